@@ -43,6 +43,7 @@ func SignRequired(authInstance auth.Auth) gin.HandlerFunc {
 			return
 		}
 
+		c.Set(filesystem.SignedRequestKey, true)
 		c.Next()
 	}
 }
@@ -55,13 +56,28 @@ func CurrentUser() gin.HandlerFunc {
 		if uid != nil {
 			user, err := model.GetActiveUserByID(uid)
 			if err == nil {
-				c.Set("user", &user)
+				if sessionExpiredByEpoch(session.Get("session_epoch"), &user) {
+					util.DeleteSession(c, "user_id")
+				} else {
+					c.Set("user", &user)
+				}
 			}
 		}
 		c.Next()
 	}
 }
 
+// sessionExpiredByEpoch 返回会话是否因用户更改密码而失效。
+// 未记录会话纪元的会话视为纪元 0
+func sessionExpiredByEpoch(epoch interface{}, user *model.User) bool {
+	if !model.IsTrueVal(model.GetSettingByNameWithDefault("logout_on_password_change", "1")) {
+		return false
+	}
+
+	sessionEpoch, _ := epoch.(uint64)
+	return sessionEpoch != user.SessionEpoch
+}
+
 // AuthRequired 需要登录
 func AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -125,6 +141,13 @@ func WebDAVAuth() gin.HandlerFunc {
 // 对上传会话进行验证
 func UseUploadSession(policyType string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 客户端与存储端的回调可能先后到达，会话已完成时直接返回成功
+		if sessionID := c.Param("sessionID"); sessionID != "" && filesystem.IsUploadSessionDone(sessionID) {
+			c.JSON(200, serializer.Response{})
+			c.Abort()
+			return
+		}
+
 		// 验证key并查找用户
 		resp := uploadCallbackCheck(c, policyType)
 		if resp.Code != 0 {
@@ -180,6 +203,13 @@ func RemoteCallbackAuth() gin.HandlerFunc {
 			return
 		}
 
+		// 防止回调请求被重放
+		if err := auth.CheckNonce(c.Request, int64(model.GetIntSetting("callback_clock_skew", 300))); err != nil {
+			c.JSON(CallbackFailedStatusCode, serializer.Err(serializer.CodeCredentialInvalid, err.Error(), err))
+			c.Abort()
+			return
+		}
+
 		c.Next()
 
 	}
@@ -288,7 +318,7 @@ func OneDriveCallbackAuth() gin.HandlerFunc {
 func IsAdmin() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, _ := c.Get("user")
-		if user.(*model.User).Group.ID != 1 && user.(*model.User).ID != 1 {
+		if !user.(*model.User).IsAdmin() {
 			c.JSON(200, serializer.Err(serializer.CodeNoPermissionErr, "", nil))
 			c.Abort()
 			return
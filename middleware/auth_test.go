@@ -64,6 +64,49 @@ func TestCurrentUser(t *testing.T) {
 	user, _ = c.Get("user")
 	asserts.NotNil(user)
 	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 用户已更改密码，会话失效
+	cache.Set("setting_logout_on_password_change", "1", 0)
+	c, _ = gin.CreateTestContext(rec)
+	c.Request, _ = http.NewRequest("GET", "/test", nil)
+	sessionFunc(c)
+	util.SetSession(c, map[string]interface{}{"user_id": 1, "session_epoch": uint64(1)})
+	rows = sqlmock.NewRows([]string{"id", "deleted_at", "email", "options", "session_epoch"}).
+		AddRow(1, nil, "admin@cloudreve.org", "{}", 2)
+	mock.ExpectQuery("^SELECT (.+)").WillReturnRows(rows)
+	CurrentUser()(c)
+	user, _ = c.Get("user")
+	asserts.Nil(user)
+	asserts.Nil(util.GetSession(c, "user_id"))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 会话纪元一致
+	c, _ = gin.CreateTestContext(rec)
+	c.Request, _ = http.NewRequest("GET", "/test", nil)
+	sessionFunc(c)
+	util.SetSession(c, map[string]interface{}{"user_id": 1, "session_epoch": uint64(2)})
+	rows = sqlmock.NewRows([]string{"id", "deleted_at", "email", "options", "session_epoch"}).
+		AddRow(1, nil, "admin@cloudreve.org", "{}", 2)
+	mock.ExpectQuery("^SELECT (.+)").WillReturnRows(rows)
+	CurrentUser()(c)
+	user, _ = c.Get("user")
+	asserts.NotNil(user)
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 未启用更改密码后登出
+	cache.Set("setting_logout_on_password_change", "0", 0)
+	c, _ = gin.CreateTestContext(rec)
+	c.Request, _ = http.NewRequest("GET", "/test", nil)
+	sessionFunc(c)
+	util.SetSession(c, map[string]interface{}{"user_id": 1, "session_epoch": uint64(1)})
+	rows = sqlmock.NewRows([]string{"id", "deleted_at", "email", "options", "session_epoch"}).
+		AddRow(1, nil, "admin@cloudreve.org", "{}", 2)
+	mock.ExpectQuery("^SELECT (.+)").WillReturnRows(rows)
+	CurrentUser()(c)
+	user, _ = c.Get("user")
+	asserts.NotNil(user)
+	asserts.NoError(mock.ExpectationsWereMet())
+	cache.Deletes([]string{"logout_on_password_change"}, "setting_")
 }
 
 func TestAuthRequired(t *testing.T) {
@@ -272,6 +315,21 @@ func TestUseUploadSession(t *testing.T) {
 		asserts.NoError(mock.ExpectationsWereMet())
 		asserts.False(c.IsAborted())
 	}
+
+	// 会话已由先到达的回调完成
+	{
+		cache.Set(filesystem.UploadSessionDonePrefix+"testCallBackDone", uint(1), 0)
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Params = []gin.Param{
+			{"sessionID", "testCallBackDone"},
+		}
+		c.Request, _ = http.NewRequest("POST", "/api/v3/callback/remote/testCallBackDone", nil)
+		AuthFunc(c)
+		asserts.True(c.IsAborted())
+		asserts.Equal(200, rec.Code)
+		asserts.Contains(rec.Body.String(), `"code":0`)
+	}
 }
 
 func TestUploadCallbackCheck(t *testing.T) {
@@ -346,10 +404,40 @@ func TestRemoteCallbackAuth(t *testing.T) {
 			Policy:      model.Policy{SecretKey: "123"},
 		})
 		c.Request, _ = http.NewRequest("POST", "/api/v3/callback/remote/testCallBackRemote", nil)
+		c.Request.Header = auth.NonceHeader()
 		authInstance := auth.HMACAuth{SecretKey: []byte("123")}
 		auth.SignRequest(authInstance, c.Request, 0)
 		AuthFunc(c)
 		asserts.False(c.IsAborted())
+
+		// 重放
+		signed := c.Request.Header
+		c, _ = gin.CreateTestContext(rec)
+		c.Set(filesystem.UploadSessionCtx, &serializer.UploadSession{
+			UID:         1,
+			VirtualPath: "/",
+			Policy:      model.Policy{SecretKey: "123"},
+		})
+		replayed, _ := http.NewRequest("POST", "/api/v3/callback/remote/testCallBackRemote", nil)
+		replayed.Header = signed
+		c.Request = replayed
+		AuthFunc(c)
+		asserts.True(c.IsAborted())
+	}
+
+	// 缺少 nonce
+	{
+		c, _ := gin.CreateTestContext(rec)
+		c.Set(filesystem.UploadSessionCtx, &serializer.UploadSession{
+			UID:         1,
+			VirtualPath: "/",
+			Policy:      model.Policy{SecretKey: "123"},
+		})
+		c.Request, _ = http.NewRequest("POST", "/api/v3/callback/remote/testCallBackRemote", nil)
+		authInstance := auth.HMACAuth{SecretKey: []byte("123")}
+		auth.SignRequest(authInstance, c.Request, 0)
+		AuthFunc(c)
+		asserts.True(c.IsAborted())
 	}
 
 	// 签名错误
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// Impersonation 管理员会话处于模拟状态时，将上下文中的用户替换为被模拟的用户，
+// 并记录实际操作的管理员。模拟已过期、管理员身份变化或失去模拟权限时结束模拟。
+// 需在 CurrentUser 之后使用
+func Impersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		targetID, ok := session.Get("impersonate_uid").(uint)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		var admin *model.User
+		if user, ok := c.Get("user"); ok {
+			admin, _ = user.(*model.User)
+		}
+
+		adminID, _ := session.Get("impersonate_admin").(uint)
+		expires, _ := session.Get("impersonate_expires").(int64)
+		if admin == nil || admin.ID != adminID || time.Now().Unix() >= expires {
+			endImpersonation(c, adminID, targetID, "expired")
+			c.Next()
+			return
+		}
+
+		target, err := model.GetActiveUserByID(targetID)
+		if err != nil || !admin.CanImpersonate(&target) {
+			endImpersonation(c, adminID, targetID, "permission revoked")
+			c.Next()
+			return
+		}
+
+		util.Log().Info("[Audit] Admin %q (#%d) acting as user %q (#%d): %s %s",
+			admin.Email, admin.ID, target.Email, target.ID, c.Request.Method, c.Request.URL.Path)
+		c.Set("user", &target)
+		c.Set("impersonator", admin)
+		c.Next()
+	}
+}
+
+// endImpersonation 清除会话中的模拟状态
+func endImpersonation(c *gin.Context, adminID, targetID uint, reason string) {
+	session := sessions.Default(c)
+	session.Delete("impersonate_uid")
+	session.Delete("impersonate_admin")
+	session.Delete("impersonate_expires")
+	if err := session.Save(); err != nil {
+		util.Log().Warning("Failed to clear impersonation session: %s", err)
+	}
+
+	util.Log().Info("[Audit] Admin #%d stopped acting as user #%d: %s.", adminID, targetID, reason)
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpersonation(t *testing.T) {
+	asserts := assert.New(t)
+	rec := httptest.NewRecorder()
+	sessionFunc := Session("233")
+	admin := &model.User{Email: "admin@cloudreve.org"}
+	admin.ID = 1
+	admin.Group.ID = 1
+	admin.Group.OptionsSerialized.Impersonate = true
+	newContext := func(session map[string]interface{}) *gin.Context {
+		c, _ := gin.CreateTestContext(rec)
+		c.Request, _ = http.NewRequest("GET", "/test", nil)
+		sessionFunc(c)
+		if session != nil {
+			util.SetSession(c, session)
+		}
+		c.Set("user", admin)
+		return c
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+
+	// 未处于模拟状态
+	{
+		c := newContext(nil)
+		Impersonation()(c)
+		user, _ := c.Get("user")
+		asserts.Equal(admin, user)
+		_, ok := c.Get("impersonator")
+		asserts.False(ok)
+	}
+
+	// 已过期
+	{
+		c := newContext(map[string]interface{}{
+			"impersonate_uid":     uint(2),
+			"impersonate_admin":   uint(1),
+			"impersonate_expires": time.Now().Add(-time.Second).Unix(),
+		})
+		Impersonation()(c)
+		user, _ := c.Get("user")
+		asserts.Equal(admin, user)
+		asserts.Nil(util.GetSession(c, "impersonate_uid"))
+	}
+
+	// 会话属于其他管理员
+	{
+		c := newContext(map[string]interface{}{
+			"impersonate_uid":     uint(2),
+			"impersonate_admin":   uint(3),
+			"impersonate_expires": expires,
+		})
+		Impersonation()(c)
+		user, _ := c.Get("user")
+		asserts.Equal(admin, user)
+		asserts.Nil(util.GetSession(c, "impersonate_uid"))
+	}
+
+	// 目标用户为管理员
+	{
+		c := newContext(map[string]interface{}{
+			"impersonate_uid":     uint(2),
+			"impersonate_admin":   uint(1),
+			"impersonate_expires": expires,
+		})
+		mock.ExpectQuery("SELECT(.+)users(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "group_id"}).AddRow(2, 1))
+		mock.ExpectQuery("SELECT(.+)groups(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		Impersonation()(c)
+		asserts.NoError(mock.ExpectationsWereMet())
+		user, _ := c.Get("user")
+		asserts.Equal(admin, user)
+		asserts.Nil(util.GetSession(c, "impersonate_uid"))
+	}
+
+	// 成功
+	{
+		c := newContext(map[string]interface{}{
+			"impersonate_uid":     uint(2),
+			"impersonate_admin":   uint(1),
+			"impersonate_expires": expires,
+		})
+		mock.ExpectQuery("SELECT(.+)users(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "group_id"}).AddRow(2, 2))
+		mock.ExpectQuery("SELECT(.+)groups(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		Impersonation()(c)
+		asserts.NoError(mock.ExpectationsWereMet())
+		user, _ := c.Get("user")
+		asserts.EqualValues(2, user.(*model.User).ID)
+		impersonator, _ := c.Get("impersonator")
+		asserts.Equal(admin, impersonator)
+	}
+}
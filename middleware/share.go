@@ -115,15 +115,7 @@ func BeforeShareDownload() gin.HandlerFunc {
 					return
 				}
 
-				// 对积分、下载次数进行更新
-				err = share.DownloadBy(user, c)
-				if err != nil {
-					c.JSON(200, serializer.Err(serializer.CodeGroupNotAllowed, err.Error(),
-						nil))
-					c.Abort()
-					return
-				}
-
+				// 下载次数在文件系统读取文件时计入，见 filesystem.WithShareDownload
 				c.Next()
 				return
 			}
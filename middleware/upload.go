@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/gin-gonic/gin"
+)
+
+// uploadRetryAfter 上传请求被拒绝时建议客户端重试的间隔，单位为秒
+const uploadRetryAfter = 5
+
+// uploadLimiter 限制全站同时处理的上传请求数，超出部分排队等待或被拒绝
+type uploadLimiter struct {
+	slots   chan struct{}
+	queue   chan struct{}
+	timeout time.Duration
+}
+
+func newUploadLimiter(max, queueSize int, timeout time.Duration) *uploadLimiter {
+	return &uploadLimiter{
+		slots:   make(chan struct{}, max),
+		queue:   make(chan struct{}, queueSize),
+		timeout: timeout,
+	}
+}
+
+// acquire 获取处理名额，队列已满、等待超时或 ctx 取消时返回 false
+func (l *uploadLimiter) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	// 进入等待队列
+	select {
+	case l.queue <- struct{}{}:
+		defer func() { <-l.queue }()
+	default:
+		return false
+	}
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release 归还处理名额
+func (l *uploadLimiter) release() {
+	<-l.slots
+}
+
+// UploadConcurrencyLimit 限制全站同时处理的上传请求数，名额在整个请求处理完成
+// 或客户端断开后归还。未设定上限时不做限制
+func UploadConcurrencyLimit() gin.HandlerFunc {
+	if conf.SystemConfig.MaxConcurrentUploads <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	limiter := newUploadLimiter(
+		conf.SystemConfig.MaxConcurrentUploads,
+		conf.SystemConfig.UploadQueueSize,
+		time.Duration(conf.SystemConfig.UploadQueueTimeout)*time.Second,
+	)
+	return func(c *gin.Context) {
+		if !limiter.acquire(c.Request.Context()) {
+			c.Header("Retry-After", strconv.Itoa(uploadRetryAfter))
+			c.JSON(http.StatusServiceUnavailable, serializer.Err(serializer.CodeServerBusy, "Too many uploads in progress, please retry later", nil))
+			c.Abort()
+			return
+		}
+
+		defer limiter.release()
+		c.Next()
+	}
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadLimiter(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+
+	// 名额未满
+	{
+		limiter := newUploadLimiter(1, 0, time.Second)
+		asserts.True(limiter.acquire(ctx))
+		limiter.release()
+		asserts.True(limiter.acquire(ctx))
+	}
+
+	// 无等待队列时直接拒绝
+	{
+		limiter := newUploadLimiter(1, 0, time.Second)
+		asserts.True(limiter.acquire(ctx))
+		asserts.False(limiter.acquire(ctx))
+	}
+
+	// 排队等待至名额归还
+	{
+		limiter := newUploadLimiter(1, 1, time.Second)
+		asserts.True(limiter.acquire(ctx))
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			limiter.release()
+		}()
+		asserts.True(limiter.acquire(ctx))
+	}
+
+	// 等待超时
+	{
+		limiter := newUploadLimiter(1, 1, 10*time.Millisecond)
+		asserts.True(limiter.acquire(ctx))
+		asserts.False(limiter.acquire(ctx))
+		asserts.Len(limiter.queue, 0)
+	}
+
+	// 队列已满
+	{
+		limiter := newUploadLimiter(1, 1, time.Second)
+		asserts.True(limiter.acquire(ctx))
+		limiter.queue <- struct{}{}
+		asserts.False(limiter.acquire(ctx))
+	}
+
+	// 客户端断开后退出队列
+	{
+		limiter := newUploadLimiter(1, 1, time.Minute)
+		asserts.True(limiter.acquire(ctx))
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		asserts.False(limiter.acquire(cancelCtx))
+		asserts.Len(limiter.queue, 0)
+	}
+}
+
+func TestUploadConcurrencyLimit(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未设定上限
+	{
+		conf.SystemConfig.MaxConcurrentUploads = 0
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request, _ = http.NewRequest("POST", "/api/v3/file/upload/1/0", nil)
+		UploadConcurrencyLimit()(c)
+		asserts.False(c.IsAborted())
+	}
+
+	// 超出上限
+	{
+		conf.SystemConfig.MaxConcurrentUploads = 1
+		conf.SystemConfig.UploadQueueSize = 0
+		defer func() { conf.SystemConfig.MaxConcurrentUploads = 0 }()
+
+		testFunc := UploadConcurrencyLimit()
+		release := make(chan struct{})
+		started := make(chan struct{})
+		router := gin.New()
+		router.POST("/upload", testFunc, func(c *gin.Context) {
+			close(started)
+			<-release
+		})
+		router.POST("/other", testFunc)
+
+		done := make(chan struct{})
+		go func() {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/upload", nil)
+			router.ServeHTTP(rec, req)
+			close(done)
+		}()
+		<-started
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/other", nil)
+		router.ServeHTTP(rec, req)
+		asserts.Equal(http.StatusServiceUnavailable, rec.Code)
+		asserts.Equal("5", rec.Header().Get("Retry-After"))
+
+		// 处理完成后归还名额
+		close(release)
+		<-done
+		rec = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/other", nil)
+		router.ServeHTTP(rec, req)
+		asserts.Equal(http.StatusOK, rec.Code)
+	}
+}
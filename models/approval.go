@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+)
+
+// IsPendingApproval 文件是否正在等待管理员审核
+func (file *File) IsPendingApproval() bool {
+	return file.PendingApproval != nil
+}
+
+// MarkPendingApproval 将文件标记为待审核。待审核的文件仍计入所有者的已用容量，
+// 所有者可正常访问，但不会出现在分享中
+func (file *File) MarkPendingApproval() error {
+	now := time.Now()
+	if err := DB.Model(&File{}).Where("id = ?", file.ID).UpdateColumn("pending_approval", now).Error; err != nil {
+		return err
+	}
+
+	file.PendingApproval = &now
+	return nil
+}
+
+// Approve 审核通过，文件恢复为普通文件
+func (file *File) Approve() error {
+	if err := DB.Model(&File{}).Where("id = ?", file.ID).UpdateColumn("pending_approval", nil).Error; err != nil {
+		return err
+	}
+
+	file.PendingApproval = nil
+	return nil
+}
+
+// GetPendingApprovalFilesByIDs 根据 ID 批量获取待审核的文件
+func GetPendingApprovalFilesByIDs(ids []uint) ([]File, error) {
+	var files []File
+	result := DB.Where("id in (?) AND pending_approval is not NULL", ids).Find(&files)
+	return files, result.Error
+}
+
+// SetRequireApproval 设定上传至此目录的文件是否需经管理员审核
+func (folder *Folder) SetRequireApproval(required bool) error {
+	folder.RequireApproval = required
+	return DB.Model(folder).UpdateColumn("require_approval", required).Error
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile_MarkPendingApproval(t *testing.T) {
+	a := assert.New(t)
+
+	// 标记成功
+	{
+		file := File{}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)pending_approval(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		a.NoError(file.MarkPendingApproval())
+		a.NoError(mock.ExpectationsWereMet())
+		a.True(file.IsPendingApproval())
+	}
+
+	// 更新失败
+	{
+		file := File{}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		a.Error(file.MarkPendingApproval())
+		a.NoError(mock.ExpectationsWereMet())
+		a.False(file.IsPendingApproval())
+	}
+}
+
+func TestFile_Approve(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	file := File{PendingApproval: &now}
+	file.ID = 2
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)pending_approval(.+)").WithArgs(nil, 2).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	a.NoError(file.Approve())
+	a.NoError(mock.ExpectationsWereMet())
+	a.False(file.IsPendingApproval())
+}
+
+func TestGetPendingApprovalFilesByIDs(t *testing.T) {
+	a := assert.New(t)
+	mock.ExpectQuery("SELECT(.+)pending_approval is not NULL(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "pending_approval"}).AddRow(1, time.Now()))
+	files, err := GetPendingApprovalFilesByIDs([]uint{1, 2})
+	a.NoError(err)
+	a.NoError(mock.ExpectationsWereMet())
+	a.Len(files, 1)
+	a.True(files[0].IsPendingApproval())
+}
+
+func TestFolder_SetRequireApproval(t *testing.T) {
+	a := assert.New(t)
+	folder := Folder{}
+	folder.ID = 1
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)folders(.+)require_approval(.+)").WithArgs(true, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	a.NoError(folder.SetRequireApproval(true))
+	a.NoError(mock.ExpectationsWereMet())
+	a.True(folder.RequireApproval)
+}
@@ -25,13 +25,25 @@ var defaultSettings = []Setting{
 	{Name: "smtpUser", Value: `no-reply@acg.blue`, Type: "mail"},
 	{Name: "smtpPass", Value: ``, Type: "mail"},
 	{Name: "smtpEncryption", Value: `0`, Type: "mail"},
+	{Name: "notify_backend", Value: `email`, Type: "notify"},
+	{Name: "notify_webhook_url", Value: ``, Type: "notify"},
+	{Name: "notify_webhook_timeout", Value: `10`, Type: "notify"},
+	{Name: "notify_quota_warning_to", Value: `user`, Type: "notify"},
+	{Name: "notify_quarantine_to", Value: `admin`, Type: "notify"},
+	{Name: "notify_sensitive_data_to", Value: `admin`, Type: "notify"},
+	{Name: "notify_source_broken_to", Value: `user,admin`, Type: "notify"},
+	{Name: "notify_approval_pending_to", Value: `admin`, Type: "notify"},
+	{Name: "notify_upload_rejected_to", Value: `user`, Type: "notify"},
+	{Name: "notify_quota_warning_percent", Value: `0`, Type: "notify"},
 	{Name: "maxEditSize", Value: `4194304`, Type: "file_edit"},
 	{Name: "archive_timeout", Value: `600`, Type: "timeout"},
 	{Name: "download_timeout", Value: `600`, Type: "timeout"},
 	{Name: "preview_timeout", Value: `600`, Type: "timeout"},
 	{Name: "doc_preview_timeout", Value: `600`, Type: "timeout"},
 	{Name: "upload_session_timeout", Value: `86400`, Type: "timeout"},
+	{Name: "file_unlock_ttl", Value: `3600`, Type: "timeout"},
 	{Name: "slave_api_timeout", Value: `60`, Type: "timeout"},
+	{Name: "sign_clock_skew", Value: `30`, Type: "timeout"},
 	{Name: "slave_node_retry", Value: `3`, Type: "slave"},
 	{Name: "slave_ping_interval", Value: `60`, Type: "slave"},
 	{Name: "slave_recover_interval", Value: `120`, Type: "slave"},
@@ -39,11 +51,73 @@ var defaultSettings = []Setting{
 	{Name: "onedrive_monitor_timeout", Value: `600`, Type: "timeout"},
 	{Name: "share_download_session_timeout", Value: `2073600`, Type: "timeout"},
 	{Name: "onedrive_callback_check", Value: `20`, Type: "timeout"},
+	{Name: "callback_clock_skew", Value: `300`, Type: "timeout"},
 	{Name: "folder_props_timeout", Value: `300`, Type: "timeout"},
+	{Name: "webdav_lock_timeout", Value: `3600`, Type: "timeout"},
+	{Name: "content_address_lock_timeout", Value: `300`, Type: "timeout"},
+	{Name: "webdav_propfind_max_entries", Value: `10000`, Type: "upload"},
+	{Name: "webdav_propfind_overflow", Value: `truncate`, Type: "upload"},
+	{Name: "reserved_name_strategy", Value: `reject`, Type: "upload"},
+	{Name: "reserved_name_prefix", Value: `_`, Type: "upload"},
+	{Name: "reserved_names", Value: `CON,PRN,AUX,NUL,COM1,COM2,COM3,COM4,COM5,COM6,COM7,COM8,COM9,LPT1,LPT2,LPT3,LPT4,LPT5,LPT6,LPT7,LPT8,LPT9`, Type: "upload"},
 	{Name: "chunk_retries", Value: `5`, Type: "retry"},
+	{Name: "multipart_complete_retries", Value: `3`, Type: "retry"},
 	{Name: "onedrive_source_timeout", Value: `1800`, Type: "timeout"},
 	{Name: "reset_after_upload_failed", Value: `0`, Type: "upload"},
+	{Name: "local_symlink_policy", Value: `restrict`, Type: "upload"},
 	{Name: "use_temp_chunk_buffer", Value: `1`, Type: "upload"},
+	{Name: "download_compress_enabled", Value: `0`, Type: "download"},
+	{Name: "download_compress_min_size", Value: `1024`, Type: "download"},
+	{Name: "etag_strategy", Value: `size_mtime`, Type: "download"},
+	{Name: "download_compress_types", Value: `text/,application/json,application/javascript,application/xml,image/svg+xml`, Type: "download"},
+	{Name: "download_buffer_size", Value: `262144`, Type: "download"},
+	{Name: "download_buffer_count", Value: `64`, Type: "download"},
+	{Name: "upload_session_bind_ip", Value: `0`, Type: "upload"},
+	{Name: "upload_session_bind_ipv4_prefix", Value: `24`, Type: "upload"},
+	{Name: "upload_session_bind_ipv6_prefix", Value: `64`, Type: "upload"},
+	{Name: "upload_geoip_enabled", Value: `0`, Type: "upload"},
+	{Name: "upload_geoip_database", Value: ``, Type: "upload"},
+	{Name: "upload_geoip_policy", Value: `deny`, Type: "upload"},
+	{Name: "upload_geoip_countries", Value: ``, Type: "upload"},
+	{Name: "upload_geoip_fail_open", Value: `1`, Type: "upload"},
+	{Name: "upload_encryption_min_entropy", Value: `7.5`, Type: "upload"},
+	{Name: "upload_encryption_sample_size", Value: `4096`, Type: "upload"},
+	{Name: "hook_retry_max_attempts", Value: `5`, Type: "upload"},
+	{Name: "hook_retry_interval", Value: `60`, Type: "upload"},
+	{Name: "hook_retry_max_interval", Value: `21600`, Type: "upload"},
+	{Name: "url_upload_allowed_hosts", Value: ``, Type: "upload"},
+	{Name: "url_upload_denied_hosts", Value: ``, Type: "upload"},
+	{Name: "url_upload_max_redirects", Value: `5`, Type: "upload"},
+	{Name: "webdav_dead_props_max_size", Value: `65536`, Type: "upload"},
+	{Name: "webdav_auto_create_parent", Value: `1`, Type: "upload"},
+	{Name: "max_path_depth", Value: `64`, Type: "upload"},
+	{Name: "upload_default_permission", Value: `private`, Type: "upload"},
+	{Name: "upload_collision_policy", Value: `error`, Type: "upload"},
+	{Name: "trash_retention_days", Value: `30`, Type: "upload"},
+	{Name: "trash_purge_batch_size", Value: `1000`, Type: "task"},
+	{Name: "upload_deadline_base", Value: `600`, Type: "timeout"},
+	{Name: "upload_finalize_timeout", Value: `30`, Type: "timeout"},
+	{Name: "upload_deadline_min_speed", Value: `10240`, Type: "upload"},
+	{Name: "upload_batch_max_files", Value: `50`, Type: "upload"},
+	{Name: "upload_batch_max_size", Value: `104857600`, Type: "upload"},
+	{Name: "upload_spool_threshold", Value: `33554432`, Type: "upload"},
+	{Name: "upload_spool_path", Value: ``, Type: "upload"},
+	{Name: "quarantine_notify_admin", Value: `1`, Type: "upload"},
+	{Name: "upload_approval_groups", Value: ``, Type: "upload"},
+	{Name: "upload_staging", Value: `auto`, Type: "upload"},
+	{Name: "upload_staging_policy", Value: `0`, Type: "upload"},
+	{Name: "object_sharding", Value: `1`, Type: "upload"},
+	{Name: "checksum_algorithm", Value: ``, Type: "upload"},
+	{Name: "unique_name_exts", Value: ``, Type: "upload"},
+	{Name: "unique_name_scope", Value: `user`, Type: "upload"},
+	{Name: "dlp_enabled", Value: `0`, Type: "upload"},
+	{Name: "dlp_action", Value: `tag`, Type: "upload"},
+	{Name: "dlp_max_size", Value: `4194304`, Type: "upload"},
+	{Name: "dlp_patterns", Value: `{"credit_card":"\\b(?:4\\d{3}|5[1-5]\\d{2}|6011|3[47]\\d{2})[ -]?\\d{4}[ -]?\\d{4}[ -]?\\d{1,4}\\b","cn_id":"\\b\\d{17}[\\dXx]\\b"}`, Type: "upload"},
+	{Name: "broken_source_detect", Value: `1`, Type: "upload"},
+	{Name: "broken_source_notify", Value: `0`, Type: "upload"},
+	{Name: "archive_restore_days", Value: `1`, Type: "upload"},
+	{Name: "url_upload_timeout", Value: `3600`, Type: "timeout"},
 	{Name: "login_captcha", Value: `0`, Type: "login"},
 	{Name: "reg_captcha", Value: `0`, Type: "login"},
 	{Name: "email_active", Value: `0`, Type: "register"},
@@ -55,6 +129,8 @@ solid #e9e9e9;"bgcolor="#fff"><tr style="font-family: 'Helvetica Neue',Helvetica
 14px; margin: 0;"><td class="alert alert-warning"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 16px; vertical-align: top; color: #fff; font-weight: 500; text-align: center; border-radius: 3px 3px 0 0; background-color: #009688; margin: 0; padding: 20px;"align="center"bgcolor="#FF9F00"valign="top">激活{siteTitle}账户</td></tr><tr style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; margin: 0;"><td class="content-wrap"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; vertical-align: top; margin: 0; padding: 20px;"valign="top"><table width="100%"cellpadding="0"cellspacing="0"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; margin: 0;"><tr style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; margin: 0;"><td class="content-block"style="font-family: 'Helvetica
 Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; vertical-align: top; margin: 0; padding: 0 0 20px;"valign="top">亲爱的<strong style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; margin: 0;">{userName}</strong>：</td></tr><tr style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; margin: 0;"><td class="content-block"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; vertical-align: top; margin: 0; padding: 0 0 20px;"valign="top">感谢您注册{siteTitle},请点击下方按钮完成账户激活。</td></tr><tr style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; margin: 0;"><td class="content-block"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; vertical-align: top; margin: 0; padding: 0 0 20px;"valign="top"><a href="{activationUrl}"class="btn-primary"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; color: #FFF; text-decoration: none; line-height: 2em; font-weight: bold; text-align: center; cursor: pointer; display: inline-block; border-radius: 5px; text-transform: capitalize; background-color: #009688; margin: 0; border-color: #009688; border-style: solid; border-width: 10px 20px;">激活账户</a></td></tr><tr style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; margin: 0;"><td class="content-block"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; vertical-align: top; margin: 0; padding: 0 0 20px;"valign="top">感谢您选择{siteTitle}。</td></tr></table></td></tr></table><div class="footer"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; width: 100%; clear: both; color: #999; margin: 0; padding: 20px;"><table width="100%"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; margin: 0;"><tr style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; margin: 0;"><td class="aligncenter content-block"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 12px; vertical-align: top; color: #999; text-align: center; margin: 0; padding: 0 0 20px;"align="center"valign="top">此邮件由系统自动发送，请不要直接回复。</td></tr></table></div></div></td><td style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; vertical-align: top; margin: 0;"valign="top"></td></tr></table></body></html>`, Type: "mail_template"},
 	{Name: "forget_captcha", Value: `0`, Type: "login"},
+	{Name: "logout_on_password_change", Value: `1`, Type: "login"},
+	{Name: "impersonation_ttl", Value: `1800`, Type: "login"},
 	{Name: "mail_reset_pwd_template", Value: `<!DOCTYPE html PUBLIC"-//W3C//DTD XHTML 1.0 Transitional//EN""http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd"><html xmlns="http://www.w3.org/1999/xhtml"style="font-family: 'Helvetica Neue', Helvetica, Arial, sans-serif; box-sizing: border-box;
 font-size: 14px; margin: 0;"><head><meta name="viewport"content="width=device-width"/><meta http-equiv="Content-Type"content="text/html; charset=UTF-8"/><title>重设密码</title><style type="text/css">img{max-width:100%}body{-webkit-font-smoothing:antialiased;-webkit-text-size-adjust:none;width:100%!important;height:100%;line-height:1.6em}body{background-color:#f6f6f6}@media only screen and(max-width:640px){body{padding:0!important}h1{font-weight:800!important;margin:20px 0 5px!important}h2{font-weight:800!important;margin:20px 0 5px!important}h3{font-weight:800!important;margin:20px 0 5px!important}h4{font-weight:800!important;margin:20px 0 5px!important}h1{font-size:22px!important}h2{font-size:18px!important}h3{font-size:16px!important}.container{padding:0!important;width:100%!important}.content{padding:0!important}.content-wrap{padding:10px!important}.invoice{width:100%!important}}</style></head><body itemscope itemtype="http://schema.org/EmailMessage"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing:
 border-box; font-size: 14px; -webkit-font-smoothing: antialiased; -webkit-text-size-adjust: none; width: 100% !important; height: 100%; line-height: 1.6em; background-color: #f6f6f6; margin: 0;"bgcolor="#f6f6f6"><table class="body-wrap"style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; width: 100%; background-color: #f6f6f6; margin: 0;"bgcolor="#f6f6f6"><tr style="font-family: 'Helvetica Neue',Helvetica,Arial,sans-serif;
@@ -69,6 +145,13 @@ Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; verti
 	{Name: "themes", Value: `{"#3f51b5":{"palette":{"primary":{"main":"#3f51b5"},"secondary":{"main":"#f50057"}}},"#2196f3":{"palette":{"primary":{"main":"#2196f3"},"secondary":{"main":"#FFC107"}}},"#673AB7":{"palette":{"primary":{"main":"#673AB7"},"secondary":{"main":"#2196F3"}}},"#E91E63":{"palette":{"primary":{"main":"#E91E63"},"secondary":{"main":"#42A5F5","contrastText":"#fff"}}},"#FF5722":{"palette":{"primary":{"main":"#FF5722"},"secondary":{"main":"#3F51B5"}}},"#FFC107":{"palette":{"primary":{"main":"#FFC107"},"secondary":{"main":"#26C6DA"}}},"#8BC34A":{"palette":{"primary":{"main":"#8BC34A","contrastText":"#fff"},"secondary":{"main":"#FF8A65","contrastText":"#fff"}}},"#009688":{"palette":{"primary":{"main":"#009688"},"secondary":{"main":"#4DD0E1","contrastText":"#fff"}}},"#607D8B":{"palette":{"primary":{"main":"#607D8B"},"secondary":{"main":"#F06292"}}},"#795548":{"palette":{"primary":{"main":"#795548"},"secondary":{"main":"#4CAF50","contrastText":"#fff"}}}}`, Type: "basic"},
 	{Name: "max_worker_num", Value: `10`, Type: "task"},
 	{Name: "max_parallel_transfer", Value: `4`, Type: "task"},
+	{Name: "delete_concurrency", Value: `4`, Type: "task"},
+	{Name: "migrate_concurrency", Value: `4`, Type: "task"},
+	{Name: "lifecycle_batch_size", Value: `1000`, Type: "task"},
+	{Name: "lifecycle_local_archive_path", Value: `archive`, Type: "path"},
+	{Name: "decompress_max_ratio", Value: `1000`, Type: "task"},
+	{Name: "decompress_max_size", Value: `0`, Type: "task"},
+	{Name: "decompress_max_entry_size", Value: `0`, Type: "task"},
 	{Name: "secret_key", Value: util.RandStringRunes(256), Type: "auth"},
 	{Name: "temp_path", Value: "temp", Type: "path"},
 	{Name: "avatar_path", Value: "avatar", Type: "path"},
@@ -80,6 +163,12 @@ Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; verti
 	{Name: "share_view_method", Value: "list", Type: "view"},
 	{Name: "cron_garbage_collect", Value: "@hourly", Type: "cron"},
 	{Name: "cron_recycle_upload_session", Value: "@every 1h30m", Type: "cron"},
+	{Name: "cron_thumb_cache_evict", Value: "@hourly", Type: "cron"},
+	{Name: "cron_thumb_remote_retry", Value: "@every 5m", Type: "cron"},
+	{Name: "cron_storage_calibrate", Value: "@daily", Type: "cron"},
+	{Name: "cron_lifecycle", Value: "@hourly", Type: "cron"},
+	{Name: "cron_hook_retry", Value: "@every 1m", Type: "cron"},
+	{Name: "cron_trash_purge", Value: "@hourly", Type: "cron"},
 	{Name: "authn_enabled", Value: "0", Type: "authn"},
 	{Name: "captcha_type", Value: "normal", Type: "captcha"},
 	{Name: "captcha_height", Value: "60", Type: "captcha"},
@@ -103,14 +192,51 @@ Neue',Helvetica,Arial,sans-serif; box-sizing: border-box; font-size: 14px; verti
 	{Name: "thumb_height", Value: "300", Type: "thumb"},
 	{Name: "thumb_file_suffix", Value: "._thumb", Type: "thumb"},
 	{Name: "thumb_max_task_count", Value: "-1", Type: "thumb"},
+	{Name: "thumb_max_memory", Value: "536870912", Type: "thumb"},
 	{Name: "thumb_encode_method", Value: "jpg", Type: "thumb"},
 	{Name: "thumb_gc_after_gen", Value: "0", Type: "thumb"},
+	{Name: "thumb_max_retry", Value: "3", Type: "thumb"},
+	{Name: "thumb_remote_attempts", Value: "3", Type: "thumb"},
+	{Name: "thumb_remote_retry_interval", Value: "60", Type: "thumb"},
+	{Name: "thumb_remote_max_retry", Value: "10", Type: "thumb"},
 	{Name: "thumb_encode_quality", Value: "85", Type: "thumb"},
+	{Name: "thumb_cache_enabled", Value: "0", Type: "thumb"},
+	{Name: "thumb_cache_max_size", Value: "1073741824", Type: "thumb"},
+	{Name: "thumb_refresh_on_update", Value: "eager", Type: "thumb"},
+	{Name: "thumb_convert_srgb", Value: "1", Type: "thumb"},
+	{Name: "image_srgb_quality", Value: "92", Type: "thumb"},
+	{Name: "image_phash_enabled", Value: "1", Type: "thumb"},
+	{Name: "image_exif_enabled", Value: "1", Type: "thumb"},
+	{Name: "image_capture_date_display", Value: "0", Type: "thumb"},
+	{Name: "image_phash_distance", Value: "8", Type: "thumb"},
+	{Name: "folder_cover_auto", Value: "1", Type: "thumb"},
+	{Name: "antivirus_clamd_address", Value: "tcp://127.0.0.1:3310", Type: "antivirus"},
+	{Name: "antivirus_timeout", Value: "300", Type: "antivirus"},
 	{Name: "pwa_small_icon", Value: "/static/img/favicon.ico", Type: "pwa"},
 	{Name: "pwa_medium_icon", Value: "/static/img/logo192.png", Type: "pwa"},
 	{Name: "pwa_large_icon", Value: "/static/img/logo512.png", Type: "pwa"},
 	{Name: "pwa_display", Value: "standalone", Type: "pwa"},
 	{Name: "pwa_theme_color", Value: "#000000", Type: "pwa"},
 	{Name: "pwa_background_color", Value: "#ffffff", Type: "pwa"},
+	{Name: "text_stat_enabled", Value: "1", Type: "text"},
+	{Name: "text_stat_exts", Value: "txt,md,markdown,csv,tsv,log,json,xml,yaml,yml,toml,ini,conf,html,htm,css,js,ts,go,py,java,c,cc,cpp,h,hpp,cs,rs,rb,php,sh,sql", Type: "text"},
+	{Name: "text_stat_max_size", Value: "4194304", Type: "text"},
+	{Name: "video_transcode_enabled", Value: "0", Type: "transcode"},
+	{Name: "video_transcode_exts", Value: "mkv,avi,wmv,flv,mov,rm,rmvb,ts,m2ts,mpg,mpeg,3gp", Type: "transcode"},
+	{Name: "video_transcode_replace", Value: "0", Type: "transcode"},
+	{Name: "video_transcode_ffmpeg", Value: "ffmpeg", Type: "transcode"},
+	{Name: "video_transcode_ffprobe", Value: "ffprobe", Type: "transcode"},
+	{Name: "video_transcode_timeout", Value: "7200", Type: "transcode"},
+	{Name: "hls_exts", Value: "mp4,m4v,mkv,mov,avi,wmv,flv,webm,ts,m2ts,mpg,mpeg,3gp", Type: "transcode"},
+	{Name: "hls_segment_duration", Value: "6", Type: "transcode"},
+	{Name: "hls_pregenerate_timeout", Value: "7200", Type: "transcode"},
+	{Name: "video_probe_enabled", Value: "0", Type: "transcode"},
+	{Name: "video_probe_exts", Value: "mp4,m4v,mkv,webm,avi,wmv,flv,mov,rm,rmvb,ts,m2ts,mpg,mpeg,3gp", Type: "transcode"},
+	{Name: "video_probe_timeout", Value: "60", Type: "transcode"},
+	{Name: "doc_preview_enabled", Value: "0", Type: "preview"},
+	{Name: "doc_preview_exts", Value: "doc,docx,xls,xlsx,ppt,pptx,odt,ods,odp,rtf", Type: "preview"},
+	{Name: "doc_preview_soffice", Value: "soffice", Type: "preview"},
+	{Name: "doc_preview_convert_timeout", Value: "300", Type: "preview"},
+	{Name: "doc_preview_max_task_count", Value: "2", Type: "preview"},
 	{Name: "office_preview_service", Value: "https://view.officeapps.live.com/op/view.aspx?src={$src}", Type: "preview"},
 }
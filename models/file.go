@@ -1,11 +1,15 @@
 package model
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
@@ -16,16 +20,40 @@ import (
 type File struct {
 	// 表字段
 	gorm.Model
-	Name            string `gorm:"unique_index:idx_only_one"`
-	SourceName      string `gorm:"type:text"`
-	UserID          uint   `gorm:"index:user_id;unique_index:idx_only_one"`
-	Size            uint64
-	PicInfo         string
-	FolderID        uint `gorm:"index:folder_id;unique_index:idx_only_one"`
-	PolicyID        uint
-	UploadSessionID *string `gorm:"index:session_id;unique_index:session_only_one"`
-	Metadata        string  `gorm:"type:text"`
-	MD5             string  `gorm:"type:text"`
+	Name             string `gorm:"unique_index:idx_only_one"`
+	SourceName       string `gorm:"type:text"`
+	UserID           uint   `gorm:"index:user_id;unique_index:idx_only_one"`
+	Size             uint64
+	PicInfo          string
+	FolderID         uint `gorm:"index:folder_id;unique_index:idx_only_one"`
+	PolicyID         uint
+	UploadSessionID  *string `gorm:"index:session_id;unique_index:session_only_one"`
+	Metadata         string  `gorm:"type:text"`
+	MD5              string  `gorm:"type:text"`
+	Checksum         string  `gorm:"size:80"` // 文件内容的校验值，格式为 算法:十六进制摘要
+	PHash            int64   // 图像感知哈希，0 表示未计算
+	ThumbStatus      string  `gorm:"size:16;index:thumb_status"`
+	ThumbRetries     int
+	ThumbRetryAt     *time.Time `gorm:"index:thumb_retry_at"` // 远程生成缩略图失败后下次重试的时间
+	ThumbSize        uint64     // 服务端生成的缩略图占用的空间
+	ThumbAccessedAt  *time.Time `gorm:"index:thumb_accessed_at"` // 缩略图最后访问时间，用于缓存淘汰
+	UploadClient     string     `gorm:"size:32"`                 // 上传此文件的客户端
+	RetainUntil      *time.Time // 保留期截止时间，此前不可删除或修改，空值表示不受限制
+	QuarantinedAt    *time.Time `gorm:"index:quarantined_at"` // 隔离时间，非空表示文件已被隔离，对所有者不可见
+	QuarantineReason string     `gorm:"type:text"`
+	TrashedAt        *time.Time `gorm:"index:trashed_at"` // 移入回收站的时间，非空表示文件在回收站中，对所有者不可见
+	PendingApproval  *time.Time `gorm:"index:pending_approval"` // 提交审核的时间，非空表示文件正在等待管理员审核
+	SourceBroken     bool       `gorm:"index:source_broken"`           // 存储端对象已丢失
+	TranscodedSource string     `gorm:"type:text"`                     // 转码后可在浏览器中播放的衍生文件物理路径
+	DocPreviewSource string     `gorm:"type:text"`                     // 文档转换生成的 PDF 预览衍生文件物理路径
+	HLSPlaylist      string     `gorm:"type:text" json:"-"`            // 预生成的 HLS 播放列表，分段地址相对于分段所在目录
+	Shards           string     `gorm:"type:text" json:"-"`            // 拆分为多个对象存储时的分片清单，为空表示以单个对象存储
+	StorageClass     string     `gorm:"size:32"`                       // 存储端的存储类型，为空表示存储端默认类型
+	RestoreStatus    string     `gorm:"size:16"`                       // 归档存储类型的解冻状态
+	TransitionAt     *time.Time `gorm:"index:transition_at"`           // 按生命周期规则计划转换存储类型的时间
+	ExpireAt         *time.Time `gorm:"index:expire_at"`               // 按生命周期规则计划删除的时间
+	Password         string     `gorm:"type:text" json:"-"`            // 下载密码的加盐摘要，为空表示未设定
+	NameKey          *string    `gorm:"size:64;unique_index:name_key"` // 需在 unique_name_scope 范围内唯一的文件名的摘要
 
 	// 关联模型
 	Policy Policy `gorm:"PRELOAD:false,association_autoupdate:false"`
@@ -35,6 +63,22 @@ type File struct {
 	MetadataSerialized map[string]string `gorm:"-"`
 }
 
+// 归档文件解冻状态
+const (
+	RestoreStatusNone      = ""
+	RestoreStatusRestoring = "restoring"
+	RestoreStatusRestored  = "restored"
+)
+
+// 缩略图生成状态
+const (
+	ThumbStatusPending     = ""
+	ThumbStatusOK          = "ok"
+	ThumbStatusFailed      = "failed"
+	ThumbStatusUnsupported = "unsupported"
+	ThumbStatusDisabled    = "disabled"
+)
+
 func init() {
 	// 注册缓存用到的复杂结构
 	gob.Register(File{})
@@ -52,7 +96,12 @@ func (file *File) Create() error {
 
 	user := &User{}
 	user.ID = file.UserID
-	if err := user.ChangeStorage(tx, "+", file.Size); err != nil {
+	if err := user.ChangeUsage(tx, "+", file.Size, 1); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := changeTypeUsage(tx, file.UserID, file.Name, "+", file.Size); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -80,7 +129,7 @@ func (file *File) BeforeSave() (err error) {
 // GetChildFile 查找目录下名为name的子文件
 func (folder *Folder) GetChildFile(name string) (*File, error) {
 	var file File
-	result := DB.Where("folder_id = ? AND name = ?", folder.ID, name).Find(&file)
+	result := DB.Where("folder_id = ? AND name = ? AND "+notQuarantined+" AND "+notTrashed, folder.ID, name).Find(&file)
 
 	if result.Error == nil {
 		file.Position = path.Join(folder.Position, folder.Name)
@@ -91,7 +140,7 @@ func (folder *Folder) GetChildFile(name string) (*File, error) {
 // GetChildFiles 查找目录下子文件
 func (folder *Folder) GetChildFiles() ([]File, error) {
 	var files []File
-	result := DB.Where("folder_id = ?", folder.ID).Find(&files)
+	result := DB.Where("folder_id = ? AND "+notQuarantined+" AND "+notTrashed, folder.ID).Find(&files)
 
 	if result.Error == nil {
 		for i := 0; i < len(files); i++ {
@@ -111,9 +160,9 @@ func GetFilesByIDsFromTX(tx *gorm.DB, ids []uint, uid uint) ([]File, error) {
 	var files []File
 	var result *gorm.DB
 	if uid == 0 {
-		result = tx.Where("id in (?)", ids).Find(&files)
+		result = tx.Where("id in (?) AND "+notQuarantined+" AND "+notTrashed, ids).Find(&files)
 	} else {
-		result = tx.Where("id in (?) AND user_id = ?", ids, uid).Find(&files)
+		result = tx.Where("id in (?) AND user_id = ? AND "+notQuarantined+" AND "+notTrashed, ids, uid).Find(&files)
 	}
 	return files, result.Error
 }
@@ -143,7 +192,7 @@ func GetFilesByKeywords(uid uint, parents []uint, keywords ...interface{}) ([]Fi
 		result = result.Where("folder_id in (?)", parents)
 	}
 
-	result = result.Where("("+conditions+")", keywords...).Find(&files)
+	result = result.Where(notQuarantined).Where(notTrashed).Where("("+conditions+")", keywords...).Find(&files)
 
 	return files, result.Error
 }
@@ -158,7 +207,7 @@ func GetChildFilesOfFolders(folders *[]Folder) ([]File, error) {
 
 	// 检索文件
 	var files []File
-	result := DB.Where("folder_id in (?)", folderIDs).Find(&files)
+	result := DB.Where("folder_id in (?) AND "+notQuarantined+" AND "+notTrashed, folderIDs).Find(&files)
 	return files, result.Error
 }
 
@@ -183,7 +232,8 @@ func (file *File) GetPolicy() *Policy {
 	return &file.Policy
 }
 
-// RemoveFilesWithSoftLinks 去除给定的文件列表中有软链接的文件
+// RemoveFilesWithSoftLinks 去除给定的文件列表中有软链接的文件，仅被列表内文件引用的
+// 源文件视为无软链接，同一源文件只保留一个
 func RemoveFilesWithSoftLinks(files []File) ([]File, error) {
 	// 结果值
 	filteredFiles := make([]File, 0)
@@ -192,40 +242,34 @@ func RemoveFilesWithSoftLinks(files []File) ([]File, error) {
 		return filteredFiles, nil
 	}
 
-	// 查询软链接的文件
-	filesWithSoftLinks := make([]File, 0)
+	ids := make([]uint, len(files))
+	for i, file := range files {
+		ids[i] = file.ID
+	}
+
+	// 查询列表外是否还有文件引用同一源文件
+	type source struct {
+		policyID uint
+		name     string
+	}
+	checked := make(map[source]bool, len(files))
 	for _, file := range files {
+		key := source{file.PolicyID, file.SourceName}
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+
 		var softLinkFile File
 		res := DB.
-			Where("source_name = ? and policy_id = ? and id != ?", file.SourceName, file.PolicyID, file.ID).
+			Where("source_name = ? and policy_id = ? and id not in (?)", file.SourceName, file.PolicyID, ids).
 			First(&softLinkFile)
-		if res.Error == nil {
-			filesWithSoftLinks = append(filesWithSoftLinks, softLinkFile)
-		}
-	}
-
-	// 过滤具有软连接的文件
-	// TODO: 优化复杂度
-	if len(filesWithSoftLinks) == 0 {
-		filteredFiles = files
-	} else {
-		for i := 0; i < len(files); i++ {
-			finder := false
-			for _, value := range filesWithSoftLinks {
-				if value.PolicyID == files[i].PolicyID && value.SourceName == files[i].SourceName {
-					finder = true
-					break
-				}
-			}
-			if !finder {
-				filteredFiles = append(filteredFiles, files[i])
-			}
-
+		if res.Error != nil {
+			filteredFiles = append(filteredFiles, file)
 		}
 	}
 
 	return filteredFiles, nil
-
 }
 
 // DeleteFiles 批量删除文件记录并归还容量
@@ -234,6 +278,7 @@ func DeleteFiles(files []*File, uid uint) error {
 	user := &User{}
 	user.ID = uid
 	var size uint64
+	typeSizes := make(map[string]uint64)
 	for _, file := range files {
 		if file.UserID != uid {
 			tx.Rollback()
@@ -252,20 +297,34 @@ func DeleteFiles(files []*File, uid uint) error {
 		}
 
 		size += file.Size
+		if fileType := FileTypeOf(file.Name); fileType != "" {
+			typeSizes[fileType] += file.Size
+		}
 	}
 
-	if err := user.ChangeStorage(tx, "-", size); err != nil {
+	if err := user.ChangeUsage(tx, "-", size, uint64(len(files))); err != nil {
 		tx.Rollback()
 		return err
 	}
 
+	for fileType, typeSize := range typeSizes {
+		if typeSize == 0 {
+			continue
+		}
+		if err := tx.Model(&TypeUsage{}).Where("user_id = ? AND type = ?", uid, fileType).
+			UpdateColumn("size", gorm.Expr("size - ?", typeSize)).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	return tx.Commit().Error
 }
 
 // GetFilesByParentIDs 根据父目录ID查找文件
 func GetFilesByParentIDs(ids []uint, uid uint) ([]File, error) {
 	files := make([]File, 0, len(ids))
-	result := DB.Where("user_id = ? and folder_id in (?)", uid, ids).Find(&files)
+	result := DB.Where("user_id = ? and folder_id in (?) and "+notQuarantined+" and "+notTrashed, uid, ids).Find(&files)
 	return files, result.Error
 }
 
@@ -276,9 +335,42 @@ func GetFilesByUploadSession(sessionID string, uid uint) (*File, error) {
 	return &file, result.Error
 }
 
-// Rename 重命名文件
+// Rename 重命名文件，文件类型改变时同时转移按类型统计的已用容量
 func (file *File) Rename(new string) error {
-	return DB.Model(&file).UpdateColumn("name", new).Error
+	oldName := file.Name
+	columns := map[string]interface{}{"name": new}
+
+	// 需唯一的文件名随之更新摘要，新文件名冲突时由唯一索引拒绝
+	if nameKey := UniqueNameKey(file.UserID, new); nameKey != nil || file.NameKey != nil {
+		columns["name_key"] = nameKey
+	}
+
+	if FileTypeOf(oldName) == FileTypeOf(new) || file.Size == 0 {
+		return DB.Model(&file).UpdateColumns(columns).Error
+	}
+
+	tx := DB.Begin()
+	if err := tx.Model(&file).UpdateColumns(columns).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := changeTypeUsage(tx, file.UserID, oldName, "-", file.Size); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := changeTypeUsage(tx, file.UserID, new, "+", file.Size); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// IsRetained 返回文件在 now 时是否仍处于保留期内
+func (file *File) IsRetained(now time.Time) bool {
+	return file.RetainUntil != nil && now.Before(*file.RetainUntil)
 }
 
 // UpdatePicInfo 更新文件的图像信息
@@ -314,6 +406,11 @@ func (file *File) UpdateSize(value uint64) error {
 		return err
 	}
 
+	if err := changeTypeUsage(tx, file.UserID, file.Name, operator, sizeDelta); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	file.Size = value
 	return tx.Commit().Error
 }
@@ -325,7 +422,7 @@ func (file *File) UpdateMD5(md5 string) error {
 	}
 
 	tx := DB.Begin()
-	if res := tx.Model(&file).
+	if res := tx.Model(&file).Set("gorm:association_autoupdate", false).
 		Update("md5", md5); res.Error != nil {
 		tx.Rollback()
 		return res.Error
@@ -334,6 +431,27 @@ func (file *File) UpdateMD5(md5 string) error {
 	return tx.Commit().Error
 }
 
+// UpdateChecksum 更新文件内容的校验值，algo 为空时清除
+func (file *File) UpdateChecksum(algo, digest string) error {
+	value := ""
+	if algo != "" {
+		value = algo + ":" + digest
+	}
+
+	file.Checksum = value
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("checksum", value).Error
+}
+
+// GetChecksum 返回文件内容校验值的算法及十六进制摘要，未记录时均为空
+func (file *File) GetChecksum() (string, string) {
+	i := strings.Index(file.Checksum, ":")
+	if i < 0 {
+		return "", ""
+	}
+
+	return file.Checksum[:i], file.Checksum[i+1:]
+}
+
 
 // GetFilesByMD5  搜索文件, UID为0表示忽略用户，只根据文件ID检索
 func (file *File) GetFilesByMD5(uid uint, md5s []string) ([]*File, error) {
@@ -378,6 +496,223 @@ func min(a, b int) int {
 //	return tx.Commit().Error
 //}
 
+// UpdatePHash 更新文件的图像感知哈希
+func (file *File) UpdatePHash(hash uint64) error {
+	file.PHash = int64(hash)
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("p_hash", file.PHash).Error
+}
+
+// UpdateSourceBroken 更新文件存储端对象是否已丢失
+func (file *File) UpdateSourceBroken(broken bool) error {
+	file.SourceBroken = broken
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("source_broken", broken).Error
+}
+
+// UpdateTranscodedSource 更新文件转码后衍生文件的物理路径
+func (file *File) UpdateTranscodedSource(value string) error {
+	file.TranscodedSource = value
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("transcoded_source", value).Error
+}
+
+// UpdateRestoreStatus 更新归档文件的解冻状态
+func (file *File) UpdateRestoreStatus(status string) error {
+	file.RestoreStatus = status
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("restore_status", status).Error
+}
+
+// SetPassword 设定文件的下载密码，以加盐摘要形式保存，password 为空时取消密码
+func (file *File) SetPassword(password string) error {
+	digest := ""
+	if password != "" {
+		salt := util.RandStringRunes(16)
+		digest = salt + ":" + filePasswordDigest(password, salt)
+	}
+
+	file.Password = digest
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("password", digest).Error
+}
+
+// CheckPassword 检查下载密码是否正确，未设定密码时始终返回 false
+func (file *File) CheckPassword(password string) bool {
+	store := strings.SplitN(file.Password, ":", 2)
+	if len(store) != 2 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(filePasswordDigest(password, store[0])), []byte(store[1])) == 1
+}
+
+// IsPasswordProtected 返回文件是否设定了下载密码
+func (file *File) IsPasswordProtected() bool {
+	return file.Password != ""
+}
+
+// filePasswordDigest 计算密码与 Salt 组合的 SHA256 摘要
+func filePasswordDigest(password, salt string) string {
+	sum := sha256.Sum256([]byte(password + salt))
+	return hex.EncodeToString(sum[:])
+}
+
+// UpdateDocPreviewSource 更新文件 PDF 预览衍生文件的物理路径
+func (file *File) UpdateDocPreviewSource(value string) error {
+	file.DocPreviewSource = value
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("doc_preview_source", value).Error
+}
+
+// UpdateHLSPlaylist 更新文件预生成的 HLS 播放列表
+func (file *File) UpdateHLSPlaylist(value string) error {
+	file.HLSPlaylist = value
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("hls_playlist", value).Error
+}
+
+// UpdateThumbStatus 更新文件的缩略图生成状态及已失败次数
+func (file *File) UpdateThumbStatus(status string, retries int) error {
+	file.ThumbStatus = status
+	file.ThumbRetries = retries
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumns(map[string]interface{}{
+		"thumb_status":  status,
+		"thumb_retries": retries,
+	}).Error
+}
+
+// ScheduleThumbRetry 记录缩略图生成失败次数，并安排在 at 时重试
+func (file *File) ScheduleThumbRetry(retries int, at time.Time) error {
+	file.ThumbStatus = ThumbStatusPending
+	file.ThumbRetries = retries
+	file.ThumbRetryAt = &at
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumns(map[string]interface{}{
+		"thumb_status":   ThumbStatusPending,
+		"thumb_retries":  retries,
+		"thumb_retry_at": at,
+	}).Error
+}
+
+// GetThumbRetryCandidates 列出重试时间不晚于 now、仍待生成缩略图的文件
+func GetThumbRetryCandidates(now time.Time, limit int) ([]File, error) {
+	var files []File
+	result := DB.Where("thumb_status = ? and pic_info = ? and thumb_retry_at <= ?", ThumbStatusPending, "", now).
+		Order("thumb_retry_at asc, id asc").Limit(limit).Find(&files)
+	return files, result.Error
+}
+
+// UpdateThumbCache 记录服务端生成的缩略图大小，并将其最后访问时间设为当前时间
+func (file *File) UpdateThumbCache(size uint64) error {
+	now := time.Now()
+	file.ThumbSize = size
+	file.ThumbAccessedAt = &now
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumns(map[string]interface{}{
+		"thumb_size":        size,
+		"thumb_accessed_at": now,
+	}).Error
+}
+
+// TouchThumb 更新缩略图的最后访问时间
+func (file *File) TouchThumb(accessed time.Time) error {
+	file.ThumbAccessedAt = &accessed
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("thumb_accessed_at", accessed).Error
+}
+
+// ClearThumbCache 缩略图被淘汰后清除记录，并将缩略图重置为待生成状态，再次访问时重新生成
+func (file *File) ClearThumbCache() error {
+	file.ThumbSize = 0
+	file.ThumbAccessedAt = nil
+	file.ThumbStatus = ThumbStatusPending
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumns(map[string]interface{}{
+		"thumb_size":        0,
+		"thumb_accessed_at": nil,
+		"thumb_status":      ThumbStatusPending,
+	}).Error
+}
+
+// GetThumbCacheSize 统计服务端生成的缩略图占用的总空间
+func GetThumbCacheSize() (uint64, error) {
+	var res struct {
+		Total uint64
+	}
+	err := DB.Model(&File{}).Select("sum(thumb_size) as total").Where("thumb_size > 0").Scan(&res).Error
+	return res.Total, err
+}
+
+// GetThumbCacheCandidates 按最后访问时间从早到晚列出服务端生成了缩略图的文件
+func GetThumbCacheCandidates(limit int) ([]File, error) {
+	var files []File
+	result := DB.Where("thumb_size > 0").Order("thumb_accessed_at asc, id asc").Limit(limit).Find(&files)
+	return files, result.Error
+}
+
+// MigrateFilesPolicy 将仍位于原存储策略、原物理路径的给定文件记录一并指向新的存储策略和物理路径，
+// 返回受影响的文件数量
+func MigrateFilesPolicy(ids []uint, srcPolicy uint, srcSource string, dstPolicy uint, dstSource string) (int64, error) {
+	result := DB.Model(&File{}).
+		Where("id in (?) and policy_id = ? and source_name = ?", ids, srcPolicy, srcSource).
+		UpdateColumns(map[string]interface{}{
+			"policy_id":   dstPolicy,
+			"source_name": dstSource,
+			"shards":      "",
+		})
+	return result.RowsAffected, result.Error
+}
+
+// ResetFailedThumbStatus 将缩略图生成失败的文件重置为待生成状态，ids 为空时重置全部，
+// 返回受影响的文件数量
+func ResetFailedThumbStatus(ids []uint) (int64, error) {
+	query := DB.Model(&File{}).Where("thumb_status = ?", ThumbStatusFailed)
+	if len(ids) > 0 {
+		query = query.Where("id in (?)", ids)
+	}
+
+	result := query.UpdateColumns(map[string]interface{}{
+		"thumb_status":  ThumbStatusPending,
+		"thumb_retries": 0,
+	})
+	return result.RowsAffected, result.Error
+}
+
+// StorageClassUsage 某一存储策略下某一存储类型的文件统计
+type StorageClassUsage struct {
+	PolicyID     uint   `json:"policy_id"`
+	StorageClass string `json:"storage_class"`
+	Files        uint64 `json:"files"`
+	Size         uint64 `json:"size"`
+}
+
+// GetFileInFolderByMD5 查找目录中内容 MD5 为 md5 的正式文件，excludeID 为需排除的文件 ID
+func GetFileInFolderByMD5(folderID uint, md5 string, excludeID uint) (*File, error) {
+	var file File
+	result := DB.Where("folder_id = ? and md5 = ? and id <> ? and upload_session_id is NULL and "+notQuarantined+" and "+notTrashed, folderID, md5, excludeID).
+		First(&file)
+	return &file, result.Error
+}
+
+// GetStorageClassUsage 按存储策略与存储类型统计文件数量及容量
+func GetStorageClassUsage() ([]StorageClassUsage, error) {
+	var res []StorageClassUsage
+	err := DB.Model(&File{}).
+		Select("policy_id, storage_class, count(*) as files, sum(size) as size").
+		Group("policy_id, storage_class").
+		Scan(&res).Error
+	return res, err
+}
+
+// GetImageHashesByUser 获取用户所有已计算感知哈希的文件 ID 及哈希值
+func GetImageHashesByUser(uid uint) ([]File, error) {
+	var files []File
+	result := DB.Select("id, p_hash").Where("user_id = ? and p_hash <> 0 and "+notQuarantined+" and "+notTrashed, uid).Find(&files)
+	return files, result.Error
+}
+
+// UpdateMetadata 更新文件的元数据
+func (file *File) UpdateMetadata(data map[string]string) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	file.MetadataSerialized = data
+	file.Metadata = string(value)
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("metadata", file.Metadata).Error
+}
+
 // UpdateSourceName 更新文件的源文件名
 func (file *File) UpdateSourceName(value string) error {
 	return DB.Model(&file).Set("gorm:association_autoupdate", false).Update("source_name", value).Error
@@ -385,6 +720,7 @@ func (file *File) UpdateSourceName(value string) error {
 
 func (file *File) PopChunkToFile(lastModified *time.Time, picInfo string) error {
 	file.UploadSessionID = nil
+	file.PicInfo = picInfo
 	if lastModified != nil {
 		file.UpdatedAt = *lastModified
 	}
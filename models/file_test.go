@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
 )
@@ -295,10 +296,10 @@ func TestRemoveFilesWithSoftLinks(t *testing.T) {
 	// 全都没有
 	{
 		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs("1.txt", 23, 1).
+			WithArgs("1.txt", 23, 1, 2).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "policy_id", "source_name"}))
 		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs("2.txt", 24, 2).
+			WithArgs("2.txt", 24, 1, 2).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "policy_id", "source_name"}))
 		file, err := RemoveFilesWithSoftLinks(files)
 		asserts.NoError(mock.ExpectationsWereMet())
@@ -309,10 +310,10 @@ func TestRemoveFilesWithSoftLinks(t *testing.T) {
 	// 第二个是软链
 	{
 		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs("1.txt", 23, 1).
+			WithArgs("1.txt", 23, 1, 2).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "policy_id", "source_name"}))
 		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs("2.txt", 24, 2).
+			WithArgs("2.txt", 24, 1, 2).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "policy_id", "source_name"}).
 					AddRow(3, 24, "2.txt"),
@@ -326,13 +327,13 @@ func TestRemoveFilesWithSoftLinks(t *testing.T) {
 	// 第一个是软链
 	{
 		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs("1.txt", 23, 1).
+			WithArgs("1.txt", 23, 1, 2).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "policy_id", "source_name"}).
 					AddRow(3, 23, "1.txt"),
 			)
 		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs("2.txt", 24, 2).
+			WithArgs("2.txt", 24, 1, 2).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "policy_id", "source_name"}))
 		file, err := RemoveFilesWithSoftLinks(files)
 		asserts.NoError(mock.ExpectationsWereMet())
@@ -342,13 +343,13 @@ func TestRemoveFilesWithSoftLinks(t *testing.T) {
 	// 全部是软链
 	{
 		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs("1.txt", 23, 1).
+			WithArgs("1.txt", 23, 1, 2).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "policy_id", "source_name"}).
 					AddRow(3, 23, "1.txt"),
 			)
 		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs("2.txt", 24, 2).
+			WithArgs("2.txt", 24, 1, 2).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "policy_id", "source_name"}).
 					AddRow(3, 24, "2.txt"),
@@ -358,6 +359,21 @@ func TestRemoveFilesWithSoftLinks(t *testing.T) {
 		asserts.NoError(err)
 		asserts.Len(file, 0)
 	}
+
+	// 同一源文件仅被列表内文件引用
+	{
+		shared := []File{
+			{Model: gorm.Model{ID: 1}, SourceName: "1.txt", PolicyID: 23},
+			{Model: gorm.Model{ID: 2}, SourceName: "1.txt", PolicyID: 23},
+		}
+		mock.ExpectQuery("SELECT(.+)files(.+)").
+			WithArgs("1.txt", 23, 1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "policy_id", "source_name"}))
+		file, err := RemoveFilesWithSoftLinks(shared)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(shared[:1], file)
+	}
 }
 
 func TestDeleteFiles(t *testing.T) {
@@ -411,7 +427,7 @@ func TestDeleteFiles(t *testing.T) {
 			WillReturnResult(sqlmock.NewResult(2, 1))
 		mock.ExpectExec("DELETE(.+)").
 			WillReturnResult(sqlmock.NewResult(2, 1))
-		mock.ExpectExec("UPDATE(.+)storage(.+)").WithArgs(uint64(3), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)file_count(.+)storage(.+)").WithArgs(uint64(2), uint64(2), uint64(3), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 		err := DeleteFiles([]*File{{Size: 1}, {Size: 2}}, 0)
 		a.NoError(mock.ExpectationsWereMet())
@@ -463,6 +479,18 @@ func TestFile_Updates(t *testing.T) {
 		asserts.NoError(err)
 	}
 
+	// rename 需唯一的文件名
+	{
+		cache.Set("setting_unique_name_exts", "pdf", 0)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)SET(.+)name_key(.+)").WithArgs("INV-001.pdf", *UniqueNameKey(0, "INV-001.pdf"), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		err := file.Rename("INV-001.pdf")
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		cache.Deletes([]string{"unique_name_exts"}, "setting_")
+	}
+
 	// UpdatePicInfo
 	{
 		mock.ExpectBegin()
@@ -482,6 +510,199 @@ func TestFile_Updates(t *testing.T) {
 		asserts.NoError(mock.ExpectationsWereMet())
 		asserts.NoError(err)
 	}
+
+	// UpdatePHash
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)p_hash(.+)").WithArgs(int64(10), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		err := file.UpdatePHash(10)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(10, file.PHash)
+	}
+
+	// UpdateMetadata
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WithArgs(`{"key":"value"}`, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		err := file.UpdateMetadata(map[string]string{"key": "value"})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal("value", file.MetadataSerialized["key"])
+	}
+
+	// UpdateThumbStatus
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_retries(.+)thumb_status(.+)").WithArgs(2, ThumbStatusFailed, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		err := file.UpdateThumbStatus(ThumbStatusFailed, 2)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(ThumbStatusFailed, file.ThumbStatus)
+		asserts.Equal(2, file.ThumbRetries)
+	}
+}
+
+func TestResetFailedThumbStatus(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 全部重置
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_status(.+)").WithArgs(0, ThumbStatusPending, ThumbStatusFailed).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectCommit()
+		count, err := ResetFailedThumbStatus(nil)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(3, count)
+	}
+
+	// 指定文件
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_status(.+)id in(.+)").WithArgs(0, ThumbStatusPending, ThumbStatusFailed, 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		count, err := ResetFailedThumbStatus([]uint{1, 2})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(1, count)
+	}
+}
+
+func TestFile_ThumbCache(t *testing.T) {
+	asserts := assert.New(t)
+	file := File{Model: gorm.Model{ID: 1}}
+
+	// UpdateThumbCache
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_accessed_at(.+)thumb_size(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(file.UpdateThumbCache(10))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.EqualValues(10, file.ThumbSize)
+		asserts.NotNil(file.ThumbAccessedAt)
+	}
+
+	// ClearThumbCache
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_size(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(file.ClearThumbCache())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.EqualValues(0, file.ThumbSize)
+		asserts.Nil(file.ThumbAccessedAt)
+		asserts.Equal(ThumbStatusPending, file.ThumbStatus)
+	}
+}
+
+func TestGetThumbCacheSize(t *testing.T) {
+	asserts := assert.New(t)
+	mock.ExpectQuery("SELECT(.+)sum(.+)thumb_size(.+)").WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(20))
+	size, err := GetThumbCacheSize()
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.EqualValues(20, size)
+}
+
+func TestGetThumbCacheCandidates(t *testing.T) {
+	asserts := assert.New(t)
+	mock.ExpectQuery("SELECT(.+)thumb_size(.+)ORDER BY thumb_accessed_at asc(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "thumb_size"}).AddRow(1, 10).AddRow(2, 20))
+	files, err := GetThumbCacheCandidates(2)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Len(files, 2)
+}
+
+func TestFile_Password(t *testing.T) {
+	asserts := assert.New(t)
+	file := File{Model: gorm.Model{ID: 1}}
+
+	// 未设定密码
+	asserts.False(file.IsPasswordProtected())
+	asserts.False(file.CheckPassword(""))
+
+	// 设定密码
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)password(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(file.SetPassword("secret"))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.True(file.IsPasswordProtected())
+		asserts.NotContains(file.Password, "secret")
+		asserts.True(file.CheckPassword("secret"))
+		asserts.False(file.CheckPassword("Secret"))
+		asserts.False(file.CheckPassword(""))
+	}
+
+	// 相同密码每次生成不同的摘要
+	{
+		origin := file.Password
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)password(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(file.SetPassword("secret"))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NotEqual(origin, file.Password)
+	}
+
+	// 取消密码
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)password(.+)").WithArgs("", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(file.SetPassword(""))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.False(file.IsPasswordProtected())
+		asserts.False(file.CheckPassword("secret"))
+	}
+}
+
+func TestFile_ScheduleThumbRetry(t *testing.T) {
+	asserts := assert.New(t)
+	file := File{Model: gorm.Model{ID: 1}, ThumbStatus: ThumbStatusFailed}
+	at := time.Now().Add(time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)thumb_retries(.+)thumb_retry_at(.+)thumb_status(.+)").
+		WithArgs(2, at, ThumbStatusPending, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(file.ScheduleThumbRetry(2, at))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal(ThumbStatusPending, file.ThumbStatus)
+	asserts.Equal(2, file.ThumbRetries)
+	asserts.Equal(at, *file.ThumbRetryAt)
+}
+
+func TestGetThumbRetryCandidates(t *testing.T) {
+	asserts := assert.New(t)
+	now := time.Now()
+	mock.ExpectQuery("SELECT(.+)thumb_retry_at(.+)ORDER BY thumb_retry_at asc(.+)").
+		WithArgs(ThumbStatusPending, "", now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	files, err := GetThumbRetryCandidates(now, 2)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Len(files, 2)
+}
+
+func TestGetImageHashesByUser(t *testing.T) {
+	asserts := assert.New(t)
+	mock.ExpectQuery("SELECT(.+)p_hash(.+)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "p_hash"}).AddRow(1, 10).AddRow(2, 20))
+	files, err := GetImageHashesByUser(1)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Len(files, 2)
+	asserts.EqualValues(20, files[1].PHash)
 }
 
 func TestFile_UpdateSize(t *testing.T) {
@@ -652,3 +873,78 @@ func TestFile_CreateOrGetSourceLink(t *testing.T) {
 		a.NoError(mock.ExpectationsWereMet())
 	}
 }
+
+func TestFile_IsRetained(t *testing.T) {
+	asserts := assert.New(t)
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	asserts.False((&File{}).IsRetained(now))
+	asserts.False((&File{RetainUntil: &before}).IsRetained(now))
+	asserts.True((&File{RetainUntil: &after}).IsRetained(now))
+}
+
+func TestGetStorageClassUsage(t *testing.T) {
+	asserts := assert.New(t)
+	mock.ExpectQuery("SELECT(.+)storage_class(.+)GROUP BY(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"policy_id", "storage_class", "files", "size"}).
+			AddRow(1, "", 10, 100).
+			AddRow(1, "GLACIER", 2, 2048))
+	res, err := GetStorageClassUsage()
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Len(res, 2)
+	asserts.Equal("GLACIER", res[1].StorageClass)
+	asserts.EqualValues(2048, res[1].Size)
+}
+
+func TestGetFileInFolderByMD5(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 找到
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)folder_id(.+)md5(.+)").
+			WithArgs(1, "827ccb0eea8a706c4c34a16891f84e7b", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "1.txt"))
+		file, err := GetFileInFolderByMD5(1, "827ccb0eea8a706c4c34a16891f84e7b", 2)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(3, file.ID)
+	}
+
+	// 未找到
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		_, err := GetFileInFolderByMD5(1, "827ccb0eea8a706c4c34a16891f84e7b", 2)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+	}
+}
+
+func TestFile_UpdateChecksum(t *testing.T) {
+	asserts := assert.New(t)
+	file := &File{Model: gorm.Model{ID: 1}}
+
+	algo, digest := file.GetChecksum()
+	asserts.Empty(algo)
+	asserts.Empty(digest)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)checksum(.+)").WithArgs("sha256:abcd", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(file.UpdateChecksum("sha256", "abcd"))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	algo, digest = file.GetChecksum()
+	asserts.Equal("sha256", algo)
+	asserts.Equal("abcd", digest)
+
+	// 清除
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)checksum(.+)").WithArgs("", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(file.UpdateChecksum("", ""))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Empty(file.Checksum)
+}
@@ -1,8 +1,10 @@
 package model
 
 import (
+	"encoding/json"
 	"errors"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
@@ -16,11 +18,63 @@ type Folder struct {
 	Name     string `gorm:"unique_index:idx_only_one_name"`
 	ParentID *uint  `gorm:"index:parent_id;unique_index:idx_only_one_name"`
 	OwnerID  uint   `gorm:"index:owner_id"`
+	// 上传至此目录的文件的默认权限，空值表示使用全局设置
+	DefaultPermission string `gorm:"size:16"`
+	// 允许存放在此目录中的文件类型，可为预设类型或以逗号分隔的扩展名、MIME 类型，空值表示不限制
+	AllowedTypes string `gorm:"type:text"`
+	// 上传文件与此目录中已有文件重名时的处理方式，空值表示继承上级目录设置
+	CollisionPolicy string `gorm:"size:16"`
+	// 上传至此目录的文件的保留天数，保留期内文件不可删除或修改，0 表示不设定
+	RetentionDays int
+	// 上传至此目录的文件必须提供的元数据键，以逗号分隔，空值表示不要求
+	RequiredMetadata string `gorm:"type:text"`
+	// 是否拒绝上传与此目录中已有文件内容相同的文件
+	UniqueContent bool
+	// 上传至此目录的文件是否需经管理员审核，由管理员设定
+	RequireApproval bool
+	// 目录封面图像的文件 ID
+	CoverID *uint `gorm:"index:cover_id"`
+	// 封面是否由用户手动指定，手动指定的封面不会被新上传的图像替换
+	CoverPinned bool
+	// 目录的元数据，如 WebDAV 客户端设定的死属性
+	Metadata string `gorm:"type:text"`
 
 	// 数据库忽略字段
-	Position string `gorm:"-"`
+	Position           string            `gorm:"-"`
+	MetadataSerialized map[string]string `gorm:"-"`
 }
 
+// 上传文件的默认权限
+const (
+	// FilePermissionInherit 继承上级设置
+	FilePermissionInherit = ""
+	// FilePermissionPrivate 仅自己可见
+	FilePermissionPrivate = "private"
+	// FilePermissionPublic 自动创建公开分享
+	FilePermissionPublic = "public"
+)
+
+// 目录允许存放的预设文件类型
+const (
+	FolderTypeImages    = "images"
+	FolderTypeDocuments = "documents"
+	FolderTypeMedia     = "media"
+)
+
+// 上传文件重名时的处理方式
+const (
+	// CollisionPolicyInherit 继承上级目录或全局设置
+	CollisionPolicyInherit = ""
+	// CollisionPolicyError 拒绝上传
+	CollisionPolicyError = "error"
+	// CollisionPolicyOverwrite 删除已有文件
+	CollisionPolicyOverwrite = "overwrite"
+	// CollisionPolicyVersion 将已有文件重命名为历史版本
+	CollisionPolicyVersion = "version"
+	// CollisionPolicyRename 自动重命名新上传的文件
+	CollisionPolicyRename = "rename"
+)
+
 // Create 创建目录
 func (folder *Folder) Create() (uint, error) {
 	if err := DB.FirstOrCreate(folder, *folder).Error; err != nil {
@@ -32,6 +86,108 @@ func (folder *Folder) Create() (uint, error) {
 	return folder.ID, nil
 }
 
+// SetDefaultPermission 设定上传至此目录的文件的默认权限
+func (folder *Folder) SetDefaultPermission(permission string) error {
+	folder.DefaultPermission = permission
+	return DB.Model(folder).UpdateColumn("default_permission", permission).Error
+}
+
+// SetAllowedTypes 设定允许存放在此目录中的文件类型
+func (folder *Folder) SetAllowedTypes(types string) error {
+	folder.AllowedTypes = types
+	return DB.Model(folder).UpdateColumn("allowed_types", types).Error
+}
+
+// SetCollisionPolicy 设定上传文件与此目录中已有文件重名时的处理方式
+func (folder *Folder) SetCollisionPolicy(policy string) error {
+	folder.CollisionPolicy = policy
+	return DB.Model(folder).UpdateColumn("collision_policy", policy).Error
+}
+
+// SetRetentionDays 设定上传至目录的文件的保留天数
+func (folder *Folder) SetRetentionDays(days int) error {
+	folder.RetentionDays = days
+	return DB.Model(folder).UpdateColumn("retention_days", days).Error
+}
+
+// AfterFind 找到目录后的钩子
+func (folder *Folder) AfterFind() (err error) {
+	// 反序列化目录元数据
+	if folder.Metadata != "" {
+		err = json.Unmarshal([]byte(folder.Metadata), &folder.MetadataSerialized)
+	}
+
+	return
+}
+
+// UpdateMetadata 更新目录的元数据
+func (folder *Folder) UpdateMetadata(data map[string]string) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	folder.MetadataSerialized = data
+	folder.Metadata = string(value)
+	return DB.Model(folder).UpdateColumn("metadata", folder.Metadata).Error
+}
+
+// SetRequiredMetadata 设定上传至此目录的文件必须提供的元数据键
+func (folder *Folder) SetRequiredMetadata(keys string) error {
+	folder.RequiredMetadata = keys
+	return DB.Model(folder).UpdateColumn("required_metadata", keys).Error
+}
+
+// SetUniqueContent 设定是否拒绝上传与此目录中已有文件内容相同的文件
+func (folder *Folder) SetUniqueContent(unique bool) error {
+	folder.UniqueContent = unique
+	return DB.Model(folder).UpdateColumn("unique_content", unique).Error
+}
+
+// SetCover 设定目录封面，fileID 为空时清除封面
+func (folder *Folder) SetCover(fileID *uint, pinned bool) error {
+	folder.CoverID = fileID
+	folder.CoverPinned = pinned
+	return DB.Model(folder).UpdateColumns(map[string]interface{}{
+		"cover_id":     fileID,
+		"cover_pinned": pinned,
+	}).Error
+}
+
+// GetLatestFileByExts 返回此目录下扩展名为 exts 之一的最新上传的文件
+func (folder *Folder) GetLatestFileByExts(exts []string) (*File, error) {
+	conditions := make([]string, len(exts))
+	args := make([]interface{}, len(exts))
+	for i, ext := range exts {
+		conditions[i] = "name LIKE ?"
+		args[i] = "%." + ext
+	}
+
+	file := &File{}
+	result := DB.Where("folder_id = ? AND upload_session_id is NULL AND "+notQuarantined+" AND "+notTrashed, folder.ID).
+		Where(strings.Join(conditions, " OR "), args...).
+		Order("id desc").First(file)
+	return file, result.Error
+}
+
+// GetFoldersByCoverIDs 根据封面文件 ID 查找目录
+func GetFoldersByCoverIDs(ids []uint) ([]Folder, error) {
+	var folders []Folder
+	result := DB.Where("cover_id in (?)", ids).Find(&folders)
+	return folders, result.Error
+}
+
+// RequiredMetadataKeys 返回上传至此目录的文件必须提供的元数据键
+func (folder *Folder) RequiredMetadataKeys() []string {
+	keys := make([]string, 0)
+	for _, key := range strings.Split(folder.RequiredMetadata, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 // GetChild 返回folder下名为name的子目录，不存在则返回错误
 func (folder *Folder) GetChild(name string) (*Folder, error) {
 	var resFolder Folder
@@ -79,6 +235,61 @@ func (folder *Folder) GetChildFolder() ([]Folder, error) {
 	return folders, result.Error
 }
 
+// GetChildrenWithLimit 按 ID 顺序列出目录下属于目录所有者的文件和子目录，合计至多 limit 个，
+// limit 为 0 时不限制。truncated 表示是否还有未列出的项目
+func (folder *Folder) GetChildrenWithLimit(limit int) (files []File, folders []Folder, truncated bool, err error) {
+	filesQuery := DB.Where("folder_id = ? AND user_id = ? AND "+notQuarantined+" AND "+notTrashed, folder.ID, folder.OwnerID).Order("id asc")
+	if limit > 0 {
+		// 多取一个以判断是否已截断
+		filesQuery = filesQuery.Limit(limit + 1)
+	}
+	if err = filesQuery.Find(&files).Error; err != nil {
+		return nil, nil, false, err
+	}
+
+	if limit > 0 && len(files) > limit {
+		files = files[:limit]
+		truncated = true
+	} else {
+		foldersQuery := DB.Where("parent_id = ? AND owner_id = ?", folder.ID, folder.OwnerID).Order("id asc")
+		if limit > 0 {
+			foldersQuery = foldersQuery.Limit(limit - len(files) + 1)
+		}
+		if err = foldersQuery.Find(&folders).Error; err != nil {
+			return nil, nil, false, err
+		}
+
+		if limit > 0 && len(files)+len(folders) > limit {
+			folders = folders[:limit-len(files)]
+			truncated = true
+		}
+	}
+
+	for i := range files {
+		files[i].Position = path.Join(folder.Position, folder.Name)
+	}
+	for i := range folders {
+		folders[i].Position = path.Join(folder.Position, folder.Name)
+	}
+	return files, folders, truncated, nil
+}
+
+// CountChildren 返回目录下属于目录所有者的文件和子目录的总数
+func (folder *Folder) CountChildren() (int, error) {
+	var files, folders int
+	if err := DB.Model(&File{}).Where("folder_id = ? AND user_id = ? AND "+notQuarantined+" AND "+notTrashed, folder.ID, folder.OwnerID).
+		Count(&files).Error; err != nil {
+		return 0, err
+	}
+
+	if err := DB.Model(&Folder{}).Where("parent_id = ? AND owner_id = ?", folder.ID, folder.OwnerID).
+		Count(&folders).Error; err != nil {
+		return 0, err
+	}
+
+	return files + folders, nil
+}
+
 // GetRecursiveChildFolder 查找所有递归子目录，包括自身
 func GetRecursiveChildFolder(dirs []uint, uid uint, includeSelf bool) ([]Folder, error) {
 	folders := make([]Folder, 0, len(dirs))
@@ -127,10 +338,34 @@ func GetRecursiveChildFolder(dirs []uint, uid uint, includeSelf bool) ([]Folder,
 	return folders, err
 }
 
-// DeleteFolderByIDs 根据给定ID批量删除目录记录
-func DeleteFolderByIDs(ids []uint) error {
-	result := DB.Where("id in (?)", ids).Unscoped().Delete(&Folder{})
-	return result.Error
+// AfterCreate 创建目录后增加所有者的目录数，根目录不计入
+func (folder *Folder) AfterCreate(tx *gorm.DB) error {
+	if folder.ParentID == nil {
+		return nil
+	}
+
+	user := User{}
+	user.ID = folder.OwnerID
+	return user.ChangeFileCount(tx, "+", 0, 1)
+}
+
+// DeleteFolderByIDs 根据给定ID批量删除用户 uid 的目录记录，并减少其目录数
+func DeleteFolderByIDs(ids []uint, uid uint) error {
+	tx := DB.Begin()
+	result := tx.Where("id in (?) and owner_id = ?", ids, uid).Unscoped().Delete(&Folder{})
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+
+	user := User{}
+	user.ID = uid
+	if err := user.ChangeFileCount(tx, "-", 0, uint64(result.RowsAffected)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }
 
 // GetFoldersByIDs 根据ID和用户查找所有目录
@@ -143,8 +378,9 @@ func GetFoldersByIDs(ids []uint, uid uint) ([]Folder, error) {
 // MoveOrCopyFileTo 将此目录下的files移动或复制至dstFolder，
 // 返回此操作新增的容量
 func (folder *Folder) MoveOrCopyFileTo(files []uint, dstFolder *Folder, isCopy bool) (uint64, error) {
-	// 已复制文件的总大小
-	var copiedSize uint64
+	// 已复制文件的总大小及数量
+	var copiedSize, copiedFiles uint64
+	defer func() { dstFolder.increaseOwnerFileCount(copiedFiles) }()
 
 	if isCopy {
 		// 检索出要复制的文件
@@ -168,14 +404,20 @@ func (folder *Folder) MoveOrCopyFileTo(files []uint, dstFolder *Folder, isCopy b
 			oldFile.Model = gorm.Model{}
 			oldFile.FolderID = dstFolder.ID
 			oldFile.UserID = dstFolder.OwnerID
+			// 副本不占用需唯一的文件名
+			oldFile.NameKey = nil
 
 			if err := DB.Create(&oldFile).Error; err != nil {
 				return copiedSize, err
 			}
 
+			if err := changeTypeUsage(DB, oldFile.UserID, oldFile.Name, "+", oldFile.Size); err != nil {
+				util.Log().Warning("Failed to update type usage of user %d: %s", oldFile.UserID, err)
+			}
+
 			copiedSize += oldFile.Size
+			copiedFiles++
 		}
-
 	} else {
 		// 更改顶级要移动文件的父目录指向
 		err := DB.Model(File{}).Where(
@@ -241,7 +483,9 @@ func (folder *Folder) CopyFolderTo(folderID uint, dstFolder *Folder) (size uint6
 
 	}
 
-	// 复制文件
+	// 复制文件，目录数已在创建目录时增加
+	var copiedFiles uint64
+	defer func() { dstFolder.increaseOwnerFileCount(copiedFiles) }()
 	var originFiles = make([]File, 0, len(subFolderIDs))
 	if err := DB.Where(
 		"user_id = ? and folder_id in (?)",
@@ -261,17 +505,32 @@ func (folder *Folder) CopyFolderTo(folderID uint, dstFolder *Folder) (size uint6
 		oldFile.Model = gorm.Model{}
 		oldFile.FolderID = newIDCache[oldFile.FolderID]
 		oldFile.UserID = dstFolder.OwnerID
+		oldFile.NameKey = nil
 		if err := DB.Create(&oldFile).Error; err != nil {
 			return size, err
 		}
 
+		if err := changeTypeUsage(DB, oldFile.UserID, oldFile.Name, "+", oldFile.Size); err != nil {
+			util.Log().Warning("Failed to update type usage of user %d: %s", oldFile.UserID, err)
+		}
+
 		size += oldFile.Size
+		copiedFiles++
 	}
 
 	return size, nil
 
 }
 
+// increaseOwnerFileCount 复制文件后增加目录所有者的文件数，包括复制中途失败前已复制的文件
+func (folder *Folder) increaseOwnerFileCount(files uint64) {
+	user := User{}
+	user.ID = folder.OwnerID
+	if err := user.ChangeFileCount(DB, "+", files, 0); err != nil {
+		util.Log().Warning("Failed to update file count of user %d: %s", folder.OwnerID, err)
+	}
+}
+
 // MoveFolderTo 将folder目录下的dirs子目录复制或移动到dstFolder，
 // 返回此过程中增加的容量
 func (folder *Folder) MoveFolderTo(dirs []uint, dstFolder *Folder) error {
@@ -46,6 +46,113 @@ func TestFolder_Create(t *testing.T) {
 	asserts.NoError(mock.ExpectationsWereMet())
 }
 
+func TestFolder_SetDefaultPermission(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &Folder{}
+	folder.ID = 1
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)default_permission(.+)").WithArgs(FilePermissionPublic, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(folder.SetDefaultPermission(FilePermissionPublic))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal(FilePermissionPublic, folder.DefaultPermission)
+}
+
+func TestFolder_SetCollisionPolicy(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &Folder{}
+	folder.ID = 1
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)collision_policy(.+)").WithArgs(CollisionPolicyRename, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(folder.SetCollisionPolicy(CollisionPolicyRename))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal(CollisionPolicyRename, folder.CollisionPolicy)
+}
+
+func TestFolder_SetRetentionDays(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &Folder{}
+	folder.ID = 1
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)retention_days(.+)").WithArgs(30, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(folder.SetRetentionDays(30))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal(30, folder.RetentionDays)
+}
+
+func TestFolder_RequiredMetadataKeys(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &Folder{}
+	folder.ID = 1
+
+	asserts.Empty(folder.RequiredMetadataKeys())
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)required_metadata(.+)").WithArgs("author, ,project", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(folder.SetRequiredMetadata("author, ,project"))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal([]string{"author", "project"}, folder.RequiredMetadataKeys())
+}
+
+func TestFolder_SetUniqueContent(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &Folder{}
+	folder.ID = 1
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)unique_content(.+)").WithArgs(true, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(folder.SetUniqueContent(true))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.True(folder.UniqueContent)
+}
+
+func TestFolder_SetCover(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &Folder{}
+	folder.ID = 1
+	coverID := uint(2)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)cover_id(.+)cover_pinned(.+)").WithArgs(&coverID, true, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(folder.SetCover(&coverID, true))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal(&coverID, folder.CoverID)
+	asserts.True(folder.CoverPinned)
+}
+
+func TestFolder_GetLatestFileByExts(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &Folder{Model: gorm.Model{ID: 1}}
+
+	mock.ExpectQuery("SELECT(.+)files(.+)name LIKE(.+)OR name LIKE(.+)ORDER BY id desc(.+)").
+		WithArgs(1, "%.jpg", "%.png").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "1.png"))
+	file, err := folder.GetLatestFileByExts([]string{"jpg", "png"})
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.EqualValues(3, file.ID)
+}
+
+func TestGetFoldersByCoverIDs(t *testing.T) {
+	asserts := assert.New(t)
+
+	mock.ExpectQuery("SELECT(.+)folders(.+)cover_id in(.+)").WithArgs(2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "cover_id"}).AddRow(1, 2))
+	folders, err := GetFoldersByCoverIDs([]uint{2, 3})
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Len(folders, 1)
+	asserts.EqualValues(2, *folders[0].CoverID)
+}
+
 func TestFolder_GetChild(t *testing.T) {
 	asserts := assert.New(t)
 	folder := Folder{
@@ -105,6 +212,105 @@ func TestFolder_GetChildFolder(t *testing.T) {
 	asserts.NoError(mock.ExpectationsWereMet())
 }
 
+func TestFolder_GetChildrenWithLimit(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &Folder{
+		Model:    gorm.Model{ID: 1},
+		OwnerID:  2,
+		Position: "/123",
+		Name:     "456",
+	}
+
+	// 不限制
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)folder_id(.+)user_id(.+)").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "1.txt"))
+		mock.ExpectQuery("SELECT(.+)folders(.+)parent_id(.+)owner_id(.+)").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "sub"))
+		files, folders, truncated, err := folder.GetChildrenWithLimit(0)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.False(truncated)
+		asserts.Len(files, 1)
+		asserts.Len(folders, 1)
+		asserts.Equal("/123/456", files[0].Position)
+		asserts.Equal("/123/456", folders[0].Position)
+	}
+
+	// 文件已超出上限，不再查询目录
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)LIMIT 3").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+		files, folders, truncated, err := folder.GetChildrenWithLimit(2)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.True(truncated)
+		asserts.Len(files, 2)
+		asserts.Len(folders, 0)
+	}
+
+	// 文件与目录合计超出上限
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)LIMIT 3").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT(.+)folders(.+)LIMIT 2").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		files, folders, truncated, err := folder.GetChildrenWithLimit(2)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.True(truncated)
+		asserts.Len(files, 1)
+		asserts.Len(folders, 1)
+	}
+
+	// 恰好达到上限
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)LIMIT 3").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT(.+)folders(.+)LIMIT 2").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		files, folders, truncated, err := folder.GetChildrenWithLimit(2)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.False(truncated)
+		asserts.Len(files, 1)
+		asserts.Len(folders, 1)
+	}
+
+	// 查询失败
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnError(errors.New("error"))
+		_, _, _, err := folder.GetChildrenWithLimit(2)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+	}
+}
+
+func TestFolder_CountChildren(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &Folder{Model: gorm.Model{ID: 1}, OwnerID: 2}
+
+	// 成功
+	{
+		mock.ExpectQuery("SELECT count(.+)files(.+)").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery("SELECT count(.+)folders(.+)").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+		total, err := folder.CountChildren()
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(7, total)
+	}
+
+	// 失败
+	{
+		mock.ExpectQuery("SELECT count(.+)files(.+)").WillReturnError(errors.New("error"))
+		_, err := folder.CountChildren()
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+	}
+}
+
 func TestGetRecursiveChildFolderSQLite(t *testing.T) {
 	conf.DatabaseConfig.Type = "sqlite3"
 	asserts := assert.New(t)
@@ -160,7 +366,7 @@ func TestDeleteFolderByIDs(t *testing.T) {
 		mock.ExpectExec("DELETE(.+)").
 			WillReturnError(errors.New("error"))
 		mock.ExpectRollback()
-		err := DeleteFolderByIDs([]uint{1, 2, 3})
+		err := DeleteFolderByIDs([]uint{1, 2, 3}, 1)
 		asserts.NoError(mock.ExpectationsWereMet())
 		asserts.Error(err)
 	}
@@ -169,8 +375,11 @@ func TestDeleteFolderByIDs(t *testing.T) {
 		mock.ExpectBegin()
 		mock.ExpectExec("DELETE(.+)").
 			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").
+			WithArgs(3, 3, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
-		err := DeleteFolderByIDs([]uint{1, 2, 3})
+		err := DeleteFolderByIDs([]uint{1, 2, 3}, 1)
 		asserts.NoError(mock.ExpectationsWereMet())
 		asserts.NoError(err)
 	}
@@ -360,12 +569,15 @@ func TestFolder_CopyFolderTo(t *testing.T) {
 		// 复制目录
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(5, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(6, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 
 		// 查找子文件
@@ -383,8 +595,17 @@ func TestFolder_CopyFolderTo(t *testing.T) {
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(5, 1))
 		mock.ExpectCommit()
 		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)").WithArgs(10, 0, FileTypeDocument).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(6, 1))
 		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)").WithArgs(20, 0, FileTypeDocument).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)users(.+)file_count(.+)").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
 
 		size, err := parFolder.CopyFolderTo(2, &dstFolder)
 		asserts.NoError(mock.ExpectationsWereMet())
@@ -414,6 +635,7 @@ func TestFolder_CopyFolderTo(t *testing.T) {
 		// 复制目录
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(5, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 
 		size, err := parFolder.CopyFolderTo(2, &dstFolder)
@@ -433,12 +655,15 @@ func TestFolder_CopyFolderTo(t *testing.T) {
 		// 复制目录
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(5, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(6, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 
 		// 查找子文件
@@ -463,12 +688,15 @@ func TestFolder_CopyFolderTo(t *testing.T) {
 		// 复制目录
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(5, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(6, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 
 		// 查找子文件
@@ -485,8 +713,14 @@ func TestFolder_CopyFolderTo(t *testing.T) {
 		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(5, 1))
 		mock.ExpectCommit()
 		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)").WillReturnError(errors.New("error"))
 		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)users(.+)file_count(.+)").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
 
 		size, err := parFolder.CopyFolderTo(2, &dstFolder)
 		asserts.NoError(mock.ExpectationsWereMet())
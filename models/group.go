@@ -34,6 +34,23 @@ type GroupOption struct {
 	SourceBatchSize  int                    `json:"source_batch,omitempty"`
 	RedirectedSource bool                   `json:"redirected_source,omitempty"`
 	Aria2BatchSize   int                    `json:"aria2_batch,omitempty"`
+	MinFileSize      uint64                 `json:"min_file_size,omitempty"`   // 允许上传的最小文件尺寸
+	UploadWindows    []string               `json:"upload_windows,omitempty"`  // 允许上传的时间段，为空时不限制
+	UploadTimezone   string                 `json:"upload_timezone,omitempty"` // 上传时间段所用时区，为空时使用服务器时区
+	TypeQuotas       map[string]uint64      `json:"type_quotas,omitempty"`     // 各类型文件的容量限制，键为文件类型
+	WebDAVCharset    string                 `json:"webdav_charset,omitempty"`  // WebDAV 客户端文件名的字符集，为空时不转换
+	WebDAVNameEncode bool                   `json:"webdav_name_encode,omitempty"`
+	WebDAVMIMEMode   string                 `json:"webdav_mime_mode,omitempty"` // WebDAV 上传时确定文件 MIME 类型的方式，为空时不做处理
+	RetentionBypass  bool                   `json:"retention_bypass,omitempty"`
+	Impersonate      bool                   `json:"impersonate,omitempty"` // 管理员可模拟其他用户操作
+	// 上传的目标目录必须已存在，不自动创建
+	StrictUploadTarget bool `json:"strict_upload_target,omitempty"`
+	// 文件数配额，为 0 时不限制
+	MaxFiles uint64 `json:"max_files,omitempty"`
+	// 目录是否计入文件数配额
+	MaxFilesIncludeFolders bool `json:"max_files_include_folders,omitempty"`
+	// 上传覆盖已有文件时将原文件移入回收站
+	TrashOnOverwrite bool `json:"trash_on_overwrite,omitempty"`
 }
 
 // GetGroupByID 用ID获取用户组
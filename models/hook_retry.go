@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// HookRetry 失败的上传后处理的重试记录，重试次数用尽后保留为死信供管理员排查
+type HookRetry struct {
+	gorm.Model
+	Hook        string    `gorm:"size:64;unique_index:hook_file"`
+	FileID      uint      `gorm:"unique_index:hook_file"`
+	UserID      uint      `gorm:"index:user_id"`
+	Attempts    int       // 已失败的次数
+	NextRetryAt time.Time `gorm:"index:next_retry_at"`
+	LastError   string    `gorm:"type:text"`
+	Dead        bool      // 重试次数已用尽或处理不可重复执行，不再自动重试
+}
+
+// GetHookRetry 获取文件某项处理的重试记录
+func GetHookRetry(hook string, fileID uint) (*HookRetry, error) {
+	record := &HookRetry{}
+	result := DB.Where("hook = ? and file_id = ?", hook, fileID).First(record)
+	return record, result.Error
+}
+
+// GetDueHookRetries 按计划时间列出不晚于 now 且仍需重试的记录
+func GetDueHookRetries(now time.Time, limit int) ([]HookRetry, error) {
+	var records []HookRetry
+	result := DB.Where("dead = ? and next_retry_at <= ?", false, now).
+		Order("next_retry_at asc, id asc").Limit(limit).Find(&records)
+	return records, result.Error
+}
+
+// Save 创建或更新重试记录
+func (record *HookRetry) Save() error {
+	return DB.Save(record).Error
+}
+
+// Delete 删除重试记录
+func (record *HookRetry) Delete() error {
+	return DB.Unscoped().Delete(record).Error
+}
+
+// RequeueHookRetries 清空失败次数，使记录（包括死信）立即重新进入重试
+func RequeueHookRetries(ids []uint) error {
+	return DB.Model(&HookRetry{}).Where("id in (?)", ids).UpdateColumns(map[string]interface{}{
+		"attempts":      0,
+		"dead":          false,
+		"next_retry_at": time.Now(),
+	}).Error
+}
+
+// DeleteHookRetries 批量删除重试记录
+func DeleteHookRetries(ids []uint) error {
+	return DB.Unscoped().Where("id in (?)", ids).Delete(&HookRetry{}).Error
+}
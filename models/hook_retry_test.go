@@ -0,0 +1,81 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetHookRetry(t *testing.T) {
+	asserts := assert.New(t)
+
+	mock.ExpectQuery("SELECT(.+)hook_retries(.+)").WithArgs("text_stats", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "hook", "file_id"}).AddRow(2, "text_stats", 1))
+	record, err := GetHookRetry("text_stats", 1)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.EqualValues(2, record.ID)
+}
+
+func TestGetDueHookRetries(t *testing.T) {
+	asserts := assert.New(t)
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT(.+)hook_retries(.+)dead(.+)next_retry_at(.+)LIMIT 10").WithArgs(false, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	records, err := GetDueHookRetries(now, 10)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Len(records, 2)
+}
+
+func TestHookRetry_SaveAndDelete(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 新建
+	{
+		record := &HookRetry{Hook: "text_stats", FileID: 1}
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)hook_retries(.+)").WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectCommit()
+		asserts.NoError(record.Save())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.EqualValues(3, record.ID)
+	}
+
+	// 删除
+	{
+		record := &HookRetry{}
+		record.ID = 3
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE(.+)hook_retries(.+)").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		asserts.NoError(record.Delete())
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
+
+func TestRequeueHookRetries(t *testing.T) {
+	asserts := assert.New(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)hook_retries(.+)attempts(.+)dead(.+)next_retry_at").
+		WithArgs(0, false, sqlmock.AnyArg(), 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	asserts.NoError(RequeueHookRetries([]uint{1, 2}))
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
+func TestDeleteHookRetries(t *testing.T) {
+	asserts := assert.New(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE(.+)hook_retries(.+)").WithArgs(1, 2).WillReturnError(errors.New("error"))
+	mock.ExpectRollback()
+	asserts.Error(DeleteHookRetries([]uint{1, 2}))
+	asserts.NoError(mock.ExpectationsWereMet())
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"time"
+)
+
+// LifecycleRule 文件生命周期规则，文件上传满指定天数后转换存储类型或过期删除
+type LifecycleRule struct {
+	// TransitionDays 上传后多少天转换存储类型，0 表示不转换
+	TransitionDays int `json:"transition_days,omitempty"`
+	// TransitionClass 转换的目标存储类型，本地存储策略下文件将移至 lifecycle_local_archive_path
+	TransitionClass string `json:"transition_class,omitempty"`
+	// ExpireDays 上传后多少天删除，0 表示不删除
+	ExpireDays int `json:"expire_days,omitempty"`
+}
+
+// IsEmpty 返回规则是否未设定任何动作
+func (rule *LifecycleRule) IsEmpty() bool {
+	return rule == nil || (!rule.HasTransition() && rule.ExpireDays <= 0)
+}
+
+// HasTransition 返回规则是否设定了存储类型转换
+func (rule *LifecycleRule) HasTransition() bool {
+	return rule != nil && rule.TransitionDays > 0 && rule.TransitionClass != ""
+}
+
+// Schedule 返回上传于 from 的文件计划转换存储类型和删除的时间，未设定时为 nil
+func (rule *LifecycleRule) Schedule(from time.Time) (transitionAt, expireAt *time.Time) {
+	if rule.IsEmpty() {
+		return nil, nil
+	}
+
+	if rule.HasTransition() {
+		at := from.AddDate(0, 0, rule.TransitionDays)
+		transitionAt = &at
+	}
+
+	if rule.ExpireDays > 0 {
+		at := from.AddDate(0, 0, rule.ExpireDays)
+		expireAt = &at
+	}
+
+	return
+}
+
+// EffectiveLifecycle 返回用户上传到 policy 的文件适用的生命周期规则，用户设定优先于存储策略，
+// 均未设定时返回 nil
+func EffectiveLifecycle(user *User, policy *Policy) *LifecycleRule {
+	if user != nil && !user.OptionsSerialized.Lifecycle.IsEmpty() {
+		return user.OptionsSerialized.Lifecycle
+	}
+
+	if policy != nil && !policy.OptionsSerialized.Lifecycle.IsEmpty() {
+		return policy.OptionsSerialized.Lifecycle
+	}
+
+	return nil
+}
+
+// GetLifecycleDueFiles 列出计划转换存储类型或删除的时间不晚于 now 的文件
+func GetLifecycleDueFiles(now time.Time, limit int) ([]File, error) {
+	var files []File
+	result := DB.Where("(transition_at <= ? or expire_at <= ?) and upload_session_id is NULL and "+notQuarantined+" and "+notTrashed, now, now).
+		Order("id asc").Limit(limit).Find(&files)
+	return files, result.Error
+}
+
+// UpdateExpireAt 更新计划删除的时间
+func (file *File) UpdateExpireAt(at time.Time) error {
+	file.ExpireAt = &at
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("expire_at", at).Error
+}
+
+// CompleteTransition 记录文件已转换为 storageClass，清除计划转换时间
+func (file *File) CompleteTransition(storageClass string) error {
+	file.StorageClass = storageClass
+	file.TransitionAt = nil
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumns(map[string]interface{}{
+		"storage_class": storageClass,
+		"transition_at": nil,
+	}).Error
+}
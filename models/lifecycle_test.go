@@ -0,0 +1,91 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleRule_Schedule(t *testing.T) {
+	asserts := assert.New(t)
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 未设定
+	{
+		var rule *LifecycleRule
+		asserts.True(rule.IsEmpty())
+		transitionAt, expireAt := rule.Schedule(from)
+		asserts.Nil(transitionAt)
+		asserts.Nil(expireAt)
+	}
+
+	// 未设定目标存储类型，不转换
+	{
+		rule := &LifecycleRule{TransitionDays: 30}
+		asserts.True(rule.IsEmpty())
+		asserts.False(rule.HasTransition())
+	}
+
+	// 转换并删除
+	{
+		rule := &LifecycleRule{TransitionDays: 30, TransitionClass: "GLACIER", ExpireDays: 365}
+		transitionAt, expireAt := rule.Schedule(from)
+		asserts.Equal(from.AddDate(0, 0, 30), *transitionAt)
+		asserts.Equal(from.AddDate(0, 0, 365), *expireAt)
+	}
+
+	// 仅删除
+	{
+		rule := &LifecycleRule{ExpireDays: 7}
+		transitionAt, expireAt := rule.Schedule(from)
+		asserts.Nil(transitionAt)
+		asserts.Equal(from.AddDate(0, 0, 7), *expireAt)
+	}
+}
+
+func TestEffectiveLifecycle(t *testing.T) {
+	asserts := assert.New(t)
+	userRule := &LifecycleRule{ExpireDays: 1}
+	policyRule := &LifecycleRule{ExpireDays: 2}
+	user := &User{}
+	policy := &Policy{}
+
+	asserts.Nil(EffectiveLifecycle(nil, nil))
+	asserts.Nil(EffectiveLifecycle(user, policy))
+
+	policy.OptionsSerialized.Lifecycle = policyRule
+	asserts.Equal(policyRule, EffectiveLifecycle(user, policy))
+
+	user.OptionsSerialized.Lifecycle = userRule
+	asserts.Equal(userRule, EffectiveLifecycle(user, policy))
+}
+
+func TestGetLifecycleDueFiles(t *testing.T) {
+	asserts := assert.New(t)
+	now := time.Now()
+	mock.ExpectQuery("SELECT(.+)transition_at(.+)expire_at(.+)quarantined_at is NULL(.+)").
+		WithArgs(now, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	files, err := GetLifecycleDueFiles(now, 2)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Len(files, 2)
+}
+
+func TestFile_CompleteTransition(t *testing.T) {
+	asserts := assert.New(t)
+	at := time.Now()
+	file := &File{StorageClass: "STANDARD", TransitionAt: &at}
+	file.ID = 1
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)").
+		WithArgs("GLACIER", nil, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(file.CompleteTransition("GLACIER"))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal("GLACIER", file.StorageClass)
+	asserts.Nil(file.TransitionAt)
+}
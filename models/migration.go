@@ -41,7 +41,7 @@ func migration() {
 	}
 
 	DB.AutoMigrate(&User{}, &Setting{}, &Group{}, &Policy{}, &Folder{}, &File{}, &Share{},
-		&Task{}, &Download{}, &Tag{}, &Webdav{}, &Node{}, &SourceLink{})
+		&Task{}, &Download{}, &Tag{}, &Webdav{}, &Node{}, &SourceLink{}, &TypeUsage{}, &Notification{}, &HookRetry{}, &Trash{})
 
 	// 创建初始存储策略
 	addDefaultPolicy()
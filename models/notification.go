@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Notification 站内通知
+type Notification struct {
+	gorm.Model
+	UserID uint       `gorm:"index:user_id"`
+	Event  string     `gorm:"size:32"`
+	Title  string     `gorm:"type:text"`
+	Body   string     `gorm:"type:text"`
+	ReadAt *time.Time // 已读时间，为空表示未读
+}
+
+// Create 创建站内通知
+func (n *Notification) Create() error {
+	return DB.Create(n).Error
+}
+
+// ListNotifications 按时间倒序列出用户的站内通知，返回通知列表、总数及未读数
+func ListNotifications(uid uint, page, pageSize int) ([]Notification, int, int) {
+	var (
+		notifications []Notification
+		total         int
+		unread        int
+	)
+	dbChain := DB.Model(&Notification{}).Where("user_id = ?", uid)
+
+	// 计算总数用于分页
+	dbChain.Count(&total)
+	dbChain.Where("read_at is NULL").Count(&unread)
+
+	// 查询记录
+	dbChain.Limit(pageSize).Offset((page - 1) * pageSize).Order("id desc").Find(&notifications)
+
+	return notifications, total, unread
+}
+
+// MarkNotificationsRead 将用户的站内通知标记为已读，ids 为空时标记全部
+func MarkNotificationsRead(uid uint, ids []uint) error {
+	dbChain := DB.Model(&Notification{}).Where("user_id = ? and read_at is NULL", uid)
+	if len(ids) > 0 {
+		dbChain = dbChain.Where("id in (?)", ids)
+	}
+
+	return dbChain.UpdateColumn("read_at", time.Now()).Error
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListNotifications(t *testing.T) {
+	asserts := assert.New(t)
+	mock.ExpectQuery("SELECT count(.+)notifications(.+)").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT count(.+)notifications(.+)read_at is NULL(.+)").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT(.+)notifications(.+)").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(3, "title"))
+	res, total, unread := ListNotifications(1, 1, 10)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal(3, total)
+	asserts.Equal(1, unread)
+	asserts.Len(res, 1)
+	asserts.Equal("title", res[0].Title)
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 全部标记
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)notifications(.+)read_at(.+)").
+			WithArgs(sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 3))
+		mock.ExpectCommit()
+		asserts.NoError(MarkNotificationsRead(1, nil))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 指定通知
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)notifications(.+)id in(.+)").
+			WithArgs(sqlmock.AnyArg(), 1, 2, 3).
+			WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		asserts.Error(MarkNotificationsRead(1, []uint{2, 3}))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
@@ -3,7 +3,9 @@ package model
 import (
 	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"github.com/gofrs/uuid"
+	"net/url"
 	"path"
 	"path/filepath"
 	"strconv"
@@ -15,6 +17,23 @@ import (
 	"github.com/jinzhu/gorm"
 )
 
+// ContentAddressDir 内容寻址存储对象所在的目录名
+const ContentAddressDir = ".cas"
+
+// 内容寻址存储的去重范围。无论哪种范围，对象的引用计数均统计所有用户的文件记录，
+// 一个用户删除文件不会删除仍被其他用户引用的对象；切换范围只影响之后上传的文件
+const (
+	// ContentAddressScopeGlobal 同一存储策略下所有用户的相同内容共用一份对象，节省空间最多，
+	// 但上传耗时、存储端写入等差异可能让用户推测出其他用户是否存有某一内容
+	ContentAddressScopeGlobal = "global"
+	// ContentAddressScopeUser 仅同一用户的相同内容共用对象，对象路径中带有用户 ID，
+	// 不同用户上传相同内容时各自保存一份，不会泄露其他用户的文件是否存在
+	ContentAddressScopeUser = "user"
+)
+
+// ErrInvalidOutboundProxy 存储策略的出站代理地址无效
+var ErrInvalidOutboundProxy = errors.New("invalid outbound proxy URL, expected http(s):// or socks5:// with a host")
+
 // Policy 存储策略
 type Policy struct {
 	// 表字段
@@ -65,6 +84,62 @@ type PolicyOption struct {
 	TPSLimit float64 `json:"tps_limit,omitempty"`
 	// 每秒 API 请求爆发上限
 	TPSLimitBurst int `json:"tps_limit_burst,omitempty"`
+	// CDNSignType CDN 鉴权方式，为空时保留源站签名
+	CDNSignType string `json:"cdn_sign_type,omitempty"`
+	// CDNSignKey CDN 鉴权密钥
+	CDNSignKey string `json:"cdn_sign_key,omitempty"`
+	// MinSize 允许上传的最小文件尺寸，0 表示不限制
+	MinSize uint64 `json:"min_size,omitempty"`
+	// ThumbExts 允许生成缩略图的文件扩展名，为空时不限制
+	ThumbExts []string `json:"thumb_exts,omitempty"`
+	// ThumbExcludeExts 不生成缩略图的文件扩展名
+	ThumbExcludeExts []string `json:"thumb_exclude_exts,omitempty"`
+	// ResponseHeaders 输出此策略下文件时附加的响应头
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	// MaxPathDepth 允许创建的最大目录深度，0 表示使用全局设定
+	MaxPathDepth int `json:"max_path_depth,omitempty"`
+	// ContentAddressable 是否以文件内容的哈希值作为存储路径，相同内容只保存一份
+	ContentAddressable bool `json:"content_addressable,omitempty"`
+	// ContentAddressScope 内容寻址的去重范围，为空时为 global
+	ContentAddressScope string `json:"content_address_scope,omitempty"`
+	// RetentionDays 上传文件的保留天数，保留期内文件不可删除或修改，0 表示不设定
+	RetentionDays int `json:"retention_days,omitempty"`
+	// OutboundProxy 驱动访问存储端时使用的 HTTP 代理，支持 http、https、socks5 协议
+	OutboundProxy string `json:"outbound_proxy,omitempty"`
+	// OutboundHeaders 驱动访问存储端时附加的请求头
+	OutboundHeaders map[string]string `json:"outbound_headers,omitempty"`
+	// MaxConcurrency 同时发往存储端的最大请求数，超出时排队等待，0 为不限制
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// ShardSize 经由服务端写入的文件超过此尺寸时拆分为多个对象存储，0 表示不拆分
+	ShardSize uint64 `json:"shard_size,omitempty"`
+	// SignedURLOnly 仅允许通过签名链接读取文件内容，拒绝仅凭登录会话的直接读取
+	SignedURLOnly bool `json:"signed_url_only,omitempty"`
+	// StorageClass 上传文件使用的存储类型，为空时使用存储端默认类型，仅 S3、OSS 有效
+	StorageClass string `json:"storage_class,omitempty"`
+	// StrictUploadTarget 上传的目标目录必须已存在，不自动创建
+	StrictUploadTarget bool `json:"strict_upload_target,omitempty"`
+	// TrashOnOverwrite 上传覆盖已有文件时将原文件移入回收站
+	TrashOnOverwrite bool `json:"trash_on_overwrite,omitempty"`
+	// Lifecycle 上传文件的生命周期规则，用户设定的规则优先
+	Lifecycle *LifecycleRule `json:"lifecycle,omitempty"`
+	// EncryptedOnly 是否只接受客户端加密的文件，仅对经由服务端中转的上传有效
+	EncryptedOnly bool `json:"encrypted_only,omitempty"`
+	// EncryptionMarker 客户端加密文件开头的标记，以 hex: 开头时按十六进制解析，为空时不检查标记
+	EncryptionMarker string `json:"encryption_marker,omitempty"`
+	// AllowedMIMETypes 允许上传的内容类型，根据文件开头内容检测，支持 image/* 形式的通配，为空时不限制，仅对经由服务端中转的上传有效
+	AllowedMIMETypes []string `json:"allowed_mime_types,omitempty"`
+	// DeniedMIMETypes 禁止上传的内容类型，优先于 AllowedMIMETypes
+	DeniedMIMETypes []string `json:"denied_mime_types,omitempty"`
+	// VerifyContentType 是否拒绝检测到的内容类型与扩展名不符的文件，仅对经由服务端中转的上传有效
+	VerifyContentType bool `json:"verify_content_type,omitempty"`
+	// ScanBeforeCallback 从机是否在病毒扫描通过后才发送上传回调，仅从机策略有效
+	ScanBeforeCallback bool `json:"scan_before_callback,omitempty"`
+	// ServerSideChecksum 上传时附加内容的 SHA-256，由存储端接收时校验，仅 S3 有效
+	ServerSideChecksum bool `json:"server_side_checksum,omitempty"`
+	// HLSMode 视频 HLS 播放的分段方式，pregenerate 为上传后预先生成分段，on_demand 为播放时实时切分，为空时不提供 HLS 播放
+	HLSMode string `json:"hls_mode,omitempty"`
+	// ConvertOriginalToSRGB 上传的图像嵌入非 sRGB 色彩配置文件时，将原图转换到 sRGB 后保存，仅对经由服务端中转的上传有效
+	ConvertOriginalToSRGB bool `json:"convert_original_to_srgb,omitempty"`
 }
 
 // thumbSuffix 支持缩略图处理的文件扩展名
@@ -129,6 +204,31 @@ func (policy *Policy) SerializeOptions() (err error) {
 	return err
 }
 
+// OutboundProxyURL 解析出站代理地址，未设定时返回 nil
+func (policy *Policy) OutboundProxyURL() (*url.URL, error) {
+	proxy := strings.TrimSpace(policy.OptionsSerialized.OutboundProxy)
+	if proxy == "" {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, ErrInvalidOutboundProxy
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, ErrInvalidOutboundProxy
+	}
+
+	if proxyURL.Hostname() == "" {
+		return nil, ErrInvalidOutboundProxy
+	}
+
+	return proxyURL, nil
+}
+
 // GeneratePath 生成存储文件的路径
 func (policy *Policy) GeneratePath(uid uint, origin string) string {
 	dirRule := policy.DirNameRule
@@ -191,6 +291,10 @@ func (policy *Policy) IsDirectlyPreview() bool {
 
 // IsThumbExist 给定文件名，返回此存储策略下是否可能存在缩略图
 func (policy *Policy) IsThumbExist(name string) bool {
+	if !policy.IsThumbEnabledFor(name) {
+		return false
+	}
+
 	if list, ok := thumbSuffix[policy.Type]; ok {
 		if len(list) == 1 && list[0] == "*" {
 			return true
@@ -200,6 +304,20 @@ func (policy *Policy) IsThumbExist(name string) bool {
 	return false
 }
 
+// IsThumbEnabledFor 给定文件名，返回此存储策略的缩略图扩展名设置是否允许为其生成缩略图
+func (policy *Policy) IsThumbEnabledFor(name string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	if util.ContainsString(policy.OptionsSerialized.ThumbExcludeExts, ext) {
+		return false
+	}
+
+	if len(policy.OptionsSerialized.ThumbExts) > 0 {
+		return util.ContainsString(policy.OptionsSerialized.ThumbExts, ext)
+	}
+
+	return true
+}
+
 // IsTransitUpload 返回此策略上传给定size文件时是否需要服务端中转
 func (policy *Policy) IsTransitUpload(size uint64) bool {
 	return policy.Type == "local"
@@ -223,6 +341,30 @@ func (policy *Policy) IsUploadPlaceholderWithSize() bool {
 	return false
 }
 
+// IsContentAddressable 返回此策略是否开启内容寻址存储
+func (policy *Policy) IsContentAddressable() bool {
+	return policy.OptionsSerialized.ContentAddressable
+}
+
+// IsShardable 返回此策略是否将大文件拆分为多个对象存储。内容寻址以完整内容的哈希作为存储路径，
+// 开启时不拆分
+func (policy *Policy) IsShardable() bool {
+	return policy.OptionsSerialized.ShardSize > 0 && !policy.OptionsSerialized.ContentAddressable
+}
+
+// ContentAddressPath 返回内容寻址模式下哈希值对应的存储路径，
+// 位于目录命名规则中首个变量之前的固定前缀下。按用户去重时路径中带有 uid
+func (policy *Policy) ContentAddressPath(hash string, uid uint) string {
+	prefix := policy.DirNameRule
+	if i := strings.Index(prefix, "{"); i >= 0 {
+		prefix = prefix[:i]
+	}
+	if policy.OptionsSerialized.ContentAddressScope == ContentAddressScopeUser {
+		return path.Join(prefix, ContentAddressDir, "u"+strconv.FormatUint(uint64(uid), 10), hash[:2], hash)
+	}
+	return path.Join(prefix, ContentAddressDir, hash[:2], hash)
+}
+
 // CanStructureBeListed 返回存储策略是否能被前台列物理目录
 func (policy *Policy) CanStructureBeListed() bool {
 	return policy.Type != "local" && policy.Type != "remote"
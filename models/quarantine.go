@@ -0,0 +1,137 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// notQuarantined 仅检索未被隔离文件的查询条件
+const notQuarantined = "quarantined_at is NULL"
+
+// quarantineNamePrefix 隔离期间文件名的前缀，避免占用所有者目录下的原文件名
+func quarantineNamePrefix(id uint) string {
+	return fmt.Sprintf(".quarantine_%d_", id)
+}
+
+// IsQuarantined 文件是否已被隔离
+func (file *File) IsQuarantined() bool {
+	return file.QuarantinedAt != nil
+}
+
+// OriginalName 返回文件被隔离前的文件名
+func (file *File) OriginalName() string {
+	return strings.TrimPrefix(file.Name, quarantineNamePrefix(file.ID))
+}
+
+// Quarantine 隔离文件，对所有者隐藏并不再计入其已用容量，保留存储端的文件数据
+func (file *File) Quarantine(reason string) error {
+	if file.IsQuarantined() {
+		return nil
+	}
+
+	now := time.Now()
+	name := quarantineNamePrefix(file.ID) + file.Name
+	tx := DB.Begin()
+	if err := tx.Model(&File{}).Where("id = ?", file.ID).UpdateColumns(map[string]interface{}{
+		"name":              name,
+		"quarantined_at":    now,
+		"quarantine_reason": reason,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := file.changeVisibleUsage(tx, "-"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	file.Name = name
+	file.QuarantinedAt = &now
+	file.QuarantineReason = reason
+	return nil
+}
+
+// ReleaseQuarantine 解除隔离，以原文件名恢复至 folderID 目录下并重新计入所有者已用容量
+func (file *File) ReleaseQuarantine(folderID uint) error {
+	if !file.IsQuarantined() {
+		return nil
+	}
+
+	name := file.OriginalName()
+	tx := DB.Begin()
+	if err := tx.Model(&File{}).Where("id = ?", file.ID).UpdateColumns(map[string]interface{}{
+		"name":              name,
+		"folder_id":         folderID,
+		"quarantined_at":    nil,
+		"quarantine_reason": "",
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := file.changeVisibleUsage(tx, "+"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	file.Name = name
+	file.FolderID = folderID
+	file.QuarantinedAt = nil
+	file.QuarantineReason = ""
+	return nil
+}
+
+// changeVisibleUsage 更新文件所有者的已用容量及按类型统计的已用容量
+func (file *File) changeVisibleUsage(tx *gorm.DB, operator string) error {
+	user := User{}
+	user.ID = file.UserID
+	if err := user.ChangeStorage(tx, operator, file.Size); err != nil {
+		return err
+	}
+
+	return changeTypeUsage(tx, file.UserID, file.OriginalName(), operator, file.Size)
+}
+
+// GetQuarantinedFilesByIDs 根据 ID 批量获取已隔离的文件
+func GetQuarantinedFilesByIDs(ids []uint) ([]File, error) {
+	var files []File
+	result := DB.Where("id in (?) AND quarantined_at is not NULL", ids).Find(&files)
+	return files, result.Error
+}
+
+// DeleteQuarantinedFiles 删除已隔离文件的记录，隔离时已扣除容量，无需再次归还，只需减少文件数
+func DeleteQuarantinedFiles(files []*File) error {
+	tx := DB.Begin()
+	counts := make(map[uint]uint64)
+	for _, file := range files {
+		res := tx.Unscoped().Where("quarantined_at is not NULL").Delete(file)
+		if res.Error != nil {
+			tx.Rollback()
+			return res.Error
+		}
+		counts[file.UserID] += uint64(res.RowsAffected)
+	}
+
+	for uid, count := range counts {
+		user := User{}
+		user.ID = uid
+		if err := user.ChangeFileCount(tx, "-", count, 0); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
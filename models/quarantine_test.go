@@ -0,0 +1,113 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile_Quarantine(t *testing.T) {
+	a := assert.New(t)
+
+	// 隔离成功
+	{
+		file := File{Name: "a.mp4", Size: 10, UserID: 1}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)storage(.+)-(.+)").WithArgs(uint64(10), sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)-(.+)").WithArgs(uint64(10), 1, FileTypeVideo).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		a.NoError(file.Quarantine("hash mismatch"))
+		a.NoError(mock.ExpectationsWereMet())
+		a.True(file.IsQuarantined())
+		a.Equal(".quarantine_2_a.mp4", file.Name)
+		a.Equal("a.mp4", file.OriginalName())
+		a.Equal("hash mismatch", file.QuarantineReason)
+
+		// 重复隔离
+		a.NoError(file.Quarantine("again"))
+		a.Equal("hash mismatch", file.QuarantineReason)
+	}
+
+	// 更新失败
+	{
+		file := File{Name: "a.bin", Size: 10, UserID: 1}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		a.Error(file.Quarantine("hash mismatch"))
+		a.NoError(mock.ExpectationsWereMet())
+		a.False(file.IsQuarantined())
+		a.Equal("a.bin", file.Name)
+	}
+}
+
+func TestFile_ReleaseQuarantine(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+
+	// 未被隔离
+	{
+		file := File{Name: "a.bin"}
+		a.NoError(file.ReleaseQuarantine(3))
+	}
+
+	// 解除成功
+	{
+		file := File{Name: ".quarantine_2_a.bin", Size: 10, UserID: 1, FolderID: 1, QuarantinedAt: &now}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)storage(.+)+(.+)").WithArgs(uint64(10), sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		a.NoError(file.ReleaseQuarantine(3))
+		a.NoError(mock.ExpectationsWereMet())
+		a.False(file.IsQuarantined())
+		a.Equal("a.bin", file.Name)
+		a.EqualValues(3, file.FolderID)
+	}
+
+	// 用户容量更新失败
+	{
+		file := File{Name: ".quarantine_2_a.bin", Size: 10, UserID: 1, FolderID: 1, QuarantinedAt: &now}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)storage(.+)+(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		a.Error(file.ReleaseQuarantine(3))
+		a.NoError(mock.ExpectationsWereMet())
+		a.True(file.IsQuarantined())
+		a.EqualValues(1, file.FolderID)
+	}
+}
+
+func TestDeleteQuarantinedFiles(t *testing.T) {
+	a := assert.New(t)
+	file := &File{}
+	file.ID = 2
+
+	// 删除成功
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE(.+)quarantined_at is not NULL(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)file_count(.+)").WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		a.NoError(DeleteQuarantinedFiles([]*File{file}))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 删除失败
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		a.Error(DeleteQuarantinedFiles([]*File{file}))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+}
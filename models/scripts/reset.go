@@ -21,8 +21,7 @@ func (script ResetAdminPassword) Run(ctx context.Context) {
 	password := util.RandStringRunes(8)
 
 	// 更改为新密码
-	user.SetPassword(password)
-	if err := user.Update(map[string]interface{}{"password": user.Password}); err != nil {
+	if err := user.ChangePassword(password); err != nil {
 		util.Log().Panic("Failed to update password: %s", err)
 	}
 
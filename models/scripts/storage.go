@@ -8,26 +8,36 @@ import (
 
 type UserStorageCalibration int
 
-type storageResult struct {
-	Total uint64
-}
-
-// Run 运行脚本校准所有用户容量
+// Run 运行脚本校准所有用户容量及文件数
 func (script UserStorageCalibration) Run(ctx context.Context) {
 	// 列出所有用户
 	var res []model.User
 	model.DB.Model(&model.User{}).Find(&res)
 
-	// 逐个检查容量
-	for _, user := range res {
-		// 计算正确的容量
-		var total storageResult
-		model.DB.Model(&model.File{}).Where("user_id = ?", user.ID).Select("sum(size) as total").Scan(&total)
-		// 更新用户的容量
-		if user.Storage != total.Total {
-			util.Log().Info("Calibrate used storage for user %q, from %d to %d.", user.Email,
-				user.Storage, total.Total)
+	// 逐个校准容量
+	for i := range res {
+		before := res[i].Storage
+		total, err := res[i].CalibrateStorage()
+		if err != nil {
+			util.Log().Warning("Failed to calibrate used storage for user %q: %s", res[i].Email, err)
+			continue
+		}
+
+		if before != total {
+			util.Log().Info("Calibrate used storage for user %q, from %d to %d.", res[i].Email,
+				before, total)
+		}
+
+		beforeFiles, beforeFolders := res[i].FileCount, res[i].FolderCount
+		files, folders, err := res[i].CalibrateFileCount()
+		if err != nil {
+			util.Log().Warning("Failed to calibrate file count for user %q: %s", res[i].Email, err)
+			continue
+		}
+
+		if beforeFiles != files || beforeFolders != folders {
+			util.Log().Info("Calibrate file count for user %q, from %d/%d to %d/%d.", res[i].Email,
+				beforeFiles, beforeFolders, files, folders)
 		}
-		model.DB.Model(&user).Update("storage", total.Total)
 	}
 }
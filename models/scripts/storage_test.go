@@ -3,6 +3,7 @@ package scripts
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/jinzhu/gorm"
@@ -35,12 +36,12 @@ func TestUserStorageCalibration_Run(t *testing.T) {
 	{
 		mock.ExpectQuery("SELECT(.+)users(.+)").
 			WillReturnRows(sqlmock.NewRows([]string{"id", "email", "storage"}).AddRow(1, "a@a.com", 10))
-		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs(1).
-			WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(11))
 		mock.ExpectBegin()
-		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)SUM(.+)files(.+)").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT(.+)users(.+)").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"storage"}).AddRow(11))
 		script.Run(context.Background())
 		asserts.NoError(mock.ExpectationsWereMet())
 	}
@@ -49,12 +50,23 @@ func TestUserStorageCalibration_Run(t *testing.T) {
 	{
 		mock.ExpectQuery("SELECT(.+)users(.+)").
 			WillReturnRows(sqlmock.NewRows([]string{"id", "email", "storage"}).AddRow(1, "a@a.com", 10))
-		mock.ExpectQuery("SELECT(.+)files(.+)").
-			WithArgs(1).
-			WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(10))
 		mock.ExpectBegin()
-		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)SUM(.+)files(.+)").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT(.+)users(.+)").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"storage"}).AddRow(10))
+		script.Run(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 校准失败
+	{
+		mock.ExpectQuery("SELECT(.+)users(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "email", "storage"}).AddRow(1, "a@a.com", 10))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
 		script.Run(context.Background())
 		asserts.NoError(mock.ExpectationsWereMet())
 	}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// FileShard 拆分存储的文件中的一个分片，分片清单按内容顺序排列
+type FileShard struct {
+	Source string `json:"source"` // 分片对象的物理路径
+	Size   uint64 `json:"size"`
+}
+
+// ShardSource 返回物理路径为 source 的文件拆分存储时第 index 个分片的物理路径
+func ShardSource(source string, index int) string {
+	return fmt.Sprintf("%s.shard%05d", source, index)
+}
+
+// ParseShards 解析分片清单，清单为空时返回 nil
+func ParseShards(manifest string) ([]FileShard, error) {
+	if manifest == "" {
+		return nil, nil
+	}
+
+	var shards []FileShard
+	if err := json.Unmarshal([]byte(manifest), &shards); err != nil {
+		return nil, fmt.Errorf("invalid shard manifest: %w", err)
+	}
+
+	return shards, nil
+}
+
+// EncodeShards 将分片列表编码为分片清单，列表为空时返回空清单
+func EncodeShards(shards []FileShard) string {
+	if len(shards) == 0 {
+		return ""
+	}
+
+	manifest, _ := json.Marshal(shards)
+	return string(manifest)
+}
+
+// IsSharded 返回文件是否拆分为多个对象存储
+func (file *File) IsSharded() bool {
+	return file.Shards != ""
+}
+
+// ShardSources 返回拆分存储的文件各分片的物理路径，未拆分或清单无效时返回 nil
+func (file *File) ShardSources() []string {
+	shards, err := ParseShards(file.Shards)
+	if err != nil {
+		return nil
+	}
+
+	sources := make([]string, len(shards))
+	for i, shard := range shards {
+		sources[i] = shard.Source
+	}
+
+	return sources
+}
+
+// UpdateShards 更新文件的分片清单
+func (file *File) UpdateShards(manifest string) error {
+	file.Shards = manifest
+	return DB.Model(&file).Set("gorm:association_autoupdate", false).UpdateColumn("shards", manifest).Error
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardManifest(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("a/b.txt.shard00002", ShardSource("a/b.txt", 2))
+
+	// 空清单
+	a.Equal("", EncodeShards(nil))
+	shards, err := ParseShards("")
+	a.NoError(err)
+	a.Nil(shards)
+
+	// 编码后解析保持顺序与尺寸
+	manifest := EncodeShards([]FileShard{{Source: "a.shard00000", Size: 3}, {Source: "a.shard00001", Size: 1}})
+	shards, err = ParseShards(manifest)
+	a.NoError(err)
+	a.Equal([]FileShard{{Source: "a.shard00000", Size: 3}, {Source: "a.shard00001", Size: 1}}, shards)
+
+	file := &File{Shards: manifest}
+	a.True(file.IsSharded())
+	a.Equal([]string{"a.shard00000", "a.shard00001"}, file.ShardSources())
+
+	// 无效清单
+	_, err = ParseShards("{")
+	a.Error(err)
+	a.Nil((&File{Shards: "{"}).ShardSources())
+}
+
+func TestFile_UpdateShards(t *testing.T) {
+	a := assert.New(t)
+	file := &File{Model: gorm.Model{ID: 1}, Shards: "[]"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)shards(.+)").WithArgs("", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	a.NoError(file.UpdateShards(""))
+	a.NoError(mock.ExpectationsWereMet())
+	a.False(file.IsSharded())
+}
@@ -13,6 +13,9 @@ import (
 	"github.com/jinzhu/gorm"
 )
 
+// ErrShareUnavailable 分享已过期或下载次数已用尽
+var ErrShareUnavailable = errors.New("share is expired or has reached its download limit")
+
 // Share 分享模型
 type Share struct {
 	gorm.Model
@@ -119,7 +122,8 @@ func (share *Share) SourceFolder() *Folder {
 func (share *Share) SourceFile() *File {
 	if share.File.ID == 0 {
 		files, _ := GetFilesByIDs([]uint{share.SourceID}, share.UserID)
-		if len(files) > 0 {
+		// 待审核的文件不可通过分享访问
+		if len(files) > 0 && !files[0].IsPendingApproval() {
 			share.File = files[0]
 		}
 	}
@@ -149,16 +153,25 @@ func (share *Share) WasDownloadedBy(user *User, c *gin.Context) (exist bool) {
 	return exist
 }
 
-// DownloadBy 增加下载次数，匿名用户不会缓存
+// DownloadBy 增加下载次数，匿名用户不会缓存。同一用户已下载过时不再重复计数，
+// 断点续传、分段读取只计为一次下载，但分享过期后仍不可再下载
 func (share *Share) DownloadBy(user *User, c *gin.Context) error {
-	if !share.WasDownloadedBy(user, c) {
-		share.Downloaded()
-		if !user.IsAnonymous() {
-			cache.Set(fmt.Sprintf("share_%d_%d", share.ID, user.ID), true,
-				GetIntSetting("share_download_session_timeout", 2073600))
-		} else {
-			util.SetSession(c, map[string]interface{}{fmt.Sprintf("share_%d_%d", share.ID, user.ID): true})
+	if share.WasDownloadedBy(user, c) {
+		if share.Expires != nil && time.Now().After(*share.Expires) {
+			return ErrShareUnavailable
 		}
+		return nil
+	}
+
+	if err := share.Downloaded(); err != nil {
+		return err
+	}
+
+	if !user.IsAnonymous() {
+		cache.Set(fmt.Sprintf("share_%d_%d", share.ID, user.ID), true,
+			GetIntSetting("share_download_session_timeout", 2073600))
+	} else {
+		util.SetSession(c, map[string]interface{}{fmt.Sprintf("share_%d_%d", share.ID, user.ID): true})
 	}
 	return nil
 }
@@ -169,16 +182,27 @@ func (share *Share) Viewed() {
 	DB.Model(share).UpdateColumn("views", gorm.Expr("views + ?", 1))
 }
 
-// Downloaded 增加下载次数
-func (share *Share) Downloaded() {
+// Downloaded 增加下载次数并扣减剩余下载配额。检查与扣减在同一条语句中完成，
+// 并发下载不会超出配额，分享已过期或配额已用尽时返回 ErrShareUnavailable
+func (share *Share) Downloaded() error {
+	result := DB.Model(&Share{}).
+		Where("id = ? and remain_downloads <> 0 and (expires is null or expires > ?)", share.ID, time.Now()).
+		UpdateColumns(map[string]interface{}{
+			"downloads":        gorm.Expr("downloads + ?", 1),
+			"remain_downloads": gorm.Expr("case when remain_downloads > 0 then remain_downloads - 1 else remain_downloads end"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShareUnavailable
+	}
+
 	share.Downloads++
 	if share.RemainDownloads > 0 {
 		share.RemainDownloads--
 	}
-	DB.Model(share).Updates(map[string]interface{}{
-		"downloads":        share.Downloads,
-		"remain_downloads": share.RemainDownloads,
-	})
+	return nil
 }
 
 // Update 更新分享属性
@@ -196,6 +220,13 @@ func DeleteShareBySourceIDs(sources []uint, isDir bool) error {
 	return DB.Where("source_id in (?) and is_dir = ?", sources, isDir).Delete(&Share{}).Error
 }
 
+// GetSharesBySourceID 查找用户为指定资源创建的分享
+func GetSharesBySourceID(uid, sourceID uint, isDir bool) ([]Share, error) {
+	var shares []Share
+	result := DB.Where("user_id = ? and source_id = ? and is_dir = ?", uid, sourceID, isDir).Find(&shares)
+	return shares, result.Error
+}
+
 // ListShares 列出UID下的分享
 func ListShares(uid uint, page, pageSize int, order string, publicOnly bool) ([]Share, int) {
 	var (
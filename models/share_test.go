@@ -247,6 +247,67 @@ func TestShare_DownloadBy(t *testing.T) {
 	asserts.True(ok)
 }
 
+func TestShare_DownloadBy_Unavailable(t *testing.T) {
+	asserts := assert.New(t)
+	user := User{Model: gorm.Model{ID: 1}}
+	r := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(r)
+
+	// 下载次数已用尽或已过期，不记录下载
+	{
+		share := Share{Model: gorm.Model{ID: 2}}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)remain_downloads <> 0(.+)").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		err := share.DownloadBy(&user, c)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(ErrShareUnavailable, err)
+		_, ok := cache.Get("share_2_1")
+		asserts.False(ok)
+	}
+
+	// 已下载过，续传时不再计数
+	{
+		share := Share{Model: gorm.Model{ID: 3}}
+		cache.Set("share_3_1", true, 0)
+		asserts.NoError(share.DownloadBy(&user, c))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 已下载过，但分享已过期
+	{
+		expires := time.Now().Add(-time.Hour)
+		share := Share{Model: gorm.Model{ID: 3}, Expires: &expires}
+		asserts.Equal(ErrShareUnavailable, share.DownloadBy(&user, c))
+	}
+}
+
+func TestShare_Downloaded(t *testing.T) {
+	asserts := assert.New(t)
+	share := Share{Model: gorm.Model{ID: 1}, RemainDownloads: 2, Downloads: 1}
+
+	// 成功
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)downloads(.+)remain_downloads(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		asserts.NoError(share.Downloaded())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(2, share.Downloads)
+		asserts.Equal(1, share.RemainDownloads)
+	}
+
+	// 数据库错误
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		asserts.Error(share.Downloaded())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(2, share.Downloads)
+	}
+}
+
 func TestShare_Viewed(t *testing.T) {
 	asserts := assert.New(t)
 	share := Share{}
@@ -295,6 +356,18 @@ func TestShare_UpdateAndDelete(t *testing.T) {
 
 }
 
+func TestGetSharesBySourceID(t *testing.T) {
+	asserts := assert.New(t)
+
+	mock.ExpectQuery("SELECT(.+)shares(.+)").
+		WithArgs(1, 2, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(1, "").AddRow(2, "123"))
+	shares, err := GetSharesBySourceID(1, 2, true)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Len(shares, 2)
+}
+
 func TestListShares(t *testing.T) {
 	asserts := assert.New(t)
 
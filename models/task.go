@@ -40,6 +40,12 @@ func (task *Task) SetError(err string) error {
 	return DB.Model(task).Select("error").Updates(map[string]interface{}{"error": err}).Error
 }
 
+// SetProps 设定任务属性
+func (task *Task) SetProps(props string) error {
+	task.Props = props
+	return DB.Model(task).Select("props").Updates(map[string]interface{}{"props": props}).Error
+}
+
 // GetTasksByStatus 根据状态检索任务
 func GetTasksByStatus(status ...int) []Task {
 	var tasks []Task
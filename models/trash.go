@@ -0,0 +1,137 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// notTrashed 仅检索不在回收站中的文件的查询条件
+const notTrashed = "trashed_at is NULL"
+
+// Trash 回收站记录，对应被覆盖后移入回收站的文件，过期前仍计入所有者已用容量
+type Trash struct {
+	gorm.Model
+	UserID          uint      `gorm:"index:user_id"`
+	FileID          uint      `gorm:"unique_index:file_id"`
+	FolderID        uint      // 移入回收站前所在的目录
+	Name            string    // 移入回收站前的文件名
+	Size            uint64    // 文件大小
+	Expires         time.Time `gorm:"index:expires"`           // 过期时间，过期后永久删除
+	UploadSessionID *string   `gorm:"index:upload_session_id"` // 覆盖此文件的上传会话，会话未完成、占位文件被删除时恢复此文件
+
+	// 关联模型
+	File File `gorm:"PRELOAD:false,association_autoupdate:false"`
+}
+
+// trashNamePrefix 回收站中文件名的前缀，避免占用原目录下的文件名
+func trashNamePrefix(id uint) string {
+	return fmt.Sprintf(".trash_%d_", id)
+}
+
+// IsTrashed 文件是否在回收站中
+func (file *File) IsTrashed() bool {
+	return file.TrashedAt != nil
+}
+
+// MoveToTrash 将文件移入回收站，retention 后过期。文件对所有者不可见，但仍计入其已用容量，
+// 存储端的文件数据保持不变。uploadSessionID 为覆盖此文件的上传会话，非上传会话覆盖时为 nil
+func (file *File) MoveToTrash(retention time.Duration, uploadSessionID *string) (*Trash, error) {
+	now := time.Now()
+	name := trashNamePrefix(file.ID) + file.Name
+	trash := &Trash{
+		UserID:          file.UserID,
+		FileID:          file.ID,
+		FolderID:        file.FolderID,
+		Name:            file.Name,
+		Size:            file.Size,
+		Expires:         now.Add(retention),
+		UploadSessionID: uploadSessionID,
+	}
+
+	tx := DB.Begin()
+	if err := tx.Model(&File{}).Where("id = ? AND "+notTrashed, file.ID).UpdateColumns(map[string]interface{}{
+		"name":       name,
+		"name_key":   nil,
+		"trashed_at": now,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Create(trash).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	file.Name = name
+	file.NameKey = nil
+	file.TrashedAt = &now
+	return trash, nil
+}
+
+// Restore 将回收站中的文件以 name 恢复至 folderID 目录下，并删除回收站记录
+func (trash *Trash) Restore(folderID uint, name string) error {
+	tx := DB.Begin()
+	if err := tx.Model(&File{}).Where("id = ? AND trashed_at is not NULL", trash.FileID).UpdateColumns(map[string]interface{}{
+		"name":       name,
+		"name_key":   UniqueNameKey(trash.UserID, name),
+		"folder_id":  folderID,
+		"trashed_at": nil,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Unscoped().Delete(trash).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// TrashedFile 获取回收站记录对应的文件
+func (trash *Trash) TrashedFile() (*File, error) {
+	file := &File{}
+	result := DB.Where("id = ? AND trashed_at is not NULL", trash.FileID).First(file)
+	return file, result.Error
+}
+
+// Delete 删除回收站记录
+func (trash *Trash) Delete() error {
+	return DB.Unscoped().Delete(trash).Error
+}
+
+// GetTrashByFileID 查找用户回收站中文件对应的记录
+func GetTrashByFileID(fileID, uid uint) (*Trash, error) {
+	trash := &Trash{}
+	result := DB.Where("file_id = ? AND user_id = ?", fileID, uid).First(trash)
+	return trash, result.Error
+}
+
+// GetTrashByUploadSession 查找用户回收站中被上传会话覆盖的文件对应的记录
+func GetTrashByUploadSession(sessionID string, uid uint) (*Trash, error) {
+	trash := &Trash{}
+	result := DB.Where("upload_session_id = ? AND user_id = ?", sessionID, uid).First(trash)
+	return trash, result.Error
+}
+
+// ListTrash 列出用户回收站中的记录，最近移入的在前
+func ListTrash(uid uint) ([]Trash, error) {
+	var trashes []Trash
+	result := DB.Where("user_id = ?", uid).Order("id desc").Find(&trashes)
+	return trashes, result.Error
+}
+
+// GetExpiredTrash 获取至多 limit 条在 now 之前过期的回收站记录
+func GetExpiredTrash(now time.Time, limit int) ([]Trash, error) {
+	var trashes []Trash
+	result := DB.Where("expires <= ?", now).Order("expires asc").Limit(limit).Find(&trashes)
+	return trashes, result.Error
+}
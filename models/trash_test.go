@@ -0,0 +1,117 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile_MoveToTrash(t *testing.T) {
+	a := assert.New(t)
+
+	// 移入成功
+	{
+		key := "key"
+		file := File{Name: "a.txt", Size: 10, UserID: 1, FolderID: 3, NameKey: &key}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs(".trash_2_a.txt", nil, sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT(.+)trashes(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		trash, err := file.MoveToTrash(time.Hour, nil)
+		a.NoError(mock.ExpectationsWereMet())
+		a.NoError(err)
+		a.True(file.IsTrashed())
+		a.Nil(file.NameKey)
+		a.Equal(".trash_2_a.txt", file.Name)
+		a.Equal("a.txt", trash.Name)
+		a.EqualValues(3, trash.FolderID)
+		a.EqualValues(10, trash.Size)
+		a.WithinDuration(time.Now().Add(time.Hour), trash.Expires, time.Minute)
+	}
+
+	// 创建回收站记录失败
+	{
+		file := File{Name: "a.txt", UserID: 1}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT(.+)trashes(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		_, err := file.MoveToTrash(time.Hour, nil)
+		a.NoError(mock.ExpectationsWereMet())
+		a.Error(err)
+		a.False(file.IsTrashed())
+		a.Equal("a.txt", file.Name)
+	}
+}
+
+func TestTrash_Restore(t *testing.T) {
+	a := assert.New(t)
+	trash := &Trash{UserID: 1, FileID: 2, Name: "a.txt"}
+	trash.ID = 5
+
+	// 恢复成功
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs(4, "a.v1.txt", nil, nil, 2).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("DELETE(.+)trashes(.+)").WithArgs(5).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		a.NoError(trash.Restore(4, "a.v1.txt"))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 更新文件失败
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		a.Error(trash.Restore(4, "a.txt"))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+}
+
+func TestGetExpiredTrash(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT(.+)trashes(.+)expires(.+)").WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "file_id"}).AddRow(1, 2))
+	trashes, err := GetExpiredTrash(now, 10)
+	a.NoError(mock.ExpectationsWereMet())
+	a.NoError(err)
+	a.Len(trashes, 1)
+	a.EqualValues(2, trashes[0].FileID)
+}
+
+func TestGetTrashByFileID(t *testing.T) {
+	a := assert.New(t)
+
+	mock.ExpectQuery("SELECT(.+)trashes(.+)").WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "file_id"}).AddRow(1, 2))
+	trash, err := GetTrashByFileID(2, 1)
+	a.NoError(mock.ExpectationsWereMet())
+	a.NoError(err)
+	a.EqualValues(2, trash.FileID)
+
+	mock.ExpectQuery("SELECT(.+)trashes(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = GetTrashByFileID(3, 1)
+	a.NoError(mock.ExpectationsWereMet())
+	a.Error(err)
+}
+
+func TestGetTrashByUploadSession(t *testing.T) {
+	a := assert.New(t)
+
+	mock.ExpectQuery("SELECT(.+)trashes(.+)upload_session_id(.+)").WithArgs("session", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "file_id"}).AddRow(1, 2))
+	trash, err := GetTrashByUploadSession("session", 1)
+	a.NoError(mock.ExpectationsWereMet())
+	a.NoError(err)
+	a.EqualValues(2, trash.FileID)
+}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+)
+
+// TypeUsage 用户各类型文件的已用容量，用于按文件类型限制容量
+type TypeUsage struct {
+	UserID uint   `gorm:"primary_key;auto_increment:false"`
+	Type   string `gorm:"primary_key;size:16"`
+	Size   uint64
+}
+
+// 按类型统计容量的文件类型
+const (
+	FileTypeImage    = "image"
+	FileTypeVideo    = "video"
+	FileTypeAudio    = "audio"
+	FileTypeDocument = "document"
+	FileTypeArchive  = "archive"
+)
+
+// FileTypes 所有按类型统计容量的文件类型
+var FileTypes = []string{FileTypeImage, FileTypeVideo, FileTypeAudio, FileTypeDocument, FileTypeArchive}
+
+// fileTypeExtensions 各文件类型包含的扩展名，未列出的扩展名根据 MIME 类型判断
+var fileTypeExtensions = map[string][]string{
+	FileTypeImage: {"jpg", "jpeg", "png", "gif", "bmp", "webp", "svg", "tif", "tiff", "heic", "heif", "avif", "ico"},
+	FileTypeVideo: {"mp4", "mkv", "mov", "avi", "webm", "flv", "wmv", "m4v", "ts", "rmvb", "3gp"},
+	FileTypeAudio: {"mp3", "flac", "wav", "aac", "ogg", "m4a", "opus", "wma", "ape"},
+	FileTypeDocument: {"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "odt", "ods", "odp", "rtf",
+		"txt", "md", "csv", "epub"},
+	FileTypeArchive: {"zip", "rar", "7z", "tar", "gz", "bz2", "xz", "zst", "iso"},
+}
+
+// FileTypeOf 返回文件名对应的文件类型，不属于任何类型时返回空值
+func FileTypeOf(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return ""
+	}
+
+	for _, fileType := range FileTypes {
+		if util.ContainsString(fileTypeExtensions[fileType], ext[1:]) {
+			return fileType
+		}
+	}
+
+	switch strings.Split(mime.TypeByExtension(ext), "/")[0] {
+	case "image":
+		return FileTypeImage
+	case "video":
+		return FileTypeVideo
+	case "audio":
+		return FileTypeAudio
+	}
+
+	return ""
+}
+
+// changeTypeUsage 更新用户 uid 中与文件 name 同类型的已用容量，尚未统计过的用户不做处理
+func changeTypeUsage(tx *gorm.DB, uid uint, name, operator string, size uint64) error {
+	fileType := FileTypeOf(name)
+	if fileType == "" || size == 0 {
+		return nil
+	}
+
+	return tx.Model(&TypeUsage{}).
+		Where("user_id = ? AND type = ?", uid, fileType).
+		UpdateColumn("size", gorm.Expr("size "+operator+" ?", size)).Error
+}
+
+// GetTypeUsage 返回用户某一类型文件的已用容量，首次查询时统计用户的全部文件
+func GetTypeUsage(uid uint, fileType string) (uint64, error) {
+	var usage TypeUsage
+	err := DB.Where("user_id = ? AND type = ?", uid, fileType).First(&usage).Error
+	if err == nil {
+		return usage.Size, nil
+	}
+
+	if !gorm.IsRecordNotFoundError(err) {
+		return 0, err
+	}
+
+	usages, err := initTypeUsage(uid)
+	if err != nil {
+		return 0, err
+	}
+
+	return usages[fileType], nil
+}
+
+// initTypeUsage 统计用户各类型文件的已用容量并保存
+func initTypeUsage(uid uint) (map[string]uint64, error) {
+	rows, err := DB.Model(&File{}).Where("user_id = ? AND "+notQuarantined, uid).Select("name, size").Rows()
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make(map[string]uint64, len(FileTypes))
+	for rows.Next() {
+		var (
+			name string
+			size uint64
+		)
+		if err := rows.Scan(&name, &size); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		if fileType := FileTypeOf(name); fileType != "" {
+			usages[fileType] += size
+		}
+	}
+	rows.Close()
+
+	for _, fileType := range FileTypes {
+		var usage TypeUsage
+		if err := DB.Where("user_id = ? AND type = ?", uid, fileType).
+			Attrs(TypeUsage{UserID: uid, Type: fileType, Size: usages[fileType]}).
+			FirstOrCreate(&usage).Error; err != nil {
+			return nil, err
+		}
+		usages[fileType] = usage.Size
+	}
+
+	return usages, nil
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileTypeOf(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal(FileTypeVideo, FileTypeOf("movie.MKV"))
+	asserts.Equal(FileTypeImage, FileTypeOf("1.png"))
+	asserts.Equal(FileTypeDocument, FileTypeOf("a.b.pdf"))
+	asserts.Equal(FileTypeArchive, FileTypeOf("backup.7z"))
+	asserts.Equal(FileTypeAudio, FileTypeOf("song.mp3"))
+	asserts.Equal("", FileTypeOf("README"))
+	asserts.Equal("", FileTypeOf("main.go"))
+}
+
+func TestGetTypeUsage(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 已统计
+	{
+		mock.ExpectQuery("SELECT(.+)type_usages(.+)").WithArgs(1, FileTypeVideo).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "size"}).AddRow(1, FileTypeVideo, 10))
+		usage, err := GetTypeUsage(1, FileTypeVideo)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(10, usage)
+	}
+
+	// 首次查询，统计已有文件
+	{
+		mock.ExpectQuery("SELECT(.+)type_usages(.+)").WithArgs(1, FileTypeVideo).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "size"}))
+		mock.ExpectQuery("SELECT name, size(.+)files(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"name", "size"}).
+				AddRow("1.mp4", 10).AddRow("2.mkv", 20).AddRow("3.txt", 5))
+		for _, fileType := range FileTypes {
+			mock.ExpectQuery("SELECT(.+)type_usages(.+)").WithArgs(1, fileType).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "size"}))
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT(.+)type_usages(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+		}
+		usage, err := GetTypeUsage(1, FileTypeVideo)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(30, usage)
+	}
+
+	// 查询失败
+	{
+		mock.ExpectQuery("SELECT(.+)type_usages(.+)").WithArgs(1, FileTypeVideo).
+			WillReturnError(errors.New("error"))
+		_, err := GetTypeUsage(1, FileTypeVideo)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+	}
+}
+
+func TestFile_RenameTypeUsage(t *testing.T) {
+	asserts := assert.New(t)
+	file := &File{Model: gorm.Model{ID: 1}, UserID: 2, Name: "1.mp4", Size: 10}
+
+	// 类型改变，转移已用容量
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs("1.mp3", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE(.+)type_usages(.+)").WithArgs(10, 2, FileTypeVideo).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE(.+)type_usages(.+)").WithArgs(10, 2, FileTypeAudio).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	asserts.NoError(file.Rename("1.mp3"))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 转移失败
+	file.Name = "1.mp4"
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs("1.mp3", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE(.+)type_usages(.+)").WillReturnError(errors.New("error"))
+	mock.ExpectRollback()
+	asserts.Error(file.Rename("1.mp3"))
+	asserts.NoError(mock.ExpectationsWereMet())
+}
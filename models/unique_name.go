@@ -0,0 +1,61 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// 文件名唯一的范围
+const (
+	// UniqueNameScopeUser 同一用户的全部文件中唯一
+	UniqueNameScopeUser = "user"
+	// UniqueNameScopeInstance 站点的全部文件中唯一
+	UniqueNameScopeInstance = "instance"
+)
+
+// UniqueNameScope 返回 unique_name_scope 设定的文件名唯一范围
+func UniqueNameScope() string {
+	if GetSettingByName("unique_name_scope") == UniqueNameScopeInstance {
+		return UniqueNameScopeInstance
+	}
+
+	return UniqueNameScopeUser
+}
+
+// UniqueNameKey 返回用户 uid 的文件 name 在唯一范围内的摘要，作为 name_key 字段的值。
+// 扩展名不在 unique_name_exts 中的文件无需唯一，返回 nil
+func UniqueNameKey(uid uint, name string) *string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return nil
+	}
+
+	exts := strings.Split(strings.ToLower(GetSettingByName("unique_name_exts")), ",")
+	for i := range exts {
+		exts[i] = strings.TrimPrefix(strings.TrimSpace(exts[i]), ".")
+	}
+	if !util.ContainsString(exts, ext[1:]) {
+		return nil
+	}
+
+	scope := UniqueNameScopeInstance
+	if UniqueNameScope() == UniqueNameScopeUser {
+		scope = fmt.Sprintf("%s/%d", UniqueNameScopeUser, uid)
+	}
+
+	sum := sha256.Sum256([]byte(scope + "/" + name))
+	key := hex.EncodeToString(sum[:])
+	return &key
+}
+
+// GetFileByNameKey 根据文件名摘要查找文件
+func GetFileByNameKey(key string) (*File, error) {
+	file := &File{}
+	result := DB.Where("name_key = ?", key).First(file)
+	return file, result.Error
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniqueNameKey(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_unique_name_exts", "pdf, .XLSX", 0)
+	cache.Set("setting_unique_name_scope", "user", 0)
+	defer cache.Deletes([]string{"unique_name_exts", "unique_name_scope"}, "setting_")
+
+	// 扩展名不需唯一
+	asserts.Nil(UniqueNameKey(1, "invoice.txt"))
+	asserts.Nil(UniqueNameKey(1, "invoice"))
+
+	// 用户范围
+	key := UniqueNameKey(1, "INV-001.pdf")
+	asserts.NotNil(key)
+	asserts.Len(*key, 64)
+	asserts.Equal(*key, *UniqueNameKey(1, "INV-001.pdf"))
+	asserts.NotEqual(*key, *UniqueNameKey(2, "INV-001.pdf"))
+	asserts.NotEqual(*key, *UniqueNameKey(1, "INV-002.pdf"))
+	asserts.NotNil(UniqueNameKey(1, "report.xlsx"))
+
+	// 站点范围
+	cache.Set("setting_unique_name_scope", "instance", 0)
+	asserts.Equal(UniqueNameScopeInstance, UniqueNameScope())
+	asserts.Equal(*UniqueNameKey(1, "INV-001.pdf"), *UniqueNameKey(2, "INV-001.pdf"))
+	asserts.NotEqual(*key, *UniqueNameKey(1, "INV-001.pdf"))
+}
+
+func TestGetFileByNameKey(t *testing.T) {
+	asserts := assert.New(t)
+
+	mock.ExpectQuery("SELECT(.+)files(.+)name_key(.+)").
+		WithArgs("key").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "INV-001.pdf"))
+	file, err := GetFileByNameKey("key")
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.Equal("INV-001.pdf", file.Name)
+
+	mock.ExpectQuery("SELECT(.+)files(.+)name_key(.+)").
+		WithArgs("key").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	_, err = GetFileByNameKey("key")
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Error(err)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
@@ -38,6 +39,12 @@ type User struct {
 	Avatar    string
 	Options   string `json:"-" gorm:"size:4294967295"`
 	Authn     string `gorm:"size:4294967295"`
+	// SessionEpoch 会话纪元，更改密码时递增，使此前登录的会话失效
+	SessionEpoch uint64
+	// FileCount 用户的文件数，随文件的增删原子更新
+	FileCount uint64
+	// FolderCount 用户的目录数，不含根目录，随目录的增删原子更新
+	FolderCount uint64
 
 	// 关联模型
 	Group  Group  `gorm:"save_associations:false:false"`
@@ -55,6 +62,12 @@ func init() {
 type UserOption struct {
 	ProfileOff     bool   `json:"profile_off,omitempty"`
 	PreferredTheme string `json:"preferred_theme,omitempty"`
+	// StorageClass 上传文件默认使用的存储类型，为空时使用存储策略设定
+	StorageClass string `json:"storage_class,omitempty"`
+	// Lifecycle 上传文件的生命周期规则，为空时使用存储策略设定
+	Lifecycle *LifecycleRule `json:"lifecycle,omitempty"`
+	// MaxFiles 文件数配额，为 0 时使用用户组设定
+	MaxFiles uint64 `json:"max_files,omitempty"`
 }
 
 // Root 获取用户的根目录
@@ -64,34 +77,47 @@ func (user *User) Root() (*Folder, error) {
 	return &folder, err
 }
 
-// DeductionStorage 减少用户已用容量
+// DeductionStorage 减少用户已用容量，以数据库中的已用容量为准，不依赖内存中可能已过期的值
 func (user *User) DeductionStorage(size uint64) bool {
 	if size == 0 {
 		return true
 	}
-	if size <= user.Storage {
-		user.Storage -= size
-		DB.Model(user).Update("storage", gorm.Expr("storage - ?", size))
-		return true
+
+	res := DB.Model(user).Where("storage >= ?", size).Update("storage", gorm.Expr("storage - ?", size))
+	if res.Error != nil || res.RowsAffected > 0 {
+		if size <= user.Storage {
+			user.Storage -= size
+		} else {
+			user.Storage = 0
+		}
+		return res.Error == nil
 	}
+
 	// 如果要减少的容量超出已用容量，则设为零
 	user.Storage = 0
-	DB.Model(user).Update("storage", 0)
+	DB.Model(user).Where("storage < ?", size).Update("storage", 0)
 
 	return false
 }
 
-// IncreaseStorage 检查并增加用户已用容量
+// IncreaseStorage 检查并增加用户已用容量。检查与增加在同一条语句中完成，
+// 并发上传时不会因内存中的已用容量过期而超出容量
 func (user *User) IncreaseStorage(size uint64) bool {
 	if size == 0 {
 		return true
 	}
-	if size <= user.GetRemainingCapacity() {
-		user.Storage += size
-		DB.Model(user).Update("storage", gorm.Expr("storage + ?", size))
-		return true
+	if size > user.GetRemainingCapacity() {
+		return false
 	}
-	return false
+
+	res := DB.Model(user).Where("storage <= ?", user.Group.MaxStorage-size).
+		Update("storage", gorm.Expr("storage + ?", size))
+	if res.Error == nil && res.RowsAffected == 0 {
+		return false
+	}
+
+	user.Storage += size
+	return true
 }
 
 // ChangeStorage 更新用户容量
@@ -99,6 +125,89 @@ func (user *User) ChangeStorage(tx *gorm.DB, operator string, size uint64) error
 	return tx.Model(user).Update("storage", gorm.Expr("storage "+operator+" ?", size)).Error
 }
 
+// ChangeUsage 在同一条语句中更新用户已用容量及文件数
+func (user *User) ChangeUsage(tx *gorm.DB, operator string, size, files uint64) error {
+	return tx.Model(user).Updates(map[string]interface{}{
+		"storage":    gorm.Expr("storage "+operator+" ?", size),
+		"file_count": countExpr("file_count", operator, files),
+	}).Error
+}
+
+// ChangeFileCount 更新用户的文件数及目录数，减少时不低于零
+func (user *User) ChangeFileCount(tx *gorm.DB, operator string, files, folders uint64) error {
+	columns := make(map[string]interface{}, 2)
+	if files > 0 {
+		columns["file_count"] = countExpr("file_count", operator, files)
+	}
+	if folders > 0 {
+		columns["folder_count"] = countExpr("folder_count", operator, folders)
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	return tx.Model(user).UpdateColumns(columns).Error
+}
+
+// countExpr 返回增减计数字段的表达式，减少时不低于零
+func countExpr(column, operator string, delta uint64) interface{} {
+	if operator == "-" {
+		return gorm.Expr(fmt.Sprintf("CASE WHEN %[1]s > ? THEN %[1]s - ? ELSE 0 END", column), delta, delta)
+	}
+
+	return gorm.Expr(column+" + ?", delta)
+}
+
+// GetFileCount 从数据库读取用户当前的文件数，includeFolders 为 true 时包含目录数
+func (user *User) GetFileCount(includeFolders bool) (uint64, error) {
+	var counted User
+	if err := DB.Select("file_count, folder_count").Where("id = ?", user.ID).First(&counted).Error; err != nil {
+		return 0, err
+	}
+
+	if includeFolders {
+		return counted.FileCount + counted.FolderCount, nil
+	}
+
+	return counted.FileCount, nil
+}
+
+// MaxFiles 返回用户的文件数配额，用户未单独设定时使用用户组设定，0 表示不限制
+func (user *User) MaxFiles() uint64 {
+	if user.OptionsSerialized.MaxFiles > 0 {
+		return user.OptionsSerialized.MaxFiles
+	}
+
+	return user.Group.OptionsSerialized.MaxFiles
+}
+
+// CalibrateFileCount 按文件及目录记录重新计算用户的文件数及目录数，返回校准后的文件数及目录数
+func (user *User) CalibrateFileCount() (uint64, uint64, error) {
+	files := DB.NewScope(&File{}).TableName()
+	folders := DB.NewScope(&Folder{}).TableName()
+	users := DB.NewScope(user).TableName()
+	if err := DB.Model(user).UpdateColumns(map[string]interface{}{
+		"file_count": gorm.Expr(fmt.Sprintf(
+			"(SELECT COUNT(*) FROM %[1]s WHERE %[1]s.user_id = %[2]s.id AND %[1]s.deleted_at IS NULL)",
+			files, users,
+		)),
+		"folder_count": gorm.Expr(fmt.Sprintf(
+			"(SELECT COUNT(*) FROM %[1]s WHERE %[1]s.owner_id = %[2]s.id AND %[1]s.parent_id IS NOT NULL AND %[1]s.deleted_at IS NULL)",
+			folders, users,
+		)),
+	}).Error; err != nil {
+		return 0, 0, err
+	}
+
+	var calibrated User
+	if err := DB.Select("file_count, folder_count").Where("id = ?", user.ID).First(&calibrated).Error; err != nil {
+		return 0, 0, err
+	}
+
+	user.FileCount, user.FolderCount = calibrated.FileCount, calibrated.FolderCount
+	return calibrated.FileCount, calibrated.FolderCount, nil
+}
+
 // IncreaseStorageWithoutCheck 忽略可用容量，增加用户已用容量
 func (user *User) IncreaseStorageWithoutCheck(size uint64) {
 	if size == 0 {
@@ -109,6 +218,28 @@ func (user *User) IncreaseStorageWithoutCheck(size uint64) {
 
 }
 
+// CalibrateStorage 按文件记录重新计算用户已用容量。计算与写入在同一条语句中完成，
+// 不会覆盖期间并发上传、删除产生的变更。返回校准后的已用容量
+func (user *User) CalibrateStorage() (uint64, error) {
+	files := DB.NewScope(&File{}).TableName()
+	users := DB.NewScope(user).TableName()
+	total := gorm.Expr(fmt.Sprintf(
+		"(SELECT COALESCE(SUM(size), 0) FROM %[1]s WHERE %[1]s.user_id = %[2]s.id AND %[1]s.quarantined_at IS NULL AND %[1]s.deleted_at IS NULL)",
+		files, users,
+	))
+	if err := DB.Model(user).UpdateColumn("storage", total).Error; err != nil {
+		return 0, err
+	}
+
+	var calibrated User
+	if err := DB.Select("storage").Where("id = ?", user.ID).First(&calibrated).Error; err != nil {
+		return 0, err
+	}
+
+	user.Storage = calibrated.Storage
+	return calibrated.Storage, nil
+}
+
 // GetRemainingCapacity 获取剩余配额
 func (user *User) GetRemainingCapacity() uint64 {
 	total := user.Group.MaxStorage
@@ -161,6 +292,13 @@ func GetActiveUserByEmail(email string) (User, error) {
 	return user, result.Error
 }
 
+// GetActiveAdminUsers 获取所有可登录的管理员用户
+func GetActiveAdminUsers() []User {
+	var users []User
+	DB.Where("status = ? and group_id = ?", Active, 1).Find(&users)
+	return users
+}
+
 // NewUser 返回一个新的空 User
 func NewUser() User {
 	options := UserOption{}
@@ -258,6 +396,16 @@ func (user *User) SetPassword(password string) error {
 	return nil
 }
 
+// ChangePassword 更改用户密码并递增会话纪元，使此前登录的会话失效
+func (user *User) ChangePassword(password string) error {
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+
+	user.SessionEpoch++
+	return user.Update(map[string]interface{}{"password": user.Password, "session_epoch": user.SessionEpoch})
+}
+
 // NewAnonymousUser 返回一个匿名用户
 func NewAnonymousUser() *User {
 	user := User{}
@@ -266,6 +414,18 @@ func NewAnonymousUser() *User {
 	return &user
 }
 
+// IsAdmin 返回用户是否为管理员
+func (user *User) IsAdmin() bool {
+	return user.Group.ID == 1 || user.ID == 1
+}
+
+// CanImpersonate 返回用户是否可以模拟 target 进行操作。仅允许具有模拟权限的管理员
+// 模拟其他非管理员用户，避免借此获得超出目标用户本身的权限
+func (user *User) CanImpersonate(target *User) bool {
+	return user.IsAdmin() && user.Group.OptionsSerialized.Impersonate &&
+		target.ID != user.ID && !target.IsAdmin()
+}
+
 // IsAnonymous 返回是否为未登录用户
 func (user *User) IsAnonymous() bool {
 	return user.ID == 0
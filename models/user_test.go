@@ -2,10 +2,13 @@ package model
 
 import (
 	"encoding/json"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
 	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -123,6 +126,24 @@ func TestUser_SetPassword(t *testing.T) {
 	asserts.NotEmpty(user.Password)
 }
 
+func TestUser_ChangePassword(t *testing.T) {
+	asserts := assert.New(t)
+	user := User{}
+	user.ID = 1
+	user.SessionEpoch = 2
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	asserts.NoError(user.ChangePassword("Cause Sega does what nintendon't"))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.EqualValues(3, user.SessionEpoch)
+
+	res, err := user.CheckPassword("Cause Sega does what nintendon't")
+	asserts.NoError(err)
+	asserts.True(res)
+}
+
 func TestUser_CheckPassword(t *testing.T) {
 	asserts := assert.New(t)
 	user := User{}
@@ -276,6 +297,17 @@ func TestUser_DeductionCapacity(t *testing.T) {
 	asserts.Equal(uint64(100), newUser.Storage)
 
 	asserts.True(newUser.IncreaseStorage(0))
+
+	// 数据库中的已用容量已被并发上传占用
+	{
+		user := User{Model: gorm.Model{ID: 1}, Group: Group{MaxStorage: 100}}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)storage(.+)").WithArgs(10, sqlmock.AnyArg(), 1, 90).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		asserts.False(user.IncreaseStorage(10))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(uint64(0), user.Storage)
+	}
 }
 
 func TestUser_DeductionStorage(t *testing.T) {
@@ -294,7 +326,7 @@ func TestUser_DeductionStorage(t *testing.T) {
 			Storage: 10,
 		}
 		mock.ExpectBegin()
-		mock.ExpectExec("UPDATE(.+)").WithArgs(5, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)").WithArgs(5, sqlmock.AnyArg(), 1, 5).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
 		asserts.True(user.DeductionStorage(5))
@@ -309,7 +341,10 @@ func TestUser_DeductionStorage(t *testing.T) {
 			Storage: 10,
 		}
 		mock.ExpectBegin()
-		mock.ExpectExec("UPDATE(.+)").WithArgs(0, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)").WithArgs(20, sqlmock.AnyArg(), 1, 20).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WithArgs(0, sqlmock.AnyArg(), 1, 20).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
 		asserts.False(user.DeductionStorage(20))
@@ -318,6 +353,188 @@ func TestUser_DeductionStorage(t *testing.T) {
 	}
 }
 
+func TestUser_StorageConcurrentSQLite(t *testing.T) {
+	asserts := assert.New(t)
+	conf.DatabaseConfig.Type = "sqlite3"
+	DB, _ = gorm.Open("sqlite3", ":memory:")
+	DB.DB().SetMaxOpenConns(1)
+	defer func() {
+		DB.Close()
+		conf.DatabaseConfig.Type = "mysql"
+		DB = mockDB
+	}()
+	asserts.NoError(DB.AutoMigrate(&User{}, &File{}).Error)
+
+	owner := User{Email: "a@a.com"}
+	asserts.NoError(DB.Create(&owner).Error)
+	stored := func() uint64 {
+		var user User
+		asserts.NoError(DB.Where("id = ?", owner.ID).First(&user).Error)
+		return user.Storage
+	}
+
+	// 并发上传，每个请求持有各自的用户对象，已用容量均已过期
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := User{Model: gorm.Model{ID: owner.ID}, Group: Group{MaxStorage: 1000}}
+			if user.IncreaseStorage(30) {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	asserts.Equal(33, succeeded)
+	asserts.Equal(uint64(990), stored())
+
+	// 并发上传与删除
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			user := User{Model: gorm.Model{ID: owner.ID}, Storage: 990}
+			asserts.True(user.DeductionStorage(10))
+		}()
+		go func() {
+			defer wg.Done()
+			user := User{Model: gorm.Model{ID: owner.ID}}
+			user.IncreaseStorageWithoutCheck(3)
+		}()
+	}
+	wg.Wait()
+	asserts.Equal(uint64(990-200+60), stored())
+
+	// 超出已用容量的减少归零
+	{
+		user := User{Model: gorm.Model{ID: owner.ID}}
+		asserts.False(user.DeductionStorage(1000))
+		asserts.Equal(uint64(0), stored())
+	}
+
+	// 按文件记录校准，忽略已隔离的文件
+	{
+		now := time.Now()
+		asserts.NoError(DB.Create(&File{Name: "1.txt", UserID: owner.ID, Size: 10}).Error)
+		asserts.NoError(DB.Create(&File{Name: "2.txt", UserID: owner.ID, Size: 20}).Error)
+		asserts.NoError(DB.Create(&File{Name: "3.txt", UserID: owner.ID, Size: 40, QuarantinedAt: &now}).Error)
+		asserts.NoError(DB.Create(&File{Name: "4.txt", UserID: owner.ID + 1, Size: 80}).Error)
+
+		user := User{Model: gorm.Model{ID: owner.ID}, Storage: 999}
+		total, err := user.CalibrateStorage()
+		asserts.NoError(err)
+		asserts.Equal(uint64(30), total)
+		asserts.Equal(uint64(30), user.Storage)
+		asserts.Equal(uint64(30), stored())
+	}
+}
+
+func TestUser_FileCountSQLite(t *testing.T) {
+	asserts := assert.New(t)
+	conf.DatabaseConfig.Type = "sqlite3"
+	DB, _ = gorm.Open("sqlite3", ":memory:")
+	DB.DB().SetMaxOpenConns(1)
+	defer func() {
+		DB.Close()
+		conf.DatabaseConfig.Type = "mysql"
+		DB = mockDB
+	}()
+	asserts.NoError(DB.AutoMigrate(&User{}, &File{}, &Folder{}, &TypeUsage{}).Error)
+
+	owner := User{Email: "a@a.com"}
+	asserts.NoError(DB.Create(&owner).Error)
+	root, err := owner.Root()
+	asserts.NoError(err)
+
+	// 根目录不计入，新建文件、目录时增加
+	{
+		count, err := owner.GetFileCount(true)
+		asserts.NoError(err)
+		asserts.EqualValues(0, count)
+
+		folder := Folder{Name: "sub", ParentID: &root.ID, OwnerID: owner.ID}
+		_, err = folder.Create()
+		asserts.NoError(err)
+		asserts.NoError((&File{Name: "1.txt", UserID: owner.ID, FolderID: root.ID, Size: 10}).Create())
+		asserts.NoError((&File{Name: "2.txt", UserID: owner.ID, FolderID: folder.ID, Size: 20}).Create())
+
+		count, err = owner.GetFileCount(false)
+		asserts.NoError(err)
+		asserts.EqualValues(2, count)
+		count, err = owner.GetFileCount(true)
+		asserts.NoError(err)
+		asserts.EqualValues(3, count)
+	}
+
+	// 复制文件及目录
+	{
+		sub, err := root.GetChild("sub")
+		asserts.NoError(err)
+		_, err = root.CopyFolderTo(sub.ID, sub)
+		asserts.NoError(err)
+
+		count, err := owner.GetFileCount(true)
+		asserts.NoError(err)
+		asserts.EqualValues(5, count)
+	}
+
+	// 删除文件及目录
+	{
+		files, err := GetChildFilesOfFolders(&[]Folder{*root})
+		asserts.NoError(err)
+		deleted := make([]*File, len(files))
+		for i := range files {
+			deleted[i] = &files[i]
+		}
+		asserts.NoError(DeleteFiles(deleted, owner.ID))
+
+		folders, err := GetRecursiveChildFolder([]uint{root.ID}, owner.ID, false)
+		asserts.NoError(err)
+		ids := make([]uint, len(folders))
+		for i := range folders {
+			ids[i] = folders[i].ID
+		}
+		asserts.NoError(DeleteFolderByIDs(ids, owner.ID))
+
+		count, err := owner.GetFileCount(true)
+		asserts.NoError(err)
+		asserts.EqualValues(2, count)
+	}
+
+	// 减少不低于零
+	{
+		asserts.NoError(owner.ChangeFileCount(DB, "-", 10, 10))
+		count, err := owner.GetFileCount(true)
+		asserts.NoError(err)
+		asserts.EqualValues(0, count)
+	}
+
+	// 按记录校准
+	{
+		files, folders, err := owner.CalibrateFileCount()
+		asserts.NoError(err)
+		asserts.EqualValues(2, files)
+		asserts.EqualValues(0, folders)
+	}
+}
+
+func TestUser_MaxFiles(t *testing.T) {
+	asserts := assert.New(t)
+	user := User{}
+	asserts.EqualValues(0, user.MaxFiles())
+
+	user.Group.OptionsSerialized.MaxFiles = 100
+	asserts.EqualValues(100, user.MaxFiles())
+
+	user.OptionsSerialized.MaxFiles = 10
+	asserts.EqualValues(10, user.MaxFiles())
+}
+
 func TestUser_IncreaseStorageWithoutCheck(t *testing.T) {
 	asserts := assert.New(t)
 
@@ -414,6 +631,32 @@ func TestUser_IsAnonymous(t *testing.T) {
 	asserts.False(user.IsAnonymous())
 }
 
+func TestUser_CanImpersonate(t *testing.T) {
+	asserts := assert.New(t)
+	admin := &User{}
+	admin.ID = 2
+	admin.Group.ID = 1
+	target := &User{}
+	target.ID = 3
+	target.Group.ID = 2
+
+	// 未授予模拟权限
+	asserts.True(admin.IsAdmin())
+	asserts.False(admin.CanImpersonate(target))
+
+	admin.Group.OptionsSerialized.Impersonate = true
+	asserts.True(admin.CanImpersonate(target))
+
+	// 不能模拟自己或其他管理员
+	asserts.False(admin.CanImpersonate(admin))
+	asserts.False(admin.CanImpersonate(&User{Model: gorm.Model{ID: 1}}))
+
+	// 非管理员
+	target.Group.OptionsSerialized.Impersonate = true
+	asserts.False(target.IsAdmin())
+	asserts.False(target.CanImpersonate(&User{Model: gorm.Model{ID: 4}}))
+}
+
 func TestUser_SetStatus(t *testing.T) {
 	asserts := assert.New(t)
 	user := User{}
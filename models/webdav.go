@@ -11,6 +11,9 @@ type Webdav struct {
 	Password string `gorm:"unique_index:password_only_on"` // 应用密码
 	UserID   uint   `gorm:"unique_index:password_only_on"` // 用户ID
 	Root     string `gorm:"type:text"`                     // 根目录
+	// 旧版客户端发送文件名所用的字符集，为空时使用用户组设定
+	Charset     string `gorm:"size:32"`
+	EncodeNames bool   // 响应中的路径是否也转换为 Charset 编码
 }
 
 // Create 创建账户
@@ -21,6 +24,15 @@ func (webdav *Webdav) Create() (uint, error) {
 	return webdav.ID, nil
 }
 
+// NameCharset 返回客户端文件名的字符集及响应中是否转换编码，账户未设定时使用用户组设定
+func (webdav *Webdav) NameCharset(group *Group) (string, bool) {
+	if webdav.Charset != "" {
+		return webdav.Charset, webdav.EncodeNames
+	}
+
+	return group.OptionsSerialized.WebDAVCharset, group.OptionsSerialized.WebDAVNameEncode
+}
+
 // GetWebdavByPassword 根据密码和用户查找Webdav应用
 func GetWebdavByPassword(password string, uid uint) (*Webdav, error) {
 	webdav := &Webdav{}
@@ -58,3 +58,22 @@ func TestDeleteWebDAVAccountByID(t *testing.T) {
 	DeleteWebDAVAccountByID(1, 1)
 	asserts.NoError(mock.ExpectationsWereMet())
 }
+
+func TestWebdav_NameCharset(t *testing.T) {
+	asserts := assert.New(t)
+	group := &Group{OptionsSerialized: GroupOption{WebDAVCharset: "gbk", WebDAVNameEncode: true}}
+
+	// 使用用户组设定
+	{
+		charset, encode := (&Webdav{}).NameCharset(group)
+		asserts.Equal("gbk", charset)
+		asserts.True(encode)
+	}
+
+	// 账户设定优先
+	{
+		charset, encode := (&Webdav{Charset: "latin1"}).NameCharset(group)
+		asserts.Equal("latin1", charset)
+		asserts.False(encode)
+	}
+}
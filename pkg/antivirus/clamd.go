@@ -0,0 +1,107 @@
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// chunkSize INSTREAM 每个数据块的大小，不能超过 clamd 的 StreamMaxLength
+const chunkSize = 64 << 10
+
+// ErrStreamTooLarge 文件超过 clamd 允许扫描的最大长度
+var ErrStreamTooLarge = errors.New("file exceeds clamd StreamMaxLength")
+
+// dial 连接 clamd，address 形如 unix:/path/to/clamd.ctl、tcp://host:port 或 host:port
+func dial(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	switch {
+	case strings.HasPrefix(address, "unix:"):
+		return dialer.DialContext(ctx, "unix", strings.TrimPrefix(strings.TrimPrefix(address, "unix:"), "//"))
+	case strings.HasPrefix(address, "tcp://"):
+		return dialer.DialContext(ctx, "tcp", strings.TrimPrefix(address, "tcp://"))
+	default:
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+}
+
+// Scan 使用 clamd 的 INSTREAM 命令扫描 r 的内容，发现病毒时返回病毒名称，未发现时返回空字符串
+func Scan(ctx context.Context, address string, r io.Reader) (string, error) {
+	conn, err := dial(ctx, address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("failed to send command to clamd: %w", err)
+	}
+
+	// 数据块以 4 字节大端序长度开头，长度为 0 的块表示结束
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				// clamd 超出长度限制时会回复错误并关闭连接
+				if reply, rerr := readReply(conn); rerr == nil {
+					return parseReply(reply)
+				}
+				return "", fmt.Errorf("failed to send content to clamd: %w", werr)
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read content: %w", err)
+		}
+	}
+
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", fmt.Errorf("failed to send content to clamd: %w", err)
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+
+	return parseReply(reply)
+}
+
+// readReply 读取以 \0 结尾的 clamd 回复
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// parseReply 解析扫描结果，如 "stream: OK"、"stream: Eicar-Signature FOUND"
+func parseReply(reply string) (string, error) {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	case strings.Contains(result, "size limit exceeded"):
+		return "", ErrStreamTooLarge
+	default:
+		return "", fmt.Errorf("clamd error: %s", result)
+	}
+}
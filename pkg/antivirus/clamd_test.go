@@ -0,0 +1,113 @@
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClamd 模拟 clamd，读取 INSTREAM 内容后回复 reply 函数的结果
+func fakeClamd(t *testing.T, reply func(content string) string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					return
+				}
+
+				var content strings.Builder
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&content, r, int64(n)); err != nil {
+						return
+					}
+				}
+
+				conn.Write([]byte(reply(content.String()) + "\x00"))
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestScan(t *testing.T) {
+	asserts := assert.New(t)
+	address := fakeClamd(t, func(content string) string {
+		switch {
+		case strings.Contains(content, "EICAR"):
+			return "stream: Eicar-Signature FOUND"
+		case content == "broken":
+			return "INSTREAM size limit exceeded. ERROR"
+		default:
+			return "stream: OK"
+		}
+	})
+
+	// 未发现病毒，内容超过一个数据块
+	{
+		threat, err := Scan(context.Background(), "tcp://"+address, strings.NewReader(strings.Repeat("a", chunkSize+10)))
+		asserts.NoError(err)
+		asserts.Empty(threat)
+	}
+
+	// 发现病毒
+	{
+		threat, err := Scan(context.Background(), address, strings.NewReader("X5O!P%@AP EICAR"))
+		asserts.NoError(err)
+		asserts.Equal("Eicar-Signature", threat)
+	}
+
+	// 超出长度限制
+	{
+		_, err := Scan(context.Background(), address, strings.NewReader("broken"))
+		asserts.Equal(ErrStreamTooLarge, err)
+	}
+
+	// 无法连接
+	{
+		_, err := Scan(context.Background(), "unix:/not/exist/clamd.ctl", strings.NewReader("a"))
+		asserts.Error(err)
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	asserts := assert.New(t)
+
+	threat, err := parseReply("stream: OK")
+	asserts.NoError(err)
+	asserts.Empty(threat)
+
+	threat, err = parseReply("stream: Win.Test.EICAR_HDB-1 FOUND")
+	asserts.NoError(err)
+	asserts.Equal("Win.Test.EICAR_HDB-1", threat)
+
+	_, err = parseReply("stream: Can't allocate memory ERROR")
+	asserts.Error(err)
+}
@@ -8,7 +8,6 @@ import (
 	"net/url"
 	"sort"
 	"strings"
-	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
@@ -41,7 +40,7 @@ type Auth interface {
 func SignRequest(instance Auth, r *http.Request, expires int64) *http.Request {
 	// 处理有效期
 	if expires > 0 {
-		expires += time.Now().Unix()
+		expires += nowUnix()
 	}
 
 	// 生成签名
@@ -98,7 +97,7 @@ func getSignContent(r *http.Request) (rawSignString string) {
 func SignURI(instance Auth, uri string, expires int64) (*url.URL, error) {
 	// 处理有效期
 	if expires != 0 {
-		expires += time.Now().Unix()
+		expires += nowUnix()
 	}
 
 	base, err := url.Parse(uri)
@@ -133,11 +132,16 @@ func Init() {
 	var secretKey string
 	if conf.SystemConfig.Mode == "master" {
 		secretKey = model.GetSettingByName("secret_key")
+		ClockSkew = int64(model.GetIntSetting("sign_clock_skew", 30))
 	} else {
 		secretKey = conf.SlaveConfig.Secret
 		if secretKey == "" {
 			util.Log().Panic("SlaveSecret is not set, please specify it in config file.")
 		}
+		ClockSkew = int64(conf.SlaveConfig.ClockSkew)
+	}
+	if ClockSkew < 0 {
+		ClockSkew = 0
 	}
 	General = HMACAuth{
 		SecretKey: []byte(secretKey),
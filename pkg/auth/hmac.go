@@ -10,6 +10,16 @@ import (
 	"time"
 )
 
+// ClockSkew 校验签名有效期时容忍的时钟偏差，单位为秒。过期时间早于当前时间
+// 不超过此值的签名仍被接受，以免签名端与校验端时钟不一致时拒绝有效的签名
+var ClockSkew int64
+
+// nowUnix 返回当前的 Unix 时间戳，签名与校验均使用此时钟。Unix 时间戳始终基于 UTC，
+// 不受服务器时区设置影响
+var nowUnix = func() int64 {
+	return time.Now().UTC().Unix()
+}
+
 // HMACAuth HMAC算法鉴权
 type HMACAuth struct {
 	SecretKey []byte
@@ -41,8 +51,8 @@ func (auth HMACAuth) Check(body string, sign string) error {
 	if err != nil {
 		return ErrAuthFailed.WithError(err)
 	}
-	// 如果签名过期
-	if expires < time.Now().Unix() && expires != 0 {
+	// 如果签名过期，容忍 ClockSkew 秒的时钟偏差
+	if expires != 0 && expires+ClockSkew < nowUnix() {
 		return ErrExpired
 	}
 
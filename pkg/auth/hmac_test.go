@@ -80,11 +80,46 @@ func TestHMACAuth_Check(t *testing.T) {
 	}
 }
 
+func TestHMACAuth_CheckClockSkew(t *testing.T) {
+	asserts := assert.New(t)
+	auth := HMACAuth{
+		SecretKey: []byte(util.RandStringRunes(256)),
+	}
+	nowUnix = func() int64 { return 1000 }
+	defer func() {
+		nowUnix = func() int64 { return time.Now().UTC().Unix() }
+		ClockSkew = 0
+	}()
+
+	// 不容忍偏差
+	ClockSkew = 0
+	asserts.NoError(auth.Check("content", auth.Sign("content", 1000)))
+	asserts.Equal(ErrExpired, auth.Check("content", auth.Sign("content", 999)))
+
+	// 偏差窗口内仍有效
+	ClockSkew = 30
+	asserts.NoError(auth.Check("content", auth.Sign("content", 970)))
+	asserts.NoError(auth.Check("content", auth.Sign("content", 999)))
+
+	// 超出偏差窗口
+	asserts.Equal(ErrExpired, auth.Check("content", auth.Sign("content", 969)))
+
+	// 永不过期的签名不受影响
+	asserts.NoError(auth.Check("content", auth.Sign("content", 0)))
+
+	// 签名时使用同一时钟
+	signed, err := SignURI(auth, "/api/v3/test", 10)
+	asserts.NoError(err)
+	asserts.Contains(signed.Query().Get("sign"), ":1010")
+}
+
 func TestInit(t *testing.T) {
 	asserts := assert.New(t)
 	mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow(1, "12312312312312"))
+	mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow(2, "-5"))
 	Init()
 	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.EqualValues(0, ClockSkew)
 
 	// slave模式
 	conf.SystemConfig.Mode = "slave"
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+const (
+	// CrHeaderNonce 请求的一次性随机串
+	CrHeaderNonce = CrHeaderPrefix + "Nonce"
+	// CrHeaderTimestamp 请求发出时的 Unix 时间戳
+	CrHeaderTimestamp = CrHeaderPrefix + "Timestamp"
+
+	// nonceCachePrefix 已使用的 nonce 在缓存中的键前缀
+	nonceCachePrefix = "request_nonce_"
+	// nonceLength nonce 的长度
+	nonceLength = 32
+)
+
+var (
+	ErrNonceMissing    = serializer.NewError(serializer.CodeNoPermissionErr, "nonce or timestamp is missing", nil)
+	ErrTimestampSkewed = serializer.NewError(serializer.CodeSignExpired, "timestamp is out of acceptable window", nil)
+	ErrRequestReplayed = serializer.NewError(serializer.CodeInvalidSign, "request has been replayed", nil)
+)
+
+// NonceHeader 生成包含随机 nonce 及当前时间戳的请求头，需在签名前加入请求，
+// 以使二者一同被签名
+func NonceHeader() http.Header {
+	header := http.Header{}
+	header.Set(CrHeaderNonce, util.RandStringRunes(nonceLength))
+	header.Set(CrHeaderTimestamp, strconv.FormatInt(nowUnix(), 10))
+	return header
+}
+
+// CheckNonce 校验请求时间戳与当前时间相差不超过 tolerance 秒，且 nonce 未被使用过。
+// 已使用的 nonce 在缓存中保留至时间戳离开接受窗口为止。应在签名校验通过后调用
+func CheckNonce(r *http.Request, tolerance int64) error {
+	nonce := r.Header.Get(CrHeaderNonce)
+	timestamp, err := strconv.ParseInt(r.Header.Get(CrHeaderTimestamp), 10, 64)
+	if nonce == "" || err != nil {
+		return ErrNonceMissing
+	}
+
+	now := nowUnix()
+	if timestamp < now-tolerance || timestamp > now+tolerance {
+		return ErrTimestampSkewed
+	}
+
+	// 时间戳最晚在 timestamp + tolerance 时离开接受窗口。记录与检查须为原子操作，
+	// 否则同一请求的并发副本可能同时通过检查
+	ttl := int(timestamp + tolerance - now + 1)
+	set, err := cache.SetNX(nonceCachePrefix+nonce, timestamp, ttl)
+	if err != nil {
+		return serializer.NewError(serializer.CodeCacheOperation, "Failed to record nonce", err)
+	}
+
+	if !set {
+		return ErrRequestReplayed
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckNonce(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 缺少 nonce
+	{
+		r, _ := http.NewRequest("POST", "/api/v3/callback", nil)
+		asserts.Equal(ErrNonceMissing, CheckNonce(r, 300))
+	}
+
+	// 成功，重放失败
+	{
+		r, _ := http.NewRequest("POST", "/api/v3/callback", nil)
+		r.Header = NonceHeader()
+		asserts.NoError(CheckNonce(r, 300))
+		asserts.Equal(ErrRequestReplayed, CheckNonce(r, 300))
+	}
+
+	// 并发重放，仅有一个请求通过
+	{
+		header := NonceHeader()
+		var (
+			wg     sync.WaitGroup
+			passed int32
+			mu     sync.Mutex
+		)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r, _ := http.NewRequest("POST", "/api/v3/callback", nil)
+				r.Header = header.Clone()
+				if CheckNonce(r, 300) == nil {
+					mu.Lock()
+					passed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		asserts.EqualValues(1, passed)
+	}
+
+	// 时间戳过旧
+	{
+		r, _ := http.NewRequest("POST", "/api/v3/callback", nil)
+		r.Header = NonceHeader()
+		r.Header.Set(CrHeaderTimestamp, strconv.FormatInt(time.Now().Unix()-301, 10))
+		asserts.Equal(ErrTimestampSkewed, CheckNonce(r, 300))
+	}
+
+	// 时间戳超前
+	{
+		r, _ := http.NewRequest("POST", "/api/v3/callback", nil)
+		r.Header = NonceHeader()
+		r.Header.Set(CrHeaderTimestamp, strconv.FormatInt(time.Now().Unix()+301, 10))
+		asserts.Equal(ErrTimestampSkewed, CheckNonce(r, 300))
+	}
+}
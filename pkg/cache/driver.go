@@ -34,6 +34,9 @@ type Driver interface {
 	// 设置值，ttl为过期时间，单位为秒
 	Set(key string, value interface{}, ttl int) error
 
+	// 仅在键不存在时设置值，返回是否设置成功，ttl为过期时间，单位为秒
+	SetNX(key string, value interface{}, ttl int) (bool, error)
+
 	// 取值，并返回是否成功
 	Get(key string) (interface{}, bool)
 
@@ -52,6 +55,11 @@ func Set(key string, value interface{}, ttl int) error {
 	return Store.Set(key, value, ttl)
 }
 
+// SetNX 仅在键不存在时设置缓存值，返回是否设置成功
+func SetNX(key string, value interface{}, ttl int) (bool, error) {
+	return Store.SetNX(key, value, ttl)
+}
+
 // Get 获取缓存值
 func Get(key string) (interface{}, bool) {
 	return Store.Get(key)
@@ -10,6 +10,9 @@ import (
 // MemoStore 内存存储驱动
 type MemoStore struct {
 	Store *sync.Map
+
+	// setNXLock 保证 SetNX 的检查与写入不被其他 SetNX 打断
+	setNXLock sync.Mutex
 }
 
 // item 存储的对象
@@ -74,6 +77,19 @@ func (store *MemoStore) Set(key string, value interface{}, ttl int) error {
 	return nil
 }
 
+// SetNX 仅在键不存在或已过期时存储值
+func (store *MemoStore) SetNX(key string, value interface{}, ttl int) (bool, error) {
+	store.setNXLock.Lock()
+	defer store.setNXLock.Unlock()
+
+	if _, ok := getValue(store.Store.Load(key)); ok {
+		return false, nil
+	}
+
+	store.Store.Store(key, newItem(value, ttl))
+	return true, nil
+}
+
 // Get 取值
 func (store *MemoStore) Get(key string) (interface{}, bool) {
 	return getValue(store.Store.Load(key))
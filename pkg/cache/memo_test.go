@@ -26,6 +26,31 @@ func TestMemoStore_Set(t *testing.T) {
 	asserts.Equal("vAL", val.(itemWithTTL).value)
 }
 
+func TestMemoStore_SetNX(t *testing.T) {
+	asserts := assert.New(t)
+	store := NewMemoStore()
+
+	// 键不存在
+	set, err := store.SetNX("KEY", "vAL", -1)
+	asserts.NoError(err)
+	asserts.True(set)
+
+	// 键已存在
+	set, err = store.SetNX("KEY", "vAL2", -1)
+	asserts.NoError(err)
+	asserts.False(set)
+	val, _ := store.Get("KEY")
+	asserts.Equal("vAL", val)
+
+	// 键已过期
+	store.Store.Store("EXPIRED", itemWithTTL{value: "old", expires: time.Now().Unix() - 1})
+	set, err = store.SetNX("EXPIRED", "new", 10)
+	asserts.NoError(err)
+	asserts.True(set)
+	val, _ = store.Get("EXPIRED")
+	asserts.Equal("new", val)
+}
+
 func TestMemoStore_Get(t *testing.T) {
 	asserts := assert.New(t)
 	store := NewMemoStore()
@@ -96,6 +96,55 @@ func TestRedisStore_Set(t *testing.T) {
 
 }
 
+func TestRedisStore_SetNX(t *testing.T) {
+	asserts := assert.New(t)
+	conn := redigomock.NewConn()
+	pool := &redis.Pool{
+		Dial:    func() (redis.Conn, error) { return conn, nil },
+		MaxIdle: 10,
+	}
+	store := &RedisStore{pool: pool}
+
+	// 设置成功
+	{
+		cmd := conn.Command("SET", "test", redigomock.NewAnyData(), "NX", "EX", 10).Expect("OK")
+		set, err := store.SetNX("test", "test val", 10)
+		asserts.NoError(err)
+		asserts.True(set)
+		asserts.Equal(1, conn.Stats(cmd))
+	}
+
+	// 键已存在
+	{
+		conn.Clear()
+		cmd := conn.Command("SET", "test", redigomock.NewAnyData(), "NX").Expect(nil)
+		set, err := store.SetNX("test", "test val", -1)
+		asserts.NoError(err)
+		asserts.False(set)
+		asserts.Equal(1, conn.Stats(cmd))
+	}
+
+	// 命令执行失败
+	{
+		conn.Clear()
+		conn.Command("SET", "test", redigomock.NewAnyData(), "NX").ExpectError(errors.New("error"))
+		set, err := store.SetNX("test", "test val", -1)
+		asserts.Error(err)
+		asserts.False(set)
+	}
+
+	// 获取连接失败
+	{
+		store.pool = &redis.Pool{
+			Dial:    func() (redis.Conn, error) { return nil, errors.New("error") },
+			MaxIdle: 10,
+		}
+		set, err := store.SetNX("test", "test val", -1)
+		asserts.Error(err)
+		asserts.False(set)
+	}
+}
+
 func TestRedisStore_Get(t *testing.T) {
 	asserts := assert.New(t)
 	conn := redigomock.NewConn()
@@ -15,6 +15,7 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"io"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -413,7 +414,38 @@ func getAria2RequestBody(body *serializer.SlaveAria2Call) (io.Reader, error) {
 	return strings.NewReader(string(reqBodyEncoded)), nil
 }
 
-// RemoteCallback 发送远程存储策略上传回调请求
+// ErrCallbackUndelivered 重试次数用尽后回调请求仍未送达主机
+var ErrCallbackUndelivered = errors.New("callback request could not be delivered to master")
+
+// callbackLogLock 保护未送达回调记录文件的并发写入
+var callbackLogLock sync.Mutex
+
+// retryableCallbackError 可重试的回调错误，即主机暂时无法访问或返回 5xx
+type retryableCallbackError struct {
+	err error
+}
+
+func (e *retryableCallbackError) Error() string {
+	return e.err.Error()
+}
+
+// undeliveredCallback 未送达的回调请求，记录在 CallbackFailedLog 中，每行一条
+type undeliveredCallback struct {
+	Time  time.Time       `json:"time"`
+	URL   string          `json:"url"`
+	Body  json.RawMessage `json:"body"`
+	Error string          `json:"error"`
+}
+
+// IsCallbackUndelivered 返回 err 是否为重试用尽后仍未送达主机的回调错误
+func IsCallbackUndelivered(err error) bool {
+	var appErr serializer.AppError
+	return errors.As(err, &appErr) && errors.Is(appErr.RawError, ErrCallbackUndelivered)
+}
+
+// RemoteCallback 发送远程存储策略上传回调请求。主机无法访问或返回 5xx 时按指数退避重试，
+// 包括重试在内的总时长不超过 CallbackRetryWindow，避免长时间阻塞客户端的上传请求。重试用尽后
+// 将请求内容记录到 CallbackFailedLog，返回的错误可由 IsCallbackUndelivered 识别；主机拒绝回调时不重试
 func RemoteCallback(url string, body serializer.UploadCallback) error {
 	callbackBody, err := json.Marshal(struct {
 		Data serializer.UploadCallback `json:"data"`
@@ -424,16 +456,69 @@ func RemoteCallback(url string, body serializer.UploadCallback) error {
 		return serializer.NewError(serializer.CodeCallbackError, "Failed to encode callback content", err)
 	}
 
+	var deadline time.Time
+	if conf.SlaveConfig.CallbackRetryWindow > 0 {
+		deadline = time.Now().Add(time.Duration(conf.SlaveConfig.CallbackRetryWindow) * time.Second)
+	}
+
+	delay := time.Duration(conf.SlaveConfig.CallbackRetryDelay) * time.Second
+	for attempt := 1; ; attempt++ {
+		err = sendCallback(url, callbackBody, callbackTimeout(deadline))
+
+		var retryable *retryableCallbackError
+		if !errors.As(err, &retryable) {
+			return err
+		}
+
+		if attempt >= conf.SlaveConfig.CallbackMaxAttempts || (!deadline.IsZero() && time.Now().Add(delay).After(deadline)) {
+			saveUndeliveredCallback(url, callbackBody, err)
+			return serializer.NewError(
+				serializer.CodeCallbackError,
+				fmt.Sprintf("Callback request could not be delivered after %d attempts", attempt),
+				fmt.Errorf("%w: %s", ErrCallbackUndelivered, err),
+			)
+		}
+
+		util.Log().Warning("Failed to send callback to %q (attempt %d), retry in %s: %s", url, attempt, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// callbackTimeout 返回单次回调请求的超时时间，不超过重试总时长的剩余部分
+func callbackTimeout(deadline time.Time) time.Duration {
+	timeout := time.Duration(conf.SlaveConfig.CallbackTimeout) * time.Second
+	if deadline.IsZero() {
+		return timeout
+	}
+
+	if remaining := time.Until(deadline); remaining < timeout {
+		if remaining < time.Second {
+			return time.Second
+		}
+		return remaining
+	}
+
+	return timeout
+}
+
+// sendCallback 发送一次回调请求
+func sendCallback(url string, callbackBody []byte, timeout time.Duration) error {
 	resp := request.GeneralClient.Request(
 		"POST",
 		url,
 		bytes.NewReader(callbackBody),
-		request.WithTimeout(time.Duration(conf.SlaveConfig.CallbackTimeout)*time.Second),
+		request.WithTimeout(timeout),
+		request.WithHeader(auth.NonceHeader()),
 		request.WithCredential(auth.General, int64(conf.SlaveConfig.SignatureTTL)),
 	)
 
 	if resp.Err != nil {
-		return serializer.NewError(serializer.CodeCallbackError, "Slave cannot send callback request", resp.Err)
+		return &retryableCallbackError{err: fmt.Errorf("slave cannot send callback request: %w", resp.Err)}
+	}
+
+	if resp.Response.StatusCode >= 500 {
+		return &retryableCallbackError{err: fmt.Errorf("master responded with status code %d", resp.Response.StatusCode)}
 	}
 
 	// 解析回调服务端响应
@@ -449,3 +534,34 @@ func RemoteCallback(url string, body serializer.UploadCallback) error {
 
 	return nil
 }
+
+// saveUndeliveredCallback 将未送达的回调请求追加记录到 CallbackFailedLog，供管理员重放，
+// 未设定记录文件或写入失败时仅记录日志
+func saveUndeliveredCallback(url string, callbackBody []byte, cause error) {
+	util.Log().Error("Callback to %q is not delivered, body: %s, error: %s", url, callbackBody, cause)
+	if conf.SlaveConfig.CallbackFailedLog == "" {
+		return
+	}
+
+	record, _ := json.Marshal(undeliveredCallback{
+		Time:  time.Now(),
+		URL:   url,
+		Body:  callbackBody,
+		Error: cause.Error(),
+	})
+
+	callbackLogLock.Lock()
+	defer callbackLogLock.Unlock()
+
+	logPath := util.RelativePath(conf.SlaveConfig.CallbackFailedLog)
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		util.Log().Warning("Failed to open undelivered callback log %q: %s", logPath, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(record, '\n')); err != nil {
+		util.Log().Warning("Failed to write undelivered callback log %q: %s", logPath, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
 	"github.com/cloudreve/Cloudreve/v3/pkg/mocks/requestmock"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
@@ -13,6 +14,7 @@ import (
 	testMock "github.com/stretchr/testify/mock"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -448,6 +450,14 @@ func TestSlaveCaller_DeleteTempFile(t *testing.T) {
 
 func TestRemoteCallback(t *testing.T) {
 	asserts := assert.New(t)
+	conf.SlaveConfig.CallbackMaxAttempts = 3
+	conf.SlaveConfig.CallbackRetryDelay = 0
+	conf.SlaveConfig.CallbackFailedLog = filepath.Join(t.TempDir(), "callback_failed.log")
+	defer func() {
+		conf.SlaveConfig.CallbackMaxAttempts = 5
+		conf.SlaveConfig.CallbackRetryDelay = 1
+		conf.SlaveConfig.CallbackFailedLog = "callback_failed.log"
+	}()
 
 	// 回调成功
 	{
@@ -550,10 +560,109 @@ func TestRemoteCallback(t *testing.T) {
 			testMock.Anything,
 		).Return(&request.Response{
 			Err: errors.New("error"),
-		})
+		}).Times(3)
+		request.GeneralClient = clientMock
+		resp := RemoteCallback("http://test/test/url", serializer.UploadCallback{})
+		asserts.True(IsCallbackUndelivered(resp))
+		asserts.Equal(serializer.CodeCallbackError, resp.(serializer.AppError).Code)
+		clientMock.AssertExpectations(t)
+
+		// 记录未送达的回调
+		content, err := ioutil.ReadFile(conf.SlaveConfig.CallbackFailedLog)
+		asserts.NoError(err)
+		var record undeliveredCallback
+		asserts.NoError(json.Unmarshal(content, &record))
+		asserts.Equal("http://test/test/url", record.URL)
+		asserts.JSONEq(`{"data":{"pic_info":""}}`, string(record.Body))
+		asserts.Contains(record.Error, "error")
+	}
+
+	// 主机返回 5xx 时重试
+	{
+		clientMock := requestmock.RequestMock{}
+		mockResp, _ := json.Marshal(serializer.Response{Code: 0})
+		clientMock.On(
+			"Request",
+			"POST",
+			"http://test/test/url",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Response: &http.Response{
+				StatusCode: 502,
+				Body:       ioutil.NopCloser(strings.NewReader("Bad Gateway")),
+			},
+		}).Once()
+		clientMock.On(
+			"Request",
+			"POST",
+			"http://test/test/url",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(bytes.NewReader(mockResp)),
+			},
+		}).Once()
+		request.GeneralClient = clientMock
+		resp := RemoteCallback("http://test/test/url", serializer.UploadCallback{})
+		asserts.NoError(resp)
+		clientMock.AssertExpectations(t)
+	}
+
+	// 4xx 不重试
+	{
+		clientMock := requestmock.RequestMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"http://test/test/url",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Response: &http.Response{
+				StatusCode: 403,
+				Body:       ioutil.NopCloser(strings.NewReader("Forbidden")),
+			},
+		}).Once()
 		request.GeneralClient = clientMock
 		resp := RemoteCallback("http://test/test/url", serializer.UploadCallback{})
 		asserts.Error(resp)
+		asserts.False(IsCallbackUndelivered(resp))
+		clientMock.AssertExpectations(t)
+	}
+
+	// 下次重试将超出重试总时长，不再等待
+	{
+		conf.SlaveConfig.CallbackRetryDelay = 60
+		conf.SlaveConfig.CallbackRetryWindow = 30
+		defer func() { conf.SlaveConfig.CallbackRetryDelay = 0 }()
+		clientMock := requestmock.RequestMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"http://test/test/url",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: errors.New("error"),
+		}).Once()
+		request.GeneralClient = clientMock
+		resp := RemoteCallback("http://test/test/url", serializer.UploadCallback{})
+		asserts.True(IsCallbackUndelivered(resp))
 		clientMock.AssertExpectations(t)
 	}
 }
+
+func TestCallbackTimeout(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 不限制总时长
+	asserts.Equal(20*time.Second, callbackTimeout(time.Time{}))
+
+	// 不超过剩余时长
+	asserts.InDelta(float64(10*time.Second), float64(callbackTimeout(time.Now().Add(10*time.Second))), float64(time.Second))
+	asserts.Equal(20*time.Second, callbackTimeout(time.Now().Add(time.Minute)))
+	asserts.Equal(time.Second, callbackTimeout(time.Now()))
+}
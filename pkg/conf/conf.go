@@ -21,12 +21,15 @@ type database struct {
 
 // system 系统通用配置
 type system struct {
-	Mode          string `validate:"eq=master|eq=slave"`
-	Listen        string `validate:"required"`
-	Debug         bool
-	SessionSecret string
-	HashIDSalt    string
-	GracePeriod   int `validate:"gte=0"`
+	Mode                 string `validate:"eq=master|eq=slave"`
+	Listen               string `validate:"required"`
+	Debug                bool
+	SessionSecret        string
+	HashIDSalt           string
+	GracePeriod          int `validate:"gte=0"`
+	MaxConcurrentUploads int `validate:"gte=0"` // 全站同时处理的上传请求数上限，0 表示不限制
+	UploadQueueSize      int `validate:"gte=0"` // 达到上限后允许排队等待的上传请求数
+	UploadQueueTimeout   int `validate:"gte=0"` // 上传请求排队等待的最长时间，单位为秒
 }
 
 type ssl struct {
@@ -42,9 +45,14 @@ type unix struct {
 
 // slave 作为slave存储端配置
 type slave struct {
-	Secret          string `validate:"omitempty,gte=64"`
-	CallbackTimeout int    `validate:"omitempty,gte=1"`
-	SignatureTTL    int    `validate:"omitempty,gte=1"`
+	Secret              string `validate:"omitempty,gte=64"`
+	CallbackTimeout     int    `validate:"omitempty,gte=1"`
+	CallbackMaxAttempts int    `validate:"omitempty,gte=1"` // 回调请求的最大尝试次数，主机无法访问或返回 5xx 时重试
+	CallbackRetryDelay  int    `validate:"omitempty,gte=0"` // 回调首次重试前等待的秒数，之后每次翻倍
+	CallbackRetryWindow int    `validate:"omitempty,gte=0"` // 回调连同重试的总时长上限，单位为秒，0 表示不限制
+	CallbackFailedLog   string // 重试用尽仍未送达的回调请求的记录文件，供管理员重放
+	SignatureTTL        int    `validate:"omitempty,gte=1"`
+	ClockSkew           int    `validate:"omitempty,gte=0"` // 校验签名有效期时容忍的时钟偏差，单位为秒
 }
 
 // redis 配置
@@ -18,9 +18,10 @@ var DatabaseConfig = &database{
 
 // SystemConfig 系统公用配置
 var SystemConfig = &system{
-	Debug:  false,
-	Mode:   "master",
-	Listen: ":5212",
+	Debug:              false,
+	Mode:               "master",
+	Listen:             ":5212",
+	UploadQueueTimeout: 30,
 }
 
 // CORSConfig 跨域配置
@@ -34,8 +35,13 @@ var CORSConfig = &cors{
 
 // SlaveConfig 从机配置
 var SlaveConfig = &slave{
-	CallbackTimeout: 20,
-	SignatureTTL:    60,
+	CallbackTimeout:     20,
+	CallbackMaxAttempts: 5,
+	CallbackRetryDelay:  1,
+	CallbackRetryWindow: 30,
+	CallbackFailedLog:   "callback_failed.log",
+	SignatureTTL:        60,
+	ClockSkew:           30,
 }
 
 var SSLConfig = &ssl{
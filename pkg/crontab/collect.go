@@ -8,6 +8,7 @@ import (
 	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/models/scripts"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
@@ -17,6 +18,9 @@ func garbageCollect() {
 	// 清理打包下载产生的临时文件
 	collectArchiveFile()
 
+	// 清理已过期上传会话遗留的追加缓冲文件
+	collectAppendBuffer()
+
 	// 清理过期的内置内存缓存
 	if store, ok := cache.Store.(*cache.MemoStore); ok {
 		collectCache(store)
@@ -51,6 +55,27 @@ func collectArchiveFile() {
 
 }
 
+func collectAppendBuffer() {
+	tempPath := util.RelativePath(model.GetSettingByName("temp_path"))
+	expires := model.GetIntSetting("upload_session_timeout", 86400)
+
+	root := filepath.Join(tempPath, "append")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() &&
+			time.Now().Sub(info.ModTime()).Seconds() > float64(expires) {
+			util.Log().Debug("Delete expired append buffer %q.", path)
+			if err := os.Remove(path); err != nil {
+				util.Log().Debug("Failed to delete append buffer %q: %s", path, err)
+			}
+		}
+		return nil
+	})
+
+	if err != nil && !os.IsNotExist(err) {
+		util.Log().Debug("Crontab job cannot list append buffer folder: %s", err)
+	}
+}
+
 func collectCache(store *cache.MemoStore) {
 	util.Log().Debug("Cleanup memory cache.")
 	store.GarbageCollect()
@@ -97,3 +122,84 @@ func uploadSessionCollect() {
 
 	util.Log().Info("Crontab job \"cron_recycle_upload_session\" complete.")
 }
+
+func thumbCacheEvict() {
+	res, err := filesystem.EvictThumbnails()
+	if err != nil {
+		util.Log().Warning("Failed to evict thumb cache: %s", err)
+	}
+
+	if res.Evicted > 0 {
+		util.Log().Info("Evicted %d thumbs, %d bytes freed.", res.Evicted, res.Freed)
+	}
+
+	util.Log().Info("Crontab job \"cron_thumb_cache_evict\" complete.")
+}
+
+func thumbRemoteRetry() {
+	fs, err := filesystem.NewAnonymousFileSystem()
+	if err != nil {
+		util.Log().Warning("Failed to initialize filesystem: %s", err)
+		return
+	}
+	defer fs.Recycle()
+
+	res, err := fs.RetryRemoteThumbnails(context.Background())
+	if err != nil {
+		util.Log().Warning("Failed to retry remote thumbs: %s", err)
+	}
+
+	if res.Succeeded+res.Failed > 0 {
+		util.Log().Info("Retried remote thumbs: %d succeeded, %d failed, %d skipped.", res.Succeeded, res.Failed, res.Skipped)
+	}
+
+	util.Log().Info("Crontab job \"cron_thumb_remote_retry\" complete.")
+}
+
+// storageCalibrate 按文件记录校准所有用户的已用容量，修正累计的偏差
+func storageCalibrate() {
+	scripts.UserStorageCalibration(0).Run(context.Background())
+	util.Log().Info("Crontab job \"cron_storage_calibrate\" complete.")
+}
+
+// lifecycleApply 按生命周期规则转换存储类型或删除到期的文件
+func lifecycleApply() {
+	res, err := filesystem.ApplyLifecycle(context.Background(), model.GetIntSetting("lifecycle_batch_size", 1000))
+	if err != nil {
+		util.Log().Warning("Failed to apply lifecycle rules: %s", err)
+	}
+
+	if res.Transitioned+res.Expired+res.Failed > 0 {
+		util.Log().Info("Applied lifecycle rules: %d transitioned, %d expired, %d failed.", res.Transitioned, res.Expired, res.Failed)
+	}
+
+	util.Log().Info("Crontab job \"cron_lifecycle\" complete.")
+}
+
+// hookRetry 重试失败的上传后处理
+func hookRetry() {
+	res, err := filesystem.RetryFailedHooks(context.Background())
+	if err != nil {
+		util.Log().Warning("Failed to retry post-upload hooks: %s", err)
+	}
+
+	if res.Succeeded+res.Failed+res.Dropped > 0 {
+		util.Log().Info("Retried post-upload hooks: %d succeeded, %d failed, %d dropped.", res.Succeeded, res.Failed, res.Dropped)
+	}
+
+	util.Log().Info("Crontab job \"cron_hook_retry\" complete.")
+}
+
+// trashPurge 永久删除回收站中已过期的文件
+func trashPurge() {
+	res, err := filesystem.PurgeExpiredTrash(context.Background(), model.GetIntSetting("trash_purge_batch_size", 1000))
+	if err != nil {
+		util.Log().Warning("Failed to purge expired trash: %s", err)
+	}
+
+	if res.Purged+res.Failed > 0 {
+		util.Log().Info("Purged expired trash: %d purged, %d failed.", res.Purged, res.Failed)
+	}
+
+	util.Log().Info("Crontab job \"cron_trash_purge\" complete.")
+}
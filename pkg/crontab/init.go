@@ -24,6 +24,12 @@ func Init() {
 	options := model.GetSettingByNames(
 		"cron_garbage_collect",
 		"cron_recycle_upload_session",
+		"cron_thumb_cache_evict",
+		"cron_thumb_remote_retry",
+		"cron_storage_calibrate",
+		"cron_lifecycle",
+		"cron_hook_retry",
+		"cron_trash_purge",
 	)
 	Cron := cron.New()
 	for k, v := range options {
@@ -33,6 +39,18 @@ func Init() {
 			handler = garbageCollect
 		case "cron_recycle_upload_session":
 			handler = uploadSessionCollect
+		case "cron_thumb_cache_evict":
+			handler = thumbCacheEvict
+		case "cron_thumb_remote_retry":
+			handler = thumbRemoteRetry
+		case "cron_storage_calibrate":
+			handler = storageCalibrate
+		case "cron_lifecycle":
+			handler = lifecycleApply
+		case "cron_hook_retry":
+			handler = hookRetry
+		case "cron_trash_purge":
+			handler = trashPurge
 		default:
 			util.Log().Warning("Unknown crontab job type %q, skipping...", k)
 			continue
@@ -0,0 +1,60 @@
+package docpreview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Available 返回 soffice 可执行文件是否存在
+func Available(soffice string) bool {
+	_, err := exec.LookPath(soffice)
+	return err == nil
+}
+
+// ToPDF 使用 LibreOffice 无界面模式将 input 转换为 PDF，保存至 outDir，返回生成的文件路径。
+// 每次转换使用 outDir 下独立的用户配置目录，使多个 soffice 进程可以同时运行
+func ToPDF(ctx context.Context, soffice, input, outDir string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, soffice,
+		"-env:UserInstallation="+fileURL(filepath.Join(outDir, "profile")),
+		"--headless",
+		"--norestore",
+		"--nolockcheck",
+		"--convert-to", "pdf",
+		"--outdir", outDir,
+		input,
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("soffice failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// soffice 转换失败时也可能正常退出，以输出文件是否存在为准
+	output := filepath.Join(outDir, strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))+".pdf")
+	if _, err := os.Stat(output); err != nil {
+		return "", fmt.Errorf("soffice produced no output: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
+
+// fileURL 返回本机路径对应的 file:// URL
+func fileURL(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+
+	abs = filepath.ToSlash(abs)
+	if !strings.HasPrefix(abs, "/") {
+		abs = "/" + abs
+	}
+
+	return (&url.URL{Scheme: "file", Path: abs}).String()
+}
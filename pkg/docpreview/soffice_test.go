@@ -0,0 +1,77 @@
+package docpreview
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSoffice 写入模拟 soffice 的脚本，返回其路径
+func fakeSoffice(t *testing.T, script string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script is not supported")
+	}
+
+	path := filepath.Join(t.TempDir(), "soffice")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAvailable(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.False(Available("/nonexistent/soffice"))
+	asserts.True(Available(fakeSoffice(t, "exit 0\n")))
+}
+
+func TestToPDF(t *testing.T) {
+	asserts := assert.New(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.docx")
+	asserts.NoError(os.WriteFile(input, []byte("document"), 0644))
+
+	// 成功
+	{
+		soffice := fakeSoffice(t, `for last; do :; done
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--outdir" ]; then out="$2"; fi
+  shift
+done
+cp "$last" "$out/input.pdf"
+`)
+		output, err := ToPDF(context.Background(), soffice, input, dir)
+		asserts.NoError(err)
+		asserts.Equal(filepath.Join(dir, "input.pdf"), output)
+		content, err := os.ReadFile(output)
+		asserts.NoError(err)
+		asserts.Equal("document", string(content))
+		asserts.NoError(os.Remove(output))
+	}
+
+	// 执行失败
+	{
+		soffice := fakeSoffice(t, "echo broken >&2\nexit 1\n")
+		_, err := ToPDF(context.Background(), soffice, input, dir)
+		asserts.Error(err)
+		asserts.True(strings.Contains(err.Error(), "broken"))
+	}
+
+	// 正常退出但未生成文件
+	{
+		soffice := fakeSoffice(t, "exit 0\n")
+		_, err := ToPDF(context.Background(), soffice, input, dir)
+		asserts.Error(err)
+	}
+}
+
+func TestFileURL(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(strings.HasPrefix(fileURL("profile"), "file:///"))
+	asserts.Equal("file:///tmp/a%20b", fileURL("/tmp/a b"))
+}
@@ -34,3 +34,48 @@ func NewResetEmail(userName, resetURL string) (string, string) {
 	return fmt.Sprintf("【%s】密码重置", options["siteName"]),
 		util.Replace(replace, options["mail_reset_pwd_template"])
 }
+
+// NewBrokenSourceEmail 新建文件存储端对象丢失的通知邮件
+func NewBrokenSourceEmail(fileName string) (string, string) {
+	siteName := model.GetSettingByName("siteName")
+	return fmt.Sprintf("【%s】文件数据已丢失", siteName),
+		fmt.Sprintf("文件 %s 在存储端的数据已丢失，无法下载，请重新上传或删除此文件。", fileName)
+}
+
+// NewQuotaWarningEmail 新建已用容量超过警告阈值的通知邮件
+func NewQuotaWarningEmail(percent int) (string, string) {
+	siteName := model.GetSettingByName("siteName")
+	return fmt.Sprintf("【%s】存储空间即将用尽", siteName),
+		fmt.Sprintf("您已使用了 %d%% 的存储空间，空间用尽后将无法上传文件，请及时清理或扩容。", percent)
+}
+
+// NewSensitiveDataEmail 新建文件含有敏感数据的管理员通知邮件
+func NewSensitiveDataEmail(userName, fileName, matches string) (string, string) {
+	siteName := model.GetSettingByName("siteName")
+	return fmt.Sprintf("【%s】文件含有敏感数据", siteName),
+		fmt.Sprintf("用户 %s 上传的文件 %s 命中了敏感数据规则：%s。请前往管理面板检查。", userName, fileName, matches)
+}
+
+// NewQuarantineEmail 新建文件被隔离的管理员通知邮件
+func NewQuarantineEmail(userName, fileName, reason string) (string, string) {
+	siteName := model.GetSettingByName("siteName")
+	return fmt.Sprintf("【%s】文件已被隔离", siteName),
+		fmt.Sprintf("用户 %s 的文件 %s 未通过校验，已被隔离：%s。请前往管理面板检查。", userName, fileName, reason)
+}
+
+// NewApprovalPendingEmail 新建文件等待审核的管理员通知邮件
+func NewApprovalPendingEmail(userName, fileName string) (string, string) {
+	siteName := model.GetSettingByName("siteName")
+	return fmt.Sprintf("【%s】文件等待审核", siteName),
+		fmt.Sprintf("用户 %s 上传的文件 %s 需要审核后才能分享。请前往管理面板处理。", userName, fileName)
+}
+
+// NewUploadRejectedEmail 新建文件未通过审核的通知邮件，reason 为空时不附带原因
+func NewUploadRejectedEmail(fileName, reason string) (string, string) {
+	siteName := model.GetSettingByName("siteName")
+	body := fmt.Sprintf("您上传的文件 %s 未通过审核，已被删除。", fileName)
+	if reason != "" {
+		body += fmt.Sprintf("原因：%s", reason)
+	}
+	return fmt.Sprintf("【%s】文件未通过审核", siteName), body
+}
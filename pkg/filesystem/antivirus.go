@@ -0,0 +1,67 @@
+package filesystem
+
+import (
+	"context"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/antivirus"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cluster"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// scanObject 使用 clamd 扫描存储中的文件，发现病毒时返回病毒名称。
+// 从机没有数据库，设置项仅能通过配置文件覆盖，因此均带有默认值
+func (fs *FileSystem) scanObject(ctx context.Context, source string) (string, error) {
+	timeout := time.Duration(model.GetIntSetting("antivirus_timeout", 300)) * time.Second
+	scanCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	content, err := fs.Handler.Get(scanCtx, source)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	address := model.GetSettingByNameWithDefault("antivirus_clamd_address", "tcp://127.0.0.1:3310")
+	return antivirus.Scan(scanCtx, address, content)
+}
+
+// HookSlaveScanBeforeCallback Slave模式下，在发送上传回调前扫描文件。
+// 扫描通过后才继续执行回调；发现病毒时删除文件，并以带有病毒信息的回调通知主机丢弃占位文件
+func HookSlaveScanBeforeCallback(session *serializer.UploadSession) Hook {
+	return func(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+		if !session.Policy.OptionsSerialized.ScanBeforeCallback {
+			return nil
+		}
+
+		fileInfo := fileHeader.Info()
+		threat, err := fs.scanObject(ctx, fileInfo.SavePath)
+		if err != nil {
+			return ErrVirusScanFailed.WithError(err)
+		}
+
+		if threat == "" {
+			return nil
+		}
+
+		util.Log().Warning("Threat %q detected in uploaded file %q, file deleted.", threat, fileInfo.SavePath)
+		if _, err := fs.Handler.Delete(context.Background(), []string{fileInfo.SavePath}); err != nil {
+			util.Log().Warning("Failed to delete infected file %q: %s", fileInfo.SavePath, err)
+		}
+
+		if session.Callback != "" {
+			callbackBody := serializer.UploadCallback{
+				Infected: true,
+				Threat:   threat,
+			}
+			if err := cluster.RemoteCallback(session.Callback, callbackBody); err != nil {
+				util.Log().Warning("Failed to report infected file %q to master: %s", fileInfo.SavePath, err)
+			}
+		}
+
+		return ErrFileInfected.WithData(map[string]string{"threat": threat})
+	}
+}
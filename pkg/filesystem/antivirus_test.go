@@ -0,0 +1,79 @@
+package filesystem
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookSlaveScanBeforeCallback(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}, Handler: local.Driver{}}
+	session := &serializer.UploadSession{}
+	file := &fsctx.FileStream{SavePath: "tests/scan_before_callback.txt"}
+	asserts.NoError(os.MkdirAll(util.RelativePath("tests"), 0744))
+	asserts.NoError(os.WriteFile(util.RelativePath(file.SavePath), []byte("content"), 0644))
+	defer os.Remove(util.RelativePath(file.SavePath))
+
+	// 未开启
+	{
+		asserts.NoError(HookSlaveScanBeforeCallback(session)(context.Background(), fs, file))
+	}
+
+	session.Policy.OptionsSerialized.ScanBeforeCallback = true
+
+	// 无法连接 clamd
+	{
+		cache.Set("setting_antivirus_clamd_address", "unix:/not/exist/clamd.ctl", 0)
+		err := HookSlaveScanBeforeCallback(session)(context.Background(), fs, file)
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeVirusScanFailed, err.(serializer.AppError).Code)
+		asserts.FileExists(util.RelativePath(file.SavePath))
+	}
+
+	// 发现病毒，删除文件
+	{
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		asserts.NoError(err)
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			r.ReadString(0)
+			// 忽略内容，读到结束块后回复
+			buf := make([]byte, 1)
+			zeros := 0
+			for zeros < 4 {
+				if _, err := r.Read(buf); err != nil {
+					return
+				}
+				if buf[0] == 0 {
+					zeros++
+				} else {
+					zeros = 0
+				}
+			}
+			conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+		}()
+
+		cache.Set("setting_antivirus_clamd_address", listener.Addr().String(), 0)
+		err = HookSlaveScanBeforeCallback(session)(context.Background(), fs, file)
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeFileInfected, err.(serializer.AppError).Code)
+		asserts.NoFileExists(util.RelativePath(file.SavePath))
+	}
+}
@@ -0,0 +1,178 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// appendBufferDir 返回不支持原生追加的存储端在分片上传时，于本机缓冲已上传分片的目录
+func appendBufferDir() string {
+	return filepath.Join(util.RelativePath(model.GetSettingByName("temp_path")), "append")
+}
+
+// appendBufferPath 返回 savePath 对应的追加缓冲文件路径
+func appendBufferPath(savePath string) string {
+	return filepath.Join(appendBufferDir(), fmt.Sprintf("%x", sha1.Sum([]byte(savePath))))
+}
+
+// putChunk 写入追加上传的分片。按上传会话的暂存设定直接追加至对象、存为暂存对象，
+// 或写入本机的追加缓冲文件，后两者由 HookCommitAppendBuffer 在最后一个分片上传后合并写入存储端
+func (fs *FileSystem) putChunk(ctx context.Context, file *fsctx.FileStream) error {
+	defer file.Close()
+	staging := stagingFromContext(ctx)
+	if fs.isNativeAppend(staging) {
+		return fs.Handler.(driver.Appender).Append(ctx, file.SavePath, int64(file.AppendStart), file)
+	}
+
+	handler, err := fs.stagingHandler(staging)
+	if err != nil {
+		return err
+	}
+	if handler != nil {
+		return fs.putStagedChunk(ctx, handler, staging, file)
+	}
+
+	bufferPath := appendBufferPath(file.SavePath)
+	if err := os.MkdirAll(filepath.Dir(bufferPath), 0744); err != nil {
+		return ErrIO.WithError(err)
+	}
+
+	buffer, err := os.OpenFile(bufferPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return ErrIO.WithError(err)
+	}
+	defer buffer.Close()
+
+	stat, err := buffer.Stat()
+	if err != nil {
+		return ErrIO.WithError(err)
+	}
+
+	offset := int64(file.AppendStart)
+	if stat.Size() < offset {
+		return errors.New("size of unfinished uploaded chunks is not as expected")
+	}
+
+	// 重传分片时丢弃此前写入的部分
+	if err := buffer.Truncate(offset); err != nil {
+		return ErrIO.WithError(err)
+	}
+
+	if _, err := buffer.Seek(offset, io.SeekStart); err != nil {
+		return ErrIO.WithError(err)
+	}
+
+	_, err = io.Copy(buffer, file)
+	return err
+}
+
+// truncateAppendBuffer 将追加缓冲文件截断至 size，用于回滚上传失败的分片
+func truncateAppendBuffer(savePath string, size uint64) error {
+	err := os.Truncate(appendBufferPath(savePath), int64(size))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// removeAppendBuffer 删除 savePath 对应的追加缓冲文件
+func removeAppendBuffer(savePath string) error {
+	err := os.Remove(appendBufferPath(savePath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// HookCommitAppendBuffer 最后一个分片上传后，将暂存的完整内容写入存储端，分片直接追加至对象时无需处理。
+// 写入成功后删除暂存数据，失败时保留，客户端可重传最后一个分片。存储端确认了内容的校验值时，
+// 存储端的内容与暂存数据一致，改由暂存数据计算 MD5 供 HookVerifyChecksum 使用，无需回读存储端
+func HookCommitAppendBuffer(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	staging := stagingFromContext(ctx)
+	if fs.isNativeAppend(staging) {
+		return nil
+	}
+
+	handler, err := fs.stagingHandler(staging)
+	if err != nil {
+		return err
+	}
+	if handler != nil {
+		return fs.commitStagedChunks(ctx, handler, staging, fileHeader)
+	}
+
+	fileInfo := fileHeader.Info()
+	bufferPath := appendBufferPath(fileInfo.SavePath)
+	buffer, err := os.Open(bufferPath)
+	if err != nil {
+		return ErrIO.WithError(err)
+	}
+
+	stat, err := buffer.Stat()
+	if err != nil {
+		buffer.Close()
+		return ErrIO.WithError(err)
+	}
+
+	committed := &fsctx.FileStream{
+		File:         buffer,
+		Seeker:       buffer,
+		Size:         uint64(stat.Size()),
+		MIMEType:     fileInfo.MIMEType,
+		Name:         fileInfo.FileName,
+		VirtualPath:  fileInfo.VirtualPath,
+		SavePath:     fileInfo.SavePath,
+		Mode:         fsctx.Overwrite,
+		LastModified: fileInfo.LastModified,
+		StorageClass: fileInfo.StorageClass,
+		Tags:         fileInfo.Tags,
+	}
+	err = fs.putObject(ctx, committed)
+	buffer.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := recordShards(fileHeader, committed.Shards); err != nil {
+		return err
+	}
+
+	if checksum, ok := committed.Metadata[driver.ServerChecksumMetadataKey]; ok {
+		if err := recordServerChecksum(fileHeader, bufferPath, checksum); err != nil {
+			util.Log().Warning("Failed to record server-side checksum of %q: %s", fileInfo.SavePath, err)
+		}
+	}
+
+	if err := os.Remove(bufferPath); err != nil {
+		util.Log().Warning("Failed to delete append buffer %q: %s", bufferPath, err)
+	}
+
+	return nil
+}
+
+// recordServerChecksum 将存储端确认的 SHA-256 保存至文件元数据，并记录缓冲文件的 MD5
+func recordServerChecksum(fileHeader fsctx.FileHeader, bufferPath, checksum string) error {
+	digest, err := generateFileMD5(context.Background(), bufferPath)
+	if err != nil {
+		return err
+	}
+
+	fileHeader.SetMetadata(committedMD5MetadataKey, digest)
+	if fileModel, ok := fileHeader.Info().Model.(*model.File); ok {
+		return updateMetadataValue(fileModel, driver.ServerChecksumMetadataKey, checksum)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func appendChunk(content string, start uint64) *fsctx.FileStream {
+	return &fsctx.FileStream{
+		File:        ioutil.NopCloser(strings.NewReader(content)),
+		Size:        uint64(len(content)),
+		SavePath:    "TestAppend.txt",
+		Mode:        fsctx.Append | fsctx.Overwrite,
+		AppendStart: start,
+	}
+}
+
+func TestFileSystem_PutChunk(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_temp_path", "tests/temp", 0)
+	bufferPath := appendBufferPath("TestAppend.txt")
+	defer os.Remove(bufferPath)
+	defer os.Remove(util.RelativePath("TestAppend.txt"))
+
+	// 存储端不支持追加，写入本机缓冲
+	{
+		fs := &FileSystem{User: &model.User{}, Handler: new(FileHeaderMock)}
+		asserts.NoError(fs.putChunk(context.Background(), appendChunk("123", 0)))
+		asserts.NoError(fs.putChunk(context.Background(), appendChunk("456", 3)))
+
+		// 重传分片
+		asserts.NoError(fs.putChunk(context.Background(), appendChunk("789", 3)))
+		content, err := ioutil.ReadFile(bufferPath)
+		asserts.NoError(err)
+		asserts.Equal("123789", string(content))
+
+		// 跳过分片
+		asserts.Error(fs.putChunk(context.Background(), appendChunk("0", 10)))
+
+		// 回滚失败的分片
+		asserts.NoError(truncateAppendBuffer("TestAppend.txt", 3))
+		content, err = ioutil.ReadFile(bufferPath)
+		asserts.NoError(err)
+		asserts.Equal("123", string(content))
+	}
+
+	// 存储端原生追加
+	{
+		fs := &FileSystem{User: &model.User{}, Handler: local.Driver{}}
+		asserts.NoError(fs.putChunk(context.Background(), appendChunk("123", 0)))
+		asserts.NoError(fs.putChunk(context.Background(), appendChunk("456", 3)))
+		content, err := ioutil.ReadFile(util.RelativePath("TestAppend.txt"))
+		asserts.NoError(err)
+		asserts.Equal("123456", string(content))
+	}
+}
+
+func TestHookCommitAppendBuffer(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_temp_path", "tests/temp", 0)
+	bufferPath := appendBufferPath("TestAppend.txt")
+	defer os.Remove(bufferPath)
+
+	// 存储端原生追加，无需提交
+	{
+		fs := &FileSystem{User: &model.User{}, Handler: local.Driver{}}
+		asserts.NoError(HookCommitAppendBuffer(context.Background(), fs, appendChunk("", 0)))
+	}
+
+	// 缓冲文件不存在
+	{
+		fs := &FileSystem{User: &model.User{}, Handler: new(FileHeaderMock)}
+		asserts.Error(HookCommitAppendBuffer(context.Background(), fs, appendChunk("", 0)))
+	}
+
+	// 写入存储端失败，保留缓冲文件
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything).Return(errors.New("error"))
+		fs := &FileSystem{User: &model.User{}, Handler: testHandler}
+		asserts.NoError(fs.putChunk(context.Background(), appendChunk("123", 0)))
+		asserts.Error(HookCommitAppendBuffer(context.Background(), fs, appendChunk("", 0)))
+		asserts.True(util.Exists(bufferPath))
+	}
+
+	// 成功
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Put", testMock.Anything, testMock.MatchedBy(func(file fsctx.FileHeader) bool {
+			info := file.Info()
+			return info.Size == 3 && info.SavePath == "TestAppend.txt" && info.Mode == fsctx.Overwrite
+		})).Return(nil)
+		fs := &FileSystem{User: &model.User{}, Handler: testHandler}
+		asserts.NoError(HookCommitAppendBuffer(context.Background(), fs, appendChunk("", 0)))
+		testHandler.AssertExpectations(t)
+		asserts.False(util.Exists(bufferPath))
+	}
+
+	// 存储端确认校验值，记录缓冲文件的 MD5
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything).Run(func(args testMock.Arguments) {
+			args.Get(1).(fsctx.FileHeader).SetMetadata(driver.ServerChecksumMetadataKey, "sha256")
+		}).Return(nil)
+		fs := &FileSystem{User: &model.User{}, Handler: testHandler}
+		asserts.NoError(fs.putChunk(context.Background(), appendChunk("123", 0)))
+		chunk := appendChunk("", 0)
+		asserts.NoError(HookCommitAppendBuffer(context.Background(), fs, chunk))
+		asserts.Equal("202cb962ac59075b964b07152d234b70", chunk.Metadata[committedMD5MetadataKey])
+		asserts.False(util.Exists(bufferPath))
+	}
+}
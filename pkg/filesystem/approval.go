@@ -0,0 +1,102 @@
+package filesystem
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/email"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/notify"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// isApprovalRequired 返回 user 上传至 folderID 目录的文件是否需经管理员审核。
+// 用户组在 upload_approval_groups 中或目录设定了需要审核时，上传的文件需要审核
+func isApprovalRequired(user *model.User, folderID uint) bool {
+	groupID := strconv.FormatUint(uint64(user.GroupID), 10)
+	for _, id := range strings.Split(model.GetSettingByName("upload_approval_groups"), ",") {
+		if strings.TrimSpace(id) == groupID {
+			return true
+		}
+	}
+
+	folders, err := model.GetFoldersByIDs([]uint{folderID}, user.ID)
+	return err == nil && len(folders) > 0 && folders[0].RequireApproval
+}
+
+// HookRequireApproval 需要审核时将上传的文件标记为待审核，并通知审核人。
+// 需在文件记录创建之后执行，待审核的文件对所有者可见，但不可分享或获取外链
+func HookRequireApproval(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	file, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || file.ID == 0 || file.IsPendingApproval() || !isApprovalRequired(fs.User, file.FolderID) {
+		return nil
+	}
+
+	if err := file.MarkPendingApproval(); err != nil {
+		return ErrDBUpdateObjects.WithError(err)
+	}
+
+	title, body := email.NewApprovalPendingEmail(fs.User.Email, file.Name)
+	user := *fs.User
+	notify.Send(&notify.Notification{
+		Event: notify.EventApprovalPending,
+		User:  &user,
+		Title: title,
+		Body:  body,
+		Data: map[string]interface{}{
+			"file_id": file.ID,
+			"name":    file.Name,
+		},
+	})
+
+	return nil
+}
+
+// checkApproved 待审核的文件不可通过分享访问
+func checkApproved(ctx context.Context, file *model.File) error {
+	if !file.IsPendingApproval() {
+		return nil
+	}
+
+	if _, ok := ctx.Value(fsctx.ShareKeyCtx).(string); ok {
+		return ErrPendingApproval
+	}
+	if _, ok := ctx.Value(fsctx.ShareDownloadCtx).(*shareDownload); ok {
+		return ErrPendingApproval
+	}
+
+	return nil
+}
+
+// RejectPendingFiles 删除未通过审核的文件，并将原因通知文件所有者。ctx 中可指定有权忽略保留期的审核人
+func (fs *FileSystem) RejectPendingFiles(ctx context.Context, files []model.File, reason string) error {
+	ids := make([]uint, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, file.ID)
+	}
+
+	if err := fs.Delete(ctx, nil, ids, false); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		util.Log().Info("File %q (#%d) of user #%d is rejected: %s", file.Name, file.ID, file.UserID, reason)
+		title, body := email.NewUploadRejectedEmail(file.Name, reason)
+		user := *fs.User
+		notify.Send(&notify.Notification{
+			Event: notify.EventUploadRejected,
+			User:  &user,
+			Title: title,
+			Body:  body,
+			Data: map[string]interface{}{
+				"file_id": file.ID,
+				"name":    file.Name,
+				"reason":  reason,
+			},
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookRequireApproval(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{GroupID: 2}}
+	fs.User.ID = 1
+	cache.Set("setting_siteName", "Cloudreve", 0)
+	cache.Set("setting_notify_approval_pending_to", "", 0)
+
+	// 文件记录未创建
+	{
+		asserts.NoError(HookRequireApproval(context.Background(), fs, &fsctx.FileStream{}))
+	}
+
+	// 用户组需要审核
+	{
+		cache.Set("setting_upload_approval_groups", "3, 2", 0)
+		file := &model.File{Name: "1.txt", FolderID: 4}
+		file.ID = 5
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)pending_approval(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(HookRequireApproval(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.True(file.IsPendingApproval())
+	}
+
+	// 目录不需要审核
+	{
+		cache.Set("setting_upload_approval_groups", "3", 0)
+		file := &model.File{Name: "1.txt", FolderID: 4}
+		file.ID = 5
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "require_approval"}).AddRow(4, false))
+		asserts.NoError(HookRequireApproval(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.False(file.IsPendingApproval())
+	}
+
+	// 目录需要审核，标记失败
+	{
+		file := &model.File{Name: "1.txt", FolderID: 4}
+		file.ID = 5
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "require_approval"}).AddRow(4, true))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		asserts.Error(HookRequireApproval(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.False(file.IsPendingApproval())
+	}
+
+	cache.Deletes([]string{"upload_approval_groups", "notify_approval_pending_to"}, "setting_")
+}
+
+func TestCheckApproved(t *testing.T) {
+	asserts := assert.New(t)
+	now := time.Now()
+	pending := &model.File{PendingApproval: &now}
+	shareCtx := context.WithValue(context.Background(), fsctx.ShareKeyCtx, "key")
+
+	asserts.NoError(checkApproved(shareCtx, &model.File{}))
+	asserts.NoError(checkApproved(context.Background(), pending))
+	asserts.Equal(ErrPendingApproval, checkApproved(shareCtx, pending))
+	asserts.Equal(ErrPendingApproval, checkApproved(WithShareDownload(context.Background(), &model.Share{}, &model.User{}, nil), pending))
+}
+
+func TestFileSystem_ListPendingApproval(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	now := time.Now()
+	files := []model.File{{Name: "1.txt"}, {Name: "2.txt", PendingApproval: &now}}
+	files[0].ID, files[1].ID = 1, 2
+
+	// 所有者可见，标记为待审核
+	objects := fs.listObjects(context.Background(), "/", files, nil, nil)
+	asserts.Len(objects, 2)
+	asserts.False(objects[0].Pending)
+	asserts.True(objects[1].Pending)
+
+	// 分享中不可见
+	objects = fs.listObjects(context.WithValue(context.Background(), fsctx.ShareKeyCtx, "key"), "/", files, nil, nil)
+	asserts.Len(objects, 1)
+	asserts.Equal("1.txt", objects[0].Name)
+}
@@ -111,10 +111,10 @@ func (fs *FileSystem) doCompress(ctx context.Context, file *model.File, folder *
 			return
 		}
 
-		// 获取文件内容
-		fileToZip, err := fs.Handler.Get(
+		// 获取文件内容，设有下载密码的文件在此被拒绝，不会打包
+		fileToZip, err := fs.OpenObject(
 			context.WithValue(ctx, fsctx.FileModelCtx, *file),
-			file.SourceName,
+			file,
 		)
 		if err != nil {
 			util.Log().Debug("Failed to open %q: %s", file.Name, err)
@@ -182,7 +182,7 @@ func (fs *FileSystem) Decompress(ctx context.Context, src, dst, encoding string)
 	}()
 
 	// 下载压缩文件到临时目录
-	fileStream, err := fs.Handler.Get(ctx, fs.FileTarget[0].SourceName)
+	fileStream, err := fs.OpenObject(ctx, &fs.FileTarget[0])
 	if err != nil {
 		return err
 	}
@@ -225,12 +225,14 @@ func (fs *FileSystem) Decompress(ctx context.Context, src, dst, encoding string)
 
 	// 除了zip必须下载到本地，其余的可以边下载边解压
 	reader := readStream
+	compressedSize := fs.FileTarget[0].Size
 	if isZip {
-		_, err = io.Copy(zipFile, readStream)
+		written, err := io.Copy(zipFile, readStream)
 		if err != nil {
 			util.Log().Warning("Failed to write temp archive file %q: %s", tempZipFilePath, err)
 			return err
 		}
+		compressedSize = uint64(written)
 
 		fileStream.Close()
 
@@ -246,6 +248,27 @@ func (fs *FileSystem) Decompress(ctx context.Context, src, dst, encoding string)
 		return err
 	}
 
+	// 收集解压出的文件，完成后统一生成缩略图
+	var (
+		createdFiles   []*model.File
+		createdFolders []uint
+		createdLock    sync.Mutex
+	)
+	guard := newDecompressGuard(compressedSize)
+	fs.Lock.Lock()
+	if fs.Hooks == nil {
+		// 缩略图在解压完成后统一生成
+		fs.useStreamUploadHooks(false, func(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+			if file, ok := fileHeader.Info().Model.(*model.File); ok {
+				createdLock.Lock()
+				createdFiles = append(createdFiles, file)
+				createdLock.Unlock()
+			}
+			return nil
+		})
+	}
+	fs.Lock.Unlock()
+
 	var wg sync.WaitGroup
 	parallel := model.GetIntSetting("max_parallel_transfer", 4)
 	worker := make(chan int, parallel)
@@ -290,16 +313,27 @@ func (fs *FileSystem) Decompress(ctx context.Context, src, dst, encoding string)
 
 		// 如果是目录
 		if f.FileInfo.IsDir() {
-			fs.CreateDirectory(ctx, savePath)
+			if folder, err := fs.CreateDirectory(ctx, savePath); err == nil {
+				createdLock.Lock()
+				createdFolders = append(createdFolders, folder.ID)
+				createdLock.Unlock()
+			}
 			return nil
 		}
 
+		// 解压出的数据超出限制时中止
+		if err := guard.Check(f.FileInfo.Size()); err != nil {
+			util.Log().Warning("Stop decompressing %q at %q: %s", fs.FileTarget[0].Name, rawPath, err)
+			return err
+		}
+
 		// 上传文件
 		fileStream, err := f.Open()
 		if err != nil {
 			util.Log().Warning("Failed to open file %q in archive file: %s, skipping...", rawPath, err)
 			return nil
 		}
+		fileStream = guard.Wrap(fileStream, f.FileInfo.Size())
 
 		if !isZip {
 			uploadFunc(fileStream, f.FileInfo.Size(), savePath, rawPath)
@@ -311,6 +345,41 @@ func (fs *FileSystem) Decompress(ctx context.Context, src, dst, encoding string)
 		return nil
 	})
 	wg.Wait()
+
+	// 超出限制时删除已解压出的文件
+	if guardErr := guard.Err(); guardErr != nil {
+		fs.cleanupDecompressed(ctx, createdFolders, createdFiles)
+		return guardErr
+	}
+
+	if len(createdFiles) > 0 && fs.Policy.IsThumbGenerateNeeded() {
+		res := fs.GenerateThumbnails(ctx, createdFiles)
+		util.Log().Info("Generated thumbnails for extracted files: %d succeeded, %d failed, %d skipped.", res.Succeeded, res.Failed, res.Skipped)
+	}
+
 	return err
 
 }
+
+// cleanupDecompressed 删除中止解压前已创建的目录和文件
+func (fs *FileSystem) cleanupDecompressed(ctx context.Context, folders []uint, files []*model.File) {
+	fileIDs := make([]uint, len(files))
+	for i, file := range files {
+		fileIDs[i] = file.ID
+	}
+
+	// 先删除文件，避免目录中的文件被重复删除
+	if len(fileIDs) > 0 {
+		fs.CleanTargets()
+		if err := fs.Delete(ctx, nil, fileIDs, true); err != nil {
+			util.Log().Warning("Failed to clean up extracted files of aborted decompression: %s", err)
+		}
+	}
+
+	if len(folders) > 0 {
+		fs.CleanTargets()
+		if err := fs.Delete(ctx, folders, nil, true); err != nil {
+			util.Log().Warning("Failed to clean up extracted folders of aborted decompression: %s", err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package filesystem
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+)
+
+// decompressGuard 统计解压出的数据总量，超过限制时中止解压，防范解压炸弹
+type decompressGuard struct {
+	mu        sync.Mutex
+	limit     uint64 // 允许解压出的总字节数，0 为不限制
+	entryMax  uint64 // 单个条目允许解压出的字节数，0 为不限制
+	extracted uint64 // 已解压出的字节数
+	err       error
+}
+
+// newDecompressGuard 根据压缩文件大小及 decompress_max_ratio、decompress_max_size、
+// decompress_max_entry_size 设置创建限制
+func newDecompressGuard(compressedSize uint64) *decompressGuard {
+	g := &decompressGuard{
+		limit:    uint64(model.GetIntSetting("decompress_max_size", 0)),
+		entryMax: uint64(model.GetIntSetting("decompress_max_entry_size", 0)),
+	}
+
+	// 压缩文件大小未知时无法按比例限制
+	if ratio := model.GetIntSetting("decompress_max_ratio", 0); ratio > 0 && compressedSize > 0 {
+		byRatio := compressedSize * uint64(ratio)
+		if g.limit == 0 || byRatio < g.limit {
+			g.limit = byRatio
+		}
+	}
+
+	return g
+}
+
+// Err 返回触发限制时的错误，未触发时返回 nil
+func (g *decompressGuard) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// fail 记录首个触发限制的原因，调用方需持有锁
+func (g *decompressGuard) fail(reason string) error {
+	if g.err == nil {
+		g.err = ErrDecompressLimitExceeded.WithError(errors.New(reason))
+	}
+	return g.err
+}
+
+// Check 在解压条目前根据其声明的大小检查是否会超出限制
+func (g *decompressGuard) Check(declared int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return g.err
+	}
+
+	if declared < 0 {
+		declared = 0
+	}
+
+	if g.entryMax > 0 && uint64(declared) > g.entryMax {
+		return g.fail("entry size exceeds limit")
+	}
+
+	if g.limit > 0 && g.extracted+uint64(declared) > g.limit {
+		return g.fail("total decompressed size exceeds limit")
+	}
+
+	return nil
+}
+
+// consume 累计解压出的字节数
+func (g *decompressGuard) consume(n int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return g.err
+	}
+
+	g.extracted += uint64(n)
+	if g.limit > 0 && g.extracted > g.limit {
+		return g.fail("total decompressed size exceeds limit")
+	}
+
+	return nil
+}
+
+// Wrap 包装条目的读取流，读出的数据超过条目声明的大小或累计超过总限制时返回错误
+func (g *decompressGuard) Wrap(r io.ReadCloser, declared int64) io.ReadCloser {
+	if declared < 0 {
+		declared = 0
+	}
+
+	entryLimit := uint64(declared)
+	if g.entryMax > 0 && g.entryMax < entryLimit {
+		entryLimit = g.entryMax
+	}
+
+	return &guardedReader{ReadCloser: r, guard: g, limit: entryLimit}
+}
+
+// guardedReader 受 decompressGuard 限制的条目读取流
+type guardedReader struct {
+	io.ReadCloser
+	guard *decompressGuard
+	limit uint64
+	read  uint64
+}
+
+func (r *guardedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += uint64(n)
+	if r.read > r.limit {
+		r.guard.mu.Lock()
+		defer r.guard.mu.Unlock()
+		return n, r.guard.fail("entry is larger than its declared size")
+	}
+
+	if gErr := r.guard.consume(n); gErr != nil {
+		return n, gErr
+	}
+
+	return n, err
+}
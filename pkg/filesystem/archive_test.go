@@ -1,12 +1,14 @@
 package filesystem
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
 	"errors"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	testMock "github.com/stretchr/testify/mock"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -17,6 +19,7 @@ import (
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
 )
@@ -194,15 +197,19 @@ func TestFileSystem_Decompress(t *testing.T) {
 		asserts.EqualError(err, "error")
 	}
 
-	// 无法创建临时压缩文件
+	// 无法创建临时压缩文件，临时目录的上级为普通文件
 	{
-		cache.Set("setting_temp_path", "/tests:", 0)
+		blocker, err := util.CreatNestedFile(util.RelativePath("tests/decompress_blocker"))
+		asserts.NoError(err)
+		blocker.Close()
+		defer os.Remove(util.RelativePath("tests/decompress_blocker"))
+		cache.Set("setting_temp_path", "tests/decompress_blocker", 0)
 		fs.FileTarget = []model.File{{SourceName: "1.zip", Policy: model.Policy{Type: "mock"}}}
 		fs.FileTarget[0].Policy.ID = 1
 		testHandler := new(FileHeaderMock)
 		testHandler.On("Get", testMock.Anything, "1.zip").Return(MockRSC{}, nil)
 		fs.Handler = testHandler
-		err := fs.Decompress(ctx, "/1.zip", "/", "")
+		err = fs.Decompress(ctx, "/1.zip", "/", "")
 		asserts.NoError(mock.ExpectationsWereMet())
 		asserts.Error(err)
 	}
@@ -254,3 +261,94 @@ func TestFileSystem_Decompress(t *testing.T) {
 		testHandler.AssertExpectations(t)
 	}
 }
+
+func TestFileSystem_Decompress_Limit(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	cache.Set("setting_temp_path", "tests", 0)
+	cache.Set("setting_decompress_max_ratio", "10", 0)
+	cache.Set("setting_decompress_max_size", "0", 0)
+	cache.Set("setting_decompress_max_entry_size", "0", 0)
+	defer cache.Set("setting_decompress_max_ratio", "0", 0)
+
+	// 高压缩比的条目
+	buf := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buf)
+	entry, _ := zipWriter.Create("bomb.txt")
+	entry.Write(make([]byte, 1<<20))
+	zipWriter.Close()
+
+	fs := FileSystem{
+		User: &model.User{Model: gorm.Model{ID: 1}},
+	}
+	fs.User.Policy.Type = "mock"
+	cache.Set("policy_91", model.Policy{Type: "mock"}, -1)
+	fs.FileTarget = []model.File{{Name: "1.zip", SourceName: "1.zip", PolicyID: 91}}
+	testHandler := new(FileHeaderMock)
+	testHandler.On("Get", testMock.Anything, "1.zip").Return(MockRSC{rs: bytes.NewReader(buf.Bytes())}, nil)
+	fs.Handler = testHandler
+
+	err := fs.Decompress(ctx, "/1.zip", "/", "")
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Error(err)
+	appErr, ok := err.(serializer.AppError)
+	asserts.True(ok)
+	asserts.Equal(serializer.CodeDecompressLimitExceeded, appErr.Code)
+	testHandler.AssertNotCalled(t, "Put", testMock.Anything, testMock.Anything)
+}
+
+func TestNewDecompressGuard(t *testing.T) {
+	asserts := assert.New(t)
+	defer cache.Set("setting_decompress_max_ratio", "0", 0)
+	defer cache.Set("setting_decompress_max_size", "0", 0)
+
+	cache.Set("setting_decompress_max_ratio", "10", 0)
+	cache.Set("setting_decompress_max_size", "0", 0)
+	asserts.EqualValues(100, newDecompressGuard(10).limit)
+	asserts.EqualValues(0, newDecompressGuard(0).limit)
+
+	cache.Set("setting_decompress_max_size", "50", 0)
+	asserts.EqualValues(50, newDecompressGuard(10).limit)
+	asserts.EqualValues(50, newDecompressGuard(0).limit)
+
+	cache.Set("setting_decompress_max_ratio", "0", 0)
+	asserts.EqualValues(50, newDecompressGuard(10000).limit)
+}
+
+func TestDecompressGuard(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 条目声明的大小超出限制
+	{
+		g := &decompressGuard{entryMax: 10}
+		asserts.Error(g.Check(11))
+		asserts.Error(g.Err())
+	}
+
+	// 累计大小超出限制
+	{
+		g := &decompressGuard{limit: 10}
+		asserts.NoError(g.Check(6))
+		_, err := io.Copy(ioutil.Discard, g.Wrap(ioutil.NopCloser(strings.NewReader("123456")), 6))
+		asserts.NoError(err)
+		asserts.Error(g.Check(6))
+		asserts.Error(g.Check(4))
+	}
+
+	// 实际大小超出声明的大小
+	{
+		g := &decompressGuard{}
+		_, err := io.Copy(ioutil.Discard, g.Wrap(ioutil.NopCloser(strings.NewReader("123456")), 3))
+		asserts.Error(err)
+		asserts.Equal(err, g.Err())
+		asserts.Error(g.Check(0))
+	}
+
+	// 读取过程中累计超出限制
+	{
+		g := &decompressGuard{limit: 5}
+		_, err := io.Copy(ioutil.Discard, g.Wrap(ioutil.NopCloser(strings.NewReader("123456")), 6))
+		asserts.Error(err)
+		asserts.Error(g.Err())
+	}
+}
@@ -0,0 +1,104 @@
+package filesystem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+)
+
+/* ================
+	 批量上传相关
+   ================
+*/
+
+// capacityReservations 各用户批量上传中已预留、尚未计入已用容量的空间
+var capacityReservations = struct {
+	sync.Mutex
+	reserved map[uint]uint64
+}{reserved: make(map[uint]uint64)}
+
+// reserveCapacity 为用户预留 size 字节的容量，剩余容量扣除已有预留后不足时返回 false
+func (fs *FileSystem) reserveCapacity(size uint64) bool {
+	capacityReservations.Lock()
+	defer capacityReservations.Unlock()
+
+	reserved := capacityReservations.reserved[fs.User.ID]
+	remaining := fs.User.GetRemainingCapacity()
+	if remaining < reserved || remaining-reserved < size {
+		return false
+	}
+
+	capacityReservations.reserved[fs.User.ID] = reserved + size
+	return true
+}
+
+// releaseCapacity 释放已预留的容量
+func (fs *FileSystem) releaseCapacity(size uint64) {
+	capacityReservations.Lock()
+	defer capacityReservations.Unlock()
+
+	if capacityReservations.reserved[fs.User.ID] <= size {
+		delete(capacityReservations.reserved, fs.User.ID)
+		return
+	}
+	capacityReservations.reserved[fs.User.ID] -= size
+}
+
+// UploadBatch 依次上传多个文件，每个文件独立经过完整的上传钩子，单个文件失败不影响其余文件。
+// 返回与 files 一一对应的错误，成功时为 nil，文件记录可从 FileStream.Model 中获取
+func (fs *FileSystem) UploadBatch(ctx context.Context, files []*fsctx.FileStream) []error {
+	errs := make([]error, len(files))
+
+	// 重设存储策略
+	fs.Policy = &fs.User.Policy
+	if err := fs.DispatchHandler(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	fs.Use("BeforeUpload", HookValidateFile)
+	fs.Use("BeforeUpload", HookValidateUniqueName)
+	fs.Use("BeforeUpload", HookValidateEncryptedUpload)
+	fs.Use("BeforeUpload", HookValidateMIMEType)
+	if min := fs.MinFileSize(); min > 0 {
+		fs.Use("BeforeUpload", HookValidateMinFileSize(min))
+	}
+	if windows, loc := fs.UploadWindows(); len(windows) > 0 {
+		fs.Use("BeforeUpload", HookValidateUploadWindow(windows, loc))
+	}
+	if IsUploadRegionPolicyEnabled() {
+		fs.Use("BeforeUpload", HookValidateUploadRegion)
+	}
+	fs.Use("AfterUploadCanceled", HookDeleteTempFile)
+	fs.Use("AfterUpload", HookValidateUniqueContent)
+	fs.Use("BeforeAddFile", HookValidateFileCount)
+	fs.Use("AfterUpload", GenericAfterUpload)
+	fs.UseUploadProcessors(true)
+	fs.Use("AfterValidateFailed", HookDeleteTempFile)
+
+	for i, file := range files {
+		errs[i] = fs.uploadReserved(ctx, file)
+	}
+
+	return errs
+}
+
+// uploadReserved 预留容量后上传单个文件，上传结束后释放预留，
+// 上传成功时文件大小已计入用户已用容量
+func (fs *FileSystem) uploadReserved(ctx context.Context, file *fsctx.FileStream) error {
+	if !fs.reserveCapacity(file.Size) {
+		file.File.Close()
+		return ErrInsufficientCapacity
+	}
+	defer fs.releaseCapacity(file.Size)
+
+	// 每个文件使用独立的上下文，上传结束后结束对客户端取消的监测
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	defer file.File.Close()
+	return fs.Upload(ctx, file)
+}
@@ -0,0 +1,86 @@
+package filesystem
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem_ReserveCapacity(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{
+		Model:   gorm.Model{ID: 1},
+		Storage: 10,
+		Group:   model.Group{MaxStorage: 20},
+	}}
+
+	asserts.True(fs.reserveCapacity(6))
+	asserts.True(fs.reserveCapacity(4))
+	asserts.False(fs.reserveCapacity(1))
+
+	// 另一用户不受影响
+	other := &FileSystem{User: &model.User{
+		Model: gorm.Model{ID: 2},
+		Group: model.Group{MaxStorage: 20},
+	}}
+	asserts.True(other.reserveCapacity(20))
+	other.releaseCapacity(20)
+
+	fs.releaseCapacity(4)
+	asserts.True(fs.reserveCapacity(3))
+	fs.releaseCapacity(9)
+	asserts.Empty(capacityReservations.reserved)
+}
+
+func TestFileSystem_UploadBatch(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{
+		Model:   gorm.Model{ID: 1},
+		Storage: 10,
+		Group:   model.Group{MaxStorage: 15},
+		Policy:  model.Policy{Type: "local"},
+	}}
+
+	files := []*fsctx.FileStream{
+		{File: ioutil.NopCloser(strings.NewReader("123456")), Size: 6, Name: "1.txt", VirtualPath: "/"},
+		{File: ioutil.NopCloser(strings.NewReader("1234")), Size: 4, Name: "/2.txt", VirtualPath: "/"},
+	}
+
+	errs := fs.UploadBatch(context.Background(), files)
+	asserts.Len(errs, 2)
+	asserts.Equal(ErrInsufficientCapacity, errs[0])
+	asserts.Equal(ErrIllegalObjectName, errs[1])
+	asserts.Empty(capacityReservations.reserved)
+}
+
+func TestFileSystem_UploadBatch_Region(t *testing.T) {
+	asserts := assert.New(t)
+	setupTestGeoIPDatabase(t)
+	cache.Set("setting_upload_geoip_enabled", "1", 0)
+	cache.Set("setting_upload_geoip_policy", UploadRegionPolicyDeny, 0)
+	cache.Set("setting_upload_geoip_countries", "CN", 0)
+	defer cache.Deletes([]string{"upload_geoip_enabled"}, "setting_")
+
+	fs := &FileSystem{User: &model.User{
+		Model:  gorm.Model{ID: 1},
+		Group:  model.Group{MaxStorage: 15},
+		Policy: model.Policy{Type: "local"},
+	}}
+	files := []*fsctx.FileStream{
+		{File: ioutil.NopCloser(strings.NewReader("123")), Size: 3, Name: "1.txt", VirtualPath: "/"},
+	}
+
+	ctx := context.WithValue(context.Background(), fsctx.ClientIPCtx, "1.1.1.1")
+	errs := fs.UploadBatch(ctx, files)
+	asserts.Len(errs, 1)
+	asserts.Error(errs[0])
+	asserts.Equal(serializer.CodeUploadRegionDenied, errs[0].(serializer.AppError).Code)
+}
@@ -0,0 +1,293 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 内容寻址存储相关
+   ================
+*/
+
+// contentAddressLock 内容寻址对象的引用检查与存放、删除互斥进行，
+// 避免新上传的文件引用正在被删除的对象
+var contentAddressLock sync.Mutex
+
+// contentAddressInflightPrefix 正在存放的内容寻址对象的缓存键前缀，值为持有者上传的源对象路径
+const contentAddressInflightPrefix = "cas_inflight_"
+
+// contentAddressPollInterval 等待其他上传存放相同内容时的轮询间隔
+var contentAddressPollInterval = 500 * time.Millisecond
+
+var contentAddressPattern = regexp.MustCompile(`(^|/)` + regexp.QuoteMeta(model.ContentAddressDir) + `/(u[0-9]+/)?[0-9a-f]{2}/[0-9a-f]{64}$`)
+
+// isContentAddressPath 返回 source 是否为内容寻址存储的对象路径
+func isContentAddressPath(source string) bool {
+	return contentAddressPattern.MatchString(source)
+}
+
+// contentAddressable 返回当前存储策略是否开启内容寻址
+func (fs *FileSystem) contentAddressable() bool {
+	return fs.Policy != nil && fs.Policy.IsContentAddressable()
+}
+
+// HookContentAddress 存储策略开启内容寻址时，将已上传完成的文件移至其内容哈希对应的路径，
+// 并更新文件记录的源文件名。用于上传时无法计算哈希的分片上传、客户端直传完成后。
+// 上传数据中的保存路径保持不变，后续失败回滚时不会改动可能被共用的对象
+func HookContentAddress(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	if !fs.contentAddressable() {
+		return nil
+	}
+
+	fileInfo := fileHeader.Info()
+	fileModel, ok := fileInfo.Model.(*model.File)
+	if !ok {
+		return ErrObjectNotExist
+	}
+
+	digest, err := fs.hashObject(ctx, fileModel.SourceName)
+	if err != nil {
+		return err
+	}
+
+	key, err := fs.storeContentAddressed(ctx, fileModel.SourceName, digest)
+	if err != nil {
+		return err
+	}
+
+	if key == fileModel.SourceName {
+		return nil
+	}
+
+	defer fs.releaseContentAddressLock(key, fileModel.SourceName)
+	if err := fileModel.UpdateSourceName(key); err != nil {
+		return err
+	}
+	fileModel.SourceName = key
+	return nil
+}
+
+// contentAddress 将 Upload 中刚写入的文件移至内容哈希对应的路径。digest 为空时回读计算。
+// 更新已有文件时同时更新其源文件名，并在旧对象不再被引用时删除
+func (fs *FileSystem) contentAddress(ctx context.Context, file *fsctx.FileStream, digest string) error {
+	if digest == "" {
+		var err error
+		if digest, err = fs.hashObject(ctx, file.SavePath); err != nil {
+			return err
+		}
+	}
+
+	key, err := fs.storeContentAddressed(ctx, file.SavePath, digest)
+	if err != nil {
+		return err
+	}
+	file.SavePath = key
+
+	if fileModel, ok := file.Model.(*model.File); ok && fileModel.SourceName != key {
+		if err := fileModel.UpdateSourceName(key); err != nil {
+			return err
+		}
+		fileModel.SourceName = key
+	}
+
+	// 更新操作，重新读取记录以获得当前实际引用的对象
+	originFile, ok := ctx.Value(fsctx.FileModelCtx).(model.File)
+	if !ok {
+		return nil
+	}
+
+	files, err := model.GetFilesByIDs([]uint{originFile.ID}, originFile.UserID)
+	if err != nil || len(files) == 0 {
+		return ErrObjectNotExist.WithError(err)
+	}
+
+	previous := files[0].SourceName
+	if previous == key {
+		return nil
+	}
+
+	if err := files[0].UpdateSourceName(key); err != nil {
+		return err
+	}
+
+	fs.releaseObject(ctx, files[0].PolicyID, previous)
+	return nil
+}
+
+// storeContentAddressed 将 src 处的对象存放至 digest 对应的路径并返回该路径，
+// 目标对象已被其他文件引用时直接删除 src。按用户去重时只查找当前用户路径下的对象。
+//
+// 相同内容的其他上传正在存放时，等待其文件记录提交后引用同一对象；等待超过
+// content_address_lock_timeout 时保留 src 作为独立的对象并返回 src。
+// 返回内容寻址路径时，调用方需在文件记录提交后调用 releaseContentAddressLock
+func (fs *FileSystem) storeContentAddressed(ctx context.Context, src, digest string) (string, error) {
+	var uid uint
+	if fs.User != nil {
+		uid = fs.User.ID
+	}
+	key := fs.Policy.ContentAddressPath(digest, uid)
+	if key == src {
+		return key, nil
+	}
+
+	timeout := model.GetIntSetting("content_address_lock_timeout", 300)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		stored, err := fs.tryStoreContentAddressed(ctx, src, key, timeout)
+		if err != nil || stored != "" {
+			return stored, err
+		}
+
+		if !time.Now().Before(deadline) {
+			util.Log().Info("Timed out waiting for identical upload of %q, store it independently.", key)
+			return src, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(contentAddressPollInterval):
+		}
+	}
+}
+
+// tryStoreContentAddressed 尝试将 src 存放至 key，其他上传正持有 key 的存放锁时返回空路径
+func (fs *FileSystem) tryStoreContentAddressed(ctx context.Context, src, key string, timeout int) (string, error) {
+	contentAddressLock.Lock()
+	defer contentAddressLock.Unlock()
+
+	var referenced int
+	if err := model.DB.Model(&model.File{}).
+		Where("policy_id = ? and source_name = ?", fs.Policy.ID, key).
+		Count(&referenced).Error; err != nil {
+		return "", ErrDBListObjects.WithError(err)
+	}
+
+	if referenced > 0 {
+		if _, err := fs.Handler.Delete(ctx, []string{src}); err != nil {
+			util.Log().Warning("Failed to delete duplicated object %q: %s", src, err)
+		}
+		return key, nil
+	}
+
+	lockKey := fs.contentAddressLockKey(key)
+	if owner, ok := cache.Get(lockKey); ok && owner != src {
+		return "", nil
+	}
+
+	// 多个节点共用 Redis 时检查与设置并非原子操作，仅可减少重复写入
+	if err := cache.Set(lockKey, src, timeout); err != nil {
+		util.Log().Warning("Failed to lock content address %q: %s", key, err)
+	}
+
+	if err := fs.moveObject(ctx, src, key); err != nil {
+		_ = cache.Deletes([]string{lockKey}, "")
+		return "", err
+	}
+
+	return key, nil
+}
+
+// contentAddressLockKey 返回内容寻址对象存放锁的缓存键
+func (fs *FileSystem) contentAddressLockKey(key string) string {
+	return contentAddressInflightPrefix + strconv.FormatUint(uint64(fs.Policy.ID), 10) + "_" + key
+}
+
+// releaseContentAddressLock 释放由 src 的上传持有的 key 的存放锁，等待中的相同内容上传随后引用该对象
+func (fs *FileSystem) releaseContentAddressLock(key, src string) {
+	contentAddressLock.Lock()
+	defer contentAddressLock.Unlock()
+
+	lockKey := fs.contentAddressLockKey(key)
+	if owner, ok := cache.Get(lockKey); ok && owner == src {
+		_ = cache.Deletes([]string{lockKey}, "")
+	}
+}
+
+// moveObject 在存储端移动对象，本地策略直接重命名，其余策略复制后删除源对象
+func (fs *FileSystem) moveObject(ctx context.Context, src, dst string) error {
+	if fs.Policy.Type == "local" {
+		dstPath := util.RelativePath(filepath.FromSlash(dst))
+		if err := os.MkdirAll(filepath.Dir(dstPath), local.Perm); err != nil {
+			return err
+		}
+		return os.Rename(util.RelativePath(filepath.FromSlash(src)), dstPath)
+	}
+
+	rs, err := fs.Handler.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = rs.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		rs.Close()
+		return err
+	}
+
+	if err := fs.Handler.Put(ctx, &fsctx.FileStream{
+		File:     rs,
+		Size:     uint64(size),
+		SavePath: dst,
+		Mode:     fsctx.Overwrite,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := fs.Handler.Delete(ctx, []string{src}); err != nil {
+		util.Log().Warning("Failed to delete object %q after moving: %s", src, err)
+	}
+
+	return nil
+}
+
+// releaseObject 对象不再被任何文件引用时将其删除
+func (fs *FileSystem) releaseObject(ctx context.Context, policyID uint, source string) {
+	contentAddressLock.Lock()
+	defer contentAddressLock.Unlock()
+
+	var referenced int
+	if err := model.DB.Model(&model.File{}).
+		Where("policy_id = ? and source_name = ?", policyID, source).
+		Count(&referenced).Error; err != nil || referenced > 0 {
+		return
+	}
+
+	if _, err := fs.Handler.Delete(ctx, []string{source}); err != nil {
+		util.Log().Warning("Failed to delete unreferenced object %q: %s", source, err)
+	}
+}
+
+// hashObject 回读存储端对象，计算其 SHA-256 哈希
+func (fs *FileSystem) hashObject(ctx context.Context, source string) (string, error) {
+	rs, err := fs.Handler.Get(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	defer rs.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rs); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,318 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func casPolicy() *model.Policy {
+	return &model.Policy{
+		Type:              "mock",
+		DirNameRule:       "uploads/{uid}/{path}",
+		OptionsSerialized: model.PolicyOption{ContentAddressable: true},
+	}
+}
+
+func cacheExists(key string) bool {
+	_, ok := cache.Get(key)
+	return ok
+}
+
+func TestIsContentAddressPath(t *testing.T) {
+	asserts := assert.New(t)
+	digest := strings.Repeat("ab", 32)
+
+	asserts.True(isContentAddressPath(casPolicy().ContentAddressPath(digest, 1)))
+	asserts.True(isContentAddressPath(".cas/ab/" + digest))
+	asserts.True(isContentAddressPath("uploads/.cas/u12/ab/" + digest))
+	asserts.False(isContentAddressPath("uploads/.cas/ux/ab/" + digest))
+	asserts.False(isContentAddressPath("uploads/1/.cas/ab/" + digest[:10]))
+	asserts.False(isContentAddressPath("uploads/1/a.cas/ab/" + digest))
+	asserts.False(isContentAddressPath("uploads/1/1.txt"))
+}
+
+func TestFileSystem_PutContentHash(t *testing.T) {
+	asserts := assert.New(t)
+	sum := sha256.Sum256([]byte("12345"))
+	expected := hex.EncodeToString(sum[:])
+
+	// 顺序读取
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything).Run(func(args testMock.Arguments) {
+			ioutil.ReadAll(args.Get(1).(fsctx.FileHeader))
+		}).Return(nil)
+		fs := &FileSystem{Handler: testHandler, Policy: casPolicy()}
+		written, digest, err := fs.put(context.Background(), &fsctx.FileStream{
+			File: ioutil.NopCloser(strings.NewReader("12345")),
+			Size: 5,
+		})
+		asserts.NoError(err)
+		asserts.EqualValues(5, written)
+		asserts.Equal(expected, digest)
+	}
+
+	// 存储端重新定位后重读
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything).Run(func(args testMock.Arguments) {
+			file := args.Get(1).(fsctx.FileHeader)
+			ioutil.ReadAll(io.LimitReader(file, 3))
+			file.Seek(1, io.SeekStart)
+			ioutil.ReadAll(file)
+		}).Return(nil)
+		fs := &FileSystem{Handler: testHandler, Policy: casPolicy()}
+		reader := strings.NewReader("12345")
+		_, digest, err := fs.put(context.Background(), &fsctx.FileStream{
+			File:   ioutil.NopCloser(reader),
+			Seeker: reader,
+			Size:   5,
+		})
+		asserts.NoError(err)
+		asserts.Equal(expected, digest)
+	}
+
+	// 未从头读取
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything).Run(func(args testMock.Arguments) {
+			file := args.Get(1).(fsctx.FileHeader)
+			file.Seek(2, io.SeekStart)
+			ioutil.ReadAll(file)
+		}).Return(nil)
+		fs := &FileSystem{Handler: testHandler, Policy: casPolicy()}
+		reader := strings.NewReader("12345")
+		_, digest, err := fs.put(context.Background(), &fsctx.FileStream{
+			File:   ioutil.NopCloser(reader),
+			Seeker: reader,
+			Size:   5,
+		})
+		asserts.NoError(err)
+		asserts.Empty(digest)
+	}
+
+	// 未开启内容寻址
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything).Return(nil)
+		fs := &FileSystem{Handler: testHandler}
+		_, digest, err := fs.put(context.Background(), &fsctx.FileStream{
+			File: ioutil.NopCloser(strings.NewReader("12345")),
+			Size: 5,
+		})
+		asserts.NoError(err)
+		asserts.Empty(digest)
+	}
+}
+
+func TestFileSystem_StoreContentAddressed(t *testing.T) {
+	asserts := assert.New(t)
+	digest := strings.Repeat("ab", 32)
+	key := "uploads/.cas/ab/" + digest
+
+	// 已有文件引用相同内容，删除新上传的对象
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Delete", testMock.Anything, []string{"uploads/1/1.txt"}).Return([]string{}, nil)
+		fs := &FileSystem{Handler: testHandler, Policy: casPolicy()}
+		mock.ExpectQuery("SELECT count(.+)files").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		res, err := fs.storeContentAddressed(context.Background(), "uploads/1/1.txt", digest)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(key, res)
+		testHandler.AssertExpectations(t)
+	}
+
+	// 首次出现的内容，复制后删除源对象
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "uploads/1/1.txt").
+			Return(MockRSC{rs: strings.NewReader("12345")}, nil)
+		testHandler.On("Put", testMock.Anything, testMock.MatchedBy(func(file fsctx.FileHeader) bool {
+			info := file.Info()
+			return info.SavePath == key && info.Size == 5
+		})).Return(nil)
+		testHandler.On("Delete", testMock.Anything, []string{"uploads/1/1.txt"}).Return([]string{}, nil)
+		fs := &FileSystem{Handler: testHandler, Policy: casPolicy()}
+		mock.ExpectQuery("SELECT count(.+)files").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		res, err := fs.storeContentAddressed(context.Background(), "uploads/1/1.txt", digest)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(key, res)
+		testHandler.AssertExpectations(t)
+
+		// 文件记录提交前持有存放锁
+		owner, ok := cache.Get(fs.contentAddressLockKey(key))
+		asserts.True(ok)
+		asserts.Equal("uploads/1/1.txt", owner)
+		fs.releaseContentAddressLock(key, "uploads/2/1.txt")
+		asserts.True(cacheExists(fs.contentAddressLockKey(key)))
+		fs.releaseContentAddressLock(key, "uploads/1/1.txt")
+		asserts.False(cacheExists(fs.contentAddressLockKey(key)))
+	}
+
+	// 相同内容的其他上传正在存放，等待超时后独立存放
+	{
+		cache.Set("setting_content_address_lock_timeout", "0", 0)
+		defer cache.Deletes([]string{"content_address_lock_timeout"}, "setting_")
+		fs := &FileSystem{Handler: new(FileHeaderMock), Policy: casPolicy()}
+		cache.Set(fs.contentAddressLockKey(key), "uploads/2/1.txt", 0)
+		mock.ExpectQuery("SELECT count(.+)files").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		res, err := fs.storeContentAddressed(context.Background(), "uploads/1/1.txt", digest)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal("uploads/1/1.txt", res)
+		cache.Deletes([]string{fs.contentAddressLockKey(key)}, "")
+	}
+
+	// 相同内容的其他上传提交后引用同一对象
+	{
+		cache.Set("setting_content_address_lock_timeout", "10", 0)
+		contentAddressPollInterval = time.Millisecond
+		defer func() { contentAddressPollInterval = 500 * time.Millisecond }()
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Delete", testMock.Anything, []string{"uploads/1/1.txt"}).Return([]string{}, nil)
+		fs := &FileSystem{Handler: testHandler, Policy: casPolicy()}
+		cache.Set(fs.contentAddressLockKey(key), "uploads/2/1.txt", 0)
+		mock.ExpectQuery("SELECT count(.+)files").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery("SELECT count(.+)files").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			fs.releaseContentAddressLock(key, "uploads/2/1.txt")
+		}()
+		res, err := fs.storeContentAddressed(context.Background(), "uploads/1/1.txt", digest)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(key, res)
+		testHandler.AssertExpectations(t)
+	}
+
+	// 已位于内容寻址路径
+	{
+		fs := &FileSystem{Handler: new(FileHeaderMock), Policy: casPolicy()}
+		res, err := fs.storeContentAddressed(context.Background(), key, digest)
+		asserts.NoError(err)
+		asserts.Equal(key, res)
+	}
+
+	// 全局去重，引用其他用户已上传的相同内容
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Delete", testMock.Anything, []string{"uploads/2/1.txt"}).Return([]string{}, nil)
+		policy := casPolicy()
+		policy.OptionsSerialized.ContentAddressScope = model.ContentAddressScopeGlobal
+		fs := &FileSystem{Handler: testHandler, Policy: policy, User: &model.User{Model: gorm.Model{ID: 2}}}
+		mock.ExpectQuery("SELECT count(.+)files").
+			WithArgs(0, key).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		res, err := fs.storeContentAddressed(context.Background(), "uploads/2/1.txt", digest)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(key, res)
+		testHandler.AssertExpectations(t)
+	}
+
+	// 按用户去重，只查找当前用户路径下的对象，不会引用其他用户的相同内容
+	{
+		userKey := "uploads/.cas/u2/ab/" + digest
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "uploads/2/1.txt").
+			Return(MockRSC{rs: strings.NewReader("12345")}, nil)
+		testHandler.On("Put", testMock.Anything, testMock.MatchedBy(func(file fsctx.FileHeader) bool {
+			return file.Info().SavePath == userKey
+		})).Return(nil)
+		testHandler.On("Delete", testMock.Anything, []string{"uploads/2/1.txt"}).Return([]string{}, nil)
+		policy := casPolicy()
+		policy.OptionsSerialized.ContentAddressScope = model.ContentAddressScopeUser
+		fs := &FileSystem{Handler: testHandler, Policy: policy, User: &model.User{Model: gorm.Model{ID: 2}}}
+		mock.ExpectQuery("SELECT count(.+)files").
+			WithArgs(0, userKey).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		res, err := fs.storeContentAddressed(context.Background(), "uploads/2/1.txt", digest)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(userKey, res)
+		testHandler.AssertExpectations(t)
+	}
+}
+
+func TestHookContentAddress(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未开启内容寻址
+	{
+		fs := &FileSystem{Policy: &model.Policy{}}
+		asserts.NoError(HookContentAddress(context.Background(), fs, &fsctx.FileStream{}))
+	}
+
+	// 回读计算哈希并更新源文件名
+	{
+		sum := sha256.Sum256([]byte("12345"))
+		key := "uploads/.cas/" + hex.EncodeToString(sum[:1]) + "/" + hex.EncodeToString(sum[:])
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "uploads/1/1.txt").
+			Return(MockRSC{rs: strings.NewReader("12345")}, nil).Once()
+		testHandler.On("Delete", testMock.Anything, []string{"uploads/1/1.txt"}).Return([]string{}, nil)
+		fs := &FileSystem{Handler: testHandler, Policy: casPolicy()}
+		file := &model.File{SourceName: "uploads/1/1.txt"}
+		mock.ExpectQuery("SELECT count(.+)files").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)source_name").WithArgs(key, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		err := HookContentAddress(context.Background(), fs, &fsctx.FileStream{Model: file})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(key, file.SourceName)
+		testHandler.AssertExpectations(t)
+	}
+}
+
+func TestFileSystem_ReleaseObject(t *testing.T) {
+	asserts := assert.New(t)
+	key := "uploads/.cas/ab/" + strings.Repeat("ab", 32)
+
+	// 仍被文件引用（可能属于其他用户），不删除
+	{
+		testHandler := new(FileHeaderMock)
+		fs := &FileSystem{Handler: testHandler, Policy: casPolicy(), User: &model.User{Model: gorm.Model{ID: 1}}}
+		mock.ExpectQuery("SELECT count(.+)files(.+)policy_id = \\? and source_name = \\?").
+			WithArgs(1, key).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		fs.releaseObject(context.Background(), 1, key)
+		asserts.NoError(mock.ExpectationsWereMet())
+		testHandler.AssertNotCalled(t, "Delete", testMock.Anything, testMock.Anything)
+	}
+
+	// 不再被引用
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Delete", testMock.Anything, []string{key}).Return([]string{}, nil)
+		fs := &FileSystem{Handler: testHandler, Policy: casPolicy()}
+		mock.ExpectQuery("SELECT count(.+)files").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		fs.releaseObject(context.Background(), 1, key)
+		asserts.NoError(mock.ExpectationsWereMet())
+		testHandler.AssertExpectations(t)
+	}
+}
@@ -0,0 +1,81 @@
+package filesystem
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/gin-gonic/gin"
+)
+
+/* ================
+	 上传客户端相关
+   ================
+*/
+
+// UploadClientHeader 客户端可通过此请求头显式声明自身标识
+const UploadClientHeader = "X-Cr-Client"
+
+// 上传客户端标识
+const (
+	UploadClientUnknown = "unknown"
+	UploadClientWeb     = "web"
+	UploadClientMobile  = "mobile"
+	UploadClientWebDAV  = "webdav"
+	UploadClientAPI     = "api"
+)
+
+// maxUploadClientLength 显式声明的客户端标识最大长度
+const maxUploadClientLength = 32
+
+// DetectUploadClient 根据请求头推断发起上传的客户端，优先使用显式声明的标识，
+// 其次根据 User-Agent 判断，均无法判断时返回 UploadClientUnknown
+func DetectUploadClient(r *http.Request) string {
+	if client := sanitizeUploadClient(r.Header.Get(UploadClientHeader)); client != "" {
+		return client
+	}
+
+	ua := r.UserAgent()
+	switch {
+	case ua == "":
+		return UploadClientUnknown
+	case strings.Contains(ua, "Android") || strings.Contains(ua, "iPhone") ||
+		strings.Contains(ua, "iPad") || strings.Contains(ua, "Mobile"):
+		return UploadClientMobile
+	case strings.HasPrefix(ua, "Mozilla/"):
+		return UploadClientWeb
+	default:
+		return UploadClientAPI
+	}
+}
+
+// sanitizeUploadClient 仅保留字母、数字及 -_. 字符，并限制长度
+func sanitizeUploadClient(client string) string {
+	client = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+			r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return -1
+	}, strings.TrimSpace(client))
+
+	if len(client) > maxUploadClientLength {
+		client = client[:maxUploadClientLength]
+	}
+
+	return strings.ToLower(client)
+}
+
+// uploadClientFromContext 从上下文中取得上传客户端标识，未指定时尝试从 Gin 上下文的请求中推断
+func uploadClientFromContext(ctx context.Context) string {
+	if client, ok := ctx.Value(fsctx.UploadClientCtx).(string); ok && client != "" {
+		return client
+	}
+
+	if ginCtx, ok := ctx.Value(fsctx.GinCtx).(*gin.Context); ok && ginCtx.Request != nil {
+		return DetectUploadClient(ginCtx.Request)
+	}
+
+	return UploadClientUnknown
+}
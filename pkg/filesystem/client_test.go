@@ -0,0 +1,58 @@
+package filesystem
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectUploadClient(t *testing.T) {
+	a := assert.New(t)
+
+	testCases := []struct {
+		header string
+		ua     string
+		expect string
+	}{
+		{"", "", UploadClientUnknown},
+		{"Desktop-App", "", "desktop-app"},
+		{" <script>", "Mozilla/5.0", "script"},
+		{"", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", UploadClientWeb},
+		{"", "Mozilla/5.0 (iPhone; CPU iPhone OS 15_0 like Mac OS X)", UploadClientMobile},
+		{"", "curl/7.68.0", UploadClientAPI},
+	}
+
+	for _, testCase := range testCases {
+		r := httptest.NewRequest("PUT", "/", nil)
+		r.Header.Set(UploadClientHeader, testCase.header)
+		r.Header.Set("User-Agent", testCase.ua)
+		a.Equal(testCase.expect, DetectUploadClient(r))
+	}
+
+	// 超长标识
+	r := httptest.NewRequest("PUT", "/", nil)
+	r.Header.Set(UploadClientHeader, "0123456789012345678901234567890123456789")
+	a.Len(DetectUploadClient(r), maxUploadClientLength)
+}
+
+func TestUploadClientFromContext(t *testing.T) {
+	a := assert.New(t)
+
+	// 未指定
+	a.Equal(UploadClientUnknown, uploadClientFromContext(context.Background()))
+
+	// 显式指定
+	ctx := context.WithValue(context.Background(), fsctx.UploadClientCtx, UploadClientWebDAV)
+	a.Equal(UploadClientWebDAV, uploadClientFromContext(ctx))
+
+	// 从 Gin 上下文推断
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("PUT", "/", nil)
+	c.Request.Header.Set("User-Agent", "curl/7.68.0")
+	ctx = context.WithValue(context.Background(), fsctx.GinCtx, c)
+	a.Equal(UploadClientAPI, uploadClientFromContext(ctx))
+}
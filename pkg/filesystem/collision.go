@@ -0,0 +1,121 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 上传重名处理相关
+   ================
+*/
+
+// maxCollisionAttempts 查找可用文件名时的最大尝试次数
+const maxCollisionAttempts = 1000
+
+// IsValidCollisionPolicy 返回 policy 是否为可设定的重名处理方式
+func IsValidCollisionPolicy(policy string) bool {
+	switch policy {
+	case model.CollisionPolicyError, model.CollisionPolicyOverwrite,
+		model.CollisionPolicyVersion, model.CollisionPolicyRename:
+		return true
+	}
+	return false
+}
+
+// resolveCollisionPolicy 决定上传至 folder 的文件重名时的处理方式，目录未设定时
+// 沿上级目录查找，均未设定时使用全局设置
+func (fs *FileSystem) resolveCollisionPolicy(folder *model.Folder) string {
+	current := folder
+	for {
+		if current.CollisionPolicy != model.CollisionPolicyInherit {
+			return current.CollisionPolicy
+		}
+
+		if current.ParentID == nil {
+			break
+		}
+
+		parents, err := model.GetFoldersByIDs([]uint{*current.ParentID}, current.OwnerID)
+		if err != nil || len(parents) == 0 {
+			break
+		}
+		current = &parents[0]
+	}
+
+	policy := model.GetSettingByNameWithDefault("upload_collision_policy", model.CollisionPolicyError)
+	if !IsValidCollisionPolicy(policy) {
+		return model.CollisionPolicyError
+	}
+
+	return policy
+}
+
+// handleNameCollision 按目录的重名处理方式处理新上传文件与已有文件 existed 的重名
+func (fs *FileSystem) handleNameCollision(ctx context.Context, folder *model.Folder, existed *model.File, fileHeader fsctx.FileHeader) error {
+	switch fs.resolveCollisionPolicy(folder) {
+	case model.CollisionPolicyOverwrite:
+		// 新内容写入了原文件的存储路径时，原内容已无法保留
+		if fs.TrashOnOverwrite() && existed.SourceName != fileHeader.Info().SavePath {
+			return fs.trashOverwritten(ctx, existed, fileHeader)
+		}
+
+		defer fs.CleanTargets()
+		if err := fs.Delete(ctx, []uint{}, []uint{existed.ID}, false); err != nil {
+			util.Log().Warning("Failed to delete file %q before overwriting: %s", existed.Name, err)
+			return ErrFileExisted.WithError(err)
+		}
+		return nil
+	case model.CollisionPolicyVersion:
+		name, ok := fs.availableFileName(folder, existed.Name, "%s.v%d%s")
+		if !ok {
+			return ErrFileExisted
+		}
+		if err := existed.Rename(name); err != nil {
+			return ErrFileExisted.WithError(err)
+		}
+		return nil
+	case model.CollisionPolicyRename:
+		name, ok := fs.availableFileName(folder, fileHeader.Info().FileName, "%s (%d)%s")
+		if !ok {
+			return ErrFileExisted
+		}
+		fileHeader.SetName(name)
+		return nil
+	default:
+		return ErrFileExisted
+	}
+}
+
+// availableFileName 按 format 依次为文件名添加序号，返回 folder 下第一个未被占用的文件名，
+// format 依次接收文件名主体、序号与扩展名
+func (fs *FileSystem) availableFileName(folder *model.Folder, name, format string) (string, bool) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; i <= maxCollisionAttempts; i++ {
+		candidate := fmt.Sprintf(format, base, i, ext)
+		if exist, _ := fs.IsChildFileExist(folder, candidate); !exist {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
+
+// trashOverwritten 将被覆盖的文件移入回收站，本次上传后续处理失败时恢复
+func (fs *FileSystem) trashOverwritten(ctx context.Context, existed *model.File, fileHeader fsctx.FileHeader) error {
+	trash, err := fs.TrashFile(ctx, existed, fileHeader.Info().UploadSessionID)
+	if err != nil {
+		util.Log().Warning("Failed to move file %q to trash before overwriting: %s", existed.Name, err)
+		return ErrFileExisted.WithError(err)
+	}
+
+	fs.Use("AfterValidateFailed", HookRestoreTrash(trash, fileHeader))
+	return nil
+}
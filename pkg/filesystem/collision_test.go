@@ -0,0 +1,125 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem_ResolveCollisionPolicy(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	parentID := uint(1)
+	cache.Set("setting_upload_collision_policy", model.CollisionPolicyError, 0)
+
+	// 目录自身设定
+	{
+		folder := &model.Folder{CollisionPolicy: model.CollisionPolicyRename}
+		asserts.Equal(model.CollisionPolicyRename, fs.resolveCollisionPolicy(folder))
+	}
+
+	// 继承上级目录
+	{
+		folder := &model.Folder{ParentID: &parentID, OwnerID: 1}
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collision_policy"}).AddRow(1, model.CollisionPolicyVersion))
+		asserts.Equal(model.CollisionPolicyVersion, fs.resolveCollisionPolicy(folder))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 上级目录均未设定，使用全局设置
+	{
+		folder := &model.Folder{ParentID: &parentID, OwnerID: 1}
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collision_policy"}).AddRow(1, ""))
+		cache.Set("setting_upload_collision_policy", model.CollisionPolicyOverwrite, 0)
+		asserts.Equal(model.CollisionPolicyOverwrite, fs.resolveCollisionPolicy(folder))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 全局设置无效
+	{
+		cache.Set("setting_upload_collision_policy", "invalid", 0)
+		asserts.Equal(model.CollisionPolicyError, fs.resolveCollisionPolicy(&model.Folder{}))
+		cache.Set("setting_upload_collision_policy", model.CollisionPolicyError, 0)
+	}
+}
+
+func TestFileSystem_HandleNameCollision(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+	existed := &model.File{Model: gorm.Model{ID: 3}, Name: "a.txt"}
+	ctx := context.Background()
+
+	// 拒绝上传
+	{
+		folder := &model.Folder{Model: gorm.Model{ID: 2}, CollisionPolicy: model.CollisionPolicyError}
+		err := fs.handleNameCollision(ctx, folder, existed, &fsctx.FileStream{Name: "a.txt"})
+		asserts.Equal(ErrFileExisted, err)
+	}
+
+	// 自动重命名新文件
+	{
+		folder := &model.Folder{Model: gorm.Model{ID: 2}, CollisionPolicy: model.CollisionPolicyRename}
+		file := &fsctx.FileStream{Name: "a.txt"}
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(2, "a (1).txt").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(2, "a (2).txt").
+			WillReturnError(errors.New("not found"))
+		asserts.NoError(fs.handleNameCollision(ctx, folder, existed, file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal("a (2).txt", file.Name)
+	}
+
+	// 已有文件重命名为历史版本
+	{
+		folder := &model.Folder{Model: gorm.Model{ID: 2}, CollisionPolicy: model.CollisionPolicyVersion}
+		file := &fsctx.FileStream{Name: "a.txt"}
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(2, "a.v1.txt").
+			WillReturnError(errors.New("not found"))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs("a.v1.txt", 3).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.handleNameCollision(ctx, folder, existed, file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal("a.txt", file.Name)
+	}
+
+	// 覆盖时将已有文件移入回收站
+	{
+		folder := &model.Folder{Model: gorm.Model{ID: 2}, CollisionPolicy: model.CollisionPolicyOverwrite}
+		fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+		fs.User.Group.OptionsSerialized.TrashOnOverwrite = true
+		existed := &model.File{Model: gorm.Model{ID: 3}, Name: "a.txt", UserID: 1, FolderID: 2, SourceName: "old"}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT(.+)trashes(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)shares(.+)").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		err := fs.handleNameCollision(ctx, folder, existed, &fsctx.FileStream{Name: "a.txt", SavePath: "new"})
+		asserts.NoError(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.True(existed.IsTrashed())
+		asserts.Len(fs.Hooks["AfterValidateFailed"], 1)
+	}
+
+	// 删除已有文件失败
+	{
+		folder := &model.Folder{Model: gorm.Model{ID: 2}, CollisionPolicy: model.CollisionPolicyOverwrite}
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnError(errors.New("error"))
+		err := fs.handleNameCollision(ctx, folder, existed, &fsctx.FileStream{Name: "a.txt"})
+		asserts.Error(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
@@ -0,0 +1,93 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"mime"
+	"path/filepath"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/thumb"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// ConvertImageToSRGB 将嵌入非 sRGB 色彩配置文件的 JPEG/PNG 原图转换到 sRGB 并覆盖保存，
+// 同时更新文件大小与 MD5。内容寻址的对象可能被其他文件引用，不做处理；返回值表示原图是否被转换
+func (fs *FileSystem) ConvertImageToSRGB(ctx context.Context, file *model.File) (bool, error) {
+	if !IsInExtensionList([]string{"jpg", "jpeg", "png"}, file.Name) || isContentAddressPath(file.SourceName) || file.IsSharded() {
+		return false, nil
+	}
+
+	source, err := fs.Handler.Get(ctx, file.SourceName)
+	if err != nil {
+		return false, ErrIO.WithError(err)
+	}
+	defer source.Close()
+
+	memory, reader, err := thumb.EstimateMemory(source)
+	if err != nil {
+		memory = file.Size
+	}
+	getThumbWorker().acquireMemory(memory)
+	defer getThumbWorker().releaseMemory(memory)
+
+	image, err := thumb.NewThumbFromFile(reader, file.Name)
+	if err != nil {
+		return false, err
+	}
+
+	if converted, err := image.ToSRGB(); err != nil || !converted {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	if err := image.Encode(&buf, model.GetIntSetting("image_srgb_quality", 92)); err != nil {
+		return false, err
+	}
+
+	if err := fs.Handler.Put(ctx, &fsctx.FileStream{
+		File:     ioutil.NopCloser(bytes.NewReader(buf.Bytes())),
+		Seeker:   bytes.NewReader(buf.Bytes()),
+		Size:     uint64(buf.Len()),
+		Name:     filepath.Base(file.SourceName),
+		MIMEType: mime.TypeByExtension(filepath.Ext(file.Name)),
+		SavePath: file.SourceName,
+		Mode:     fsctx.Overwrite,
+	}); err != nil {
+		return false, ErrIO.WithError(err)
+	}
+
+	if err := file.UpdateSize(uint64(buf.Len())); err != nil {
+		return true, ErrDBUpdateObjects.WithError(err)
+	}
+
+	// 仅更新已记录的 MD5，避免为不需要的文件额外写入
+	if file.MD5 != "" {
+		digest := md5.Sum(buf.Bytes())
+		if err := file.UpdateMD5(hex.EncodeToString(digest[:])); err != nil {
+			return true, ErrDBUpdateObjects.WithError(err)
+		}
+		file.MD5 = hex.EncodeToString(digest[:])
+	}
+
+	return true, nil
+}
+
+// HookConvertImageToSRGB 存储策略启用原图色彩转换时，将上传的图像转换到 sRGB。
+// 需在生成缩略图等读取文件内容的处理之前执行，转换失败时保留原图
+func HookConvertImageToSRGB(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || fs.Policy == nil || !fs.Policy.OptionsSerialized.ConvertOriginalToSRGB {
+		return nil
+	}
+
+	if _, err := fs.ConvertImageToSRGB(ctx, fileModel); err != nil {
+		util.Log().Warning("Failed to convert color profile of image %q: %s", fileModel.Name, err)
+	}
+
+	return nil
+}
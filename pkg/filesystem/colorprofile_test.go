@@ -0,0 +1,112 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/thumb"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// jpegWithProfile 编码 JPEG 并在 SOI 之后嵌入色彩配置文件
+func jpegWithProfile(t *testing.T, profile []byte) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil))
+	data := buf.Bytes()
+
+	segment := []byte{0xFF, 0xE2, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+12+2+len(profile)))
+	segment = append(segment, "ICC_PROFILE\x00\x01\x01"...)
+	segment = append(segment, profile...)
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+// wideGamutProfile 以 sRGB 配置文件为基础，将红色原色替换为 Display P3 的红色
+func wideGamutProfile() []byte {
+	profile := append([]byte{}, thumb.SRGBProfile()...)
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count; i++ {
+		entry := profile[132+i*12:]
+		if string(entry[:4]) == "rXYZ" {
+			offset := int(binary.BigEndian.Uint32(entry[4:]))
+			binary.BigEndian.PutUint32(profile[offset+8:], 33758)
+			binary.BigEndian.PutUint32(profile[offset+12:], 15807)
+		}
+	}
+
+	return profile
+}
+
+func TestFileSystem_ConvertImageToSRGB(t *testing.T) {
+	a := assert.New(t)
+	fs := &FileSystem{User: &model.User{}, Handler: local.Driver{}}
+	source := "tests/convert_srgb.jpg"
+	a.NoError(os.MkdirAll(util.RelativePath("tests"), 0744))
+	defer os.Remove(util.RelativePath(source))
+
+	// 不支持的格式
+	{
+		converted, err := fs.ConvertImageToSRGB(context.Background(), &model.File{Name: "1.gif", SourceName: source})
+		a.NoError(err)
+		a.False(converted)
+	}
+
+	// 已是 sRGB
+	{
+		a.NoError(os.WriteFile(util.RelativePath(source), jpegWithProfile(t, thumb.SRGBProfile()), 0644))
+		converted, err := fs.ConvertImageToSRGB(context.Background(), &model.File{Name: "1.jpg", SourceName: source})
+		a.NoError(err)
+		a.False(converted)
+	}
+
+	// 转换成功
+	{
+		a.NoError(os.WriteFile(util.RelativePath(source), jpegWithProfile(t, wideGamutProfile()), 0644))
+		file := &model.File{Name: "1.jpg", SourceName: source, Size: 10, MD5: "origin"}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)md5(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		converted, err := fs.ConvertImageToSRGB(context.Background(), file)
+		a.NoError(err)
+		a.True(converted)
+		a.NoError(mock.ExpectationsWereMet())
+		a.NotEqual("origin", file.MD5)
+
+		stat, err := os.Stat(util.RelativePath(source))
+		a.NoError(err)
+		a.EqualValues(stat.Size(), file.Size)
+
+		// 再次转换时已是 sRGB
+		converted, err = fs.ConvertImageToSRGB(context.Background(), file)
+		a.NoError(err)
+		a.False(converted)
+	}
+}
+
+func TestHookConvertImageToSRGB(t *testing.T) {
+	a := assert.New(t)
+	fs := &FileSystem{User: &model.User{}, Handler: local.Driver{}, Policy: &model.Policy{}}
+	file := &fsctx.FileStream{Model: &model.File{Name: "1.jpg", SourceName: "tests/not_exist.jpg"}}
+
+	// 未开启
+	a.NoError(HookConvertImageToSRGB(context.Background(), fs, file))
+
+	// 转换失败时保留原图
+	fs.Policy.OptionsSerialized.ConvertOriginalToSRGB = true
+	a.NoError(HookConvertImageToSRGB(context.Background(), fs, file))
+}
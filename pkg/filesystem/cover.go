@@ -0,0 +1,118 @@
+package filesystem
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/hashid"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+)
+
+// IsFolderCoverCandidate 返回文件是否可作为目录封面
+func IsFolderCoverCandidate(name string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	return ext != "" && util.ContainsString(folderTypePresets[model.FolderTypeImages], ext)
+}
+
+// isFolderCoverAutoEnabled 返回是否自动以最新上传的图像作为目录封面
+func isFolderCoverAutoEnabled() bool {
+	return model.IsTrueVal(model.GetSettingByName("folder_cover_auto"))
+}
+
+// folderCoverURL 返回封面文件的缩略图地址
+func folderCoverURL(fileID uint) string {
+	return path.Join("/api/v3/file/thumb", hashid.HashID(fileID, hashid.FileID))
+}
+
+// HookUpdateFolderCover 上传图像后将其设为所在目录的封面，已手动指定封面的目录不受影响。
+// 封面更新失败不影响上传结果
+func HookUpdateFolderCover(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	file, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || !isFolderCoverAutoEnabled() || !IsFolderCoverCandidate(file.Name) {
+		return nil
+	}
+
+	folders, err := model.GetFoldersByIDs([]uint{file.FolderID}, file.UserID)
+	if err != nil || len(folders) == 0 || folders[0].CoverPinned {
+		return nil
+	}
+
+	if err := folders[0].SetCover(&file.ID, false); err != nil {
+		util.Log().Warning("Failed to update cover of folder %q: %s", folders[0].Name, err)
+	}
+
+	return nil
+}
+
+// RefreshFolderCover 以目录中最新上传的图像作为封面，未开启自动封面或目录中没有图像时清除封面
+func RefreshFolderCover(folder *model.Folder) error {
+	if !isFolderCoverAutoEnabled() {
+		return folder.SetCover(nil, false)
+	}
+
+	cover, err := folder.GetLatestFileByExts(folderTypePresets[model.FolderTypeImages])
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return folder.SetCover(nil, false)
+		}
+		return err
+	}
+
+	return folder.SetCover(&cover.ID, false)
+}
+
+// refreshDeletedCovers 为以已删除文件为封面的目录重新选择封面
+func refreshDeletedCovers(fileIDs []uint) {
+	if len(fileIDs) == 0 {
+		return
+	}
+
+	folders, err := model.GetFoldersByCoverIDs(fileIDs)
+	if err != nil {
+		util.Log().Warning("Failed to list folders with deleted covers: %s", err)
+		return
+	}
+
+	for i := range folders {
+		if err := RefreshFolderCover(&folders[i]); err != nil {
+			util.Log().Warning("Failed to refresh cover of folder %q: %s", folders[i].Name, err)
+		}
+	}
+}
+
+// setFolderCovers 为目录列表设置封面的缩略图地址，封面文件已移出目录时忽略
+func (fs *FileSystem) setFolderCovers(folders []model.Folder, objects []serializer.Object) {
+	coverIDs := make([]uint, 0, len(folders))
+	for _, folder := range folders {
+		if folder.CoverID != nil {
+			coverIDs = append(coverIDs, *folder.CoverID)
+		}
+	}
+
+	if len(coverIDs) == 0 {
+		return
+	}
+
+	covers, err := model.GetFilesByIDs(coverIDs, fs.User.ID)
+	if err != nil {
+		util.Log().Warning("Failed to get folder covers: %s", err)
+		return
+	}
+
+	coverFolders := make(map[uint]uint, len(covers))
+	for _, cover := range covers {
+		coverFolders[cover.ID] = cover.FolderID
+	}
+
+	for i, folder := range folders {
+		if folder.CoverID != nil && coverFolders[*folder.CoverID] == folder.ID {
+			objects[i].Cover = folderCoverURL(*folder.CoverID)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/hashid"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFolderCoverCandidate(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(IsFolderCoverCandidate("1.JPG"))
+	asserts.True(IsFolderCoverCandidate("1.webp"))
+	asserts.False(IsFolderCoverCandidate("1.txt"))
+	asserts.False(IsFolderCoverCandidate("jpg"))
+}
+
+func TestHookUpdateFolderCover(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_folder_cover_auto", "1", 0)
+	fs := &FileSystem{User: &model.User{}}
+	image := &model.File{Model: gorm.Model{ID: 2}, Name: "1.png", FolderID: 1, UserID: 1}
+
+	// 非图像
+	{
+		file := &fsctx.FileStream{Model: &model.File{Name: "1.txt"}}
+		asserts.NoError(HookUpdateFolderCover(context.Background(), fs, file))
+	}
+
+	// 已手动指定封面
+	{
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "cover_pinned"}).AddRow(1, true))
+		asserts.NoError(HookUpdateFolderCover(context.Background(), fs, &fsctx.FileStream{Model: image}))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 更新封面
+	{
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)cover_id(.+)").WithArgs(&image.ID, false, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(HookUpdateFolderCover(context.Background(), fs, &fsctx.FileStream{Model: image}))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 未开启
+	{
+		cache.Set("setting_folder_cover_auto", "0", 0)
+		asserts.NoError(HookUpdateFolderCover(context.Background(), fs, &fsctx.FileStream{Model: image}))
+		cache.Set("setting_folder_cover_auto", "1", 0)
+	}
+}
+
+func TestRefreshFolderCover(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_folder_cover_auto", "1", 0)
+
+	// 选择最新的图像
+	{
+		folder := &model.Folder{Model: gorm.Model{ID: 1}, CoverPinned: true}
+		coverID := uint(3)
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "1.png"))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)cover_id(.+)").WithArgs(&coverID, false, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(RefreshFolderCover(folder))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.EqualValues(3, *folder.CoverID)
+		asserts.False(folder.CoverPinned)
+	}
+
+	// 没有图像
+	{
+		folder := &model.Folder{Model: gorm.Model{ID: 1}}
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)cover_id(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(RefreshFolderCover(folder))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Nil(folder.CoverID)
+	}
+
+	// 查询失败
+	{
+		folder := &model.Folder{Model: gorm.Model{ID: 1}}
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnError(errors.New("error"))
+		asserts.Error(RefreshFolderCover(folder))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
+
+func TestFileSystem_SetFolderCovers(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+	coverID, movedID := uint(3), uint(4)
+	folders := []model.Folder{
+		{Model: gorm.Model{ID: 1}, CoverID: &coverID},
+		{Model: gorm.Model{ID: 2}, CoverID: &movedID},
+		{Model: gorm.Model{ID: 5}},
+	}
+	objects := make([]serializer.Object, len(folders))
+
+	mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(3, 4, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "folder_id"}).AddRow(3, 1).AddRow(4, 6))
+	fs.setFolderCovers(folders, objects)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal("/api/v3/file/thumb/"+hashid.HashID(3, hashid.FileID), objects[0].Cover)
+	asserts.Empty(objects[1].Cover)
+	asserts.Empty(objects[2].Cover)
+}
@@ -0,0 +1,159 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 单文件一致性诊断
+   ================
+*/
+
+// 诊断发现的问题
+const (
+	// DiagnosisStatUnsupported 存储策略适配器不支持查询单个对象，无法诊断
+	DiagnosisStatUnsupported = "stat_unsupported"
+	// DiagnosisSourceMissing 存储端对象不存在
+	DiagnosisSourceMissing = "source_missing"
+	// DiagnosisSizeMismatch 记录的大小与存储端对象不一致
+	DiagnosisSizeMismatch = "size_mismatch"
+	// DiagnosisHashMismatch 记录的 MD5 与存储端对象内容不一致
+	DiagnosisHashMismatch = "hash_mismatch"
+)
+
+// 可执行的修复操作
+const (
+	// RepairFixSize 将记录的大小更正为存储端对象的大小，并同步调整用户已用容量
+	RepairFixSize = "fix_size"
+	// RepairMarkBroken 将文件标记为存储端对象已丢失
+	RepairMarkBroken = "mark_broken"
+	// RepairDeleteRecord 删除存储端对象已不存在的文件记录并归还容量
+	RepairDeleteRecord = "delete_record"
+)
+
+// ErrRepairNotApplicable 诊断结果中没有可通过此操作修复的问题
+var ErrRepairNotApplicable = serializer.NewError(serializer.CodeParamErr, "Repair action is not applicable to this file", nil)
+
+// FileDiagnosis 单个文件记录与存储端对象的一致性诊断报告
+type FileDiagnosis struct {
+	FileID       uint     `json:"file_id"`
+	Name         string   `json:"name"`
+	PolicyID     uint     `json:"policy_id"`
+	SourceName   string   `json:"source_name"`
+	Broken       bool     `json:"broken"`
+	Exists       bool     `json:"exists"`
+	RecordedSize uint64   `json:"recorded_size"`
+	StoredSize   uint64   `json:"stored_size"`
+	HashChecked  bool     `json:"hash_checked"`
+	RecordedHash string   `json:"recorded_hash,omitempty"`
+	StoredHash   string   `json:"stored_hash,omitempty"`
+	Issues       []string `json:"issues"`
+	Repairs      []string `json:"repairs"`
+	Repaired     string   `json:"repaired,omitempty"`
+}
+
+// Consistent 返回文件记录与存储端对象是否一致
+func (d *FileDiagnosis) Consistent() bool {
+	return len(d.Issues) == 0
+}
+
+// CanRepair 返回诊断结果是否允许执行修复操作 action
+func (d *FileDiagnosis) CanRepair(action string) bool {
+	return util.ContainsString(d.Repairs, action)
+}
+
+// DiagnoseFile 通过存储端查询核对文件记录，检查对象是否存在、大小是否一致，
+// verifyHash 为 true 且记录了 MD5 时回读对象校验内容，返回发现的问题及可执行的修复操作
+func (fs *FileSystem) DiagnoseFile(ctx context.Context, file *model.File, verifyHash bool) (*FileDiagnosis, error) {
+	report := &FileDiagnosis{
+		FileID:       file.ID,
+		Name:         file.Name,
+		PolicyID:     file.PolicyID,
+		SourceName:   file.SourceName,
+		Broken:       file.SourceBroken,
+		RecordedSize: file.Size,
+		RecordedHash: file.MD5,
+		Issues:       []string{},
+		Repairs:      []string{},
+	}
+
+	fs.Policy = file.GetPolicy()
+	if err := fs.DispatchHandler(); err != nil {
+		return nil, ErrUnknownPolicyType.WithError(err)
+	}
+
+	object, err := fs.statObject(ctx, file)
+	switch {
+	case errors.Is(err, driver.ErrStatNotSupported):
+		report.Issues = append(report.Issues, DiagnosisStatUnsupported)
+		return report, nil
+	case errors.Is(err, driver.ErrObjectMissing):
+		report.Issues = append(report.Issues, DiagnosisSourceMissing)
+		if !file.SourceBroken {
+			report.Repairs = append(report.Repairs, RepairMarkBroken)
+		}
+		report.Repairs = append(report.Repairs, RepairDeleteRecord)
+		return report, nil
+	case err != nil:
+		return nil, ErrIO.WithError(err)
+	}
+
+	report.Exists = true
+	report.StoredSize = object.Size
+	if object.Size != file.Size {
+		report.Issues = append(report.Issues, DiagnosisSizeMismatch)
+		report.Repairs = append(report.Repairs, RepairFixSize)
+	}
+
+	if verifyHash && file.MD5 != "" {
+		digest, err := fs.md5File(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+
+		report.HashChecked = true
+		report.StoredHash = digest
+		if !strings.EqualFold(digest, file.MD5) {
+			report.Issues = append(report.Issues, DiagnosisHashMismatch)
+			if !file.SourceBroken {
+				report.Repairs = append(report.Repairs, RepairMarkBroken)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// RepairFile 对诊断过的文件执行修复操作，操作须在诊断结果给出的可执行操作中
+func (fs *FileSystem) RepairFile(ctx context.Context, file *model.File, report *FileDiagnosis, action string) error {
+	if !report.CanRepair(action) {
+		return ErrRepairNotApplicable.WithData(action)
+	}
+
+	switch action {
+	case RepairFixSize:
+		if err := file.UpdateSize(report.StoredSize); err != nil {
+			return ErrDBUpdateObjects.WithError(err)
+		}
+	case RepairMarkBroken:
+		if err := file.UpdateSourceBroken(true); err != nil {
+			return ErrDBUpdateObjects.WithError(err)
+		}
+	case RepairDeleteRecord:
+		if err := model.DeleteFiles([]*model.File{file}, file.UserID); err != nil {
+			return ErrDBDeleteObjects.WithError(err)
+		}
+		model.DeleteShareBySourceIDs([]uint{file.ID}, false)
+	}
+
+	util.Log().Info("File #%d (%q) repaired by %q.", file.ID, file.Name, action)
+	report.Repaired = action
+	return nil
+}
@@ -0,0 +1,118 @@
+package filesystem
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem_DiagnoseFile(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("policy_91", model.Policy{Type: "mock"}, -1)
+	defer cache.Deletes([]string{"91"}, "policy_")
+
+	handler := newMemoryDriver()
+	handler.objects["1.txt"] = []byte("content")
+	fs := &FileSystem{User: &model.User{}, Handler: handler}
+
+	// 一致
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.txt", SourceName: "1.txt", Size: 7, PolicyID: 91,
+			MD5: "9a0364b9e99bb480dd25e1f0284c8555"}
+		report, err := fs.DiagnoseFile(context.Background(), file, true)
+		asserts.NoError(err)
+		asserts.True(report.Exists)
+		asserts.True(report.HashChecked)
+		asserts.True(report.Consistent())
+		asserts.Empty(report.Repairs)
+	}
+
+	// 大小与内容均不一致
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.txt", SourceName: "1.txt", Size: 10, PolicyID: 91, MD5: "wrong"}
+		report, err := fs.DiagnoseFile(context.Background(), file, true)
+		asserts.NoError(err)
+		asserts.EqualValues(7, report.StoredSize)
+		asserts.Equal([]string{DiagnosisSizeMismatch, DiagnosisHashMismatch}, report.Issues)
+		asserts.Equal([]string{RepairFixSize, RepairMarkBroken}, report.Repairs)
+
+		// 未要求校验内容
+		report, err = fs.DiagnoseFile(context.Background(), file, false)
+		asserts.NoError(err)
+		asserts.False(report.HashChecked)
+		asserts.Equal([]string{DiagnosisSizeMismatch}, report.Issues)
+	}
+
+	// 存储端对象不存在
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "2.txt", SourceName: "2.txt", PolicyID: 91}
+		report, err := fs.DiagnoseFile(context.Background(), file, true)
+		asserts.NoError(err)
+		asserts.False(report.Exists)
+		asserts.Equal([]string{DiagnosisSourceMissing}, report.Issues)
+		asserts.Equal([]string{RepairMarkBroken, RepairDeleteRecord}, report.Repairs)
+
+		// 已标记丢失
+		file.SourceBroken = true
+		report, err = fs.DiagnoseFile(context.Background(), file, true)
+		asserts.NoError(err)
+		asserts.Equal([]string{RepairDeleteRecord}, report.Repairs)
+	}
+
+	// 适配器不支持查询
+	{
+		fs := &FileSystem{User: &model.User{}, Handler: &FileHeaderMock{}}
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.txt", SourceName: "1.txt", PolicyID: 91}
+		report, err := fs.DiagnoseFile(context.Background(), file, true)
+		asserts.NoError(err)
+		asserts.Equal([]string{DiagnosisStatUnsupported}, report.Issues)
+		asserts.Empty(report.Repairs)
+	}
+}
+
+func TestFileSystem_RepairFile(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+
+	// 不适用的操作
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}}
+		report := &FileDiagnosis{Repairs: []string{RepairMarkBroken}}
+		err := fs.RepairFile(context.Background(), file, report, RepairDeleteRecord)
+		asserts.Equal(ErrRepairNotApplicable.Code, err.(serializer.AppError).Code)
+		asserts.Empty(report.Repaired)
+	}
+
+	// 标记丢失
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}}
+		report := &FileDiagnosis{Repairs: []string{RepairMarkBroken}}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)source_broken(.+)").WithArgs(true, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.RepairFile(context.Background(), file, report, RepairMarkBroken))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.True(file.SourceBroken)
+		asserts.Equal(RepairMarkBroken, report.Repaired)
+	}
+
+	// 更正大小
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, Size: 10, UserID: 1}
+		report := &FileDiagnosis{StoredSize: 7, Repairs: []string{RepairFixSize}}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		err := fs.RepairFile(context.Background(), file, report, RepairFixSize)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(7, file.Size)
+	}
+}
@@ -0,0 +1,174 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/email"
+	"github.com/cloudreve/Cloudreve/v3/pkg/notify"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// 文件元数据中记录敏感数据扫描结果的键
+const (
+	// DLPMatchesMetadataKey 命中的规则名称，以逗号分隔
+	DLPMatchesMetadataKey = "dlp_matches"
+	// DLPSkippedMetadataKey 未扫描的原因
+	DLPSkippedMetadataKey = "dlp_skipped"
+)
+
+// 命中敏感数据规则后的处理方式
+const (
+	// DLPActionTag 仅在元数据中标记并通知
+	DLPActionTag = "tag"
+	// DLPActionQuarantine 标记后隔离文件
+	DLPActionQuarantine = "quarantine"
+)
+
+// 未扫描的原因
+const (
+	DLPSkippedOversized = "oversized"
+	DLPSkippedBinary    = "binary"
+)
+
+// dlpRule 一条敏感数据匹配规则
+type dlpRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// loadDLPRules 从 dlp_patterns 设置读取规则名称到正则表达式的 JSON 对象，按名称排序，
+// 忽略无法编译的规则
+func loadDLPRules() []dlpRule {
+	patterns := make(map[string]string)
+	if err := json.Unmarshal([]byte(model.GetSettingByName("dlp_patterns")), &patterns); err != nil {
+		util.Log().Warning("Failed to parse DLP patterns: %s", err)
+		return nil
+	}
+
+	rules := make([]dlpRule, 0, len(patterns))
+	for name, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			util.Log().Warning("Invalid DLP pattern %q: %s", name, err)
+			continue
+		}
+		rules = append(rules, dlpRule{Name: name, Pattern: re})
+	}
+
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// isDLPScanNeeded 返回是否需要扫描上传文件中的敏感数据
+func isDLPScanNeeded() bool {
+	return model.IsTrueVal(model.GetSettingByName("dlp_enabled"))
+}
+
+// dlpAction 返回命中规则后的处理方式
+func dlpAction() string {
+	if model.GetSettingByName("dlp_action") == DLPActionQuarantine {
+		return DLPActionQuarantine
+	}
+
+	return DLPActionTag
+}
+
+// ScanSensitiveData 扫描文件内容，返回命中的规则名称。超过 dlp_max_size 的文件及二进制文件
+// 不予扫描，原因记录在元数据中；命中规则时名称同样记录在元数据中
+func (fs *FileSystem) ScanSensitiveData(ctx context.Context, file *model.File) ([]string, error) {
+	limit := uint64(model.GetIntSetting("dlp_max_size", 4194304))
+	if file.Size > limit {
+		return nil, updateMetadataValue(file, DLPSkippedMetadataKey, DLPSkippedOversized)
+	}
+
+	source, err := fs.OpenObject(WithInternalRead(ctx), file)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	content, err := io.ReadAll(io.LimitReader(source, int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	head := content
+	if len(head) > binarySniffSize {
+		head = head[:binarySniffSize]
+	}
+	enc, bomLen := detectBOM(head)
+	if enc == "" && looksBinary(head) {
+		return nil, updateMetadataValue(file, DLPSkippedMetadataKey, DLPSkippedBinary)
+	}
+
+	if enc == "" {
+		enc = detectEncoding(content, false)
+	}
+	decoded, err := decodeText(content[bomLen:], enc)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]string, 0)
+	for _, rule := range loadDLPRules() {
+		if rule.Pattern.Match(decoded) {
+			matches = append(matches, rule.Name)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	return matches, updateMetadataValue(file, DLPMatchesMetadataKey, strings.Join(matches, ","))
+}
+
+// updateMetadataValue 保留已有元数据，写入 key 对应的值
+func updateMetadataValue(file *model.File, key, value string) error {
+	meta := make(map[string]string, len(file.MetadataSerialized)+1)
+	for k, v := range file.MetadataSerialized {
+		meta[k] = v
+	}
+	meta[key] = value
+	return file.UpdateMetadata(meta)
+}
+
+// HandleSensitiveData 扫描文件，命中规则时按 dlp_action 隔离文件或通知管理员
+func (fs *FileSystem) HandleSensitiveData(ctx context.Context, file *model.File) error {
+	matches, err := fs.ScanSensitiveData(ctx, file)
+	if err != nil || len(matches) == 0 {
+		return err
+	}
+
+	util.Log().Warning("File %q (#%d) of user #%d contains sensitive data: %s", file.Name, file.ID, file.UserID, strings.Join(matches, ","))
+	if dlpAction() == DLPActionQuarantine {
+		return fs.QuarantineFile(ctx, file, fmt.Sprintf("sensitive data detected (%s)", strings.Join(matches, ",")))
+	}
+
+	notifySensitiveData(fs.User, file, matches)
+	return nil
+}
+
+// notifySensitiveData 通知有文件含有敏感数据，默认发送给管理员
+func notifySensitiveData(owner *model.User, file *model.File, matches []string) {
+	title, body := email.NewSensitiveDataEmail(owner.Email, file.Name, strings.Join(matches, ", "))
+	user := *owner
+	notify.Send(&notify.Notification{
+		Event: notify.EventSensitiveData,
+		User:  &user,
+		Title: title,
+		Body:  body,
+		Data: map[string]interface{}{
+			"file_id": file.ID,
+			"name":    file.Name,
+			"matches": matches,
+		},
+	})
+}
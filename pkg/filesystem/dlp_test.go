@@ -0,0 +1,162 @@
+package filesystem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDLPPatterns = `{"credit_card":"\\b4\\d{3}[ -]?\\d{4}[ -]?\\d{4}[ -]?\\d{4}\\b","cn_id":"\\b\\d{17}[\\dXx]\\b","invalid":"("}`
+
+func TestLoadDLPRules(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 无法解析
+	{
+		cache.Set("setting_dlp_patterns", "[", 0)
+		asserts.Empty(loadDLPRules())
+	}
+
+	// 忽略无效规则，按名称排序
+	{
+		cache.Set("setting_dlp_patterns", testDLPPatterns, 0)
+		rules := loadDLPRules()
+		asserts.Len(rules, 2)
+		asserts.Equal("cn_id", rules[0].Name)
+		asserts.Equal("credit_card", rules[1].Name)
+	}
+}
+
+func TestFileSystem_ScanSensitiveData(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_dlp_patterns", testDLPPatterns, 0)
+	cache.Set("setting_dlp_max_size", "100", 0)
+	handler := newMemoryDriver()
+	handler.objects["clean.txt"] = []byte("nothing to see here")
+	handler.objects["card.txt"] = []byte("card: 4111 1111 1111 1111\nid: 11010519491231002X")
+	handler.objects["binary.bin"] = []byte{0, 1, 2, 3}
+	fs := &FileSystem{User: &model.User{}, Handler: handler}
+
+	// 文件过大
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: "card.txt", Size: 101}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		matches, err := fs.ScanSensitiveData(context.Background(), file)
+		asserts.NoError(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Empty(matches)
+		asserts.Equal(DLPSkippedOversized, file.MetadataSerialized[DLPSkippedMetadataKey])
+	}
+
+	// 二进制文件
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: "binary.bin", Size: 4}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		matches, err := fs.ScanSensitiveData(context.Background(), file)
+		asserts.NoError(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Empty(matches)
+		asserts.Equal(DLPSkippedBinary, file.MetadataSerialized[DLPSkippedMetadataKey])
+	}
+
+	// 未命中
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: "clean.txt", Size: 19}
+		matches, err := fs.ScanSensitiveData(context.Background(), file)
+		asserts.NoError(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Empty(matches)
+		asserts.Empty(file.MetadataSerialized)
+	}
+
+	// 命中，保留已有元数据
+	{
+		file := &model.File{
+			Model:              gorm.Model{ID: 1},
+			SourceName:         "card.txt",
+			Size:               49,
+			MetadataSerialized: map[string]string{"key": "value"},
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		matches, err := fs.ScanSensitiveData(context.Background(), file)
+		asserts.NoError(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal([]string{"cn_id", "credit_card"}, matches)
+		asserts.Equal("cn_id,credit_card", file.MetadataSerialized[DLPMatchesMetadataKey])
+		asserts.Equal("value", file.MetadataSerialized["key"])
+	}
+
+	// 无法读取
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: "missing.txt", Size: 1}
+		_, err := fs.ScanSensitiveData(context.Background(), file)
+		asserts.Error(err)
+	}
+}
+
+func TestHookScanSensitiveData(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_dlp_patterns", testDLPPatterns, 0)
+	cache.Set("setting_dlp_max_size", "100", 0)
+	cache.Set("setting_notify_sensitive_data_to", "", 0)
+	cache.Set("setting_quarantine_notify_admin", "0", 0)
+	handler := newMemoryDriver()
+	handler.objects["card.txt"] = []byte("4111-1111-1111-1111")
+	fs := &FileSystem{User: &model.User{}, Handler: handler}
+	defer cache.Set("setting_dlp_enabled", "0", 0)
+
+	// 未开启
+	{
+		cache.Set("setting_dlp_enabled", "0", 0)
+		asserts.NoError(HookScanSensitiveData(context.Background(), fs, &fsctx.FileStream{
+			Model: &model.File{SourceName: "card.txt"},
+		}))
+	}
+
+	cache.Set("setting_dlp_enabled", "1", 0)
+
+	// 仅标记，后台扫描
+	{
+		cache.Set("setting_dlp_action", DLPActionTag, 0)
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: "card.txt", Size: 19}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		waiter := &PostProcessWaiter{}
+		ctx := context.WithValue(context.Background(), fsctx.PostProcessWaiterCtx, waiter)
+		asserts.NoError(HookScanSensitiveData(ctx, fs, &fsctx.FileStream{Model: file}))
+		asserts.True(waiter.Wait(time.Second))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal("credit_card", file.MetadataSerialized[DLPMatchesMetadataKey])
+		asserts.False(file.IsQuarantined())
+	}
+
+	// 命中后隔离，同步完成
+	{
+		cache.Set("setting_dlp_action", DLPActionQuarantine, 0)
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: "card.txt", Size: 19, UserID: 1}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(HookScanSensitiveData(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.True(file.IsQuarantined())
+	}
+}
@@ -0,0 +1,138 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/docpreview"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// docPreviewSuffix PDF 预览衍生文件相对原文件物理路径的后缀
+const docPreviewSuffix = "._preview.pdf"
+
+var (
+	docPreviewWorkerOnce sync.Once
+	docPreviewWorker     chan struct{}
+)
+
+// getDocPreviewWorker 返回限制同时进行的文档转换数量的队列，容量由 doc_preview_max_task_count 设定
+func getDocPreviewWorker() chan struct{} {
+	docPreviewWorkerOnce.Do(func() {
+		maxWorker := model.GetIntSetting("doc_preview_max_task_count", 2)
+		if maxWorker <= 0 {
+			maxWorker = runtime.GOMAXPROCS(0)
+		}
+		docPreviewWorker = make(chan struct{}, maxWorker)
+		util.Log().Debug("Initialize document preview queue with: WorkerNum = %d", maxWorker)
+	})
+	return docPreviewWorker
+}
+
+// IsDocPreviewNeeded 返回是否需要为文件生成 PDF 预览
+func IsDocPreviewNeeded(name string) bool {
+	if !model.IsTrueVal(model.GetSettingByName("doc_preview_enabled")) {
+		return false
+	}
+
+	exts := strings.Split(strings.ToLower(model.GetSettingByName("doc_preview_exts")), ",")
+	for i := range exts {
+		exts[i] = strings.TrimSpace(exts[i])
+	}
+	return IsInExtensionList(exts, name)
+}
+
+// IsDocPreviewAvailable 返回 doc_preview_soffice 设定的 soffice 是否可用
+func IsDocPreviewAvailable() bool {
+	return docpreview.Available(model.GetSettingByName("doc_preview_soffice"))
+}
+
+// GenerateDocPreview 使用 soffice 将文档转换为 PDF，与原文件保存在同一存储策略下，作为预览使用的
+// 衍生文件。文件已有预览或 soffice 不可用时跳过，返回值表示是否跳过
+func (fs *FileSystem) GenerateDocPreview(ctx context.Context, file *model.File) (bool, error) {
+	if file.DocPreviewSource != "" {
+		return true, nil
+	}
+
+	soffice := model.GetSettingByName("doc_preview_soffice")
+	if !docpreview.Available(soffice) {
+		util.Log().Debug("soffice %q is not available, skip generating preview for %q", soffice, file.Name)
+		return true, nil
+	}
+
+	fs.Policy = file.GetPolicy()
+	if err := fs.DispatchHandler(); err != nil {
+		return false, err
+	}
+
+	// 排队等待的时间不计入转换超时
+	worker := getDocPreviewWorker()
+	select {
+	case worker <- struct{}{}:
+		defer func() { <-worker }()
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	timeout := time.Duration(model.GetIntSetting("doc_preview_convert_timeout", 300)) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tempDir := filepath.Join(
+		util.RelativePath(model.GetSettingByName("temp_path")),
+		"docpreview",
+		fmt.Sprintf("%d_%d", file.ID, time.Now().UnixNano()),
+	)
+	if err := os.MkdirAll(tempDir, 0700); err != nil {
+		return false, fmt.Errorf("failed to create temp folder: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	input := filepath.Join(tempDir, "input"+filepath.Ext(file.Name))
+	if err := fs.downloadToTemp(ctx, file.SourceName, input); err != nil {
+		return false, err
+	}
+
+	output, err := docpreview.ToPDF(ctx, soffice, input, tempDir)
+	if err != nil {
+		return false, err
+	}
+
+	out, err := os.Open(output)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+	stat, err := out.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	savePath := file.SourceName + docPreviewSuffix
+	if err := fs.Handler.Put(ctx, &fsctx.FileStream{
+		File:     out,
+		Seeker:   out,
+		Size:     uint64(stat.Size()),
+		Name:     filepath.Base(savePath),
+		MIMEType: "application/pdf",
+		SavePath: savePath,
+		Mode:     fsctx.Overwrite,
+	}); err != nil {
+		return false, fmt.Errorf("failed to save document preview: %w", err)
+	}
+
+	if err := file.UpdateDocPreviewSource(savePath); err != nil {
+		_, _ = fs.Handler.Delete(ctx, []string{savePath})
+		return false, ErrDBUpdateObjects.WithError(err)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,113 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDocPreviewNeeded(t *testing.T) {
+	asserts := assert.New(t)
+
+	cache.Set("setting_doc_preview_enabled", "0", 0)
+	cache.Set("setting_doc_preview_exts", "docx, PPTX", 0)
+	asserts.False(IsDocPreviewNeeded("1.docx"))
+
+	cache.Set("setting_doc_preview_enabled", "1", 0)
+	defer cache.Set("setting_doc_preview_enabled", "0", 0)
+	asserts.True(IsDocPreviewNeeded("1.docx"))
+	asserts.True(IsDocPreviewNeeded("1.pptx"))
+	asserts.False(IsDocPreviewNeeded("1.pdf"))
+	asserts.False(IsDocPreviewNeeded("docx"))
+}
+
+func TestFileSystem_GenerateDocPreview(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script is not supported")
+	}
+
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_temp_path", "temp", 0)
+	cache.Set("setting_doc_preview_convert_timeout", "60", 0)
+	cache.Set("setting_doc_preview_max_task_count", "1", 0)
+	newFile := func() *model.File {
+		return &model.File{
+			Model:      gorm.Model{ID: 1},
+			Name:       "report.docx",
+			SourceName: "TestFileSystem_GenerateDocPreview.docx",
+			Policy:     model.Policy{Model: gorm.Model{ID: 1}, Type: "local"},
+		}
+	}
+
+	// 已有预览
+	{
+		file := newFile()
+		file.DocPreviewSource = "preview.pdf"
+		skipped, err := fs.GenerateDocPreview(context.Background(), file)
+		asserts.True(skipped)
+		asserts.NoError(err)
+	}
+
+	// soffice 不可用
+	{
+		cache.Set("setting_doc_preview_soffice", "/nonexistent/soffice", 0)
+		skipped, err := fs.GenerateDocPreview(context.Background(), newFile())
+		asserts.True(skipped)
+		asserts.NoError(err)
+	}
+
+	soffice := filepath.Join(t.TempDir(), "soffice")
+	asserts.NoError(os.WriteFile(util.RelativePath("TestFileSystem_GenerateDocPreview.docx"), []byte("document"), 0644))
+	defer os.Remove(util.RelativePath("TestFileSystem_GenerateDocPreview.docx"))
+	cache.Set("setting_doc_preview_soffice", soffice, 0)
+
+	// 转换失败，不生成预览
+	{
+		asserts.NoError(os.WriteFile(soffice, []byte("#!/bin/sh\nexit 1\n"), 0755))
+		file := newFile()
+		skipped, err := fs.GenerateDocPreview(context.Background(), file)
+		asserts.False(skipped)
+		asserts.Error(err)
+		asserts.Empty(file.DocPreviewSource)
+		asserts.False(util.Exists(util.RelativePath(file.SourceName + docPreviewSuffix)))
+
+		// 临时文件已清理
+		entries, _ := os.ReadDir(filepath.Join(util.RelativePath("temp"), "docpreview"))
+		asserts.Len(entries, 0)
+	}
+
+	// 成功
+	{
+		asserts.NoError(os.WriteFile(soffice, []byte(`#!/bin/sh
+for last; do :; done
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--outdir" ]; then out="$2"; fi
+  shift
+done
+cp "$last" "$out/input.pdf"
+`), 0755))
+		file := newFile()
+		defer os.Remove(util.RelativePath(file.SourceName + docPreviewSuffix))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)doc_preview_source(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		skipped, err := fs.GenerateDocPreview(context.Background(), file)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.False(skipped)
+		asserts.NoError(err)
+		asserts.Equal("TestFileSystem_GenerateDocPreview.docx"+docPreviewSuffix, file.DocPreviewSource)
+		content, err := os.ReadFile(util.RelativePath(file.DocPreviewSource))
+		asserts.NoError(err)
+		asserts.Equal("document", string(content))
+	}
+}
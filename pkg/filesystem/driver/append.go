@@ -0,0 +1,14 @@
+package driver
+
+import (
+	"context"
+	"io"
+)
+
+// Appender 可在已有对象末尾原生追加内容的适配器，分片上传时每个分片只需写入本身的内容
+type Appender interface {
+	// Append 将 r 的内容写入 path 对象的 offset 处，对象不存在且 offset 为 0 时创建对象。
+	// 对象当前长度小于 offset 时返回错误；大于 offset（如重传分片）时，
+	// 可截断对象的适配器丢弃多余部分，否则返回错误
+	Append(ctx context.Context, path string, offset int64, r io.Reader) error
+}
@@ -0,0 +1,97 @@
+package driver
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteToCDN(t *testing.T) {
+	a := assert.New(t)
+	origin, _ := url.Parse("https://bucket.oss.com/dir/file.txt?Signature=123")
+
+	// 未配置 CDN
+	{
+		res, err := RewriteToCDN(origin, &model.Policy{}, 10)
+		a.NoError(err)
+		a.Equal(origin.String(), res.String())
+	}
+
+	// 仅替换域名，保留源站签名
+	{
+		res, err := RewriteToCDN(origin, &model.Policy{BaseURL: "http://cdn.com"}, 10)
+		a.NoError(err)
+		a.Equal("http://cdn.com/dir/file.txt?Signature=123", res.String())
+		a.Equal("https://bucket.oss.com/dir/file.txt?Signature=123", origin.String())
+	}
+
+	// A 类鉴权
+	{
+		policy := &model.Policy{
+			BaseURL: "https://cdn.com",
+			OptionsSerialized: model.PolicyOption{
+				CDNSignType: CDNSignTypeA,
+				CDNSignKey:  "key",
+			},
+		}
+		res, err := RewriteToCDN(origin, policy, 0)
+		a.NoError(err)
+		a.Equal("cdn.com", res.Host)
+		a.Empty(res.Query().Get("Signature"))
+		a.Len(strings.Split(res.Query().Get("auth_key"), "-"), 4)
+	}
+
+	// A 类鉴权保留缩略图、强制下载及限速参数
+	{
+		policy := &model.Policy{
+			BaseURL: "https://cdn.com",
+			OptionsSerialized: model.PolicyOption{
+				CDNSignType: CDNSignTypeA,
+				CDNSignKey:  "key",
+			},
+		}
+
+		// OSS 缩略图
+		thumb, _ := url.Parse("https://bucket.oss.com/a.jpg?Expires=1&OSSAccessKeyId=ak&Signature=sig&x-oss-process=image%2Fresize%2Cw_400&x-oss-traffic-limit=819200")
+		res, err := RewriteToCDN(thumb, policy, 10)
+		a.NoError(err)
+		a.True(strings.HasPrefix(res.RawQuery, "x-oss-process=image%2Fresize%2Cw_400&x-oss-traffic-limit=819200&auth_key="))
+		a.Empty(res.Query().Get("Signature"))
+		a.Empty(res.Query().Get("OSSAccessKeyId"))
+		a.Empty(res.Query().Get("Expires"))
+
+		// COS 缩略图
+		thumb, _ = url.Parse("https://bucket.cos.com/a.jpg?q-sign-algorithm=sha1&q-ak=ak&q-sign-time=1%3B2&q-key-time=1%3B2&q-header-list=&q-url-param-list=&q-signature=sig&imageMogr2/thumbnail/400x300")
+		res, err = RewriteToCDN(thumb, policy, 10)
+		a.NoError(err)
+		a.True(strings.HasPrefix(res.RawQuery, "imageMogr2/thumbnail/400x300&auth_key="))
+
+		// S3 强制下载
+		download, _ := url.Parse("https://bucket.s3.com/a.txt?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=ak&X-Amz-Date=1&X-Amz-Expires=10&X-Amz-SignedHeaders=host&X-Amz-Signature=sig&response-content-disposition=attachment%3B%20filename%3D%22a.txt%22")
+		res, err = RewriteToCDN(download, policy, 10)
+		a.NoError(err)
+		a.Equal(`attachment; filename="a.txt"`, res.Query().Get("response-content-disposition"))
+		a.Empty(res.Query().Get("X-Amz-Signature"))
+		a.Empty(res.Query().Get("X-Amz-Credential"))
+		a.Len(res.Query(), 2)
+	}
+
+	// 未知鉴权方式
+	{
+		policy := &model.Policy{
+			BaseURL:           "https://cdn.com",
+			OptionsSerialized: model.PolicyOption{CDNSignType: "unknown"},
+		}
+		_, err := RewriteToCDN(origin, policy, 0)
+		a.Error(err)
+	}
+
+	// CDN 地址无效
+	{
+		_, err := RewriteToCDN(origin, &model.Policy{BaseURL: string([]byte{0x7f})}, 0)
+		a.Error(err)
+	}
+}
@@ -0,0 +1,5 @@
+package driver
+
+// ServerChecksumMetadataKey 文件元数据中记录存储端已校验并保存的内容 SHA-256 的键。
+// 适配器仅在存储端确认校验值后写入，不支持的存储端不会有此项
+const ServerChecksumMetadataKey = "server_sha256"
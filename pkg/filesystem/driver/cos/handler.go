@@ -17,6 +17,7 @@ import (
 	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
@@ -319,10 +320,12 @@ func (handler Driver) signSourceURL(ctx context.Context, path string, ttl int64,
 	}
 
 	// 将最终生成的签名URL域名换成用户自定义的加速域名（如果有）
-	presignedURL.Host = cdnURL.Host
-	presignedURL.Scheme = cdnURL.Scheme
+	finalURL, err := driver.RewriteToCDN(presignedURL, handler.Policy, ttl)
+	if err != nil {
+		return "", err
+	}
 
-	return presignedURL.String(), nil
+	return finalURL.String(), nil
 }
 
 // Token 获取上传策略和认证Token
@@ -7,11 +7,14 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
@@ -33,6 +36,9 @@ func (handler Driver) List(ctx context.Context, path string, recursive bool) ([]
 
 	// 取得起始路径
 	root := util.RelativePath(filepath.FromSlash(path))
+	if err := handler.checkSymlink(root, symlinkMode()); err != nil {
+		return nil, err
+	}
 
 	// 开始遍历路径下的文件、目录
 	err := filepath.Walk(root,
@@ -73,10 +79,67 @@ func (handler Driver) List(ctx context.Context, path string, recursive bool) ([]
 	return res, err
 }
 
+// Walk 按目录逐层、名称顺序遍历 prefix 下的文件，marker 为上次遍历到的文件路径，
+// 早于 marker 且不包含 marker 的目录会被整体跳过
+func (handler Driver) Walk(ctx context.Context, prefix, marker string, fn driver.WalkFunc) error {
+	root := util.RelativePath(filepath.FromSlash(prefix))
+	if err := handler.checkSymlink(root, symlinkMode()); err != nil {
+		return err
+	}
+
+	return filepath.Walk(root,
+		func(fullPath string, info os.FileInfo, err error) error {
+			if fullPath == root {
+				return err
+			}
+
+			if err != nil {
+				util.Log().Warning("Failed to walk folder %q: %s", fullPath, err)
+				return filepath.SkipDir
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(root, fullPath)
+			if err != nil {
+				return err
+			}
+			source := path.Join(prefix, filepath.ToSlash(rel))
+
+			// 跳过已遍历过的部分
+			if marker != "" && driver.ComparePath(source, marker) <= 0 {
+				if info.IsDir() && !strings.HasPrefix(marker, source+"/") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			return fn(response.Object{
+				Name:         info.Name(),
+				RelativePath: filepath.ToSlash(rel),
+				Source:       source,
+				Size:         uint64(info.Size()),
+				LastModify:   info.ModTime(),
+			}, source)
+		})
+}
+
 // Get 获取文件内容
 func (handler Driver) Get(ctx context.Context, path string) (response.RSCloser, error) {
 	// 打开文件
-	file, err := os.Open(util.RelativePath(path))
+	filePath := util.RelativePath(path)
+	if err := handler.checkSymlink(filePath, symlinkMode()); err != nil {
+		util.Log().Warning("Refused to open file %q: %s", filePath, err)
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
 	if err != nil {
 		util.Log().Debug("Failed to open file: %s", err)
 		return nil, err
@@ -85,11 +148,44 @@ func (handler Driver) Get(ctx context.Context, path string) (response.RSCloser,
 	return file, nil
 }
 
+// Stat 获取文件信息
+func (handler Driver) Stat(ctx context.Context, path string) (*response.Object, error) {
+	filePath := util.RelativePath(path)
+	if err := handler.checkSymlink(filePath, symlinkMode()); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, driver.ErrObjectMissing
+		}
+		return nil, err
+	}
+
+	return &response.Object{
+		Name:       info.Name(),
+		Source:     path,
+		Size:       uint64(info.Size()),
+		IsDir:      info.IsDir(),
+		LastModify: info.ModTime(),
+	}, nil
+}
+
+// StreamingPut 上传内容直接写入本地文件，无需预先缓冲请求正文
+func (handler Driver) StreamingPut() bool {
+	return true
+}
+
 // Put 将文件流保存到指定目录
 func (handler Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 	defer file.Close()
 	fileInfo := file.Info()
 	dst := util.RelativePath(filepath.FromSlash(fileInfo.SavePath))
+	if err := handler.checkSymlink(dst, symlinkMode()); err != nil {
+		util.Log().Warning("Refused to write file %q: %s", dst, err)
+		return err
+	}
 
 	// 如果非 Overwrite，则检查是否有重名冲突
 	if fileInfo.Mode&fsctx.Overwrite != fsctx.Overwrite {
@@ -99,64 +195,84 @@ func (handler Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 		}
 	}
 
+	if fileInfo.Mode&fsctx.Append == fsctx.Append {
+		return handler.Append(ctx, fileInfo.SavePath, int64(fileInfo.AppendStart), file)
+	}
+
 	// 如果目标目录不存在，创建
-	basePath := filepath.Dir(dst)
-	if !util.Exists(basePath) {
-		err := os.MkdirAll(basePath, Perm)
-		if err != nil {
-			util.Log().Warning("Failed to create directory: %s", err)
-			return err
-		}
+	if err := createParentDir(dst); err != nil {
+		return err
 	}
 
-	var (
-		out *os.File
-		err error
-	)
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_RDWR|os.O_TRUNC, Perm)
+	if err != nil {
+		util.Log().Warning("Failed to open or create file: %s", err)
+		return err
+	}
+	defer out.Close()
 
-	openMode := os.O_CREATE | os.O_RDWR
-	if fileInfo.Mode&fsctx.Append == fsctx.Append {
-		openMode |= os.O_APPEND
-	} else {
-		openMode |= os.O_TRUNC
+	// 写入文件内容
+	_, err = io.Copy(out, file)
+	return err
+}
+
+// Append 将 r 的内容写入文件的 offset 处，文件中 offset 之后已有的内容（重传的分片）将被截断
+func (handler Driver) Append(ctx context.Context, path string, offset int64, r io.Reader) error {
+	dst := util.RelativePath(filepath.FromSlash(path))
+	if err := handler.checkSymlink(dst, symlinkMode()); err != nil {
+		util.Log().Warning("Refused to write file %q: %s", dst, err)
+		return err
+	}
+
+	if err := createParentDir(dst); err != nil {
+		return err
 	}
 
-	out, err = os.OpenFile(dst, openMode, Perm)
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, Perm)
 	if err != nil {
 		util.Log().Warning("Failed to open or create file: %s", err)
 		return err
 	}
 	defer out.Close()
 
-	if fileInfo.Mode&fsctx.Append == fsctx.Append {
-		stat, err := out.Stat()
-		if err != nil {
-			util.Log().Warning("Failed to read file info: %s", err)
-			return err
-		}
-
-		if uint64(stat.Size()) < fileInfo.AppendStart {
-			return errors.New("size of unfinished uploaded chunks is not as expected")
-		} else if uint64(stat.Size()) > fileInfo.AppendStart {
-			out.Close()
-			if err := handler.Truncate(ctx, dst, fileInfo.AppendStart); err != nil {
-				return fmt.Errorf("failed to overwrite chunk: %w", err)
-			}
+	stat, err := out.Stat()
+	if err != nil {
+		util.Log().Warning("Failed to read file info: %s", err)
+		return err
+	}
 
-			out, err = os.OpenFile(dst, openMode, Perm)
-			defer out.Close()
-			if err != nil {
-				util.Log().Warning("Failed to create or open file: %s", err)
-				return err
-			}
+	if stat.Size() < offset {
+		return errors.New("size of unfinished uploaded chunks is not as expected")
+	} else if stat.Size() > offset {
+		util.Log().Warning("Truncate file %q to [%d].", dst, offset)
+		if err := out.Truncate(offset); err != nil {
+			return fmt.Errorf("failed to overwrite chunk: %w", err)
 		}
 	}
 
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
 	// 写入文件内容
-	_, err = io.Copy(out, file)
+	_, err = io.Copy(out, r)
 	return err
 }
 
+// createParentDir 目标文件所在目录不存在时创建
+func createParentDir(dst string) error {
+	basePath := filepath.Dir(dst)
+	if !util.Exists(basePath) {
+		err := os.MkdirAll(basePath, Perm)
+		if err != nil {
+			util.Log().Warning("Failed to create directory: %s", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (handler Driver) Truncate(ctx context.Context, src string, size uint64) error {
 	util.Log().Warning("Truncate file %q to [%d].", src, size)
 	out, err := os.OpenFile(src, os.O_WRONLY, Perm)
@@ -175,8 +291,23 @@ func (handler Driver) Delete(ctx context.Context, files []string) ([]string, err
 	deleteFailed := make([]string, 0, len(files))
 	var retErr error
 
+	// 删除时至少不允许经由符号链接删除存储根目录外的文件
+	mode := symlinkMode()
+	if mode == SymlinkFollow {
+		mode = SymlinkRestrict
+	}
+
 	for _, value := range files {
 		filePath := util.RelativePath(filepath.FromSlash(value))
+
+		// 只校验父目录，符号链接本身可被直接删除
+		if err := handler.checkSymlink(filepath.Dir(filePath), mode); err != nil {
+			util.Log().Warning("Refused to delete file %q: %s", filePath, err)
+			retErr = err
+			deleteFailed = append(deleteFailed, value)
+			continue
+		}
+
 		if util.Exists(filePath) {
 			err := os.Remove(filePath)
 			if err != nil {
@@ -260,6 +391,13 @@ func (handler Driver) Source(
 		return "", serializer.NewError(serializer.CodeEncryptError, "Failed to sign url", err)
 	}
 
+	// 设有下载密码的文件，将解锁凭证附加到地址中，以便分段读取时继续使用
+	if token, ok := ctx.Value(fsctx.FileUnlockCtx).(string); ok && file.Password != "" {
+		queries := signedURI.Query()
+		queries.Set("unlock", token)
+		signedURI.RawQuery = queries.Encode()
+	}
+
 	finalURL := baseURL.ResolveReference(signedURI).String()
 	return finalURL, nil
 }
@@ -4,7 +4,10 @@ import (
 	"context"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/jinzhu/gorm"
@@ -12,6 +15,7 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -133,6 +137,26 @@ func TestHandler_Get(t *testing.T) {
 	asserts.Nil(rs)
 }
 
+func TestDriver_Stat(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{}
+
+	// 成功
+	file, err := os.Create(util.RelativePath("TestDriver_Stat.txt"))
+	asserts.NoError(err)
+	_, _ = file.WriteString("data")
+	_ = file.Close()
+
+	res, err := driver.Stat(context.Background(), handler, "TestDriver_Stat.txt")
+	asserts.NoError(err)
+	asserts.EqualValues(4, res.Size)
+	asserts.Equal("TestDriver_Stat.txt", res.Source)
+
+	// 文件不存在
+	_, err = driver.Stat(context.Background(), handler, "TestDriver_Stat_notExist.txt")
+	asserts.Equal(driver.ErrObjectMissing, err)
+}
+
 func TestHandler_Thumb(t *testing.T) {
 	asserts := assert.New(t)
 	handler := Driver{}
@@ -198,6 +222,26 @@ func TestHandler_Source(t *testing.T) {
 		asserts.Contains(sourceURL, "sign=")
 		asserts.Contains(sourceURL, "download")
 		asserts.Contains(sourceURL, "https://cloudreve.org")
+		asserts.NotContains(sourceURL, "unlock=")
+	}
+
+	// 设有下载密码，附加解锁凭证
+	{
+		file := model.File{
+			Model: gorm.Model{
+				ID: 1,
+			},
+			Name:     "test.jpg",
+			Password: "salt:digest",
+		}
+		ctx := context.WithValue(ctx, fsctx.FileModelCtx, file)
+		ctx = context.WithValue(ctx, fsctx.FileUnlockCtx, "token")
+		baseURL, err := url.Parse("https://cloudreve.org")
+		asserts.NoError(err)
+		sourceURL, err := handler.Source(ctx, "", *baseURL, 0, true, 0)
+		asserts.NoError(err)
+		asserts.Contains(sourceURL, "sign=")
+		asserts.Contains(sourceURL, "unlock=token")
 	}
 
 	// 无法获取上下文
@@ -336,3 +380,167 @@ func TestDriver_List(t *testing.T) {
 		asserts.Len(res, 7)
 	}
 }
+
+func TestDriver_Walk(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{}
+	ctx := context.Background()
+
+	for _, path := range []string{
+		"test/TestDriver_Walk/a.txt",
+		"test/TestDriver_Walk/a/1.txt",
+		"test/TestDriver_Walk/a/b/2.txt",
+		"test/TestDriver_Walk/c/3.txt",
+	} {
+		f, _ := util.CreatNestedFile(util.RelativePath(path))
+		f.Close()
+	}
+
+	walk := func(marker string) []string {
+		var res []string
+		err := handler.Walk(ctx, "test/TestDriver_Walk", marker, func(object response.Object, marker string) error {
+			asserts.Equal(object.Source, marker)
+			res = append(res, marker)
+			return nil
+		})
+		asserts.NoError(err)
+		return res
+	}
+
+	// 从头遍历
+	asserts.Equal([]string{
+		"test/TestDriver_Walk/a/1.txt",
+		"test/TestDriver_Walk/a/b/2.txt",
+		"test/TestDriver_Walk/a.txt",
+		"test/TestDriver_Walk/c/3.txt",
+	}, walk(""))
+
+	// 从检查点恢复
+	asserts.Equal([]string{
+		"test/TestDriver_Walk/a.txt",
+		"test/TestDriver_Walk/c/3.txt",
+	}, walk("test/TestDriver_Walk/a/b/2.txt"))
+
+	// 检查点对应的文件已被删除
+	asserts.Equal([]string{
+		"test/TestDriver_Walk/c/3.txt",
+	}, walk("test/TestDriver_Walk/b.txt"))
+
+	// 回调返回错误时中止
+	count := 0
+	err := handler.Walk(ctx, "test/TestDriver_Walk", "", func(object response.Object, marker string) error {
+		count++
+		return driver.ErrStopWalk
+	})
+	asserts.Equal(driver.ErrStopWalk, err)
+	asserts.Equal(1, count)
+
+	// 路径不存在
+	asserts.Error(handler.Walk(ctx, "test/TestDriver_Walk_not_exist", "", func(object response.Object, marker string) error {
+		return nil
+	}))
+}
+
+func TestDriver_Symlink(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{}
+
+	// 存储根目录外的文件
+	outside, err := os.MkdirTemp("", "TestDriver_Symlink")
+	asserts.NoError(err)
+	secret := filepath.Join(outside, "secret.txt")
+	asserts.NoError(os.WriteFile(secret, []byte("secret"), 0644))
+
+	// 存储根目录内的文件及符号链接
+	base := util.RelativePath("TestDriver_Symlink")
+	asserts.NoError(os.MkdirAll(filepath.Join(base, "real"), 0755))
+	asserts.NoError(os.WriteFile(filepath.Join(base, "real", "a.txt"), []byte("a"), 0644))
+	asserts.NoError(os.Symlink(outside, filepath.Join(base, "outside")))
+	asserts.NoError(os.Symlink(filepath.Join(base, "real"), filepath.Join(base, "inner")))
+
+	defer func() {
+		os.RemoveAll(base)
+		os.RemoveAll(outside)
+		cache.Deletes([]string{"local_symlink_policy"}, "setting_")
+	}()
+
+	// 限制模式
+	{
+		cache.Set("setting_local_symlink_policy", SymlinkRestrict, 0)
+		_, err := handler.Get(context.Background(), "TestDriver_Symlink/outside/secret.txt")
+		asserts.ErrorIs(err, ErrPathOutsideRoot)
+
+		file, err := handler.Get(context.Background(), "TestDriver_Symlink/inner/a.txt")
+		asserts.NoError(err)
+		file.Close()
+
+		err = handler.Put(context.Background(), &fsctx.FileStream{
+			SavePath: "TestDriver_Symlink/outside/new.txt",
+			File:     io.NopCloser(strings.NewReader("new")),
+		})
+		asserts.ErrorIs(err, ErrPathOutsideRoot)
+		asserts.False(util.Exists(filepath.Join(outside, "new.txt")))
+
+		_, err = handler.List(context.Background(), "TestDriver_Symlink/outside", false)
+		asserts.ErrorIs(err, ErrPathOutsideRoot)
+	}
+
+	// 禁止模式
+	{
+		cache.Set("setting_local_symlink_policy", SymlinkDeny, 0)
+		_, err := handler.Get(context.Background(), "TestDriver_Symlink/inner/a.txt")
+		asserts.ErrorIs(err, ErrSymlinkNotAllowed)
+
+		file, err := handler.Get(context.Background(), "TestDriver_Symlink/real/a.txt")
+		asserts.NoError(err)
+		file.Close()
+	}
+
+	// 跟随模式下读取不受限制，但删除仍不能经由符号链接
+	{
+		cache.Set("setting_local_symlink_policy", SymlinkFollow, 0)
+		file, err := handler.Get(context.Background(), "TestDriver_Symlink/outside/secret.txt")
+		asserts.NoError(err)
+		file.Close()
+
+		failed, err := handler.Delete(context.Background(), []string{"TestDriver_Symlink/outside/secret.txt"})
+		asserts.ErrorIs(err, ErrPathOutsideRoot)
+		asserts.Len(failed, 1)
+		asserts.True(util.Exists(secret))
+
+		// 删除符号链接本身不影响目标
+		failed, err = handler.Delete(context.Background(), []string{"TestDriver_Symlink/outside"})
+		asserts.NoError(err)
+		asserts.Empty(failed)
+		asserts.True(util.Exists(secret))
+
+		// 正常文件
+		failed, err = handler.Delete(context.Background(), []string{"TestDriver_Symlink/real/a.txt"})
+		asserts.NoError(err)
+		asserts.Empty(failed)
+		asserts.False(util.Exists(filepath.Join(base, "real", "a.txt")))
+	}
+}
+
+func TestDriver_Append(t *testing.T) {
+	a := assert.New(t)
+	h := Driver{}
+	defer os.Remove(util.RelativePath("inner/TestDriver_Append.txt"))
+
+	// 创建文件
+	a.NoError(h.Append(context.Background(), "inner/TestDriver_Append.txt", 0, strings.NewReader("123")))
+
+	// 追加
+	a.NoError(h.Append(context.Background(), "inner/TestDriver_Append.txt", 3, strings.NewReader("456")))
+
+	// 重传分片，截断已有内容
+	a.NoError(h.Append(context.Background(), "inner/TestDriver_Append.txt", 3, strings.NewReader("7")))
+	content, err := os.ReadFile(util.RelativePath("inner/TestDriver_Append.txt"))
+	a.NoError(err)
+	a.Equal("1237", string(content))
+
+	// 跳过分片
+	err = h.Append(context.Background(), "inner/TestDriver_Append.txt", 10, strings.NewReader("8"))
+	a.Error(err)
+	a.Contains(err.Error(), "size of unfinished uploaded chunks is not as expected")
+}
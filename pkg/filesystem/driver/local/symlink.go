@@ -0,0 +1,108 @@
+package local
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// 存储目录中符号链接的处理方式
+const (
+	// SymlinkFollow 不做限制，跟随所有符号链接
+	SymlinkFollow = "follow"
+	// SymlinkRestrict 允许跟随指向存储根目录内的符号链接
+	SymlinkRestrict = "restrict"
+	// SymlinkDeny 拒绝经由任何符号链接访问存储根目录内的文件
+	SymlinkDeny = "deny"
+)
+
+var (
+	// ErrPathOutsideRoot 路径经符号链接解析后位于存储根目录之外
+	ErrPathOutsideRoot = errors.New("path resolves outside of storage root")
+	// ErrSymlinkNotAllowed 路径中包含符号链接
+	ErrSymlinkNotAllowed = errors.New("symbolic link is not allowed")
+)
+
+// symlinkMode 返回设定的符号链接处理方式
+func symlinkMode() string {
+	return model.GetSettingByNameWithDefault("local_symlink_policy", SymlinkRestrict)
+}
+
+// root 返回存储策略的根目录，即存储路径规则中第一个变量之前的固定部分
+func (handler Driver) root() string {
+	rule := ""
+	if handler.Policy != nil {
+		rule = handler.Policy.DirNameRule
+	}
+
+	if i := strings.Index(rule, "{"); i >= 0 {
+		rule = rule[:strings.LastIndex(rule[:i], "/")+1]
+	}
+
+	return util.RelativePath(filepath.FromSlash(rule))
+}
+
+// checkSymlink 按照给定的处理方式，校验路径中位于存储根目录之下的各级符号链接。
+// 不在存储根目录下的路径（如从外部目录导入的文件）不做限制
+func (handler Driver) checkSymlink(path, mode string) error {
+	if mode == SymlinkFollow {
+		return nil
+	}
+
+	root := handler.root()
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+
+	// 根目录本身可以是管理员设定的符号链接
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		resolvedRoot = root
+	}
+
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." || part == "" {
+			continue
+		}
+
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			// 余下部分尚不存在，不会经过符号链接
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		if mode == SymlinkDeny {
+			return ErrSymlinkNotAllowed
+		}
+
+		target, err := filepath.EvalSymlinks(current)
+		if err != nil {
+			return err
+		}
+
+		if !isWithin(resolvedRoot, target) {
+			return ErrPathOutsideRoot
+		}
+	}
+
+	return nil
+}
+
+// isWithin 返回 path 是否位于 root 目录之下
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,26 @@
+package driver
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMultipartAborted 分片上传确定无法完成，已中止并清理已上传的分片
+var ErrMultipartAborted = errors.New("multipart upload cannot be completed and has been aborted")
+
+// MultipartETag 返回由 parts 组成的分片上传对象的 ETag，即各分片 MD5 拼接后的 MD5 加分片数
+func MultipartETag(parts []string) (string, error) {
+	hash := md5.New()
+	for i, part := range parts {
+		digest, err := hex.DecodeString(strings.Trim(part, `"`))
+		if err != nil || len(digest) != md5.Size {
+			return "", fmt.Errorf("invalid ETag %q of part #%d", part, i+1)
+		}
+		hash.Write(digest)
+	}
+
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(hash.Sum(nil)), len(parts)), nil
+}
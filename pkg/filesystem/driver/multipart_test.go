@@ -0,0 +1,24 @@
+package driver
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultipartETag(t *testing.T) {
+	asserts := assert.New(t)
+
+	part1 := md5.Sum([]byte("part1"))
+	part2 := md5.Sum([]byte("part2"))
+	composite := md5.Sum(append(part1[:], part2[:]...))
+
+	etag, err := MultipartETag([]string{`"` + hex.EncodeToString(part1[:]) + `"`, hex.EncodeToString(part2[:])})
+	asserts.NoError(err)
+	asserts.Equal(hex.EncodeToString(composite[:])+"-2", etag)
+
+	_, err = MultipartETag([]string{"not-a-md5"})
+	asserts.Error(err)
+}
@@ -57,7 +57,7 @@ func NewClient(policy *model.Policy) (*Client, error) {
 		ClientID:          policy.BucketName,
 		ClientSecret:      policy.SecretKey,
 		Redirect:          policy.OptionsSerialized.OdRedirect,
-		Request:           request.NewClient(),
+		Request:           request.NewClient(request.WithPolicyOutbound(policy)),
 		ClusterController: cluster.DefaultController,
 	}
 
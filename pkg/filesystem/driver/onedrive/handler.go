@@ -36,7 +36,7 @@ func NewDriver(policy *model.Policy) (driver.Handler, error) {
 	return Driver{
 		Policy:     policy,
 		Client:     client,
-		HTTPClient: request.NewClient(),
+		HTTPClient: request.NewClient(request.WithPolicyOutbound(policy)),
 	}, err
 }
 
@@ -122,6 +122,11 @@ func (handler Driver) Get(ctx context.Context, path string) (response.RSCloser,
 	return resp, nil
 }
 
+// StreamingPut 上传内容按分片大小缓冲后上传，无需预先缓冲请求正文
+func (handler Driver) StreamingPut() bool {
+	return true
+}
+
 // Put 将文件流保存到指定目录
 func (handler Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 	defer file.Close()
@@ -7,9 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +20,7 @@ import (
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/chunk"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/chunk/backoff"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
@@ -63,7 +67,7 @@ func NewDriver(policy *model.Policy) (*Driver, error) {
 
 	driver := &Driver{
 		Policy:     policy,
-		HTTPClient: request.NewClient(),
+		HTTPClient: request.NewClient(request.WithPolicyOutbound(policy)),
 	}
 
 	return driver, driver.InitOSSClient(false)
@@ -100,8 +104,18 @@ func (handler *Driver) InitOSSClient(forceUsePublicEndpoint bool) error {
 		endpoint = handler.Policy.OptionsSerialized.ServerSideEndpoint
 	}
 
+	// 使用存储策略的出站代理与附加请求头
+	options := make([]oss.ClientOption, 0)
+	httpClient, err := request.NewOutboundHTTPClient(handler.Policy)
+	if err != nil {
+		return err
+	}
+	if httpClient != nil {
+		options = append(options, oss.HTTPClient(httpClient))
+	}
+
 	// 初始化客户端
-	client, err := oss.New(endpoint, handler.Policy.AccessKey, handler.Policy.SecretKey)
+	client, err := oss.New(endpoint, handler.Policy.AccessKey, handler.Policy.SecretKey, options...)
 	if err != nil {
 		return err
 	}
@@ -184,6 +198,31 @@ func (handler *Driver) List(ctx context.Context, base string, recursive bool) ([
 	return res, nil
 }
 
+// Stat 获取文件信息
+func (handler *Driver) Stat(ctx context.Context, path string) (*response.Object, error) {
+	header, err := handler.bucket.GetObjectMeta(path)
+	if err != nil {
+		var srvErr oss.ServiceError
+		if errors.As(err, &srvErr) && srvErr.StatusCode == 404 {
+			return nil, driver.ErrObjectMissing
+		}
+		return nil, err
+	}
+
+	object := &response.Object{
+		Name:   filepath.Base(path),
+		Source: path,
+	}
+	if size, err := strconv.ParseUint(header.Get(oss.HTTPHeaderContentLength), 10, 64); err == nil {
+		object.Size = size
+	}
+	if modified, err := http.ParseTime(header.Get(oss.HTTPHeaderLastModified)); err == nil {
+		object.LastModify = modified
+	}
+
+	return object, nil
+}
+
 // Get 获取文件
 func (handler *Driver) Get(ctx context.Context, path string) (response.RSCloser, error) {
 	// 通过VersionID禁止缓存
@@ -227,6 +266,11 @@ func (handler *Driver) Get(ctx context.Context, path string) (response.RSCloser,
 	return resp, nil
 }
 
+// StreamingPut 上传内容按分片大小缓冲后上传，无需预先缓冲请求正文
+func (handler *Driver) StreamingPut() bool {
+	return true
+}
+
 // Put 将文件流保存到指定目录
 func (handler *Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 	defer file.Close()
@@ -241,6 +285,12 @@ func (handler *Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 		oss.Expires(time.Now().Add(time.Duration(credentialTTL) * time.Second)),
 		oss.ForbidOverWrite(!overwrite),
 	}
+	if class := handler.storageClass(fileInfo); class != "" {
+		options = append(options, oss.ObjectStorageClass(oss.StorageClassType(class)))
+	}
+	if len(fileInfo.Tags) > 0 {
+		options = append(options, oss.SetTagging(objectTagging(fileInfo.Tags)))
+	}
 
 	// 小文件直接上传
 	if fileInfo.Size < MultiPartUploadThreshold {
@@ -269,8 +319,54 @@ func (handler *Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 		}
 	}
 
-	_, err = handler.bucket.CompleteMultipartUpload(imur, oss.CompleteAll("yes"), oss.ForbidOverWrite(!overwrite))
-	return err
+	return handler.completeMultipart(imur, overwrite, fileInfo.Size)
+}
+
+// completeMultipart 完成分片上传，失败时按 multipart_complete_retries 重试。
+// 此前的请求可能已生效但响应丢失，存储端返回 NoSuchUpload 且对象大小一致时视为成功；
+// 重试用尽后中止分片上传并清理已上传的分片
+func (handler *Driver) completeMultipart(imur oss.InitiateMultipartUploadResult, overwrite bool, size uint64) error {
+	retry := &backoff.ConstantBackoff{
+		Max:   model.GetIntSetting("multipart_complete_retries", 3),
+		Sleep: chunkRetrySleep,
+	}
+
+	for {
+		_, err := handler.bucket.CompleteMultipartUpload(imur, oss.CompleteAll("yes"), oss.ForbidOverWrite(!overwrite))
+		if err == nil {
+			return nil
+		}
+
+		var srvErr oss.ServiceError
+		if errors.As(err, &srvErr) && srvErr.Code == "NoSuchUpload" {
+			if object, statErr := handler.Stat(context.Background(), imur.Key); statErr == nil && object.Size == size {
+				return nil
+			}
+		}
+
+		if !retry.Next(err) {
+			if abortErr := handler.bucket.AbortMultipartUpload(imur); abortErr != nil {
+				util.Log().Warning("Failed to abort multipart upload %q: %s", imur.UploadID, abortErr)
+			}
+			return fmt.Errorf("failed to complete multipart upload: %w", err)
+		}
+	}
+}
+
+// Append 使用追加上传写入 offset 处的内容。只有以追加上传创建的对象可继续追加，
+// OSS 不支持截断对象，offset 与对象当前长度不一致时返回错误；offset 为 0 时重新创建对象
+func (handler *Driver) Append(ctx context.Context, path string, offset int64, r io.Reader) error {
+	if offset == 0 {
+		if err := handler.bucket.DeleteObject(path); err != nil {
+			return fmt.Errorf("failed to reset object before append: %w", err)
+		}
+	}
+
+	if _, err := handler.bucket.AppendObject(path, r, offset); err != nil {
+		return fmt.Errorf("failed to append object: %w", err)
+	}
+
+	return nil
 }
 
 // Delete 删除一个或多个文件，
@@ -394,13 +490,9 @@ func (handler *Driver) signSourceURL(ctx context.Context, path string, ttl int64
 		finalURL.RawQuery = query.Encode()
 	}
 
-	if handler.Policy.BaseURL != "" {
-		cdnURL, err := url.Parse(handler.Policy.BaseURL)
-		if err != nil {
-			return "", err
-		}
-		finalURL.Host = cdnURL.Host
-		finalURL.Scheme = cdnURL.Scheme
+	finalURL, err = driver.RewriteToCDN(finalURL, handler.Policy, ttl)
+	if err != nil {
+		return "", err
 	}
 
 	return finalURL.String(), nil
@@ -436,6 +528,12 @@ func (handler *Driver) Token(ctx context.Context, ttl int64, uploadSession *seri
 		oss.Expires(time.Now().Add(time.Duration(ttl) * time.Second)),
 		oss.ForbidOverWrite(true),
 	}
+	if class := handler.storageClass(fileInfo); class != "" {
+		options = append(options, oss.ObjectStorageClass(oss.StorageClassType(class)))
+	}
+	if len(fileInfo.Tags) > 0 {
+		options = append(options, oss.SetTagging(objectTagging(fileInfo.Tags)))
+	}
 	imur, err := handler.bucket.InitiateMultipartUpload(fileInfo.SavePath, options...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize multipart upload: %w", err)
@@ -488,3 +586,63 @@ func (handler *Driver) Token(ctx context.Context, ttl int64, uploadSession *seri
 func (handler *Driver) CancelToken(ctx context.Context, uploadSession *serializer.UploadSession) error {
 	return handler.bucket.AbortMultipartUpload(oss.InitiateMultipartUploadResult{UploadID: uploadSession.UploadID, Key: uploadSession.SavePath}, nil)
 }
+
+// objectTagging 将标签按键名排序后转换为对象标签
+func objectTagging(tags map[string]string) oss.Tagging {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tagging := oss.Tagging{Tags: make([]oss.Tag, 0, len(keys))}
+	for _, key := range keys {
+		tagging.Tags = append(tagging.Tags, oss.Tag{Key: key, Value: tags[key]})
+	}
+	return tagging
+}
+
+// storageClass 返回上传文件使用的存储类型，未指定时使用存储策略设定
+func (handler *Driver) storageClass(info *fsctx.UploadTaskInfo) string {
+	if info.StorageClass != "" {
+		return info.StorageClass
+	}
+	return handler.Policy.OptionsSerialized.StorageClass
+}
+
+// NeedsRestore 归档、冷归档类型的对象需解冻后才能读取
+func (handler *Driver) NeedsRestore(class string) bool {
+	switch class {
+	case string(oss.StorageArchive), "ColdArchive", "DeepColdArchive":
+		return true
+	}
+	return false
+}
+
+// RestoreState 查询对象的解冻状态
+func (handler *Driver) RestoreState(ctx context.Context, path string) (driver.RestoreState, error) {
+	header, err := handler.bucket.GetObjectDetailedMeta(path)
+	if err != nil {
+		return driver.RestoreStateArchived, err
+	}
+
+	// 对象已不再是归档类型
+	if !handler.NeedsRestore(header.Get(oss.HTTPHeaderOssStorageClass)) {
+		return driver.RestoreStateRestored, nil
+	}
+
+	return driver.ParseRestoreHeader(header.Get("X-Oss-Restore")), nil
+}
+
+// Restore 发起解冻，解冻已在进行中时视为成功。OSS 解冻后的可读取天数由存储类型决定，
+// 忽略 days
+func (handler *Driver) Restore(ctx context.Context, path string, days int) error {
+	err := handler.bucket.RestoreObject(path)
+
+	var srvErr oss.ServiceError
+	if errors.As(err, &srvErr) && srvErr.StatusCode == http.StatusConflict {
+		return nil
+	}
+
+	return err
+}
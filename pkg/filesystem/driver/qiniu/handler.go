@@ -18,6 +18,7 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/qiniu/go-sdk/v7/auth/qbox"
+	"github.com/qiniu/go-sdk/v7/client"
 	"github.com/qiniu/go-sdk/v7/storage"
 )
 
@@ -27,6 +28,7 @@ type Driver struct {
 	mac    *qbox.Mac
 	cfg    *storage.Config
 	bucket *storage.BucketManager
+	client *client.Client
 }
 
 func NewDriver(policy *model.Policy) *Driver {
@@ -36,11 +38,19 @@ func NewDriver(policy *model.Policy) *Driver {
 
 	mac := qbox.NewMac(policy.AccessKey, policy.SecretKey)
 	cfg := &storage.Config{UseHTTPS: true}
+
+	// 使用存储策略的出站代理与附加请求头
+	var clt *client.Client
+	if httpClient, _ := request.NewOutboundHTTPClient(policy); httpClient != nil {
+		clt = &client.Client{Client: httpClient}
+	}
+
 	return &Driver{
 		Policy: policy,
 		mac:    mac,
 		cfg:    cfg,
-		bucket: storage.NewBucketManager(mac, cfg),
+		bucket: storage.NewBucketManagerEx(mac, cfg, clt),
+		client: clt,
 	}
 }
 
@@ -130,7 +140,7 @@ func (handler *Driver) Get(ctx context.Context, path string) (response.RSCloser,
 	}
 
 	// 获取文件数据流
-	client := request.NewClient()
+	client := request.NewClient(request.WithPolicyOutbound(handler.Policy))
 	resp, err := client.Request(
 		"GET",
 		downloadURL,
@@ -189,7 +199,7 @@ func (handler *Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 
 	// 创建上传表单
 	cfg := storage.Config{}
-	formUploader := storage.NewFormUploader(&cfg)
+	formUploader := storage.NewFormUploaderEx(&cfg, handler.client)
 	ret := storage.PutRet{}
 	putExtra := storage.PutExtra{
 		Params: map[string]string{},
@@ -329,7 +339,7 @@ func (handler *Driver) getUploadCredential(ctx context.Context, policy storage.P
 	upToken := policy.UploadToken(handler.mac)
 
 	// 初始化分片上传
-	resumeUploader := storage.NewResumeUploaderV2(handler.cfg)
+	resumeUploader := storage.NewResumeUploaderV2Ex(handler.cfg, handler.client)
 	upHost, err := resumeUploader.UpHost(handler.Policy.AccessKey, handler.Policy.BucketName)
 	if err != nil {
 		return nil, err
@@ -348,6 +358,6 @@ func (handler *Driver) getUploadCredential(ctx context.Context, policy storage.P
 
 // 取消上传凭证
 func (handler Driver) CancelToken(ctx context.Context, uploadSession *serializer.UploadSession) error {
-	resumeUploader := storage.NewResumeUploaderV2(handler.cfg)
+	resumeUploader := storage.NewResumeUploaderV2Ex(handler.cfg, handler.client)
 	return resumeUploader.Client.CallWith(ctx, nil, "DELETE", uploadSession.UploadURL, http.Header{"Authorization": {"UpToken " + uploadSession.Credential}}, nil, 0)
 }
@@ -58,6 +58,7 @@ func NewClient(policy *model.Policy) (Client, error) {
 			request.WithCredential(authInstance, int64(signTTL)),
 			request.WithMasterMeta(),
 			request.WithSlaveMeta(policy.AccessKey),
+			request.WithPolicyOutbound(policy),
 		),
 	}, nil
 }
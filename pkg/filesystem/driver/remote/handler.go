@@ -13,6 +13,7 @@ import (
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
@@ -38,7 +39,7 @@ func NewDriver(policy *model.Policy) (*Driver, error) {
 
 	return &Driver{
 		Policy:       policy,
-		Client:       request.NewClient(),
+		Client:       request.NewClient(request.WithPolicyOutbound(policy)),
 		AuthInstance: auth.HMACAuth{[]byte(policy.SecretKey)},
 		uploadClient: client,
 	}, nil
@@ -149,6 +150,11 @@ func (handler *Driver) Get(ctx context.Context, path string) (response.RSCloser,
 	return resp, nil
 }
 
+// StreamingPut 上传内容按分片大小缓冲后上传，无需预先缓冲请求正文
+func (handler *Driver) StreamingPut() bool {
+	return true
+}
+
 // Put 将文件流保存到指定目录
 func (handler *Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 	defer file.Close()
@@ -219,6 +225,38 @@ func (handler *Driver) Thumb(ctx context.Context, path string) (*response.Conten
 	}, nil
 }
 
+// GenerateThumb 请求从机重新为文件生成缩略图，从机无法访问时返回的错误可稍后重试
+func (handler *Driver) GenerateThumb(ctx context.Context, path string) (string, error) {
+	sourcePath := base64.RawURLEncoding.EncodeToString([]byte(path))
+	signTTL := model.GetIntSetting("slave_api_timeout", 60)
+	resp, err := handler.Client.Request(
+		"POST",
+		handler.getAPIUrl("thumb", sourcePath),
+		nil,
+		request.WithContext(ctx),
+		request.WithCredential(handler.AuthInstance, int64(signTTL)),
+		request.WithMasterMeta(),
+	).CheckHTTPResponse(200).DecodeResponse()
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Code == serializer.CodeThumbUnsupported {
+		return "", driver.ErrThumbUnsupported
+	}
+
+	if resp.Code != 0 {
+		return "", errors.New(resp.Error)
+	}
+
+	picInfo, ok := resp.Data.(string)
+	if !ok || picInfo == "" {
+		return "", errors.New("unknown format of returned response")
+	}
+
+	return picInfo, nil
+}
+
 // Source 获取外链URL
 func (handler *Driver) Source(
 	ctx context.Context,
@@ -15,6 +15,7 @@ import (
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/stretchr/testify/assert"
@@ -383,6 +384,110 @@ func TestHandler_Thumb(t *testing.T) {
 	asserts.True(resp.Redirect)
 }
 
+func TestHandler_GenerateThumb(t *testing.T) {
+	asserts := assert.New(t)
+	handler := Driver{
+		Policy: &model.Policy{
+			Type:      "remote",
+			SecretKey: "test",
+			Server:    "http://test.com",
+		},
+		AuthInstance: auth.HMACAuth{},
+	}
+	ctx := context.Background()
+	cache.Set("setting_slave_api_timeout", "60", 0)
+
+	// 成功
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"http://test.com/api/v3/slave/thumb/LzEuanBn",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"code":0,"data":"10,20"}`)),
+			},
+		})
+		handler.Client = clientMock
+		picInfo, err := handler.GenerateThumb(ctx, "/1.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.NoError(err)
+		asserts.Equal("10,20", picInfo)
+	}
+
+	// 从机无法生成
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"http://test.com/api/v3/slave/thumb/LzEuanBn",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"code":40085}`)),
+			},
+		})
+		handler.Client = clientMock
+		picInfo, err := handler.GenerateThumb(ctx, "/1.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.ErrorIs(err, driver.ErrThumbUnsupported)
+		asserts.Empty(picInfo)
+	}
+
+	// 从机生成失败
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"http://test.com/api/v3/slave/thumb/LzEuanBn",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: nil,
+			Response: &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"code":40001,"error":"failed"}`)),
+			},
+		})
+		handler.Client = clientMock
+		picInfo, err := handler.GenerateThumb(ctx, "/1.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.NotErrorIs(err, driver.ErrThumbUnsupported)
+		asserts.Empty(picInfo)
+	}
+
+	// 从机无法访问
+	{
+		clientMock := ClientMock{}
+		clientMock.On(
+			"Request",
+			"POST",
+			"http://test.com/api/v3/slave/thumb/LzEuanBn",
+			testMock.Anything,
+			testMock.Anything,
+		).Return(&request.Response{
+			Err: errors.New("connection refused"),
+		})
+		handler.Client = clientMock
+		picInfo, err := handler.GenerateThumb(ctx, "/1.jpg")
+		clientMock.AssertExpectations(t)
+		asserts.Error(err)
+		asserts.NotErrorIs(err, driver.ErrThumbUnsupported)
+		asserts.Empty(picInfo)
+	}
+}
+
 func TestHandler_Token(t *testing.T) {
 	a := assert.New(t)
 	handler, _ := NewDriver(&model.Policy{})
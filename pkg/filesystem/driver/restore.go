@@ -0,0 +1,40 @@
+package driver
+
+import (
+	"context"
+	"strings"
+)
+
+// RestoreState 归档对象的解冻状态
+type RestoreState int
+
+const (
+	// RestoreStateArchived 未解冻，不可读取
+	RestoreStateArchived RestoreState = iota
+	// RestoreStateRestoring 解冻中
+	RestoreStateRestoring
+	// RestoreStateRestored 已解冻，可以读取
+	RestoreStateRestored
+)
+
+// Restorer 支持归档存储类型的适配器，归档类型的对象需解冻后才能读取
+type Restorer interface {
+	// NeedsRestore 返回存储类型为 class 的对象是否需要解冻后才能读取
+	NeedsRestore(class string) bool
+	// RestoreState 查询 path 处对象的解冻状态
+	RestoreState(ctx context.Context, path string) (RestoreState, error)
+	// Restore 对 path 处的对象发起解冻，days 为解冻后可读取的天数
+	Restore(ctx context.Context, path string, days int) error
+}
+
+// ParseRestoreHeader 解析 S3 x-amz-restore、OSS x-oss-restore 响应头表示的解冻状态
+func ParseRestoreHeader(value string) RestoreState {
+	switch {
+	case strings.Contains(value, `ongoing-request="true"`):
+		return RestoreStateRestoring
+	case strings.Contains(value, `ongoing-request="false"`):
+		return RestoreStateRestored
+	default:
+		return RestoreStateArchived
+	}
+}
@@ -0,0 +1,15 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRestoreHeader(t *testing.T) {
+	asserts := assert.New(t)
+
+	asserts.Equal(RestoreStateArchived, ParseRestoreHeader(""))
+	asserts.Equal(RestoreStateRestoring, ParseRestoreHeader(`ongoing-request="true"`))
+	asserts.Equal(RestoreStateRestored, ParseRestoreHeader(`ongoing-request="false", expiry-date="Fri, 23 Dec 2012 00:00:00 GMT"`))
+}
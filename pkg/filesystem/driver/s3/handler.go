@@ -14,9 +14,11 @@ import (
 
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/chunk"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/chunk/backoff"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -67,13 +69,23 @@ func (handler *Driver) InitS3Client() error {
 
 	if handler.svc == nil {
 		// 初始化会话
-		sess, err := session.NewSession(&aws.Config{
+		cfg := &aws.Config{
 			Credentials:      credentials.NewStaticCredentials(handler.Policy.AccessKey, handler.Policy.SecretKey, ""),
 			Endpoint:         &handler.Policy.Server,
 			Region:           &handler.Policy.OptionsSerialized.Region,
 			S3ForcePathStyle: aws.Bool(true),
-		})
+		}
 
+		// 使用存储策略的出站代理与附加请求头
+		httpClient, err := request.NewOutboundHTTPClient(handler.Policy)
+		if err != nil {
+			return err
+		}
+		if httpClient != nil {
+			cfg.HTTPClient = httpClient
+		}
+
+		sess, err := session.NewSession(cfg)
 		if err != nil {
 			return err
 		}
@@ -160,6 +172,59 @@ func (handler *Driver) List(ctx context.Context, base string, recursive bool) ([
 
 }
 
+// Walk 使用 ListObjectsV2 分页遍历 prefix 下的文件，marker 为上次遍历到的对象键
+func (handler *Driver) Walk(ctx context.Context, prefix, marker string, fn driver.WalkFunc) error {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	opt := &s3.ListObjectsV2Input{
+		Bucket:  &handler.Policy.BucketName,
+		Prefix:  &prefix,
+		MaxKeys: aws.Int64(1000),
+	}
+	if marker != "" {
+		opt.StartAfter = aws.String(marker)
+	}
+
+	var walkErr error
+	err := handler.svc.ListObjectsV2PagesWithContext(ctx, opt, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			// 目录占位对象
+			if strings.HasSuffix(*object.Key, "/") {
+				continue
+			}
+
+			rel, err := filepath.Rel(prefix, *object.Key)
+			if err != nil {
+				continue
+			}
+
+			lastModify := time.Now()
+			if object.LastModified != nil {
+				lastModify = *object.LastModified
+			}
+
+			if walkErr = fn(response.Object{
+				Name:         path.Base(*object.Key),
+				Source:       *object.Key,
+				RelativePath: filepath.ToSlash(rel),
+				Size:         uint64(*object.Size),
+				LastModify:   lastModify,
+			}, *object.Key); walkErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+
+	if walkErr != nil {
+		return walkErr
+	}
+	return err
+}
+
 // Get 获取文件
 func (handler *Driver) Get(ctx context.Context, path string) (response.RSCloser, error) {
 	// 获取文件源地址
@@ -176,7 +241,7 @@ func (handler *Driver) Get(ctx context.Context, path string) (response.RSCloser,
 	}
 
 	// 获取文件数据流
-	client := request.NewClient()
+	client := request.NewClient(request.WithPolicyOutbound(handler.Policy))
 	resp, err := client.Request(
 		"GET",
 		downloadURL,
@@ -201,6 +266,11 @@ func (handler *Driver) Get(ctx context.Context, path string) (response.RSCloser,
 	return resp, nil
 }
 
+// StreamingPut 上传内容按分片大小缓冲后上传，无需预先缓冲请求正文
+func (handler *Driver) StreamingPut() bool {
+	return true
+}
+
 // Put 将文件流保存到指定目录
 func (handler *Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 	defer file.Close()
@@ -210,21 +280,34 @@ func (handler *Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 		return err
 	}
 
+	confirmed := ""
 	uploader := s3manager.NewUploader(handler.sess, func(u *s3manager.Uploader) {
 		u.PartSize = int64(handler.Policy.OptionsSerialized.ChunkSize)
+		if handler.Policy.OptionsSerialized.ServerSideChecksum {
+			u.RequestOptions = append(u.RequestOptions, checksumRequestOption(&confirmed))
+		}
 	})
 
 	dst := file.Info().SavePath
-	_, err := uploader.Upload(&s3manager.UploadInput{
+	input := &s3manager.UploadInput{
 		Bucket: &handler.Policy.BucketName,
 		Key:    &dst,
 		Body:   io.LimitReader(file, int64(file.Info().Size)),
-	})
+	}
+	if class := handler.storageClass(file.Info()); class != "" {
+		input.StorageClass = &class
+	}
+	input.Tagging = objectTagging(file.Info().Tags)
+	_, err := uploader.Upload(input)
 
 	if err != nil {
 		return err
 	}
 
+	if confirmed != "" {
+		file.SetMetadata(driver.ServerChecksumMetadataKey, confirmed)
+	}
+
 	return nil
 }
 
@@ -316,13 +399,9 @@ func (handler *Driver) Source(
 		finalURL.RawQuery = ""
 	}
 
-	if handler.Policy.BaseURL != "" {
-		cdnURL, err := url.Parse(handler.Policy.BaseURL)
-		if err != nil {
-			return "", err
-		}
-		finalURL.Host = cdnURL.Host
-		finalURL.Scheme = cdnURL.Scheme
+	finalURL, err = driver.RewriteToCDN(finalURL, handler.Policy, ttl)
+	if err != nil {
+		return "", err
 	}
 
 	return finalURL.String(), nil
@@ -338,11 +417,16 @@ func (handler *Driver) Token(ctx context.Context, ttl int64, uploadSession *seri
 
 	// 创建分片上传
 	expires := time.Now().Add(time.Duration(ttl) * time.Second)
-	res, err := handler.svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+	input := &s3.CreateMultipartUploadInput{
 		Bucket:  &handler.Policy.BucketName,
 		Key:     &fileInfo.SavePath,
 		Expires: &expires,
-	})
+	}
+	if class := handler.storageClass(fileInfo); class != "" {
+		input.StorageClass = &class
+	}
+	input.Tagging = objectTagging(fileInfo.Tags)
+	res, err := handler.svc.CreateMultipartUpload(input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create multipart upload: %w", err)
 	}
@@ -416,6 +500,100 @@ func (handler *Driver) Meta(ctx context.Context, path string) (*MetaData, error)
 
 }
 
+// Stat 获取文件信息
+func (handler *Driver) Stat(ctx context.Context, path string) (*response.Object, error) {
+	res, err := handler.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: &handler.Policy.BucketName,
+		Key:    &path,
+	})
+	if err != nil {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+			return nil, driver.ErrObjectMissing
+		}
+		return nil, err
+	}
+
+	object := &response.Object{
+		Name:   filepath.Base(path),
+		Source: path,
+	}
+	if res.ContentLength != nil {
+		object.Size = uint64(*res.ContentLength)
+	}
+	if res.LastModified != nil {
+		object.LastModify = *res.LastModified
+	}
+
+	return object, nil
+}
+
+// objectTagging 将标签编码为 x-amz-tagging 请求头的值，没有标签时返回 nil
+func objectTagging(tags map[string]string) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	tagging := url.Values{}
+	for key, value := range tags {
+		tagging.Set(key, value)
+	}
+	encoded := tagging.Encode()
+	return &encoded
+}
+
+// storageClass 返回上传文件使用的存储类型，未指定时使用存储策略设定
+func (handler *Driver) storageClass(info *fsctx.UploadTaskInfo) string {
+	if info.StorageClass != "" {
+		return info.StorageClass
+	}
+	return handler.Policy.OptionsSerialized.StorageClass
+}
+
+// NeedsRestore 归档类型的对象需解冻后才能读取
+func (handler *Driver) NeedsRestore(class string) bool {
+	return class == s3.StorageClassGlacier || class == s3.StorageClassDeepArchive
+}
+
+// RestoreState 查询对象的解冻状态
+func (handler *Driver) RestoreState(ctx context.Context, path string) (driver.RestoreState, error) {
+	res, err := handler.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: &handler.Policy.BucketName,
+		Key:    &path,
+	})
+	if err != nil {
+		return driver.RestoreStateArchived, err
+	}
+
+	// 对象已不再是归档类型
+	if res.StorageClass == nil || !handler.NeedsRestore(*res.StorageClass) {
+		return driver.RestoreStateRestored, nil
+	}
+
+	return driver.ParseRestoreHeader(aws.StringValue(res.Restore)), nil
+}
+
+// Restore 发起解冻，解冻已在进行中时视为成功
+func (handler *Driver) Restore(ctx context.Context, path string, days int) error {
+	_, err := handler.svc.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+		Bucket: &handler.Policy.BucketName,
+		Key:    &path,
+		RestoreRequest: &s3.RestoreRequest{
+			Days: aws.Int64(int64(days)),
+			GlacierJobParameters: &s3.GlacierJobParameters{
+				Tier: aws.String(s3.TierStandard),
+			},
+		},
+	})
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.Code() == "RestoreAlreadyInProgress" {
+		return nil
+	}
+
+	return err
+}
+
 // CORS 创建跨域策略
 func (handler *Driver) CORS() error {
 	rule := s3.CORSRule{
@@ -0,0 +1,207 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/chunk/backoff"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// multipartCompleteRetrySleep 重试完成分片上传的间隔
+var multipartCompleteRetrySleep = 2 * time.Second
+
+// errMultipartMismatch 分片上传生成的对象与上传会话不一致
+var errMultipartMismatch = errors.New("object does not match the upload session")
+
+// definitiveCompleteErrors 表明分片上传无法完成的错误码，重试不会改变结果
+var definitiveCompleteErrors = map[string]bool{
+	"InvalidPart":      true,
+	"InvalidPartOrder": true,
+	"EntityTooSmall":   true,
+}
+
+// CompleteMultipart 完成客户端直传的分片上传。客户端的完成请求可能已在存储端生效但响应丢失，
+// 因此先校验对象是否已存在；完成请求失败时按 multipart_complete_retries 重试，
+// 存储端返回 NoSuchUpload 时说明此前的请求已生效或上传已被中止，以对象是否存在区分
+func (handler *Driver) CompleteMultipart(ctx context.Context, session *serializer.UploadSession) error {
+	if err := handler.verifyMultipartObject(ctx, session); err == nil {
+		return nil
+	}
+
+	parts, err := handler.listParts(ctx, session)
+	if err != nil {
+		if isAWSErrorCode(err, s3.ErrCodeNoSuchUpload) {
+			return handler.verifyCompletedObject(ctx, session)
+		}
+
+		// 已记录分片时仍可尝试完成
+		if len(session.PartETags) == 0 {
+			return fmt.Errorf("failed to list uploaded parts: %w", err)
+		}
+		parts = session.PartETags
+	}
+
+	if expected := expectedPartNum(session, handler.Policy.OptionsSerialized.ChunkSize); len(parts) < expected {
+		return fmt.Errorf("only %d of %d parts are uploaded", len(parts), expected)
+	}
+	session.PartETags = parts
+
+	completed := make([]*s3.CompletedPart, len(parts))
+	for i, etag := range parts {
+		completed[i] = &s3.CompletedPart{
+			ETag:       aws.String(etag),
+			PartNumber: aws.Int64(int64(i + 1)),
+		}
+	}
+
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:          &handler.Policy.BucketName,
+		Key:             &session.SavePath,
+		UploadId:        &session.UploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	}
+	retry := &backoff.ConstantBackoff{
+		Max:   model.GetIntSetting("multipart_complete_retries", 3),
+		Sleep: multipartCompleteRetrySleep,
+	}
+
+	for {
+		_, err = handler.svc.CompleteMultipartUploadWithContext(ctx, input)
+		if err == nil {
+			break
+		}
+
+		if isAWSErrorCode(err, s3.ErrCodeNoSuchUpload) {
+			return handler.verifyCompletedObject(ctx, session)
+		}
+
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && definitiveCompleteErrors[awsErr.Code()] {
+			util.Log().Warning("Multipart upload %q of %q cannot be completed: %s", session.UploadID, session.SavePath, err)
+			handler.abortMultipart(session)
+			return driver.ErrMultipartAborted
+		}
+
+		if !retry.Next(err) {
+			return fmt.Errorf("failed to complete multipart upload: %w", err)
+		}
+
+		util.Log().Debug("Failed to complete multipart upload %q, retrying: %s", session.UploadID, err)
+	}
+
+	return handler.verifyCompletedObject(ctx, session)
+}
+
+// verifyCompletedObject 校验分片上传已完成后的对象，对象不存在说明上传已被中止，
+// 与会话不一致时对象不可用，均视为无法完成
+func (handler *Driver) verifyCompletedObject(ctx context.Context, session *serializer.UploadSession) error {
+	err := handler.verifyMultipartObject(ctx, session)
+	if errors.Is(err, driver.ErrObjectMissing) || errors.Is(err, errMultipartMismatch) {
+		util.Log().Warning("Multipart upload %q of %q cannot be completed: %s", session.UploadID, session.SavePath, err)
+		handler.abortMultipart(session)
+		return driver.ErrMultipartAborted
+	}
+
+	return err
+}
+
+// verifyMultipartObject 校验对象大小与上传会话一致，会话记录了分片 ETag 时一并校验对象的 ETag。
+// 启用服务端加密等情况下对象 ETag 不是分片 ETag 的组合，此时仅校验大小
+func (handler *Driver) verifyMultipartObject(ctx context.Context, session *serializer.UploadSession) error {
+	res, err := handler.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: &handler.Policy.BucketName,
+		Key:    &session.SavePath,
+	})
+	if err != nil {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == 404 {
+			return driver.ErrObjectMissing
+		}
+		return err
+	}
+
+	if res.ContentLength == nil || uint64(*res.ContentLength) != session.Size {
+		return errMultipartMismatch
+	}
+
+	etag := strings.Trim(aws.StringValue(res.ETag), `"`)
+	if len(session.PartETags) > 0 && strings.HasSuffix(etag, fmt.Sprintf("-%d", len(session.PartETags))) {
+		expected, err := driver.MultipartETag(session.PartETags)
+		if err == nil && !strings.EqualFold(expected, etag) {
+			return errMultipartMismatch
+		}
+	}
+
+	return nil
+}
+
+// listParts 按分片序号列出已上传分片的 ETag
+func (handler *Driver) listParts(ctx context.Context, session *serializer.UploadSession) ([]string, error) {
+	var etags []string
+	err := handler.svc.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   &handler.Policy.BucketName,
+		Key:      &session.SavePath,
+		UploadId: &session.UploadID,
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			number := int(aws.Int64Value(part.PartNumber))
+			if number < 1 {
+				continue
+			}
+
+			for len(etags) < number {
+				etags = append(etags, "")
+			}
+			etags[number-1] = aws.StringValue(part.ETag)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 分片序号不连续时，缺失的分片尚未上传
+	for i, etag := range etags {
+		if etag == "" {
+			return etags[:i], nil
+		}
+	}
+
+	return etags, nil
+}
+
+// abortMultipart 中止分片上传并清理已上传的分片，失败时仅记录日志
+func (handler *Driver) abortMultipart(session *serializer.UploadSession) {
+	if _, err := handler.svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   &handler.Policy.BucketName,
+		Key:      &session.SavePath,
+		UploadId: &session.UploadID,
+	}); err != nil && !isAWSErrorCode(err, s3.ErrCodeNoSuchUpload) {
+		util.Log().Warning("Failed to abort multipart upload %q: %s", session.UploadID, err)
+	}
+}
+
+// expectedPartNum 返回上传会话应有的分片数量
+func expectedPartNum(session *serializer.UploadSession, chunkSize uint64) int {
+	if chunkSize == 0 || session.Size == 0 {
+		return 1
+	}
+
+	return int((session.Size + chunkSize - 1) / chunkSize)
+}
+
+// isAWSErrorCode 返回 err 是否为指定错误码的 AWS 错误
+func isAWSErrorCode(err error, code string) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == code
+}
@@ -0,0 +1,30 @@
+package driver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+)
+
+var (
+	// ErrObjectMissing 存储端不存在指定的对象
+	ErrObjectMissing = errors.New("object does not exist in storage")
+	// ErrStatNotSupported 适配器不支持查询单个对象
+	ErrStatNotSupported = errors.New("stat is not supported by this storage driver")
+)
+
+// Stater 可查询单个存储端对象的适配器
+type Stater interface {
+	// Stat 返回 path 处对象的信息，对象不存在时返回 ErrObjectMissing
+	Stat(ctx context.Context, path string) (*response.Object, error)
+}
+
+// Stat 查询存储端对象，适配器未实现 Stater 时返回 ErrStatNotSupported
+func Stat(ctx context.Context, handler Handler, path string) (*response.Object, error) {
+	if stater, ok := handler.(Stater); ok {
+		return stater.Stat(ctx, path)
+	}
+
+	return nil, ErrStatNotSupported
+}
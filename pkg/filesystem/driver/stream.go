@@ -0,0 +1,16 @@
+package driver
+
+// StreamPutter Put 时边读取边写入存储端、内存占用有界的适配器，上传前无需缓冲请求正文
+type StreamPutter interface {
+	// StreamingPut 返回 Put 是否以流式读取上传内容
+	StreamingPut() bool
+}
+
+// SupportsStreamingPut 返回适配器是否支持流式上传
+func SupportsStreamingPut(handler Handler) bool {
+	if putter, ok := handler.(StreamPutter); ok {
+		return putter.StreamingPut()
+	}
+
+	return false
+}
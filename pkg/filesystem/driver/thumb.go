@@ -0,0 +1,16 @@
+package driver
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrThumbUnsupported 存储端无法为文件生成缩略图，如格式不受支持，重试不会改变结果
+var ErrThumbUnsupported = errors.New("thumbnail is not supported for this file")
+
+// ThumbGenerator 可请求存储端重新生成缩略图的适配器
+type ThumbGenerator interface {
+	// GenerateThumb 为 path 处的文件生成缩略图，返回 "宽,高" 格式的图像原始尺寸。
+	// 无法生成时返回 ErrThumbUnsupported，其余错误视为暂时性错误，稍后可重试
+	GenerateThumb(ctx context.Context, path string) (string, error)
+}
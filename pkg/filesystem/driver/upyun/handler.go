@@ -41,6 +41,21 @@ type Driver struct {
 	Policy *model.Policy
 }
 
+// newUpYun 创建又拍云 SDK 客户端，使用存储策略的出站代理与附加请求头
+func (handler Driver) newUpYun() *upyun.UpYun {
+	up := upyun.NewUpYun(&upyun.UpYunConfig{
+		Bucket:   handler.Policy.BucketName,
+		Operator: handler.Policy.AccessKey,
+		Password: handler.Policy.SecretKey,
+	})
+
+	if httpClient, _ := request.NewOutboundHTTPClient(handler.Policy); httpClient != nil {
+		up.SetHTTPClient(httpClient)
+	}
+
+	return up
+}
+
 func (handler Driver) List(ctx context.Context, base string, recursive bool) ([]response.Object, error) {
 	base = strings.TrimPrefix(base, "/")
 
@@ -73,11 +88,7 @@ func (handler Driver) List(ctx context.Context, base string, recursive bool) ([]
 		}
 	}(objChan, &objects, wg)
 
-	up := upyun.NewUpYun(&upyun.UpYunConfig{
-		Bucket:   handler.Policy.BucketName,
-		Operator: handler.Policy.AccessKey,
-		Password: handler.Policy.SecretKey,
-	})
+	up := handler.newUpYun()
 
 	err := up.List(listConf)
 	if err != nil {
@@ -118,7 +129,7 @@ func (handler Driver) Get(ctx context.Context, path string) (response.RSCloser,
 	}
 
 	// 获取文件数据流
-	client := request.NewClient()
+	client := request.NewClient(request.WithPolicyOutbound(handler.Policy))
 	resp, err := client.Request(
 		"GET",
 		downloadURL,
@@ -148,11 +159,7 @@ func (handler Driver) Get(ctx context.Context, path string) (response.RSCloser,
 func (handler Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 	defer file.Close()
 
-	up := upyun.NewUpYun(&upyun.UpYunConfig{
-		Bucket:   handler.Policy.BucketName,
-		Operator: handler.Policy.AccessKey,
-		Password: handler.Policy.SecretKey,
-	})
+	up := handler.newUpYun()
 	err := up.Put(&upyun.PutObjectConfig{
 		Path:   file.Info().SavePath,
 		Reader: file,
@@ -164,11 +171,7 @@ func (handler Driver) Put(ctx context.Context, file fsctx.FileHeader) error {
 // Delete 删除一个或多个文件，
 // 返回未删除的文件，及遇到的最后一个错误
 func (handler Driver) Delete(ctx context.Context, files []string) ([]string, error) {
-	up := upyun.NewUpYun(&upyun.UpYunConfig{
-		Bucket:   handler.Policy.BucketName,
-		Operator: handler.Policy.AccessKey,
-		Password: handler.Policy.SecretKey,
-	})
+	up := handler.newUpYun()
 
 	var (
 		failed       = make([]string, 0, len(files))
@@ -0,0 +1,99 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+)
+
+// ErrStopWalk 在 WalkFunc 中返回此错误可提前结束遍历，Walk 不会将其作为错误返回
+var ErrStopWalk = errors.New("stop walking")
+
+// WalkFunc 遍历存储端对象时对每个文件调用的回调。marker 为处理完此对象后
+// 恢复遍历所需的位置，调用方可将其保存为检查点，返回错误时中止遍历
+type WalkFunc func(object response.Object, marker string) error
+
+// Walker 可流式遍历存储端对象的适配器，避免对象数量巨大时一次性载入内存
+type Walker interface {
+	// Walk 遍历 prefix 下的所有文件（不含目录），从 marker 之后的对象开始，
+	// marker 为空时从头开始。返回对象的 Source 为存储端的完整路径
+	Walk(ctx context.Context, prefix, marker string, fn WalkFunc) error
+}
+
+// Walk 使用适配器流式遍历存储端文件，适配器未实现 Walker 时退回到递归列取后逐个回调
+func Walk(ctx context.Context, handler Handler, prefix, marker string, fn WalkFunc) error {
+	var err error
+	if walker, ok := handler.(Walker); ok {
+		err = walker.Walk(ctx, prefix, marker, fn)
+	} else {
+		err = walkByList(ctx, handler, prefix, marker, fn)
+	}
+
+	if errors.Is(err, ErrStopWalk) {
+		return nil
+	}
+	return err
+}
+
+func walkByList(ctx context.Context, handler Handler, prefix, marker string, fn WalkFunc) error {
+	objects, err := handler.List(ctx, prefix, true)
+	if err != nil {
+		return err
+	}
+
+	files := make([]response.Object, 0, len(objects))
+	for _, object := range objects {
+		if object.IsDir {
+			continue
+		}
+		if object.Source == "" {
+			object.Source = path.Join(prefix, object.RelativePath)
+		}
+		files = append(files, object)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Source < files[j].Source
+	})
+
+	for _, file := range files {
+		if marker != "" && file.Source <= marker {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(file, file.Source); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ComparePath 按路径分段逐段比较 a、b，顺序与逐层按名称排序的目录遍历一致，
+// 返回值含义同 strings.Compare
+func ComparePath(a, b string) int {
+	segA := strings.Split(strings.Trim(a, "/"), "/")
+	segB := strings.Split(strings.Trim(b, "/"), "/")
+	for i := 0; i < len(segA) && i < len(segB); i++ {
+		if res := strings.Compare(segA[i], segB[i]); res != 0 {
+			return res
+		}
+	}
+
+	switch {
+	case len(segA) < len(segB):
+		return -1
+	case len(segA) > len(segB):
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,16 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComparePath(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(0, ComparePath("a/b", "/a/b"))
+	a.Equal(-1, ComparePath("a/b", "a.txt"))
+	a.Equal(1, ComparePath("a.txt", "a/b/c"))
+	a.Equal(-1, ComparePath("a", "a/b"))
+	a.Equal(1, ComparePath("b", "a/b"))
+}
@@ -0,0 +1,108 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+)
+
+// encryptionMinSample 参与熵检查的最少字节数，更短的内容即使加密也难以达到阈值，只检查标记
+const encryptionMinSample = 1024
+
+// parseEncryptionMarker 解析存储策略设定的加密标记，以 hex: 开头时按十六进制解码
+func parseEncryptionMarker(marker string) ([]byte, error) {
+	if strings.HasPrefix(marker, "hex:") {
+		return hex.DecodeString(strings.TrimPrefix(marker, "hex:"))
+	}
+
+	return []byte(marker), nil
+}
+
+// shannonEntropy 返回 data 每字节的香农熵，取值范围为 0~8，加密内容接近 8
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(len(data))
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// encryptionMinEntropy 返回加密内容每字节应达到的最低熵
+func encryptionMinEntropy() float64 {
+	threshold, err := strconv.ParseFloat(model.GetSettingByName("upload_encryption_min_entropy"), 64)
+	if err != nil {
+		return 7.5
+	}
+
+	return threshold
+}
+
+// HookValidateEncryptedUpload 存储策略只接受客户端加密的文件时，检查上传内容是否以加密标记开头，
+// 并对标记之后的一段内容做熵检查，避免误传明文。追加上传的后续分片只做熵检查
+func HookValidateEncryptedUpload(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+	if fs.Policy == nil || !fs.Policy.OptionsSerialized.EncryptedOnly {
+		return nil
+	}
+
+	fileInfo := file.Info()
+	if fileInfo.Mode&fsctx.Nop == fsctx.Nop {
+		return nil
+	}
+
+	marker, err := parseEncryptionMarker(fs.Policy.OptionsSerialized.EncryptionMarker)
+	if err != nil {
+		return fmt.Errorf("invalid encryption marker of policy %q: %w", fs.Policy.Name, err)
+	}
+
+	sampleSize := model.GetIntSetting("upload_encryption_sample_size", 4096)
+	if fileInfo.AppendStart > 0 {
+		marker = nil
+	}
+
+	sample, err := file.Peek(len(marker) + sampleSize)
+	if err != nil {
+		return ErrIO.WithError(err)
+	}
+
+	if !bytes.HasPrefix(sample, marker) {
+		return ErrEncryptionMarkerMissing.WithData(map[string]string{
+			"marker": fs.Policy.OptionsSerialized.EncryptionMarker,
+		})
+	}
+
+	sample = sample[len(marker):]
+	if len(sample) < encryptionMinSample {
+		return nil
+	}
+
+	threshold := encryptionMinEntropy()
+	if entropy := shannonEntropy(sample); entropy < threshold {
+		return ErrEncryptionEntropyTooLow.WithData(map[string]float64{
+			"entropy":   math.Round(entropy*100) / 100,
+			"threshold": threshold,
+		})
+	}
+
+	return nil
+}
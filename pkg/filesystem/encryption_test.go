@@ -0,0 +1,119 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEncryptionMarker(t *testing.T) {
+	asserts := assert.New(t)
+
+	res, err := parseEncryptionMarker("CRENC")
+	asserts.NoError(err)
+	asserts.Equal([]byte("CRENC"), res)
+
+	res, err = parseEncryptionMarker("hex:00ff")
+	asserts.NoError(err)
+	asserts.Equal([]byte{0x00, 0xff}, res)
+
+	_, err = parseEncryptionMarker("hex:zz")
+	asserts.Error(err)
+}
+
+func TestShannonEntropy(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.EqualValues(0, shannonEntropy(nil))
+	asserts.EqualValues(0, shannonEntropy([]byte("aaaa")))
+	asserts.EqualValues(1, shannonEntropy([]byte("abab")))
+
+	random := make([]byte, 4096)
+	rand.Read(random)
+	asserts.Greater(shannonEntropy(random), 7.9)
+}
+
+func TestHookValidateEncryptedUpload(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_upload_encryption_min_entropy", "7.5", 0)
+	cache.Set("setting_upload_encryption_sample_size", "4096", 0)
+	fs := &FileSystem{User: &model.User{}, Policy: &model.Policy{}}
+	fs.Policy.OptionsSerialized.EncryptedOnly = true
+	fs.Policy.OptionsSerialized.EncryptionMarker = "CRENC"
+
+	random := make([]byte, 8192)
+	rand.Read(random)
+	encrypted := "CRENC" + string(random)
+	stream := func(content string) *fsctx.FileStream {
+		return &fsctx.FileStream{File: ioutil.NopCloser(strings.NewReader(content)), Size: uint64(len(content))}
+	}
+
+	// 未开启
+	{
+		fs := &FileSystem{User: &model.User{}, Policy: &model.Policy{}}
+		asserts.NoError(HookValidateEncryptedUpload(context.Background(), fs, stream("plain")))
+	}
+
+	// 仅创建占位文件
+	{
+		asserts.NoError(HookValidateEncryptedUpload(context.Background(), fs, &fsctx.FileStream{Mode: fsctx.Nop}))
+	}
+
+	// 加密文件，内容可继续完整读取
+	{
+		file := stream(encrypted)
+		asserts.NoError(HookValidateEncryptedUpload(context.Background(), fs, file))
+		content, err := ioutil.ReadAll(file)
+		asserts.NoError(err)
+		asserts.Equal(encrypted, string(content))
+	}
+
+	// 缺少标记
+	{
+		err := HookValidateEncryptedUpload(context.Background(), fs, stream(string(random)))
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeEncryptionRequired, err.(serializer.AppError).Code)
+		asserts.Contains(err.Error(), "encryption marker")
+	}
+
+	// 明文
+	{
+		err := HookValidateEncryptedUpload(context.Background(), fs, stream("CRENC"+strings.Repeat("plain text ", 500)))
+		asserts.Error(err)
+		asserts.Contains(err.Error(), "plaintext")
+	}
+
+	// 内容过短，只检查标记
+	{
+		asserts.NoError(HookValidateEncryptedUpload(context.Background(), fs, stream("CRENCshort")))
+	}
+
+	// 后续分片不检查标记
+	{
+		file := stream(string(random))
+		file.AppendStart = 100
+		asserts.NoError(HookValidateEncryptedUpload(context.Background(), fs, file))
+	}
+
+	// 标记设定有误
+	{
+		fs.Policy.OptionsSerialized.EncryptionMarker = "hex:zz"
+		asserts.Error(HookValidateEncryptedUpload(context.Background(), fs, stream(encrypted)))
+	}
+}
+
+func TestFileSystem_CreateUploadSession_EncryptedOnly(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}, Policy: &model.Policy{Type: "oss"}}
+	fs.Policy.OptionsSerialized.EncryptedOnly = true
+
+	_, err := fs.CreateUploadSession(context.Background(), &fsctx.FileStream{Size: 5})
+	asserts.Equal(ErrEncryptionUnenforceable, err)
+}
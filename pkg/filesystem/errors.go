@@ -9,7 +9,10 @@ import (
 var (
 	ErrUnknownPolicyType        = serializer.NewError(serializer.CodeInternalSetting, "Unknown policy type", nil)
 	ErrFileSizeTooBig           = serializer.NewError(serializer.CodeFileTooLarge, "File is too large", nil)
+	ErrFileSizeMismatch         = serializer.NewError(serializer.CodeInvalidContentLength, "Uploaded size does not match declared size", nil)
+	ErrFileSizeTooSmall         = serializer.NewError(serializer.CodeFileTooSmall, "File is too small", nil)
 	ErrFileExtensionNotAllowed  = serializer.NewError(serializer.CodeFileTypeNotAllowed, "File type not allowed", nil)
+	ErrFolderFileTypeNotAllowed = serializer.NewError(serializer.CodeFileTypeNotAllowed, "File type is not allowed in this folder", nil)
 	ErrInsufficientCapacity     = serializer.NewError(serializer.CodeInsufficientCapacity, "Insufficient capacity", nil)
 	ErrIllegalObjectName        = serializer.NewError(serializer.CodeIllegalObjectName, "Invalid object name", nil)
 	ErrClientCanceled           = errors.New("Client canceled operation")
@@ -17,10 +20,51 @@ var (
 	ErrInsertFileRecord         = serializer.NewError(serializer.CodeDBError, "Failed to create file record", nil)
 	ErrFileExisted              = serializer.NewError(serializer.CodeObjectExist, "Object existed", nil)
 	ErrFileUploadSessionExisted = serializer.NewError(serializer.CodeConflictUploadOngoing, "Upload session existed", nil)
+	ErrPathEscapesRoot          = serializer.NewError(serializer.CodeIllegalObjectName, "Path escapes root directory", nil)
+	ErrPathTooDeep              = serializer.NewError(serializer.CodeParamErr, "Path exceeds maximum folder depth", nil)
 	ErrPathNotExist             = serializer.NewError(serializer.CodeParentNotExist, "Path not exist", nil)
 	ErrObjectNotExist           = serializer.NewError(serializer.CodeParentNotExist, "Object not exist", nil)
 	ErrIO                       = serializer.NewError(serializer.CodeIOFailed, "Failed to read file data", nil)
 	ErrDBListObjects            = serializer.NewError(serializer.CodeDBError, "Failed to list object records", nil)
 	ErrDBDeleteObjects          = serializer.NewError(serializer.CodeDBError, "Failed to delete object records", nil)
 	ErrOneObjectOnly            = serializer.ParamErr("You can only copy one object at the same time", nil)
+	ErrUploadSessionIPMismatch  = serializer.NewError(serializer.CodeUploadSessionIPMismatch, "Upload session is bound to another client IP", nil)
+	ErrPerceptualHashNotExist   = serializer.NewError(serializer.CodeNotFound, "Perceptual hash of this file is not computed", nil)
+	ErrURLNotAllowed            = serializer.NewError(serializer.CodeURLNotAllowed, "URL is not allowed", nil)
+	ErrFetchURLFailed           = serializer.NewError(serializer.CodeIOFailed, "Failed to fetch remote file", nil)
+	ErrUploadWindowClosed       = serializer.NewError(serializer.CodeUploadWindowClosed, "Uploads are not allowed at this time", nil)
+	ErrUnknownManifestFormat    = serializer.NewError(serializer.CodeParamErr, "Unknown manifest format", nil)
+	ErrTypeQuotaExceeded        = serializer.NewError(serializer.CodeTypeQuotaExceeded, "Exceeded capacity limit of this file type", nil)
+	ErrFileCountExceeded        = serializer.NewError(serializer.CodeFileCountExceeded, "Exceeded file count quota", nil)
+	ErrFileRetained             = serializer.NewError(serializer.CodeFileRetained, "File is under retention", nil)
+	ErrUploadSessionExpired     = serializer.NewError(serializer.CodeUploadSessionExpired, "Upload session expired", nil)
+	ErrMetadataRequired         = serializer.NewError(serializer.CodeMetadataRequired, "Required metadata is missing", nil)
+	ErrChecksumMismatch         = serializer.NewError(serializer.CodeChecksumMismatch, "Checksum of uploaded file does not match", nil)
+	ErrDBUpdateObjects          = serializer.NewError(serializer.CodeDBError, "Failed to update object records", nil)
+	ErrSourceMissing            = serializer.NewError(serializer.CodeSourceMissing, "File data is missing in storage, please re-upload it", nil)
+	ErrNeedsRestore             = serializer.NewError(serializer.CodeNeedsRestore, "File is archived, please restore it before reading", nil)
+	ErrRestoreInProgress        = serializer.NewError(serializer.CodeRestoreInProgress, "File is being restored, please retry later", nil)
+	ErrDuplicateContent         = serializer.NewError(serializer.CodeDuplicateContent, "A file with the same content already exists in this folder", nil)
+	ErrRestoreNotNeeded         = serializer.NewError(serializer.CodeParamErr, "File is not archived", nil)
+	ErrShareUnavailable         = serializer.NewError(serializer.CodeShareLinkNotFound, "Share link is expired or has reached its download limit", nil)
+	ErrFileLocked               = serializer.NewError(serializer.CodeFileLocked, "File is password protected, please unlock it first", nil)
+	ErrIncorrectFilePassword    = serializer.NewError(serializer.CodeIncorrectPassword, "Incorrect file password", nil)
+	ErrUploadTargetNotExist     = serializer.NewError(serializer.CodeParentNotExist, "Upload target folder does not exist", nil)
+	ErrDecompressLimitExceeded  = serializer.NewError(serializer.CodeDecompressLimitExceeded, "Decompressed size of the archive exceeds limit", nil)
+	ErrNameNotUnique            = serializer.NewError(serializer.CodeNameNotUnique, "A file with the same name already exists", nil)
+	ErrUploadRegionDenied       = serializer.NewError(serializer.CodeUploadRegionDenied, "Uploads from your region are not allowed", nil)
+	ErrUploadRegionUnknown      = serializer.NewError(serializer.CodeUploadRegionDenied, "Unable to determine the region of your upload", nil)
+	ErrMIMETypeMismatch         = serializer.NewError(serializer.CodeMIMETypeMismatch, "Content type of the file does not match its extension", nil)
+	ErrMIMETypeNotAllowed       = serializer.NewError(serializer.CodeMIMETypeNotAllowed, "Content type of the file is not allowed by the storage policy", nil)
+	ErrEncryptionMarkerMissing  = serializer.NewError(serializer.CodeEncryptionRequired, "This storage policy only accepts client-side encrypted files, but the file does not start with the expected encryption marker; upload it with the client encryption SDK", nil)
+	ErrEncryptionEntropyTooLow  = serializer.NewError(serializer.CodeEncryptionRequired, "This storage policy only accepts client-side encrypted files, but the file content looks like plaintext; make sure it is encrypted before uploading", nil)
+	ErrEncryptionUnenforceable  = serializer.NewError(serializer.CodeEncryptionRequired, "This storage policy only accepts client-side encrypted files, which cannot be verified for uploads sent directly to the storage provider", nil)
+	ErrFileInfected             = serializer.NewError(serializer.CodeFileInfected, "Upload rejected, a threat was detected in the file", nil)
+	ErrVirusScanFailed          = serializer.NewError(serializer.CodeVirusScanFailed, "Failed to scan the file for viruses", nil)
+	ErrHLSNotAvailable          = serializer.NewError(serializer.CodeHLSNotAvailable, "HLS playback is not available for this file", nil)
+	ErrHLSSegmentNotFound       = serializer.NewError(serializer.CodeNotFound, "HLS segment not found", nil)
+	ErrStagingPolicyNotExist    = serializer.NewError(serializer.CodePolicyNotExist, "Storage policy for staging upload chunks does not exist", nil)
+	ErrPendingApproval          = serializer.NewError(serializer.CodePendingApproval, "File is pending approval", nil)
+	ErrReservedObjectName       = serializer.NewError(serializer.CodeReservedObjectName, "Object name is a device name reserved by Windows", nil)
+	ErrSignedURLRequired        = serializer.NewError(serializer.CodeSignedURLRequired, "This file can only be accessed through a signed URL", nil)
 )
@@ -0,0 +1,224 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 远程URL上传相关
+   ================
+*/
+
+// sizeLimitReader 读取超过 limit 字节时返回 ErrFileSizeTooBig
+type sizeLimitReader struct {
+	reader io.Reader
+	limit  uint64
+	read   uint64
+}
+
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += uint64(n)
+	if r.read > r.limit {
+		return n, ErrFileSizeTooBig
+	}
+	return n, err
+}
+
+// NewSizeLimitReader 返回读取超过 limit 字节时返回 ErrFileSizeTooBig 的 reader
+func NewSizeLimitReader(reader io.Reader, limit uint64) io.Reader {
+	return &sizeLimitReader{reader: reader, limit: limit}
+}
+
+// UploadFromURL 由服务端下载给定 URL 的内容，并经由常规上传流程保存到用户文件系统的 dst 目录中，
+// name 为空时从 URL 或响应头中推断文件名
+func (fs *FileSystem) UploadFromURL(ctx context.Context, src, dst, name string) error {
+	resp, _, err := fs.OpenURL(ctx, src, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if name == "" {
+		name = FileNameFromResponse(resp)
+	}
+
+	// 可上传的最大尺寸
+	limit := fs.URLUploadLimit()
+
+	file := &fsctx.FileStream{
+		Name:        name,
+		VirtualPath: dst,
+	}
+
+	if resp.ContentLength >= 0 {
+		// 已知大小时直接流式上传，尺寸由上传钩子校验，实际大小超出声明时中止
+		if uint64(resp.ContentLength) > limit {
+			return ErrFileSizeTooBig
+		}
+
+		file.Size = uint64(resp.ContentLength)
+		if err := HookValidateMinFileSize(fs.MinFileSize())(ctx, fs, file); err != nil {
+			return err
+		}
+
+		file.File = io.NopCloser(&sizeLimitReader{reader: resp.Body, limit: file.Size})
+		return fs.UploadFromStream(ctx, file, true)
+	}
+
+	// 未知大小时先缓存到临时文件
+	tempPath := filepath.Join(
+		util.RelativePath(model.GetSettingByName("temp_path")),
+		"fetch",
+		fmt.Sprintf("fetch_%d", time.Now().UnixNano()),
+	)
+	tempFile, err := util.CreatNestedFile(tempPath)
+	if err != nil {
+		return ErrIO.WithError(err)
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath)
+	}()
+
+	size, err := io.Copy(tempFile, &sizeLimitReader{reader: resp.Body, limit: limit})
+	if err != nil {
+		if errors.Is(err, ErrFileSizeTooBig) {
+			return ErrFileSizeTooBig
+		}
+		return ErrFetchURLFailed.WithError(err)
+	}
+
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		return ErrIO.WithError(err)
+	}
+
+	file.File = tempFile
+	file.Seeker = tempFile
+	file.Size = uint64(size)
+	return fs.UploadFromStream(ctx, file, true)
+}
+
+// OpenURL 在 URL 访问限制下请求远程文件，offset 大于 0 时通过 Range 请求从 offset 开始的内容，
+// partial 表示源站是否按请求返回了部分内容。源站不支持 Range 时返回完整内容
+func (fs *FileSystem) OpenURL(ctx context.Context, src string, offset uint64) (resp *http.Response, partial bool, err error) {
+	target, err := url.Parse(src)
+	if err != nil {
+		return nil, false, ErrURLNotAllowed.WithError(err)
+	}
+
+	options := model.GetSettingByNames("url_upload_allowed_hosts", "url_upload_denied_hosts")
+	guard := request.NewURLGuard(
+		options["url_upload_allowed_hosts"],
+		options["url_upload_denied_hosts"],
+		model.GetIntSetting("url_upload_max_redirects", 5),
+	)
+	if err := guard.Check(target); err != nil {
+		return nil, false, ErrURLNotAllowed.WithError(err)
+	}
+
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res := request.GeneralClient.Request(
+		"GET",
+		target.String(),
+		nil,
+		request.WithContext(ctx),
+		request.WithHeader(header),
+		request.WithURLGuard(guard),
+		request.WithTimeout(time.Duration(model.GetIntSetting("url_upload_timeout", 3600))*time.Second),
+	)
+	if res.Err != nil {
+		if res.Response != nil {
+			res.Response.Body.Close()
+		}
+
+		if errors.Is(res.Err, request.ErrURLNotAllowed) {
+			return nil, false, ErrURLNotAllowed.WithError(res.Err)
+		}
+		return nil, false, ErrFetchURLFailed.WithError(res.Err)
+	}
+
+	resp = res.Response
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return resp, false, nil
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 && contentRangeStart(resp) == int64(offset):
+		return resp, true, nil
+	}
+
+	resp.Body.Close()
+	return nil, false, ErrFetchURLFailed.WithError(fmt.Errorf("unexpected HTTP status %d", resp.StatusCode))
+}
+
+// URLUploadLimit 返回由服务端下载远程文件时允许的最大尺寸
+func (fs *FileSystem) URLUploadLimit() uint64 {
+	limit := fs.User.GetRemainingCapacity()
+	if fs.User.Policy.MaxSize > 0 && fs.User.Policy.MaxSize < limit {
+		limit = fs.User.Policy.MaxSize
+	}
+	return limit
+}
+
+// RemoteFileSize 返回响应对应的远程文件完整尺寸，未知时返回 -1
+func RemoteFileSize(resp *http.Response) int64 {
+	if resp.StatusCode != http.StatusPartialContent {
+		return resp.ContentLength
+	}
+
+	// Content-Range: bytes start-end/total
+	contentRange := resp.Header.Get("Content-Range")
+	if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+		if total, err := strconv.ParseInt(contentRange[i+1:], 10, 64); err == nil {
+			return total
+		}
+	}
+	return -1
+}
+
+// contentRangeStart 返回部分内容响应的起始位置，无法解析时返回 -1
+func contentRangeStart(resp *http.Response) int64 {
+	var start, end int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d", &start, &end); err != nil {
+		return -1
+	}
+	return start
+}
+
+// FileNameFromResponse 根据响应的 Content-Disposition 或最终请求的 URL 推断文件名
+func FileNameFromResponse(resp *http.Response) string {
+	return fileNameFromResponse(resp.Request.URL, resp.Header.Get("Content-Disposition"))
+}
+
+// fileNameFromResponse 根据 Content-Disposition 或最终请求的 URL 推断文件名
+func fileNameFromResponse(target *url.URL, disposition string) string {
+	if _, params, err := mime.ParseMediaType(disposition); err == nil && params["filename"] != "" {
+		return path.Base(params["filename"])
+	}
+
+	if name := path.Base(target.Path); name != "/" && name != "." {
+		return name
+	}
+
+	return target.Hostname()
+}
@@ -0,0 +1,75 @@
+package filesystem
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem_UploadFromURL(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_url_upload_allowed_hosts", "", 0)
+	cache.Set("setting_url_upload_denied_hosts", "evil.com", 0)
+	cache.Set("setting_url_upload_max_redirects", "3", 0)
+	cache.Set("setting_url_upload_timeout", "10", 0)
+
+	for _, target := range []string{
+		"::invalid",
+		"gopher://example.com/",
+		"http://127.0.0.1/1.txt",
+		"http://169.254.169.254/latest/meta-data",
+		"http://evil.com/1.txt",
+	} {
+		err := fs.UploadFromURL(context.Background(), target, "/", "")
+		asserts.Error(err, target)
+		asserts.Equal(ErrURLNotAllowed.Code, err.(serializer.AppError).Code, target)
+	}
+}
+
+func TestSizeLimitReader(t *testing.T) {
+	asserts := assert.New(t)
+
+	res, err := ioutil.ReadAll(&sizeLimitReader{reader: strings.NewReader("123"), limit: 3})
+	asserts.NoError(err)
+	asserts.Equal("123", string(res))
+
+	_, err = ioutil.ReadAll(&sizeLimitReader{reader: strings.NewReader("1234"), limit: 3})
+	asserts.Equal(ErrFileSizeTooBig, err)
+}
+
+func TestFileNameFromResponse(t *testing.T) {
+	asserts := assert.New(t)
+	target, _ := url.Parse("https://example.com/dir/a%20b.txt?x=1")
+	asserts.Equal("a b.txt", fileNameFromResponse(target, ""))
+	asserts.Equal("c.txt", fileNameFromResponse(target, `attachment; filename="../c.txt"`))
+
+	target, _ = url.Parse("https://example.com/")
+	asserts.Equal("example.com", fileNameFromResponse(target, ""))
+}
+
+func TestRemoteFileSize(t *testing.T) {
+	asserts := assert.New(t)
+
+	asserts.EqualValues(10, RemoteFileSize(&http.Response{StatusCode: 200, ContentLength: 10}))
+	asserts.EqualValues(-1, RemoteFileSize(&http.Response{StatusCode: 200, ContentLength: -1}))
+
+	partial := &http.Response{StatusCode: 206, Header: http.Header{}}
+	partial.Header.Set("Content-Range", "bytes 5-9/10")
+	asserts.EqualValues(10, RemoteFileSize(partial))
+	asserts.EqualValues(5, contentRangeStart(partial))
+
+	partial.Header.Set("Content-Range", "bytes 5-9/*")
+	asserts.EqualValues(-1, RemoteFileSize(partial))
+
+	partial.Header.Del("Content-Range")
+	asserts.EqualValues(-1, contentRangeStart(partial))
+}
@@ -2,17 +2,27 @@ package filesystem
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/HFO4/aliyun-oss-go-sdk/oss"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
+	"github.com/cloudreve/Cloudreve/v3/pkg/email"
+	"github.com/cloudreve/Cloudreve/v3/pkg/notify"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/juju/ratelimit"
+	cossdk "github.com/tencentyun/cos-go-sdk-v5"
 )
 
 /* ============
@@ -61,26 +71,57 @@ func (fs *FileSystem) AddFile(ctx context.Context, parent *model.Folder, file fs
 		FolderID:           parent.ID,
 		PolicyID:           fs.Policy.ID,
 		MetadataSerialized: uploadInfo.Metadata,
+		Shards:             uploadInfo.Shards,
 		UploadSessionID:    uploadInfo.UploadSessionID,
+		UploadClient:       uploadClientFromContext(ctx),
+		RetainUntil:        fs.retentionDeadline(parent),
+		StorageClass:       uploadInfo.StorageClass,
 	}
 
+	if newFile.StorageClass == "" {
+		newFile.StorageClass = fs.Policy.OptionsSerialized.StorageClass
+	}
+
+	// 按生命周期规则安排转换存储类型及删除的时间
+	newFile.TransitionAt, newFile.ExpireAt = model.EffectiveLifecycle(fs.User, fs.Policy).Schedule(time.Now())
+
 	if fs.Policy.IsThumbExist(uploadInfo.FileName) {
 		newFile.PicInfo = "1,1"
 	}
 
-	err = newFile.Create()
+	newFile.NameKey = model.UniqueNameKey(fs.User.ID, newFile.Name)
+
+	err = fs.createFile(&newFile)
 
 	if err != nil {
 		if err := fs.Trigger(ctx, "AfterValidateFailed", file); err != nil {
 			util.Log().Debug("AfterValidateFailed hook execution failed: %s", err)
 		}
-		return nil, ErrFileExisted.WithError(err)
+		return nil, err
 	}
 
 	fs.User.Storage += newFile.Size
 	return &newFile, nil
 }
 
+// createFile 创建文件记录。需唯一的文件名被同时进行的上传抢先使用时，插入会被唯一索引拒绝，
+// 此时重新查询以返回冲突文件的位置；查询不到时对方已回滚，重试一次
+func (fs *FileSystem) createFile(file *model.File) error {
+	err := file.Create()
+	if err != nil && file.NameKey != nil {
+		if conflict := fs.checkUniqueName(*file.NameKey, 0); conflict != nil {
+			return conflict
+		}
+		err = file.Create()
+	}
+
+	if err != nil {
+		return ErrFileExisted.WithError(err)
+	}
+
+	return nil
+}
+
 // GetPhysicalFileContent 根据文件物理路径获取文件流
 func (fs *FileSystem) GetPhysicalFileContent(ctx context.Context, path string) (response.RSCloser, error) {
 	// 重设上传策略
@@ -112,8 +153,20 @@ func (fs *FileSystem) Preview(ctx context.Context, id uint, isText bool) (*respo
 		return nil, ErrFileSizeTooBig
 	}
 
-	// 是否直接返回文件内容
-	if isText || fs.Policy.IsDirectlyPreview() {
+	// 视频已转码时预览转码后的文件
+	if !isText && fs.FileTarget[0].TranscodedSource != "" {
+		fs.FileTarget[0].SourceName = fs.FileTarget[0].TranscodedSource
+		fs.FileTarget[0].Shards = ""
+	}
+
+	// 文档已转换为 PDF 时预览转换后的文件
+	if !isText && fs.FileTarget[0].DocPreviewSource != "" {
+		fs.FileTarget[0].SourceName = fs.FileTarget[0].DocPreviewSource
+		fs.FileTarget[0].Shards = ""
+	}
+
+	// 是否直接返回文件内容，仅允许签名链接访问时重定向到签名的预览URL
+	if isText || (fs.Policy.IsDirectlyPreview() && !isSignedURLOnly(fs.Policy)) {
 		resp, err := fs.GetDownloadContent(ctx, id)
 		if err != nil {
 			return nil, err
@@ -159,34 +212,112 @@ func (fs *FileSystem) GetContent(ctx context.Context, id uint) (response.RSClose
 	}
 	ctx = context.WithValue(ctx, fsctx.FileModelCtx, fs.FileTarget[0])
 
+	// 设有下载密码的文件需先解锁
+	if err := checkFileUnlocked(ctx, &fs.FileTarget[0]); err != nil {
+		return nil, err
+	}
+
+	// 归档文件需解冻后才能读取
+	if err := fs.checkRestored(ctx, &fs.FileTarget[0]); err != nil {
+		return nil, err
+	}
+
+	// 待审核的文件不可通过分享访问
+	if err := checkApproved(ctx, &fs.FileTarget[0]); err != nil {
+		return nil, err
+	}
+
+	// 仅允许签名链接访问的存储策略需验证签名
+	if err := fs.checkSignedAccess(ctx, &fs.FileTarget[0]); err != nil {
+		return nil, err
+	}
+
+	// 通过分享读取时计入分享的下载次数
+	if err := CountShareDownload(ctx); err != nil {
+		return nil, err
+	}
+
 	// 获取文件流
-	rs, err := fs.Handler.Get(ctx, fs.FileTarget[0].SourceName)
+	rs, err := fs.OpenObject(ctx, &fs.FileTarget[0])
 	if err != nil {
-		return nil, ErrIO.WithError(err)
+		return nil, fs.checkSourceMissing(ctx, &fs.FileTarget[0], err)
 	}
 
 	return rs, nil
 }
 
+// checkSourceMissing 读取文件失败时，检查存储端对象是否已丢失。
+// 已丢失时将文件标记为源文件损坏并返回 ErrSourceMissing，否则返回 ErrIO
+func (fs *FileSystem) checkSourceMissing(ctx context.Context, file *model.File, readErr error) error {
+	if _, ok := fs.Handler.(driver.Stater); !ok || !model.IsTrueVal(model.GetSettingByName("broken_source_detect")) {
+		return ErrIO.WithError(readErr)
+	}
+
+	if _, err := fs.statObject(ctx, file); !errors.Is(err, driver.ErrObjectMissing) {
+		return ErrIO.WithError(readErr)
+	}
+
+	if !file.SourceBroken {
+		util.Log().Warning("Source of file %q (#%d) is missing in storage: %s", file.Name, file.ID, file.SourceName)
+		if err := file.UpdateSourceBroken(true); err != nil {
+			util.Log().Warning("Failed to mark file #%d as broken: %s", file.ID, err)
+		}
+
+		if model.IsTrueVal(model.GetSettingByName("broken_source_notify")) {
+			notifyBrokenSource(file)
+		}
+	}
+
+	return ErrSourceMissing.WithError(readErr)
+}
+
+// notifyBrokenSource 通知文件已丢失，默认发送给文件所有者及管理员
+func notifyBrokenSource(file *model.File) {
+	n := &notify.Notification{
+		Event: notify.EventSourceBroken,
+		Data: map[string]interface{}{
+			"file_id": file.ID,
+			"name":    file.Name,
+		},
+	}
+	if owner, err := model.GetUserByID(file.UserID); err == nil {
+		n.User = &owner
+	}
+
+	n.Title, n.Body = email.NewBrokenSourceEmail(file.Name)
+	notify.Send(n)
+}
+
 // deleteGroupedFile 对分组好的文件执行删除操作，
 // 返回每个分组失败的文件列表
 func (fs *FileSystem) deleteGroupedFile(ctx context.Context, files map[uint][]*model.File) map[uint][]string {
 	// 失败的文件列表
-	// TODO 并行删除
 	failed := make(map[uint][]string, len(files))
+	batches := make([]*deleteBatch, 0, len(files))
 
 	for policyID, toBeDeletedFiles := range files {
 		// 列举出需要物理删除的文件的物理路径
 		sourceNamesAll := make([]string, 0, len(toBeDeletedFiles))
 		uploadSessions := make([]*serializer.UploadSession, 0, len(toBeDeletedFiles))
+		placeholders := make(map[*model.File]*serializer.UploadSession)
 
 		for i := 0; i < len(toBeDeletedFiles); i++ {
 			sourceNamesAll = append(sourceNamesAll, toBeDeletedFiles[i].SourceName)
+			if toBeDeletedFiles[i].TranscodedSource != "" {
+				sourceNamesAll = append(sourceNamesAll, toBeDeletedFiles[i].TranscodedSource)
+			}
+			if toBeDeletedFiles[i].DocPreviewSource != "" {
+				sourceNamesAll = append(sourceNamesAll, toBeDeletedFiles[i].DocPreviewSource)
+			}
+			sourceNamesAll = append(sourceNamesAll, hlsSegmentObjects(toBeDeletedFiles[i])...)
+			sourceNamesAll = append(sourceNamesAll, shardObjects(toBeDeletedFiles[i].Shards)...)
 
 			if toBeDeletedFiles[i].UploadSessionID != nil {
+				placeholders[toBeDeletedFiles[i]] = nil
 				if session, ok := cache.Get(UploadSessionCachePrefix + *toBeDeletedFiles[i].UploadSessionID); ok {
 					uploadSession := session.(serializer.UploadSession)
 					uploadSessions = append(uploadSessions, &uploadSession)
+					placeholders[toBeDeletedFiles[i]] = &uploadSession
 				}
 
 			}
@@ -209,14 +340,148 @@ func (fs *FileSystem) deleteGroupedFile(ctx context.Context, files map[uint][]*m
 			cache.Deletes([]string{upSession.Key}, UploadSessionCachePrefix)
 		}
 
-		// 执行删除
-		failedFile, _ := fs.Handler.Delete(ctx, sourceNamesAll)
-		failed[policyID] = failedFile
+		// 清理未完成的上传暂存的分片数据
+		for placeholder, upSession := range placeholders {
+			fs.discardStagedUpload(ctx, placeholder, upSession)
+		}
+
+		// 按存储端单次批量删除的上限分批
+		failed[policyID] = []string{}
+		limit := deleteBatchLimit(fs.Policy.Type)
+		for i := 0; i < len(sourceNamesAll); i += limit {
+			end := i + limit
+			if end > len(sourceNamesAll) {
+				end = len(sourceNamesAll)
+			}
+			batches = append(batches, &deleteBatch{
+				policyID: policyID,
+				handler:  fs.Handler,
+				files:    sourceNamesAll[i:end],
+			})
+		}
+	}
+
+	// 执行删除
+	fs.deleteBatches(ctx, batches)
+	for _, batch := range batches {
+		failed[batch.policyID] = append(failed[batch.policyID], batch.failed...)
 	}
 
 	return failed
 }
 
+// deleteBatch 提交给同一存储端的一批待删除文件
+type deleteBatch struct {
+	policyID uint
+	handler  driver.Handler
+	files    []string
+	failed   []string
+}
+
+// 存储端单次批量删除的文件数量上限，未列出的存储策略使用 defaultDeleteBatchLimit
+var deleteBatchLimits = map[string]int{
+	"s3":       1000,
+	"oss":      1000,
+	"cos":      1000,
+	"qiniu":    1000,
+	"onedrive": 20,
+}
+
+const (
+	defaultDeleteBatchLimit = 1000
+	// deleteMaxRetries 存储端限流时单批删除的最大重试次数
+	deleteMaxRetries = 5
+)
+
+// deleteRetryInterval 存储端限流时首次重试前的等待时间，之后每次加倍
+var deleteRetryInterval = time.Second
+
+func deleteBatchLimit(policyType string) int {
+	if limit, ok := deleteBatchLimits[policyType]; ok {
+		return limit
+	}
+	return defaultDeleteBatchLimit
+}
+
+// deleteBatches 按 delete_concurrency 设定的并发数并行提交各批删除请求，
+// 删除失败的文件记录在每批的 failed 中
+func (fs *FileSystem) deleteBatches(ctx context.Context, batches []*deleteBatch) {
+	workers := model.GetIntSetting("delete_concurrency", 4)
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(batches) {
+		workers = len(batches)
+	}
+
+	queue := make(chan *deleteBatch, len(batches))
+	for _, batch := range batches {
+		queue <- batch
+	}
+	close(queue)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for batch := range queue {
+				batch.failed = deleteWithBackoff(ctx, batch.handler, batch.files)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deleteWithBackoff 删除一批文件，存储端限流时等待后重试仍未删除的文件，返回最终删除失败的文件
+func deleteWithBackoff(ctx context.Context, handler driver.Handler, files []string) []string {
+	interval := deleteRetryInterval
+	for retry := 0; ; retry++ {
+		failed, err := handler.Delete(ctx, files)
+		if len(failed) == 0 || !IsThrottleError(err) || retry >= deleteMaxRetries {
+			return failed
+		}
+
+		util.Log().Debug("Delete request throttled, retry %d file(s) after %s: %s", len(failed), interval, err)
+		select {
+		case <-ctx.Done():
+			return failed
+		case <-time.After(interval):
+		}
+
+		files = failed
+		interval *= 2
+	}
+}
+
+// IsThrottleError 判断存储端返回的错误是否表示请求过于频繁
+func IsThrottleError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var statusCode int
+	var awsErr awserr.Error
+	var ossErr oss.ServiceError
+	var cosErr *cossdk.ErrorResponse
+	switch {
+	case errors.As(err, &awsErr):
+		switch awsErr.Code() {
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests":
+			return true
+		}
+		if reqErr, ok := awsErr.(awserr.RequestFailure); ok {
+			statusCode = reqErr.StatusCode()
+		}
+	case errors.As(err, &ossErr):
+		statusCode = ossErr.StatusCode
+	case errors.As(err, &cosErr) && cosErr.Response != nil:
+		statusCode = cosErr.Response.StatusCode
+	}
+
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
 // GroupFileByPolicy 将目标文件按照存储策略分组
 func (fs *FileSystem) GroupFileByPolicy(ctx context.Context, files []model.File) map[uint][]*model.File {
 	var policyGroup = make(map[uint][]*model.File)
@@ -266,6 +531,11 @@ func (fs *FileSystem) GetSource(ctx context.Context, fileID uint) (string, error
 		return "", ErrObjectNotExist.WithError(err)
 	}
 
+	// 待审核的文件不可获取外链
+	if fs.FileTarget[0].IsPendingApproval() {
+		return "", ErrPendingApproval
+	}
+
 	// 检查存储策略是否可以获得外链
 	if !fs.Policy.IsOriginLinkEnable {
 		return "", serializer.NewError(
@@ -293,14 +563,36 @@ func (fs *FileSystem) SignURL(ctx context.Context, file *model.File, ttl int64,
 		return "", err
 	}
 
+	// 设有下载密码的文件需先解锁
+	if err := checkFileUnlocked(ctx, &fs.FileTarget[0]); err != nil {
+		return "", err
+	}
+
+	// 归档文件需解冻后才能读取
+	if err := fs.checkRestored(ctx, &fs.FileTarget[0]); err != nil {
+		return "", err
+	}
+
+	// 待审核的文件不可通过分享访问
+	if err := checkApproved(ctx, &fs.FileTarget[0]); err != nil {
+		return "", err
+	}
+
+	// 通过分享获取地址时计入分享的下载次数
+	if err := CountShareDownload(ctx); err != nil {
+		return "", err
+	}
+
 	// 签名最终URL
 	// 生成外链地址
 	siteURL := model.GetSiteURL()
-	source, err := fs.Handler.Source(ctx, fs.FileTarget[0].SourceName, *siteURL, ttl, isDownload, fs.User.Group.SpeedLimit)
+	handler := fs.shardSourceHandler(&fs.FileTarget[0])
+	source, err := handler.Source(ctx, fs.FileTarget[0].SourceName, *siteURL, ttl, isDownload, fs.User.Group.SpeedLimit)
 	if err != nil {
 		return "", serializer.NewError(serializer.CodeNotSet, "Failed to get source link", err)
 	}
 
+	fs.logSignedURL(&fs.FileTarget[0], ttl)
 	return source, nil
 }
 
@@ -3,10 +3,14 @@ package filesystem
 import (
 	"context"
 	"errors"
+	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HFO4/aliyun-oss-go-sdk/oss"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
@@ -15,6 +19,8 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+	cossdk "github.com/tencentyun/cos-go-sdk-v5"
 )
 
 func TestFileSystem_AddFile(t *testing.T) {
@@ -51,6 +57,7 @@ func TestFileSystem_AddFile(t *testing.T) {
 	mock.ExpectBegin()
 	mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec("UPDATE(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE(.+)type_usages(.+)").WithArgs(5, 1, model.FileTypeImage).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
 	f, err := fs.AddFile(context.Background(), &folder, &file)
@@ -92,6 +99,56 @@ func TestFileSystem_AddFile(t *testing.T) {
 	}
 }
 
+func TestFileSystem_AddFile_UniqueName(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_unique_name_exts", "pdf", 0)
+	cache.Set("setting_unique_name_scope", "user", 0)
+	defer cache.Deletes([]string{"unique_name_exts", "unique_name_scope"}, "setting_")
+	file := fsctx.FileStream{Size: 5, Name: "INV-001.pdf", SavePath: "/Uploads/INV-001.pdf"}
+	folder := model.Folder{Model: gorm.Model{ID: 1}}
+	fs := FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}, Policy: &model.Policy{Type: "cos"}}
+	nameKey := *model.UniqueNameKey(1, "INV-001.pdf")
+
+	// 同时上传的同名文件已创建，返回其位置
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnError(errors.New("Duplicate entry"))
+		mock.ExpectRollback()
+		mock.ExpectQuery("SELECT(.+)files(.+)name_key(.+)").WithArgs(nameKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "user_id", "folder_id"}).AddRow(2, "INV-001.pdf", 1, 3))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "parent_id", "owner_id"}).AddRow(3, "invoices", 1, 1))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "owner_id"}).AddRow(1, "/", 1))
+		f, err := fs.AddFile(context.Background(), &folder, &file)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Nil(f)
+		asserts.Error(err)
+		appErr, ok := err.(serializer.AppError)
+		asserts.True(ok)
+		asserts.Equal(serializer.CodeNameNotUnique, appErr.Code)
+		asserts.Equal("/invoices", appErr.Data.(serializer.Object).Path)
+	}
+
+	// 冲突的上传已回滚，重试成功
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnError(errors.New("Duplicate entry"))
+		mock.ExpectRollback()
+		mock.ExpectQuery("SELECT(.+)files(.+)name_key(.+)").WithArgs(nameKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		f, err := fs.AddFile(context.Background(), &folder, &file)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(nameKey, *f.NameKey)
+	}
+}
+
 func TestFileSystem_GetContent(t *testing.T) {
 	asserts := assert.New(t)
 	ctx := context.Background()
@@ -128,7 +185,8 @@ func TestFileSystem_GetContent(t *testing.T) {
 	asserts.NoError(mock.ExpectationsWereMet())
 	fs.CleanTargets()
 
-	// 打开文件失败
+	// 打开文件失败，未开启丢失检测
+	cache.Set("setting_broken_source_detect", "0", 0)
 	cache.Deletes([]string{"1"}, "policy_")
 	mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "source_name", "policy_id"}).AddRow(1, "TestFileSystem_GetContent2.txt", 1))
 	mock.ExpectQuery("SELECT(.+)poli(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "type", "source_name"}).AddRow(1, "local", "not exist"))
@@ -138,6 +196,23 @@ func TestFileSystem_GetContent(t *testing.T) {
 	asserts.NoError(mock.ExpectationsWereMet())
 	fs.CleanTargets()
 
+	// 存储端对象已丢失，标记文件
+	cache.Set("setting_broken_source_detect", "1", 0)
+	cache.Set("setting_broken_source_notify", "0", 0)
+	cache.Deletes([]string{"1"}, "policy_")
+	mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "source_name", "policy_id"}).AddRow(1, "TestFileSystem_GetContent2.txt", 1))
+	mock.ExpectQuery("SELECT(.+)poli(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "type", "source_name"}).AddRow(1, "local", "not exist"))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)source_broken(.+)").WithArgs(true, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rs, err = fs.GetContent(ctx, 1)
+	asserts.Equal(serializer.CodeSourceMissing, err.(serializer.AppError).Code)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.True(fs.FileTarget[0].SourceBroken)
+	fs.CleanTargets()
+	cache.Deletes([]string{"broken_source_detect", "broken_source_notify"}, "setting_")
+
 	// 打开成功
 	cache.Deletes([]string{"1"}, "policy_")
 	mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "source_name", "policy_id", "source_name"}).AddRow(1, "TestFileSystem_GetContent.txt", 1, "TestFileSystem_GetContent.txt"))
@@ -314,6 +389,73 @@ func TestFileSystem_deleteGroupedFile(t *testing.T) {
 	}
 }
 
+func TestFileSystem_deleteGroupedFileBatches(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	deleteBatchLimits["mock"] = 2
+	defer delete(deleteBatchLimits, "mock")
+	cache.Set("setting_delete_concurrency", "2", 0)
+
+	testHandler := new(FileHeaderMock)
+	testHandler.On("Delete", testMock.Anything, []string{"1.txt", "2.txt"}).Return([]string{}, nil)
+	testHandler.On("Delete", testMock.Anything, []string{"3.txt"}).Return([]string{"3.txt"}, errors.New("error"))
+	fs := FileSystem{Handler: testHandler}
+	policy := model.Policy{Model: gorm.Model{ID: 1}, Type: "mock"}
+	files := []model.File{
+		{PolicyID: 1, SourceName: "1.txt", Policy: policy},
+		{PolicyID: 1, SourceName: "2.txt", Policy: policy},
+		{PolicyID: 1, SourceName: "3.txt", Policy: policy},
+	}
+
+	failed := fs.deleteGroupedFile(ctx, fs.GroupFileByPolicy(ctx, files))
+	asserts.Equal(map[uint][]string{1: {"3.txt"}}, failed)
+	testHandler.AssertExpectations(t)
+}
+
+func TestDeleteWithBackoff(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	deleteRetryInterval = time.Millisecond
+	defer func() { deleteRetryInterval = time.Second }()
+	throttled := awserr.NewRequestFailure(awserr.New("SlowDown", "slow down", nil), 503, "")
+
+	// 限流后重试失败的部分
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Delete", testMock.Anything, []string{"1.txt", "2.txt"}).Return([]string{"2.txt"}, throttled).Once()
+		testHandler.On("Delete", testMock.Anything, []string{"2.txt"}).Return([]string{}, nil).Once()
+		asserts.Empty(deleteWithBackoff(ctx, testHandler, []string{"1.txt", "2.txt"}))
+		testHandler.AssertExpectations(t)
+	}
+
+	// 非限流错误不重试
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Delete", testMock.Anything, []string{"1.txt"}).Return([]string{"1.txt"}, errors.New("error")).Once()
+		asserts.Equal([]string{"1.txt"}, deleteWithBackoff(ctx, testHandler, []string{"1.txt"}))
+		testHandler.AssertExpectations(t)
+	}
+
+	// 超过最大重试次数
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Delete", testMock.Anything, []string{"1.txt"}).Return([]string{"1.txt"}, throttled).Times(deleteMaxRetries + 1)
+		asserts.Equal([]string{"1.txt"}, deleteWithBackoff(ctx, testHandler, []string{"1.txt"}))
+		testHandler.AssertExpectations(t)
+	}
+}
+
+func TestIsThrottleError(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.False(IsThrottleError(nil))
+	asserts.False(IsThrottleError(errors.New("error")))
+	asserts.True(IsThrottleError(awserr.New("SlowDown", "", nil)))
+	asserts.True(IsThrottleError(awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 429, "")))
+	asserts.False(IsThrottleError(awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, "")))
+	asserts.True(IsThrottleError(oss.ServiceError{StatusCode: 503}))
+	asserts.True(IsThrottleError(&cossdk.ErrorResponse{Response: &http.Response{StatusCode: 429}}))
+}
+
 func TestFileSystem_GetSource(t *testing.T) {
 	asserts := assert.New(t)
 	ctx := context.Background()
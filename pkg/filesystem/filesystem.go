@@ -127,6 +127,11 @@ func (fs *FileSystem) DispatchHandler() error {
 	policyType := fs.Policy.Type
 	currentPolicy := fs.Policy
 
+	// 出站代理设置无效时拒绝初始化驱动，避免请求绕过代理
+	if _, err := currentPolicy.OutboundProxyURL(); err != nil {
+		return err
+	}
+
 	switch policyType {
 	case "mock", "anonymous":
 		return nil
@@ -161,15 +166,17 @@ func (fs *FileSystem) DispatchHandler() error {
 	case "cos":
 		u, _ := url.Parse(currentPolicy.Server)
 		b := &cossdk.BaseURL{BucketURL: u}
+		outbound, _ := request.NewOutboundTransport(currentPolicy)
 		fs.Handler = cos.Driver{
 			Policy: currentPolicy,
 			Client: cossdk.NewClient(b, &http.Client{
 				Transport: &cossdk.AuthorizationTransport{
 					SecretID:  currentPolicy.AccessKey,
 					SecretKey: currentPolicy.SecretKey,
+					Transport: outbound,
 				},
 			}),
-			HTTPClient: request.NewClient(),
+			HTTPClient: request.NewClient(request.WithPolicyOutbound(currentPolicy)),
 		}
 		return nil
 	case "s3":
@@ -219,6 +219,7 @@ func TestNewAnonymousFileSystem(t *testing.T) {
 	// 从机
 	{
 		conf.SystemConfig.Mode = "slave"
+		defer func() { conf.SystemConfig.Mode = "master" }()
 		fs, err := NewAnonymousFileSystem()
 		asserts.NoError(mock.ExpectationsWereMet())
 		asserts.NoError(err)
@@ -35,4 +35,26 @@ const (
 	CancelFuncCtx
 	// 文件在从机节点中的路径
 	SlaveSrcPath
+	// ClientIPCtx 发起请求的客户端 IP
+	ClientIPCtx
+	// UploadPermissionCtx 本次上传指定的文件默认权限
+	UploadPermissionCtx
+	// UploadClientCtx 发起上传的客户端标识
+	UploadClientCtx
+	// PostProcessWaiterCtx 跟踪上传后处理任务，存在时可同步等待处理结果
+	PostProcessWaiterCtx
+	// RetentionBypassCtx 有权忽略文件保留期的操作者
+	RetentionBypassCtx
+	// UploadChecksumCtx 客户端声明的完整文件 MD5
+	UploadChecksumCtx
+	// ShareDownloadCtx 通过分享读取文件时的分享及下载者信息
+	ShareDownloadCtx
+	// FileUnlockCtx 读取设有下载密码的文件时使用的解锁凭证
+	FileUnlockCtx
+	// UploadStagingCtx 分片上传暂存数据的存放位置
+	UploadStagingCtx
+	// SignedAccessCtx 请求已通过签名验证
+	SignedAccessCtx
+	// InternalReadCtx 系统内部处理文件时的读取，不受面向用户的读取限制
+	InternalReadCtx
 )
@@ -1,6 +1,7 @@
 package fsctx
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"time"
@@ -28,6 +29,9 @@ type UploadTaskInfo struct {
 	AppendStart     uint64
 	Model           interface{}
 	Src             string
+	StorageClass    string            // 存储端的存储类型，为空时使用存储策略设定
+	Tags            map[string]string // 存储端对象标签，仅 S3、OSS 有效
+	Shards          string            // 拆分为多个对象存储时的分片清单，为空表示以单个对象存储
 }
 
 // FileHeader 上传来的文件数据处理器
@@ -38,6 +42,9 @@ type FileHeader interface {
 	Info() *UploadTaskInfo
 	SetSize(uint64)
 	SetModel(fileModel interface{})
+	SetName(name string)
+	SetMetadata(key, value string)
+	Peek(n int) ([]byte, error)
 	Seekable() bool
 }
 
@@ -57,6 +64,9 @@ type FileStream struct {
 	AppendStart     uint64
 	Model           interface{}
 	Src             string
+	StorageClass    string
+	Tags            map[string]string
+	Shards          string
 }
 
 func (file *FileStream) Read(p []byte) (n int, err error) {
@@ -83,6 +93,34 @@ func (file *FileStream) Seek(offset int64, whence int) (int64, error) {
 	return 0, errors.New("no seeker")
 }
 
+// Peek 返回上传内容开头至多 n 字节，之后的读取仍从这些字节开始
+func (file *FileStream) Peek(n int) ([]byte, error) {
+	if file.File == nil {
+		return nil, nil
+	}
+
+	buf := make([]byte, n)
+	read, err := io.ReadFull(file.File, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	buf = buf[:read]
+
+	if file.Seekable() {
+		_, err := file.Seeker.Seek(int64(-read), io.SeekCurrent)
+		return buf, err
+	}
+
+	file.File = &peekedReader{Reader: io.MultiReader(bytes.NewReader(buf), file.File), Closer: file.File}
+	return buf, nil
+}
+
+// peekedReader 将已预读的内容放回原始流之前
+type peekedReader struct {
+	io.Reader
+	io.Closer
+}
+
 func (file *FileStream) Seekable() bool {
 	return file.Seeker != nil
 }
@@ -101,6 +139,9 @@ func (file *FileStream) Info() *UploadTaskInfo {
 		AppendStart:     file.AppendStart,
 		Model:           file.Model,
 		Src:             file.Src,
+		StorageClass:    file.StorageClass,
+		Tags:            file.Tags,
+		Shards:          file.Shards,
 	}
 }
 
@@ -111,3 +152,14 @@ func (file *FileStream) SetSize(size uint64) {
 func (file *FileStream) SetModel(fileModel interface{}) {
 	file.Model = fileModel
 }
+
+func (file *FileStream) SetName(name string) {
+	file.Name = name
+}
+
+func (file *FileStream) SetMetadata(key, value string) {
+	if file.Metadata == nil {
+		file.Metadata = make(map[string]string)
+	}
+	file.Metadata[key] = value
+}
@@ -75,4 +75,42 @@ func TestFileStream_Info(t *testing.T) {
 
 	file.SetModel(&model.File{})
 	a.NotNil(file.Info().Model)
+
+	file.SetMetadata("key", "value")
+	a.Equal("value", file.Info().Metadata["key"])
+}
+
+func TestFileStream_Peek(t *testing.T) {
+	a := assert.New(t)
+
+	// 无内容
+	{
+		file := FileStream{}
+		res, err := file.Peek(3)
+		a.NoError(err)
+		a.Empty(res)
+	}
+
+	// 不可定位
+	{
+		file := FileStream{File: ioutil.NopCloser(strings.NewReader("12345"))}
+		res, err := file.Peek(3)
+		a.NoError(err)
+		a.Equal("123", string(res))
+		content, err := ioutil.ReadAll(&file)
+		a.NoError(err)
+		a.Equal("12345", string(content))
+	}
+
+	// 可定位，内容短于 n
+	{
+		reader := strings.NewReader("12")
+		file := FileStream{File: ioutil.NopCloser(reader), Seeker: reader}
+		res, err := file.Peek(3)
+		a.NoError(err)
+		a.Equal("12", string(res))
+		content, err := ioutil.ReadAll(&file)
+		a.NoError(err)
+		a.Equal("12", string(content))
+	}
 }
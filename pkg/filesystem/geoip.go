@@ -0,0 +1,167 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// UploadCountryMetadataKey 文件元数据中记录上传来源国家或地区代码的键
+const UploadCountryMetadataKey = "upload_country"
+
+// 上传来源地区的限制方式
+const (
+	// UploadRegionPolicyAllow 仅允许列表中的国家或地区
+	UploadRegionPolicyAllow = "allow"
+	// UploadRegionPolicyDeny 拒绝列表中的国家或地区
+	UploadRegionPolicyDeny = "deny"
+)
+
+var errGeoIPNotFound = errors.New("IP address not found in GeoIP database")
+
+// geoIPDatabase 已加载的 GeoIP 数据库，文件路径或修改时间变化时重新加载
+type geoIPDatabase struct {
+	path    string
+	modTime time.Time
+	reader  *maxminddb.Reader
+}
+
+var (
+	geoIPLock sync.Mutex
+	geoIP     *geoIPDatabase
+)
+
+// geoIPCountryRecord GeoIP2/GeoLite2 Country 及 City 数据库中与国家相关的字段
+type geoIPCountryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// openGeoIP 返回 upload_geoip_database 设定的 MaxMind DB 格式数据库。
+// 数据库整体读入内存，重新加载时进行中的查询不受影响
+func openGeoIP() (*maxminddb.Reader, error) {
+	path := model.GetSettingByName("upload_geoip_database")
+	if path == "" {
+		return nil, errors.New("GeoIP database is not configured")
+	}
+
+	stat, err := os.Stat(util.RelativePath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	geoIPLock.Lock()
+	defer geoIPLock.Unlock()
+	if geoIP != nil && geoIP.path == path && geoIP.modTime.Equal(stat.ModTime()) {
+		return geoIP.reader, nil
+	}
+
+	content, err := os.ReadFile(util.RelativePath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := maxminddb.FromBytes(content)
+	if err != nil {
+		return nil, err
+	}
+
+	geoIP = &geoIPDatabase{path: path, modTime: stat.ModTime(), reader: reader}
+	return reader, nil
+}
+
+// LookupCountry 返回 IP 所属国家或地区的 ISO 3166-1 代码，数据库中未记录国家时使用注册国家
+func LookupCountry(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("invalid IP address %q", ip)
+	}
+
+	reader, err := openGeoIP()
+	if err != nil {
+		return "", err
+	}
+
+	var record geoIPCountryRecord
+	if err := reader.Lookup(parsed, &record); err != nil {
+		return "", err
+	}
+
+	country := record.Country.ISOCode
+	if country == "" {
+		country = record.RegisteredCountry.ISOCode
+	}
+	if country == "" {
+		return "", errGeoIPNotFound
+	}
+
+	return strings.ToUpper(country), nil
+}
+
+// IsUploadRegionPolicyEnabled 返回是否按上传来源地区限制上传
+func IsUploadRegionPolicyEnabled() bool {
+	return model.IsTrueVal(model.GetSettingByName("upload_geoip_enabled"))
+}
+
+// isUploadRegionAllowed 返回 upload_geoip_policy 及 upload_geoip_countries 是否允许来自 country 的上传。
+// 允许列表为空时拒绝所有地区
+func isUploadRegionAllowed(country string) bool {
+	listed := false
+	for _, code := range strings.Split(model.GetSettingByName("upload_geoip_countries"), ",") {
+		if strings.EqualFold(strings.TrimSpace(code), country) {
+			listed = true
+			break
+		}
+	}
+
+	if model.GetSettingByName("upload_geoip_policy") == UploadRegionPolicyAllow {
+		return listed
+	}
+
+	return !listed
+}
+
+// HookValidateUploadRegion 按客户端 IP 所属国家或地区限制上传，并将其记录在文件元数据中。
+// 未携带客户端 IP 的上传由服务端发起，不做限制；无法确定地区时按 upload_geoip_fail_open 放行或拒绝
+func HookValidateUploadRegion(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+	clientIP, ok := ctx.Value(fsctx.ClientIPCtx).(string)
+	if !ok || clientIP == "" {
+		return nil
+	}
+
+	country, err := LookupCountry(clientIP)
+	if err != nil {
+		if model.IsTrueVal(model.GetSettingByName("upload_geoip_fail_open")) {
+			util.Log().Warning("Failed to resolve country of upload client %q, upload allowed: %s", clientIP, err)
+			return nil
+		}
+
+		return ErrUploadRegionUnknown.WithError(err)
+	}
+
+	if !isUploadRegionAllowed(country) {
+		return ErrUploadRegionDenied.WithData(map[string]string{"country": country})
+	}
+
+	// 覆盖已有文件时，上传信息中的元数据不会写入文件
+	if originFile, ok := ctx.Value(fsctx.FileModelCtx).(model.File); ok {
+		return updateMetadataValue(&originFile, UploadCountryMetadataKey, country)
+	}
+
+	file.SetMetadata(UploadCountryMetadataKey, country)
+	return nil
+}
@@ -0,0 +1,267 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// mmdbControl 返回 MaxMind DB 数据段中指定类型和长度的控制字节
+func mmdbControl(typeNum, size int) []byte {
+	return []byte{byte(typeNum<<5 | size)}
+}
+
+func mmdbString(s string) []byte {
+	return append(mmdbControl(2, len(s)), s...)
+}
+
+func mmdbUint(typeNum int, v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, v)
+	buf = bytes.TrimLeft(buf, "\x00")
+	return append(mmdbControl(typeNum, len(buf)), buf...)
+}
+
+// buildTestGeoIPDatabase 生成仅记录给定 IPv4 网段所属国家的 MaxMind DB 数据库
+func buildTestGeoIPDatabase(networks map[string]string) []byte {
+	const (
+		empty = -1
+		node  = 0
+		data  = 1
+	)
+	type record struct {
+		kind  int
+		value int
+	}
+
+	// 数据段
+	dataSection := &bytes.Buffer{}
+	offsets := make(map[string]int)
+	for _, country := range networks {
+		if _, ok := offsets[country]; ok {
+			continue
+		}
+		offsets[country] = dataSection.Len()
+		dataSection.Write(mmdbControl(7, 1))
+		dataSection.Write(mmdbString("country"))
+		dataSection.Write(mmdbControl(7, 1))
+		dataSection.Write(mmdbString("iso_code"))
+		dataSection.Write(mmdbString(country))
+	}
+
+	// 搜索树
+	nodes := [][2]record{{{kind: empty}, {kind: empty}}}
+	for cidr, country := range networks {
+		_, network, _ := net.ParseCIDR(cidr)
+		ones, _ := network.Mask.Size()
+		ip := binary.BigEndian.Uint32(network.IP.To4())
+		current := 0
+		for i := 0; i < ones; i++ {
+			bit := (ip >> (31 - i)) & 1
+			if i == ones-1 {
+				nodes[current][bit] = record{kind: data, value: offsets[country]}
+				break
+			}
+			if nodes[current][bit].kind != node {
+				nodes = append(nodes, [2]record{{kind: empty}, {kind: empty}})
+				nodes[current][bit] = record{kind: node, value: len(nodes) - 1}
+			}
+			current = nodes[current][bit].value
+		}
+	}
+
+	db := &bytes.Buffer{}
+	for _, n := range nodes {
+		for _, r := range n {
+			value := len(nodes)
+			switch r.kind {
+			case node:
+				value = r.value
+			case data:
+				value = len(nodes) + 16 + r.value
+			}
+			db.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	db.Write(make([]byte, 16))
+	db.Write(dataSection.Bytes())
+
+	// 元数据
+	db.WriteString("\xAB\xCD\xEFMaxMind.com")
+	db.Write(mmdbControl(7, 6))
+	db.Write(mmdbString("node_count"))
+	db.Write(mmdbUint(6, uint32(len(nodes))))
+	db.Write(mmdbString("record_size"))
+	db.Write(mmdbUint(5, 24))
+	db.Write(mmdbString("ip_version"))
+	db.Write(mmdbUint(5, 4))
+	db.Write(mmdbString("binary_format_major_version"))
+	db.Write(mmdbUint(5, 2))
+	db.Write(mmdbString("binary_format_minor_version"))
+	db.Write(mmdbUint(5, 0))
+	db.Write(mmdbString("database_type"))
+	db.Write(mmdbString("Test-Country"))
+	return db.Bytes()
+}
+
+func setupTestGeoIPDatabase(t *testing.T) {
+	content := buildTestGeoIPDatabase(map[string]string{
+		"1.0.0.0/8":  "cn",
+		"8.8.8.0/24": "US",
+	})
+	if err := os.WriteFile(util.RelativePath("TestGeoIP.mmdb"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache.Set("setting_upload_geoip_database", "TestGeoIP.mmdb", 0)
+	t.Cleanup(func() {
+		os.Remove(util.RelativePath("TestGeoIP.mmdb"))
+		cache.Deletes([]string{
+			"upload_geoip_database",
+			"upload_geoip_policy",
+			"upload_geoip_countries",
+			"upload_geoip_fail_open",
+		}, "setting_")
+	})
+}
+
+func TestLookupCountry(t *testing.T) {
+	asserts := assert.New(t)
+	setupTestGeoIPDatabase(t)
+
+	// 成功
+	{
+		country, err := LookupCountry("1.2.3.4")
+		asserts.NoError(err)
+		asserts.Equal("CN", country)
+
+		country, err = LookupCountry("8.8.8.8")
+		asserts.NoError(err)
+		asserts.Equal("US", country)
+	}
+
+	// 未记录
+	{
+		_, err := LookupCountry("8.8.4.4")
+		asserts.Equal(errGeoIPNotFound, err)
+	}
+
+	// 无效 IP
+	{
+		_, err := LookupCountry("invalid")
+		asserts.Error(err)
+	}
+
+	// 数据库不存在
+	{
+		cache.Set("setting_upload_geoip_database", "not_exist.mmdb", 0)
+		_, err := LookupCountry("1.2.3.4")
+		asserts.Error(err)
+	}
+
+	// 未设定数据库
+	{
+		cache.Set("setting_upload_geoip_database", "", 0)
+		_, err := LookupCountry("1.2.3.4")
+		asserts.Error(err)
+	}
+}
+
+func TestIsUploadRegionAllowed(t *testing.T) {
+	asserts := assert.New(t)
+	defer cache.Deletes([]string{"upload_geoip_policy", "upload_geoip_countries"}, "setting_")
+
+	cache.Set("setting_upload_geoip_countries", "cn, us", 0)
+	cache.Set("setting_upload_geoip_policy", UploadRegionPolicyDeny, 0)
+	asserts.False(isUploadRegionAllowed("CN"))
+	asserts.True(isUploadRegionAllowed("JP"))
+
+	cache.Set("setting_upload_geoip_policy", UploadRegionPolicyAllow, 0)
+	asserts.True(isUploadRegionAllowed("US"))
+	asserts.False(isUploadRegionAllowed("JP"))
+
+	// 允许列表为空
+	cache.Set("setting_upload_geoip_countries", "", 0)
+	asserts.False(isUploadRegionAllowed("US"))
+}
+
+func TestHookValidateUploadRegion(t *testing.T) {
+	asserts := assert.New(t)
+	setupTestGeoIPDatabase(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_upload_geoip_policy", UploadRegionPolicyDeny, 0)
+	cache.Set("setting_upload_geoip_countries", "CN", 0)
+
+	// 服务端发起的上传
+	{
+		file := &fsctx.FileStream{}
+		asserts.NoError(HookValidateUploadRegion(context.Background(), fs, file))
+		asserts.Nil(file.Metadata)
+	}
+
+	// 允许，记录地区
+	{
+		file := &fsctx.FileStream{}
+		ctx := context.WithValue(context.Background(), fsctx.ClientIPCtx, "8.8.8.8")
+		asserts.NoError(HookValidateUploadRegion(ctx, fs, file))
+		asserts.Equal("US", file.Metadata[UploadCountryMetadataKey])
+	}
+
+	// 拒绝
+	{
+		file := &fsctx.FileStream{}
+		ctx := context.WithValue(context.Background(), fsctx.ClientIPCtx, "1.1.1.1")
+		err := HookValidateUploadRegion(ctx, fs, file)
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeUploadRegionDenied, err.(serializer.AppError).Code)
+		asserts.Nil(file.Metadata)
+	}
+
+	// 覆盖已有文件，记录到文件元数据
+	{
+		file := &fsctx.FileStream{}
+		ctx := context.WithValue(context.Background(), fsctx.ClientIPCtx, "8.8.8.8")
+		ctx = context.WithValue(ctx, fsctx.FileModelCtx, model.File{
+			Model:              gorm.Model{ID: 1},
+			MetadataSerialized: map[string]string{"k": "v"},
+		})
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)metadata(.+)").
+			WithArgs(`{"k":"v","upload_country":"US"}`, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(HookValidateUploadRegion(ctx, fs, file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Nil(file.Metadata)
+	}
+
+	// 无法确定地区，放行
+	{
+		cache.Set("setting_upload_geoip_fail_open", "1", 0)
+		file := &fsctx.FileStream{}
+		ctx := context.WithValue(context.Background(), fsctx.ClientIPCtx, "8.8.4.4")
+		asserts.NoError(HookValidateUploadRegion(ctx, fs, file))
+		asserts.Nil(file.Metadata)
+	}
+
+	// 无法确定地区，拒绝
+	{
+		cache.Set("setting_upload_geoip_fail_open", "0", 0)
+		file := &fsctx.FileStream{}
+		ctx := context.WithValue(context.Background(), fsctx.ClientIPCtx, "8.8.4.4")
+		err := HookValidateUploadRegion(ctx, fs, file)
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeUploadRegionDenied, err.(serializer.AppError).Code)
+	}
+}
@@ -0,0 +1,446 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+/* ==============
+     钩子测试工具
+   ==============
+*/
+
+// memoryDriver 将文件内容保存在内存中的存储适配器
+type memoryDriver struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemoryDriver() *memoryDriver {
+	return &memoryDriver{objects: make(map[string][]byte)}
+}
+
+// memoryObject 内存中对象的只读副本
+type memoryObject struct {
+	*bytes.Reader
+}
+
+func (memoryObject) Close() error {
+	return nil
+}
+
+func (d *memoryDriver) Put(ctx context.Context, file fsctx.FileHeader) error {
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.objects[file.Info().SavePath] = content
+	return nil
+}
+
+func (d *memoryDriver) Delete(ctx context.Context, files []string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, path := range files {
+		delete(d.objects, path)
+	}
+	return []string{}, nil
+}
+
+func (d *memoryDriver) Get(ctx context.Context, path string) (response.RSCloser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	content, ok := d.objects[path]
+	if !ok {
+		return nil, driver.ErrObjectMissing
+	}
+	return memoryObject{bytes.NewReader(content)}, nil
+}
+
+func (d *memoryDriver) Stat(ctx context.Context, path string) (*response.Object, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	content, ok := d.objects[path]
+	if !ok {
+		return nil, driver.ErrObjectMissing
+	}
+	return &response.Object{Name: path, Source: path, Size: uint64(len(content))}, nil
+}
+
+func (d *memoryDriver) Thumb(ctx context.Context, path string) (*response.ContentResponse, error) {
+	return nil, errors.New("未实现")
+}
+
+func (d *memoryDriver) Source(ctx context.Context, path string, url url.URL, ttl int64, isDownload bool, speed int) (string, error) {
+	return "", errors.New("未实现")
+}
+
+func (d *memoryDriver) Token(ctx context.Context, ttl int64, uploadSession *serializer.UploadSession, file fsctx.FileHeader) (*serializer.UploadCredential, error) {
+	return &serializer.UploadCredential{}, nil
+}
+
+func (d *memoryDriver) CancelToken(ctx context.Context, uploadSession *serializer.UploadSession) error {
+	return nil
+}
+
+func (d *memoryDriver) List(ctx context.Context, path string, recursive bool) ([]response.Object, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := make([]response.Object, 0, len(d.objects))
+	for name, content := range d.objects {
+		if strings.HasPrefix(name, path) {
+			res = append(res, response.Object{Name: name, Source: name, Size: uint64(len(content))})
+		}
+	}
+	return res, nil
+}
+
+// hookHarness 以内存存储适配器、虚构的用户与存储策略构建文件系统，
+// 用于注册钩子、触发事件并检查执行结果
+type hookHarness struct {
+	t      *testing.T
+	fs     *FileSystem
+	driver *memoryDriver
+	ctx    context.Context
+	err    error
+}
+
+// newHookHarness 创建钩子测试工具，用户 ID 为 1，容量 1 MB，存储策略不限制文件大小与类型
+func newHookHarness(t *testing.T) *hookHarness {
+	d := newMemoryDriver()
+	return &hookHarness{
+		t: t,
+		fs: &FileSystem{
+			User: &model.User{
+				Model: gorm.Model{ID: 1},
+				Group: model.Group{MaxStorage: 1 << 20},
+			},
+			Policy:  &model.Policy{Model: gorm.Model{ID: 1}, Type: "memory"},
+			Handler: d,
+		},
+		driver: d,
+		ctx:    context.Background(),
+	}
+}
+
+// WithUser 修改虚构的用户
+func (h *hookHarness) WithUser(f func(user *model.User)) *hookHarness {
+	f(h.fs.User)
+	return h
+}
+
+// WithPolicy 修改虚构的存储策略
+func (h *hookHarness) WithPolicy(f func(policy *model.Policy)) *hookHarness {
+	f(h.fs.Policy)
+	return h
+}
+
+// WithContext 设定触发钩子时使用的上下文
+func (h *hookHarness) WithContext(ctx context.Context) *hookHarness {
+	h.ctx = ctx
+	return h
+}
+
+// Use 依次为事件注册钩子
+func (h *hookHarness) Use(name string, hooks ...Hook) *hookHarness {
+	for _, hook := range hooks {
+		h.fs.Use(name, hook)
+	}
+	return h
+}
+
+// Trigger 触发事件，记录返回的错误
+func (h *hookHarness) Trigger(name string, file fsctx.FileHeader) *hookHarness {
+	h.err = h.fs.Trigger(h.ctx, name, file)
+	return h
+}
+
+// Upload 模拟上传流程：触发 BeforeUpload，写入存储端，再触发 AfterUpload，
+// 任一环节出错时停止并记录错误
+func (h *hookHarness) Upload(file *fsctx.FileStream) *hookHarness {
+	if h.err = h.fs.Trigger(h.ctx, "BeforeUpload", file); h.err != nil {
+		return h
+	}
+	if file.SavePath == "" {
+		file.SavePath = file.Name
+	}
+	if h.err = h.fs.Handler.Put(h.ctx, file); h.err != nil {
+		return h
+	}
+	h.err = h.fs.Trigger(h.ctx, "AfterUpload", file)
+	return h
+}
+
+// AssertNoError 断言最近一次执行未返回错误
+func (h *hookHarness) AssertNoError() *hookHarness {
+	h.t.Helper()
+	assert.NoError(h.t, h.err)
+	return h
+}
+
+// AssertError 断言最近一次执行返回了 expected 错误，serializer.AppError 按错误码比较
+func (h *hookHarness) AssertError(expected error) *hookHarness {
+	h.t.Helper()
+	var expectedAppErr, actualAppErr serializer.AppError
+	if errors.As(expected, &expectedAppErr) && errors.As(h.err, &actualAppErr) {
+		assert.Equal(h.t, expectedAppErr.Code, actualAppErr.Code)
+		return h
+	}
+	assert.Equal(h.t, expected, h.err)
+	return h
+}
+
+// AssertStored 断言存储端 path 处保存的内容
+func (h *hookHarness) AssertStored(path string, content []byte) *hookHarness {
+	h.t.Helper()
+	h.driver.mu.Lock()
+	stored, ok := h.driver.objects[path]
+	h.driver.mu.Unlock()
+	if assert.True(h.t, ok, "object %q is not stored", path) {
+		assert.Equal(h.t, content, stored)
+	}
+	return h
+}
+
+// AssertNotStored 断言存储端 path 处没有对象
+func (h *hookHarness) AssertNotStored(path string) *hookHarness {
+	h.t.Helper()
+	h.driver.mu.Lock()
+	_, ok := h.driver.objects[path]
+	h.driver.mu.Unlock()
+	assert.False(h.t, ok, "object %q should not be stored", path)
+	return h
+}
+
+// AssertRecordedSize 断言钩子为文件创建的记录大小及用户已用容量
+func (h *hookHarness) AssertRecordedSize(file fsctx.FileHeader, size uint64, storage uint64) *hookHarness {
+	h.t.Helper()
+	if fileModel, ok := file.Info().Model.(*model.File); assert.True(h.t, ok, "file model is not set") {
+		assert.Equal(h.t, size, fileModel.Size)
+	}
+	assert.Equal(h.t, storage, h.fs.User.Storage)
+	return h
+}
+
+// newHarnessFile 创建内容为 content 的待上传文件
+func newHarnessFile(name, content string) *fsctx.FileStream {
+	return &fsctx.FileStream{
+		File:        ioutil.NopCloser(strings.NewReader(content)),
+		Size:        uint64(len(content)),
+		Name:        name,
+		VirtualPath: "/",
+	}
+}
+
+/* ==============
+     钩子测试用例
+   ==============
+*/
+
+func TestHookHarness_Trigger(t *testing.T) {
+	errFirst := errors.New("first")
+	var called []string
+	record := func(name string, err error) Hook {
+		return func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			called = append(called, name)
+			return err
+		}
+	}
+
+	// 按注册顺序执行
+	{
+		called = nil
+		newHookHarness(t).
+			Use("BeforeUpload", record("a", nil), record("b", nil), record("c", nil)).
+			Trigger("BeforeUpload", newHarnessFile("1.txt", "1")).
+			AssertNoError()
+		assert.Equal(t, []string{"a", "b", "c"}, called)
+	}
+
+	// 遇到错误后停止，返回第一个错误
+	{
+		called = nil
+		newHookHarness(t).
+			Use("BeforeUpload", record("a", nil), record("b", errFirst), record("c", errors.New("second"))).
+			Trigger("BeforeUpload", newHarnessFile("1.txt", "1")).
+			AssertError(errFirst)
+		assert.Equal(t, []string{"a", "b"}, called)
+	}
+
+	// 未注册钩子的事件
+	{
+		called = nil
+		newHookHarness(t).
+			Use("AfterUpload", record("a", errFirst)).
+			Trigger("BeforeUpload", newHarnessFile("1.txt", "1")).
+			AssertNoError()
+		assert.Empty(t, called)
+	}
+
+	// 前置钩子失败时不写入存储端
+	{
+		newHookHarness(t).
+			Use("BeforeUpload", record("a", errFirst)).
+			Upload(newHarnessFile("1.txt", "content")).
+			AssertError(errFirst).
+			AssertNotStored("1.txt")
+	}
+}
+
+func TestHookHarness_HookValidateFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		content  string
+		maxSize  uint64
+		fileType []string
+		expected error
+	}{
+		{"合法", "1.txt", "content", 0, nil, nil},
+		{"超出大小限制", "1.txt", "content", 4, nil, ErrFileSizeTooBig},
+		{"等于大小限制", "1.txt", "content", 7, nil, nil},
+		{"非法文件名", "1/.txt", "content", 0, nil, ErrIllegalObjectName},
+		{"以空格结尾", "1.txt ", "content", 0, nil, ErrIllegalObjectName},
+		{"扩展名不允许", "1.exe", "content", 0, []string{"txt"}, ErrFileExtensionNotAllowed},
+		{"扩展名允许", "1.txt", "content", 0, []string{"txt"}, nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			h := newHookHarness(t).
+				WithPolicy(func(policy *model.Policy) {
+					policy.MaxSize = testCase.maxSize
+					policy.OptionsSerialized.FileType = testCase.fileType
+				}).
+				Use("BeforeUpload", HookValidateFile).
+				Upload(newHarnessFile(testCase.file, testCase.content))
+			if testCase.expected == nil {
+				h.AssertNoError().AssertStored(testCase.file, []byte(testCase.content))
+			} else {
+				h.AssertError(testCase.expected).AssertNotStored(testCase.file)
+			}
+		})
+	}
+}
+
+func TestHookHarness_HookValidateCapacity(t *testing.T) {
+	testCases := []struct {
+		name       string
+		content    string
+		maxStorage uint64
+		used       uint64
+		expected   error
+	}{
+		{"容量充足", "content", 10, 0, nil},
+		{"恰好用尽", "content", 10, 3, nil},
+		{"容量不足", "content", 10, 4, ErrInsufficientCapacity},
+		{"已超出容量", "content", 10, 20, ErrInsufficientCapacity},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			h := newHookHarness(t).
+				WithUser(func(user *model.User) {
+					user.Group.MaxStorage = testCase.maxStorage
+					user.Storage = testCase.used
+				}).
+				Use("BeforeUpload", HookValidateCapacity).
+				Upload(newHarnessFile("1.txt", testCase.content))
+			if testCase.expected == nil {
+				h.AssertNoError().AssertStored("1.txt", []byte(testCase.content))
+			} else {
+				h.AssertError(testCase.expected).AssertNotStored("1.txt")
+			}
+		})
+	}
+}
+
+func TestHookHarness_GenericAfterUpload(t *testing.T) {
+	errRootNotFound := errors.New("not found")
+	testCases := []struct {
+		name     string
+		content  string
+		mock     func()
+		expected error
+	}{
+		{
+			"成功",
+			"content",
+			func() {
+				mock.ExpectQuery("SELECT(.+)").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+				mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnError(errors.New("not found"))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE(.+)type_usages(.+)").
+					WithArgs(7, 1, model.FileTypeDocument).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			nil,
+		},
+		{
+			"插入记录失败",
+			"content",
+			func() {
+				mock.ExpectQuery("SELECT(.+)").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+				mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnError(errors.New("not found"))
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT(.+)files(.+)").WillReturnError(errors.New("error"))
+				mock.ExpectRollback()
+			},
+			ErrInsertFileRecord,
+		},
+		{
+			"根目录不存在",
+			"content",
+			func() {
+				mock.ExpectQuery("SELECT(.+)").
+					WithArgs(1).
+					WillReturnError(errRootNotFound)
+			},
+			errRootNotFound,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.mock()
+			file := newHarnessFile("1.txt", testCase.content)
+			h := newHookHarness(t).
+				Use("AfterUpload", GenericAfterUpload).
+				Upload(file)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			if testCase.expected == nil {
+				h.AssertNoError().
+					AssertStored("1.txt", []byte(testCase.content)).
+					AssertRecordedSize(file, uint64(len(testCase.content)), uint64(len(testCase.content)))
+			} else {
+				h.AssertError(testCase.expected)
+			}
+		})
+	}
+}
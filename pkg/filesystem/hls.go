@@ -0,0 +1,281 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/transcode"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// HLS 播放的分段方式，由存储策略设定
+const (
+	// HLSModePregenerate 上传后预先生成分段，与原文件保存在同一存储策略下
+	HLSModePregenerate = "pregenerate"
+	// HLSModeOnDemand 播放时由 ffmpeg 以范围请求读取原文件，实时切分
+	HLSModeOnDemand = "on_demand"
+)
+
+// hlsSuffix 预生成的 HLS 分段所在目录相对原文件物理路径的后缀
+const hlsSuffix = "._hls/"
+
+// hlsSegmentName 分段文件名的格式，用于校验请求中的分段名称
+var hlsSegmentName = regexp.MustCompile(`^\d+\.ts$`)
+
+// segmentVideo 实时切分视频分段
+var segmentVideo = transcode.Segment
+
+// isHLSExt 返回文件是否为可提供 HLS 播放的视频
+func isHLSExt(name string) bool {
+	exts := strings.Split(strings.ToLower(model.GetSettingByName("hls_exts")), ",")
+	for i := range exts {
+		exts[i] = strings.TrimSpace(exts[i])
+	}
+	return IsInExtensionList(exts, name)
+}
+
+// IsHLSPregenerateNeeded 返回是否需要为文件预生成 HLS 分段
+func IsHLSPregenerateNeeded(file *model.File) bool {
+	return file.GetPolicy().OptionsSerialized.HLSMode == HLSModePregenerate && isHLSExt(file.Name)
+}
+
+// hlsSegmentDuration 返回 hls_segment_duration 设定的分段时长
+func hlsSegmentDuration() time.Duration {
+	seconds := model.GetIntSetting("hls_segment_duration", 6)
+	if seconds <= 0 {
+		seconds = 6
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// hlsSegmentObjects 返回文件预生成的 HLS 分段的物理路径
+func hlsSegmentObjects(file *model.File) []string {
+	segments := transcode.PlaylistSegments(file.HLSPlaylist)
+	objects := make([]string, len(segments))
+	for i, segment := range segments {
+		objects[i] = file.SourceName + hlsSuffix + segment
+	}
+
+	return objects
+}
+
+// GenerateHLS 使用 ffmpeg 将视频切分为 HLS 分段，与原文件保存在同一存储策略下，播放列表记录在文件中。
+// 文件已有分段时跳过，返回值表示是否跳过。生成失败时已上传的分段被删除
+func (fs *FileSystem) GenerateHLS(ctx context.Context, file *model.File) (bool, error) {
+	if file.HLSPlaylist != "" {
+		return true, nil
+	}
+
+	fs.Policy = file.GetPolicy()
+	if err := fs.DispatchHandler(); err != nil {
+		return false, err
+	}
+
+	timeout := time.Duration(model.GetIntSetting("hls_pregenerate_timeout", 7200)) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tempDir := filepath.Join(
+		util.RelativePath(model.GetSettingByName("temp_path")),
+		"hls",
+		fmt.Sprintf("%d_%d", file.ID, time.Now().UnixNano()),
+	)
+	outputDir := filepath.Join(tempDir, "output")
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		return false, fmt.Errorf("failed to create temp folder: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	input := filepath.Join(tempDir, "input"+filepath.Ext(file.Name))
+	if err := fs.downloadToTemp(ctx, file.SourceName, input); err != nil {
+		return false, err
+	}
+
+	ffmpeg := model.GetSettingByName("video_transcode_ffmpeg")
+	if err := transcode.ToHLS(ctx, ffmpeg, input, outputDir, hlsSegmentDuration()); err != nil {
+		return false, err
+	}
+
+	playlist, err := os.ReadFile(filepath.Join(outputDir, transcode.HLSPlaylistName))
+	if err != nil {
+		return false, err
+	}
+
+	uploaded := make([]string, 0)
+	for _, segment := range transcode.PlaylistSegments(string(playlist)) {
+		if !hlsSegmentName.MatchString(segment) {
+			_, _ = fs.Handler.Delete(ctx, uploaded)
+			return false, fmt.Errorf("unexpected segment %q in generated playlist", segment)
+		}
+
+		savePath := file.SourceName + hlsSuffix + segment
+		if err := fs.putHLSSegment(ctx, filepath.Join(outputDir, segment), savePath); err != nil {
+			_, _ = fs.Handler.Delete(ctx, uploaded)
+			return false, fmt.Errorf("failed to save HLS segment %q: %w", segment, err)
+		}
+		uploaded = append(uploaded, savePath)
+	}
+
+	if err := file.UpdateHLSPlaylist(string(playlist)); err != nil {
+		_, _ = fs.Handler.Delete(ctx, uploaded)
+		return false, ErrDBUpdateObjects.WithError(err)
+	}
+
+	return false, nil
+}
+
+// putHLSSegment 将本机的分段文件 src 保存至存储端的 savePath
+func (fs *FileSystem) putHLSSegment(ctx context.Context, src, savePath string) error {
+	segment, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer segment.Close()
+
+	stat, err := segment.Stat()
+	if err != nil {
+		return err
+	}
+
+	return fs.Handler.Put(ctx, &fsctx.FileStream{
+		File:     segment,
+		Seeker:   segment,
+		Size:     uint64(stat.Size()),
+		Name:     filepath.Base(savePath),
+		MIMEType: "video/mp2t",
+		SavePath: savePath,
+		Mode:     fsctx.Overwrite,
+	})
+}
+
+// resetHLSTarget 按读取文件内容的权限检查定位要播放的文件，存储策略未开启 HLS 播放
+// 或文件不是设定格式的视频时返回 ErrHLSNotAvailable
+func (fs *FileSystem) resetHLSTarget(ctx context.Context, id uint) (*model.File, error) {
+	if err := fs.resetFileIDIfNotExist(ctx, id); err != nil {
+		return nil, err
+	}
+
+	file := &fs.FileTarget[0]
+	if err := checkFileUnlocked(ctx, file); err != nil {
+		return nil, err
+	}
+
+	if err := fs.checkRestored(ctx, file); err != nil {
+		return nil, err
+	}
+
+	// 从机模式下不会按文件重设存储策略
+	if fs.Policy == nil || fs.Policy.OptionsSerialized.HLSMode == "" || !isHLSExt(file.Name) {
+		return nil, ErrHLSNotAvailable
+	}
+
+	return file, nil
+}
+
+// hlsInput 返回 ffmpeg 读取原文件使用的地址，本机存储时为文件路径，否则为签名的预览地址
+func (fs *FileSystem) hlsInput(ctx context.Context, file *model.File) (string, error) {
+	if fs.Policy.Type == "local" {
+		return util.RelativePath(file.SourceName), nil
+	}
+
+	return fs.SignURL(ctx, file, int64(model.GetIntSetting("preview_timeout", 60)), false)
+}
+
+// HLSPlaylist 返回视频的 HLS 播放列表，其中第 i 个分段的地址为 uri("<i>.ts")。
+// 已预生成分段时返回预生成的播放列表，否则按视频时长生成实时切分的播放列表
+func (fs *FileSystem) HLSPlaylist(ctx context.Context, id uint, uri func(segment string) string) (string, error) {
+	file, err := fs.resetHLSTarget(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if file.HLSPlaylist != "" {
+		return transcode.RewritePlaylist(file.HLSPlaylist, uri), nil
+	}
+
+	// 分段尚未生成时实时切分
+	var duration time.Duration
+	if seconds, err := strconv.ParseFloat(file.MetadataSerialized[VideoDurationMetadataKey], 64); err == nil {
+		duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	if duration <= 0 {
+		input, err := fs.hlsInput(ctx, file)
+		if err != nil {
+			return "", err
+		}
+
+		timeout := time.Duration(model.GetIntSetting("video_probe_timeout", 60)) * time.Second
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		info, err := probeVideo(probeCtx, model.GetSettingByName("video_transcode_ffprobe"), input)
+		if err != nil {
+			return "", ErrHLSNotAvailable.WithError(err)
+		}
+		duration = info.Duration
+	}
+
+	if duration <= 0 {
+		return "", ErrHLSNotAvailable
+	}
+
+	return transcode.Playlist(duration, hlsSegmentDuration(), func(i int) string {
+		return uri(fmt.Sprintf("%d.ts", i))
+	}), nil
+}
+
+// HLSSegment 返回视频名为 name 的 HLS 分段，已预生成分段时读取存储端的分段文件，
+// 否则由 ffmpeg 以范围请求读取原文件实时切分
+func (fs *FileSystem) HLSSegment(ctx context.Context, id uint, name string) (io.ReadCloser, error) {
+	if !hlsSegmentName.MatchString(name) {
+		return nil, ErrHLSSegmentNotFound
+	}
+
+	file, err := fs.resetHLSTarget(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.HLSPlaylist != "" {
+		for _, segment := range transcode.PlaylistSegments(file.HLSPlaylist) {
+			if segment == name {
+				rs, err := fs.Handler.Get(ctx, file.SourceName+hlsSuffix+name)
+				if err != nil {
+					return nil, ErrIO.WithError(err)
+				}
+				return rs, nil
+			}
+		}
+
+		return nil, ErrHLSSegmentNotFound
+	}
+
+	index, err := strconv.Atoi(strings.TrimSuffix(name, ".ts"))
+	if err != nil {
+		return nil, ErrHLSSegmentNotFound
+	}
+
+	input, err := fs.hlsInput(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := hlsSegmentDuration()
+	rc, err := segmentVideo(ctx, model.GetSettingByName("video_transcode_ffmpeg"), input, time.Duration(index)*segment, segment)
+	if err != nil {
+		return nil, ErrIO.WithError(err)
+	}
+
+	return rc, nil
+}
@@ -0,0 +1,162 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/transcode"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestIsHLSPregenerateNeeded(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_hls_exts", "mp4, MKV", 0)
+
+	file := &model.File{Name: "1.mkv", Policy: model.Policy{Model: gorm.Model{ID: 1}}}
+	asserts.False(IsHLSPregenerateNeeded(file))
+
+	file.Policy.OptionsSerialized.HLSMode = HLSModeOnDemand
+	asserts.False(IsHLSPregenerateNeeded(file))
+
+	file.Policy.OptionsSerialized.HLSMode = HLSModePregenerate
+	asserts.True(IsHLSPregenerateNeeded(file))
+
+	file.Name = "1.txt"
+	asserts.False(IsHLSPregenerateNeeded(file))
+}
+
+func TestFileSystem_HLSPlaylist(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_hls_exts", "mp4", 0)
+	cache.Set("setting_hls_segment_duration", "6", 0)
+	cache.Set("policy_93", model.Policy{Type: "mock", OptionsSerialized: model.PolicyOption{HLSMode: HLSModeOnDemand}}, -1)
+	cache.Set("policy_94", model.Policy{Type: "mock"}, -1)
+	cache.Set("policy_95", model.Policy{Type: "local", OptionsSerialized: model.PolicyOption{HLSMode: HLSModeOnDemand}}, -1)
+	defer cache.Deletes([]string{"93", "94", "95"}, "policy_")
+	defer func() { probeVideo = transcode.Probe }()
+	uri := func(segment string) string {
+		return segment + "?unlock=token"
+	}
+
+	// 存储策略未开启
+	{
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{{Name: "1.mp4", PolicyID: 94}}}
+		_, err := fs.HLSPlaylist(context.Background(), 0, uri)
+		asserts.Equal(ErrHLSNotAvailable, err)
+	}
+
+	// 不是设定格式的视频
+	{
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{{Name: "1.txt", PolicyID: 93}}}
+		_, err := fs.HLSPlaylist(context.Background(), 0, uri)
+		asserts.Equal(ErrHLSNotAvailable, err)
+	}
+
+	// 设有下载密码，未解锁
+	{
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{{Name: "1.mp4", PolicyID: 93, Password: "salt:digest"}}}
+		_, err := fs.HLSPlaylist(context.Background(), 0, uri)
+		asserts.Equal(ErrFileLocked, err)
+	}
+
+	// 已预生成分段
+	{
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{{
+			Name:        "1.mp4",
+			PolicyID:    93,
+			HLSPlaylist: "#EXTM3U\n#EXTINF:6.0,\n0.ts\n#EXT-X-ENDLIST\n",
+		}}}
+		playlist, err := fs.HLSPlaylist(context.Background(), 0, uri)
+		asserts.NoError(err)
+		asserts.Equal("#EXTM3U\n#EXTINF:6.0,\n0.ts?unlock=token\n#EXT-X-ENDLIST\n", playlist)
+	}
+
+	// 实时切分，使用元数据中记录的时长
+	{
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{{
+			Name:               "1.mp4",
+			PolicyID:           93,
+			MetadataSerialized: map[string]string{VideoDurationMetadataKey: "7.500"},
+		}}}
+		playlist, err := fs.HLSPlaylist(context.Background(), 0, uri)
+		asserts.NoError(err)
+		asserts.Equal([]string{"0.ts?unlock=token", "1.ts?unlock=token"}, transcode.PlaylistSegments(playlist))
+		asserts.Contains(playlist, "#EXTINF:1.500000,\n1.ts")
+	}
+
+	// 实时切分，读取时长失败
+	{
+		probeVideo = func(ctx context.Context, ffprobe, input string) (*transcode.MediaInfo, error) {
+			return nil, errors.New("error")
+		}
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{{Name: "1.mp4", PolicyID: 95}}}
+		_, err := fs.HLSPlaylist(context.Background(), 0, uri)
+		asserts.Error(err)
+	}
+}
+
+func TestFileSystem_HLSSegment(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_hls_exts", "mp4", 0)
+	cache.Set("setting_hls_segment_duration", "6", 0)
+	cache.Set("policy_93", model.Policy{Type: "mock", OptionsSerialized: model.PolicyOption{HLSMode: HLSModeOnDemand}}, -1)
+	cache.Set("policy_95", model.Policy{Type: "local", OptionsSerialized: model.PolicyOption{HLSMode: HLSModeOnDemand}}, -1)
+	defer cache.Deletes([]string{"93", "95"}, "policy_")
+	defer func() { segmentVideo = transcode.Segment }()
+
+	// 分段名称不合法
+	{
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{{Name: "1.mp4", PolicyID: 93}}}
+		_, err := fs.HLSSegment(context.Background(), 0, "../1.mp4")
+		asserts.Equal(ErrHLSSegmentNotFound, err)
+	}
+
+	// 预生成的分段
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.mp4._hls/1.ts").
+			Return(MockRSC{rs: strings.NewReader("segment")}, nil)
+		fs := &FileSystem{User: &model.User{}, Handler: testHandler, FileTarget: []model.File{{
+			Name:        "1.mp4",
+			SourceName:  "1.mp4",
+			PolicyID:    93,
+			HLSPlaylist: "#EXTM3U\n0.ts\n1.ts\n",
+		}}}
+		rc, err := fs.HLSSegment(context.Background(), 0, "1.ts")
+		asserts.NoError(err)
+		content, _ := ioutil.ReadAll(rc)
+		asserts.Equal("segment", string(content))
+		testHandler.AssertExpectations(t)
+
+		_, err = fs.HLSSegment(context.Background(), 0, "2.ts")
+		asserts.Equal(ErrHLSSegmentNotFound, err)
+	}
+
+	// 实时切分
+	{
+		var start, duration time.Duration
+		segmentVideo = func(ctx context.Context, ffmpeg, input string, s, d time.Duration) (io.ReadCloser, error) {
+			start, duration = s, d
+			return ioutil.NopCloser(strings.NewReader("segment")), nil
+		}
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{{
+			Name:       "1.mp4",
+			SourceName: "1.mp4",
+			PolicyID:   95,
+		}}}
+		rc, err := fs.HLSSegment(context.Background(), 0, "2.ts")
+		asserts.NoError(err)
+		rc.Close()
+		asserts.Equal(12*time.Second, start)
+		asserts.Equal(6*time.Second, duration)
+	}
+}
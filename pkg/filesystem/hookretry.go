@@ -0,0 +1,176 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+)
+
+// 可重试的上传后处理名称，记录在重试队列中
+const (
+	PerceptualHashHook = "perceptual_hash"
+	CaptureTimeHook    = "capture_time"
+	TextStatsHook      = "text_stats"
+	VideoInfoHook      = "video_info"
+	SensitiveDataHook  = "sensitive_data"
+)
+
+// hookRetryBatch 每次定时任务最多重试的记录数量
+const hookRetryBatch = 100
+
+// RetryableHook 失败后可由重试队列再次执行的上传后处理
+type RetryableHook struct {
+	// Idempotent 重复执行是否安全，不可重复执行的处理失败后直接记为死信，由管理员决定是否重试
+	Idempotent bool
+	// Run 对文件执行处理
+	Run func(fs *FileSystem, ctx context.Context, file *model.File) error
+}
+
+// retryableHooks 已注册的可重试处理。缩略图生成使用自身的重试机制，不在此列
+var retryableHooks = map[string]RetryableHook{
+	PerceptualHashHook: {Idempotent: true, Run: (*FileSystem).GeneratePerceptualHash},
+	CaptureTimeHook:    {Idempotent: true, Run: (*FileSystem).ExtractCaptureTime},
+	TextStatsHook:      {Idempotent: true, Run: (*FileSystem).ComputeTextStats},
+	VideoInfoHook:      {Idempotent: true, Run: (*FileSystem).ProbeVideoInfo},
+	SensitiveDataHook:  {Idempotent: true, Run: (*FileSystem).HandleSensitiveData},
+}
+
+// RegisterRetryableHook 注册可重试的上传后处理，应在初始化阶段调用
+func RegisterRetryableHook(name string, hook RetryableHook) {
+	retryableHooks[name] = hook
+}
+
+// HookRetryResult 一次重试队列处理的结果
+type HookRetryResult struct {
+	Succeeded int
+	Failed    int
+	Dropped   int // 文件已不存在，记录被删除
+}
+
+// runRetryablePostProcess 在后台执行已注册的处理，失败时加入重试队列
+func (fs *FileSystem) runRetryablePostProcess(ctx context.Context, name string, file *model.File) {
+	fs.runPostProcess(ctx, func() {
+		fs.runRetryableHook(context.Background(), name, file)
+	})
+}
+
+// runRetryableHook 执行已注册的处理，失败时加入重试队列
+func (fs *FileSystem) runRetryableHook(ctx context.Context, name string, file *model.File) {
+	if err := retryableHooks[name].Run(fs, ctx, file); err != nil {
+		util.Log().Warning("Post-upload hook %q failed for %q: %s", name, file.Name, err)
+		scheduleHookRetry(name, file, err)
+	}
+}
+
+// hookRetryDelay 返回第 attempts 次失败后到下次重试的间隔，从 hook_retry_interval 起每次翻倍，
+// 不超过 hook_retry_max_interval
+func hookRetryDelay(attempts int) time.Duration {
+	delay := time.Duration(model.GetIntSetting("hook_retry_interval", 60)) * time.Second
+	maxDelay := time.Duration(model.GetIntSetting("hook_retry_max_interval", 21600)) * time.Second
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return delay
+}
+
+// scheduleHookRetry 记录一次处理失败并计划下次重试。失败次数达到 hook_retry_max_attempts
+// 或处理不可重复执行时记为死信
+func scheduleHookRetry(name string, file *model.File, cause error) {
+	record, err := model.GetHookRetry(name, file.ID)
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		util.Log().Warning("Failed to query retry record of hook %q for file %q: %s", name, file.Name, err)
+		return
+	}
+
+	record.Hook = name
+	record.FileID = file.ID
+	record.UserID = file.UserID
+	record.Attempts++
+	record.LastError = cause.Error()
+	if !retryableHooks[name].Idempotent || record.Attempts >= model.GetIntSetting("hook_retry_max_attempts", 5) {
+		record.Dead = true
+	} else {
+		record.NextRetryAt = time.Now().Add(hookRetryDelay(record.Attempts))
+	}
+
+	if err := record.Save(); err != nil {
+		util.Log().Warning("Failed to save retry record of hook %q for file %q: %s", name, file.Name, err)
+	}
+}
+
+// RetryFailedHooks 重试已到重试时间的上传后处理，以文件所有者身份执行
+func RetryFailedHooks(ctx context.Context) (HookRetryResult, error) {
+	res := HookRetryResult{}
+	records, err := model.GetDueHookRetries(time.Now(), hookRetryBatch)
+	if err != nil {
+		return res, ErrDBListObjects.WithError(err)
+	}
+
+	for i := range records {
+		record := &records[i]
+		files, err := model.GetFilesByIDs([]uint{record.FileID}, 0)
+		if err != nil {
+			util.Log().Warning("Failed to get file of retry record %d: %s", record.ID, err)
+			res.Failed++
+			continue
+		}
+
+		if len(files) == 0 {
+			if err := record.Delete(); err != nil {
+				util.Log().Warning("Failed to delete retry record %d: %s", record.ID, err)
+			}
+			res.Dropped++
+			continue
+		}
+
+		file := &files[0]
+		if _, ok := retryableHooks[record.Hook]; ok {
+			err = retryHook(ctx, record.Hook, file)
+		} else {
+			err = errors.New("hook is not registered")
+		}
+
+		if err != nil {
+			util.Log().Warning("Failed to retry hook %q for file %q: %s", record.Hook, file.Name, err)
+			scheduleHookRetry(record.Hook, file, err)
+			res.Failed++
+			continue
+		}
+
+		if err := record.Delete(); err != nil {
+			util.Log().Warning("Failed to delete retry record %d: %s", record.ID, err)
+		}
+		res.Succeeded++
+	}
+
+	return res, nil
+}
+
+// retryHook 以文件所有者身份再次执行处理
+func retryHook(ctx context.Context, name string, file *model.File) error {
+	user, err := model.GetUserByID(file.UserID)
+	if err != nil {
+		return err
+	}
+
+	fs, err := NewFileSystem(&user)
+	if err != nil {
+		return err
+	}
+	defer fs.Recycle()
+
+	fs.Policy = file.GetPolicy()
+	if err := fs.DispatchHandler(); err != nil {
+		return err
+	}
+
+	return retryableHooks[name].Run(fs, ctx, file)
+}
@@ -0,0 +1,210 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookRetryDelay(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_hook_retry_interval", "60", 0)
+	cache.Set("setting_hook_retry_max_interval", "300", 0)
+	defer cache.Deletes([]string{"hook_retry_interval", "hook_retry_max_interval"}, "setting_")
+
+	asserts.Equal(60*time.Second, hookRetryDelay(1))
+	asserts.Equal(120*time.Second, hookRetryDelay(2))
+	asserts.Equal(240*time.Second, hookRetryDelay(3))
+	asserts.Equal(300*time.Second, hookRetryDelay(4))
+	asserts.Equal(300*time.Second, hookRetryDelay(100))
+}
+
+func TestScheduleHookRetry(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_hook_retry_max_attempts", "3", 0)
+	defer cache.Deletes([]string{"hook_retry_max_attempts"}, "setting_")
+	RegisterRetryableHook("test_unsafe", RetryableHook{Run: func(fs *FileSystem, ctx context.Context, file *model.File) error {
+		return nil
+	}})
+	defer delete(retryableHooks, "test_unsafe")
+	file := &model.File{Model: gorm.Model{ID: 1}, UserID: 2, Name: "1.txt"}
+
+	// 首次失败
+	{
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").WithArgs(TextStatsHook, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)hook_retries(.+)").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), TextStatsHook, 1, 2, 1, sqlmock.AnyArg(), "error", false).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		scheduleHookRetry(TextStatsHook, file, errors.New("error"))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 达到最大次数，记为死信
+	{
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").WithArgs(TextStatsHook, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hook", "file_id", "attempts"}).AddRow(5, TextStatsHook, 1, 2))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)hook_retries(.+)").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), TextStatsHook, 1, 2, 3, sqlmock.AnyArg(), "error", true, 5).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		scheduleHookRetry(TextStatsHook, file, errors.New("error"))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 不可重复执行，直接记为死信
+	{
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").WithArgs("test_unsafe", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)hook_retries(.+)").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "test_unsafe", 1, 2, 1, sqlmock.AnyArg(), "error", true).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		scheduleHookRetry("test_unsafe", file, errors.New("error"))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 查询失败
+	{
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").WillReturnError(errors.New("error"))
+		scheduleHookRetry(TextStatsHook, file, errors.New("error"))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
+
+func TestFileSystem_RunRetryableHook(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.txt"}
+	called := 0
+	RegisterRetryableHook("test_hook", RetryableHook{Idempotent: true, Run: func(fs *FileSystem, ctx context.Context, file *model.File) error {
+		called++
+		if called > 1 {
+			return errors.New("error")
+		}
+		return nil
+	}})
+	defer delete(retryableHooks, "test_hook")
+
+	// 成功
+	fs.runRetryableHook(context.Background(), "test_hook", file)
+	asserts.Equal(1, called)
+
+	// 失败，加入重试队列
+	mock.ExpectQuery("SELECT(.+)hook_retries(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT(.+)hook_retries(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	fs.runRetryableHook(context.Background(), "test_hook", file)
+	asserts.Equal(2, called)
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
+func TestRetryFailedHooks(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("policy_93", model.Policy{Model: gorm.Model{ID: 93}, Type: "local"}, -1)
+	succeed := true
+	RegisterRetryableHook("test_hook", RetryableHook{Idempotent: true, Run: func(fs *FileSystem, ctx context.Context, file *model.File) error {
+		if fs.Policy.ID != 93 || fs.User.ID != 2 {
+			return errors.New("unexpected filesystem")
+		}
+		if !succeed {
+			return errors.New("error")
+		}
+		return nil
+	}})
+	defer delete(retryableHooks, "test_hook")
+	expectOwner := func() {
+		mock.ExpectQuery("SELECT(.+)users(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "group_id"}).AddRow(2, 1))
+		mock.ExpectQuery("SELECT(.+)groups(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "policies"}).AddRow(1, "[93]"))
+	}
+
+	// 列出失败
+	{
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").WillReturnError(errors.New("error"))
+		_, err := RetryFailedHooks(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+	}
+
+	// 文件已不存在
+	{
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hook", "file_id"}).AddRow(1, "test_hook", 1))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE(.+)hook_retries(.+)").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		res, err := RetryFailedHooks(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(HookRetryResult{Dropped: 1}, res)
+	}
+
+	// 重试成功
+	{
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hook", "file_id"}).AddRow(1, "test_hook", 1))
+		mock.ExpectQuery("SELECT(.+)files(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "policy_id"}).AddRow(1, 2, 93))
+		expectOwner()
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE(.+)hook_retries(.+)").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		res, err := RetryFailedHooks(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(HookRetryResult{Succeeded: 1}, res)
+	}
+
+	// 重试失败，重新计划
+	{
+		succeed = false
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hook", "file_id"}).AddRow(1, "test_hook", 1))
+		mock.ExpectQuery("SELECT(.+)files(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "policy_id"}).AddRow(1, 2, 93))
+		expectOwner()
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hook", "file_id", "attempts"}).AddRow(1, "test_hook", 1, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)hook_retries(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		res, err := RetryFailedHooks(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(HookRetryResult{Failed: 1}, res)
+	}
+
+	// 处理未注册，记为死信
+	{
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hook", "file_id"}).AddRow(1, "removed_hook", 1))
+		mock.ExpectQuery("SELECT(.+)files(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "policy_id"}).AddRow(1, 2, 93))
+		mock.ExpectQuery("SELECT(.+)hook_retries(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "hook", "file_id"}).AddRow(1, "removed_hook", 1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)hook_retries(.+)").WithArgs(
+			sqlmock.AnyArg(), sqlmock.AnyArg(), "removed_hook", 1, 2, 1, sqlmock.AnyArg(), "hook is not registered", true, 1,
+		).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		res, err := RetryFailedHooks(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(HookRetryResult{Failed: 1}, res)
+	}
+}
@@ -3,18 +3,27 @@ package filesystem
 import (
 	"context"
 	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cluster"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/hashid"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"hash"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Hook 钩子函数
@@ -56,6 +65,90 @@ func (fs *FileSystem) Trigger(ctx context.Context, name string, file fsctx.FileH
 	return nil
 }
 
+// TriggerParallel 并发执行钩子，等待全部钩子结束后返回合并的错误，不会因某个钩子出错而中止其他钩子。
+// 钩子间没有执行顺序，仅适用于互相独立、只产生副作用的钩子（如生成缩略图、计算校验值、发送通知），
+// 有先后依赖的钩子应使用 Trigger。ctx 取消后尚未开始的钩子不再执行，执行中的钩子通过 ctx 感知取消；
+// 钩子发生 panic 时转换为错误返回
+func (fs *FileSystem) TriggerParallel(ctx context.Context, name string, file fsctx.FileHeader) error {
+	hooks := fs.Hooks[name]
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(hooks))
+	wg := sync.WaitGroup{}
+	for i, hook := range hooks {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, hook Hook) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("hook panicked: %v", r)
+				}
+			}()
+
+			errs[i] = hook(ctx, fs, file)
+		}(i, hook)
+	}
+	wg.Wait()
+
+	err := joinHookErrors(errs)
+	if err != nil {
+		util.Log().Warning("Failed to execute hook：%s", err)
+	}
+
+	return err
+}
+
+// hookErrors 并发执行钩子时产生的多个错误，errors.Is / errors.As 会逐个匹配其中的错误
+type hookErrors []error
+
+// joinHookErrors 合并非空的错误，全部为空时返回 nil
+func joinHookErrors(errs []error) error {
+	var joined hookErrors
+	for _, err := range errs {
+		if err != nil {
+			joined = append(joined, err)
+		}
+	}
+
+	if len(joined) == 0 {
+		return nil
+	}
+	return joined
+}
+
+func (errs hookErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (errs hookErrors) Is(target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (errs hookErrors) As(target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // HookValidateFile 一系列对文件检验的集合
 func HookValidateFile(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
 	fileInfo := file.Info()
@@ -69,6 +162,9 @@ func HookValidateFile(ctx context.Context, fs *FileSystem, file fsctx.FileHeader
 	if !fs.ValidateLegalName(ctx, fileInfo.FileName) {
 		return ErrIllegalObjectName
 	}
+	if err := ValidateReservedName(fileInfo.FileName); err != nil {
+		return err
+	}
 
 	// 验证扩展名
 	if !fs.ValidateExtension(ctx, fileInfo.FileName) {
@@ -90,13 +186,62 @@ func HookResetPolicy(ctx context.Context, fs *FileSystem, file fsctx.FileHeader)
 	return fs.DispatchHandler()
 }
 
+// HookValidateMinFileSize 验证文件尺寸不小于 min，错误中附带最小尺寸与实际尺寸
+func HookValidateMinFileSize(min uint64) Hook {
+	return func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+		if size := file.Info().Size; size < min {
+			return ErrFileSizeTooSmall.WithData(map[string]uint64{
+				"min":  min,
+				"size": size,
+			})
+		}
+
+		return nil
+	}
+}
+
+// HookValidateConfiguredMinFileSize 验证文件尺寸不小于存储策略与用户组设定的最小文件尺寸，
+// 设定在钩子执行时读取，可用于 HookResetPolicy 重设存储策略之后
+func HookValidateConfiguredMinFileSize(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+	min := fs.MinFileSize()
+	if min == 0 {
+		return nil
+	}
+
+	return HookValidateMinFileSize(min)(ctx, fs, file)
+}
+
+// HookValidateUploadWindow 验证当前时间位于允许上传的时间段内，时间按 loc 时区计算，
+// 错误中附带下一次允许上传的时间
+func HookValidateUploadWindow(windows []UploadWindow, loc *time.Location) Hook {
+	return func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+		allowed, next := nextUploadWindow(windows, time.Now().In(loc))
+		if allowed {
+			return nil
+		}
+
+		data := map[string]string{"timezone": loc.String()}
+		if !next.IsZero() {
+			data["next"] = next.Format(time.RFC3339)
+		}
+		return ErrUploadWindowClosed.WithData(data)
+	}
+}
+
 // HookValidateCapacity 验证用户容量
 func HookValidateCapacity(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
 	// 验证并扣除容量
 	if fs.User.GetRemainingCapacity() < file.Info().Size {
 		return ErrInsufficientCapacity
 	}
-	return nil
+
+	// 验证文件类型容量限制
+	return fs.ValidateTypeQuota(file.Info().FileName, file.Info().Size)
+}
+
+// HookValidateFileCount 验证新增文件后是否超出文件数配额，需注册于 BeforeAddFile
+func HookValidateFileCount(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+	return fs.ValidateFileCount(1, 0)
 }
 
 // HookValidateCapacityDiff 根据原有文件和新文件的大小验证用户容量
@@ -113,8 +258,15 @@ func HookValidateCapacityDiff(ctx context.Context, fs *FileSystem, newFile fsctx
 
 // HookDeleteTempFile 删除已保存的临时文件
 func HookDeleteTempFile(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
-	// 删除临时文件
-	_, err := fs.Handler.Delete(ctx, []string{file.Info().SavePath})
+	// 内容寻址的对象可能已被其他文件引用
+	savePath := file.Info().SavePath
+	if isContentAddressPath(savePath) {
+		fs.releaseObject(ctx, fs.Policy.ID, savePath)
+		return nil
+	}
+
+	// 删除临时文件及已写入的分片
+	_, err := fs.Handler.Delete(ctx, append([]string{savePath}, shardObjects(file.Info().Shards)...))
 	if err != nil {
 		util.Log().Warning("Failed to clean-up temp files: %s", err)
 	}
@@ -125,12 +277,24 @@ func HookDeleteTempFile(ctx context.Context, fs *FileSystem, file fsctx.FileHead
 // HookCleanFileContent 清空文件内容
 func HookCleanFileContent(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
 	// 清空内容
-	return fs.Handler.Put(ctx, &fsctx.FileStream{
+	savePath := file.Info().SavePath
+	if err := fs.Handler.Put(ctx, &fsctx.FileStream{
 		File:     ioutil.NopCloser(strings.NewReader("")),
-		SavePath: file.Info().SavePath,
+		SavePath: savePath,
 		Size:     0,
 		Mode:     fsctx.Overwrite,
-	})
+	}); err != nil {
+		return err
+	}
+
+	// 拆分存储的文件改为以空的单个对象存储
+	fs.deleteShardObjects(ctx, staleShardObjects(file.Info().Shards, "", savePath))
+	if originFile, ok := ctx.Value(fsctx.FileModelCtx).(model.File); ok && originFile.IsSharded() {
+		fs.deleteShardObjects(ctx, staleShardObjects(originFile.Shards, "", savePath))
+		return originFile.UpdateShards("")
+	}
+
+	return nil
 }
 
 // HookClearFileSize 将原始文件的尺寸设为0
@@ -153,6 +317,11 @@ func HookCancelContext(ctx context.Context, fs *FileSystem, file fsctx.FileHeade
 
 // HookUpdateSourceName 更新文件SourceName
 func HookUpdateSourceName(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+	// 内容寻址策略下源文件名已在上传时更新
+	if fs.contentAddressable() {
+		return nil
+	}
+
 	originFile, ok := ctx.Value(fsctx.FileModelCtx).(model.File)
 	if !ok {
 		return ErrObjectNotExist
@@ -175,6 +344,55 @@ func GenericAfterUpdate(ctx context.Context, fs *FileSystem, newFile fsctx.FileH
 		return err
 	}
 
+	// 内容已改变，之前记录的校验值不再有效
+	if originFile.Checksum != "" {
+		if err := originFile.UpdateChecksum("", ""); err != nil {
+			return err
+		}
+	}
+
+	// 内容已重新写入，清除源文件丢失标记
+	if originFile.SourceBroken {
+		if err := originFile.UpdateSourceBroken(false); err != nil {
+			return err
+		}
+	}
+
+	// 衍生的转码文件已过期
+	if originFile.TranscodedSource != "" {
+		_, _ = fs.Handler.Delete(ctx, []string{originFile.TranscodedSource})
+		if err := originFile.UpdateTranscodedSource(""); err != nil {
+			return err
+		}
+	}
+
+	// 衍生的 PDF 预览已过期
+	if originFile.DocPreviewSource != "" {
+		_, _ = fs.Handler.Delete(ctx, []string{originFile.DocPreviewSource})
+		if err := originFile.UpdateDocPreviewSource(""); err != nil {
+			return err
+		}
+	}
+
+	// 预生成的 HLS 分段已过期
+	if originFile.HLSPlaylist != "" {
+		_, _ = fs.Handler.Delete(ctx, hlsSegmentObjects(&originFile))
+		if err := originFile.UpdateHLSPlaylist(""); err != nil {
+			return err
+		}
+	}
+
+	// 拆分存储的方式可能已改变，更新分片清单并删除不再使用的对象
+	if shards := newFile.Info().Shards; shards != originFile.Shards {
+		fs.deleteShardObjects(ctx, staleShardObjects(originFile.Shards, shards, newFile.Info().SavePath))
+		if err := originFile.UpdateShards(shards); err != nil {
+			return err
+		}
+	}
+
+	// 缩略图已过期
+	fs.refreshThumb(ctx, &originFile, newFile)
+
 	return nil
 }
 
@@ -199,7 +417,13 @@ func SlaveAfterUpload(session *serializer.UploadSession) Hook {
 			PicInfo: file.PicInfo,
 		}
 
-		return cluster.RemoteCallback(session.Callback, callbackBody)
+		err := cluster.RemoteCallback(session.Callback, callbackBody)
+		if cluster.IsCallbackUndelivered(err) {
+			// 文件已完整保存，回调已记录供管理员重放，不再执行截断已上传内容等失败处理
+			fs.CleanHooks("AfterValidateFailed")
+		}
+
+		return err
 	}
 }
 
@@ -207,12 +431,28 @@ func SlaveAfterUpload(session *serializer.UploadSession) Hook {
 func GenericAfterUpload(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
 	fileInfo := fileHeader.Info()
 
+	// 规范化路径，使等价的路径对应同一目录
+	virtualPath, err := NormalizeVirtualPath(fileInfo.VirtualPath)
+	if err != nil {
+		return err
+	}
+
 	// 创建或查找根目录
-	folder, err := fs.CreateDirectory(ctx, fileInfo.VirtualPath)
+	folder, err := fs.CreateDirectory(ctx, virtualPath)
 	if err != nil {
 		return err
 	}
 
+	// 检查目录允许存放的文件类型
+	if !IsFileTypeAllowedInFolder(folder, fileInfo.FileName, fileInfo.MIMEType) {
+		return ErrFolderFileTypeNotAllowed
+	}
+
+	// 检查目录要求的元数据
+	if err := ValidateRequiredMetadata(folder, fileInfo.Metadata); err != nil {
+		return err
+	}
+
 	// 检查文件是否存在
 	if ok, file := fs.IsChildFileExist(
 		folder,
@@ -221,7 +461,11 @@ func GenericAfterUpload(ctx context.Context, fs *FileSystem, fileHeader fsctx.Fi
 		if file.UploadSessionID != nil {
 			return ErrFileUploadSessionExisted
 		}
-		return ErrFileExisted
+
+		// 按目录设定处理重名
+		if err := fs.handleNameCollision(ctx, folder, file, fileHeader); err != nil {
+			return err
+		}
 	}
 
 	// 向数据库中插入记录
@@ -231,9 +475,123 @@ func GenericAfterUpload(ctx context.Context, fs *FileSystem, fileHeader fsctx.Fi
 	}
 	fileHeader.SetModel(file)
 
+	// 应用默认权限，上传会话的占位文件在上传完成后再应用，避免取消或失败的上传留下分享
+	if file.UploadSessionID == nil {
+		permission, _ := ctx.Value(fsctx.UploadPermissionCtx).(string)
+		fs.applyUploadPermission(permission, folder, file)
+	}
+
 	return nil
 }
 
+// HookApplyUploadPermission 按默认权限处理上传完成的占位文件，permission 为创建上传会话时
+// 指定的权限，需在占位文件提升为正式文件后执行
+func HookApplyUploadPermission(permission string) Hook {
+	return func(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+		file, ok := fileHeader.Info().Model.(*model.File)
+		if !ok {
+			return nil
+		}
+
+		folders, err := model.GetFoldersByIDs([]uint{file.FolderID}, file.UserID)
+		if err != nil || len(folders) == 0 {
+			util.Log().Warning("Failed to find parent folder of file %q: %s", file.Name, err)
+			return nil
+		}
+
+		fs.applyUploadPermission(permission, &folders[0], file)
+		return nil
+	}
+}
+
+// applyUploadPermission 按默认权限为上传至 folder 的新文件创建分享，permission 为本次上传指定的权限
+func (fs *FileSystem) applyUploadPermission(permission string, folder *model.Folder, file *model.File) {
+	share := fs.resolveUploadShare(permission, folder)
+	if share == nil {
+		return
+	}
+
+	share.UserID = fs.User.ID
+	share.SourceID = file.ID
+	share.RemainDownloads = -1
+	share.SourceName = file.Name
+	if _, err := share.Create(); err != nil {
+		util.Log().Warning("Failed to create default share for file %q: %s", file.Name, err)
+	}
+}
+
+// resolveUploadShare 决定新上传文件的默认权限，返回需为文件创建的分享，nil 表示文件保持私有。
+// 优先级依次为本次上传指定、所在目录及其上级目录的设定、全局设定。沿上级目录查找时遇到已被分享的目录，
+// 文件沿用该分享的密码与有效期，使文件可见范围与目录分享一致。用户组无分享权限时始终为私有
+func (fs *FileSystem) resolveUploadShare(permission string, folder *model.Folder) *model.Share {
+	if !fs.User.Group.ShareEnabled {
+		return nil
+	}
+
+	if permission != model.FilePermissionInherit {
+		return publicUploadShare(permission)
+	}
+
+	current := folder
+	for {
+		if current.DefaultPermission != model.FilePermissionInherit {
+			return publicUploadShare(current.DefaultPermission)
+		}
+
+		if share := availableFolderShare(current); share != nil {
+			return &model.Share{
+				Password:       share.Password,
+				Expires:        share.Expires,
+				PreviewEnabled: share.PreviewEnabled,
+			}
+		}
+
+		if current.ParentID == nil {
+			break
+		}
+
+		parents, err := model.GetFoldersByIDs([]uint{*current.ParentID}, current.OwnerID)
+		if err != nil || len(parents) == 0 {
+			break
+		}
+		current = &parents[0]
+	}
+
+	return publicUploadShare(model.GetSettingByNameWithDefault("upload_default_permission", model.FilePermissionPrivate))
+}
+
+// publicUploadShare 权限为公开时返回待创建的公开分享，否则返回 nil
+func publicUploadShare(permission string) *model.Share {
+	if permission == model.FilePermissionPublic {
+		return &model.Share{}
+	}
+	return nil
+}
+
+// availableFolderShare 返回目录未过期且下载次数未用尽的分享，存在多个时优先返回无密码的分享
+func availableFolderShare(folder *model.Folder) *model.Share {
+	shares, err := model.GetSharesBySourceID(folder.OwnerID, folder.ID, true)
+	if err != nil {
+		return nil
+	}
+
+	var found *model.Share
+	for i := range shares {
+		share := &shares[i]
+		if share.RemainDownloads == 0 || (share.Expires != nil && time.Now().After(*share.Expires)) {
+			continue
+		}
+		if share.Password == "" {
+			return share
+		}
+		if found == nil {
+			found = share
+		}
+	}
+
+	return found
+}
+
 func generateFileMD5(ctx context.Context, filename string) (md5Code string, err error) {
 	if filename == "" {
 		return "", fmt.Errorf("filename is empty")
@@ -257,18 +615,127 @@ func generateFileMD5(ctx context.Context, filename string) (md5Code string, err
 	return md5str, nil
 }
 
+// PostProcessWaiter 跟踪上传后处理任务的完成情况，用于需要同步等待处理结果的上传
+type PostProcessWaiter struct {
+	wg sync.WaitGroup
+}
+
+// Wait 等待已提交的后处理任务全部完成，超过 timeout 仍未完成时返回 false，
+// 未完成的任务继续在后台执行
+func (w *PostProcessWaiter) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// runPostProcess 在后台执行上传后处理任务，上下文中带有 PostProcessWaiter 时由其跟踪任务
+func (fs *FileSystem) runPostProcess(ctx context.Context, task func()) {
+	waiter, _ := ctx.Value(fsctx.PostProcessWaiterCtx).(*PostProcessWaiter)
+	if waiter != nil {
+		waiter.wg.Add(1)
+	}
+
+	fs.recycleLock.Lock()
+	go func() {
+		defer fs.recycleLock.Unlock()
+		if waiter != nil {
+			defer waiter.wg.Done()
+		}
+		task()
+	}()
+}
+
 // HookGenerateThumb 生成缩略图
 func HookGenerateThumb(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
-	// 异步尝试生成缩略图
 	fileMode := fileHeader.Info().Model.(*model.File)
 	if fs.Policy.IsThumbGenerateNeeded() {
-		fs.recycleLock.Lock()
-		go func() {
-			defer fs.recycleLock.Unlock()
+		fs.runPostProcess(ctx, func() {
 			_, _ = fs.Handler.Delete(ctx, []string{fileMode.SourceName + model.GetSettingByNameWithDefault("thumb_file_suffix", "._thumb")})
+			// 文件内容已变更，清除之前的失败记录
+			fileMode.ThumbStatus = model.ThumbStatusPending
+			fileMode.ThumbRetries = 0
 			fs.GenerateThumbnail(ctx, fileMode)
-		}()
+		})
+	}
+	return nil
+}
+
+// HookComputePerceptualHash 计算图像文件的感知哈希
+func HookComputePerceptualHash(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || !IsInExtensionList(HandledExtension, fileModel.Name) {
+		return nil
+	}
+
+	if !model.IsTrueVal(model.GetSettingByNameWithDefault("image_phash_enabled", "1")) {
+		return nil
+	}
+
+	fs.runRetryablePostProcess(ctx, PerceptualHashHook, fileModel)
+	return nil
+}
+
+// HookExtractCaptureTime 读取图像 EXIF 中的拍摄时间并保存到文件元数据
+func HookExtractCaptureTime(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || !IsInExtensionList(exifExtension, fileModel.Name) {
+		return nil
 	}
+
+	if !model.IsTrueVal(model.GetSettingByNameWithDefault("image_exif_enabled", "1")) {
+		return nil
+	}
+
+	fs.runRetryablePostProcess(ctx, CaptureTimeHook, fileModel)
+	return nil
+}
+
+// HookComputeTextStats 检测文本文件的字符编码并统计行数、词数
+func HookComputeTextStats(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || !isTextStatNeeded(fileModel.Name) {
+		return nil
+	}
+
+	fs.runRetryablePostProcess(ctx, TextStatsHook, fileModel)
+	return nil
+}
+
+// HookProbeVideoInfo 读取视频文件的时长、分辨率、编码与码率
+func HookProbeVideoInfo(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || !isVideoProbeNeeded(fileModel.Name) {
+		return nil
+	}
+
+	fs.runRetryablePostProcess(ctx, VideoInfoHook, fileModel)
+	return nil
+}
+
+// HookScanSensitiveData 扫描文件中的敏感数据。命中后需隔离文件时同步扫描，避免文件在隔离前可见
+func HookScanSensitiveData(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || !isDLPScanNeeded() {
+		return nil
+	}
+
+	if dlpAction() == DLPActionQuarantine {
+		fs.runRetryableHook(ctx, SensitiveDataHook, fileModel)
+		return nil
+	}
+
+	fs.runRetryablePostProcess(ctx, SensitiveDataHook, fileModel)
 	return nil
 }
 
@@ -278,14 +745,26 @@ func HookClearFileHeaderSize(ctx context.Context, fs *FileSystem, fileHeader fsc
 	return nil
 }
 
-// HookTruncateFileTo 将物理文件截断至 size
+// HookTruncateFileTo 回滚追加上传，将已写入或暂存的数据截断至 size
 func HookTruncateFileTo(size uint64) Hook {
 	return func(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
-		if handler, ok := fs.Handler.(local.Driver); ok {
-			return handler.Truncate(ctx, fileHeader.Info().SavePath, size)
+		staging := stagingFromContext(ctx)
+		if fs.isNativeAppend(staging) {
+			if handler, ok := fs.Handler.(local.Driver); ok {
+				return handler.Truncate(ctx, fileHeader.Info().SavePath, size)
+			}
+			return nil
 		}
 
-		return nil
+		handler, err := fs.stagingHandler(staging)
+		if err != nil {
+			return err
+		}
+		if handler != nil {
+			return fs.truncateStagedChunks(ctx, handler, staging, fileHeader.Info().SavePath, size)
+		}
+
+		return truncateAppendBuffer(fileHeader.Info().SavePath, size)
 	}
 }
 
@@ -318,6 +797,262 @@ func HookPopPlaceholderToFile(picInfo string) Hook {
 	}
 }
 
+// committedMD5MetadataKey 上传信息中记录已确认与存储端内容一致的 MD5 的键，仅在钩子间传递，不保存
+const committedMD5MetadataKey = "committed_md5"
+
+// HookVerifyChecksum 回读组装完成的文件计算 MD5 并与客户端声明的值比较，一致时将校验值
+// 保存至文件记录，需在占位文件提升为正式文件前执行。expected 为空时不校验；
+// 存储端已确认内容的校验值时使用 HookCommitAppendBuffer 记录的 MD5，不再回读
+func HookVerifyChecksum(expected string) Hook {
+	return func(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+		if expected == "" {
+			return nil
+		}
+
+		fileModel, ok := fileHeader.Info().Model.(*model.File)
+		if !ok {
+			return ErrObjectNotExist
+		}
+
+		digest, ok := fileHeader.Info().Metadata[committedMD5MetadataKey]
+		if !ok {
+			var err error
+			if digest, err = fs.md5File(ctx, fileModel); err != nil {
+				return err
+			}
+		}
+
+		if !strings.EqualFold(digest, expected) {
+			util.Log().Warning("Checksum of uploaded file %q mismatch, expected %s, got %s.", fileModel.Name, expected, digest)
+			return ErrChecksumMismatch.WithData(map[string]interface{}{
+				"expected": expected,
+				"actual":   digest,
+			})
+		}
+
+		return fileModel.UpdateMD5(digest)
+	}
+}
+
+// IsChecksumMismatch 返回 err 是否为 HookVerifyChecksum 校验失败
+func IsChecksumMismatch(err error) bool {
+	appErr, ok := err.(serializer.AppError)
+	return ok && appErr.Code == serializer.CodeChecksumMismatch
+}
+
+// md5Object 回读存储端的 source 计算 MD5
+func (fs *FileSystem) md5Object(ctx context.Context, source string) (string, error) {
+	return fs.md5File(ctx, &model.File{SourceName: source})
+}
+
+// md5File 回读文件内容计算 MD5，拆分存储的文件依次读取各分片
+func (fs *FileSystem) md5File(ctx context.Context, file *model.File) (string, error) {
+	rs, err := fs.OpenObject(WithInternalRead(ctx), file)
+	if err != nil {
+		return "", ErrIO.WithError(err)
+	}
+	defer rs.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, rs); err != nil {
+		return "", ErrIO.WithError(err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// 文件内容校验值支持的摘要算法
+const (
+	ChecksumMD5    = "md5"
+	ChecksumSHA1   = "sha1"
+	ChecksumSHA256 = "sha256"
+)
+
+// ChecksumAlgorithm 返回 checksum_algorithm 设定的上传后计算校验值使用的摘要算法，为空表示不计算
+func ChecksumAlgorithm() string {
+	return strings.ToLower(strings.TrimSpace(model.GetSettingByName("checksum_algorithm")))
+}
+
+// newChecksumHash 返回 algo 对应的摘要算法，不支持时返回 nil
+func newChecksumHash(algo string) hash.Hash {
+	switch algo {
+	case ChecksumMD5:
+		return md5.New()
+	case ChecksumSHA1:
+		return sha1.New()
+	case ChecksumSHA256:
+		return sha256.New()
+	}
+
+	return nil
+}
+
+// HookComputeChecksum 回读上传完成的文件计算 algo 摘要并保存至文件记录，需在 GenericAfterUpload
+// 创建文件记录后执行。文件内容不在本机（如从机、对象存储策略）或算法不受支持时不做处理，
+// 读取失败仅记录日志，不影响上传结果
+func HookComputeChecksum(algo string) Hook {
+	return func(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+		fileModel, ok := fileHeader.Info().Model.(*model.File)
+		if !ok || fileModel.ID == 0 || fs.Policy == nil || fs.Policy.Type != "local" {
+			return nil
+		}
+
+		digest := newChecksumHash(algo)
+		if digest == nil {
+			if algo != "" {
+				util.Log().Warning("Unsupported checksum algorithm %q, skip computing checksum.", algo)
+			}
+			return nil
+		}
+
+		rs, err := fs.OpenObject(WithInternalRead(ctx), fileModel)
+		if err != nil {
+			util.Log().Warning("Failed to open file %q to compute checksum: %s", fileModel.Name, err)
+			return nil
+		}
+		defer rs.Close()
+
+		if _, err := io.Copy(digest, rs); err != nil {
+			util.Log().Warning("Failed to compute checksum of file %q: %s", fileModel.Name, err)
+			return nil
+		}
+
+		return fileModel.UpdateChecksum(algo, hex.EncodeToString(digest.Sum(nil)))
+	}
+}
+
+// HookValidateUniqueContent 目标目录设定了内容唯一时，拒绝与目录中已有文件内容相同的上传，
+// 并在错误数据中返回已有文件的信息。分片上传、客户端直传需在占位文件提升为正式文件前执行，
+// 其他上传需在 GenericAfterUpload 之前执行
+func HookValidateUniqueContent(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	fileInfo := fileHeader.Info()
+	fileModel, _ := fileInfo.Model.(*model.File)
+
+	var folder *model.Folder
+	if fileModel != nil && fileModel.FolderID != 0 {
+		folders, err := model.GetFoldersByIDs([]uint{fileModel.FolderID}, fs.User.ID)
+		if err != nil || len(folders) == 0 {
+			return nil
+		}
+		folder = &folders[0]
+	} else {
+		virtualPath, err := NormalizeVirtualPath(fileInfo.VirtualPath)
+		if err != nil {
+			return nil
+		}
+		exist, parent := fs.IsPathExist(virtualPath)
+		if !exist {
+			return nil
+		}
+		folder = parent
+	}
+
+	if !folder.UniqueContent {
+		return nil
+	}
+
+	var (
+		digest    string
+		excludeID uint
+		err       error
+	)
+	if fileModel != nil {
+		digest = fileModel.MD5
+		excludeID = fileModel.ID
+	}
+
+	if digest == "" {
+		source := &model.File{SourceName: fileInfo.SavePath, Shards: fileInfo.Shards}
+		if fileModel != nil && fileModel.SourceName != "" {
+			source = fileModel
+		}
+		if digest, err = fs.md5File(ctx, source); err != nil {
+			return err
+		}
+
+		if fileModel != nil && fileModel.ID != 0 {
+			if err := fileModel.UpdateMD5(digest); err != nil {
+				util.Log().Warning("Failed to save MD5 of file %q: %s", fileModel.Name, err)
+			}
+		}
+	}
+
+	existed, err := model.GetFileInFolderByMD5(folder.ID, digest, excludeID)
+	if err != nil {
+		return nil
+	}
+
+	return ErrDuplicateContent.WithData(serializer.Object{
+		ID:         hashid.HashID(existed.ID, hashid.FileID),
+		Name:       existed.Name,
+		Size:       existed.Size,
+		Type:       "file",
+		Date:       existed.UpdatedAt,
+		MD5:        existed.MD5,
+		CreateDate: existed.CreatedAt,
+	})
+}
+
+// HookValidateUniqueName 扩展名在 unique_name_exts 中的文件，拒绝文件名在 unique_name_scope
+// 范围内已被其他文件使用的上传，并在错误数据中返回已有文件的位置
+func HookValidateUniqueName(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	fileInfo := fileHeader.Info()
+	nameKey := model.UniqueNameKey(fs.User.ID, fileInfo.FileName)
+	if nameKey == nil {
+		return nil
+	}
+
+	var excludeID uint
+	if fileModel, ok := fileInfo.Model.(*model.File); ok && fileModel != nil {
+		excludeID = fileModel.ID
+	}
+
+	return fs.checkUniqueName(*nameKey, excludeID)
+}
+
+// checkUniqueName 文件名摘要已被 excludeID 以外的文件使用时返回 ErrNameNotUnique，
+// 已有文件属于其他用户时不返回其位置
+func (fs *FileSystem) checkUniqueName(nameKey string, excludeID uint) error {
+	existed, err := model.GetFileByNameKey(nameKey)
+	if err != nil || existed.ID == excludeID {
+		return nil
+	}
+
+	if existed.UserID != fs.User.ID {
+		return ErrNameNotUnique
+	}
+
+	location := "/"
+	if folders, err := model.GetFoldersByIDs([]uint{existed.FolderID}, existed.UserID); err == nil && len(folders) > 0 {
+		if err := folders[0].TraceRoot(); err == nil {
+			location = path.Join(folders[0].Position, folders[0].Name)
+		}
+	}
+
+	return ErrNameNotUnique.WithData(serializer.Object{
+		ID:         hashid.HashID(existed.ID, hashid.FileID),
+		Name:       existed.Name,
+		Path:       location,
+		Size:       existed.Size,
+		Type:       "file",
+		Date:       existed.UpdatedAt,
+		CreateDate: existed.CreatedAt,
+	})
+}
+
+// ShouldDiscardUpload 返回分片上传、客户端直传完成时的错误是否需要丢弃已上传的文件
+func ShouldDiscardUpload(err error) bool {
+	appErr, ok := err.(serializer.AppError)
+	return ok && (appErr.Code == serializer.CodeChecksumMismatch || appErr.Code == serializer.CodeDuplicateContent)
+}
+
+// DiscardCorruptedUpload 删除校验失败的上传文件及其占位记录、上传会话，避免其成为正式文件
+func (fs *FileSystem) DiscardCorruptedUpload(ctx context.Context, placeholder *model.File) {
+	if err := fs.Delete(ctx, []uint{}, []uint{placeholder.ID}, false); err != nil {
+		util.Log().Warning("Failed to discard corrupted upload %q: %s", placeholder.Name, err)
+	}
+}
+
 // HookChunkUploadFinished 分片上传结束后处理文件
 func HookDeleteUploadSession(id string) Hook {
 	return func(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
@@ -11,10 +11,15 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/mocks/requestmock"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"image"
+	"image/png"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/jinzhu/gorm"
@@ -92,6 +97,66 @@ func TestGenericAfterUploadCanceled(t *testing.T) {
 
 }
 
+func TestFileSystem_ResolveUploadShare(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	folder := &model.Folder{Model: gorm.Model{ID: 2}, OwnerID: 1}
+	cache.Set("setting_upload_default_permission", model.FilePermissionPublic, 0)
+	defer cache.Set("setting_upload_default_permission", model.FilePermissionPrivate, 0)
+
+	// 用户组无分享权限
+	asserts.Nil(fs.resolveUploadShare(model.FilePermissionPublic, folder))
+
+	// 使用全局设定
+	fs.User.Group.ShareEnabled = true
+	mock.ExpectQuery("SELECT(.+)shares(.+)").WithArgs(1, 2, true).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	asserts.Equal(&model.Share{}, fs.resolveUploadShare(model.FilePermissionInherit, folder))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 使用上级目录设定
+	parentID := uint(1)
+	folder.ParentID = &parentID
+	mock.ExpectQuery("SELECT(.+)shares(.+)").WithArgs(1, 2, true).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT(.+)folders(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "default_permission"}).AddRow(1, 1, model.FilePermissionPrivate))
+	asserts.Nil(fs.resolveUploadShare(model.FilePermissionInherit, folder))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 上级目录已被分享，沿用分享的密码，忽略已失效的分享
+	mock.ExpectQuery("SELECT(.+)shares(.+)").WithArgs(1, 2, true).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT(.+)folders(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+	mock.ExpectQuery("SELECT(.+)shares(.+)").WithArgs(1, 1, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "remain_downloads"}).AddRow(1, "", 0).AddRow(2, "123", -1))
+	asserts.Equal(&model.Share{Password: "123"}, fs.resolveUploadShare(model.FilePermissionInherit, folder))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 使用目录设定
+	folder.DefaultPermission = model.FilePermissionPrivate
+	asserts.Nil(fs.resolveUploadShare(model.FilePermissionInherit, folder))
+
+	// 使用本次上传指定的权限
+	asserts.Equal(&model.Share{}, fs.resolveUploadShare(model.FilePermissionPublic, folder))
+}
+
+func TestHookApplyUploadPermission(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+	fs.User.Group.ShareEnabled = true
+	file := &model.File{Model: gorm.Model{ID: 3}, Name: "1.txt", UserID: 1, FolderID: 2}
+
+	// 未关联文件记录
+	asserts.NoError(HookApplyUploadPermission(model.FilePermissionPublic)(context.Background(), fs, &fsctx.FileStream{}))
+
+	// 上传完成后创建分享
+	mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(2, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT(.+)shares(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(HookApplyUploadPermission(model.FilePermissionPublic)(context.Background(), fs, &fsctx.FileStream{Model: file}))
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
 func TestGenericAfterUpload(t *testing.T) {
 	asserts := assert.New(t)
 	fs := FileSystem{
@@ -130,7 +195,59 @@ func TestGenericAfterUpload(t *testing.T) {
 	asserts.NoError(err)
 	asserts.NoError(mock.ExpectationsWereMet())
 
+	// 默认公开，创建分享
+	fs.User.Group.ShareEnabled = true
+	ctx = context.WithValue(ctx, fsctx.UploadPermissionCtx, model.FilePermissionPublic)
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+	mock.ExpectQuery("SELECT(.+)files").
+		WithArgs(1, "我的文件").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}))
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs("我的文件", 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(2, 1))
+	mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnError(errors.New("not found"))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT(.+)shares(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = GenericAfterUpload(ctx, &fs, file)
+	asserts.NoError(err)
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 上传会话的占位文件，上传完成前不创建分享
+	sessionID := "session"
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+	mock.ExpectQuery("SELECT(.+)files").
+		WithArgs(1, "我的文件").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}))
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs("我的文件", 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(2, 1))
+	mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnError(errors.New("not found"))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err = GenericAfterUpload(ctx, &fs, &fsctx.FileStream{
+		VirtualPath:     "/我的文件",
+		Name:            "test.txt",
+		UploadSessionID: &sessionID,
+	})
+	asserts.NoError(err)
+	asserts.NoError(mock.ExpectationsWereMet())
+	fs.User.Group.ShareEnabled = false
+	ctx = context.Background()
+
 	// 文件已存在
+	cache.Set("setting_upload_collision_policy", model.CollisionPolicyError, 0)
 	mock.ExpectQuery("SELECT(.+)").
 		WithArgs(1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
@@ -281,6 +398,42 @@ func TestHookValidateCapacity(t *testing.T) {
 	}
 }
 
+func TestHookValidateMinFileSize(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{}
+	ctx := context.Background()
+
+	{
+		asserts.NoError(HookValidateMinFileSize(10)(ctx, fs, &fsctx.FileStream{Size: 10}))
+		asserts.NoError(HookValidateMinFileSize(0)(ctx, fs, &fsctx.FileStream{Size: 0}))
+	}
+
+	{
+		err := HookValidateMinFileSize(10)(ctx, fs, &fsctx.FileStream{Size: 9})
+		asserts.Error(err)
+		appErr := err.(serializer.AppError)
+		asserts.Equal(ErrFileSizeTooSmall.Code, appErr.Code)
+		asserts.Equal(map[string]uint64{"min": 10, "size": 9}, appErr.Data)
+		asserts.Nil(ErrFileSizeTooSmall.Data)
+	}
+}
+
+func TestHookValidateConfiguredMinFileSize(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}, Policy: &model.Policy{}}
+	ctx := context.Background()
+
+	// 未设定，允许空文件
+	asserts.NoError(HookValidateConfiguredMinFileSize(ctx, fs, &fsctx.FileStream{Size: 0}))
+
+	// 使用执行时的存储策略设定
+	fs.Policy = &model.Policy{OptionsSerialized: model.PolicyOption{MinSize: 10}}
+	err := HookValidateConfiguredMinFileSize(ctx, fs, &fsctx.FileStream{Size: 0})
+	asserts.Error(err)
+	asserts.Equal(map[string]uint64{"min": 10, "size": 0}, err.(serializer.AppError).Data)
+	asserts.NoError(HookValidateConfiguredMinFileSize(ctx, fs, &fsctx.FileStream{Size: 10}))
+}
+
 func TestHookValidateCapacityDiff(t *testing.T) {
 	a := assert.New(t)
 	fs := &FileSystem{User: &model.User{
@@ -473,6 +626,102 @@ func TestGenericAfterUpdate(t *testing.T) {
 	}
 }
 
+// writeTestImage 在 dst 写入 w×h 的 PNG 图像
+func writeTestImage(dst string, w, h int) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return png.Encode(out, image.NewRGBA(image.Rect(0, 0, w, h)))
+}
+
+func TestGenericAfterUpdate_RefreshThumb(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_thumb_width", "400", 0)
+	cache.Set("setting_thumb_height", "300", 0)
+	cache.Set("setting_thumb_file_suffix", "._thumb", 0)
+	cache.Set("setting_thumb_encode_method", "png", 0)
+	cache.Set("setting_thumb_convert_srgb", "0", 0)
+	cache.Set("setting_thumb_gc_after_gen", "0", 0)
+	defer cache.Deletes([]string{"thumb_width", "thumb_height", "thumb_file_suffix", "thumb_encode_method",
+		"thumb_convert_srgb", "thumb_gc_after_gen", "thumb_refresh_on_update"}, "setting_")
+
+	source := "tests/refresh_thumb.png"
+	thumbFile := util.RelativePath(source + "._thumb")
+	asserts.NoError(os.MkdirAll(util.RelativePath("tests"), 0744))
+	defer os.Remove(util.RelativePath(source))
+	defer os.Remove(thumbFile)
+
+	fs := &FileSystem{
+		User:    &model.User{Model: gorm.Model{ID: 1}},
+		Handler: local.Driver{},
+		Policy:  &model.Policy{Type: "local"},
+	}
+	originFile := model.File{
+		Model:      gorm.Model{ID: 1},
+		Name:       "1.png",
+		SourceName: source,
+		PicInfo:    "100,100",
+	}
+
+	// 覆盖图像后以新内容重新生成缩略图
+	{
+		asserts.NoError(writeTestImage(thumbFile, 100, 100))
+		asserts.NoError(writeTestImage(util.RelativePath(source), 800, 200))
+		waiter := &PostProcessWaiter{}
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, originFile)
+		ctx = context.WithValue(ctx, fsctx.PostProcessWaiterCtx, waiter)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)pic_info(.+)").WithArgs("800,200", 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_status(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_size(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		asserts.NoError(GenericAfterUpdate(ctx, fs, &fsctx.FileStream{Size: 10, SavePath: source}))
+		asserts.True(waiter.Wait(10 * time.Second))
+		asserts.NoError(mock.ExpectationsWereMet())
+
+		thumb, err := os.Open(thumbFile)
+		asserts.NoError(err)
+		config, err := png.DecodeConfig(thumb)
+		thumb.Close()
+		asserts.NoError(err)
+		asserts.Equal(4*config.Height, config.Width)
+	}
+
+	// 延迟生成，仅删除旧缩略图并清除缓存记录
+	{
+		cache.Set("setting_thumb_refresh_on_update", ThumbRefreshLazy, 0)
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, originFile)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_status(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		asserts.NoError(GenericAfterUpdate(ctx, fs, &fsctx.FileStream{Size: 10, SavePath: source}))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.False(util.Exists(thumbFile))
+	}
+}
+
 func TestHookGenerateThumb(t *testing.T) {
 	a := assert.New(t)
 	mockHandler := &FileHeaderMock{}
@@ -494,6 +743,46 @@ func TestHookGenerateThumb(t *testing.T) {
 	mockHandler.AssertExpectations(t)
 }
 
+func TestPostProcessWaiter(t *testing.T) {
+	a := assert.New(t)
+	fs := &FileSystem{}
+
+	// 任务完成
+	{
+		waiter := &PostProcessWaiter{}
+		ctx := context.WithValue(context.Background(), fsctx.PostProcessWaiterCtx, waiter)
+		finished := false
+		fs.runPostProcess(ctx, func() {
+			time.Sleep(10 * time.Millisecond)
+			finished = true
+		})
+		a.True(waiter.Wait(time.Second))
+		a.True(finished)
+	}
+
+	// 等待超时
+	{
+		waiter := &PostProcessWaiter{}
+		ctx := context.WithValue(context.Background(), fsctx.PostProcessWaiterCtx, waiter)
+		release := make(chan struct{})
+		fs.runPostProcess(ctx, func() {
+			<-release
+		})
+		a.False(waiter.Wait(10 * time.Millisecond))
+		close(release)
+		a.True(waiter.Wait(time.Second))
+	}
+
+	// 未指定时异步执行
+	{
+		done := make(chan struct{})
+		fs.runPostProcess(context.Background(), func() {
+			close(done)
+		})
+		<-done
+	}
+}
+
 func TestSlaveAfterUpload(t *testing.T) {
 	asserts := assert.New(t)
 	conf.SystemConfig.Mode = "slave"
@@ -655,6 +944,179 @@ func TestHookChunkUploadFailed(t *testing.T) {
 	a.NoError(mock.ExpectationsWereMet())
 }
 
+func TestHookVerifyChecksum(t *testing.T) {
+	a := assert.New(t)
+	file := &fsctx.FileStream{Model: &model.File{Model: gorm.Model{ID: 1}, Name: "1.txt", SourceName: "1.txt"}}
+
+	// 未声明校验值
+	{
+		fs := &FileSystem{}
+		a.NoError(HookVerifyChecksum("")(context.Background(), fs, file))
+	}
+
+	// 读取失败
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.txt").Return(MockRSC{}, errors.New("error"))
+		fs := &FileSystem{Handler: testHandler}
+		a.Error(HookVerifyChecksum("827ccb0eea8a706c4c34a16891f84e7b")(context.Background(), fs, file))
+	}
+
+	// 校验值不一致
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.txt").
+			Return(MockRSC{rs: strings.NewReader("1234")}, nil)
+		fs := &FileSystem{Handler: testHandler}
+		err := HookVerifyChecksum("827ccb0eea8a706c4c34a16891f84e7b")(context.Background(), fs, file)
+		a.True(IsChecksumMismatch(err))
+	}
+
+	// 成功，保存校验值
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.txt").
+			Return(MockRSC{rs: strings.NewReader("12345")}, nil)
+		fs := &FileSystem{Handler: testHandler}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs("827ccb0eea8a706c4c34a16891f84e7b", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		a.NoError(HookVerifyChecksum("827CCB0EEA8A706C4C34A16891F84E7B")(context.Background(), fs, file))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 存储端已确认，不回读
+	{
+		fs := &FileSystem{Handler: new(FileHeaderMock)}
+		file.SetMetadata(committedMD5MetadataKey, "202cb962ac59075b964b07152d234b70")
+		err := HookVerifyChecksum("827ccb0eea8a706c4c34a16891f84e7b")(context.Background(), fs, file)
+		a.True(IsChecksumMismatch(err))
+	}
+}
+
+func TestHookValidateUniqueContent(t *testing.T) {
+	a := assert.New(t)
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+	newFile := func() *fsctx.FileStream {
+		return &fsctx.FileStream{Model: &model.File{
+			Model:      gorm.Model{ID: 1},
+			Name:       "1.txt",
+			SourceName: "1.txt",
+			FolderID:   2,
+		}}
+	}
+
+	// 目录未开启
+	{
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "unique_content"}).AddRow(2, false))
+		a.NoError(HookValidateUniqueContent(context.Background(), fs, newFile()))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 读取失败
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.txt").Return(MockRSC{}, errors.New("error"))
+		fs.Handler = testHandler
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "unique_content"}).AddRow(2, true))
+		a.Error(HookValidateUniqueContent(context.Background(), fs, newFile()))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 无相同内容的文件，保存校验值
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.txt").
+			Return(MockRSC{rs: strings.NewReader("12345")}, nil)
+		fs.Handler = testHandler
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "unique_content"}).AddRow(2, true))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs("827ccb0eea8a706c4c34a16891f84e7b", sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT(.+)files(.+)").
+			WithArgs(2, "827ccb0eea8a706c4c34a16891f84e7b", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		a.NoError(HookValidateUniqueContent(context.Background(), fs, newFile()))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 已有相同内容的文件
+	{
+		file := newFile()
+		file.Model.(*model.File).MD5 = "827ccb0eea8a706c4c34a16891f84e7b"
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "unique_content"}).AddRow(2, true))
+		mock.ExpectQuery("SELECT(.+)files(.+)").
+			WithArgs(2, "827ccb0eea8a706c4c34a16891f84e7b", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "existed.txt"))
+		err := HookValidateUniqueContent(context.Background(), fs, file)
+		a.NoError(mock.ExpectationsWereMet())
+		a.True(ShouldDiscardUpload(err))
+		a.Equal("existed.txt", err.(serializer.AppError).Data.(serializer.Object).Name)
+	}
+}
+
+func TestHookValidateUniqueName(t *testing.T) {
+	a := assert.New(t)
+	cache.Set("setting_unique_name_exts", "pdf", 0)
+	cache.Set("setting_unique_name_scope", "instance", 0)
+	defer cache.Deletes([]string{"unique_name_exts", "unique_name_scope"}, "setting_")
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+	nameKey := *model.UniqueNameKey(1, "INV-001.pdf")
+
+	// 扩展名无需唯一
+	a.NoError(HookValidateUniqueName(context.Background(), fs, &fsctx.FileStream{Name: "1.txt"}))
+
+	// 未被使用
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)name_key(.+)").WithArgs(nameKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		a.NoError(HookValidateUniqueName(context.Background(), fs, &fsctx.FileStream{Name: "INV-001.pdf"}))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 覆盖文件自身
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)name_key(.+)").WithArgs(nameKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(2, 1))
+		a.NoError(HookValidateUniqueName(context.Background(), fs, &fsctx.FileStream{
+			Name:  "INV-001.pdf",
+			Model: &model.File{Model: gorm.Model{ID: 2}},
+		}))
+		a.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 已被其他用户使用，不返回位置
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)name_key(.+)").WithArgs(nameKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "folder_id"}).AddRow(2, 2, 3))
+		err := HookValidateUniqueName(context.Background(), fs, &fsctx.FileStream{Name: "INV-001.pdf"})
+		a.NoError(mock.ExpectationsWereMet())
+		a.Equal(ErrNameNotUnique, err)
+	}
+
+	// 已被当前用户使用，返回位置
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)name_key(.+)").WithArgs(nameKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "user_id", "folder_id"}).AddRow(2, "INV-001.pdf", 1, 1))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "owner_id"}).AddRow(1, "/", 1))
+		err := HookValidateUniqueName(context.Background(), fs, &fsctx.FileStream{Name: "INV-001.pdf"})
+		a.NoError(mock.ExpectationsWereMet())
+		a.Error(err)
+		appErr, ok := err.(serializer.AppError)
+		a.True(ok)
+		a.Equal(serializer.CodeNameNotUnique, appErr.Code)
+		a.Equal("/", appErr.Data.(serializer.Object).Path)
+		a.Equal("INV-001.pdf", appErr.Data.(serializer.Object).Name)
+	}
+}
+
 func TestHookPopPlaceholderToFile(t *testing.T) {
 	a := assert.New(t)
 	fs := &FileSystem{}
@@ -704,3 +1166,125 @@ func TestHookDeleteUploadSession(t *testing.T) {
 	_, ok := cache.Get(UploadSessionCachePrefix + "TestHookDeleteUploadSession")
 	a.False(ok)
 }
+
+func TestHookComputeChecksum(t *testing.T) {
+	asserts := assert.New(t)
+	source := "TestHookComputeChecksum.txt"
+	asserts.NoError(ioutil.WriteFile(util.RelativePath(source), []byte("hello"), 0644))
+	defer os.Remove(util.RelativePath(source))
+
+	fs := &FileSystem{Policy: &model.Policy{Type: "local"}, Handler: local.Driver{}}
+	fileModel := &model.File{Model: gorm.Model{ID: 1}, Name: source, SourceName: source}
+	file := &fsctx.FileStream{Model: fileModel}
+
+	// 不支持的算法
+	asserts.NoError(HookComputeChecksum("crc32")(context.Background(), fs, file))
+	asserts.Empty(fileModel.Checksum)
+
+	// 计算并保存
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)checksum(.+)").
+		WithArgs("sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(HookComputeChecksum(ChecksumSHA256)(context.Background(), fs, file))
+	asserts.NoError(mock.ExpectationsWereMet())
+	algo, digest := fileModel.GetChecksum()
+	asserts.Equal(ChecksumSHA256, algo)
+	asserts.Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", digest)
+
+	// 文件不在本机
+	fileModel.Checksum = ""
+	fs.Policy.Type = "remote"
+	asserts.NoError(HookComputeChecksum(ChecksumSHA256)(context.Background(), fs, file))
+	asserts.Empty(fileModel.Checksum)
+
+	// 读取失败不影响上传
+	fs.Policy.Type = "local"
+	fileModel.SourceName = "not_exist.txt"
+	asserts.NoError(HookComputeChecksum(ChecksumMD5)(context.Background(), fs, file))
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
+func TestFileSystem_TriggerParallel(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	ctx := context.Background()
+
+	// 无钩子
+	{
+		asserts.NoError(fs.TriggerParallel(ctx, "AfterUpload", &fsctx.FileStream{}))
+	}
+
+	// 钩子并发执行
+	{
+		fs.CleanHooks("")
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		wait := func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		}
+		fs.Use("AfterUpload", wait)
+		fs.Use("AfterUpload", wait)
+		go func() {
+			<-started
+			<-started
+			close(release)
+		}()
+		asserts.NoError(fs.TriggerParallel(ctx, "AfterUpload", &fsctx.FileStream{}))
+	}
+
+	// 合并全部错误，panic 转换为错误，不影响其他钩子
+	{
+		fs.CleanHooks("")
+		err1 := errors.New("error 1")
+		err2 := errors.New("error 2")
+		executed := make(chan struct{}, 1)
+		fs.Use("AfterUpload", func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			return err1
+		})
+		fs.Use("AfterUpload", func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			panic("oops")
+		})
+		fs.Use("AfterUpload", func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			return err2
+		})
+		fs.Use("AfterUpload", func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			executed <- struct{}{}
+			return nil
+		})
+		err := fs.TriggerParallel(ctx, "AfterUpload", &fsctx.FileStream{})
+		asserts.ErrorIs(err, err1)
+		asserts.ErrorIs(err, err2)
+		asserts.Contains(err.Error(), "hook panicked: oops")
+		asserts.Len(executed, 1)
+	}
+
+	// 执行中的钩子感知取消
+	{
+		fs.CleanHooks("")
+		cancelCtx, cancel := context.WithCancel(ctx)
+		fs.Use("AfterUpload", func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		go cancel()
+		asserts.ErrorIs(fs.TriggerParallel(cancelCtx, "AfterUpload", &fsctx.FileStream{}), context.Canceled)
+	}
+
+	// 已取消时不再执行钩子
+	{
+		fs.CleanHooks("")
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		called := false
+		fs.Use("AfterUpload", func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			called = true
+			return nil
+		})
+		asserts.ErrorIs(fs.TriggerParallel(cancelCtx, "AfterUpload", &fsctx.FileStream{}), context.Canceled)
+		asserts.False(called)
+	}
+}
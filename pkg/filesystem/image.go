@@ -6,11 +6,14 @@ import (
 	"sync"
 
 	"runtime"
+	"strconv"
+	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/thumb"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 )
@@ -27,12 +30,27 @@ var HandledExtension = []string{"jpg", "jpeg", "png", "gif"}
 func (fs *FileSystem) GetThumb(ctx context.Context, id uint) (*response.ContentResponse, error) {
 	// 根据 ID 查找文件
 	err := fs.resetFileIDIfNotExist(ctx, id)
-	if err != nil || fs.FileTarget[0].PicInfo == "" {
+	if err != nil || fs.FileTarget[0].PicInfo == "" || !isThumbAvailable(&fs.FileTarget[0]) ||
+		(fs.Policy != nil && !fs.Policy.IsThumbEnabledFor(fs.FileTarget[0].Name)) {
 		return &response.ContentResponse{
 			Redirect: false,
 		}, ErrObjectNotExist
 	}
 
+	// 缩略图同样暴露文件内容，设有下载密码的文件需先解锁
+	if err := checkFileUnlocked(ctx, &fs.FileTarget[0]); err != nil {
+		return &response.ContentResponse{
+			Redirect: false,
+		}, err
+	}
+
+	// 仅允许签名链接访问的存储策略需验证签名
+	if err := fs.checkSignedAccess(ctx, &fs.FileTarget[0]); err != nil {
+		return &response.ContentResponse{
+			Redirect: false,
+		}, err
+	}
+
 	w, h := fs.GenerateThumbnailSize(0, 0)
 	ctx = context.WithValue(ctx, fsctx.ThumbSizeCtx, [2]uint{w, h})
 	ctx = context.WithValue(ctx, fsctx.FileModelCtx, fs.FileTarget[0])
@@ -46,6 +64,11 @@ func (fs *FileSystem) GetThumb(ctx context.Context, id uint) (*response.ContentR
 
 	if err == nil && conf.SystemConfig.Mode == "master" {
 		res.MaxAge = model.GetIntSetting("preview_timeout", 60)
+		touchThumb(&fs.FileTarget[0])
+	}
+
+	if err == nil {
+		fs.logSignedAccess(ctx, &fs.FileTarget[0])
 	}
 
 	return res, err
@@ -59,6 +82,11 @@ var once sync.Once
 type Pool struct {
 	// 容量
 	worker chan int
+	// 解码图像可占用的估算内存总量，0 表示不限制
+	memoryBudget uint64
+	// 正在处理的任务占用的估算内存
+	memoryInUse uint64
+	memoryCond  *sync.Cond
 }
 
 // Init 初始化任务池
@@ -68,10 +96,13 @@ func getThumbWorker() *Pool {
 		if maxWorker <= 0 {
 			maxWorker = runtime.GOMAXPROCS(0)
 		}
+		memoryBudget, _ := strconv.ParseUint(model.GetSettingByNameWithDefault("thumb_max_memory", "0"), 10, 64)
 		thumbPool = &Pool{
-			worker: make(chan int, maxWorker),
+			worker:       make(chan int, maxWorker),
+			memoryBudget: memoryBudget,
+			memoryCond:   sync.NewCond(&sync.Mutex{}),
 		}
-		util.Log().Debug("Initialize thumbnails task queue with: WorkerNum = %d", maxWorker)
+		util.Log().Debug("Initialize thumbnails task queue with: WorkerNum = %d, MemoryBudget = %d", maxWorker, memoryBudget)
 	})
 	return thumbPool
 }
@@ -84,11 +115,84 @@ func (pool *Pool) releaseWorker() {
 	<-pool.worker
 }
 
+// acquireMemory 等待直到占用的估算内存加上 size 不超出预算。
+// 单个任务超出预算时，在没有其他任务占用内存时放行，避免永久等待
+func (pool *Pool) acquireMemory(size uint64) {
+	if pool.memoryBudget == 0 {
+		return
+	}
+
+	pool.memoryCond.L.Lock()
+	defer pool.memoryCond.L.Unlock()
+	for pool.memoryInUse > 0 && pool.memoryInUse+size > pool.memoryBudget {
+		pool.memoryCond.Wait()
+	}
+	pool.memoryInUse += size
+}
+
+// releaseMemory 释放任务占用的估算内存
+func (pool *Pool) releaseMemory(size uint64) {
+	if pool.memoryBudget == 0 {
+		return
+	}
+
+	pool.memoryCond.L.Lock()
+	pool.memoryInUse -= size
+	pool.memoryCond.L.Unlock()
+	pool.memoryCond.Broadcast()
+}
+
+// isThumbAvailable 返回文件的缩略图生成状态是否允许获取或重新生成缩略图
+func isThumbAvailable(file *model.File) bool {
+	return file.ThumbStatus != model.ThumbStatusFailed && file.ThumbStatus != model.ThumbStatusUnsupported
+}
+
+// setThumbStatus 设定文件的缩略图生成状态，文件已入库时同步更新数据库
+func setThumbStatus(file *model.File, status string, retries int) {
+	if file.Model.ID == 0 {
+		file.ThumbStatus = status
+		file.ThumbRetries = retries
+		return
+	}
+
+	if err := file.UpdateThumbStatus(status, retries); err != nil {
+		util.Log().Warning("Failed to update thumb status of file %q: %s", file.Name, err)
+	}
+}
+
+// markThumbFailed 记录一次缩略图生成失败，失败次数达到 thumb_max_retry 后
+// 标记为失败状态，不再自动重试；thumb_max_retry 小于等于 0 时始终重试
+func markThumbFailed(file *model.File) {
+	retries := file.ThumbRetries + 1
+	status := model.ThumbStatusPending
+	if maxRetry := model.GetIntSetting("thumb_max_retry", 3); maxRetry > 0 && retries >= maxRetry {
+		status = model.ThumbStatusFailed
+	}
+
+	setThumbStatus(file, status, retries)
+}
+
 // GenerateThumbnail 尝试为本地策略文件生成缩略图并获取图像原始大小
 // TODO 失败时，如果之前还有图像信息，则清除
 func (fs *FileSystem) GenerateThumbnail(ctx context.Context, file *model.File) {
 	// 判断是否可以生成缩略图
 	if !IsInExtensionList(HandledExtension, file.Name) {
+		if file.ThumbStatus != model.ThumbStatusUnsupported {
+			setThumbStatus(file, model.ThumbStatusUnsupported, 0)
+		}
+		return
+	}
+
+	// 存储策略设定不为此类文件生成缩略图
+	if fs.Policy != nil && !fs.Policy.IsThumbEnabledFor(file.Name) {
+		if file.ThumbStatus != model.ThumbStatusDisabled {
+			setThumbStatus(file, model.ThumbStatusDisabled, 0)
+		}
+		return
+	}
+
+	// 之前已多次失败的不再重试
+	if !isThumbAvailable(file) {
 		return
 	}
 
@@ -97,17 +201,27 @@ func (fs *FileSystem) GenerateThumbnail(ctx context.Context, file *model.File) {
 	defer cancel()
 
 	// 获取文件数据
-	source, err := fs.Handler.Get(newCtx, file.SourceName)
+	source, err := fs.OpenObject(WithInternalRead(newCtx), file)
 	if err != nil {
+		markThumbFailed(file)
 		return
 	}
 	defer source.Close()
+
+	// 根据图像头部估算解码所需内存，无法读取时以文件大小代替，解码时再报告错误
+	memory, reader, err := thumb.EstimateMemory(source)
+	if err != nil {
+		memory = file.Size
+	}
+	getThumbWorker().acquireMemory(memory)
+	defer getThumbWorker().releaseMemory(memory)
 	getThumbWorker().addWorker()
 	defer getThumbWorker().releaseWorker()
 
-	image, err := thumb.NewThumbFromFile(source, file.Name)
+	image, err := thumb.NewThumbFromFile(reader, file.Name)
 	if err != nil {
 		util.Log().Warning("Cannot generate thumb because of failed to parse image %q: %s", file.SourceName, err)
+		markThumbFailed(file)
 		return
 	}
 
@@ -116,6 +230,12 @@ func (fs *FileSystem) GenerateThumbnail(ctx context.Context, file *model.File) {
 
 	// 生成缩略图
 	image.GetThumb(fs.GenerateThumbnailSize(w, h))
+	// 转换到 sRGB，避免广色域图像的缩略图在浏览器中颜色失真
+	if model.IsTrueVal(model.GetSettingByNameWithDefault("thumb_convert_srgb", "1")) {
+		if _, err := image.ToSRGB(); err != nil {
+			util.Log().Debug("Failed to convert color profile of thumb %q: %s", file.SourceName, err)
+		}
+	}
 	// 保存到文件
 	err = image.Save(util.RelativePath(file.SourceName + model.GetSettingByNameWithDefault("thumb_file_suffix", "._thumb")))
 	image = nil
@@ -126,6 +246,7 @@ func (fs *FileSystem) GenerateThumbnail(ctx context.Context, file *model.File) {
 
 	if err != nil {
 		util.Log().Warning("Failed to save thumb: %s", err)
+		markThumbFailed(file)
 		return
 	}
 
@@ -139,10 +260,272 @@ func (fs *FileSystem) GenerateThumbnail(ctx context.Context, file *model.File) {
 	// 失败时删除缩略图文件
 	if err != nil {
 		_, _ = fs.Handler.Delete(newCtx, []string{file.SourceName + model.GetSettingByNameWithDefault("thumb_file_suffix", "._thumb")})
+		return
 	}
+
+	setThumbStatus(file, model.ThumbStatusOK, 0)
+	recordThumbCache(file)
+}
+
+// ThumbBatchResult 批量生成缩略图的统计结果
+type ThumbBatchResult struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+}
+
+// GenerateThumbnails 批量为文件生成缩略图，相同文件只处理一次，
+// 并发数不超过缩略图任务池的容量
+func (fs *FileSystem) GenerateThumbnails(ctx context.Context, files []*model.File) ThumbBatchResult {
+	var (
+		res   ThumbBatchResult
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		queue = make(chan *model.File)
+		seen  = make(map[string]bool, len(files))
+	)
+
+	worker := cap(getThumbWorker().worker)
+	for i := 0; i < worker; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range queue {
+				fs.GenerateThumbnail(ctx, file)
+
+				mu.Lock()
+				switch file.ThumbStatus {
+				case model.ThumbStatusOK:
+					res.Succeeded++
+				case model.ThumbStatusUnsupported, model.ThumbStatusDisabled:
+					res.Skipped++
+				default:
+					res.Failed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, file := range files {
+		key := file.SourceName
+		if file.ID > 0 {
+			key = fmt.Sprintf("%d", file.ID)
+		}
+
+		if seen[key] || !isThumbAvailable(file) {
+			res.Skipped++
+			continue
+		}
+		seen[key] = true
+		queue <- file
+	}
+
+	close(queue)
+	wg.Wait()
+
+	util.Log().Debug("Batch thumbnail generation finished: %d succeeded, %d failed, %d skipped.", res.Succeeded, res.Failed, res.Skipped)
+	return res
+}
+
+// WarmThumbnails 为给定文件中的图像预先生成缩略图，已有缩略图或存储策略不需要生成
+// 缩略图的文件视为跳过，其余文件按存储策略分组后交由 GenerateThumbnails 处理
+func (fs *FileSystem) WarmThumbnails(ctx context.Context, files []model.File) ThumbBatchResult {
+	var (
+		res      ThumbBatchResult
+		policies = make(map[uint]*model.Policy)
+		groups   = make(map[uint][]*model.File)
+		order    []uint
+	)
+
+	suffix := model.GetSettingByNameWithDefault("thumb_file_suffix", "._thumb")
+	for i := range files {
+		file := &files[i]
+		if file.UploadSessionID != nil || !IsInExtensionList(HandledExtension, file.Name) ||
+			file.ThumbStatus == model.ThumbStatusOK || !isThumbAvailable(file) {
+			res.Skipped++
+			continue
+		}
+
+		policy := file.GetPolicy()
+		if !policy.IsThumbGenerateNeeded() || util.Exists(util.RelativePath(file.SourceName+suffix)) {
+			res.Skipped++
+			continue
+		}
+
+		if _, ok := groups[policy.ID]; !ok {
+			policies[policy.ID] = policy
+			order = append(order, policy.ID)
+		}
+		groups[policy.ID] = append(groups[policy.ID], file)
+	}
+
+	for _, id := range order {
+		fs.Policy = policies[id]
+		if err := fs.DispatchHandler(); err != nil {
+			util.Log().Warning("Failed to dispatch handler for policy %d: %s", id, err)
+			res.Failed += len(groups[id])
+			continue
+		}
+
+		r := fs.GenerateThumbnails(ctx, groups[id])
+		res.Succeeded += r.Succeeded
+		res.Failed += r.Failed
+		res.Skipped += r.Skipped
+	}
+
+	return res
 }
 
 // GenerateThumbnailSize 获取要生成的缩略图的尺寸
 func (fs *FileSystem) GenerateThumbnailSize(w, h int) (uint, uint) {
 	return uint(model.GetIntSetting("thumb_width", 400)), uint(model.GetIntSetting("thumb_width", 300))
 }
+
+// phashIndex 按用户划分的图像感知哈希索引，首次查询时从数据库构建
+var (
+	phashIndex   = make(map[uint]*thumb.BKTree)
+	phashIndexMu sync.Mutex
+)
+
+// getPHashIndex 获取用户的感知哈希索引，不存在时从数据库构建
+func getPHashIndex(uid uint) (*thumb.BKTree, error) {
+	phashIndexMu.Lock()
+	defer phashIndexMu.Unlock()
+
+	if tree, ok := phashIndex[uid]; ok {
+		return tree, nil
+	}
+
+	files, err := model.GetImageHashesByUser(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &thumb.BKTree{}
+	for _, file := range files {
+		tree.Add(uint64(file.PHash), file.ID)
+	}
+	phashIndex[uid] = tree
+	return tree, nil
+}
+
+// GeneratePerceptualHash 计算图像文件的感知哈希并保存到文件记录
+func (fs *FileSystem) GeneratePerceptualHash(ctx context.Context, file *model.File) error {
+	if !IsInExtensionList(HandledExtension, file.Name) {
+		return nil
+	}
+
+	source, err := fs.OpenObject(WithInternalRead(ctx), file)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	image, err := thumb.NewThumbFromFile(source, file.Name)
+	if err != nil {
+		return err
+	}
+
+	hash := image.DHash()
+	if err := file.UpdatePHash(hash); err != nil {
+		return err
+	}
+
+	// 已构建的索引中追加新哈希
+	phashIndexMu.Lock()
+	if tree, ok := phashIndex[file.UserID]; ok {
+		tree.Add(hash, file.ID)
+	}
+	phashIndexMu.Unlock()
+
+	return nil
+}
+
+// CaptureTimeMetadataKey 文件元数据中记录图像拍摄时间的键
+const CaptureTimeMetadataKey = "capture_time"
+
+// exifExtension 可读取 EXIF 拍摄时间的图像扩展名
+var exifExtension = []string{"jpg", "jpeg"}
+
+// ExtractCaptureTime 读取图像 EXIF 中的拍摄时间并保存到文件元数据，无拍摄时间时不做修改
+func (fs *FileSystem) ExtractCaptureTime(ctx context.Context, file *model.File) error {
+	if !IsInExtensionList(exifExtension, file.Name) {
+		return nil
+	}
+
+	source, err := fs.OpenObject(WithInternalRead(ctx), file)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	captured, err := thumb.ReadCaptureTime(source)
+	if err != nil {
+		if err == thumb.ErrNoCaptureTime {
+			return nil
+		}
+		return err
+	}
+
+	meta := make(map[string]string, len(file.MetadataSerialized)+1)
+	for key, value := range file.MetadataSerialized {
+		meta[key] = value
+	}
+	meta[CaptureTimeMetadataKey] = captured.Format(time.RFC3339)
+	return file.UpdateMetadata(meta)
+}
+
+// CaptureTimeOf 返回图像文件的拍摄时间，未记录时以上传时间代替，非图像文件返回 nil
+func CaptureTimeOf(file *model.File) *time.Time {
+	if !IsInExtensionList(HandledExtension, file.Name) {
+		return nil
+	}
+
+	if raw, ok := file.MetadataSerialized[CaptureTimeMetadataKey]; ok {
+		if captured, err := time.Parse(time.RFC3339, raw); err == nil {
+			return &captured
+		}
+	}
+
+	created := file.CreatedAt
+	return &created
+}
+
+// FindSimilarImages 查找与给定文件感知哈希的汉明距离不超过 maxDistance 的图像
+func (fs *FileSystem) FindSimilarImages(ctx context.Context, id uint, maxDistance int) ([]serializer.Object, error) {
+	err := fs.resetFileIDIfNotExist(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	target := fs.FileTarget[0]
+	if target.PHash == 0 {
+		return nil, ErrPerceptualHashNotExist
+	}
+
+	tree, err := getPHashIndex(fs.User.ID)
+	if err != nil {
+		return nil, ErrDBListObjects.WithError(err)
+	}
+
+	ids := make([]uint, 0)
+	for _, candidate := range tree.Search(uint64(target.PHash), maxDistance) {
+		if candidate != target.ID {
+			ids = append(ids, candidate)
+		}
+	}
+
+	if len(ids) == 0 {
+		return []serializer.Object{}, nil
+	}
+
+	// 索引中可能存在已删除的文件，以数据库为准
+	files, err := model.GetFilesByIDs(ids, fs.User.ID)
+	if err != nil {
+		return nil, ErrDBListObjects.WithError(err)
+	}
+
+	fs.FileTarget = files
+	return fs.listObjects(ctx, "/", files, nil, nil), nil
+}
@@ -3,12 +3,17 @@ package filesystem
 import (
 	"context"
 	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/jinzhu/gorm"
 	testMock "github.com/stretchr/testify/mock"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -39,6 +44,17 @@ func TestFileSystem_GetThumb(t *testing.T) {
 		asserts.NoError(err)
 		asserts.EqualValues(50, res.MaxAge)
 	}
+
+	// 缩略图已生成失败
+	{
+		testHandller := new(FileHeaderMock)
+		fs.CleanTargets()
+		fs.SetTargetFile(&[]model.File{{PicInfo: "1,1", ThumbStatus: model.ThumbStatusFailed}})
+		fs.Handler = testHandller
+		_, err := fs.GetThumb(context.Background(), 1)
+		asserts.Equal(ErrObjectNotExist, err)
+		testHandller.AssertNotCalled(t, "Thumb", testMock.Anything, testMock.Anything)
+	}
 }
 
 func TestFileSystem_ThumbWorker(t *testing.T) {
@@ -50,6 +66,42 @@ func TestFileSystem_ThumbWorker(t *testing.T) {
 	})
 }
 
+func TestPool_Memory(t *testing.T) {
+	asserts := assert.New(t)
+	pool := &Pool{memoryBudget: 100, memoryCond: sync.NewCond(&sync.Mutex{})}
+
+	// 预算内直接放行
+	pool.acquireMemory(60)
+	asserts.EqualValues(60, pool.memoryInUse)
+
+	// 超出预算时等待释放
+	admitted := make(chan struct{})
+	go func() {
+		pool.acquireMemory(50)
+		close(admitted)
+	}()
+	select {
+	case <-admitted:
+		t.Fatal("job should not be admitted before memory released")
+	case <-time.After(50 * time.Millisecond):
+	}
+	pool.releaseMemory(60)
+	<-admitted
+	asserts.EqualValues(50, pool.memoryInUse)
+	pool.releaseMemory(50)
+
+	// 单个任务超出预算时，无其他任务占用则放行
+	pool.acquireMemory(200)
+	asserts.EqualValues(200, pool.memoryInUse)
+	pool.releaseMemory(200)
+
+	// 未设定预算
+	pool = &Pool{}
+	pool.acquireMemory(200)
+	pool.releaseMemory(200)
+	asserts.EqualValues(0, pool.memoryInUse)
+}
+
 func TestFileSystem_GenerateThumbnail(t *testing.T) {
 	fs := &FileSystem{User: &model.User{}}
 
@@ -68,3 +120,225 @@ func TestFileSystem_GenerateThumbnail(t *testing.T) {
 		testHandller.AssertExpectations(t)
 	}
 }
+
+func TestFileSystem_GenerateThumbnailStatus(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_thumb_max_retry", "2", 0)
+
+	// 不支持的格式
+	{
+		file := &model.File{Name: "test.txt"}
+		fs.GenerateThumbnail(context.Background(), file)
+		asserts.Equal(model.ThumbStatusUnsupported, file.ThumbStatus)
+	}
+
+	// 存储策略排除的扩展名
+	{
+		testHandller := new(FileHeaderMock)
+		fs.Handler = testHandller
+		fs.Policy = &model.Policy{OptionsSerialized: model.PolicyOption{ThumbExcludeExts: []string{"png"}}}
+		file := &model.File{Name: "test.png"}
+		fs.GenerateThumbnail(context.Background(), file)
+		asserts.Equal(model.ThumbStatusDisabled, file.ThumbStatus)
+		testHandller.AssertNotCalled(t, "Get", testMock.Anything, testMock.Anything)
+		fs.Policy = nil
+	}
+
+	// 失败次数未达上限，仍为待生成状态
+	{
+		testHandller := new(FileHeaderMock)
+		testHandller.On("Get", testMock.Anything, "").Return(request.NopRSCloser{}, errors.New("error"))
+		fs.Handler = testHandller
+		file := &model.File{Name: "test.png"}
+		fs.GenerateThumbnail(context.Background(), file)
+		asserts.Equal(model.ThumbStatusPending, file.ThumbStatus)
+		asserts.Equal(1, file.ThumbRetries)
+
+		// 达到上限后标记为失败
+		fs.GenerateThumbnail(context.Background(), file)
+		asserts.Equal(model.ThumbStatusFailed, file.ThumbStatus)
+		asserts.Equal(2, file.ThumbRetries)
+
+		// 失败后不再重试
+		fs.GenerateThumbnail(context.Background(), file)
+		asserts.Equal(2, file.ThumbRetries)
+	}
+
+	// 已入库的文件同步更新数据库
+	{
+		testHandller := new(FileHeaderMock)
+		testHandller.On("Get", testMock.Anything, "").Return(request.NopRSCloser{}, errors.New("error"))
+		fs.Handler = testHandller
+		file := &model.File{Name: "test.png", ThumbRetries: 1}
+		file.ID = 1
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_status(.+)").WithArgs(2, model.ThumbStatusFailed, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		fs.GenerateThumbnail(context.Background(), file)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(model.ThumbStatusFailed, file.ThumbStatus)
+	}
+
+	cache.Deletes([]string{"thumb_max_retry"}, "setting_")
+}
+
+func TestFileSystem_GenerateThumbnails(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_thumb_max_retry", "3", 0)
+	testHandller := new(FileHeaderMock)
+	testHandller.On("Get", testMock.Anything, "1.png").Return(request.NopRSCloser{}, errors.New("error"))
+	fs.Handler = testHandller
+
+	failed := &model.File{Name: "1.png", SourceName: "1.png"}
+	res := fs.GenerateThumbnails(context.Background(), []*model.File{
+		failed,
+		failed,
+		{Name: "2.txt", SourceName: "2.txt"},
+		{Name: "3.png", ThumbStatus: model.ThumbStatusFailed},
+	})
+	asserts.Equal(ThumbBatchResult{Succeeded: 0, Failed: 1, Skipped: 3}, res)
+	asserts.Equal(1, failed.ThumbRetries)
+
+	cache.Deletes([]string{"thumb_max_retry"}, "setting_")
+}
+
+func TestFileSystem_WarmThumbnails(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_thumb_max_retry", "3", 0)
+	local := model.Policy{Type: "local"}
+	local.ID = 1
+	remote := model.Policy{Type: "remote"}
+	remote.ID = 2
+
+	res := fs.WarmThumbnails(context.Background(), []model.File{
+		{Name: "1.png", SourceName: "not_exist.png", Policy: local},
+		{Name: "2.png", SourceName: "2.png", Policy: remote},
+		{Name: "3.txt", SourceName: "3.txt", Policy: local},
+		{Name: "4.png", SourceName: "4.png", Policy: local, ThumbStatus: model.ThumbStatusOK},
+	})
+	asserts.Equal(ThumbBatchResult{Succeeded: 0, Failed: 1, Skipped: 3}, res)
+	asserts.Equal("local", fs.Policy.Type)
+
+	cache.Deletes([]string{"thumb_max_retry"}, "setting_")
+}
+
+func TestFileSystem_ExtractCaptureTime(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+
+	// 非 JPEG 文件
+	asserts.NoError(fs.ExtractCaptureTime(context.Background(), &model.File{Name: "1.png"}))
+
+	// 读取失败
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.jpg").Return(MockRSC{}, errors.New("error"))
+		fs.Handler = testHandler
+		asserts.Error(fs.ExtractCaptureTime(context.Background(), &model.File{Name: "1.jpg", SourceName: "1.jpg"}))
+	}
+
+	// 无 EXIF 信息，不做修改
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.jpg").
+			Return(MockRSC{rs: strings.NewReader("not a jpeg")}, nil)
+		fs.Handler = testHandler
+		file := &model.File{Name: "1.jpg", SourceName: "1.jpg"}
+		asserts.NoError(fs.ExtractCaptureTime(context.Background(), file))
+		asserts.Empty(file.MetadataSerialized)
+	}
+}
+
+func TestCaptureTimeOf(t *testing.T) {
+	asserts := assert.New(t)
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 非图像
+	asserts.Nil(CaptureTimeOf(&model.File{Name: "1.txt"}))
+
+	// 未记录拍摄时间，使用上传时间
+	{
+		file := &model.File{Name: "1.jpg", Model: gorm.Model{CreatedAt: created}}
+		asserts.True(CaptureTimeOf(file).Equal(created))
+	}
+
+	// 拍摄时间格式错误，使用上传时间
+	{
+		file := &model.File{Name: "1.jpg", Model: gorm.Model{CreatedAt: created},
+			MetadataSerialized: map[string]string{CaptureTimeMetadataKey: "bad"}}
+		asserts.True(CaptureTimeOf(file).Equal(created))
+	}
+
+	// 已记录拍摄时间
+	{
+		file := &model.File{Name: "1.jpg", Model: gorm.Model{CreatedAt: created},
+			MetadataSerialized: map[string]string{CaptureTimeMetadataKey: "2021-07-15T10:20:30+08:00"}}
+		asserts.True(CaptureTimeOf(file).Equal(time.Date(2021, 7, 15, 2, 20, 30, 0, time.UTC)))
+	}
+}
+
+func TestFileSystem_FindSimilarImages(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	fs.User.ID = 1
+	policy := model.Policy{Type: "mock"}
+	policy.ID = 1
+
+	// 未计算感知哈希
+	{
+		fs.SetTargetFile(&[]model.File{{Policy: policy}})
+		_, err := fs.FindSimilarImages(context.Background(), 1, 5)
+		asserts.Equal(ErrPerceptualHashNotExist, err)
+	}
+
+	// 成功
+	{
+		delete(phashIndex, 1)
+		fs.CleanTargets()
+		target := model.File{Policy: policy, PHash: 0b1111}
+		target.ID = 1
+		fs.SetTargetFile(&[]model.File{target})
+		mock.ExpectQuery("SELECT(.+)p_hash(.+)").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "p_hash"}).AddRow(1, 0b1111).AddRow(2, 0b0111).AddRow(3, 0b0000))
+		mock.ExpectQuery("SELECT(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "2.png"))
+		res, err := fs.FindSimilarImages(context.Background(), 1, 2)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Len(res, 1)
+		asserts.Equal("2.png", res[0].Name)
+	}
+
+	// 无相似图像，索引已缓存
+	{
+		fs.CleanTargets()
+		target := model.File{Policy: policy, PHash: 0b1111}
+		target.ID = 1
+		fs.SetTargetFile(&[]model.File{target})
+		res, err := fs.FindSimilarImages(context.Background(), 1, 0)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Len(res, 0)
+	}
+}
+
+func TestFileSystem_GeneratePerceptualHash(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+
+	// 非图像文件
+	asserts.NoError(fs.GeneratePerceptualHash(context.Background(), &model.File{Name: "1.txt"}))
+
+	// 无法获取文件数据
+	{
+		testHandller := new(FileHeaderMock)
+		testHandller.On("Get", testMock.Anything, "").Return(request.NopRSCloser{}, errors.New("error"))
+		fs.Handler = testHandller
+		asserts.Error(fs.GeneratePerceptualHash(context.Background(), &model.File{Name: "test.png"}))
+		testHandller.AssertExpectations(t)
+	}
+}
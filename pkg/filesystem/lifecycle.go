@@ -0,0 +1,218 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// 上传到对象存储的文件附带的生命周期标签，供存储端的生命周期规则按标签筛选
+const (
+	LifecycleTransitionDaysTag  = "cloudreve-transition-days"
+	LifecycleTransitionClassTag = "cloudreve-transition-class"
+	LifecycleExpireDaysTag      = "cloudreve-expire-days"
+)
+
+// LifecycleResult 一次生命周期处理的结果
+type LifecycleResult struct {
+	Transitioned int
+	Expired      int
+	Failed       int
+}
+
+// supportsStorageClass 返回存储策略是否支持指定存储类型
+func supportsStorageClass(policy *model.Policy) bool {
+	return policy != nil && (policy.Type == "s3" || policy.Type == "oss")
+}
+
+// lifecycleTags 返回规则对应的对象标签，规则为空时返回 nil
+func lifecycleTags(rule *model.LifecycleRule) map[string]string {
+	if rule.IsEmpty() {
+		return nil
+	}
+
+	tags := make(map[string]string)
+	if rule.HasTransition() {
+		tags[LifecycleTransitionDaysTag] = strconv.Itoa(rule.TransitionDays)
+		tags[LifecycleTransitionClassTag] = rule.TransitionClass
+	}
+	if rule.ExpireDays > 0 {
+		tags[LifecycleExpireDaysTag] = strconv.Itoa(rule.ExpireDays)
+	}
+	return tags
+}
+
+// applyUploadDefaults 为上传文件设定用户默认的存储类型及生命周期标签
+func (fs *FileSystem) applyUploadDefaults(file *fsctx.FileStream) {
+	if !supportsStorageClass(fs.Policy) {
+		return
+	}
+
+	if file.StorageClass == "" {
+		file.StorageClass = fs.User.OptionsSerialized.StorageClass
+	}
+
+	if file.Tags == nil {
+		file.Tags = lifecycleTags(model.EffectiveLifecycle(fs.User, fs.Policy))
+	}
+}
+
+// ApplyLifecycle 处理计划转换存储类型或删除的时间已到的文件，至多处理 limit 个。
+// 过期的文件按常规流程删除；本地存储策略下转换存储类型即将文件移至
+// lifecycle_local_archive_path，对象存储由存储端按标签完成转换，此处仅更新记录
+func ApplyLifecycle(ctx context.Context, limit int) (LifecycleResult, error) {
+	res := LifecycleResult{}
+	now := time.Now()
+	files, err := model.GetLifecycleDueFiles(now, limit)
+	if err != nil {
+		return res, ErrDBListObjects.WithError(err)
+	}
+
+	// 按用户分组，以所有者身份处理
+	userToFiles := make(map[uint][]model.File)
+	for _, file := range files {
+		userToFiles[file.UserID] = append(userToFiles[file.UserID], file)
+	}
+
+	for uid, userFiles := range userToFiles {
+		user, err := model.GetUserByID(uid)
+		if err != nil {
+			util.Log().Warning("Owner of lifecycle files cannot be found: %s", err)
+			res.Failed += len(userFiles)
+			continue
+		}
+
+		fs, err := NewFileSystem(&user)
+		if err != nil {
+			util.Log().Warning("Failed to initialize filesystem: %s", err)
+			res.Failed += len(userFiles)
+			continue
+		}
+
+		for i := range userFiles {
+			file := &userFiles[i]
+			if file.ExpireAt != nil && !file.ExpireAt.After(now) {
+				err = fs.expireFile(ctx, file, now)
+				if err == nil {
+					res.Expired++
+				}
+			} else {
+				err = fs.transitionFile(ctx, file)
+				if err == nil {
+					res.Transitioned++
+				}
+			}
+
+			if err != nil {
+				util.Log().Warning("Failed to apply lifecycle rule to file %q (#%d): %s", file.Name, file.ID, err)
+				res.Failed++
+			}
+		}
+
+		fs.Recycle()
+	}
+
+	return res, nil
+}
+
+// expireFile 删除过期的文件，仍在保留期内时推迟至保留期结束
+func (fs *FileSystem) expireFile(ctx context.Context, file *model.File, now time.Time) error {
+	if file.RetainUntil != nil && file.RetainUntil.After(now) {
+		return file.UpdateExpireAt(*file.RetainUntil)
+	}
+
+	fs.CleanTargets()
+	return fs.Delete(ctx, nil, []uint{file.ID}, false)
+}
+
+// transitionFile 转换文件的存储类型
+func (fs *FileSystem) transitionFile(ctx context.Context, file *model.File) error {
+	policy := file.GetPolicy()
+	rule := model.EffectiveLifecycle(fs.User, policy)
+	if !rule.HasTransition() {
+		// 规则已被取消
+		return file.CompleteTransition(file.StorageClass)
+	}
+
+	if policy.Type == "local" {
+		if err := moveToLocalArchive(file); err != nil {
+			return err
+		}
+	}
+
+	return file.CompleteTransition(rule.TransitionClass)
+}
+
+// moveToLocalArchive 将本地存储的文件移至 lifecycle_local_archive_path，并更新其物理路径。
+// 内容寻址或被其他文件引用的对象保持原位
+func moveToLocalArchive(file *model.File) error {
+	if isContentAddressPath(file.SourceName) {
+		return nil
+	}
+
+	if files, err := model.RemoveFilesWithSoftLinks([]model.File{*file}); err != nil {
+		return err
+	} else if len(files) == 0 {
+		return nil
+	}
+
+	archiveRoot := model.GetSettingByName("lifecycle_local_archive_path")
+	dst := filepath.ToSlash(filepath.Join(archiveRoot, filepath.FromSlash(file.SourceName)))
+	if err := moveLocalFile(util.RelativePath(filepath.FromSlash(file.SourceName)), util.RelativePath(filepath.FromSlash(dst))); err != nil {
+		return err
+	}
+
+	if err := file.UpdateSourceName(dst); err != nil {
+		// 记录更新失败时移回原处，避免文件记录指向不存在的路径
+		if rollbackErr := moveLocalFile(util.RelativePath(filepath.FromSlash(dst)), util.RelativePath(filepath.FromSlash(file.SourceName))); rollbackErr != nil {
+			util.Log().Warning("Failed to move file %q back from archive: %s", dst, rollbackErr)
+		}
+		return err
+	}
+
+	file.SourceName = dst
+	return nil
+}
+
+// moveLocalFile 移动本地文件，无法直接重命名（如跨设备）时复制后删除源文件
+func moveLocalFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0744); err != nil {
+		return err
+	}
+
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,158 @@
+package filesystem
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleTags(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Nil(lifecycleTags(nil))
+	asserts.Equal(map[string]string{
+		LifecycleTransitionDaysTag:  "30",
+		LifecycleTransitionClassTag: "GLACIER",
+		LifecycleExpireDaysTag:      "365",
+	}, lifecycleTags(&model.LifecycleRule{TransitionDays: 30, TransitionClass: "GLACIER", ExpireDays: 365}))
+	asserts.Equal(map[string]string{
+		LifecycleExpireDaysTag: "7",
+	}, lifecycleTags(&model.LifecycleRule{ExpireDays: 7}))
+}
+
+func TestFileSystem_ApplyUploadDefaults(t *testing.T) {
+	asserts := assert.New(t)
+	user := &model.User{}
+	user.OptionsSerialized.StorageClass = "STANDARD_IA"
+	user.OptionsSerialized.Lifecycle = &model.LifecycleRule{ExpireDays: 7}
+
+	// 存储策略不支持存储类型
+	{
+		fs := &FileSystem{User: user, Policy: &model.Policy{Type: "local"}}
+		file := &fsctx.FileStream{}
+		fs.applyUploadDefaults(file)
+		asserts.Empty(file.StorageClass)
+		asserts.Nil(file.Tags)
+	}
+
+	// 使用用户设定
+	{
+		fs := &FileSystem{User: user, Policy: &model.Policy{Type: "s3"}}
+		file := &fsctx.FileStream{}
+		fs.applyUploadDefaults(file)
+		asserts.Equal("STANDARD_IA", file.StorageClass)
+		asserts.Equal(map[string]string{LifecycleExpireDaysTag: "7"}, file.Tags)
+	}
+
+	// 上传时指定的存储类型优先
+	{
+		fs := &FileSystem{User: user, Policy: &model.Policy{Type: "oss"}}
+		file := &fsctx.FileStream{StorageClass: "Archive"}
+		fs.applyUploadDefaults(file)
+		asserts.Equal("Archive", file.StorageClass)
+	}
+}
+
+func TestFileSystem_TransitionFile(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("policy_91", model.Policy{Model: gorm.Model{ID: 91}, Type: "local"}, -1)
+	cache.Set("policy_92", model.Policy{Model: gorm.Model{ID: 92}, Type: "s3"}, -1)
+	cache.Set("setting_lifecycle_local_archive_path", "tests/lifecycle_archive", 0)
+	defer os.RemoveAll(util.RelativePath("tests/lifecycle_archive"))
+	user := &model.User{}
+	user.OptionsSerialized.Lifecycle = &model.LifecycleRule{TransitionDays: 1, TransitionClass: "cold"}
+	fs := &FileSystem{User: user}
+
+	// 本地存储，移至归档目录
+	{
+		src := "TestFileSystem_TransitionFile.txt"
+		asserts.NoError(ioutil.WriteFile(util.RelativePath(src), []byte("content"), 0644))
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: src, PolicyID: 91}
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)source_name(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)storage_class(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.transitionFile(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal("tests/lifecycle_archive/TestFileSystem_TransitionFile.txt", file.SourceName)
+		asserts.Equal("cold", file.StorageClass)
+		asserts.False(util.Exists(util.RelativePath(src)))
+		content, err := ioutil.ReadFile(util.RelativePath(file.SourceName))
+		asserts.NoError(err)
+		asserts.Equal("content", string(content))
+	}
+
+	// 本地存储，源文件不存在
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: "tests/not_exist.txt", PolicyID: 91}
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		asserts.Error(fs.transitionFile(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Empty(file.StorageClass)
+	}
+
+	// 对象存储，仅更新记录
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: "1.txt", PolicyID: 92}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)storage_class(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.transitionFile(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal("1.txt", file.SourceName)
+		asserts.Equal("cold", file.StorageClass)
+	}
+
+	// 规则已取消
+	{
+		fs := &FileSystem{User: &model.User{}}
+		at := time.Now()
+		file := &model.File{Model: gorm.Model{ID: 1}, SourceName: "1.txt", PolicyID: 92, StorageClass: "STANDARD", TransitionAt: &at}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)storage_class(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.transitionFile(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal("STANDARD", file.StorageClass)
+		asserts.Nil(file.TransitionAt)
+	}
+}
+
+func TestFileSystem_ExpireFile(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	now := time.Now()
+
+	// 保留期内推迟删除
+	retainUntil := now.Add(time.Hour)
+	file := &model.File{Model: gorm.Model{ID: 1}, RetainUntil: &retainUntil, ExpireAt: &now}
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)expire_at(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(fs.expireFile(context.Background(), file, now))
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal(retainUntil, *file.ExpireAt)
+}
+
+func TestApplyLifecycle(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 没有到期的文件
+	mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	res, err := ApplyLifecycle(context.Background(), 10)
+	asserts.NoError(err)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Equal(LifecycleResult{}, res)
+}
@@ -24,6 +24,9 @@ func (fs *FileSystem) Rename(ctx context.Context, dir, file []uint, new string)
 	if !fs.ValidateLegalName(ctx, new) || (len(file) > 0 && !fs.ValidateExtension(ctx, new)) {
 		return ErrIllegalObjectName
 	}
+	if err := ValidateReservedName(new); err != nil {
+		return err
+	}
 
 	// 如果源对象是文件
 	if len(file) > 0 {
@@ -32,6 +35,15 @@ func (fs *FileSystem) Rename(ctx context.Context, dir, file []uint, new string)
 			return ErrPathNotExist
 		}
 
+		// 检查所在目录允许存放的文件类型
+		parent, err := model.GetFoldersByIDs([]uint{fileObject[0].FolderID}, fs.User.ID)
+		if err != nil || len(parent) == 0 {
+			return ErrPathNotExist
+		}
+		if !IsFileTypeAllowedInFolder(&parent[0], new, "") {
+			return ErrFolderFileTypeNotAllowed
+		}
+
 		err = fileObject[0].Rename(new)
 		if err != nil {
 			return ErrFileExisted
@@ -66,6 +78,11 @@ func (fs *FileSystem) Copy(ctx context.Context, dirs, files []uint, src, dst str
 		return ErrPathNotExist
 	}
 
+	// 检查目标目录允许存放的文件类型
+	if err := fs.validateFolderFileTypes(dstFolder, dirs, files); err != nil {
+		return err
+	}
+
 	// 记录复制的文件的总容量
 	var newUsedStorage uint64
 
@@ -103,6 +120,11 @@ func (fs *FileSystem) Move(ctx context.Context, dirs, files []uint, src, dst str
 		return ErrPathNotExist
 	}
 
+	// 检查目标目录允许存放的文件类型
+	if err := fs.validateFolderFileTypes(dstFolder, dirs, files); err != nil {
+		return err
+	}
+
 	// 处理目录及子文件移动
 	err := srcFolder.MoveFolderTo(dirs, dstFolder)
 	if err != nil {
@@ -145,6 +167,20 @@ func (fs *FileSystem) Delete(ctx context.Context, dirs, files []uint, force bool
 		}
 	}
 
+	// 处于保留期内的文件不可删除
+	if err := fs.CheckRetention(ctx, fs.FileTarget, "delete"); err != nil {
+		return err
+	}
+
+	// 删除内容寻址的对象时，避免同时有新上传的文件引用此对象
+	for i := range fs.FileTarget {
+		if isContentAddressPath(fs.FileTarget[i].SourceName) {
+			contentAddressLock.Lock()
+			defer contentAddressLock.Unlock()
+			break
+		}
+	}
+
 	// 去除待删除文件中包含软连接的部分
 	filesToBeDelete, err := model.RemoveFilesWithSoftLinks(fs.FileTarget)
 	if err != nil {
@@ -188,13 +224,23 @@ func (fs *FileSystem) Delete(ctx context.Context, dirs, files []uint, force bool
 
 	model.DeleteShareBySourceIDs(deletedFileIDs, false)
 
+	// 已删除的文件不能再作为目录封面
+	refreshDeletedCovers(deletedFileIDs)
+
+	// 未完成的上传不再覆盖原文件，从回收站恢复
+	for _, file := range deletedFiles {
+		if file.UploadSessionID != nil {
+			fs.restoreUploadSessionTrash(*file.UploadSessionID)
+		}
+	}
+
 	// 如果文件全部删除成功，继续删除目录
 	if len(deletedFiles) == len(allFiles) {
 		var allFolderIDs = make([]uint, 0, len(fs.DirTarget))
 		for _, value := range fs.DirTarget {
 			allFolderIDs = append(allFolderIDs, value.ID)
 		}
-		err = model.DeleteFolderByIDs(allFolderIDs)
+		err = model.DeleteFolderByIDs(allFolderIDs, fs.User.ID)
 		if err != nil {
 			return ErrDBDeleteObjects.WithError(err)
 		}
@@ -322,6 +368,16 @@ func (fs *FileSystem) listObjects(ctx context.Context, parent string, files []mo
 	// 所有对象的父目录
 	var processedPath string
 
+	// 是否以图像拍摄时间作为显示日期，仅在存在图像文件时读取设置
+	var displayCaptureDate *bool
+	captureDateAsDisplay := func() bool {
+		if displayCaptureDate == nil {
+			enabled := model.IsTrueVal(model.GetSettingByNameWithDefault("image_capture_date_display", "0"))
+			displayCaptureDate = &enabled
+		}
+		return *displayCaptureDate
+	}
+
 	for _, subFolder := range folders {
 		// 路径处理钩子，
 		// 所有对象父目录都是一样的，所以只处理一次
@@ -345,6 +401,11 @@ func (fs *FileSystem) listObjects(ctx context.Context, parent string, files []mo
 		})
 	}
 
+	// 分享中的目录不提供封面
+	if shareKey == "" && fs.User != nil {
+		fs.setFolderCovers(folders, objects)
+	}
+
 	for _, file := range files {
 		if processedPath == "" {
 			if pathProcessor != nil {
@@ -354,6 +415,11 @@ func (fs *FileSystem) listObjects(ctx context.Context, parent string, files []mo
 			}
 		}
 
+		// 待审核的文件不出现在分享中
+		if shareKey != "" && file.IsPendingApproval() {
+			continue
+		}
+
 		if file.UploadSessionID == nil {
 			newFile := serializer.Object{
 				ID:            hashid.HashID(file.ID, hashid.FileID),
@@ -366,6 +432,18 @@ func (fs *FileSystem) listObjects(ctx context.Context, parent string, files []mo
 				SourceEnabled: file.GetPolicy().IsOriginLinkEnable,
 				MD5:           file.MD5,
 				CreateDate:    file.CreatedAt,
+				ThumbStatus:   file.ThumbStatus,
+				CaptureDate:   CaptureTimeOf(&file),
+				SourceBroken:  file.SourceBroken,
+				Protected:     file.IsPasswordProtected(),
+				StorageClass:  file.StorageClass,
+				TransitionAt:  file.TransitionAt,
+				ExpireAt:      file.ExpireAt,
+				PDFPreview:    file.DocPreviewSource != "",
+				Pending:       file.IsPendingApproval(),
+			}
+			if newFile.CaptureDate != nil && captureDateAsDisplay() {
+				newFile.Date = *newFile.CaptureDate
 			}
 			if shareKey != "" {
 				newFile.Key = shareKey
@@ -393,6 +471,15 @@ func (fs *FileSystem) CreateDirectory(ctx context.Context, fullPath string) (*mo
 
 	// 获取要创建目录的父路径和目录名
 	fullPath = path.Clean(fullPath)
+
+	// 超出深度限制时不再创建，已存在的目录仍可使用
+	if max := fs.MaxPathDepth(); max > 0 && strings.Count(fullPath, "/") > max {
+		if exist, folder := fs.IsPathExist(fullPath); exist {
+			return folder, nil
+		}
+		return nil, ErrPathTooDeep.WithData(map[string]int{"max": max})
+	}
+
 	base := path.Dir(fullPath)
 	dir := path.Base(fullPath)
 
@@ -403,6 +490,9 @@ func (fs *FileSystem) CreateDirectory(ctx context.Context, fullPath string) (*mo
 	if !fs.ValidateLegalName(ctx, dir) {
 		return nil, ErrIllegalObjectName
 	}
+	if err := ValidateReservedName(dir); err != nil {
+		return nil, err
+	}
 
 	// 父目录是否存在
 	isExist, parent := fs.IsPathExist(base)
@@ -419,6 +509,11 @@ func (fs *FileSystem) CreateDirectory(ctx context.Context, fullPath string) (*mo
 		return nil, ErrFileExisted
 	}
 
+	// 检查文件数配额
+	if err := fs.ValidateFileCount(0, 1); err != nil {
+		return nil, err
+	}
+
 	// 创建目录
 	newFolder := model.Folder{
 		Name:     dir,
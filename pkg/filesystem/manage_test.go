@@ -187,6 +187,51 @@ func TestFileSystem_List(t *testing.T) {
 	asserts.NoError(mock.ExpectationsWereMet())
 }
 
+func TestFileSystem_MaxPathDepth(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+	ctx := context.Background()
+	cache.Set("setting_max_path_depth", "2", 0)
+	defer cache.Deletes([]string{"max_path_depth"}, "setting_")
+
+	asserts.Equal(2, fs.MaxPathDepth())
+	fs.Policy = &model.Policy{}
+	fs.Policy.OptionsSerialized.MaxPathDepth = 1
+	asserts.Equal(1, fs.MaxPathDepth())
+	fs.Policy.OptionsSerialized.MaxPathDepth = 3
+	asserts.Equal(2, fs.MaxPathDepth())
+	fs.Policy = nil
+
+	// 超出深度且目录不存在
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs(1, 1, "a").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}))
+	_, err := fs.CreateDirectory(ctx, "/a/b/c")
+	asserts.Equal(ErrPathTooDeep.WithData(map[string]int{"max": 2}), err)
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 超出深度但目录已存在
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs(1, 1, "a").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(2, 1))
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs(2, 1, "b").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(3, 1))
+	mock.ExpectQuery("SELECT(.+)").
+		WithArgs(3, 1, "c").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(4, 1))
+	res, err := fs.CreateDirectory(ctx, "/a/b/c")
+	asserts.NoError(err)
+	asserts.EqualValues(4, res.ID)
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
 func TestFileSystem_CreateDirectory(t *testing.T) {
 	asserts := assert.New(t)
 	fs := &FileSystem{User: &model.User{
@@ -249,6 +294,7 @@ func TestFileSystem_CreateDirectory(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}))
 	mock.ExpectBegin()
 	mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 	_, err = fs.CreateDirectory(ctx, "/ad/ab")
 	asserts.NoError(err)
@@ -274,6 +320,7 @@ func TestFileSystem_CreateDirectory(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}))
 	mock.ExpectBegin()
 	mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 	mock.ExpectQuery("SELECT(.+)files").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
 	// 创建ab
@@ -282,6 +329,7 @@ func TestFileSystem_CreateDirectory(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}))
 	mock.ExpectBegin()
 	mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 	_, err = fs.CreateDirectory(ctx, "/ad/ab")
 	asserts.NoError(err)
@@ -486,6 +534,7 @@ func TestFileSystem_Delete(t *testing.T) {
 		mock.ExpectExec("DELETE(.+)").
 			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectExec("UPDATE(.+)users(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)").WithArgs(3, 0, model.FileTypeDocument).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		// 删除对应分享
 		mock.ExpectBegin()
@@ -496,6 +545,8 @@ func TestFileSystem_Delete(t *testing.T) {
 		mock.ExpectBegin()
 		mock.ExpectExec("DELETE(.+)").
 			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").
+			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		// 删除对应分享
 		mock.ExpectBegin()
@@ -544,6 +595,7 @@ func TestFileSystem_Delete(t *testing.T) {
 		mock.ExpectExec("DELETE(.+)").
 			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectExec("UPDATE(.+)users(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)type_usages(.+)").WithArgs(3, 0, model.FileTypeDocument).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		// 删除对应分享
 		mock.ExpectBegin()
@@ -554,6 +606,8 @@ func TestFileSystem_Delete(t *testing.T) {
 		mock.ExpectBegin()
 		mock.ExpectExec("DELETE(.+)").
 			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").
+			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		// 删除对应分享
 		mock.ExpectBegin()
@@ -682,6 +736,8 @@ func TestFileSystem_Rename(t *testing.T) {
 		mock.ExpectQuery("SELECT(.+)files(.+)").
 			WithArgs(10, 1).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(10, "old.text"))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 		mock.ExpectBegin()
 		mock.ExpectExec("UPDATE(.+)files(.+)SET(.+)").
 			WithArgs("new.txt", 10).
@@ -708,6 +764,8 @@ func TestFileSystem_Rename(t *testing.T) {
 		mock.ExpectQuery("SELECT(.+)files(.+)").
 			WithArgs(10, 1).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(10, "old.text"))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 		mock.ExpectBegin()
 		mock.ExpectExec("UPDATE(.+)files(.+)SET(.+)").
 			WithArgs("new.txt", 10).
@@ -719,6 +777,19 @@ func TestFileSystem_Rename(t *testing.T) {
 		asserts.Equal(ErrFileExisted, err)
 	}
 
+	// 重命名文件 所在目录不允许此类型
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").
+			WithArgs(10, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "folder_id"}).AddRow(10, "old.jpg", 2))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "allowed_types"}).AddRow(2, model.FolderTypeImages))
+		err := fs.Rename(ctx, []uint{}, []uint{10}, "old.exe")
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(ErrFolderFileTypeNotAllowed, err)
+	}
+
 	// 重命名目录 成功
 	{
 		mock.ExpectQuery("SELECT(.+)folders(.+)").
@@ -0,0 +1,169 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 校验清单导出
+   ================
+*/
+
+// 校验清单格式
+const (
+	ManifestFormatCSV   = "csv"
+	ManifestFormatJSONL = "jsonl"
+)
+
+// ManifestEntry 校验清单中的一项，Path 为相对于导出目录的路径，
+// MD5 为空表示无法读取文件内容
+type ManifestEntry struct {
+	Path string `json:"path"`
+	Size uint64 `json:"size"`
+	MD5  string `json:"md5"`
+}
+
+// manifestEncoder 将清单项逐条写出
+type manifestEncoder interface {
+	Encode(entry *ManifestEntry) error
+}
+
+type csvManifestEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvManifestEncoder) Encode(entry *ManifestEntry) error {
+	e.writer.Write([]string{entry.Path, strconv.FormatUint(entry.Size, 10), entry.MD5})
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type jsonlManifestEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *jsonlManifestEncoder) Encode(entry *ManifestEntry) error {
+	return e.encoder.Encode(entry)
+}
+
+// ExportManifest 遍历 dirPath 下的所有文件，以 format 格式将路径、大小与 MD5 逐条写入 writer。
+// 已记录 MD5 的文件不再读取内容，未记录的将回读计算并保存。ctx 取消时停止导出并返回 ErrClientCanceled
+func (fs *FileSystem) ExportManifest(ctx context.Context, writer io.Writer, dirPath, format string) error {
+	exist, folder := fs.IsPathExist(dirPath)
+	if !exist {
+		return ErrPathNotExist
+	}
+
+	var encoder manifestEncoder
+	switch format {
+	case ManifestFormatCSV:
+		csvWriter := csv.NewWriter(writer)
+		if err := csvWriter.Write([]string{"path", "size", "md5"}); err != nil {
+			return err
+		}
+		encoder = &csvManifestEncoder{writer: csvWriter}
+	case ManifestFormatJSONL:
+		encoder = &jsonlManifestEncoder{encoder: json.NewEncoder(writer)}
+	default:
+		return ErrUnknownManifestFormat
+	}
+
+	flusher, _ := writer.(http.Flusher)
+
+	// 导出目录本身不计入路径
+	root := *folder
+	root.Name = ""
+	root.Position = ""
+	return fs.exportFolderManifest(ctx, &root, encoder, flusher)
+}
+
+func (fs *FileSystem) exportFolderManifest(ctx context.Context, folder *model.Folder, encoder manifestEncoder, flusher http.Flusher) error {
+	files, err := folder.GetChildFiles()
+	if err != nil {
+		return ErrDBListObjects.WithError(err)
+	}
+
+	for i := range files {
+		select {
+		case <-ctx.Done():
+			return ErrClientCanceled
+		default:
+		}
+
+		// 跳过未完成上传的占位文件
+		if files[i].UploadSessionID != nil {
+			continue
+		}
+
+		entry := &ManifestEntry{
+			Path: path.Join(files[i].Position, files[i].Name),
+			Size: files[i].Size,
+			MD5:  fs.manifestFileHash(ctx, &files[i]),
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	subFolders, err := folder.GetChildFolder()
+	if err != nil {
+		return ErrDBListObjects.WithError(err)
+	}
+
+	for i := range subFolders {
+		if err := fs.exportFolderManifest(ctx, &subFolders[i], encoder, flusher); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// manifestFileHash 返回文件的 MD5，未记录时回读存储端计算并保存，失败时返回空值
+func (fs *FileSystem) manifestFileHash(ctx context.Context, file *model.File) string {
+	if file.MD5 != "" {
+		return file.MD5
+	}
+
+	fs.Policy = file.GetPolicy()
+	if err := fs.DispatchHandler(); err != nil {
+		util.Log().Warning("Failed to hash file %q: %s", file.Name, err)
+		return ""
+	}
+
+	rs, err := fs.OpenObject(WithInternalRead(context.WithValue(ctx, fsctx.FileModelCtx, *file)), file)
+	if err != nil {
+		util.Log().Warning("Failed to open %q: %s", file.Name, err)
+		return ""
+	}
+	defer rs.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, rs); err != nil {
+		util.Log().Warning("Failed to hash file %q: %s", file.Name, err)
+		return ""
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if err := file.UpdateMD5(digest); err != nil {
+		util.Log().Warning("Failed to save MD5 of file %q: %s", file.Name, err)
+	}
+
+	return digest
+}
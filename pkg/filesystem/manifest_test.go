@@ -0,0 +1,108 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestFileSystem_ExportManifest(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	// 存储策略须从数据库读取，不使用其他测试缓存的结果
+	cache.Deletes([]string{"1"}, "policy_")
+
+	// 目录不存在
+	{
+		fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+		mock.ExpectQuery("SELECT(.+)").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		err := fs.ExportManifest(ctx, &bytes.Buffer{}, "/", ManifestFormatCSV)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(ErrPathNotExist, err)
+	}
+
+	// 未知格式
+	{
+		fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+		mock.ExpectQuery("SELECT(.+)").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		err := fs.ExportManifest(ctx, &bytes.Buffer{}, "/", "xml")
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(ErrUnknownManifestFormat, err)
+	}
+
+	// 复用已记录的 MD5，未记录的回读计算并保存
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "2.txt").
+			Return(MockRSC{rs: strings.NewReader("12345")}, nil)
+		fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}, Handler: testHandler}
+		mock.ExpectQuery("SELECT(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "/"))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "size", "md5", "policy_id", "source_name"}).
+				AddRow(1, "1.txt", 5, "stored", 1, "1.txt"))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "sub"))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "size", "md5", "policy_id", "source_name"}).
+				AddRow(2, "2.txt", 5, "", 1, "2.txt"))
+		mock.ExpectQuery("SELECT(.+)policies(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "type"}).AddRow(1, "mock"))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs("827ccb0eea8a706c4c34a16891f84e7b", 1, sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		buffer := &bytes.Buffer{}
+		err := fs.ExportManifest(ctx, buffer, "/", ManifestFormatCSV)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal("path,size,md5\n1.txt,5,stored\nsub/2.txt,5,827ccb0eea8a706c4c34a16891f84e7b\n", buffer.String())
+		testHandler.AssertExpectations(t)
+	}
+
+	// JSONL 格式，读取失败时哈希为空
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.txt").Return(MockRSC{}, errors.New("error"))
+		fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}, Handler: testHandler}
+		mock.ExpectQuery("SELECT(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "/"))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "size", "policy_id", "source_name"}).
+				AddRow(1, "1.txt", 5, 1, "1.txt"))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		buffer := &bytes.Buffer{}
+		err := fs.ExportManifest(ctx, buffer, "/", ManifestFormatJSONL)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal("{\"path\":\"1.txt\",\"size\":5,\"md5\":\"\"}\n", buffer.String())
+	}
+
+	// 已取消
+	{
+		fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+		mock.ExpectQuery("SELECT(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "/"))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "1.txt"))
+		canceledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		err := fs.ExportManifest(canceledCtx, &bytes.Buffer{}, "/", ManifestFormatJSONL)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(ErrClientCanceled, err)
+	}
+}
@@ -0,0 +1,58 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+)
+
+/* ================
+	 上传元数据相关
+   ================
+*/
+
+// UploadMetadataHeader 客户端可通过此请求头以 JSON 对象声明上传文件的元数据，
+// 非 ASCII 字符需经 URL 编码
+const UploadMetadataHeader = "X-Cr-Metadata"
+
+// ParseUploadMetadata 解析请求头中声明的上传文件元数据，未声明时返回 nil
+func ParseUploadMetadata(r *http.Request) (map[string]string, error) {
+	raw := r.Header.Get(UploadMetadataHeader)
+	if raw == "" {
+		return nil, nil
+	}
+
+	decoded, err := url.PathUnescape(raw)
+	if err != nil {
+		return nil, serializer.NewError(serializer.CodeParamErr, "Invalid metadata header", err)
+	}
+
+	var metadata map[string]string
+	if err := json.Unmarshal([]byte(decoded), &metadata); err != nil {
+		return nil, serializer.NewError(serializer.CodeParamErr, "Invalid metadata header", err)
+	}
+
+	return metadata, nil
+}
+
+// ValidateRequiredMetadata 检查上传文件是否提供了目录要求的全部元数据，
+// 值为空视为未提供，失败时返回的错误附带缺失的元数据键
+func ValidateRequiredMetadata(folder *model.Folder, metadata map[string]string) error {
+	missing := make([]string, 0)
+	for _, key := range folder.RequiredMetadataKeys() {
+		if metadata[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		return ErrMetadataRequired.WithData(map[string]interface{}{
+			"missing": missing,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package filesystem
+
+import (
+	"net/http"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	a := assert.New(t)
+	r, _ := http.NewRequest("POST", "/", nil)
+
+	// 未声明
+	{
+		metadata, err := ParseUploadMetadata(r)
+		a.NoError(err)
+		a.Nil(metadata)
+	}
+
+	// 格式错误
+	{
+		r.Header.Set(UploadMetadataHeader, "{")
+		_, err := ParseUploadMetadata(r)
+		a.Error(err)
+	}
+
+	// 成功，含 URL 编码
+	{
+		r.Header.Set(UploadMetadataHeader, `{"author":"%E5%BC%A0%E4%B8%89","project":"a"}`)
+		metadata, err := ParseUploadMetadata(r)
+		a.NoError(err)
+		a.Equal(map[string]string{"author": "张三", "project": "a"}, metadata)
+	}
+}
+
+func TestValidateRequiredMetadata(t *testing.T) {
+	a := assert.New(t)
+
+	// 目录未要求
+	a.NoError(ValidateRequiredMetadata(&model.Folder{}, nil))
+
+	folder := &model.Folder{RequiredMetadata: "author,project,dept"}
+
+	// 缺失部分键
+	{
+		err := ValidateRequiredMetadata(folder, map[string]string{"author": "a", "project": ""})
+		a.Error(err)
+		appErr, ok := err.(serializer.AppError)
+		a.True(ok)
+		a.Equal(serializer.CodeMetadataRequired, appErr.Code)
+		a.Equal([]string{"project", "dept"}, appErr.Data.(map[string]interface{})["missing"])
+	}
+
+	// 成功
+	a.NoError(ValidateRequiredMetadata(folder, map[string]string{"author": "a", "project": "b", "dept": "c"}))
+}
@@ -0,0 +1,171 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// MIMETypeMetadataKey 文件元数据中记录上传时确定的 MIME 类型的键，下载时以此作为 Content-Type
+const MIMETypeMetadataKey = "mime_type"
+
+// 上传时确定文件 MIME 类型的方式，为空时沿用客户端提供的类型且不做记录
+const (
+	// MIMEModeTrust 使用客户端提供的 Content-Type，未提供时根据扩展名推断
+	MIMEModeTrust = "trust"
+	// MIMEModeExtension 根据扩展名推断，无法推断时使用客户端提供的 Content-Type
+	MIMEModeExtension = "extension"
+	// MIMEModeStrict 客户端提供的 Content-Type 须与扩展名推断的类型一致，否则拒绝上传
+	MIMEModeStrict = "strict"
+)
+
+// genericMIMETypes 客户端无法确定文件类型时使用的通用类型，严格模式下不视为与扩展名不一致
+var genericMIMETypes = []string{"application/octet-stream", "binary/octet-stream"}
+
+// sniffedMIMETypes 扩展名对应的、可由文件开头内容可靠识别的 MIME 类型，取值与 http.DetectContentType 的结果一致。
+// 纯文本、MP3 等无法从开头内容可靠识别的格式不在此列，不与扩展名比较
+var sniffedMIMETypes = map[string]string{
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".png":   "image/png",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".bmp":   "image/bmp",
+	".ico":   "image/x-icon",
+	".pdf":   "application/pdf",
+	".zip":   "application/zip",
+	".gz":    "application/x-gzip",
+	".tgz":   "application/x-gzip",
+	".rar":   "application/x-rar-compressed",
+	".wasm":  "application/wasm",
+	".ogg":   "application/ogg",
+	".wav":   "audio/wave",
+	".avi":   "video/avi",
+	".webm":  "video/webm",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+// mimeSniffLen 检测内容类型时读取的文件开头字节数
+const mimeSniffLen = 512
+
+// mediaType 返回去除参数并转为小写的 MIME 类型
+func mediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// ResolveMIMEType 按 mode 确定名为 name 的文件的 MIME 类型，declared 为客户端提供的 Content-Type。
+// 客户端未提供或提供通用类型时，任何方式下均不会拒绝上传
+func ResolveMIMEType(mode, name, declared string) (string, error) {
+	declared = strings.TrimSpace(declared)
+	if mode == "" {
+		return declared, nil
+	}
+
+	detected := mime.TypeByExtension(filepath.Ext(name))
+	switch mode {
+	case MIMEModeExtension:
+		if detected != "" {
+			return detected, nil
+		}
+		return declared, nil
+	case MIMEModeStrict:
+		if declared == "" || util.ContainsString(genericMIMETypes, mediaType(declared)) {
+			return detected, nil
+		}
+		if detected != "" && mediaType(declared) != mediaType(detected) {
+			return "", ErrMIMETypeMismatch.WithError(fmt.Errorf("declared %q, expected %q", declared, mediaType(detected)))
+		}
+		return declared, nil
+	default:
+		if declared != "" {
+			return declared, nil
+		}
+		return detected, nil
+	}
+}
+
+// matchMIMEType 返回 MIME 类型 t 是否与 patterns 中的任一项匹配，支持 image/* 形式的通配
+func matchMIMEType(t string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = mediaType(pattern)
+		if pattern == t || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(t, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HookValidateMIMEType 根据上传内容开头检测文件的实际类型，拒绝存储策略不允许的类型，
+// 开启 VerifyContentType 时还拒绝与扩展名不符的文件。空文件与追加上传的后续分片不检查
+func HookValidateMIMEType(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+	if fs.Policy == nil {
+		return nil
+	}
+
+	options := fs.Policy.OptionsSerialized
+	if len(options.AllowedMIMETypes) == 0 && len(options.DeniedMIMETypes) == 0 && !options.VerifyContentType {
+		return nil
+	}
+
+	fileInfo := file.Info()
+	if fileInfo.Mode&fsctx.Nop == fsctx.Nop || fileInfo.AppendStart > 0 {
+		return nil
+	}
+
+	sample, err := file.Peek(mimeSniffLen)
+	if err != nil {
+		return ErrIO.WithError(err)
+	}
+	if len(sample) == 0 {
+		return nil
+	}
+
+	detected := mediaType(http.DetectContentType(sample))
+	if matchMIMEType(detected, options.DeniedMIMETypes) ||
+		(len(options.AllowedMIMETypes) > 0 && !matchMIMEType(detected, options.AllowedMIMETypes)) {
+		return ErrMIMETypeNotAllowed.WithError(fmt.Errorf("detected %q", detected))
+	}
+
+	if options.VerifyContentType {
+		expected, ok := sniffedMIMETypes[strings.ToLower(filepath.Ext(fileInfo.FileName))]
+		if ok && detected != expected {
+			return ErrMIMETypeMismatch.WithError(fmt.Errorf("detected %q, expected %q", detected, expected))
+		}
+	}
+
+	return nil
+}
+
+// HookSaveMIMEType 将上传时确定的 MIME 类型记录在文件元数据中
+func HookSaveMIMEType(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+	mimeType := file.Info().MIMEType
+	if mimeType == "" {
+		return nil
+	}
+
+	// 覆盖已有文件时，上传信息中的元数据不会写入文件
+	if originFile, ok := ctx.Value(fsctx.FileModelCtx).(model.File); ok {
+		return updateMetadataValue(&originFile, MIMETypeMetadataKey, mimeType)
+	}
+
+	file.SetMetadata(MIMETypeMetadataKey, mimeType)
+	return nil
+}
+
+// SetContentTypeHeader 文件记录了上传时确定的 MIME 类型时，以此作为响应的 Content-Type
+func SetContentTypeHeader(header http.Header, file *model.File) {
+	if mimeType := file.MetadataSerialized[MIMETypeMetadataKey]; mimeType != "" {
+		header.Set("Content-Type", mimeType)
+	}
+}
@@ -0,0 +1,179 @@
+package filesystem
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveMIMEType(t *testing.T) {
+	asserts := assert.New(t)
+	testCases := []struct {
+		mode     string
+		name     string
+		declared string
+		expected string
+		err      bool
+	}{
+		// 未设定，原样使用
+		{"", "1.png", "text/html", "text/html", false},
+		{"", "1.png", "", "", false},
+		// 信任客户端
+		{MIMEModeTrust, "1.png", "image/jpeg", "image/jpeg", false},
+		{MIMEModeTrust, "1.png", "", "image/png", false},
+		// 根据扩展名推断
+		{MIMEModeExtension, "1.png", "image/jpeg", "image/png", false},
+		{MIMEModeExtension, "1.unknown", "image/jpeg", "image/jpeg", false},
+		// 严格模式
+		{MIMEModeStrict, "1.png", "image/jpeg", "", true},
+		{MIMEModeStrict, "1.png", "IMAGE/PNG", "IMAGE/PNG", false},
+		{MIMEModeStrict, "1.txt", "text/plain; charset=gbk", "text/plain; charset=gbk", false},
+		{MIMEModeStrict, "1.png", "", "image/png", false},
+		{MIMEModeStrict, "1.png", "application/octet-stream", "image/png", false},
+		{MIMEModeStrict, "1.unknown", "image/jpeg", "image/jpeg", false},
+	}
+
+	for i, testCase := range testCases {
+		res, err := ResolveMIMEType(testCase.mode, testCase.name, testCase.declared)
+		if testCase.err {
+			asserts.Error(err, "case #%d", i)
+			continue
+		}
+		asserts.NoError(err, "case #%d", i)
+		asserts.Equal(testCase.expected, res, "case #%d", i)
+	}
+}
+
+func TestHookSaveMIMEType(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+
+	// 未确定类型
+	{
+		file := &fsctx.FileStream{}
+		asserts.NoError(HookSaveMIMEType(context.Background(), fs, file))
+		asserts.Nil(file.Metadata)
+	}
+
+	// 新文件
+	{
+		file := &fsctx.FileStream{MIMEType: "image/png"}
+		asserts.NoError(HookSaveMIMEType(context.Background(), fs, file))
+		asserts.Equal("image/png", file.Metadata[MIMETypeMetadataKey])
+	}
+
+	// 覆盖已有文件
+	{
+		file := &fsctx.FileStream{MIMEType: "image/png"}
+		ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{
+			Model:              gorm.Model{ID: 1},
+			MetadataSerialized: map[string]string{"k": "v"},
+		})
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)metadata(.+)").
+			WithArgs(`{"k":"v","mime_type":"image/png"}`, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(HookSaveMIMEType(ctx, fs, file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Nil(file.Metadata)
+	}
+}
+
+func TestSetContentTypeHeader(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未记录
+	{
+		header := http.Header{}
+		SetContentTypeHeader(header, &model.File{})
+		asserts.Empty(header.Get("Content-Type"))
+	}
+
+	// 已记录
+	{
+		header := http.Header{}
+		SetContentTypeHeader(header, &model.File{MetadataSerialized: map[string]string{MIMETypeMetadataKey: "image/png"}})
+		asserts.Equal("image/png", header.Get("Content-Type"))
+	}
+}
+
+func TestMatchMIMEType(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(matchMIMEType("image/png", []string{"image/png"}))
+	asserts.True(matchMIMEType("image/png", []string{"text/plain", "Image/*"}))
+	asserts.False(matchMIMEType("image/png", []string{"image/jpeg", "text/*"}))
+	asserts.False(matchMIMEType("image/png", nil))
+}
+
+func TestHookValidateMIMEType(t *testing.T) {
+	asserts := assert.New(t)
+	png := "\x89PNG\x0D\x0A\x1A\x0A" + strings.Repeat("\x00", 100)
+	exe := "MZ\x90\x00" + strings.Repeat("\x00", 100)
+	stream := func(name, content string) *fsctx.FileStream {
+		return &fsctx.FileStream{Name: name, File: ioutil.NopCloser(strings.NewReader(content)), Size: uint64(len(content))}
+	}
+	newFs := func(option model.PolicyOption) *FileSystem {
+		return &FileSystem{User: &model.User{}, Policy: &model.Policy{OptionsSerialized: option}}
+	}
+
+	// 未设定
+	{
+		asserts.NoError(HookValidateMIMEType(context.Background(), newFs(model.PolicyOption{}), stream("photo.jpg", exe)))
+	}
+
+	// 内容与扩展名一致，内容可继续完整读取
+	{
+		file := stream("photo.png", png)
+		asserts.NoError(HookValidateMIMEType(context.Background(), newFs(model.PolicyOption{VerifyContentType: true}), file))
+		content, err := ioutil.ReadAll(file)
+		asserts.NoError(err)
+		asserts.Equal(png, string(content))
+	}
+
+	// 内容与扩展名不符
+	{
+		err := HookValidateMIMEType(context.Background(), newFs(model.PolicyOption{VerifyContentType: true}), stream("photo.JPG", exe))
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeMIMETypeMismatch, err.(serializer.AppError).Code)
+	}
+
+	// 无法从内容识别的扩展名不比较
+	{
+		asserts.NoError(HookValidateMIMEType(context.Background(), newFs(model.PolicyOption{VerifyContentType: true}), stream("song.mp3", exe)))
+	}
+
+	// 允许列表
+	{
+		fs := newFs(model.PolicyOption{AllowedMIMETypes: []string{"image/*"}})
+		asserts.NoError(HookValidateMIMEType(context.Background(), fs, stream("photo.png", png)))
+		err := HookValidateMIMEType(context.Background(), fs, stream("photo.png", exe))
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeMIMETypeNotAllowed, err.(serializer.AppError).Code)
+	}
+
+	// 禁止列表优先
+	{
+		fs := newFs(model.PolicyOption{AllowedMIMETypes: []string{"image/*"}, DeniedMIMETypes: []string{"image/png"}})
+		asserts.Error(HookValidateMIMEType(context.Background(), fs, stream("photo.png", png)))
+	}
+
+	// 空文件、占位文件、后续分片不检查
+	{
+		fs := newFs(model.PolicyOption{AllowedMIMETypes: []string{"image/*"}})
+		asserts.NoError(HookValidateMIMEType(context.Background(), fs, stream("empty.png", "")))
+		asserts.NoError(HookValidateMIMEType(context.Background(), fs, &fsctx.FileStream{Name: "photo.png", Mode: fsctx.Nop}))
+		file := stream("photo.png", exe)
+		file.AppendStart = 100
+		asserts.NoError(HookValidateMIMEType(context.Background(), fs, file))
+	}
+}
@@ -0,0 +1,106 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/gin-gonic/gin"
+)
+
+/* ================
+	 文件下载密码相关
+   ================
+*/
+
+const (
+	// FileUnlockHeader 携带文件解锁凭证的请求头
+	FileUnlockHeader = "X-Cr-File-Unlock"
+	// FileUnlockQuery 携带文件解锁凭证的查询参数，用于签名地址等无法附加请求头的场景
+	FileUnlockQuery = "unlock"
+
+	fileUnlockCachePrefix = "file_unlock_"
+)
+
+// ErrFileNotProtected 文件未设定下载密码
+var ErrFileNotProtected = serializer.NewError(serializer.CodeParamErr, "File is not password protected", nil)
+
+// WithFileUnlock 读取请求中携带的文件解锁凭证并加入上下文，之后通过此上下文读取设有下载密码的文件
+func WithFileUnlock(ctx context.Context, c *gin.Context) context.Context {
+	token := c.GetHeader(FileUnlockHeader)
+	if token == "" {
+		token = c.Query(FileUnlockQuery)
+	}
+
+	if token == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, fsctx.FileUnlockCtx, token)
+}
+
+// SetFilePassword 设定文件的下载密码，password 为空时取消密码。更改密码后此前签发的解锁凭证失效
+func (fs *FileSystem) SetFilePassword(ctx context.Context, id uint, password string) error {
+	if err := fs.resetFileIDIfNotExist(ctx, id); err != nil {
+		return err
+	}
+
+	if err := fs.FileTarget[0].SetPassword(password); err != nil {
+		return ErrDBUpdateObjects.WithError(err)
+	}
+
+	return nil
+}
+
+// UnlockFile 校验文件的下载密码，正确时签发解锁凭证。凭证在 file_unlock_ttl 秒内有效，
+// 此后读取文件时以凭证代替密码
+func (fs *FileSystem) UnlockFile(ctx context.Context, id uint, password string) (string, error) {
+	if err := fs.resetFileIDIfNotExist(ctx, id); err != nil {
+		return "", err
+	}
+
+	file := &fs.FileTarget[0]
+	if !file.IsPasswordProtected() {
+		return "", ErrFileNotProtected
+	}
+
+	if !file.CheckPassword(password) {
+		return "", ErrIncorrectFilePassword
+	}
+
+	token := util.RandStringRunes(32)
+	ttl := model.GetIntSetting("file_unlock_ttl", 3600)
+	if err := cache.Set(fileUnlockCachePrefix+token, fileUnlockKey(file), ttl); err != nil {
+		return "", serializer.NewError(serializer.CodeCacheOperation, "Failed to create unlock token", err)
+	}
+
+	return token, nil
+}
+
+// fileUnlockKey 解锁凭证对应的文件标识，包含密码摘要，使更改密码后旧凭证失效
+func fileUnlockKey(file *model.File) string {
+	return fmt.Sprintf("%d:%s", file.ID, file.Password)
+}
+
+// checkFileUnlocked 文件设有下载密码时，检查上下文中的解锁凭证是否仍然有效
+func checkFileUnlocked(ctx context.Context, file *model.File) error {
+	if !file.IsPasswordProtected() {
+		return nil
+	}
+
+	token, _ := ctx.Value(fsctx.FileUnlockCtx).(string)
+	if token == "" {
+		return ErrFileLocked
+	}
+
+	key, ok := cache.Get(fileUnlockCachePrefix + token)
+	if !ok || key != fileUnlockKey(file) {
+		return ErrFileLocked
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package filesystem
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFileUnlock(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未携带凭证
+	{
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		ctx := WithFileUnlock(context.Background(), c)
+		asserts.Nil(ctx.Value(fsctx.FileUnlockCtx))
+	}
+
+	// 请求头
+	{
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/?unlock=query", nil)
+		c.Request.Header.Set(FileUnlockHeader, "header")
+		ctx := WithFileUnlock(context.Background(), c)
+		asserts.Equal("header", ctx.Value(fsctx.FileUnlockCtx))
+	}
+
+	// 查询参数
+	{
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/?unlock=query", nil)
+		ctx := WithFileUnlock(context.Background(), c)
+		asserts.Equal("query", ctx.Value(fsctx.FileUnlockCtx))
+	}
+}
+
+func TestFileSystem_UnlockFile(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_file_unlock_ttl", "60", 0)
+	cache.Set("policy_91", model.Policy{Type: "mock"}, -1)
+	defer cache.Deletes([]string{"91"}, "policy_")
+
+	file := model.File{Model: gorm.Model{ID: 1}, Name: "1.txt", SourceName: "1.txt", PolicyID: 91}
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)password(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(file.SetPassword("secret"))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 未设定密码
+	{
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{{Model: gorm.Model{ID: 2}, PolicyID: 91}}}
+		_, err := fs.UnlockFile(context.Background(), 0, "secret")
+		asserts.Equal(ErrFileNotProtected, err)
+	}
+
+	// 密码错误
+	{
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{file}}
+		token, err := fs.UnlockFile(context.Background(), 0, "wrong")
+		asserts.Equal(ErrIncorrectFilePassword, err)
+		asserts.Empty(token)
+	}
+
+	// 解锁成功
+	{
+		fs := &FileSystem{User: &model.User{}, FileTarget: []model.File{file}}
+		token, err := fs.UnlockFile(context.Background(), 0, "secret")
+		asserts.NoError(err)
+		asserts.NotEmpty(token)
+
+		ctx := context.WithValue(context.Background(), fsctx.FileUnlockCtx, token)
+		asserts.NoError(checkFileUnlocked(ctx, &file))
+
+		// 其他文件不能使用此凭证
+		other := file
+		other.ID = 2
+		asserts.Equal(ErrFileLocked, checkFileUnlocked(ctx, &other))
+
+		// 更改密码后凭证失效
+		changed := file
+		changed.Password = "salt:changed"
+		asserts.Equal(ErrFileLocked, checkFileUnlocked(ctx, &changed))
+	}
+
+	// 未携带凭证或凭证无效
+	{
+		asserts.Equal(ErrFileLocked, checkFileUnlocked(context.Background(), &file))
+		ctx := context.WithValue(context.Background(), fsctx.FileUnlockCtx, "invalid")
+		asserts.Equal(ErrFileLocked, checkFileUnlocked(ctx, &file))
+	}
+
+	// 未设定密码的文件无需解锁
+	{
+		asserts.NoError(checkFileUnlocked(context.Background(), &model.File{}))
+	}
+}
+
+func TestFileSystem_GetContent_Locked(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_file_unlock_ttl", "60", 0)
+	cache.Set("policy_91", model.Policy{Type: "mock"}, -1)
+	defer cache.Deletes([]string{"91"}, "policy_")
+
+	handler := newMemoryDriver()
+	handler.objects["1.txt"] = []byte("content")
+	file := model.File{Model: gorm.Model{ID: 1}, Name: "1.txt", SourceName: "1.txt", PolicyID: 91}
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)password(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(file.SetPassword("secret"))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 未解锁时拒绝读取内容、签名地址和缩略图
+	{
+		fs := &FileSystem{User: &model.User{}, Handler: handler, FileTarget: []model.File{file}}
+		rs, err := fs.GetContent(context.Background(), 0)
+		asserts.Nil(rs)
+		asserts.Equal(serializer.CodeFileLocked, err.(serializer.AppError).Code)
+
+		_, err = fs.SignURL(context.Background(), &file, 60, true)
+		asserts.Equal(serializer.CodeFileLocked, err.(serializer.AppError).Code)
+
+		lockedPic := file
+		lockedPic.PicInfo = "1,1"
+		fs.FileTarget = []model.File{lockedPic}
+		_, err = fs.GetThumb(context.Background(), 0)
+		asserts.Equal(ErrFileLocked, err)
+	}
+
+	// 解锁后可多次读取
+	{
+		fs := &FileSystem{User: &model.User{}, Handler: handler, FileTarget: []model.File{file}}
+		token, err := fs.UnlockFile(context.Background(), 0, "secret")
+		asserts.NoError(err)
+		ctx := context.WithValue(context.Background(), fsctx.FileUnlockCtx, token)
+
+		for i := 0; i < 2; i++ {
+			rs, err := fs.GetContent(ctx, 0)
+			asserts.NoError(err)
+			content, _ := ioutil.ReadAll(rs)
+			asserts.Equal("content", string(content))
+			rs.Close()
+		}
+	}
+}
+
+func TestFileSystem_OpenObject_Locked(t *testing.T) {
+	asserts := assert.New(t)
+	handler := newMemoryDriver()
+	handler.objects["1.txt"] = []byte("content")
+	file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.txt", SourceName: "1.txt", Password: "digest"}
+	fs := &FileSystem{User: &model.User{}, Handler: handler}
+
+	// 未解锁时拒绝读取
+	{
+		rs, err := fs.OpenObject(context.Background(), file)
+		asserts.Nil(rs)
+		asserts.Equal(ErrFileLocked, err)
+	}
+
+	// 系统内部处理不受限制
+	{
+		rs, err := fs.OpenObject(WithInternalRead(context.Background()), file)
+		asserts.NoError(err)
+		content, _ := ioutil.ReadAll(rs)
+		asserts.Equal("content", string(content))
+		rs.Close()
+	}
+}
+
+func TestFileSystem_Compress_Locked(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("policy_91", model.Policy{Type: "mock"}, -1)
+	defer cache.Deletes([]string{"91"}, "policy_")
+
+	handler := newMemoryDriver()
+	handler.objects["1.txt"] = []byte("locked")
+	handler.objects["2.txt"] = []byte("open")
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}, Handler: handler}
+
+	mock.ExpectQuery("SELECT(.+)files(.+)").
+		WithArgs(1, 2, 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "source_name", "policy_id", "password"}).
+				AddRow(1, "1.txt", "1.txt", 91, "digest").
+				AddRow(2, "2.txt", "2.txt", 91, ""),
+		)
+
+	w := &bytes.Buffer{}
+	asserts.NoError(fs.Compress(context.Background(), w, nil, []uint{1, 2}, true))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 设有下载密码的文件不会被打包
+	reader, err := zip.NewReader(bytes.NewReader(w.Bytes()), int64(w.Len()))
+	asserts.NoError(err)
+	asserts.Len(reader.File, 1)
+	asserts.Equal("2.txt", reader.File[0].Name)
+}
@@ -2,6 +2,7 @@ package filesystem
 
 import (
 	"path"
+	"strings"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
@@ -73,3 +74,23 @@ func (fs *FileSystem) IsChildFileExist(folder *model.Folder, name string) (bool,
 	file, err := folder.GetChildFile(name)
 	return err == nil, file
 }
+
+// NormalizeVirtualPath 规范化虚拟路径：合并重复的斜杠、解析 . 与 .. 并去掉结尾的斜杠，
+// 使等价的路径对应同一目录。.. 越过根目录时返回 ErrPathEscapesRoot
+func NormalizeVirtualPath(virtualPath string) (string, error) {
+	segments := make([]string, 0, strings.Count(virtualPath, "/")+1)
+	for _, segment := range strings.Split(virtualPath, "/") {
+		switch segment {
+		case "", ".":
+		case "..":
+			if len(segments) == 0 {
+				return "", ErrPathEscapesRoot
+			}
+			segments = segments[:len(segments)-1]
+		default:
+			segments = append(segments, segment)
+		}
+	}
+
+	return "/" + strings.Join(segments, "/"), nil
+}
@@ -170,3 +170,28 @@ func TestFileSystem_IsChildFileExist(t *testing.T) {
 	asserts.True(exist)
 	asserts.Equal("/123", childFile.Position)
 }
+
+func TestNormalizeVirtualPath(t *testing.T) {
+	asserts := assert.New(t)
+	testCases := map[string]string{
+		"/":                "/",
+		"":                 "/",
+		"//a///b/":         "/a/b",
+		"/a/./b/.":         "/a/b",
+		"/a/b/../c":        "/a/c",
+		"a/b":              "/a/b",
+		"/a/../..b/":       "/..b",
+		"/a/b/c/../../../": "/",
+	}
+
+	for input, expected := range testCases {
+		res, err := NormalizeVirtualPath(input)
+		asserts.NoError(err, input)
+		asserts.Equal(expected, res, input)
+	}
+
+	for _, input := range []string{"/..", "/a/../../b", "../a"} {
+		_, err := NormalizeVirtualPath(input)
+		asserts.Equal(ErrPathEscapesRoot, err, input)
+	}
+}
@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/email"
+	"github.com/cloudreve/Cloudreve/v3/pkg/notify"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// QuarantineFile 隔离未通过校验的文件。文件对所有者不可见且不计入其已用容量，
+// 存储端的文件数据予以保留，供管理员检查后解除隔离或永久删除
+func (fs *FileSystem) QuarantineFile(ctx context.Context, file *model.File, reason string) error {
+	if err := file.Quarantine(reason); err != nil {
+		return ErrDBUpdateObjects.WithError(err)
+	}
+
+	util.Log().Warning("File %q (#%d) of user #%d is quarantined: %s", file.OriginalName(), file.ID, file.UserID, reason)
+
+	if model.IsTrueVal(model.GetSettingByName("quarantine_notify_admin")) {
+		notifyQuarantine(fs.User, file, reason)
+	}
+
+	return nil
+}
+
+// notifyQuarantine 通知有文件被隔离，默认发送给管理员
+func notifyQuarantine(owner *model.User, file *model.File, reason string) {
+	title, body := email.NewQuarantineEmail(owner.Email, file.OriginalName(), reason)
+	user := *owner
+	notify.Send(&notify.Notification{
+		Event: notify.EventQuarantine,
+		User:  &user,
+		Title: title,
+		Body:  body,
+		Data: map[string]interface{}{
+			"file_id": file.ID,
+			"name":    file.OriginalName(),
+			"reason":  reason,
+		},
+	})
+}
+
+// ReleaseQuarantinedFile 解除文件隔离，恢复至原目录，原目录已不存在时恢复至根目录
+func (fs *FileSystem) ReleaseQuarantinedFile(ctx context.Context, file *model.File) error {
+	var parent *model.Folder
+	if folders, err := model.GetFoldersByIDs([]uint{file.FolderID}, fs.User.ID); err == nil && len(folders) > 0 {
+		parent = &folders[0]
+	} else {
+		root, err := fs.User.Root()
+		if err != nil {
+			return ErrObjectNotExist.WithError(err)
+		}
+		parent = root
+	}
+
+	// 目标目录下已存在同名文件
+	if _, err := parent.GetChildFile(file.OriginalName()); err == nil {
+		return ErrFileExisted
+	}
+
+	if err := file.ReleaseQuarantine(parent.ID); err != nil {
+		return ErrDBUpdateObjects.WithError(err)
+	}
+
+	return nil
+}
+
+// DeleteQuarantinedFiles 永久删除已隔离的文件及其存储端数据
+func (fs *FileSystem) DeleteQuarantinedFiles(ctx context.Context, files []model.File) error {
+	// 删除内容寻址的对象时，避免同时有新上传的文件引用此对象
+	for i := range files {
+		if isContentAddressPath(files[i].SourceName) {
+			contentAddressLock.Lock()
+			defer contentAddressLock.Unlock()
+			break
+		}
+	}
+
+	// 去除仍被其他文件引用的部分
+	filesToBeDelete, err := model.RemoveFilesWithSoftLinks(files)
+	if err != nil {
+		return ErrDBListObjects.WithError(err)
+	}
+
+	failed := fs.deleteGroupedFile(ctx, fs.GroupFileByPolicy(ctx, filesToBeDelete))
+
+	deletedFiles := make([]*model.File, 0, len(files))
+	deletedFileIDs := make([]uint, 0, len(files))
+	for i := range files {
+		if !util.ContainsString(failed[files[i].PolicyID], files[i].SourceName) {
+			deletedFiles = append(deletedFiles, &files[i])
+			deletedFileIDs = append(deletedFileIDs, files[i].ID)
+		}
+	}
+
+	if err := model.DeleteQuarantinedFiles(deletedFiles); err != nil {
+		return ErrDBDeleteObjects.WithError(err)
+	}
+
+	model.DeleteShareBySourceIDs(deletedFileIDs, false)
+
+	if notDeleted := len(files) - len(deletedFiles); notDeleted > 0 {
+		return serializer.NewError(
+			serializer.CodeNotFullySuccess,
+			fmt.Sprintf("Failed to delete %d file(s).", notDeleted),
+			nil,
+		)
+	}
+
+	return nil
+}
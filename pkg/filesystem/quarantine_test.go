@@ -0,0 +1,91 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem_QuarantineFile(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_quarantine_notify_admin", "0", 0)
+
+	// 隔离成功
+	{
+		file := &model.File{Name: "1.bin", Size: 10, UserID: 1}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.QuarantineFile(context.Background(), file, "size mismatch"))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.True(file.IsQuarantined())
+	}
+
+	// 数据库更新失败
+	{
+		file := &model.File{Name: "1.bin", Size: 10, UserID: 1}
+		file.ID = 2
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		asserts.Error(fs.QuarantineFile(context.Background(), file, "size mismatch"))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.False(file.IsQuarantined())
+	}
+
+	cache.Deletes([]string{"quarantine_notify_admin"}, "setting_")
+}
+
+func TestFileSystem_ReleaseQuarantinedFile(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	fs.User.ID = 1
+	now := time.Now()
+
+	// 原目录下已存在同名文件
+	{
+		file := &model.File{Name: ".quarantine_2_1.bin", FolderID: 3, QuarantinedAt: &now}
+		file.ID = 2
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(3, "1.bin").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+		asserts.Equal(ErrFileExisted, fs.ReleaseQuarantinedFile(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 原目录不存在，恢复至根目录
+	{
+		file := &model.File{Name: ".quarantine_2_1.bin", Size: 10, UserID: 1, FolderID: 3, QuarantinedAt: &now}
+		file.ID = 2
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(1, "1.bin").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE(.+)storage(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.ReleaseQuarantinedFile(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.False(file.IsQuarantined())
+		asserts.Equal("1.bin", file.Name)
+		asserts.EqualValues(1, file.FolderID)
+	}
+
+	// 根目录不存在
+	{
+		file := &model.File{Name: ".quarantine_2_1.bin", FolderID: 3, QuarantinedAt: &now}
+		file.ID = 2
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnError(errors.New("error"))
+		asserts.Error(fs.ReleaseQuarantinedFile(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
@@ -0,0 +1,175 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 远程缩略图相关
+   ================
+*/
+
+// remoteThumbBackoff 同一次生成中两次请求之间的初始等待时间，之后每次翻倍
+var remoteThumbBackoff = time.Second
+
+// remoteThumbMaxDelay 排队重试的最长间隔
+const remoteThumbMaxDelay = 24 * time.Hour
+
+// remoteThumbRetryBatch 每次定时任务最多重试的文件数量
+const remoteThumbRetryBatch = 100
+
+// GenerateRemoteThumbnail 请求存储端为文件生成缩略图，失败时按 thumb_remote_attempts
+// 退避重试。存储端表示无法生成时标记为不支持，不再重试；存储端暂时无法访问时将文件放入
+// 重试队列，由定时任务按指数退避继续重试，排队重试次数达到 thumb_remote_max_retry
+// 后标记为失败。存储策略适配器不支持生成缩略图时不做处理
+func (fs *FileSystem) GenerateRemoteThumbnail(ctx context.Context, file *model.File) error {
+	generator, ok := fs.Handler.(driver.ThumbGenerator)
+	if !ok {
+		return nil
+	}
+
+	if !IsInExtensionList(HandledExtension, file.Name) {
+		setThumbStatus(file, model.ThumbStatusUnsupported, 0)
+		return nil
+	}
+
+	if fs.Policy != nil && !fs.Policy.IsThumbEnabledFor(file.Name) {
+		setThumbStatus(file, model.ThumbStatusDisabled, 0)
+		return nil
+	}
+
+	if !isThumbAvailable(file) {
+		return nil
+	}
+
+	attempts := model.GetIntSetting("thumb_remote_attempts", 3)
+	backoff := remoteThumbBackoff
+	var err error
+	for i := 0; i < attempts || i == 0; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				scheduleRemoteThumbRetry(file)
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		var picInfo string
+		picInfo, err = generator.GenerateThumb(ctx, file.SourceName)
+		if err == nil {
+			if file.Model.ID > 0 {
+				if err := file.UpdatePicInfo(picInfo); err != nil {
+					return ErrDBUpdateObjects.WithError(err)
+				}
+			}
+			file.PicInfo = picInfo
+			setThumbStatus(file, model.ThumbStatusOK, 0)
+			return nil
+		}
+
+		if errors.Is(err, driver.ErrThumbUnsupported) {
+			setThumbStatus(file, model.ThumbStatusUnsupported, 0)
+			return nil
+		}
+
+		util.Log().Debug("Failed to generate remote thumb for %q (attempt %d): %s", file.Name, i+1, err)
+	}
+
+	scheduleRemoteThumbRetry(file)
+	return err
+}
+
+// scheduleRemoteThumbRetry 记录一次远程缩略图生成失败，并按已失败次数计算下次重试时间。
+// 失败次数达到 thumb_remote_max_retry 后标记为失败状态，不再自动重试
+func scheduleRemoteThumbRetry(file *model.File) {
+	retries := file.ThumbRetries + 1
+	if maxRetry := model.GetIntSetting("thumb_remote_max_retry", 10); retries >= maxRetry {
+		setThumbStatus(file, model.ThumbStatusFailed, retries)
+		return
+	}
+
+	delay := time.Duration(model.GetIntSetting("thumb_remote_retry_interval", 60)) * time.Second
+	for i := 1; i < retries && delay < remoteThumbMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > remoteThumbMaxDelay {
+		delay = remoteThumbMaxDelay
+	}
+
+	at := time.Now().Add(delay)
+	if file.Model.ID == 0 {
+		file.ThumbRetries = retries
+		file.ThumbRetryAt = &at
+		return
+	}
+
+	if err := file.ScheduleThumbRetry(retries, at); err != nil {
+		util.Log().Warning("Failed to schedule thumb retry of file %q: %s", file.Name, err)
+	}
+}
+
+// RetryRemoteThumbnails 重试已到重试时间的远程缩略图生成，按存储策略分配适配器
+func (fs *FileSystem) RetryRemoteThumbnails(ctx context.Context) (ThumbBatchResult, error) {
+	var res ThumbBatchResult
+	files, err := model.GetThumbRetryCandidates(time.Now(), remoteThumbRetryBatch)
+	if err != nil {
+		return res, err
+	}
+
+	for i := range files {
+		fs.Policy = files[i].GetPolicy()
+		if err := fs.DispatchHandler(); err != nil {
+			util.Log().Warning("Failed to dispatch handler for policy %d: %s", fs.Policy.ID, err)
+			res.Failed++
+			continue
+		}
+
+		if _, ok := fs.Handler.(driver.ThumbGenerator); !ok {
+			res.Skipped++
+			continue
+		}
+
+		if err := fs.GenerateRemoteThumbnail(ctx, &files[i]); err != nil {
+			util.Log().Debug("Remote thumb of file #%d is still unavailable: %s", files[i].ID, err)
+		}
+
+		switch files[i].ThumbStatus {
+		case model.ThumbStatusOK:
+			res.Succeeded++
+		case model.ThumbStatusUnsupported, model.ThumbStatusDisabled:
+			res.Skipped++
+		default:
+			res.Failed++
+		}
+	}
+
+	return res, nil
+}
+
+// HookGenerateRemoteThumb 存储端在上传完成时未能生成缩略图的，在后台请求存储端重新生成
+func HookGenerateRemoteThumb(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || fileModel.PicInfo != "" || !IsInExtensionList(HandledExtension, fileModel.Name) {
+		return nil
+	}
+
+	if _, ok := fs.Handler.(driver.ThumbGenerator); !ok {
+		return nil
+	}
+
+	fs.runPostProcess(ctx, func() {
+		if err := fs.GenerateRemoteThumbnail(context.Background(), fileModel); err != nil {
+			util.Log().Warning("Remote thumb of %q is unavailable, will retry later: %s", fileModel.Name, err)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,204 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// thumbGeneratorDriver 可请求生成缩略图的内存存储适配器，依次返回 errs 中的错误
+type thumbGeneratorDriver struct {
+	*memoryDriver
+	errs  []error
+	calls int
+}
+
+func (d *thumbGeneratorDriver) GenerateThumb(ctx context.Context, path string) (string, error) {
+	d.calls++
+	if len(d.errs) > 0 {
+		err := d.errs[0]
+		d.errs = d.errs[1:]
+		return "", err
+	}
+	return "10,20", nil
+}
+
+func TestFileSystem_GenerateRemoteThumbnail(t *testing.T) {
+	asserts := assert.New(t)
+	remoteThumbBackoff = time.Millisecond
+	cache.Set("setting_thumb_remote_attempts", "3", 0)
+	cache.Set("setting_thumb_remote_retry_interval", "60", 0)
+	cache.Set("setting_thumb_remote_max_retry", "10", 0)
+	down := errors.New("slave unreachable")
+
+	// 适配器不支持
+	{
+		fs := &FileSystem{Handler: newMemoryDriver()}
+		file := &model.File{Name: "1.jpg"}
+		asserts.NoError(fs.GenerateRemoteThumbnail(context.Background(), file))
+		asserts.Equal(model.ThumbStatusPending, file.ThumbStatus)
+	}
+
+	// 不支持的格式，不请求存储端
+	{
+		handler := &thumbGeneratorDriver{memoryDriver: newMemoryDriver()}
+		fs := &FileSystem{Handler: handler}
+		file := &model.File{Name: "1.txt"}
+		asserts.NoError(fs.GenerateRemoteThumbnail(context.Background(), file))
+		asserts.Equal(model.ThumbStatusUnsupported, file.ThumbStatus)
+		asserts.Equal(0, handler.calls)
+	}
+
+	// 暂时失败后重试成功
+	{
+		handler := &thumbGeneratorDriver{memoryDriver: newMemoryDriver(), errs: []error{down}}
+		fs := &FileSystem{Handler: handler}
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.jpg", ThumbRetries: 2}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)pic_info(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_retries(.+)thumb_status(.+)").
+			WithArgs(0, model.ThumbStatusOK, 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.GenerateRemoteThumbnail(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(2, handler.calls)
+		asserts.Equal("10,20", file.PicInfo)
+		asserts.Equal(model.ThumbStatusOK, file.ThumbStatus)
+	}
+
+	// 存储端无法生成，不再重试
+	{
+		handler := &thumbGeneratorDriver{memoryDriver: newMemoryDriver(), errs: []error{driver.ErrThumbUnsupported}}
+		fs := &FileSystem{Handler: handler}
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.jpg"}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_retries(.+)thumb_status(.+)").
+			WithArgs(0, model.ThumbStatusUnsupported, 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.GenerateRemoteThumbnail(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(1, handler.calls)
+		asserts.Equal(model.ThumbStatusUnsupported, file.ThumbStatus)
+	}
+
+	// 存储端暂时无法访问，放入重试队列
+	{
+		handler := &thumbGeneratorDriver{memoryDriver: newMemoryDriver(), errs: []error{down, down, down}}
+		fs := &FileSystem{Handler: handler}
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.jpg", ThumbRetries: 2}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_retries(.+)thumb_retry_at(.+)thumb_status(.+)").
+			WithArgs(3, sqlmock.AnyArg(), model.ThumbStatusPending, 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.ErrorIs(fs.GenerateRemoteThumbnail(context.Background(), file), down)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(3, handler.calls)
+		asserts.Equal(model.ThumbStatusPending, file.ThumbStatus)
+		asserts.Equal(3, file.ThumbRetries)
+		// 第三次失败，等待 60s * 2^2
+		asserts.WithinDuration(time.Now().Add(4*time.Minute), *file.ThumbRetryAt, 10*time.Second)
+	}
+
+	// 达到重试上限，标记为失败
+	{
+		handler := &thumbGeneratorDriver{memoryDriver: newMemoryDriver(), errs: []error{down, down, down}}
+		fs := &FileSystem{Handler: handler}
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.jpg", ThumbRetries: 9}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_retries(.+)thumb_status(.+)").
+			WithArgs(10, model.ThumbStatusFailed, 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.Error(fs.GenerateRemoteThumbnail(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(model.ThumbStatusFailed, file.ThumbStatus)
+
+		// 已标记失败的不再请求
+		asserts.NoError(fs.GenerateRemoteThumbnail(context.Background(), file))
+		asserts.Equal(3, handler.calls)
+	}
+}
+
+func TestScheduleRemoteThumbRetry(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_thumb_remote_retry_interval", "3600", 0)
+	cache.Set("setting_thumb_remote_max_retry", "100", 0)
+	defer cache.Set("setting_thumb_remote_retry_interval", "60", 0)
+	defer cache.Set("setting_thumb_remote_max_retry", "10", 0)
+
+	// 重试间隔不超过上限
+	file := &model.File{Name: "1.jpg", ThumbRetries: 50}
+	scheduleRemoteThumbRetry(file)
+	asserts.Equal(51, file.ThumbRetries)
+	asserts.WithinDuration(time.Now().Add(remoteThumbMaxDelay), *file.ThumbRetryAt, 10*time.Second)
+}
+
+func TestHookGenerateRemoteThumb(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_thumb_remote_attempts", "1", 0)
+	defer cache.Set("setting_thumb_remote_attempts", "3", 0)
+	handler := &thumbGeneratorDriver{memoryDriver: newMemoryDriver()}
+	fs := &FileSystem{User: &model.User{}, Handler: handler}
+
+	// 存储端已生成缩略图
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.jpg", PicInfo: "1,1"}
+		asserts.NoError(HookGenerateRemoteThumb(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.Equal(0, handler.calls)
+	}
+
+	// 适配器不支持
+	{
+		fs := &FileSystem{User: &model.User{}, Handler: newMemoryDriver()}
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.jpg"}
+		asserts.NoError(HookGenerateRemoteThumb(context.Background(), fs, &fsctx.FileStream{Model: file}))
+	}
+
+	// 后台重新生成
+	{
+		file := &model.File{Name: "1.jpg"}
+		waiter := &PostProcessWaiter{}
+		ctx := context.WithValue(context.Background(), fsctx.PostProcessWaiterCtx, waiter)
+		asserts.NoError(HookGenerateRemoteThumb(ctx, fs, &fsctx.FileStream{Model: file}))
+		asserts.True(waiter.Wait(time.Second))
+		asserts.Equal(1, handler.calls)
+		asserts.Equal("10,20", file.PicInfo)
+		asserts.Equal(model.ThumbStatusOK, file.ThumbStatus)
+	}
+}
+
+func TestFileSystem_RetryRemoteThumbnails(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+
+	// 查询失败
+	{
+		mock.ExpectQuery("SELECT(.+)thumb_retry_at(.+)").WillReturnError(errors.New("error"))
+		_, err := fs.RetryRemoteThumbnails(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+	}
+
+	// 没有待重试的文件
+	{
+		mock.ExpectQuery("SELECT(.+)thumb_retry_at(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		res, err := fs.RetryRemoteThumbnails(context.Background())
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.Equal(ThumbBatchResult{}, res)
+	}
+}
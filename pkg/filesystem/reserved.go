@@ -0,0 +1,93 @@
+package filesystem
+
+import (
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+)
+
+// Windows 保留设备名（CON、NUL、COM1 等）的处理方式
+const (
+	// ReservedNameReject 拒绝以保留设备名命名的文件和目录
+	ReservedNameReject = "reject"
+	// ReservedNameRename 允许保留设备名，WebDAV 中以 reserved_name_prefix 为前缀呈现，
+	// 客户端以带前缀的名称访问和上传时还原为原名称
+	ReservedNameRename = "rename"
+	// ReservedNameAllow 不做处理
+	ReservedNameAllow = "allow"
+)
+
+// ReservedNameStrategy 返回 reserved_name_strategy 设定的保留设备名处理方式，设定无效时拒绝
+func ReservedNameStrategy() string {
+	switch strategy := model.GetSettingByNameWithDefault("reserved_name_strategy", ReservedNameReject); strategy {
+	case ReservedNameRename, ReservedNameAllow:
+		return strategy
+	}
+
+	return ReservedNameReject
+}
+
+// IsReservedName 返回 name 是否为 reserved_names 设定的保留设备名。与 Windows 一致，
+// 忽略大小写、扩展名及主文件名结尾的空格，如 con.txt、Nul .tar.gz
+func IsReservedName(name string) bool {
+	stem := name
+	if i := strings.Index(stem, "."); i >= 0 {
+		stem = stem[:i]
+	}
+	stem = strings.TrimRight(stem, " ")
+	if stem == "" {
+		return false
+	}
+
+	for _, reserved := range strings.Split(model.GetSettingByName("reserved_names"), ",") {
+		if strings.EqualFold(strings.TrimSpace(reserved), stem) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateReservedName 按设定拒绝以保留设备名命名的对象
+func ValidateReservedName(name string) error {
+	if ReservedNameStrategy() == ReservedNameReject && IsReservedName(name) {
+		return ErrReservedObjectName.WithData(name)
+	}
+
+	return nil
+}
+
+// reservedNamePrefix 返回重命名保留设备名时添加的前缀
+func reservedNamePrefix() string {
+	return model.GetSettingByNameWithDefault("reserved_name_prefix", "_")
+}
+
+// trimReservedNamePrefix 去除 name 开头的所有 prefix
+func trimReservedNamePrefix(name, prefix string) string {
+	for prefix != "" && strings.HasPrefix(name, prefix) {
+		name = name[len(prefix):]
+	}
+	return name
+}
+
+// EscapeReservedName 为保留设备名添加前缀。已带有前缀的名称去除前缀后为保留设备名时
+// 同样再添加一层前缀，使 UnescapeReservedName 能够无歧义地还原，如 CON 与 _CON
+// 分别转换为 _CON 与 __CON
+func EscapeReservedName(name string) string {
+	prefix := reservedNamePrefix()
+	if prefix == "" || !IsReservedName(trimReservedNamePrefix(name, prefix)) {
+		return name
+	}
+
+	return prefix + name
+}
+
+// UnescapeReservedName 还原 EscapeReservedName 转换后的名称
+func UnescapeReservedName(name string) string {
+	prefix := reservedNamePrefix()
+	if prefix == "" || !strings.HasPrefix(name, prefix) || !IsReservedName(trimReservedNamePrefix(name, prefix)) {
+		return name
+	}
+
+	return name[len(prefix):]
+}
@@ -0,0 +1,66 @@
+package filesystem
+
+import (
+	"testing"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsReservedName(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_reserved_names", "CON,NUL, COM1", 0)
+	defer cache.Deletes([]string{"reserved_names"}, "setting_")
+
+	asserts.True(IsReservedName("CON"))
+	asserts.True(IsReservedName("con.txt"))
+	asserts.True(IsReservedName("Nul .tar.gz"))
+	asserts.True(IsReservedName("com1"))
+	asserts.False(IsReservedName("CONSOLE"))
+	asserts.False(IsReservedName("_CON"))
+	asserts.False(IsReservedName(".CON"))
+	asserts.False(IsReservedName("a.CON"))
+}
+
+func TestValidateReservedName(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_reserved_names", "CON,NUL", 0)
+	defer cache.Deletes([]string{"reserved_names", "reserved_name_strategy"}, "setting_")
+
+	// 默认拒绝
+	err := ValidateReservedName("con.txt")
+	asserts.Error(err)
+	asserts.Equal(serializer.CodeReservedObjectName, err.(serializer.AppError).Code)
+	asserts.NoError(ValidateReservedName("1.txt"))
+
+	cache.Set("setting_reserved_name_strategy", ReservedNameRename, 0)
+	asserts.NoError(ValidateReservedName("con.txt"))
+
+	cache.Set("setting_reserved_name_strategy", ReservedNameAllow, 0)
+	asserts.NoError(ValidateReservedName("con.txt"))
+
+	// 无效设定
+	cache.Set("setting_reserved_name_strategy", "unknown", 0)
+	asserts.Error(ValidateReservedName("con.txt"))
+}
+
+func TestEscapeReservedName(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_reserved_names", "CON,NUL", 0)
+	cache.Set("setting_reserved_name_prefix", "_", 0)
+	defer cache.Deletes([]string{"reserved_names", "reserved_name_prefix"}, "setting_")
+
+	testCases := map[string]string{
+		"CON":     "_CON",
+		"nul.txt": "_nul.txt",
+		"_CON":    "__CON",
+		"__CON":   "___CON",
+		"_1.txt":  "_1.txt",
+		"1.txt":   "1.txt",
+	}
+	for name, escaped := range testCases {
+		asserts.Equal(escaped, EscapeReservedName(name), name)
+		asserts.Equal(name, UnescapeReservedName(escaped), escaped)
+	}
+}
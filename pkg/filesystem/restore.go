@@ -0,0 +1,80 @@
+package filesystem
+
+import (
+	"context"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// archivedRestorer 文件为需解冻后才能读取的归档类型时，返回当前适配器的 Restorer
+func (fs *FileSystem) archivedRestorer(file *model.File) (driver.Restorer, bool) {
+	restorer, ok := fs.Handler.(driver.Restorer)
+	if !ok || file.StorageClass == "" || !restorer.NeedsRestore(file.StorageClass) {
+		return nil, false
+	}
+	return restorer, true
+}
+
+// checkRestored 读取文件内容前检查归档文件的解冻状态，并同步到文件记录。
+// 未解冻时返回 ErrNeedsRestore，解冻中返回 ErrRestoreInProgress
+func (fs *FileSystem) checkRestored(ctx context.Context, file *model.File) error {
+	restorer, ok := fs.archivedRestorer(file)
+	if !ok {
+		return nil
+	}
+
+	state, err := restorer.RestoreState(ctx, file.SourceName)
+	if err != nil {
+		return ErrIO.WithError(err)
+	}
+
+	status := model.RestoreStatusNone
+	switch state {
+	case driver.RestoreStateRestoring:
+		status = model.RestoreStatusRestoring
+	case driver.RestoreStateRestored:
+		status = model.RestoreStatusRestored
+	}
+
+	if status != file.RestoreStatus {
+		if err := file.UpdateRestoreStatus(status); err != nil {
+			util.Log().Warning("Failed to update restore status of file #%d: %s", file.ID, err)
+		}
+	}
+
+	switch state {
+	case driver.RestoreStateArchived:
+		return ErrNeedsRestore
+	case driver.RestoreStateRestoring:
+		return ErrRestoreInProgress
+	}
+
+	return nil
+}
+
+// RestoreArchivedFile 对归档文件发起解冻，解冻完成后可在设定天数内读取
+func (fs *FileSystem) RestoreArchivedFile(ctx context.Context, id uint) error {
+	if err := fs.resetFileIDIfNotExist(ctx, id); err != nil {
+		return err
+	}
+
+	file := &fs.FileTarget[0]
+	restorer, ok := fs.archivedRestorer(file)
+	if !ok {
+		return ErrRestoreNotNeeded
+	}
+
+	days := model.GetIntSetting("archive_restore_days", 1)
+	if err := restorer.Restore(ctx, file.SourceName, days); err != nil {
+		return serializer.NewError(serializer.CodeIOFailed, "Failed to restore file", err)
+	}
+
+	if err := file.UpdateRestoreStatus(model.RestoreStatusRestoring); err != nil {
+		return ErrDBUpdateObjects.WithError(err)
+	}
+
+	return nil
+}
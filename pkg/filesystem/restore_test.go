@@ -0,0 +1,109 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// restorerDriver 支持归档存储类型的内存存储适配器
+type restorerDriver struct {
+	*memoryDriver
+	state driver.RestoreState
+	err   error
+}
+
+func (d *restorerDriver) NeedsRestore(class string) bool {
+	return class == "GLACIER"
+}
+
+func (d *restorerDriver) RestoreState(ctx context.Context, path string) (driver.RestoreState, error) {
+	return d.state, d.err
+}
+
+func (d *restorerDriver) Restore(ctx context.Context, path string, days int) error {
+	return d.err
+}
+
+func TestFileSystem_CheckRestored(t *testing.T) {
+	asserts := assert.New(t)
+	handler := &restorerDriver{memoryDriver: newMemoryDriver()}
+	fs := &FileSystem{User: &model.User{}, Handler: handler}
+
+	// 非归档类型
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, StorageClass: "STANDARD"}
+		asserts.NoError(fs.checkRestored(context.Background(), file))
+	}
+
+	// 不支持归档的适配器
+	{
+		fs := &FileSystem{User: &model.User{}, Handler: newMemoryDriver()}
+		file := &model.File{Model: gorm.Model{ID: 1}, StorageClass: "GLACIER"}
+		asserts.NoError(fs.checkRestored(context.Background(), file))
+	}
+
+	// 未解冻
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, StorageClass: "GLACIER"}
+		asserts.Equal(ErrNeedsRestore, fs.checkRestored(context.Background(), file))
+	}
+
+	// 解冻中，同步状态
+	{
+		handler.state = driver.RestoreStateRestoring
+		file := &model.File{Model: gorm.Model{ID: 1}, StorageClass: "GLACIER"}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs(model.RestoreStatusRestoring, 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.Equal(ErrRestoreInProgress, fs.checkRestored(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(model.RestoreStatusRestoring, file.RestoreStatus)
+	}
+
+	// 已解冻，状态未变化时不更新记录
+	{
+		handler.state = driver.RestoreStateRestored
+		file := &model.File{Model: gorm.Model{ID: 1}, StorageClass: "GLACIER", RestoreStatus: model.RestoreStatusRestored}
+		asserts.NoError(fs.checkRestored(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 查询失败
+	{
+		handler.err = errors.New("error")
+		file := &model.File{Model: gorm.Model{ID: 1}, StorageClass: "GLACIER"}
+		err := fs.checkRestored(context.Background(), file)
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeIOFailed, err.(serializer.AppError).Code)
+	}
+}
+
+func TestFileSystem_RestoreArchivedFile(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+
+	// 文件不存在
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		asserts.Equal(ErrObjectNotExist, fs.RestoreArchivedFile(context.Background(), 1))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 存储策略不支持归档
+	{
+		fs.FileTarget = []model.File{{
+			Model:        gorm.Model{ID: 1},
+			StorageClass: "GLACIER",
+			Policy:       model.Policy{Model: gorm.Model{ID: 1}, Type: "local"},
+		}}
+		asserts.Equal(ErrRestoreNotNeeded, fs.RestoreArchivedFile(context.Background(), 1))
+	}
+}
@@ -0,0 +1,83 @@
+package filesystem
+
+import (
+	"context"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 文件保留期相关
+   ================
+*/
+
+// retentionDeadline 返回上传至 parent 的文件的保留期截止时间，存储策略与目录均设定时
+// 取较长者，均未设定时返回 nil
+func (fs *FileSystem) retentionDeadline(parent *model.Folder) *time.Time {
+	days := 0
+	if fs.Policy != nil {
+		days = fs.Policy.OptionsSerialized.RetentionDays
+	}
+	if parent != nil && parent.RetentionDays > days {
+		days = parent.RetentionDays
+	}
+
+	if days <= 0 {
+		return nil
+	}
+
+	deadline := time.Now().AddDate(0, 0, days)
+	return &deadline
+}
+
+// retentionBypassedBy 返回本次操作中有权忽略保留期的操作者，没有时返回 nil。
+// 操作者优先取上下文中指定的用户，其次为文件系统所属用户
+func (fs *FileSystem) retentionBypassedBy(ctx context.Context) *model.User {
+	if operator, ok := ctx.Value(fsctx.RetentionBypassCtx).(*model.User); ok &&
+		operator.Group.OptionsSerialized.RetentionBypass {
+		return operator
+	}
+
+	if fs.User != nil && fs.User.Group.OptionsSerialized.RetentionBypass {
+		return fs.User
+	}
+
+	return nil
+}
+
+// CheckRetention 检查 files 中是否有处于保留期内的文件，有则拒绝 action 操作。
+// 操作者有权忽略保留期时放行并记录审计日志，未完成上传的占位文件不受限制
+func (fs *FileSystem) CheckRetention(ctx context.Context, files []model.File, action string) error {
+	now := time.Now()
+	for i := range files {
+		if files[i].UploadSessionID != nil || !files[i].IsRetained(now) {
+			continue
+		}
+
+		if operator := fs.retentionBypassedBy(ctx); operator != nil {
+			util.Log().Info("[Audit] User %q bypassed retention to %s file %q (#%d) of user #%d, retained until %s.",
+				operator.Email, action, files[i].Name, files[i].ID, files[i].UserID, files[i].RetainUntil.Format(time.RFC3339))
+			continue
+		}
+
+		return ErrFileRetained.WithData(map[string]interface{}{
+			"name":         files[i].Name,
+			"retain_until": files[i].RetainUntil,
+		})
+	}
+
+	return nil
+}
+
+// HookValidateRetention 拒绝修改处于保留期内的文件
+func HookValidateRetention(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+	originFile, ok := ctx.Value(fsctx.FileModelCtx).(model.File)
+	if !ok {
+		return nil
+	}
+
+	return fs.CheckRetention(ctx, []model.File{originFile}, "overwrite")
+}
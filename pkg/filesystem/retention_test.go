@@ -0,0 +1,84 @@
+package filesystem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem_RetentionDeadline(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{Policy: &model.Policy{}}
+
+	// 均未设定
+	asserts.Nil(fs.retentionDeadline(&model.Folder{}))
+
+	// 取较长者
+	fs.Policy.OptionsSerialized.RetentionDays = 7
+	deadline := fs.retentionDeadline(&model.Folder{RetentionDays: 30})
+	asserts.NotNil(deadline)
+	asserts.WithinDuration(time.Now().AddDate(0, 0, 30), *deadline, time.Minute)
+
+	deadline = fs.retentionDeadline(&model.Folder{RetentionDays: 1})
+	asserts.NotNil(deadline)
+	asserts.WithinDuration(time.Now().AddDate(0, 0, 7), *deadline, time.Minute)
+}
+
+func TestFileSystem_CheckRetention(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	sessionID := "session"
+
+	// 保留期已过或未设定
+	asserts.NoError(fs.CheckRetention(context.Background(), []model.File{{}, {RetainUntil: &past}}, "delete"))
+
+	// 占位文件不受限制
+	asserts.NoError(fs.CheckRetention(context.Background(), []model.File{{RetainUntil: &future, UploadSessionID: &sessionID}}, "delete"))
+
+	// 处于保留期内
+	err := fs.CheckRetention(context.Background(), []model.File{{}, {Name: "1.txt", RetainUntil: &future}}, "delete")
+	asserts.Error(err)
+	asserts.Equal(serializer.CodeFileRetained, err.(serializer.AppError).Code)
+
+	// 上下文中的操作者有权忽略
+	admin := &model.User{Email: "admin@cloudreve.org"}
+	ctx := context.WithValue(context.Background(), fsctx.RetentionBypassCtx, admin)
+	asserts.Error(fs.CheckRetention(ctx, []model.File{{RetainUntil: &future}}, "delete"))
+	admin.Group.OptionsSerialized.RetentionBypass = true
+	asserts.NoError(fs.CheckRetention(ctx, []model.File{{RetainUntil: &future}}, "delete"))
+
+	// 文件系统所属用户有权忽略
+	fs.User.Group.OptionsSerialized.RetentionBypass = true
+	asserts.NoError(fs.CheckRetention(context.Background(), []model.File{{RetainUntil: &future}}, "delete"))
+}
+
+func TestHookValidateRetention(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	future := time.Now().Add(time.Hour)
+
+	// 非更新操作
+	asserts.NoError(HookValidateRetention(context.Background(), fs, &fsctx.FileStream{}))
+
+	// 处于保留期内
+	ctx := context.WithValue(context.Background(), fsctx.FileModelCtx, model.File{RetainUntil: &future})
+	asserts.Error(HookValidateRetention(ctx, fs, &fsctx.FileStream{}))
+}
+
+func TestFileSystem_Delete_Retained(t *testing.T) {
+	asserts := assert.New(t)
+	future := time.Now().Add(time.Hour)
+	fs := &FileSystem{User: &model.User{}}
+	fs.FileTarget = []model.File{{RetainUntil: &future}}
+
+	err := fs.Delete(context.Background(), []uint{}, []uint{}, true)
+	asserts.Error(err)
+	asserts.Equal(serializer.CodeFileRetained, err.(serializer.AppError).Code)
+}
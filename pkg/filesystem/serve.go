@@ -0,0 +1,302 @@
+package filesystem
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 下载输出相关
+   ================
+*/
+
+// incompressibleTypes 本身已压缩的 MIME 类型前缀，即使出现在设置中也不会再次压缩
+var incompressibleTypes = []string{
+	"image/jpeg", "image/png", "image/gif", "image/webp",
+	"video/", "audio/",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-7z-compressed",
+	"application/x-rar-compressed", "application/vnd.rar", "application/x-bzip2", "application/x-xz",
+}
+
+// ServeContent 向客户端输出文件内容。文件类型可压缩、尺寸超过阈值且客户端
+// 支持时使用 gzip/deflate 流式压缩输出，否则交由 http.ServeContent 处理
+func ServeContent(w http.ResponseWriter, r *http.Request, name string, modTime time.Time, size uint64, content io.ReadSeeker) {
+	encoding := negotiateEncoding(r, name, size)
+	if encoding == "" {
+		http.ServeContent(NewBufferedResponseWriter(w), r, name, modTime, content)
+		return
+	}
+
+	if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modTime.Truncate(time.Second).After(ims) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", mime.TypeByExtension(filepath.Ext(name)))
+	}
+	header.Set("Content-Encoding", encoding)
+	header.Add("Vary", "Accept-Encoding")
+	header.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	// 压缩后的长度未知，使用分块传输
+	header.Del("Content-Length")
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+strings.TrimSuffix(etag, `"`)+"-"+encoding+`"`)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	var compressor io.WriteCloser
+	if encoding == "gzip" {
+		compressor = gzip.NewWriter(w)
+	} else {
+		// deflate 编码为 zlib 格式封装的数据，而非原始 DEFLATE 流
+		compressor = zlib.NewWriter(w)
+	}
+
+	if _, err := copyBuffered(compressor, content); err != nil {
+		util.Log().Debug("Failed to write compressed content: %s", err)
+	}
+	compressor.Close()
+}
+
+// bufferPool 容量有限的缓冲区池，至多分配 max 个缓冲区，用尽时 Get 返回 nil，
+// 避免大量并发下载各自占用大缓冲区
+type bufferPool struct {
+	size      int
+	max       int
+	free      chan []byte
+	mu        sync.Mutex
+	allocated int
+}
+
+func newBufferPool(size, max int) *bufferPool {
+	if size <= 0 || max < 0 {
+		max = 0
+	}
+
+	return &bufferPool{size: size, max: max, free: make(chan []byte, max)}
+}
+
+// Get 取出空闲缓冲区，无空闲且已达上限时返回 nil
+func (p *bufferPool) Get() []byte {
+	select {
+	case buf := <-p.free:
+		return buf
+	default:
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.allocated >= p.max {
+		return nil
+	}
+
+	p.allocated++
+	return make([]byte, p.size)
+}
+
+// Put 归还缓冲区
+func (p *bufferPool) Put(buf []byte) {
+	select {
+	case p.free <- buf:
+	default:
+	}
+}
+
+var (
+	downloadBufferPoolLock sync.Mutex
+	downloadBufferPool     *bufferPool
+)
+
+// downloadBuffers 返回下载输出使用的缓冲区池，download_buffer_size、download_buffer_count
+// 设置变更后重新创建
+func downloadBuffers() *bufferPool {
+	size := model.GetIntSetting("download_buffer_size", 262144)
+	max := model.GetIntSetting("download_buffer_count", 64)
+
+	downloadBufferPoolLock.Lock()
+	defer downloadBufferPoolLock.Unlock()
+	if downloadBufferPool == nil || downloadBufferPool.size != size || downloadBufferPool.max != max {
+		downloadBufferPool = newBufferPool(size, max)
+	}
+
+	return downloadBufferPool
+}
+
+// writerOnly 隐藏 io.ReaderFrom 等接口，使 io.CopyBuffer 使用给定的缓冲区
+type writerOnly struct {
+	io.Writer
+}
+
+// copyBuffered 使用下载缓冲区池中的缓冲区复制内容，缓冲区用尽或未启用时使用 io.Copy 的默认缓冲区
+func copyBuffered(dst io.Writer, src io.Reader) (int64, error) {
+	pool := downloadBuffers()
+	buf := pool.Get()
+	if buf == nil {
+		return io.Copy(dst, src)
+	}
+	defer pool.Put(buf)
+
+	return io.CopyBuffer(writerOnly{dst}, src, buf)
+}
+
+// bufferedResponseWriter 实现 io.ReaderFrom，http.ServeContent 输出正文时经由 ReadFrom
+// 使用下载缓冲区池中的缓冲区
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+}
+
+// ReadFrom 实现 io.ReaderFrom
+func (w bufferedResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	return copyBuffered(w.ResponseWriter, r)
+}
+
+// NewBufferedResponseWriter 包装 w，交由 http.ServeContent 输出文件内容时使用可配置大小的复制缓冲区
+func NewBufferedResponseWriter(w http.ResponseWriter) http.ResponseWriter {
+	return bufferedResponseWriter{ResponseWriter: w}
+}
+
+// ETag 生成策略
+const (
+	// ETagStrategySizeMtime 使用修改时间与大小生成，开销最小
+	ETagStrategySizeMtime = "size_mtime"
+	// ETagStrategyHash 使用已存储的内容哈希，无哈希时回退到 ETagStrategySizeMtime
+	ETagStrategyHash = "hash"
+)
+
+// FileETag 按 etag_strategy 设定返回文件的强 ETag，下载、WebDAV 均使用此 ETag。
+// 在 ServeContent 前设置后，断点续传请求的 If-Range、If-Match 会据此校验，
+// 文件已变更时返回完整内容或 412，而不是拼接不一致的数据
+func FileETag(file *model.File) string {
+	if file.MD5 != "" && model.GetSettingByNameWithDefault("etag_strategy", ETagStrategySizeMtime) == ETagStrategyHash {
+		return `"` + file.MD5 + `"`
+	}
+
+	return fmt.Sprintf(`"%x%x"`, file.UpdatedAt.UnixNano(), file.Size)
+}
+
+// protectedResponseHeaders 由输出逻辑设定的响应头，存储策略的自定义响应头不能覆盖
+var protectedResponseHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Content-Range":     true,
+	"Content-Encoding":  true,
+	"Transfer-Encoding": true,
+	"Accept-Ranges":     true,
+	"Etag":              true,
+	"Last-Modified":     true,
+	"Location":          true,
+	"Set-Cookie":        true,
+}
+
+// SetPolicyHeaders 将存储策略配置的自定义响应头写入 header，
+// 受保护或名称不合法的响应头会被忽略
+func SetPolicyHeaders(header http.Header, policy *model.Policy) {
+	if policy == nil {
+		return
+	}
+
+	for name, value := range policy.OptionsSerialized.ResponseHeaders {
+		name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		if name == "" || strings.ContainsAny(name, " :\t\r\n") || protectedResponseHeaders[name] {
+			continue
+		}
+
+		header.Set(name, strings.NewReplacer("\r", " ", "\n", " ").Replace(value))
+	}
+}
+
+// negotiateEncoding 根据文件类型、大小和请求头决定使用的压缩方式，
+// 返回空字符串表示不压缩
+func negotiateEncoding(r *http.Request, name string, size uint64) string {
+	// 断点续传请求不压缩，以保证偏移量有效
+	if r.Header.Get("Range") != "" {
+		return ""
+	}
+
+	options := model.GetSettingByNames("download_compress_enabled", "download_compress_min_size", "download_compress_types")
+	if !model.IsTrueVal(options["download_compress_enabled"]) {
+		return ""
+	}
+
+	minSize, _ := strconv.ParseUint(options["download_compress_min_size"], 10, 64)
+	if size < minSize {
+		return ""
+	}
+
+	if !isCompressibleType(mime.TypeByExtension(filepath.Ext(name)), strings.Split(options["download_compress_types"], ",")) {
+		return ""
+	}
+
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		token := strings.Split(strings.TrimSpace(part), ";")
+		if !isAcceptedQuality(token[1:]) {
+			continue
+		}
+		accepted[strings.ToLower(strings.TrimSpace(token[0]))] = true
+	}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+// isAcceptedQuality 解析编码的参数中的 q 值，q 值为 0 或无效时返回 false，未指定时视为 1
+func isAcceptedQuality(params []string) bool {
+	for _, param := range params {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "q") {
+			continue
+		}
+
+		q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		return err == nil && q > 0
+	}
+
+	return true
+}
+
+// isCompressibleType 返回给定 MIME 类型是否匹配可压缩类型前缀列表
+func isCompressibleType(mimeType string, types []string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	if mimeType == "" {
+		return false
+	}
+
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(mimeType, prefix) {
+			return false
+		}
+	}
+
+	for _, prefix := range types {
+		prefix = strings.ToLower(strings.TrimSpace(prefix))
+		if prefix != "" && strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
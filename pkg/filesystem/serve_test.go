@@ -0,0 +1,372 @@
+package filesystem
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeContent(t *testing.T) {
+	a := assert.New(t)
+	content := strings.Repeat("cloudreve", 100)
+	cache.Set("setting_download_compress_enabled", "1", 0)
+	cache.Set("setting_download_compress_min_size", "10", 0)
+	cache.Set("setting_download_compress_types", "text/,application/json", 0)
+
+	// gzip 压缩
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "deflate, gzip")
+		ServeContent(w, r, "1.txt", time.Now(), uint64(len(content)), strings.NewReader(content))
+		a.Equal("gzip", w.Header().Get("Content-Encoding"))
+		a.Empty(w.Header().Get("Content-Length"))
+		reader, err := gzip.NewReader(w.Body)
+		a.NoError(err)
+		res, _ := ioutil.ReadAll(reader)
+		a.Equal(content, string(res))
+	}
+
+	// deflate 压缩输出 zlib 格式
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "deflate")
+		ServeContent(w, r, "1.txt", time.Now(), uint64(len(content)), strings.NewReader(content))
+		a.Equal("deflate", w.Header().Get("Content-Encoding"))
+		reader, err := zlib.NewReader(w.Body)
+		a.NoError(err)
+		res, _ := ioutil.ReadAll(reader)
+		a.Equal(content, string(res))
+	}
+
+	// 客户端不支持压缩
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip;q=0")
+		ServeContent(w, r, "1.txt", time.Now(), uint64(len(content)), strings.NewReader(content))
+		a.Empty(w.Header().Get("Content-Encoding"))
+		a.Equal(content, w.Body.String())
+	}
+
+	// 断点续传请求
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		r.Header.Set("Range", "bytes=0-1")
+		ServeContent(w, r, "1.txt", time.Now(), uint64(len(content)), strings.NewReader(content))
+		a.Empty(w.Header().Get("Content-Encoding"))
+		a.Equal("cl", w.Body.String())
+	}
+
+	// 已压缩格式
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		ServeContent(w, r, "1.zip", time.Now(), uint64(len(content)), strings.NewReader(content))
+		a.Empty(w.Header().Get("Content-Encoding"))
+	}
+
+	// 未达到尺寸阈值
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		ServeContent(w, r, "1.txt", time.Now(), 5, strings.NewReader("12345"))
+		a.Empty(w.Header().Get("Content-Encoding"))
+	}
+
+	cache.Set("setting_download_compress_enabled", "0", 0)
+}
+
+func TestIsAcceptedQuality(t *testing.T) {
+	a := assert.New(t)
+	a.True(isAcceptedQuality(nil))
+	a.True(isAcceptedQuality([]string{"q=0.5"}))
+	a.True(isAcceptedQuality([]string{" Q = 1 "}))
+	a.False(isAcceptedQuality([]string{"q=0"}))
+	a.False(isAcceptedQuality([]string{"q=0.0"}))
+	a.False(isAcceptedQuality([]string{" q=0.000"}))
+	a.False(isAcceptedQuality([]string{"q=invalid"}))
+}
+
+func TestIsCompressibleType(t *testing.T) {
+	a := assert.New(t)
+	a.True(isCompressibleType("text/plain; charset=utf-8", []string{"text/"}))
+	a.False(isCompressibleType("video/mp4", []string{"video/"}))
+	a.False(isCompressibleType("", []string{"text/"}))
+	a.False(isCompressibleType("application/json", []string{"", "text/"}))
+}
+
+func TestFileETag(t *testing.T) {
+	a := assert.New(t)
+	cache.Set("setting_download_compress_enabled", "0", 0)
+	content := "cloudreve"
+	file := &model.File{Size: uint64(len(content))}
+	file.ID = 1
+	file.UpdatedAt = time.Now()
+	etag := FileETag(file)
+	a.True(strings.HasPrefix(etag, `"`))
+
+	// 内容变更后 ETag 改变
+	modified := *file
+	modified.UpdatedAt = file.UpdatedAt.Add(time.Second)
+	a.NotEqual(etag, FileETag(&modified))
+
+	// 使用内容哈希
+	modified = *file
+	modified.MD5 = "md5"
+	a.Equal(etag, FileETag(&modified))
+	cache.Set("setting_etag_strategy", ETagStrategyHash, 0)
+	a.Equal(`"md5"`, FileETag(&modified))
+	a.Equal(etag, FileETag(file))
+	cache.Deletes([]string{"etag_strategy"}, "setting_")
+
+	serve := func(header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w.Header().Set("ETag", etag)
+		ServeContent(w, r, "1.txt", file.UpdatedAt, file.Size, strings.NewReader(content))
+		return w
+	}
+
+	// If-Range 匹配，返回部分内容
+	{
+		w := serve(map[string]string{"Range": "bytes=5-", "If-Range": etag})
+		a.Equal(http.StatusPartialContent, w.Code)
+		a.Equal("reve", w.Body.String())
+	}
+
+	// If-Range 不匹配，返回完整内容
+	{
+		w := serve(map[string]string{"Range": "bytes=5-", "If-Range": `"other"`})
+		a.Equal(http.StatusOK, w.Code)
+		a.Equal(content, w.Body.String())
+	}
+
+	// If-Match 不匹配
+	{
+		w := serve(map[string]string{"Range": "bytes=5-", "If-Match": `"other"`})
+		a.Equal(http.StatusPreconditionFailed, w.Code)
+	}
+}
+
+func TestSetPolicyHeaders(t *testing.T) {
+	asserts := assert.New(t)
+	header := http.Header{}
+	header.Set("Content-Length", "10")
+
+	SetPolicyHeaders(header, nil)
+	asserts.Len(header, 1)
+
+	policy := &model.Policy{}
+	policy.OptionsSerialized.ResponseHeaders = map[string]string{
+		"x-content-type-options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'\r\nX-Injected: 1",
+		"content-length":          "0",
+		"Content-Range":           "bytes 0-1/2",
+		"Bad Name":                "1",
+	}
+	SetPolicyHeaders(header, policy)
+	asserts.Equal("nosniff", header.Get("X-Content-Type-Options"))
+	asserts.Equal("default-src 'none'  X-Injected: 1", header.Get("Content-Security-Policy"))
+	asserts.Equal("10", header.Get("Content-Length"))
+	asserts.Empty(header.Get("Content-Range"))
+	asserts.Len(header, 3)
+}
+
+func TestBufferPool(t *testing.T) {
+	a := assert.New(t)
+
+	// 未启用
+	a.Nil(newBufferPool(0, 10).Get())
+	a.Nil(newBufferPool(1024, 0).Get())
+
+	// 至多分配 max 个
+	pool := newBufferPool(1024, 2)
+	first, second := pool.Get(), pool.Get()
+	a.Len(first, 1024)
+	a.Len(second, 1024)
+	a.Nil(pool.Get())
+
+	// 归还后可复用
+	pool.Put(first)
+	a.Len(pool.Get(), 1024)
+	a.Nil(pool.Get())
+}
+
+// chunkRecorder 记录每次写入的长度
+type chunkRecorder struct {
+	header http.Header
+	chunks []int
+}
+
+func (w *chunkRecorder) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *chunkRecorder) Write(p []byte) (int, error) {
+	w.chunks = append(w.chunks, len(p))
+	return len(p), nil
+}
+
+func (w *chunkRecorder) WriteHeader(int) {}
+
+func (w *chunkRecorder) maxChunk() int {
+	max := 0
+	for _, size := range w.chunks {
+		if size > max {
+			max = size
+		}
+	}
+	return max
+}
+
+// readerOnly 隐藏 io.WriterTo，使复制时使用缓冲区
+type readerOnly struct {
+	io.Reader
+}
+
+func TestNewBufferedResponseWriter(t *testing.T) {
+	a := assert.New(t)
+	content := strings.Repeat("c", 1<<20)
+	cache.Set("setting_download_compress_enabled", "0", 0)
+	defer cache.Deletes([]string{"download_buffer_size", "download_buffer_count"}, "setting_")
+
+	// 使用设定大小的缓冲区
+	{
+		cache.Set("setting_download_buffer_size", "131072", 0)
+		cache.Set("setting_download_buffer_count", "4", 0)
+		w := &chunkRecorder{}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		ServeContent(w, r, "1.bin", time.Now(), uint64(len(content)), strings.NewReader(content))
+		a.Equal(131072, w.maxChunk())
+	}
+
+	// 已禁用时使用默认缓冲区
+	{
+		cache.Set("setting_download_buffer_size", "0", 0)
+		w := &chunkRecorder{}
+		n, err := NewBufferedResponseWriter(w).(io.ReaderFrom).ReadFrom(readerOnly{strings.NewReader(content)})
+		a.NoError(err)
+		a.EqualValues(len(content), n)
+		a.Equal(32*1024, w.maxChunk())
+	}
+}
+
+// devNullResponseWriter 将正文写入 /dev/null，每次写入均产生一次系统调用，近似写入网络连接的开销
+type devNullResponseWriter struct {
+	file   *os.File
+	header http.Header
+}
+
+func (w *devNullResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *devNullResponseWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+func (w *devNullResponseWriter) WriteHeader(int) {}
+
+// benchmarkServeContent 以不同大小的缓冲区输出 open 返回的内容
+func benchmarkServeContent(b *testing.B, size int, open func() io.ReadSeeker) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+
+	for _, bufferSize := range []int{0, 256 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("buffer=%d", bufferSize), func(b *testing.B) {
+			cache.Set("setting_download_compress_enabled", "0", 0)
+			cache.Set("setting_download_compress_min_size", "0", 0)
+			cache.Set("setting_download_compress_types", "", 0)
+			cache.Set("setting_download_buffer_size", strconv.Itoa(bufferSize), 0)
+			cache.Set("setting_download_buffer_count", "4", 0)
+			defer cache.Deletes([]string{"download_buffer_size", "download_buffer_count"}, "setting_")
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := &devNullResponseWriter{file: devNull, header: make(http.Header)}
+				ServeContent(w, httptest.NewRequest(http.MethodGet, "/", nil), "1.bin", time.Now(), uint64(size), open())
+			}
+		})
+	}
+}
+
+func BenchmarkServeContent_Local(b *testing.B) {
+	size := 64 << 20
+	path := filepath.Join(b.TempDir(), "bench.bin")
+	if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	var opened []*os.File
+	defer func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}()
+	benchmarkServeContent(b, size, func() io.ReadSeeker {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		opened = append(opened, f)
+		return f
+	})
+}
+
+func BenchmarkServeContent_Proxied(b *testing.B) {
+	size := 64 << 20
+	content := make([]byte, size)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	// 与对象存储驱动相同，经由 HTTP 客户端读取响应正文
+	client := request.NewClient()
+	var opened []*request.NopRSCloser
+	defer func() {
+		for _, rs := range opened {
+			rs.Close()
+		}
+	}()
+	benchmarkServeContent(b, size, func() io.ReadSeeker {
+		rs, err := client.Request("GET", server.URL, nil).CheckHTTPResponse(200).GetRSCloser()
+		if err != nil {
+			b.Fatal(err)
+		}
+		rs.SetFirstFakeChunk()
+		opened = append(opened, rs)
+		return rs
+	})
+}
@@ -0,0 +1,366 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/response"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 大文件拆分存储
+   ================
+*/
+
+// shardSize 返回经由服务端写入 size 字节的文件时每个分片的尺寸，不拆分时返回 0。
+// 存储策略设定了分片尺寸且 object_sharding 开启时，超过分片尺寸的文件拆分为多个对象存储
+func (fs *FileSystem) shardSize(size uint64) uint64 {
+	if fs.Policy == nil || !fs.Policy.IsShardable() || !model.IsTrueVal(model.GetSettingByName("object_sharding")) {
+		return 0
+	}
+
+	if shardSize := fs.Policy.OptionsSerialized.ShardSize; size > shardSize {
+		return shardSize
+	}
+
+	return 0
+}
+
+// putObject 将文件写入存储端，需要拆分时按顺序将内容写入各分片对象，分片清单记录在 file.Shards 中。
+// 写入分片失败时删除已写入的分片
+func (fs *FileSystem) putObject(ctx context.Context, file *fsctx.FileStream) error {
+	file.Shards = ""
+	shardSize := fs.shardSize(file.Size)
+	if shardSize == 0 {
+		return fs.Handler.Put(ctx, file)
+	}
+
+	shards := make([]model.FileShard, 0, (file.Size+shardSize-1)/shardSize)
+	for offset := uint64(0); offset < file.Size; offset += shardSize {
+		size := shardSize
+		if remaining := file.Size - offset; remaining < size {
+			size = remaining
+		}
+
+		shard := model.FileShard{Source: model.ShardSource(file.SavePath, len(shards)), Size: size}
+		shards = append(shards, shard)
+		if err := fs.Handler.Put(ctx, &fsctx.FileStream{
+			File:         ioutil.NopCloser(io.LimitReader(file, int64(size))),
+			Size:         size,
+			MIMEType:     file.MIMEType,
+			Name:         file.Name,
+			SavePath:     shard.Source,
+			Mode:         file.Mode,
+			LastModified: file.LastModified,
+			StorageClass: file.StorageClass,
+			Tags:         file.Tags,
+		}); err != nil {
+			fs.deleteShardObjects(ctx, shardSources(shards))
+			return err
+		}
+	}
+
+	file.Shards = model.EncodeShards(shards)
+	return nil
+}
+
+// recordShards 将合并写入时生成的分片清单记录到上传的文件记录中
+func recordShards(fileHeader fsctx.FileHeader, manifest string) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok {
+		if manifest == "" {
+			return nil
+		}
+		return ErrObjectNotExist
+	}
+
+	if fileModel.Shards == manifest {
+		return nil
+	}
+
+	return fileModel.UpdateShards(manifest)
+}
+
+// shardSources 返回各分片的物理路径
+func shardSources(shards []model.FileShard) []string {
+	sources := make([]string, len(shards))
+	for i, shard := range shards {
+		sources[i] = shard.Source
+	}
+
+	return sources
+}
+
+// shardObjects 返回分片清单中各分片的物理路径，清单无效时返回 nil
+func shardObjects(manifest string) []string {
+	shards, err := model.ParseShards(manifest)
+	if err != nil {
+		util.Log().Warning("Failed to parse shard manifest: %s", err)
+		return nil
+	}
+
+	return shardSources(shards)
+}
+
+// staleShardObjects 返回以 savePath 存储的文件内容由分片清单 previous 更新为 current 后不再使用的对象。
+// 仅包含由 savePath 生成的路径，软链接文件重新生成存储路径后，旧分片仍被其他文件引用
+func staleShardObjects(previous, current, savePath string) []string {
+	if previous == current {
+		return nil
+	}
+
+	kept := len(shardObjects(current))
+	stale := make([]string, 0)
+	for i, source := range shardObjects(previous) {
+		if i >= kept && source == model.ShardSource(savePath, i) {
+			stale = append(stale, source)
+		}
+	}
+
+	// 由单个对象改为拆分存储后，之前的对象不再使用
+	if kept > 0 && previous == "" {
+		stale = append(stale, savePath)
+	}
+
+	return stale
+}
+
+// deleteShardObjects 删除分片对象，失败时仅记录日志
+func (fs *FileSystem) deleteShardObjects(ctx context.Context, sources []string) {
+	if len(sources) == 0 {
+		return
+	}
+
+	if _, err := fs.Handler.Delete(ctx, sources); err != nil {
+		util.Log().Warning("Failed to delete shard objects: %s", err)
+	}
+}
+
+// WithInternalRead 标记此上下文中的读取为系统内部处理，不受下载密码等面向用户的读取限制
+func WithInternalRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fsctx.InternalReadCtx, true)
+}
+
+// isInternalRead 返回此上下文中的读取是否为系统内部处理
+func isInternalRead(ctx context.Context) bool {
+	internal, _ := ctx.Value(fsctx.InternalReadCtx).(bool)
+	return internal
+}
+
+// OpenObject 读取文件在存储端的内容。除系统内部处理外，设有下载密码的文件需先解锁，
+// 仅允许签名链接访问的存储策略需验证签名并记录读取
+func (fs *FileSystem) OpenObject(ctx context.Context, file *model.File) (response.RSCloser, error) {
+	if isInternalRead(ctx) {
+		return fs.openObject(ctx, file)
+	}
+
+	if err := checkFileUnlocked(ctx, file); err != nil {
+		return nil, err
+	}
+
+	if err := fs.checkSignedAccess(ctx, file); err != nil {
+		return nil, err
+	}
+
+	rs, err := fs.openObject(ctx, file)
+	if err == nil {
+		fs.logSignedAccess(ctx, file)
+	}
+
+	return rs, err
+}
+
+// openObject 打开存储端对象，拆分存储的文件按分片清单的顺序组合各分片
+func (fs *FileSystem) openObject(ctx context.Context, file *model.File) (response.RSCloser, error) {
+	if !file.IsSharded() {
+		return fs.Handler.Get(ctx, file.SourceName)
+	}
+
+	shards, err := model.ParseShards(file.Shards)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &shardReader{ctx: ctx, handler: fs.Handler, shards: shards, current: -1}
+	for _, shard := range shards {
+		reader.size += int64(shard.Size)
+	}
+
+	// 立即打开首个分片，使对象缺失等错误在读取前返回
+	if err := reader.open(0, 0); err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// statObject 查询文件在存储端的对象，拆分存储的文件查询全部分片，返回的大小为各分片之和
+func (fs *FileSystem) statObject(ctx context.Context, file *model.File) (*response.Object, error) {
+	if !file.IsSharded() {
+		return driver.Stat(ctx, fs.Handler, file.SourceName)
+	}
+
+	shards, err := model.ParseShards(file.Shards)
+	if err != nil {
+		return nil, err
+	}
+
+	var object *response.Object
+	for _, shard := range shards {
+		stat, err := driver.Stat(ctx, fs.Handler, shard.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		if object == nil {
+			object = stat
+			object.Name = file.Name
+			object.RelativePath = file.SourceName
+			object.Source = file.SourceName
+			continue
+		}
+		object.Size += stat.Size
+	}
+
+	if object == nil {
+		return nil, driver.ErrObjectMissing
+	}
+
+	return object, nil
+}
+
+// shardSourceHandler 拆分存储的文件在存储端没有完整的对象，非本机存储策略下改为生成经由服务端读取的地址
+func (fs *FileSystem) shardSourceHandler(file *model.File) driver.Handler {
+	if !file.IsSharded() || fs.Policy.Type == "local" {
+		return fs.Handler
+	}
+
+	return local.Driver{Policy: &model.Policy{}}
+}
+
+// shardReader 将各分片组合为一个可定位的文件流，读取跨越分片边界时依次打开后续分片
+type shardReader struct {
+	ctx     context.Context
+	handler driver.Handler
+	shards  []model.FileShard
+	size    int64
+	pos     int64
+	current int // 当前打开的分片序号，-1 表示未打开
+	rs      response.RSCloser
+}
+
+// locate 返回 pos 所在的分片序号及在该分片内的偏移
+func (r *shardReader) locate(pos int64) (int, int64) {
+	for i, shard := range r.shards {
+		if pos < int64(shard.Size) {
+			return i, pos
+		}
+		pos -= int64(shard.Size)
+	}
+
+	return len(r.shards), 0
+}
+
+// open 打开第 index 个分片并定位至 offset
+func (r *shardReader) open(index int, offset int64) error {
+	if r.rs != nil {
+		r.rs.Close()
+		r.rs = nil
+		r.current = -1
+	}
+
+	rs, err := r.handler.Get(r.ctx, r.shards[index].Source)
+	if err != nil {
+		return fmt.Errorf("failed to open shard %q: %w", r.shards[index].Source, err)
+	}
+
+	if offset > 0 {
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			rs.Close()
+			return err
+		}
+	}
+
+	r.rs = rs
+	r.current = index
+	return nil
+}
+
+func (r *shardReader) Read(p []byte) (int, error) {
+	for {
+		if r.pos >= r.size {
+			return 0, io.EOF
+		}
+
+		index, offset := r.locate(r.pos)
+		if index != r.current {
+			if err := r.open(index, offset); err != nil {
+				return 0, err
+			}
+		}
+
+		// 不读取超出清单记录大小的内容
+		remaining := int64(r.shards[index].Size) - offset
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+
+		n, err := r.rs.Read(p)
+		r.pos += int64(n)
+		if err == io.EOF {
+			if int64(n) < remaining {
+				return n, io.ErrUnexpectedEOF
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *shardReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	// 定位至当前分片内时直接在分片中定位，否则在下次读取时重新打开
+	if index, inner := r.locate(offset); index == r.current && offset != r.pos {
+		if _, err := r.rs.Seek(inner, io.SeekStart); err != nil {
+			return 0, err
+		}
+	} else if index != r.current && r.rs != nil {
+		r.rs.Close()
+		r.rs = nil
+		r.current = -1
+	}
+
+	r.pos = offset
+	return offset, nil
+}
+
+func (r *shardReader) Close() error {
+	if r.rs != nil {
+		return r.rs.Close()
+	}
+
+	return nil
+}
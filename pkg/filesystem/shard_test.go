@@ -0,0 +1,136 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem_ShardSize(t *testing.T) {
+	asserts := assert.New(t)
+	defer cache.Deletes([]string{"object_sharding"}, "setting_")
+	cache.Set("setting_object_sharding", "1", 0)
+
+	fs := &FileSystem{Policy: &model.Policy{}}
+	asserts.EqualValues(0, fs.shardSize(10))
+
+	fs.Policy.OptionsSerialized.ShardSize = 3
+	asserts.EqualValues(3, fs.shardSize(10))
+	asserts.EqualValues(0, fs.shardSize(3))
+
+	// 全局关闭
+	cache.Set("setting_object_sharding", "0", 0)
+	asserts.EqualValues(0, fs.shardSize(10))
+}
+
+func TestFileSystem_PutObject_Sharded(t *testing.T) {
+	asserts := assert.New(t)
+	defer cache.Deletes([]string{"object_sharding"}, "setting_")
+	cache.Set("setting_object_sharding", "1", 0)
+
+	fs := &FileSystem{
+		Policy:  &model.Policy{Type: "local", OptionsSerialized: model.PolicyOption{ShardSize: 3}},
+		Handler: local.Driver{},
+	}
+	file := &fsctx.FileStream{
+		File:     ioutil.NopCloser(strings.NewReader("1234567")),
+		Size:     7,
+		SavePath: "TestShard.txt",
+		Mode:     fsctx.Overwrite,
+	}
+	asserts.NoError(fs.putObject(context.Background(), file))
+	fileModel := &model.File{SourceName: file.SavePath, Shards: file.Shards}
+	defer fs.Handler.Delete(context.Background(), fileModel.ShardSources())
+
+	// 按顺序记录分片及尺寸
+	shards, err := model.ParseShards(file.Shards)
+	asserts.NoError(err)
+	asserts.Equal([]model.FileShard{
+		{Source: "TestShard.txt.shard00000", Size: 3},
+		{Source: "TestShard.txt.shard00001", Size: 3},
+		{Source: "TestShard.txt.shard00002", Size: 1},
+	}, shards)
+	asserts.False(util.Exists(util.RelativePath("TestShard.txt")))
+
+	// 完整读取
+	rs, err := fs.OpenObject(context.Background(), fileModel)
+	asserts.NoError(err)
+	content, err := ioutil.ReadAll(rs)
+	asserts.NoError(err)
+	asserts.Equal("1234567", string(content))
+
+	// 跨越分片的范围读取
+	pos, err := rs.Seek(2, io.SeekStart)
+	asserts.NoError(err)
+	asserts.EqualValues(2, pos)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(rs, buf)
+	asserts.NoError(err)
+	asserts.Equal("3456", string(buf))
+
+	// 当前分片内定位
+	_, err = rs.Seek(-2, io.SeekCurrent)
+	asserts.NoError(err)
+	_, err = io.ReadFull(rs, buf[:2])
+	asserts.NoError(err)
+	asserts.Equal("56", string(buf[:2]))
+
+	size, err := rs.Seek(0, io.SeekEnd)
+	asserts.NoError(err)
+	asserts.EqualValues(7, size)
+	asserts.NoError(rs.Close())
+
+	// 分片缺失
+	asserts.NoError(os.Remove(util.RelativePath("TestShard.txt.shard00000")))
+	_, err = fs.OpenObject(context.Background(), fileModel)
+	asserts.Error(err)
+
+	// 未超出分片尺寸时以单个对象存储
+	file = &fsctx.FileStream{
+		File:     ioutil.NopCloser(strings.NewReader("123")),
+		Size:     3,
+		SavePath: "TestShard.txt",
+		Mode:     fsctx.Overwrite,
+	}
+	asserts.NoError(fs.putObject(context.Background(), file))
+	defer os.Remove(util.RelativePath("TestShard.txt"))
+	asserts.Empty(file.Shards)
+	asserts.True(util.Exists(util.RelativePath("TestShard.txt")))
+}
+
+func TestStaleShardObjects(t *testing.T) {
+	asserts := assert.New(t)
+	manifest := func(sources ...string) string {
+		shards := make([]model.FileShard, len(sources))
+		for i, source := range sources {
+			shards[i] = model.FileShard{Source: source, Size: 1}
+		}
+		return model.EncodeShards(shards)
+	}
+	three := manifest(model.ShardSource("a", 0), model.ShardSource("a", 1), model.ShardSource("a", 2))
+
+	asserts.Empty(staleShardObjects(three, three, "a"))
+
+	// 分片减少
+	asserts.Equal([]string{model.ShardSource("a", 2)}, staleShardObjects(three, manifest(model.ShardSource("a", 0), model.ShardSource("a", 1)), "a"))
+
+	// 改为单个对象存储
+	asserts.Equal(manifest(), "")
+	asserts.Len(staleShardObjects(three, "", "a"), 3)
+
+	// 改为拆分存储
+	asserts.Equal([]string{"a"}, staleShardObjects("", three, "a"))
+
+	// 软链接文件重新生成了存储路径，旧分片仍被引用
+	asserts.Empty(staleShardObjects(three, manifest(model.ShardSource("b", 0)), "b"))
+}
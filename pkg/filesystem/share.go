@@ -0,0 +1,41 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/gin-gonic/gin"
+)
+
+// shareDownload 通过分享读取文件时的分享及下载者信息
+type shareDownload struct {
+	share *model.Share
+	user  *model.User
+	c     *gin.Context
+}
+
+// WithShareDownload 返回带有分享下载信息的上下文。通过此上下文读取文件内容或签名下载地址时，
+// 检查分享是否过期、下载次数是否用尽，并计入一次下载
+func WithShareDownload(ctx context.Context, share *model.Share, user *model.User, c *gin.Context) context.Context {
+	return context.WithValue(ctx, fsctx.ShareDownloadCtx, &shareDownload{share: share, user: user, c: c})
+}
+
+// CountShareDownload 上下文中带有分享下载信息时，检查分享的有效期和剩余下载次数并计入一次下载。
+// 同一下载者的断点续传、分段读取只计为一次下载
+func CountShareDownload(ctx context.Context) error {
+	download, ok := ctx.Value(fsctx.ShareDownloadCtx).(*shareDownload)
+	if !ok {
+		return nil
+	}
+
+	if err := download.share.DownloadBy(download.user, download.c); err != nil {
+		if errors.Is(err, model.ErrShareUnavailable) {
+			return ErrShareUnavailable
+		}
+		return ErrDBUpdateObjects.WithError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package filesystem
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestCountShareDownload(t *testing.T) {
+	asserts := assert.New(t)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	user := &model.User{Model: gorm.Model{ID: 1}}
+
+	// 非分享访问
+	asserts.NoError(CountShareDownload(context.Background()))
+
+	// 首次下载
+	{
+		cache.Deletes([]string{"10_1"}, "share_")
+		ctx := WithShareDownload(context.Background(), &model.Share{Model: gorm.Model{ID: 10}, RemainDownloads: 1}, user, c)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)shares(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		asserts.NoError(CountShareDownload(ctx))
+		asserts.NoError(mock.ExpectationsWereMet())
+
+		// 分段读取、续传不再计数
+		asserts.NoError(CountShareDownload(ctx))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 下载次数已用尽
+	{
+		cache.Deletes([]string{"11_1"}, "share_")
+		ctx := WithShareDownload(context.Background(), &model.Share{Model: gorm.Model{ID: 11}}, user, c)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)shares(.+)").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		err := CountShareDownload(ctx)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeShareLinkNotFound, err.(serializer.AppError).Code)
+	}
+}
+
+func TestFileSystem_GetContent_ShareUnavailable(t *testing.T) {
+	asserts := assert.New(t)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	cache.Deletes([]string{"12_1"}, "share_")
+
+	testHandler := new(FileHeaderMock)
+	fs := &FileSystem{
+		User:       &model.User{Model: gorm.Model{ID: 1}},
+		Handler:    testHandler,
+		FileTarget: []model.File{{Model: gorm.Model{ID: 1}, SourceName: "1.txt", PolicyID: 91}},
+	}
+	cache.Set("policy_91", model.Policy{Type: "mock"}, -1)
+	defer cache.Deletes([]string{"91"}, "policy_")
+	ctx := WithShareDownload(context.Background(), &model.Share{Model: gorm.Model{ID: 12}}, fs.User, c)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)shares(.+)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	_, err := fs.GetContent(ctx, 0)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Error(err)
+	testHandler.AssertNotCalled(t, "Get", testMock.Anything, testMock.Anything)
+}
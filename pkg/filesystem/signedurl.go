@@ -0,0 +1,69 @@
+package filesystem
+
+import (
+	"context"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/gin-gonic/gin"
+)
+
+/* ================
+	 签名链接访问相关
+   ================
+*/
+
+// SignedRequestKey 请求通过签名验证后在 gin.Context 中设定的键
+const SignedRequestKey = "signed_request"
+
+// WithSignedAccess 请求已通过签名验证时在上下文中记录，之后可通过此上下文读取
+// 仅允许签名链接访问的存储策略下的文件
+func WithSignedAccess(ctx context.Context, c *gin.Context) context.Context {
+	if !c.GetBool(SignedRequestKey) {
+		return ctx
+	}
+
+	return context.WithValue(ctx, fsctx.SignedAccessCtx, true)
+}
+
+// isSignedURLOnly 返回存储策略是否仅允许通过签名链接读取文件
+func isSignedURLOnly(policy *model.Policy) bool {
+	return policy != nil && policy.OptionsSerialized.SignedURLOnly
+}
+
+// checkSignedAccess 存储策略仅允许通过签名链接读取时，拒绝未经签名验证的读取
+func (fs *FileSystem) checkSignedAccess(ctx context.Context, file *model.File) error {
+	if !isSignedURLOnly(fs.Policy) {
+		return nil
+	}
+
+	if signed, _ := ctx.Value(fsctx.SignedAccessCtx).(bool); !signed {
+		return ErrSignedURLRequired
+	}
+
+	return nil
+}
+
+// logSignedAccess 记录对仅允许签名链接访问的存储策略下文件内容的读取
+func (fs *FileSystem) logSignedAccess(ctx context.Context, file *model.File) {
+	if !isSignedURLOnly(fs.Policy) {
+		return
+	}
+
+	clientIP, _ := ctx.Value(fsctx.ClientIPCtx).(string)
+	util.Log().Info("Signed access to file %q (#%d) of policy %q from %q.", file.Name, file.ID, fs.Policy.Name, clientIP)
+}
+
+// logSignedURL 记录为仅允许签名链接访问的存储策略下的文件签发链接
+func (fs *FileSystem) logSignedURL(file *model.File, ttl int64) {
+	if !isSignedURLOnly(fs.Policy) {
+		return
+	}
+
+	var uid uint
+	if fs.User != nil {
+		uid = fs.User.ID
+	}
+	util.Log().Info("Signed URL of file %q (#%d) issued to user #%d, valid for %d seconds.", file.Name, file.ID, uid, ttl)
+}
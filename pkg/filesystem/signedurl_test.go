@@ -0,0 +1,110 @@
+package filesystem
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSignedAccess(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未通过签名验证
+	{
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx := WithSignedAccess(context.Background(), c)
+		asserts.Nil(ctx.Value(fsctx.SignedAccessCtx))
+	}
+
+	// 已通过签名验证
+	{
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set(SignedRequestKey, true)
+		ctx := WithSignedAccess(context.Background(), c)
+		asserts.Equal(true, ctx.Value(fsctx.SignedAccessCtx))
+	}
+}
+
+func TestFileSystem_CheckSignedAccess(t *testing.T) {
+	asserts := assert.New(t)
+	file := &model.File{Name: "a.txt"}
+	signed := context.WithValue(context.Background(), fsctx.SignedAccessCtx, true)
+
+	// 未开启
+	fs := &FileSystem{Policy: &model.Policy{}}
+	asserts.NoError(fs.checkSignedAccess(context.Background(), file))
+
+	// 开启后拒绝未签名的读取
+	fs.Policy.OptionsSerialized.SignedURLOnly = true
+	asserts.Equal(ErrSignedURLRequired, fs.checkSignedAccess(context.Background(), file))
+	asserts.NoError(fs.checkSignedAccess(signed, file))
+}
+
+func TestFileSystem_OpenObject_SignedURLOnly(t *testing.T) {
+	asserts := assert.New(t)
+	handler := newMemoryDriver()
+	handler.objects["a.txt"] = []byte("content")
+	file := &model.File{Name: "a.txt", SourceName: "a.txt"}
+	fs := &FileSystem{
+		User:    &model.User{},
+		Handler: handler,
+		Policy:  &model.Policy{OptionsSerialized: model.PolicyOption{SignedURLOnly: true}},
+	}
+
+	// 未签名的读取被拒绝
+	rs, err := fs.OpenObject(context.Background(), file)
+	asserts.Nil(rs)
+	asserts.Equal(ErrSignedURLRequired, err)
+
+	// 签名验证后可读取
+	rs, err = fs.OpenObject(context.WithValue(context.Background(), fsctx.SignedAccessCtx, true), file)
+	asserts.NoError(err)
+	rs.Close()
+
+	// 系统内部处理不受限制
+	rs, err = fs.OpenObject(WithInternalRead(context.Background()), file)
+	asserts.NoError(err)
+	rs.Close()
+
+	// 缩略图同样需要签名
+	cache.Set("policy_92", model.Policy{Type: "mock", OptionsSerialized: model.PolicyOption{SignedURLOnly: true}}, -1)
+	defer cache.Deletes([]string{"92"}, "policy_")
+	fs.FileTarget = []model.File{{Name: "a.jpg", SourceName: "a.jpg", PicInfo: "1,1", PolicyID: 92}}
+	_, err = fs.GetThumb(context.Background(), 0)
+	asserts.Equal(ErrSignedURLRequired, err)
+}
+
+func TestFileSystem_Preview_SignedURLOnly(t *testing.T) {
+	asserts := assert.New(t)
+	auth.General = auth.HMACAuth{SecretKey: []byte("123")}
+	fs := &FileSystem{
+		User: &model.User{},
+		Policy: &model.Policy{
+			Model:             gorm.Model{ID: 1},
+			Type:              "local",
+			OptionsSerialized: model.PolicyOption{SignedURLOnly: true},
+		},
+		FileTarget: []model.File{{Name: "a.txt", SourceName: "a.txt"}},
+	}
+	fs.FileTarget[0].Policy = *fs.Policy
+	asserts.NoError(fs.DispatchHandler())
+
+	// 本地策略不直接返回内容，重定向到签名的预览URL
+	resp, err := fs.Preview(context.Background(), 0, false)
+	asserts.NoError(err)
+	asserts.True(resp.Redirect)
+	asserts.Contains(resp.URL, "sign=")
+
+	// 文本预览需直接读取，拒绝
+	fs.FileTarget = []model.File{{Name: "a.txt", SourceName: "a.txt", Policy: *fs.Policy}}
+	_, err = fs.Preview(context.Background(), 0, true)
+	asserts.Equal(ErrSignedURLRequired, err)
+}
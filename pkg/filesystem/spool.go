@@ -0,0 +1,81 @@
+package filesystem
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// spoolDir 返回上传缓冲文件所在目录，未设置 upload_spool_path 时使用临时目录下的 spool
+func spoolDir() string {
+	if dir := model.GetSettingByName("upload_spool_path"); dir != "" {
+		return util.RelativePath(dir)
+	}
+
+	return filepath.Join(util.RelativePath(model.GetSettingByName("temp_path")), "spool")
+}
+
+// isSpoolNeeded 返回上传内容是否需要先写入缓冲文件
+func (fs *FileSystem) isSpoolNeeded(file *fsctx.FileStream) bool {
+	// 已可重新定位的来源（如已落盘的表单文件）无需缓冲
+	if file.File == nil || file.Seeker != nil {
+		return false
+	}
+
+	// 追加上传的分片直接写入存储端或本机的追加缓冲文件
+	if file.Mode&fsctx.Append == fsctx.Append {
+		return false
+	}
+
+	threshold := model.GetIntSetting("upload_spool_threshold", 0)
+	if threshold <= 0 || file.Size <= uint64(threshold) {
+		return false
+	}
+
+	return !driver.SupportsStreamingPut(fs.Handler)
+}
+
+// spoolUpload 存储端不支持流式上传时，将超过 upload_spool_threshold 的上传内容写入缓冲文件，
+// 存储端改为读取此文件，避免在内存中缓冲整个请求正文。返回的函数用于删除缓冲文件
+func (fs *FileSystem) spoolUpload(file *fsctx.FileStream) (func(), error) {
+	if !fs.isSpoolNeeded(file) {
+		return func() {}, nil
+	}
+
+	spoolPath := filepath.Join(spoolDir(), fmt.Sprintf("upload_%d_%d", fs.User.ID, time.Now().UnixNano()))
+	spool, err := util.CreatNestedFile(spoolPath)
+	if err != nil {
+		util.Log().Warning("Failed to create upload spool file %q: %s", spoolPath, err)
+		return nil, ErrIO.WithError(err)
+	}
+
+	cleanup := func() {
+		spool.Close()
+		if err := os.Remove(spoolPath); err != nil && !os.IsNotExist(err) {
+			util.Log().Warning("Failed to delete upload spool file %q: %s", spoolPath, err)
+		}
+	}
+
+	// 多读取一个字节，使超出声明大小的上传仍能被识别
+	_, err = io.Copy(spool, io.LimitReader(file.File, int64(file.Size)+1))
+	file.File.Close()
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		cleanup()
+		return nil, ErrIO.WithError(err)
+	}
+
+	file.File = spool
+	file.Seeker = spool
+	return cleanup, nil
+}
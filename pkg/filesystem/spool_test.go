@@ -0,0 +1,89 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem_IsSpoolNeeded(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_upload_spool_threshold", "4", 0)
+	defer cache.Set("setting_upload_spool_threshold", "0", 0)
+	fs := &FileSystem{User: &model.User{}, Handler: new(FileHeaderMock)}
+	body := ioutil.NopCloser(strings.NewReader("12345"))
+
+	// 超过阈值
+	asserts.True(fs.isSpoolNeeded(&fsctx.FileStream{File: body, Size: 5}))
+
+	// 未超过阈值
+	asserts.False(fs.isSpoolNeeded(&fsctx.FileStream{File: body, Size: 4}))
+
+	// 来源可重新定位
+	asserts.False(fs.isSpoolNeeded(&fsctx.FileStream{File: body, Seeker: strings.NewReader(""), Size: 5}))
+
+	// 存储端支持流式上传
+	asserts.False((&FileSystem{Handler: local.Driver{}}).isSpoolNeeded(&fsctx.FileStream{File: body, Size: 5}))
+
+	// 追加上传的分片
+	asserts.False(fs.isSpoolNeeded(&fsctx.FileStream{File: body, Size: 5, Mode: fsctx.Append}))
+
+	// 未开启
+	cache.Set("setting_upload_spool_threshold", "0", 0)
+	asserts.False(fs.isSpoolNeeded(&fsctx.FileStream{File: body, Size: 5}))
+}
+
+func TestFileSystem_SpoolUpload(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_upload_spool_threshold", "1", 0)
+	cache.Set("setting_upload_spool_path", "tests/spool", 0)
+	defer cache.Set("setting_upload_spool_threshold", "0", 0)
+	defer cache.Set("setting_upload_spool_path", "", 0)
+	fs := &FileSystem{User: &model.User{}, Handler: new(FileHeaderMock)}
+
+	// 无需缓冲
+	{
+		file := &fsctx.FileStream{Size: 5}
+		cleanup, err := fs.spoolUpload(file)
+		asserts.NoError(err)
+		cleanup()
+		asserts.Nil(file.File)
+	}
+
+	// 写入缓冲文件，完成后删除
+	{
+		file := &fsctx.FileStream{File: ioutil.NopCloser(strings.NewReader("123456")), Size: 5}
+		cleanup, err := fs.spoolUpload(file)
+		asserts.NoError(err)
+		spool, ok := file.File.(*os.File)
+		asserts.True(ok)
+		asserts.Equal(file.Seeker, spool)
+
+		// 超出声明大小的部分也会被读出
+		content, err := ioutil.ReadAll(file)
+		asserts.NoError(err)
+		asserts.Equal("123456", string(content))
+
+		cleanup()
+		asserts.False(util.Exists(spool.Name()))
+		asserts.True(util.IsEmpty(util.RelativePath("tests/spool")))
+	}
+
+	// 无法创建缓冲文件
+	{
+		asserts.NoError(ioutil.WriteFile(util.RelativePath("tests/spool_file"), []byte(""), 0644))
+		defer os.Remove(util.RelativePath("tests/spool_file"))
+		cache.Set("setting_upload_spool_path", "tests/spool_file", 0)
+		file := &fsctx.FileStream{File: ioutil.NopCloser(strings.NewReader("123456")), Size: 5}
+		_, err := fs.spoolUpload(file)
+		asserts.Error(err)
+	}
+}
@@ -0,0 +1,300 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// 分片上传暂存数据的存放位置
+const (
+	// StagingAuto 存储端支持原生追加时直接追加至目标对象，否则暂存于本机
+	StagingAuto = "auto"
+	// StagingLocal 暂存于本机临时目录，最后一个分片上传后一次性写入存储端
+	StagingLocal = "local"
+	// StagingTarget 暂存于目标存储端，存储端不支持原生追加时各分片分别存为暂存对象，完成时合并
+	StagingTarget = "target"
+	// StagingPolicy 各分片分别暂存于 upload_staging_policy 指定的存储策略，完成时合并写入目标存储端
+	StagingPolicy = "policy"
+)
+
+// stagingObjectDir 暂存对象在存储端的目录
+const stagingObjectDir = "upload_staging"
+
+// uploadStaging 一次分片上传的暂存设定
+type uploadStaging struct {
+	Location  string
+	PolicyID  uint
+	ChunkSize uint64
+	Size      uint64 // 文件的完整大小
+}
+
+// uploadStagingSetting 返回 upload_staging 及 upload_staging_policy 设定的暂存位置，
+// 设定无效时使用 StagingAuto
+func uploadStagingSetting() (string, uint) {
+	switch location := model.GetSettingByNameWithDefault("upload_staging", StagingAuto); location {
+	case StagingLocal, StagingTarget:
+		return location, 0
+	case StagingPolicy:
+		if id := model.GetIntSetting("upload_staging_policy", 0); id > 0 {
+			return location, uint(id)
+		}
+	}
+
+	return StagingAuto, 0
+}
+
+// WithUploadStaging 返回带有上传会话暂存设定的上下文，分片的写入、合并与回滚按此设定进行。
+// 未指定时按 StagingAuto 处理
+func WithUploadStaging(ctx context.Context, session *serializer.UploadSession) context.Context {
+	return context.WithValue(ctx, fsctx.UploadStagingCtx, newUploadStaging(session))
+}
+
+func newUploadStaging(session *serializer.UploadSession) *uploadStaging {
+	staging := &uploadStaging{
+		Location:  session.Staging,
+		PolicyID:  session.StagingPolicy,
+		ChunkSize: session.Policy.OptionsSerialized.ChunkSize,
+		Size:      session.Size,
+	}
+	if staging.Location == "" {
+		staging.Location = StagingAuto
+	}
+
+	return staging
+}
+
+// stagingFromContext 获取上下文中的暂存设定
+func stagingFromContext(ctx context.Context) *uploadStaging {
+	if staging, ok := ctx.Value(fsctx.UploadStagingCtx).(*uploadStaging); ok {
+		return staging
+	}
+
+	return &uploadStaging{Location: StagingAuto}
+}
+
+// isNativeAppend 返回分片是否直接追加至目标对象
+func (fs *FileSystem) isNativeAppend(staging *uploadStaging) bool {
+	if staging.Location != StagingAuto && staging.Location != StagingTarget {
+		return false
+	}
+
+	_, ok := fs.Handler.(driver.Appender)
+	return ok
+}
+
+// stagingHandler 返回存放暂存对象的存储端，分片直接追加或暂存于本机时返回 nil
+func (fs *FileSystem) stagingHandler(staging *uploadStaging) (driver.Handler, error) {
+	switch staging.Location {
+	case StagingTarget:
+		if fs.isNativeAppend(staging) {
+			return nil, nil
+		}
+		return fs.Handler, nil
+	case StagingPolicy:
+		policy, err := model.GetPolicyByID(staging.PolicyID)
+		if err != nil {
+			return nil, ErrStagingPolicyNotExist.WithError(err)
+		}
+
+		scratch := &FileSystem{Policy: &policy}
+		if err := scratch.DispatchHandler(); err != nil {
+			return nil, err
+		}
+		return scratch.Handler, nil
+	}
+
+	return nil, nil
+}
+
+// stagedChunkPath 返回 savePath 自 offset 起的分片的暂存对象路径
+func stagedChunkPath(savePath string, offset uint64) string {
+	return path.Join(stagingObjectDir, fmt.Sprintf("%x", sha1.Sum([]byte(savePath))), fmt.Sprintf("%020d", offset))
+}
+
+// stagedChunkPaths 按顺序返回 [from, size) 范围内各分片的暂存对象路径
+func stagedChunkPaths(savePath string, chunkSize, from, size uint64) []string {
+	if chunkSize == 0 {
+		if from == 0 {
+			return []string{stagedChunkPath(savePath, 0)}
+		}
+		return nil
+	}
+
+	paths := make([]string, 0)
+	for offset := from - from%chunkSize; offset < size || offset == 0; offset += chunkSize {
+		if offset >= from {
+			paths = append(paths, stagedChunkPath(savePath, offset))
+		}
+	}
+
+	return paths
+}
+
+// putStagedChunk 将分片存为暂存对象。重传分片时删除其后已暂存的分片
+func (fs *FileSystem) putStagedChunk(ctx context.Context, handler driver.Handler, staging *uploadStaging, file *fsctx.FileStream) error {
+	if later := stagedChunkPaths(file.SavePath, staging.ChunkSize, file.AppendStart+1, staging.Size); len(later) > 0 {
+		if _, err := handler.Delete(ctx, later); err != nil {
+			util.Log().Debug("Failed to delete later staged chunks of %q: %s", file.SavePath, err)
+		}
+	}
+
+	return handler.Put(ctx, &fsctx.FileStream{
+		File:     ioutil.NopCloser(file),
+		Size:     file.Size,
+		Name:     path.Base(file.SavePath),
+		SavePath: stagedChunkPath(file.SavePath, file.AppendStart),
+		Mode:     fsctx.Overwrite,
+	})
+}
+
+// truncateStagedChunks 删除自 size 起的暂存分片，用于回滚上传失败的分片
+func (fs *FileSystem) truncateStagedChunks(ctx context.Context, handler driver.Handler, staging *uploadStaging, savePath string, size uint64) error {
+	paths := stagedChunkPaths(savePath, staging.ChunkSize, size, staging.Size)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	_, err := handler.Delete(ctx, paths)
+	return err
+}
+
+// commitStagedChunks 依次读取暂存的分片写入目标存储端，成功后删除暂存对象，失败时保留，
+// 客户端可重传最后一个分片
+func (fs *FileSystem) commitStagedChunks(ctx context.Context, handler driver.Handler, staging *uploadStaging, fileHeader fsctx.FileHeader) error {
+	fileInfo := fileHeader.Info()
+	paths := stagedChunkPaths(fileInfo.SavePath, staging.ChunkSize, 0, staging.Size)
+	reader := &stagedChunkReader{ctx: ctx, handler: handler, paths: paths}
+	defer reader.Close()
+
+	hash := md5.New()
+	committed := &fsctx.FileStream{
+		File:         ioutil.NopCloser(io.TeeReader(reader, hash)),
+		Size:         staging.Size,
+		MIMEType:     fileInfo.MIMEType,
+		Name:         fileInfo.FileName,
+		VirtualPath:  fileInfo.VirtualPath,
+		SavePath:     fileInfo.SavePath,
+		Mode:         fsctx.Overwrite,
+		LastModified: fileInfo.LastModified,
+		StorageClass: fileInfo.StorageClass,
+		Tags:         fileInfo.Tags,
+	}
+	if err := fs.putObject(ctx, committed); err != nil {
+		return err
+	}
+
+	if err := recordShards(fileHeader, committed.Shards); err != nil {
+		return err
+	}
+
+	// 存储端确认了内容的校验值时，以合并时读取的内容计算 MD5，无需回读存储端
+	if checksum, ok := committed.Metadata[driver.ServerChecksumMetadataKey]; ok {
+		fileHeader.SetMetadata(committedMD5MetadataKey, hex.EncodeToString(hash.Sum(nil)))
+		if fileModel, ok := fileInfo.Model.(*model.File); ok {
+			if err := updateMetadataValue(fileModel, driver.ServerChecksumMetadataKey, checksum); err != nil {
+				util.Log().Warning("Failed to record server-side checksum of %q: %s", fileInfo.SavePath, err)
+			}
+		}
+	}
+
+	if _, err := handler.Delete(ctx, paths); err != nil {
+		util.Log().Warning("Failed to delete staged chunks of %q: %s", fileInfo.SavePath, err)
+	}
+
+	return nil
+}
+
+// discardStagedUpload 删除上传会话暂存的分片数据。会话已过期时按当前设置查找暂存位置，
+// 本机的追加缓冲文件总是会被删除
+func (fs *FileSystem) discardStagedUpload(ctx context.Context, file *model.File, session *serializer.UploadSession) {
+	if err := removeAppendBuffer(file.SourceName); err != nil {
+		util.Log().Warning("Failed to delete append buffer of %q: %s", file.SourceName, err)
+	}
+
+	var staging *uploadStaging
+	if session != nil {
+		staging = newUploadStaging(session)
+	} else {
+		location, policyID := uploadStagingSetting()
+		staging = &uploadStaging{Location: location, PolicyID: policyID}
+	}
+
+	// 仅暂存对象需要清理
+	if staging.Location != StagingTarget && staging.Location != StagingPolicy {
+		return
+	}
+
+	if session == nil {
+		staging.ChunkSize = file.GetPolicy().OptionsSerialized.ChunkSize
+	}
+	if staging.Size < file.Size {
+		staging.Size = file.Size
+	}
+
+	handler, err := fs.stagingHandler(staging)
+	if err != nil {
+		util.Log().Warning("Failed to get staging storage of %q: %s", file.SourceName, err)
+		return
+	}
+
+	if handler != nil {
+		if err := fs.truncateStagedChunks(ctx, handler, staging, file.SourceName, 0); err != nil {
+			util.Log().Warning("Failed to delete staged chunks of %q: %s", file.SourceName, err)
+		}
+	}
+}
+
+// stagedChunkReader 按顺序读取各暂存分片的内容
+type stagedChunkReader struct {
+	ctx     context.Context
+	handler driver.Handler
+	paths   []string
+	current io.ReadCloser
+}
+
+func (r *stagedChunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.paths) == 0 {
+				return 0, io.EOF
+			}
+
+			rs, err := r.handler.Get(r.ctx, r.paths[0])
+			if err != nil {
+				return 0, fmt.Errorf("failed to read staged chunk %q: %w", r.paths[0], err)
+			}
+			r.current = rs
+			r.paths = r.paths[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *stagedChunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
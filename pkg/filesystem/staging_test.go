@@ -0,0 +1,109 @@
+package filesystem
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/local"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// objectStore 不支持原生追加的存储端
+type objectStore struct {
+	driver.Handler
+}
+
+func TestUploadStagingSetting(t *testing.T) {
+	asserts := assert.New(t)
+	defer cache.Deletes([]string{"upload_staging", "upload_staging_policy"}, "setting_")
+
+	cache.Set("setting_upload_staging", "target", 0)
+	location, policyID := uploadStagingSetting()
+	asserts.Equal(StagingTarget, location)
+	asserts.EqualValues(0, policyID)
+
+	cache.Set("setting_upload_staging", "policy", 0)
+	cache.Set("setting_upload_staging_policy", "2", 0)
+	location, policyID = uploadStagingSetting()
+	asserts.Equal(StagingPolicy, location)
+	asserts.EqualValues(2, policyID)
+
+	// 未指定存储策略
+	cache.Set("setting_upload_staging_policy", "0", 0)
+	location, _ = uploadStagingSetting()
+	asserts.Equal(StagingAuto, location)
+
+	cache.Set("setting_upload_staging", "unknown", 0)
+	location, _ = uploadStagingSetting()
+	asserts.Equal(StagingAuto, location)
+}
+
+func TestStagedChunkPaths(t *testing.T) {
+	asserts := assert.New(t)
+
+	asserts.Equal([]string{
+		stagedChunkPath("a.txt", 0),
+		stagedChunkPath("a.txt", 3),
+		stagedChunkPath("a.txt", 6),
+	}, stagedChunkPaths("a.txt", 3, 0, 7))
+	asserts.Equal([]string{stagedChunkPath("a.txt", 6)}, stagedChunkPaths("a.txt", 3, 4, 7))
+	asserts.Empty(stagedChunkPaths("a.txt", 3, 7, 7))
+
+	// 未分片
+	asserts.Equal([]string{stagedChunkPath("a.txt", 0)}, stagedChunkPaths("a.txt", 0, 0, 7))
+	asserts.Empty(stagedChunkPaths("a.txt", 0, 1, 7))
+
+	// 空文件
+	asserts.Equal([]string{stagedChunkPath("a.txt", 0)}, stagedChunkPaths("a.txt", 3, 0, 0))
+}
+
+func TestFileSystem_StagedChunks(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_temp_path", "tests/temp", 0)
+	defer os.RemoveAll(util.RelativePath(stagingObjectDir))
+	defer os.Remove(util.RelativePath("TestAppend.txt"))
+
+	fs := &FileSystem{User: &model.User{}, Handler: objectStore{local.Driver{}}}
+	ctx := WithUploadStaging(context.Background(), &serializer.UploadSession{
+		Size:    7,
+		Staging: StagingTarget,
+		Policy:  model.Policy{OptionsSerialized: model.PolicyOption{ChunkSize: 3}},
+	})
+
+	asserts.NoError(fs.putChunk(ctx, appendChunk("123", 0)))
+	asserts.NoError(fs.putChunk(ctx, appendChunk("456", 3)))
+	asserts.True(util.Exists(util.RelativePath(stagedChunkPath("TestAppend.txt", 3))))
+	asserts.False(util.Exists(appendBufferPath("TestAppend.txt")))
+
+	// 回滚失败的分片
+	asserts.NoError(HookTruncateFileTo(3)(ctx, fs, appendChunk("", 3)))
+	asserts.False(util.Exists(util.RelativePath(stagedChunkPath("TestAppend.txt", 3))))
+
+	// 重传分片后合并
+	asserts.NoError(fs.putChunk(ctx, appendChunk("abc", 3)))
+	asserts.NoError(fs.putChunk(ctx, appendChunk("7", 6)))
+	asserts.NoError(HookCommitAppendBuffer(ctx, fs, appendChunk("", 0)))
+	content, err := ioutil.ReadFile(util.RelativePath("TestAppend.txt"))
+	asserts.NoError(err)
+	asserts.Equal("123abc7", string(content))
+	for _, chunk := range stagedChunkPaths("TestAppend.txt", 3, 0, 7) {
+		asserts.False(util.Exists(util.RelativePath(chunk)))
+	}
+
+	// 暂存的分片缺失
+	asserts.Error(HookCommitAppendBuffer(ctx, fs, appendChunk("", 0)))
+
+	// 原生追加的存储端
+	fs.Handler = local.Driver{}
+	asserts.True(fs.isNativeAppend(stagingFromContext(ctx)))
+	handler, err := fs.stagingHandler(stagingFromContext(ctx))
+	asserts.NoError(err)
+	asserts.Nil(handler)
+}
@@ -0,0 +1,220 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// 文件元数据中记录文本统计信息的键
+const (
+	TextEncodingMetadataKey  = "text_encoding"
+	TextLinesMetadataKey     = "text_lines"
+	TextWordsMetadataKey     = "text_words"
+	TextBytesMetadataKey     = "text_bytes"
+	TextBinaryMetadataKey    = "text_binary"
+	TextTruncatedMetadataKey = "text_truncated"
+)
+
+// binarySniffSize 判断是否为二进制文件时检查的文件头长度
+const binarySniffSize = 8000
+
+// isTextStatNeeded 返回是否需要统计文件的文本信息
+func isTextStatNeeded(name string) bool {
+	if !model.IsTrueVal(model.GetSettingByNameWithDefault("text_stat_enabled", "1")) {
+		return false
+	}
+
+	exts := strings.Split(strings.ToLower(model.GetSettingByName("text_stat_exts")), ",")
+	for i := range exts {
+		exts[i] = strings.TrimSpace(exts[i])
+	}
+	return IsInExtensionList(exts, name)
+}
+
+// ScanText 读取 r 中至多 limit 字节，检测字符编码并统计行数、词数。文件头中含有
+// 不可见控制字符时视为二进制内容，不再继续读取
+func ScanText(r io.Reader, limit int64) (*serializer.TextStat, error) {
+	head := make([]byte, binarySniffSize)
+	if limit < binarySniffSize {
+		head = head[:limit]
+	}
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	enc, bomLen := detectBOM(head)
+	if enc == "" && looksBinary(head) {
+		return &serializer.TextStat{Binary: true, Bytes: int64(n)}, nil
+	}
+
+	// 读取剩余部分，多读一字节用于判断是否超出上限
+	rest, err := io.ReadAll(io.LimitReader(r, limit-int64(n)+1))
+	if err != nil {
+		return nil, err
+	}
+	content := append(head, rest...)
+	stat := &serializer.TextStat{}
+	if int64(len(content)) > limit {
+		content = content[:limit]
+		stat.Truncated = true
+	}
+	stat.Bytes = int64(len(content))
+
+	if enc == "" {
+		enc = detectEncoding(content, stat.Truncated)
+	}
+	stat.Encoding = enc
+
+	decoded, err := decodeText(content[bomLen:], enc)
+	if err != nil {
+		return nil, err
+	}
+	stat.Lines, stat.Words = countText(decoded)
+	return stat, nil
+}
+
+// detectBOM 根据字节序标记识别编码，返回编码名称及标记长度
+func detectBOM(head []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8", 3
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return "utf-16le", 2
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return "utf-16be", 2
+	}
+	return "", 0
+}
+
+// looksBinary 文件头中含有 NUL 或较多不可见控制字符时视为二进制内容
+func looksBinary(head []byte) bool {
+	control := 0
+	for _, b := range head {
+		if b == 0 {
+			return true
+		}
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != '\b' && b != 0x1B {
+			control++
+		}
+	}
+	return len(head) > 0 && control*10 > len(head)
+}
+
+// detectEncoding 依次尝试 UTF-8、GB18030，均不符合时按 Windows-1252 处理。
+// 内容被截断时忽略末尾不完整的字符
+func detectEncoding(content []byte, truncated bool) string {
+	sample := content
+	if truncated {
+		for i := 0; i < utf8.UTFMax-1 && len(sample) > 0 && !utf8.Valid(sample); i++ {
+			sample = sample[:len(sample)-1]
+		}
+	}
+	if utf8.Valid(sample) {
+		return "utf-8"
+	}
+
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(sample)
+	if err == nil && !bytes.ContainsRune(decoded, utf8.RuneError) {
+		return "gb18030"
+	}
+
+	return "windows-1252"
+}
+
+// decodeText 将内容按给定编码转换为 UTF-8
+func decodeText(content []byte, enc string) ([]byte, error) {
+	var decoder encoding.Encoding
+	switch enc {
+	case "utf-16le":
+		decoder = xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM)
+	case "utf-16be":
+		decoder = xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM)
+	case "gb18030":
+		decoder = simplifiedchinese.GB18030
+	case "windows-1252":
+		decoder = charmap.Windows1252
+	default:
+		return content, nil
+	}
+	return decoder.NewDecoder().Bytes(content)
+}
+
+// countText 统计行数和以空白分隔的词数，末行没有换行符时也计为一行
+func countText(content []byte) (lines, words int) {
+	inWord := false
+	last := '\n'
+	for len(content) > 0 {
+		r, size := utf8.DecodeRune(content)
+		content = content[size:]
+		if r == '\n' {
+			lines++
+		}
+		if unicode.IsSpace(r) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			words++
+		}
+		last = r
+	}
+	if last != '\n' {
+		lines++
+	}
+	return
+}
+
+// ComputeTextStats 统计文本文件的编码、行数、词数并保存到文件元数据
+func (fs *FileSystem) ComputeTextStats(ctx context.Context, file *model.File) error {
+	source, err := fs.OpenObject(WithInternalRead(ctx), file)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	stat, err := ScanText(source, int64(model.GetIntSetting("text_stat_max_size", 4194304)))
+	if err != nil {
+		return err
+	}
+
+	meta := make(map[string]string, len(file.MetadataSerialized)+6)
+	for key, value := range file.MetadataSerialized {
+		meta[key] = value
+	}
+	meta[TextEncodingMetadataKey] = stat.Encoding
+	meta[TextLinesMetadataKey] = strconv.Itoa(stat.Lines)
+	meta[TextWordsMetadataKey] = strconv.Itoa(stat.Words)
+	meta[TextBytesMetadataKey] = strconv.FormatInt(stat.Bytes, 10)
+	meta[TextBinaryMetadataKey] = strconv.FormatBool(stat.Binary)
+	meta[TextTruncatedMetadataKey] = strconv.FormatBool(stat.Truncated)
+	return file.UpdateMetadata(meta)
+}
+
+// TextStatOf 返回文件元数据中记录的文本统计信息，未统计时返回 nil
+func TextStatOf(file *model.File) *serializer.TextStat {
+	meta := file.MetadataSerialized
+	if _, ok := meta[TextBinaryMetadataKey]; !ok {
+		return nil
+	}
+
+	stat := &serializer.TextStat{Encoding: meta[TextEncodingMetadataKey]}
+	stat.Lines, _ = strconv.Atoi(meta[TextLinesMetadataKey])
+	stat.Words, _ = strconv.Atoi(meta[TextWordsMetadataKey])
+	stat.Bytes, _ = strconv.ParseInt(meta[TextBytesMetadataKey], 10, 64)
+	stat.Binary, _ = strconv.ParseBool(meta[TextBinaryMetadataKey])
+	stat.Truncated, _ = strconv.ParseBool(meta[TextTruncatedMetadataKey])
+	return stat
+}
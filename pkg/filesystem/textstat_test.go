@@ -0,0 +1,172 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestScanText(t *testing.T) {
+	asserts := assert.New(t)
+
+	// UTF-8
+	{
+		stat, err := ScanText(strings.NewReader("hello world\n你好 世界"), 1024)
+		asserts.NoError(err)
+		asserts.Equal("utf-8", stat.Encoding)
+		asserts.Equal(2, stat.Lines)
+		asserts.Equal(4, stat.Words)
+		asserts.EqualValues(25, stat.Bytes)
+		asserts.False(stat.Binary)
+		asserts.False(stat.Truncated)
+	}
+
+	// 带 BOM 的 UTF-16
+	{
+		stat, err := ScanText(strings.NewReader("\xff\xfea\x00 \x00b\x00\n\x00"), 1024)
+		asserts.NoError(err)
+		asserts.Equal("utf-16le", stat.Encoding)
+		asserts.Equal(1, stat.Lines)
+		asserts.Equal(2, stat.Words)
+	}
+
+	// GB18030
+	{
+		stat, err := ScanText(strings.NewReader("\xc4\xe3\xba\xc3 \xca\xc0\xbd\xe7"), 1024)
+		asserts.NoError(err)
+		asserts.Equal("gb18030", stat.Encoding)
+		asserts.Equal(2, stat.Words)
+	}
+
+	// 其他单字节编码
+	{
+		stat, err := ScanText(strings.NewReader("caf\xe9 \xff"), 1024)
+		asserts.NoError(err)
+		asserts.Equal("windows-1252", stat.Encoding)
+	}
+
+	// 二进制
+	{
+		stat, err := ScanText(strings.NewReader("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 1024)
+		asserts.NoError(err)
+		asserts.True(stat.Binary)
+		asserts.Empty(stat.Encoding)
+		asserts.Zero(stat.Lines)
+	}
+
+	// 超出扫描上限，截断处的不完整字符不影响编码检测
+	{
+		stat, err := ScanText(strings.NewReader("一二三四"), 7)
+		asserts.NoError(err)
+		asserts.True(stat.Truncated)
+		asserts.EqualValues(7, stat.Bytes)
+		asserts.Equal("utf-8", stat.Encoding)
+		asserts.Equal(1, stat.Lines)
+	}
+
+	// 空文件
+	{
+		stat, err := ScanText(strings.NewReader(""), 1024)
+		asserts.NoError(err)
+		asserts.Zero(stat.Lines)
+		asserts.Zero(stat.Words)
+	}
+}
+
+func TestFileSystem_ComputeTextStats(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_text_stat_max_size", "1024", 0)
+
+	// 读取失败
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.txt").Return(MockRSC{}, errors.New("error"))
+		fs.Handler = testHandler
+		asserts.Error(fs.ComputeTextStats(context.Background(), &model.File{Name: "1.txt", SourceName: "1.txt"}))
+	}
+
+	// 成功，保留已有元数据
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.txt").
+			Return(MockRSC{rs: strings.NewReader("a b\nc\n")}, nil)
+		fs.Handler = testHandler
+		file := &model.File{
+			Model:              gorm.Model{ID: 1},
+			Name:               "1.txt",
+			SourceName:         "1.txt",
+			MetadataSerialized: map[string]string{"key": "value"},
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.ComputeTextStats(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal("value", file.MetadataSerialized["key"])
+
+		stat := TextStatOf(file)
+		asserts.NotNil(stat)
+		asserts.Equal("utf-8", stat.Encoding)
+		asserts.Equal(2, stat.Lines)
+		asserts.Equal(3, stat.Words)
+		asserts.EqualValues(6, stat.Bytes)
+	}
+
+	// 未统计
+	asserts.Nil(TextStatOf(&model.File{Name: "1.txt"}))
+}
+
+func TestHookComputeTextStats(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_text_stat_exts", "txt,md", 0)
+	cache.Set("setting_text_stat_max_size", "1024", 0)
+
+	// 未开启
+	{
+		cache.Set("setting_text_stat_enabled", "0", 0)
+		asserts.NoError(HookComputeTextStats(context.Background(), fs, &fsctx.FileStream{
+			Model: &model.File{Name: "1.txt"},
+		}))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	cache.Set("setting_text_stat_enabled", "1", 0)
+
+	// 非文本文件
+	{
+		asserts.NoError(HookComputeTextStats(context.Background(), fs, &fsctx.FileStream{
+			Model: &model.File{Name: "1.jpg"},
+		}))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 后台统计
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Get", testMock.Anything, "1.md").
+			Return(MockRSC{rs: strings.NewReader("# title")}, nil)
+		fs.Handler = testHandler
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.md", SourceName: "1.md"}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		waiter := &PostProcessWaiter{}
+		ctx := context.WithValue(context.Background(), fsctx.PostProcessWaiterCtx, waiter)
+		asserts.NoError(HookComputeTextStats(ctx, fs, &fsctx.FileStream{Model: file}))
+		asserts.True(waiter.Wait(time.Second))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal("1", file.MetadataSerialized[TextLinesMetadataKey])
+	}
+}
@@ -0,0 +1,150 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 缩略图缓存相关
+   ================
+*/
+
+// thumbTouchInterval 缩略图最后访问时间的最小更新间隔，避免每次访问都写入数据库
+const thumbTouchInterval = 10 * time.Minute
+
+// thumbEvictBatch 每批淘汰前检查的缩略图数量
+const thumbEvictBatch = 100
+
+// 文件内容更新后已过期缩略图的处理方式
+const (
+	// ThumbRefreshEager 删除旧缩略图并立即重新生成
+	ThumbRefreshEager = "eager"
+	// ThumbRefreshLazy 仅删除旧缩略图，再次访问时重新生成
+	ThumbRefreshLazy = "lazy"
+)
+
+// ThumbEvictResult 缩略图缓存淘汰的统计结果
+type ThumbEvictResult struct {
+	Evicted int    `json:"evicted"`
+	Freed   uint64 `json:"freed"`
+}
+
+// thumbCacheEnabled 返回是否开启缩略图缓存淘汰，关闭时缩略图永久保留
+func thumbCacheEnabled() bool {
+	return model.IsTrueVal(model.GetSettingByName("thumb_cache_enabled"))
+}
+
+// thumbPath 返回服务端为文件生成的缩略图的本机路径
+func thumbPath(file *model.File) string {
+	return util.RelativePath(file.SourceName + model.GetSettingByNameWithDefault("thumb_file_suffix", "._thumb"))
+}
+
+// recordThumbCache 记录新生成的缩略图大小及访问时间
+func recordThumbCache(file *model.File) {
+	if file.ID == 0 {
+		return
+	}
+
+	info, err := os.Stat(thumbPath(file))
+	if err != nil {
+		return
+	}
+
+	if err := file.UpdateThumbCache(uint64(info.Size())); err != nil {
+		util.Log().Warning("Failed to record thumb cache of file #%d: %s", file.ID, err)
+	}
+}
+
+// touchThumb 更新服务端生成的缩略图的最后访问时间
+func touchThumb(file *model.File) {
+	if file.ID == 0 || file.ThumbSize == 0 || !thumbCacheEnabled() {
+		return
+	}
+
+	now := time.Now()
+	if file.ThumbAccessedAt != nil && now.Sub(*file.ThumbAccessedAt) < thumbTouchInterval {
+		return
+	}
+
+	if err := file.TouchThumb(now); err != nil {
+		util.Log().Debug("Failed to update thumb access time of file #%d: %s", file.ID, err)
+	}
+}
+
+// EvictThumbnails 服务端生成的缩略图总大小超出设定的容量时，按最后访问时间从早到晚删除
+// 缩略图直至不超出容量，被删除的缩略图在再次访问时重新生成。未超出容量时不删除任何缩略图
+func EvictThumbnails() (ThumbEvictResult, error) {
+	var res ThumbEvictResult
+	if !thumbCacheEnabled() {
+		return res, nil
+	}
+
+	budget, err := strconv.ParseUint(model.GetSettingByName("thumb_cache_max_size"), 10, 64)
+	if err != nil {
+		return res, err
+	}
+
+	total, err := model.GetThumbCacheSize()
+	if err != nil {
+		return res, err
+	}
+
+	for total > budget {
+		files, err := model.GetThumbCacheCandidates(thumbEvictBatch)
+		if err != nil {
+			return res, err
+		}
+
+		if len(files) == 0 {
+			break
+		}
+
+		for i := 0; i < len(files) && total > budget; i++ {
+			size := files[i].ThumbSize
+			if err := os.Remove(thumbPath(&files[i])); err != nil && !os.IsNotExist(err) {
+				util.Log().Warning("Failed to delete thumb of file #%d: %s", files[i].ID, err)
+				return res, err
+			}
+
+			if err := files[i].ClearThumbCache(); err != nil {
+				return res, err
+			}
+
+			total -= size
+			res.Evicted++
+			res.Freed += size
+		}
+	}
+
+	return res, nil
+}
+
+// refreshThumb 文件内容更新后，按 thumb_refresh_on_update 设定以与上传相同的方式重新生成缩略图，
+// 或删除旧缩略图并清除缓存记录，由再次访问时重新生成。内容寻址的源对象路径改变时，
+// 旧路径的缩略图可能仍被其他文件使用，不做删除
+func (fs *FileSystem) refreshThumb(ctx context.Context, file *model.File, fileHeader fsctx.FileHeader) {
+	if fs.Policy == nil || !fs.Policy.IsThumbGenerateNeeded() || !IsInExtensionList(HandledExtension, file.Name) {
+		return
+	}
+
+	if savePath := fileHeader.Info().SavePath; savePath != "" {
+		file.SourceName = savePath
+	}
+
+	if model.GetSettingByNameWithDefault("thumb_refresh_on_update", ThumbRefreshEager) != ThumbRefreshLazy {
+		_ = HookGenerateThumb(ctx, fs, fileHeader)
+		return
+	}
+
+	_, _ = fs.Handler.Delete(ctx, []string{file.SourceName + model.GetSettingByNameWithDefault("thumb_file_suffix", "._thumb")})
+	if err := file.ClearThumbCache(); err != nil {
+		util.Log().Warning("Failed to invalidate thumb of file %q: %s", file.Name, err)
+	}
+}
@@ -0,0 +1,106 @@
+package filesystem
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTouchThumb(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_thumb_cache_enabled", "1", 0)
+	defer cache.Set("setting_thumb_cache_enabled", "0", 0)
+
+	// 最近访问过，不更新
+	{
+		recent := time.Now().Add(-time.Minute)
+		file := &model.File{Model: gorm.Model{ID: 1}, ThumbSize: 10, ThumbAccessedAt: &recent}
+		touchThumb(file)
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 超过更新间隔
+	{
+		old := time.Now().Add(-time.Hour)
+		file := &model.File{Model: gorm.Model{ID: 1}, ThumbSize: 10, ThumbAccessedAt: &old}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)thumb_accessed_at(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		touchThumb(file)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.True(file.ThumbAccessedAt.After(old))
+	}
+
+	// 未记录缩略图大小
+	{
+		touchThumb(&model.File{Model: gorm.Model{ID: 1}})
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
+
+func TestEvictThumbnails(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_thumb_file_suffix", "._thumb", 0)
+	cache.Set("setting_thumb_cache_max_size", "10", 0)
+
+	// 未开启
+	{
+		cache.Set("setting_thumb_cache_enabled", "0", 0)
+		res, err := EvictThumbnails()
+		asserts.NoError(err)
+		asserts.Zero(res.Evicted)
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	cache.Set("setting_thumb_cache_enabled", "1", 0)
+	defer cache.Set("setting_thumb_cache_enabled", "0", 0)
+
+	// 未超出容量
+	{
+		mock.ExpectQuery("SELECT(.+)thumb_size(.+)").WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(10))
+		res, err := EvictThumbnails()
+		asserts.NoError(err)
+		asserts.Zero(res.Evicted)
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 超出容量，按访问时间淘汰直至不超出
+	{
+		asserts.NoError(os.WriteFile(util.RelativePath("TestEvictThumbnails1.jpg._thumb"), []byte("thumb"), 0644))
+		asserts.NoError(os.WriteFile(util.RelativePath("TestEvictThumbnails2.jpg._thumb"), []byte("thumb"), 0644))
+		defer os.Remove(util.RelativePath("TestEvictThumbnails2.jpg._thumb"))
+
+		mock.ExpectQuery("SELECT(.+)thumb_size(.+)").WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(15))
+		mock.ExpectQuery("SELECT(.+)files(.+)ORDER BY(.+)thumb_accessed_at").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "source_name", "thumb_size"}).
+				AddRow(1, "TestEvictThumbnails1.jpg", 5).
+				AddRow(2, "TestEvictThumbnails2.jpg", 5))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		res, err := EvictThumbnails()
+		asserts.NoError(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(1, res.Evicted)
+		asserts.EqualValues(5, res.Freed)
+		asserts.False(util.Exists(util.RelativePath("TestEvictThumbnails1.jpg._thumb")))
+		asserts.True(util.Exists(util.RelativePath("TestEvictThumbnails2.jpg._thumb")))
+	}
+
+	// 无可淘汰的缩略图
+	{
+		mock.ExpectQuery("SELECT(.+)thumb_size(.+)").WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(15))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		res, err := EvictThumbnails()
+		asserts.NoError(err)
+		asserts.Zero(res.Evicted)
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
@@ -0,0 +1,175 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/transcode"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// transcodedSuffix 转码后的衍生文件相对原文件物理路径的后缀
+const transcodedSuffix = "._transcoded.mp4"
+
+// IsTranscodeNeeded 返回是否需要将文件转码为可在浏览器中播放的格式
+func IsTranscodeNeeded(name string) bool {
+	if !model.IsTrueVal(model.GetSettingByName("video_transcode_enabled")) {
+		return false
+	}
+
+	exts := strings.Split(strings.ToLower(model.GetSettingByName("video_transcode_exts")), ",")
+	for i := range exts {
+		exts[i] = strings.TrimSpace(exts[i])
+	}
+	return IsInExtensionList(exts, name)
+}
+
+// TranscodeVideo 使用 ffmpeg 将视频转码为 H.264/AAC 编码的 MP4 文件，与原文件保存在同一
+// 存储策略下，按设定作为预览使用的衍生文件或替换原文件。原视频已可在浏览器中播放时跳过，
+// 返回值表示是否跳过。转码失败时保持原文件不变
+func (fs *FileSystem) TranscodeVideo(ctx context.Context, file *model.File, progress func(percent int)) (bool, error) {
+	fs.Policy = file.GetPolicy()
+	if err := fs.DispatchHandler(); err != nil {
+		return false, err
+	}
+
+	timeout := time.Duration(model.GetIntSetting("video_transcode_timeout", 7200)) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tempDir := filepath.Join(
+		util.RelativePath(model.GetSettingByName("temp_path")),
+		"transcode",
+		fmt.Sprintf("%d_%d", file.ID, time.Now().UnixNano()),
+	)
+	if err := os.MkdirAll(tempDir, 0700); err != nil {
+		return false, fmt.Errorf("failed to create temp folder: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	input := filepath.Join(tempDir, "input"+filepath.Ext(file.Name))
+	if err := fs.downloadToTemp(ctx, file.SourceName, input); err != nil {
+		return false, err
+	}
+
+	info, err := transcode.Probe(ctx, model.GetSettingByName("video_transcode_ffprobe"), input)
+	if err != nil {
+		return false, err
+	}
+
+	if info.WebFriendly(filepath.Ext(file.Name)) {
+		return true, nil
+	}
+
+	output := filepath.Join(tempDir, "output.mp4")
+	if err := transcode.ToMP4(ctx, model.GetSettingByName("video_transcode_ffmpeg"), input, output, info.Duration, progress); err != nil {
+		return false, err
+	}
+
+	out, err := os.Open(output)
+	if err != nil {
+		return false, err
+	}
+	stat, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return false, err
+	}
+
+	savePath := file.SourceName + transcodedSuffix
+	if err := fs.Handler.Put(ctx, &fsctx.FileStream{
+		File:     out,
+		Seeker:   out,
+		Size:     uint64(stat.Size()),
+		Name:     filepath.Base(savePath),
+		MIMEType: "video/mp4",
+		SavePath: savePath,
+		Mode:     fsctx.Overwrite,
+	}); err != nil {
+		return false, fmt.Errorf("failed to save transcoded video: %w", err)
+	}
+
+	if model.IsTrueVal(model.GetSettingByName("video_transcode_replace")) {
+		return false, fs.replaceWithTranscoded(ctx, file, savePath, uint64(stat.Size()))
+	}
+
+	if err := file.UpdateTranscodedSource(savePath); err != nil {
+		_, _ = fs.Handler.Delete(ctx, []string{savePath})
+		return false, ErrDBUpdateObjects.WithError(err)
+	}
+
+	return false, nil
+}
+
+// downloadToTemp 将存储端的 source 保存至本机 dst，供 ffmpeg 读取
+func (fs *FileSystem) downloadToTemp(ctx context.Context, source, dst string) error {
+	rs, err := fs.Handler.Get(ctx, source)
+	if err != nil {
+		return ErrIO.WithError(err)
+	}
+	defer rs.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, rs); err != nil {
+		return ErrIO.WithError(err)
+	}
+
+	return nil
+}
+
+// replaceWithTranscoded 以转码后的文件替换原文件，原文件数据不再被其他文件引用时删除，
+// 扩展名改为 .mp4，目录下已有同名文件时保留原文件名
+func (fs *FileSystem) replaceWithTranscoded(ctx context.Context, file *model.File, savePath string, size uint64) error {
+	origin := *file
+	if err := file.UpdateSourceName(savePath); err != nil {
+		_, _ = fs.Handler.Delete(ctx, []string{savePath})
+		return ErrDBUpdateObjects.WithError(err)
+	}
+	file.SourceName = savePath
+
+	if err := file.UpdateSize(size); err != nil {
+		util.Log().Warning("Failed to update size of transcoded file %q: %s", file.Name, err)
+	}
+
+	if file.TranscodedSource != "" {
+		_, _ = fs.Handler.Delete(ctx, []string{file.TranscodedSource})
+		if err := file.UpdateTranscodedSource(""); err != nil {
+			util.Log().Warning("Failed to clear transcoded source of %q: %s", file.Name, err)
+		}
+	}
+
+	// 预生成的 HLS 分段位于原文件路径下
+	if file.HLSPlaylist != "" {
+		_, _ = fs.Handler.Delete(ctx, hlsSegmentObjects(&origin))
+		if err := file.UpdateHLSPlaylist(""); err != nil {
+			util.Log().Warning("Failed to clear HLS playlist of %q: %s", file.Name, err)
+		}
+	}
+
+	if !isContentAddressPath(origin.SourceName) {
+		if rest, err := model.RemoveFilesWithSoftLinks([]model.File{origin}); err == nil && len(rest) > 0 {
+			if _, err := fs.Handler.Delete(ctx, []string{origin.SourceName}); err != nil {
+				util.Log().Warning("Failed to delete original video %q: %s", origin.SourceName, err)
+			}
+		}
+	}
+
+	newName := strings.TrimSuffix(file.Name, filepath.Ext(file.Name)) + ".mp4"
+	if err := file.Rename(newName); err != nil {
+		util.Log().Info("Keep original name of transcoded file %q: %s", file.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTranscodeNeeded(t *testing.T) {
+	asserts := assert.New(t)
+
+	cache.Set("setting_video_transcode_enabled", "0", 0)
+	cache.Set("setting_video_transcode_exts", "mkv, AVI", 0)
+	asserts.False(IsTranscodeNeeded("1.mkv"))
+
+	cache.Set("setting_video_transcode_enabled", "1", 0)
+	defer cache.Set("setting_video_transcode_enabled", "0", 0)
+	asserts.True(IsTranscodeNeeded("1.mkv"))
+	asserts.True(IsTranscodeNeeded("1.avi"))
+	asserts.False(IsTranscodeNeeded("1.mp4"))
+	asserts.False(IsTranscodeNeeded("mkv"))
+}
+
+func TestFileSystem_TranscodeVideo(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	cache.Set("setting_temp_path", "temp", 0)
+	cache.Set("setting_video_transcode_timeout", "60", 0)
+	cache.Set("setting_video_transcode_ffprobe", "/nonexistent/ffprobe", 0)
+	file := &model.File{
+		Model:      gorm.Model{ID: 1},
+		Name:       "video.mkv",
+		SourceName: "TestFileSystem_TranscodeVideo.mkv",
+		Policy:     model.Policy{Model: gorm.Model{ID: 1}, Type: "local"},
+	}
+
+	// 源文件不存在
+	{
+		skipped, err := fs.TranscodeVideo(context.Background(), file, nil)
+		asserts.False(skipped)
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeIOFailed, err.(serializer.AppError).Code)
+		asserts.Empty(file.TranscodedSource)
+	}
+
+	// ffprobe 执行失败，原文件保持不变
+	{
+		asserts.NoError(os.WriteFile(util.RelativePath(file.SourceName), []byte("video"), 0644))
+		defer os.Remove(util.RelativePath(file.SourceName))
+		skipped, err := fs.TranscodeVideo(context.Background(), file, nil)
+		asserts.False(skipped)
+		asserts.Error(err)
+		asserts.Empty(file.TranscodedSource)
+		asserts.False(util.Exists(util.RelativePath(file.SourceName + transcodedSuffix)))
+
+		// 临时文件已清理
+		entries, _ := os.ReadDir(filepath.Join(util.RelativePath("temp"), "transcode"))
+		asserts.Len(entries, 0)
+	}
+}
@@ -0,0 +1,190 @@
+package filesystem
+
+import (
+	"context"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 回收站相关
+   ================
+*/
+
+// TrashPurgeResult 一次清理回收站的结果
+type TrashPurgeResult struct {
+	Purged int
+	Failed int
+}
+
+// TrashOnOverwrite 返回存储策略或用户组是否要求上传覆盖已有文件时将原文件移入回收站
+func (fs *FileSystem) TrashOnOverwrite() bool {
+	if fs.Policy != nil && fs.Policy.OptionsSerialized.TrashOnOverwrite {
+		return true
+	}
+	return fs.User != nil && fs.User.Group.OptionsSerialized.TrashOnOverwrite
+}
+
+// trashRetention 返回文件在回收站中的保留时长
+func trashRetention() time.Duration {
+	return time.Duration(model.GetIntSetting("trash_retention_days", 30)) * 24 * time.Hour
+}
+
+// TrashFile 将文件移入回收站，同时删除其分享，文件不再作为目录封面。
+// uploadSessionID 为覆盖此文件的上传会话，会话未完成时可据此恢复
+func (fs *FileSystem) TrashFile(ctx context.Context, file *model.File, uploadSessionID *string) (*model.Trash, error) {
+	if err := fs.CheckRetention(ctx, []model.File{*file}, "delete"); err != nil {
+		return nil, err
+	}
+
+	trash, err := file.MoveToTrash(trashRetention(), uploadSessionID)
+	if err != nil {
+		return nil, ErrDBUpdateObjects.WithError(err)
+	}
+
+	model.DeleteShareBySourceIDs([]uint{file.ID}, false)
+	refreshDeletedCovers([]uint{file.ID})
+	return trash, nil
+}
+
+// HookRestoreTrash 上传 uploaded 失败时从回收站恢复被其覆盖的文件。批量上传中各文件共用钩子，
+// 其他文件的失败不会触发恢复
+func HookRestoreTrash(trash *model.Trash, uploaded fsctx.FileHeader) Hook {
+	return func(ctx context.Context, fs *FileSystem, fileHeader fsctx.FileHeader) error {
+		if fileHeader != uploaded {
+			return nil
+		}
+
+		return fs.restoreTrash(trash)
+	}
+}
+
+// RestoreTrashedFile 将回收站中的文件恢复至原目录
+func (fs *FileSystem) RestoreTrashedFile(ctx context.Context, fileID uint) error {
+	trash, err := model.GetTrashByFileID(fileID, fs.User.ID)
+	if err != nil {
+		return ErrObjectNotExist.WithError(err)
+	}
+
+	return fs.restoreTrash(trash)
+}
+
+// restoreUploadSessionTrash 上传会话取消、过期或占位文件被删除时，恢复被此会话覆盖的文件
+func (fs *FileSystem) restoreUploadSessionTrash(sessionID string) {
+	trash, err := model.GetTrashByUploadSession(sessionID, fs.User.ID)
+	if err != nil {
+		return
+	}
+
+	if err := fs.restoreTrash(trash); err != nil {
+		util.Log().Warning("Failed to restore file %q overwritten by upload session %q: %s", trash.Name, sessionID, err)
+	}
+}
+
+// restoreTrash 将回收站中的文件恢复至原目录，原目录已不存在时恢复至根目录，
+// 原文件名已被占用时按版本序号重命名
+func (fs *FileSystem) restoreTrash(trash *model.Trash) error {
+	var parent *model.Folder
+	if folders, err := model.GetFoldersByIDs([]uint{trash.FolderID}, trash.UserID); err == nil && len(folders) > 0 {
+		parent = &folders[0]
+	} else {
+		root, err := fs.User.Root()
+		if err != nil {
+			return ErrObjectNotExist.WithError(err)
+		}
+		parent = root
+	}
+
+	name := trash.Name
+	if exist, _ := fs.IsChildFileExist(parent, name); exist {
+		var ok bool
+		if name, ok = fs.availableFileName(parent, trash.Name, "%s.v%d%s"); !ok {
+			return ErrFileExisted
+		}
+	}
+
+	if err := trash.Restore(parent.ID, name); err != nil {
+		return ErrDBUpdateObjects.WithError(err)
+	}
+
+	return nil
+}
+
+// PurgeExpiredTrash 永久删除回收站中已过期的文件及其存储端数据，至多处理 limit 个
+func PurgeExpiredTrash(ctx context.Context, limit int) (TrashPurgeResult, error) {
+	res := TrashPurgeResult{}
+	trashes, err := model.GetExpiredTrash(time.Now(), limit)
+	if err != nil {
+		return res, ErrDBListObjects.WithError(err)
+	}
+
+	// 按用户分组，以所有者身份处理
+	userToTrashes := make(map[uint][]model.Trash)
+	for _, trash := range trashes {
+		userToTrashes[trash.UserID] = append(userToTrashes[trash.UserID], trash)
+	}
+
+	for uid, userTrashes := range userToTrashes {
+		user, err := model.GetUserByID(uid)
+		if err != nil {
+			util.Log().Warning("Owner of trashed files cannot be found: %s", err)
+			res.Failed += len(userTrashes)
+			continue
+		}
+
+		fs, err := NewFileSystem(&user)
+		if err != nil {
+			util.Log().Warning("Failed to initialize filesystem: %s", err)
+			res.Failed += len(userTrashes)
+			continue
+		}
+
+		for i := range userTrashes {
+			if err := fs.purgeTrash(ctx, &userTrashes[i]); err != nil {
+				util.Log().Warning("Failed to purge trashed file %q: %s", userTrashes[i].Name, err)
+				res.Failed++
+				continue
+			}
+			res.Purged++
+		}
+
+		fs.Recycle()
+	}
+
+	return res, nil
+}
+
+// purgeTrash 永久删除回收站中的文件，仍被其他文件引用的存储端数据予以保留
+func (fs *FileSystem) purgeTrash(ctx context.Context, trash *model.Trash) error {
+	file, err := trash.TrashedFile()
+	if err != nil {
+		// 文件记录已不存在，仅清理回收站记录
+		return trash.Delete()
+	}
+
+	// 删除内容寻址的对象时，避免同时有新上传的文件引用此对象
+	if isContentAddressPath(file.SourceName) {
+		contentAddressLock.Lock()
+		defer contentAddressLock.Unlock()
+	}
+
+	filesToBeDelete, err := model.RemoveFilesWithSoftLinks([]model.File{*file})
+	if err != nil {
+		return ErrDBListObjects.WithError(err)
+	}
+
+	failed := fs.deleteGroupedFile(ctx, fs.GroupFileByPolicy(ctx, filesToBeDelete))
+	if util.ContainsString(failed[file.PolicyID], file.SourceName) {
+		return serializer.NewError(serializer.CodeNotFullySuccess, "Failed to delete file data", nil)
+	}
+
+	if err := model.DeleteFiles([]*model.File{file}, file.UserID); err != nil {
+		return ErrDBDeleteObjects.WithError(err)
+	}
+
+	return trash.Delete()
+}
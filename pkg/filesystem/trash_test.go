@@ -0,0 +1,176 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem_TrashOnOverwrite(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+
+	asserts.False(fs.TrashOnOverwrite())
+
+	fs.Policy = &model.Policy{}
+	fs.Policy.OptionsSerialized.TrashOnOverwrite = true
+	asserts.True(fs.TrashOnOverwrite())
+
+	fs.Policy.OptionsSerialized.TrashOnOverwrite = false
+	fs.User.Group.OptionsSerialized.TrashOnOverwrite = true
+	asserts.True(fs.TrashOnOverwrite())
+}
+
+func TestFileSystem_RestoreTrashedFile(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+	ctx := context.Background()
+
+	// 不在回收站中
+	{
+		mock.ExpectQuery("SELECT(.+)trashes(.+)").WithArgs(2, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		asserts.Error(fs.RestoreTrashedFile(ctx, 2))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 原文件名已被占用，按版本序号重命名
+	{
+		mock.ExpectQuery("SELECT(.+)trashes(.+)").WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "file_id", "folder_id", "name"}).AddRow(5, 1, 2, 3, "a.txt"))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(3, 1))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(3, "a.txt").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+		mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(3, "a.v1.txt").
+			WillReturnError(errors.New("not found"))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs(3, "a.v1.txt", nil, nil, 2).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("DELETE(.+)trashes(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.RestoreTrashedFile(ctx, 2))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
+
+func TestHookRestoreTrash(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+	trash := &model.Trash{UserID: 1, FileID: 2, FolderID: 3, Name: "a.txt"}
+	uploaded := &fsctx.FileStream{}
+
+	// 批量上传中其他文件失败，不恢复
+	asserts.NoError(HookRestoreTrash(trash, uploaded)(context.Background(), fs, &fsctx.FileStream{}))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 原目录已不存在，恢复至根目录
+	mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT(.+)folders(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+	mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(1, "a.txt").
+		WillReturnError(errors.New("not found"))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs(1, "a.txt", nil, nil, 2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE(.+)trashes(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(HookRestoreTrash(trash, uploaded)(context.Background(), fs, uploaded))
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
+func TestFileSystem_Delete_RestoreUploadSessionTrash(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("policy_93", model.Policy{Type: "mock"}, -1)
+	defer cache.Deletes([]string{"93"}, "policy_")
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}, Handler: newMemoryDriver()}
+
+	// 删除未完成上传的占位文件
+	mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "source_name", "policy_id", "user_id", "folder_id", "size", "upload_session_id"}).
+			AddRow(5, "a.txt", "a.txt", 93, 1, 3, 1, "session"))
+	mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE(.+)files(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE(.+)users(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE(.+)type_usages(.+)").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)shares(.+)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// 恢复被此会话覆盖的文件
+	mock.ExpectQuery("SELECT(.+)trashes(.+)").WithArgs("session", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "file_id", "folder_id", "name"}).AddRow(4, 1, 2, 3, "a.txt"))
+	mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(3, 1))
+	mock.ExpectQuery("SELECT(.+)files(.+)").WithArgs(3, "a.txt").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs(3, "a.txt", sqlmock.AnyArg(), nil, 2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE(.+)trashes(.+)").WithArgs(4).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE(.+)folders(.+)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)shares(.+)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	asserts.NoError(fs.Delete(context.Background(), []uint{}, []uint{5}, false))
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
+func TestFileSystem_RestoreUploadSessionTrash(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+
+	// 会话未覆盖任何文件
+	mock.ExpectQuery("SELECT(.+)trashes(.+)").WithArgs("session", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	fs.restoreUploadSessionTrash("session")
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
+func TestFileSystem_PurgeTrash(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+	trash := &model.Trash{UserID: 1, FileID: 2}
+	trash.ID = 5
+
+	// 文件记录已不存在，仅删除回收站记录
+	mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE(.+)trashes(.+)").WithArgs(5).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	asserts.NoError(fs.purgeTrash(context.Background(), trash))
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 列出失败
+	{
+		mock.ExpectQuery("SELECT(.+)trashes(.+)").WillReturnError(errors.New("error"))
+		_, err := PurgeExpiredTrash(context.Background(), 10)
+		asserts.Error(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 所有者不存在
+	{
+		mock.ExpectQuery("SELECT(.+)trashes(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "file_id"}).AddRow(1, 1, 2).AddRow(2, 1, 3))
+		mock.ExpectQuery("SELECT(.+)users(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		res, err := PurgeExpiredTrash(context.Background(), 10)
+		asserts.NoError(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(TrashPurgeResult{Failed: 2}, res)
+	}
+}
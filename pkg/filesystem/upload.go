@@ -2,9 +2,15 @@ package filesystem
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 	"path"
+	"strings"
 	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
@@ -27,10 +33,13 @@ const (
 	UploadSessionCtx         = "uploadSession"
 	UserCtx                  = "user"
 	UploadSessionCachePrefix = "callback_"
+	UploadSessionDonePrefix  = "upload_done_"
 )
 
 // Upload 上传文件
 func (fs *FileSystem) Upload(ctx context.Context, file *fsctx.FileStream) (err error) {
+	fs.applyUploadDefaults(file)
+
 	// 上传前的钩子
 	err = fs.Trigger(ctx, "BeforeUpload", file)
 	if err != nil {
@@ -38,11 +47,17 @@ func (fs *FileSystem) Upload(ctx context.Context, file *fsctx.FileStream) (err e
 		return err
 	}
 
+	// 严格模式下目标目录需已存在
+	if err = fs.validateUploadTarget(file); err != nil {
+		request.BlackHole(file)
+		return err
+	}
+
 	// 生成文件名和路径,
 	var savePath string
 	if file.SavePath == "" {
-		// 如果是更新操作就从上下文中获取
-		if originFile, ok := ctx.Value(fsctx.FileModelCtx).(model.File); ok {
+		// 如果是更新操作就从上下文中获取，内容寻址的对象可能被其他文件引用，不能覆盖
+		if originFile, ok := ctx.Value(fsctx.FileModelCtx).(model.File); ok && !fs.contentAddressable() {
 			savePath = originFile.SourceName
 		} else {
 			savePath = fs.GenerateSavePath(ctx, file)
@@ -55,22 +70,44 @@ func (fs *FileSystem) Upload(ctx context.Context, file *fsctx.FileStream) (err e
 		// 处理客户端未完成上传时，关闭连接
 		go fs.CancelUpload(ctx, savePath, file)
 
-		err = fs.Handler.Put(ctx, file)
+		written, digest, err := fs.put(ctx, file)
 		if err != nil {
 			fs.Trigger(ctx, "AfterUploadFailed", file)
 			return err
 		}
+
+		// 实际写入的大小与声明不符时删除已保存的内容
+		if written != file.Size {
+			fs.discardMismatchedUpload(ctx, file)
+			return ErrFileSizeMismatch.WithData(map[string]uint64{
+				"declared": file.Size,
+				"actual":   written,
+			})
+		}
+
+		// 内容寻址策略下移至内容哈希对应的路径
+		if fs.contentAddressable() && file.Mode&fsctx.Append == 0 {
+			// 文件记录在 AfterUpload 中提交后，释放相同内容的存放锁
+			src := file.SavePath
+			defer func() { fs.releaseContentAddressLock(file.SavePath, src) }()
+			if err := fs.contentAddress(ctx, file, digest); err != nil {
+				fs.Trigger(ctx, "AfterValidateFailed", file)
+				return err
+			}
+		}
 		gMD5, err := generateFileMD5(ctx, file.SavePath)
 		if err != nil {
 			util.Log().Error("generateFileMD5 failed:", err)
 		}
-		f := file.Model.(*model.File)
-		f.MD5 = gMD5
-		fmt.Println("MD5 ", gMD5)
+		// 新文件的记录在 AfterUpload 中才创建
+		if f, ok := file.Model.(*model.File); ok {
+			f.MD5 = gMD5
+			fmt.Println("MD5 ", gMD5)
 
-		err = f.UpdateMD5(gMD5)
-		if err != nil {
-			util.Log().Error("save md5 failed:", err)
+			err = f.UpdateMD5(gMD5)
+			if err != nil {
+				util.Log().Error("save md5 failed:", err)
+			}
 		}
 	}
 
@@ -91,10 +128,11 @@ func (fs *FileSystem) Upload(ctx context.Context, file *fsctx.FileStream) (err e
 	if file.Mode&fsctx.Overwrite == 0 {
 		fileInfo := file.Info()
 		util.Log().Info(
-			"新文件PUT:%s , 大小:%d, 上传者:%s",
+			"新文件PUT:%s , 大小:%d, 上传者:%s, 客户端:%s",
 			fileInfo.FileName,
 			fileInfo.Size,
 			fs.User.Nick,
+			uploadClientFromContext(ctx),
 		)
 	}
 	fmt.Println("save path ", file.SavePath)
@@ -102,6 +140,105 @@ func (fs *FileSystem) Upload(ctx context.Context, file *fsctx.FileStream) (err e
 	return nil
 }
 
+// put 将文件保存到存储端，返回存储端实际读取的字节数。读取量等于声明的大小时
+// 再尝试读取一个字节，以发现超出声明大小的内容。存储策略开启内容寻址时同时计算
+// 内容的 SHA-256 哈希，存储端未按顺序完整读取时哈希为空。存储端不支持流式上传时，
+// 较大的内容会先写入缓冲文件
+func (fs *FileSystem) put(ctx context.Context, file *fsctx.FileStream) (uint64, string, error) {
+	cleanup, err := fs.spoolUpload(file)
+	if err != nil {
+		return 0, "", err
+	}
+	defer cleanup()
+
+	counter := &countingReader{reader: file.File}
+	if fs.contentAddressable() {
+		counter.hash = sha256.New()
+	}
+	if file.File != nil {
+		file.File = counter
+	}
+	if file.Seeker != nil {
+		counter.seeker = file.Seeker
+		file.Seeker = counter
+	}
+
+	if file.Mode&fsctx.Append == fsctx.Append {
+		err = fs.putChunk(ctx, file)
+	} else {
+		err = fs.putObject(ctx, file)
+	}
+	if err != nil {
+		return counter.max, "", err
+	}
+
+	if counter.pos == file.Size && file.File != nil {
+		var probe [1]byte
+		io.ReadFull(counter, probe[:])
+	}
+
+	digest := ""
+	if counter.hash != nil && counter.hashed == counter.max {
+		digest = hex.EncodeToString(counter.hash.Sum(nil))
+	}
+
+	return counter.max, digest, nil
+}
+
+// discardMismatchedUpload 删除实际大小与声明不符的上传内容，
+// 追加上传时交由 AfterValidateFailed 钩子回滚本次写入的部分
+func (fs *FileSystem) discardMismatchedUpload(ctx context.Context, file *fsctx.FileStream) {
+	if file.Mode&fsctx.Append == fsctx.Append {
+		if err := fs.Trigger(ctx, "AfterValidateFailed", file); err != nil {
+			util.Log().Debug("AfterValidateFailed hook execution failed: %s", err)
+		}
+		return
+	}
+
+	if _, err := fs.Handler.Delete(ctx, append([]string{file.SavePath}, shardObjects(file.Shards)...)); err != nil {
+		util.Log().Warning("Failed to delete upload with mismatched size: %s", err)
+	}
+}
+
+// countingReader 记录存储端读取到的位置，存储端重新定位后重读的部分不会重复计数。
+// hash 不为空时对从头开始连续读取的内容计算哈希
+type countingReader struct {
+	reader io.Reader
+	seeker io.Seeker
+	pos    uint64
+	max    uint64
+	hash   hash.Hash
+	hashed uint64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if r.hash != nil && r.pos <= r.hashed && r.hashed < r.pos+uint64(n) {
+		r.hash.Write(p[r.hashed-r.pos : n])
+		r.hashed = r.pos + uint64(n)
+	}
+	r.pos += uint64(n)
+	if r.pos > r.max {
+		r.max = r.pos
+	}
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	if closer, ok := r.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (r *countingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.seeker.Seek(offset, whence)
+	if err == nil {
+		r.pos = uint64(pos)
+	}
+	return pos, err
+}
+
 // GenerateSavePath 生成要存放文件的路径
 // TODO 完善测试
 func (fs *FileSystem) GenerateSavePath(ctx context.Context, file fsctx.FileHeader) string {
@@ -138,16 +275,73 @@ func (fs *FileSystem) CancelUpload(ctx context.Context, path string, file fsctx.
 		default:
 			// 客户端取消上传，删除临时文件
 			util.Log().Debug("Client canceled upload.")
-			if fs.Hooks["AfterUploadCanceled"] == nil {
-				return
-			}
-			err := fs.Trigger(ctx, "AfterUploadCanceled", file)
-			if err != nil {
-				util.Log().Debug("AfterUploadCanceled hook execution failed: %s", err)
-			}
+			fs.triggerUploadCanceled(ctx, file)
+		}
+	case <-ctx.Done():
+		// 超出上传时限
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			util.Log().Debug("Upload exceeded deadline, canceled.")
+			fs.triggerUploadCanceled(ctx, file)
 		}
+	}
+}
+
+func (fs *FileSystem) triggerUploadCanceled(ctx context.Context, file fsctx.FileHeader) {
+	if fs.Hooks["AfterUploadCanceled"] == nil {
+		return
+	}
+	err := fs.Trigger(ctx, "AfterUploadCanceled", file)
+	if err != nil {
+		util.Log().Debug("AfterUploadCanceled hook execution failed: %s", err)
+	}
+}
+
+// UploadDeadline 根据声明的文件大小计算上传允许的最长时间，为基础时长加上按最低速率
+// 传输完整个文件所需的时长；基础时长设为 0 时不限制，返回 0
+func UploadDeadline(size uint64) time.Duration {
+	base := model.GetIntSetting("upload_deadline_base", 600)
+	if base <= 0 {
+		return 0
+	}
+
+	deadline := time.Duration(base) * time.Second
+	if minSpeed := model.GetIntSetting("upload_deadline_min_speed", 10240); minSpeed > 0 {
+		deadline += time.Duration(size/uint64(minSpeed)) * time.Second
+	}
+
+	return deadline
+}
+
+// WithUploadDeadline 返回带有上传时限的上下文，未设定时限时仅可取消
+func WithUploadDeadline(ctx context.Context, size uint64) (context.Context, context.CancelFunc) {
+	if deadline := UploadDeadline(size); deadline > 0 {
+		return context.WithTimeout(ctx, deadline)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// contextReader 上下文结束后读取返回错误，使存储端的写入能够及时中止
+type contextReader struct {
+	ctx    context.Context
+	reader io.ReadCloser
+}
 
+// NewContextReader 包装请求正文，上下文超时或取消后读取将返回上下文的错误。
+// 已阻塞的读取仍需等待下一批数据或服务器读超时才会返回
+func NewContextReader(ctx context.Context, reader io.ReadCloser) io.ReadCloser {
+	return &contextReader{ctx: ctx, reader: reader}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
 	}
+	return r.reader.Read(p)
+}
+
+func (r *contextReader) Close() error {
+	return r.reader.Close()
 }
 
 // CreateUploadSession 创建上传会话
@@ -165,8 +359,23 @@ func (fs *FileSystem) CreateUploadSession(ctx context.Context, file *fsctx.FileS
 	}
 
 	fs.Use("BeforeUpload", HookValidateFile)
+	fs.Use("BeforeUpload", HookValidateUniqueName)
+	if min := fs.MinFileSize(); min > 0 {
+		fs.Use("BeforeUpload", HookValidateMinFileSize(min))
+	}
+	if windows, loc := fs.UploadWindows(); len(windows) > 0 {
+		fs.Use("BeforeUpload", HookValidateUploadWindow(windows, loc))
+	}
+	if IsUploadRegionPolicyEnabled() {
+		fs.Use("BeforeUpload", HookValidateUploadRegion)
+	}
 	fs.Use("BeforeUpload", HookValidateCapacity)
 
+	// 直传存储端的上传无法检查内容是否已加密，从机策略由从机上传分片时检查
+	if fs.Policy.OptionsSerialized.EncryptedOnly && fs.Policy.Type != "local" && fs.Policy.Type != "remote" {
+		return nil, ErrEncryptionUnenforceable
+	}
+
 	// 验证文件规格
 	if err := fs.Upload(ctx, file); err != nil {
 		return nil, err
@@ -183,6 +392,24 @@ func (fs *FileSystem) CreateUploadSession(ctx context.Context, file *fsctx.FileS
 		LastModified:   file.LastModified,
 		CallbackSecret: util.RandStringRunes(32),
 	}
+	uploadSession.Staging, uploadSession.StagingPolicy = uploadStagingSetting()
+
+	// 将上传会话绑定到客户端 IP
+	if model.IsTrueVal(model.GetSettingByName("upload_session_bind_ip")) {
+		if clientIP, ok := ctx.Value(fsctx.ClientIPCtx).(string); ok {
+			uploadSession.ClientIP = clientIP
+		}
+	}
+
+	// 记录客户端声明的完整文件校验值，上传完成时校验
+	if checksum, ok := ctx.Value(fsctx.UploadChecksumCtx).(string); ok {
+		uploadSession.MD5 = strings.ToLower(checksum)
+	}
+
+	// 记录本次上传指定的默认权限，上传完成时应用
+	if permission, ok := ctx.Value(fsctx.UploadPermissionCtx).(string); ok {
+		uploadSession.Permission = permission
+	}
 
 	// 获取上传凭证
 	credential, err := fs.Handler.Token(ctx, int64(callBackSessionTTL), uploadSession, file)
@@ -194,13 +421,18 @@ func (fs *FileSystem) CreateUploadSession(ctx context.Context, file *fsctx.FileS
 	if !fs.Policy.IsUploadPlaceholderWithSize() {
 		fs.Use("AfterUpload", HookClearFileHeaderSize)
 	}
+	fs.Use("BeforeAddFile", HookValidateFileCount)
 	fs.Use("AfterUpload", GenericAfterUpload)
 	ctx = context.WithValue(ctx, fsctx.IgnoreDirectoryConflictCtx, true)
 	if err := fs.Upload(ctx, file); err != nil {
 		return nil, err
 	}
 
+	// 文件名可能因目录的重名处理方式而变更
+	uploadSession.Name = file.Name
+
 	// 创建回调会话
+	uploadSession.Expires = time.Now().Add(time.Duration(callBackSessionTTL) * time.Second).Unix()
 	err = cache.Set(
 		UploadSessionCachePrefix+callbackKey,
 		*uploadSession,
@@ -211,11 +443,107 @@ func (fs *FileSystem) CreateUploadSession(ctx context.Context, file *fsctx.FileS
 	}
 
 	// 补全上传凭证其他信息
-	credential.Expires = time.Now().Add(time.Duration(callBackSessionTTL) * time.Second).Unix()
+	credential.Expires = uploadSession.Expires
 
 	return credential, nil
 }
 
+// uploadSessionTTL 返回上传会话的剩余有效秒数，未记录过期时间的会话视为已过期
+func uploadSessionTTL(session *serializer.UploadSession) int {
+	return int(session.Expires - time.Now().Unix())
+}
+
+// RestoreUploadSession 将已被回调取走的上传会话放回缓存，用于对象尚未在存储端
+// 可见等可重试的失败，使客户端或存储端之后的回调仍能完成上传
+func RestoreUploadSession(session *serializer.UploadSession) error {
+	ttl := uploadSessionTTL(session)
+	if ttl <= 0 {
+		return ErrUploadSessionExpired
+	}
+
+	return cache.Set(UploadSessionCachePrefix+session.Key, *session, ttl)
+}
+
+// MarkUploadSessionDone 记录上传会话已完成并创建了文件，客户端与存储端的回调可能
+// 先后到达，之后到达的回调据此直接返回成功
+func MarkUploadSessionDone(session *serializer.UploadSession) error {
+	ttl := uploadSessionTTL(session)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return cache.Set(UploadSessionDonePrefix+session.Key, session.UID, ttl)
+}
+
+// IsUploadSessionDone 返回上传会话是否已完成
+func IsUploadSessionDone(sessionID string) bool {
+	_, ok := cache.Get(UploadSessionDonePrefix + sessionID)
+	return ok
+}
+
+// CreateUploadPlaceholder 校验文件信息并创建上传会话的占位文件，供由服务端写入内容的上传使用，
+// 占位文件的容量处理与客户端上传会话一致
+func (fs *FileSystem) CreateUploadPlaceholder(ctx context.Context, file *fsctx.FileStream) (*model.File, error) {
+	sessionID := uuid.Must(uuid.NewV4()).String()
+	file.Mode = fsctx.Nop
+	file.UploadSessionID = &sessionID
+
+	fs.Use("BeforeUpload", HookValidateFile)
+	fs.Use("BeforeUpload", HookValidateUniqueName)
+	if min := fs.MinFileSize(); min > 0 {
+		fs.Use("BeforeUpload", HookValidateMinFileSize(min))
+	}
+	if windows, loc := fs.UploadWindows(); len(windows) > 0 {
+		fs.Use("BeforeUpload", HookValidateUploadWindow(windows, loc))
+	}
+	if IsUploadRegionPolicyEnabled() {
+		fs.Use("BeforeUpload", HookValidateUploadRegion)
+	}
+	fs.Use("BeforeUpload", HookValidateCapacity)
+	if !fs.Policy.IsUploadPlaceholderWithSize() {
+		fs.Use("AfterUpload", HookClearFileHeaderSize)
+	}
+	fs.Use("BeforeAddFile", HookValidateFileCount)
+	fs.Use("AfterUpload", GenericAfterUpload)
+
+	if err := fs.Upload(ctx, file); err != nil {
+		return nil, err
+	}
+
+	return file.Model.(*model.File), nil
+}
+
+// CompleteUploadPlaceholder 将文件内容写入占位文件的存储路径，并将占位文件提升为正式文件
+func (fs *FileSystem) CompleteUploadPlaceholder(ctx context.Context, placeholder *model.File, file *fsctx.FileStream) error {
+	fs.Policy = placeholder.GetPolicy()
+	if err := fs.DispatchHandler(); err != nil {
+		return err
+	}
+
+	file.Name = placeholder.Name
+	file.SavePath = placeholder.SourceName
+	file.Mode = fsctx.Overwrite
+	file.Model = placeholder
+
+	fs.Use("BeforeUpload", HookValidateEncryptedUpload)
+	fs.Use("BeforeUpload", HookValidateMIMEType)
+
+	// 占位符未扣除容量需要校验和扣除
+	if !fs.Policy.IsUploadPlaceholderWithSize() {
+		fs.Use("BeforeUpload", HookValidateCapacity)
+		fs.Use("AfterUpload", HookChunkUploaded)
+	}
+	fs.Use("AfterUpload", HookValidateUniqueContent)
+	fs.Use("AfterUpload", HookContentAddress)
+	fs.Use("AfterUpload", HookPopPlaceholderToFile(""))
+	permission, _ := ctx.Value(fsctx.UploadPermissionCtx).(string)
+	fs.Use("AfterUpload", HookApplyUploadPermission(permission))
+	fs.UseUploadProcessors(true)
+	fs.Use("AfterValidateFailed", HookDeleteTempFile)
+
+	return fs.Upload(ctx, file)
+}
+
 // UploadFromStream 从文件流上传文件
 func (fs *FileSystem) UploadFromStream(ctx context.Context, file *fsctx.FileStream, resetPolicy bool) error {
 	if resetPolicy {
@@ -230,12 +558,7 @@ func (fs *FileSystem) UploadFromStream(ctx context.Context, file *fsctx.FileStre
 	// 给文件系统分配钩子
 	fs.Lock.Lock()
 	if fs.Hooks == nil {
-		fs.Use("BeforeUpload", HookValidateFile)
-		fs.Use("BeforeUpload", HookValidateCapacity)
-		fs.Use("AfterUploadCanceled", HookDeleteTempFile)
-		fs.Use("AfterUpload", GenericAfterUpload)
-		fs.Use("AfterUpload", HookGenerateThumb)
-		fs.Use("AfterValidateFailed", HookDeleteTempFile)
+		fs.useStreamUploadHooks(true)
 	}
 	fs.Lock.Unlock()
 
@@ -243,6 +566,55 @@ func (fs *FileSystem) UploadFromStream(ctx context.Context, file *fsctx.FileStre
 	return fs.Upload(ctx, file)
 }
 
+// useStreamUploadHooks 注册由服务端写入文件流的新建文件上传钩子，onCreated 在创建文件记录后、
+// 处理文件内容前执行。generateThumb 为 false 时不逐个生成缩略图，由调用方在上传结束后统一生成
+func (fs *FileSystem) useStreamUploadHooks(generateThumb bool, onCreated ...Hook) {
+	fs.Use("BeforeUpload", HookValidateFile)
+	fs.Use("BeforeUpload", HookValidateUniqueName)
+	fs.Use("BeforeUpload", HookValidateEncryptedUpload)
+	fs.Use("BeforeUpload", HookValidateMIMEType)
+	fs.Use("BeforeUpload", HookValidateConfiguredMinFileSize)
+	if windows, loc := fs.UploadWindows(); len(windows) > 0 {
+		fs.Use("BeforeUpload", HookValidateUploadWindow(windows, loc))
+	}
+	if IsUploadRegionPolicyEnabled() {
+		fs.Use("BeforeUpload", HookValidateUploadRegion)
+	}
+	fs.Use("BeforeUpload", HookValidateCapacity)
+	fs.Use("AfterUploadCanceled", HookDeleteTempFile)
+	fs.Use("AfterUpload", HookValidateUniqueContent)
+	fs.Use("BeforeAddFile", HookValidateFileCount)
+	fs.Use("AfterUpload", GenericAfterUpload)
+	for _, hook := range onCreated {
+		fs.Use("AfterUpload", hook)
+	}
+	fs.UseUploadProcessors(generateThumb)
+	fs.Use("AfterValidateFailed", HookDeleteTempFile)
+}
+
+// UseUploadProcessors 注册新建文件上传完成、创建文件记录后处理文件内容的钩子，
+// generateThumb 为 false 时不逐个生成缩略图
+func (fs *FileSystem) UseUploadProcessors(generateThumb bool) {
+	fs.Use("AfterUpload", HookRequireApproval)
+	fs.Use("AfterUpload", HookUpdateFolderCover)
+	fs.Use("AfterUpload", HookConvertImageToSRGB)
+	if generateThumb {
+		fs.Use("AfterUpload", HookGenerateThumb)
+	}
+	fs.Use("AfterUpload", HookComputeChecksum(ChecksumAlgorithm()))
+	fs.Use("AfterUpload", HookComputePerceptualHash)
+	fs.Use("AfterUpload", HookExtractCaptureTime)
+	fs.Use("AfterUpload", HookComputeTextStats)
+	fs.Use("AfterUpload", HookProbeVideoInfo)
+	fs.Use("AfterUpload", HookScanSensitiveData)
+}
+
+// UseUpdateProcessors 注册覆盖已有文件内容后重新处理文件内容的钩子，需在 GenericAfterUpdate 之后注册
+func (fs *FileSystem) UseUpdateProcessors() {
+	fs.Use("AfterUpload", HookComputeChecksum(ChecksumAlgorithm()))
+	fs.Use("AfterUpload", HookComputeTextStats)
+}
+
 // UploadFromPath 将本机已有文件上传到用户的文件系统
 func (fs *FileSystem) UploadFromPath(ctx context.Context, src, dst string, mode fsctx.WriteMode) error {
 	file, err := os.Open(util.RelativePath(src))
@@ -13,12 +13,16 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
 	testMock "github.com/stretchr/testify/mock"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 type FileHeaderMock struct {
@@ -67,10 +71,13 @@ func (m FileHeaderMock) Source(ctx context.Context, path string, url url.URL, ex
 
 func TestFileSystem_Upload(t *testing.T) {
 	asserts := assert.New(t)
+	readAll := func(args testMock.Arguments) {
+		ioutil.ReadAll(args.Get(1).(fsctx.FileHeader))
+	}
 
 	// 正常
 	testHandler := new(FileHeaderMock)
-	testHandler.On("Put", testMock.Anything, testMock.Anything, testMock.Anything).Return(nil)
+	testHandler.On("Put", testMock.Anything, testMock.Anything).Run(readAll).Return(nil)
 	fs := &FileSystem{
 		Handler: testHandler,
 		User: &model.User{
@@ -89,6 +96,7 @@ func TestFileSystem_Upload(t *testing.T) {
 	ctx = context.WithValue(ctx, fsctx.GinCtx, c)
 	cancel()
 	file := &fsctx.FileStream{
+		File:        ioutil.NopCloser(strings.NewReader("hello")),
 		Size:        5,
 		VirtualPath: "/",
 		Name:        "1.txt",
@@ -96,9 +104,33 @@ func TestFileSystem_Upload(t *testing.T) {
 	err := fs.Upload(ctx, file)
 	asserts.NoError(err)
 
+	// 严格模式下目标目录不存在，不保存文件内容
+	{
+		testHandler := new(FileHeaderMock)
+		fs := &FileSystem{
+			Handler: testHandler,
+			User:    &model.User{Model: gorm.Model{ID: 1}},
+			Policy:  &model.Policy{DirNameRule: "{path}"},
+		}
+		fs.Policy.OptionsSerialized.StrictUploadTarget = true
+		mock.ExpectQuery("SELECT(.+)").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}))
+		err := fs.Upload(context.Background(), &fsctx.FileStream{
+			File:        ioutil.NopCloser(strings.NewReader("hello")),
+			Size:        5,
+			VirtualPath: "/typo",
+			Name:        "1.txt",
+		})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeParentNotExist, err.(serializer.AppError).Code)
+		testHandler.AssertNotCalled(t, "Put", testMock.Anything, testMock.Anything)
+	}
+
 	// 正常，上下文已指定源文件
 	testHandler = new(FileHeaderMock)
-	testHandler.On("Put", testMock.Anything, testMock.Anything).Return(nil)
+	testHandler.On("Put", testMock.Anything, testMock.Anything).Run(readAll).Return(nil)
 	fs = &FileSystem{
 		Handler: testHandler,
 		User: &model.User{
@@ -121,7 +153,7 @@ func TestFileSystem_Upload(t *testing.T) {
 		Size:        5,
 		VirtualPath: "/",
 		Name:        "1.txt",
-		File:        ioutil.NopCloser(strings.NewReader("")),
+		File:        ioutil.NopCloser(strings.NewReader("hello")),
 	}
 	err = fs.Upload(ctx, file)
 	asserts.NoError(err)
@@ -145,8 +177,9 @@ func TestFileSystem_Upload(t *testing.T) {
 
 	// AfterUpload失败
 	testHandler3 := new(FileHeaderMock)
-	testHandler3.On("Put", testMock.Anything, testMock.Anything).Return(nil)
+	testHandler3.On("Put", testMock.Anything, testMock.Anything).Run(readAll).Return(nil)
 	fs.Handler = testHandler3
+	file.File = ioutil.NopCloser(strings.NewReader("hello"))
 	fs.Use("AfterUpload", func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
 		return errors.New("error")
 	})
@@ -159,6 +192,71 @@ func TestFileSystem_Upload(t *testing.T) {
 
 }
 
+func TestFileSystem_UploadSizeMismatch(t *testing.T) {
+	asserts := assert.New(t)
+	readAll := func(args testMock.Arguments) {
+		ioutil.ReadAll(args.Get(1).(fsctx.FileHeader))
+	}
+
+	// 实际大小小于声明
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything).Run(readAll).Return(nil)
+		testHandler.On("Delete", testMock.Anything, []string{"/1.txt"}).Return([]string{}, nil)
+		fs := &FileSystem{Handler: testHandler, User: &model.User{}}
+		err := fs.Upload(context.Background(), &fsctx.FileStream{
+			File:     ioutil.NopCloser(strings.NewReader("123")),
+			Size:     5,
+			Name:     "1.txt",
+			SavePath: "/1.txt",
+		})
+		asserts.Error(err)
+		asserts.Equal(map[string]uint64{"declared": 5, "actual": 3}, err.(serializer.AppError).Data)
+		testHandler.AssertExpectations(t)
+	}
+
+	// 实际大小大于声明，存储端仅读取声明的大小
+	{
+		testHandler := new(FileHeaderMock)
+		testHandler.On("Put", testMock.Anything, testMock.Anything).Run(func(args testMock.Arguments) {
+			ioutil.ReadAll(io.LimitReader(args.Get(1).(fsctx.FileHeader), 2))
+		}).Return(nil)
+		testHandler.On("Delete", testMock.Anything, []string{"/1.txt"}).Return([]string{}, nil)
+		fs := &FileSystem{Handler: testHandler, User: &model.User{}}
+		err := fs.Upload(context.Background(), &fsctx.FileStream{
+			File:     ioutil.NopCloser(strings.NewReader("123")),
+			Size:     2,
+			Name:     "1.txt",
+			SavePath: "/1.txt",
+		})
+		asserts.Error(err)
+		testHandler.AssertExpectations(t)
+	}
+
+	// 追加上传时回滚本次写入，存储端不支持追加时写入本机缓冲
+	{
+		cache.Set("setting_temp_path", "tests/temp", 0)
+		defer os.Remove(appendBufferPath("/1.txt"))
+		testHandler := new(FileHeaderMock)
+		fs := &FileSystem{Handler: testHandler, User: &model.User{}}
+		rollback := false
+		fs.Use("AfterValidateFailed", func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			rollback = true
+			return nil
+		})
+		err := fs.Upload(context.Background(), &fsctx.FileStream{
+			File:     ioutil.NopCloser(strings.NewReader("123")),
+			Size:     5,
+			Name:     "1.txt",
+			SavePath: "/1.txt",
+			Mode:     fsctx.Append,
+		})
+		asserts.Error(err)
+		asserts.True(rollback)
+		testHandler.AssertExpectations(t)
+	}
+}
+
 func TestFileSystem_GetUploadToken(t *testing.T) {
 	asserts := assert.New(t)
 	fs := FileSystem{
@@ -262,3 +360,138 @@ func TestFileSystem_UploadFromPath(t *testing.T) {
 		asserts.Error(err)
 	}
 }
+
+func TestUploadDeadline(t *testing.T) {
+	asserts := assert.New(t)
+
+	cache.Set("setting_upload_deadline_base", "10", 0)
+	cache.Set("setting_upload_deadline_min_speed", "100", 0)
+	asserts.Equal(20*time.Second, UploadDeadline(1000))
+
+	ctx, cancel := WithUploadDeadline(context.Background(), 1000)
+	_, ok := ctx.Deadline()
+	asserts.True(ok)
+	cancel()
+
+	// 不限制
+	cache.Set("setting_upload_deadline_base", "0", 0)
+	asserts.EqualValues(0, UploadDeadline(1000))
+	ctx, cancel = WithUploadDeadline(context.Background(), 1000)
+	_, ok = ctx.Deadline()
+	asserts.False(ok)
+	cancel()
+}
+
+func TestNewContextReader(t *testing.T) {
+	asserts := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := NewContextReader(ctx, ioutil.NopCloser(strings.NewReader("123")))
+
+	buf := make([]byte, 1)
+	n, err := reader.Read(buf)
+	asserts.NoError(err)
+	asserts.Equal(1, n)
+
+	cancel()
+	_, err = reader.Read(buf)
+	asserts.Equal(context.Canceled, err)
+	asserts.NoError(reader.Close())
+}
+
+func TestFileSystem_CancelUploadDeadline(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{}
+	canceled := make(chan struct{})
+	fs.Use("AfterUploadCanceled", func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+		close(canceled)
+		return nil
+	})
+
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	defer reqCancel()
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), fsctx.HTTPCtx, reqCtx), time.Millisecond)
+	defer cancel()
+
+	fs.CancelUpload(ctx, "", &fsctx.FileStream{})
+	select {
+	case <-canceled:
+	default:
+		asserts.Fail("AfterUploadCanceled not triggered")
+	}
+}
+
+func TestRestoreUploadSession(t *testing.T) {
+	a := assert.New(t)
+
+	// 会话已过期
+	{
+		session := &serializer.UploadSession{Key: "testRestoreExpired", Expires: time.Now().Unix() - 1}
+		a.Equal(ErrUploadSessionExpired, RestoreUploadSession(session))
+		_, ok := cache.Get(UploadSessionCachePrefix + "testRestoreExpired")
+		a.False(ok)
+	}
+
+	// 成功
+	{
+		session := &serializer.UploadSession{Key: "testRestore", Expires: time.Now().Unix() + 60}
+		a.NoError(RestoreUploadSession(session))
+		restored, ok := cache.Get(UploadSessionCachePrefix + "testRestore")
+		a.True(ok)
+		a.Equal("testRestore", restored.(serializer.UploadSession).Key)
+	}
+}
+
+func TestMarkUploadSessionDone(t *testing.T) {
+	a := assert.New(t)
+
+	// 会话已过期，不记录
+	{
+		session := &serializer.UploadSession{Key: "testDoneExpired", Expires: time.Now().Unix() - 1}
+		a.NoError(MarkUploadSessionDone(session))
+		a.False(IsUploadSessionDone("testDoneExpired"))
+	}
+
+	// 成功
+	{
+		session := &serializer.UploadSession{Key: "testDone", Expires: time.Now().Unix() + 60}
+		a.False(IsUploadSessionDone("testDone"))
+		a.NoError(MarkUploadSessionDone(session))
+		a.True(IsUploadSessionDone("testDone"))
+	}
+}
+
+func TestFileSystem_UseStreamUploadHooks(t *testing.T) {
+	asserts := assert.New(t)
+	registered := func(hooks []Hook, target Hook) bool {
+		for _, hook := range hooks {
+			if reflect.ValueOf(hook).Pointer() == reflect.ValueOf(target).Pointer() {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 逐个生成缩略图
+	{
+		fs := &FileSystem{User: &model.User{}}
+		fs.useStreamUploadHooks(true)
+		asserts.True(registered(fs.Hooks["BeforeUpload"], HookValidateConfiguredMinFileSize))
+		asserts.True(registered(fs.Hooks["BeforeUpload"], HookValidateCapacity))
+		asserts.True(registered(fs.Hooks["AfterUpload"], HookValidateUniqueContent))
+		asserts.True(registered(fs.Hooks["AfterUpload"], HookRequireApproval))
+		asserts.True(registered(fs.Hooks["AfterUpload"], HookGenerateThumb))
+		asserts.True(registered(fs.Hooks["AfterUpload"], HookScanSensitiveData))
+	}
+
+	// 由调用方统一生成缩略图，创建文件记录后执行附加钩子
+	{
+		fs := &FileSystem{User: &model.User{}}
+		onCreated := func(ctx context.Context, fs *FileSystem, file fsctx.FileHeader) error {
+			return nil
+		}
+		fs.useStreamUploadHooks(false, onCreated)
+		asserts.True(registered(fs.Hooks["AfterUpload"], HookRequireApproval))
+		asserts.False(registered(fs.Hooks["AfterUpload"], HookGenerateThumb))
+		asserts.True(registered(fs.Hooks["AfterUpload"], onCreated))
+	}
+}
@@ -2,9 +2,15 @@ package filesystem
 
 import (
 	"context"
+	"mime"
 	"path/filepath"
 	"strings"
 
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/email"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/notify"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 )
 
@@ -51,9 +57,124 @@ func (fs *FileSystem) ValidateFileSize(ctx context.Context, size uint64) bool {
 	return size <= fs.Policy.MaxSize
 }
 
-// ValidateCapacity 验证并扣除用户容量
+// MinFileSize 返回存储策略与用户组设定中较大的最小文件尺寸，0 表示未设定
+func (fs *FileSystem) MinFileSize() uint64 {
+	var min uint64
+	if fs.Policy != nil {
+		min = fs.Policy.OptionsSerialized.MinSize
+	}
+	if fs.User != nil && fs.User.Group.OptionsSerialized.MinFileSize > min {
+		min = fs.User.Group.OptionsSerialized.MinFileSize
+	}
+	return min
+}
+
+// StrictUploadTarget 返回存储策略或用户组是否要求上传的目标目录已存在
+func (fs *FileSystem) StrictUploadTarget() bool {
+	if fs.Policy != nil && fs.Policy.OptionsSerialized.StrictUploadTarget {
+		return true
+	}
+	return fs.User != nil && fs.User.Group.OptionsSerialized.StrictUploadTarget
+}
+
+// validateUploadTarget 严格模式下检查上传的目标目录是否已存在，避免路径拼写错误时自动创建目录
+func (fs *FileSystem) validateUploadTarget(file fsctx.FileHeader) error {
+	virtualPath := file.Info().VirtualPath
+	if virtualPath == "" || !fs.StrictUploadTarget() {
+		return nil
+	}
+
+	virtualPath, err := NormalizeVirtualPath(virtualPath)
+	if err != nil {
+		return err
+	}
+
+	if exist, _ := fs.IsPathExist(virtualPath); !exist {
+		return ErrUploadTargetNotExist.WithData(virtualPath)
+	}
+
+	return nil
+}
+
+// MaxPathDepth 返回允许创建的最大目录深度，取全局设定与存储策略设定中较小的非零值，0 表示不限制
+func (fs *FileSystem) MaxPathDepth() int {
+	max := model.GetIntSetting("max_path_depth", 0)
+	if fs.Policy != nil {
+		if policyMax := fs.Policy.OptionsSerialized.MaxPathDepth; policyMax > 0 && (max <= 0 || policyMax < max) {
+			max = policyMax
+		}
+	}
+	if max < 0 {
+		return 0
+	}
+	return max
+}
+
+// ValidateCapacity 验证并扣除用户容量，已用容量首次超过警告阈值时通知用户
 func (fs *FileSystem) ValidateCapacity(ctx context.Context, size uint64) bool {
-	return fs.User.IncreaseStorage(size)
+	before := fs.User.Storage
+	if !fs.User.IncreaseStorage(size) {
+		return false
+	}
+
+	fs.checkQuotaWarning(before)
+	return true
+}
+
+// checkQuotaWarning 已用容量由 before 增长至超过 notify_quota_warning_percent 时发送容量警告
+func (fs *FileSystem) checkQuotaWarning(before uint64) {
+	percent := model.GetIntSetting("notify_quota_warning_percent", 0)
+	total := fs.User.Group.MaxStorage
+	if percent <= 0 || total == 0 {
+		return
+	}
+
+	threshold := total * uint64(percent) / 100
+	if before >= threshold || fs.User.Storage < threshold {
+		return
+	}
+
+	owner := *fs.User
+	n := &notify.Notification{
+		Event: notify.EventQuotaWarning,
+		User:  &owner,
+		Data: map[string]interface{}{
+			"used":  fs.User.Storage,
+			"total": total,
+		},
+	}
+	n.Title, n.Body = email.NewQuotaWarningEmail(percent)
+	notify.Send(n)
+}
+
+// ValidateTypeQuota 验证用户组设定的文件类型容量限制是否允许再存放 size 大小的文件 name，
+// 超出时返回的错误中包含触发限制的文件类型
+func (fs *FileSystem) ValidateTypeQuota(name string, size uint64) error {
+	quotas := fs.User.Group.OptionsSerialized.TypeQuotas
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	fileType := model.FileTypeOf(name)
+	quota, ok := quotas[fileType]
+	if fileType == "" || !ok {
+		return nil
+	}
+
+	used, err := model.GetTypeUsage(fs.User.ID, fileType)
+	if err != nil {
+		return serializer.NewError(serializer.CodeDBError, "Failed to get type usage", err)
+	}
+
+	if used+size > quota {
+		return ErrTypeQuotaExceeded.WithData(map[string]interface{}{
+			"type":  fileType,
+			"quota": quota,
+			"used":  used,
+		})
+	}
+
+	return nil
 }
 
 // ValidateExtension 验证文件扩展名
@@ -80,3 +201,149 @@ func IsInExtensionList(extList []string, fileName string) bool {
 
 	return false
 }
+
+// ValidateUploadSessionIP 验证提交分片的客户端 IP 是否与上传会话绑定的 IP
+// 位于同一子网，会话未绑定 IP 时不做限制
+func ValidateUploadSessionIP(session *serializer.UploadSession, clientIP string) error {
+	if session.ClientIP == "" {
+		return nil
+	}
+
+	if !util.IsSameSubnet(
+		session.ClientIP,
+		clientIP,
+		model.GetIntSetting("upload_session_bind_ipv4_prefix", 24),
+		model.GetIntSetting("upload_session_bind_ipv6_prefix", 64),
+	) {
+		return ErrUploadSessionIPMismatch
+	}
+
+	return nil
+}
+
+// folderTypePresets 目录预设文件类型包含的扩展名
+var folderTypePresets = map[string][]string{
+	model.FolderTypeImages: {"jpg", "jpeg", "png", "gif", "bmp", "webp", "svg", "tif", "tiff", "heic", "heif", "avif", "ico"},
+	model.FolderTypeDocuments: {"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "odt", "ods", "odp", "rtf",
+		"txt", "md", "csv", "epub"},
+	model.FolderTypeMedia: {"jpg", "jpeg", "png", "gif", "bmp", "webp", "svg", "tif", "tiff", "heic", "heif", "avif", "ico",
+		"mp4", "mkv", "mov", "avi", "webm", "flv", "wmv", "m4v", "mp3", "flac", "wav", "aac", "ogg", "m4a", "opus", "wma"},
+}
+
+// IsFileTypeAllowedInFolder 返回目录的文件类型限制是否允许存放给定文件。限制规则以逗号分隔，
+// 可为预设类型、扩展名或 MIME 类型（以 / 结尾时匹配前缀）。MIME 类型优先根据扩展名推断，
+// 无法推断时才使用 mimeType
+func IsFileTypeAllowedInFolder(folder *model.Folder, name, mimeType string) bool {
+	if strings.TrimSpace(folder.AllowedTypes) == "" {
+		return true
+	}
+
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	if detected := mime.TypeByExtension(filepath.Ext(name)); detected != "" {
+		mimeType = detected
+	}
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+
+	for _, rule := range strings.Split(folder.AllowedTypes, ",") {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == "" {
+			continue
+		}
+
+		if preset, ok := folderTypePresets[rule]; ok {
+			if ext != "" && util.ContainsString(preset, ext) {
+				return true
+			}
+			continue
+		}
+
+		if strings.Contains(rule, "/") {
+			if mimeType != "" && (rule == mimeType || (strings.HasSuffix(rule, "/") && strings.HasPrefix(mimeType, rule))) {
+				return true
+			}
+			continue
+		}
+
+		if ext != "" && strings.TrimPrefix(rule, ".") == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateFolderFileTypes 检查给定文件及目录 dirs 下的所有文件是否均允许移入或复制到目标目录
+func (fs *FileSystem) validateFolderFileTypes(folder *model.Folder, dirs, files []uint) error {
+	if strings.TrimSpace(folder.AllowedTypes) == "" || (len(files) == 0 && len(dirs) == 0) {
+		return nil
+	}
+
+	fileObjects := make([]model.File, 0, len(files))
+	if len(files) > 0 {
+		objects, err := model.GetFilesByIDs(files, fs.User.ID)
+		if err != nil {
+			return ErrObjectNotExist.WithError(err)
+		}
+		fileObjects = append(fileObjects, objects...)
+	}
+
+	// 递归列出目录下的文件
+	if len(dirs) > 0 {
+		folders, err := model.GetRecursiveChildFolder(dirs, fs.User.ID, true)
+		if err != nil {
+			return ErrObjectNotExist.WithError(err)
+		}
+
+		folderIDs := make([]uint, 0, len(folders))
+		for _, child := range folders {
+			folderIDs = append(folderIDs, child.ID)
+		}
+
+		if len(folderIDs) > 0 {
+			objects, err := model.GetFilesByParentIDs(folderIDs, fs.User.ID)
+			if err != nil {
+				return ErrObjectNotExist.WithError(err)
+			}
+			fileObjects = append(fileObjects, objects...)
+		}
+	}
+
+	for _, file := range fileObjects {
+		if !IsFileTypeAllowedInFolder(folder, file.Name, "") {
+			return ErrFolderFileTypeNotAllowed
+		}
+	}
+
+	return nil
+}
+
+// ValidateFileCount 验证新增 files 个文件、folders 个目录后是否超出文件数配额。
+// 已用数量以数据库中的计数为准；用户组设定目录不计入配额时只检查文件
+func (fs *FileSystem) ValidateFileCount(files, folders uint64) error {
+	limit := fs.User.MaxFiles()
+	if limit == 0 {
+		return nil
+	}
+
+	includeFolders := fs.User.Group.OptionsSerialized.MaxFilesIncludeFolders
+	if !includeFolders {
+		folders = 0
+	}
+	if files+folders == 0 {
+		return nil
+	}
+
+	count, err := fs.User.GetFileCount(includeFolders)
+	if err != nil {
+		return serializer.NewError(serializer.CodeDBError, "Failed to get file count", err)
+	}
+
+	if count+files+folders > limit {
+		return ErrFileCountExceeded.WithData(map[string]uint64{
+			"count": count,
+			"limit": limit,
+		})
+	}
+
+	return nil
+}
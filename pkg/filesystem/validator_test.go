@@ -3,11 +3,16 @@ package filesystem
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/notify"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
 )
@@ -64,6 +69,46 @@ func TestFileSystem_ValidateCapacity(t *testing.T) {
 	asserts.Equal(uint64(5), fs.User.Storage)
 }
 
+// quotaWarningBackend 记录收到的容量警告
+type quotaWarningBackend chan *notify.Notification
+
+func (b quotaWarningBackend) Deliver(ctx context.Context, recipient *model.User, n *notify.Notification) error {
+	b <- n
+	return nil
+}
+
+func TestFileSystem_ValidateCapacity_QuotaWarning(t *testing.T) {
+	asserts := assert.New(t)
+	ctx := context.Background()
+	received := make(quotaWarningBackend, 1)
+	notify.Register("test_quota_warning", received)
+	cache.Set("setting_notify_backend", "test_quota_warning", 0)
+	cache.Set("setting_notify_quota_warning_to", "user", 0)
+	cache.Set("setting_notify_quota_warning_percent", "90", 0)
+	defer cache.Set("setting_notify_quota_warning_percent", "0", 0)
+	fs := FileSystem{User: &model.User{Group: model.Group{MaxStorage: 100}}}
+
+	// 未超过阈值
+	asserts.True(fs.ValidateCapacity(ctx, 89))
+	// 超过阈值
+	asserts.True(fs.ValidateCapacity(ctx, 1))
+	select {
+	case n := <-received:
+		asserts.Equal(notify.EventQuotaWarning, n.Event)
+		asserts.Equal(uint64(90), n.Data["used"])
+	case <-time.After(time.Second):
+		asserts.Fail("quota warning is not sent")
+	}
+
+	// 已超过阈值后不再重复发送
+	asserts.True(fs.ValidateCapacity(ctx, 5))
+	select {
+	case <-received:
+		asserts.Fail("quota warning is sent twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
 func TestFileSystem_ValidateFileSize(t *testing.T) {
 	asserts := assert.New(t)
 	ctx := context.Background()
@@ -83,6 +128,164 @@ func TestFileSystem_ValidateFileSize(t *testing.T) {
 	asserts.True(fs.ValidateFileSize(ctx, 11))
 }
 
+func TestFileSystem_MinFileSize(t *testing.T) {
+	asserts := assert.New(t)
+	fs := FileSystem{
+		User:   &model.User{},
+		Policy: &model.Policy{},
+	}
+
+	// 未设定
+	asserts.EqualValues(0, fs.MinFileSize())
+
+	// 取较大值
+	fs.Policy.OptionsSerialized.MinSize = 10
+	asserts.EqualValues(10, fs.MinFileSize())
+	fs.User.Group.OptionsSerialized.MinFileSize = 20
+	asserts.EqualValues(20, fs.MinFileSize())
+
+	// 未指定存储策略
+	fs.Policy = nil
+	asserts.EqualValues(20, fs.MinFileSize())
+}
+
+func TestFileSystem_StrictUploadTarget(t *testing.T) {
+	asserts := assert.New(t)
+	fs := FileSystem{
+		User:   &model.User{},
+		Policy: &model.Policy{},
+	}
+
+	// 默认自动创建
+	asserts.False(fs.StrictUploadTarget())
+
+	// 存储策略开启
+	fs.Policy.OptionsSerialized.StrictUploadTarget = true
+	asserts.True(fs.StrictUploadTarget())
+
+	// 用户组开启
+	fs.Policy.OptionsSerialized.StrictUploadTarget = false
+	fs.User.Group.OptionsSerialized.StrictUploadTarget = true
+	asserts.True(fs.StrictUploadTarget())
+
+	// 未设定存储策略
+	fs.Policy = nil
+	asserts.True(fs.StrictUploadTarget())
+}
+
+func TestFileSystem_validateUploadTarget(t *testing.T) {
+	asserts := assert.New(t)
+	fs := FileSystem{
+		User:   &model.User{Model: gorm.Model{ID: 1}},
+		Policy: &model.Policy{},
+	}
+
+	// 未开启严格模式，不查询目录
+	asserts.NoError(fs.validateUploadTarget(&fsctx.FileStream{VirtualPath: "/not/exist"}))
+
+	fs.Policy.OptionsSerialized.StrictUploadTarget = true
+
+	// 目录已存在
+	{
+		mock.ExpectQuery("SELECT(.+)").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+		mock.ExpectQuery("SELECT(.+)").
+			WithArgs(1, 1, "docs").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(2, 1))
+		asserts.NoError(fs.validateUploadTarget(&fsctx.FileStream{VirtualPath: "/docs/"}))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 中间目录不存在
+	{
+		mock.ExpectQuery("SELECT(.+)").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}).AddRow(1, 1))
+		mock.ExpectQuery("SELECT(.+)").
+			WithArgs(1, 1, "docs").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id"}))
+		err := fs.validateUploadTarget(&fsctx.FileStream{VirtualPath: "/docs/2021"})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.Equal(serializer.CodeParentNotExist, err.(serializer.AppError).Code)
+	}
+}
+
+func TestFileSystem_ValidateTypeQuota(t *testing.T) {
+	asserts := assert.New(t)
+	fs := FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+
+	// 未设定限制
+	asserts.NoError(fs.ValidateTypeQuota("1.mp4", 10))
+
+	fs.User.Group.OptionsSerialized.TypeQuotas = map[string]uint64{model.FileTypeVideo: 100}
+
+	// 不受限制的类型
+	asserts.NoError(fs.ValidateTypeQuota("1.txt", 1000))
+
+	// 未超出
+	{
+		mock.ExpectQuery("SELECT(.+)type_usages(.+)").WithArgs(1, model.FileTypeVideo).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "size"}).AddRow(1, model.FileTypeVideo, 90))
+		asserts.NoError(fs.ValidateTypeQuota("1.mp4", 10))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 超出
+	{
+		mock.ExpectQuery("SELECT(.+)type_usages(.+)").WithArgs(1, model.FileTypeVideo).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "type", "size"}).AddRow(1, model.FileTypeVideo, 91))
+		err := fs.ValidateTypeQuota("1.mkv", 10)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		appErr := err.(serializer.AppError)
+		asserts.Equal(serializer.CodeTypeQuotaExceeded, appErr.Code)
+		asserts.Equal(model.FileTypeVideo, appErr.Data.(map[string]interface{})["type"])
+	}
+}
+
+func TestFileSystem_ValidateFileCount(t *testing.T) {
+	asserts := assert.New(t)
+	fs := FileSystem{User: &model.User{Model: gorm.Model{ID: 1}}}
+
+	// 未设定限制
+	asserts.NoError(fs.ValidateFileCount(1, 0))
+
+	fs.User.Group.OptionsSerialized.MaxFiles = 10
+
+	// 目录不计入
+	asserts.NoError(fs.ValidateFileCount(0, 1))
+
+	// 未超出
+	{
+		mock.ExpectQuery("SELECT(.+)users(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"file_count", "folder_count"}).AddRow(9, 5))
+		asserts.NoError(fs.ValidateFileCount(1, 0))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 目录计入，超出
+	{
+		fs.User.Group.OptionsSerialized.MaxFilesIncludeFolders = true
+		mock.ExpectQuery("SELECT(.+)users(.+)").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"file_count", "folder_count"}).AddRow(5, 5))
+		err := fs.ValidateFileCount(0, 1)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		appErr := err.(serializer.AppError)
+		asserts.Equal(serializer.CodeFileCountExceeded, appErr.Code)
+		asserts.Equal(map[string]uint64{"count": 10, "limit": 10}, appErr.Data)
+	}
+
+	// 读取失败
+	{
+		mock.ExpectQuery("SELECT(.+)users(.+)").WillReturnError(errors.New("error"))
+		asserts.Error(fs.ValidateFileCount(1, 0))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
+
 func TestFileSystem_ValidateExtension(t *testing.T) {
 	asserts := assert.New(t)
 	ctx := context.Background()
@@ -110,3 +313,86 @@ func TestFileSystem_ValidateExtension(t *testing.T) {
 	asserts.True(fs.ValidateExtension(ctx, "1.png.jpG"))
 	asserts.False(fs.ValidateExtension(ctx, "1.png"))
 }
+
+func TestValidateUploadSessionIP(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_upload_session_bind_ipv4_prefix", "24", 0)
+	cache.Set("setting_upload_session_bind_ipv6_prefix", "64", 0)
+
+	// 未绑定 IP
+	asserts.NoError(ValidateUploadSessionIP(&serializer.UploadSession{}, "1.1.1.1"))
+
+	// 同一子网
+	session := &serializer.UploadSession{ClientIP: "1.2.3.4"}
+	asserts.NoError(ValidateUploadSessionIP(session, "1.2.3.100"))
+
+	// 不同子网
+	asserts.Equal(ErrUploadSessionIPMismatch, ValidateUploadSessionIP(session, "1.2.4.4"))
+}
+
+func TestIsFileTypeAllowedInFolder(t *testing.T) {
+	asserts := assert.New(t)
+	folder := &model.Folder{}
+
+	// 未限制
+	asserts.True(IsFileTypeAllowedInFolder(folder, "1.txt", ""))
+
+	// 预设类型
+	folder.AllowedTypes = model.FolderTypeImages
+	asserts.True(IsFileTypeAllowedInFolder(folder, "1.JPG", ""))
+	asserts.False(IsFileTypeAllowedInFolder(folder, "1.txt", ""))
+	asserts.False(IsFileTypeAllowedInFolder(folder, "1", "image/png"))
+
+	// 自定义扩展名及 MIME 类型
+	folder.AllowedTypes = "documents, .zip, image/"
+	asserts.True(IsFileTypeAllowedInFolder(folder, "1.pdf", ""))
+	asserts.True(IsFileTypeAllowedInFolder(folder, "1.zip", ""))
+	asserts.True(IsFileTypeAllowedInFolder(folder, "1.png", ""))
+	asserts.True(IsFileTypeAllowedInFolder(folder, "1", "image/png"))
+	asserts.False(IsFileTypeAllowedInFolder(folder, "1.exe", "image/png"))
+	asserts.False(IsFileTypeAllowedInFolder(folder, "1.mp4", ""))
+}
+
+func TestFileSystem_validateFolderFileTypes(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	folder := &model.Folder{}
+
+	// 未限制
+	asserts.NoError(fs.validateFolderFileTypes(folder, nil, []uint{1}))
+
+	// 包含不允许的文件
+	folder.AllowedTypes = model.FolderTypeImages
+	mock.ExpectQuery("SELECT(.+)files(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "1.png").AddRow(2, "2.txt"))
+	asserts.Equal(ErrFolderFileTypeNotAllowed, fs.validateFolderFileTypes(folder, nil, []uint{1, 2}))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 全部允许
+	mock.ExpectQuery("SELECT(.+)files(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "1.png"))
+	asserts.NoError(fs.validateFolderFileTypes(folder, nil, []uint{1}))
+	asserts.NoError(mock.ExpectationsWereMet())
+	// 目录的子目录中包含不允许的文件
+	mock.ExpectQuery("SELECT(.+)folders(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectQuery("SELECT(.+)folders(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery("SELECT(.+)folders(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT(.+)files(.+)").
+		WithArgs(0, 3, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "folder_id"}).AddRow(5, "5.png", 3).AddRow(6, "6.exe", 4))
+	asserts.Equal(ErrFolderFileTypeNotAllowed, fs.validateFolderFileTypes(folder, []uint{3}, nil))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 目录下的文件全部允许
+	mock.ExpectQuery("SELECT(.+)folders(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectQuery("SELECT(.+)folders(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT(.+)files(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "folder_id"}).AddRow(5, "5.png", 3))
+	asserts.NoError(fs.validateFolderFileTypes(folder, []uint{3}, nil))
+	asserts.NoError(mock.ExpectationsWereMet())
+}
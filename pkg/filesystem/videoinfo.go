@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/transcode"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// 文件元数据中记录视频信息的键
+const (
+	VideoDurationMetadataKey   = "video_duration"
+	VideoWidthMetadataKey      = "video_width"
+	VideoHeightMetadataKey     = "video_height"
+	VideoCodecMetadataKey      = "video_codec"
+	VideoBitrateMetadataKey    = "video_bitrate"
+	VideoUnprobableMetadataKey = "video_unprobable"
+)
+
+// probeVideo 读取视频编码信息
+var probeVideo = transcode.Probe
+
+// isVideoProbeNeeded 返回是否需要读取文件的视频信息
+func isVideoProbeNeeded(name string) bool {
+	if !model.IsTrueVal(model.GetSettingByName("video_probe_enabled")) {
+		return false
+	}
+
+	exts := strings.Split(strings.ToLower(model.GetSettingByName("video_probe_exts")), ",")
+	for i := range exts {
+		exts[i] = strings.TrimSpace(exts[i])
+	}
+	return IsInExtensionList(exts, name)
+}
+
+// ProbeVideoInfo 使用 ffprobe 读取视频的时长、分辨率、编码与码率并保存到文件元数据。
+// 整个过程至多耗时 video_probe_timeout 秒，文件损坏、无法解析或解析超时时在元数据中
+// 标记为无法解析，不视为错误
+func (fs *FileSystem) ProbeVideoInfo(ctx context.Context, file *model.File) error {
+	timeout := time.Duration(model.GetIntSetting("video_probe_timeout", 60)) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tempDir := filepath.Join(
+		util.RelativePath(model.GetSettingByName("temp_path")),
+		"probe",
+		fmt.Sprintf("%d_%d", file.ID, time.Now().UnixNano()),
+	)
+	if err := os.MkdirAll(tempDir, 0700); err != nil {
+		return fmt.Errorf("failed to create temp folder: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	input := filepath.Join(tempDir, "input"+filepath.Ext(file.Name))
+	if err := fs.downloadToTemp(ctx, file.SourceName, input); err != nil {
+		return err
+	}
+
+	meta := make(map[string]string, len(file.MetadataSerialized)+6)
+	for key, value := range file.MetadataSerialized {
+		meta[key] = value
+	}
+	for _, key := range []string{VideoDurationMetadataKey, VideoWidthMetadataKey, VideoHeightMetadataKey,
+		VideoCodecMetadataKey, VideoBitrateMetadataKey, VideoUnprobableMetadataKey} {
+		delete(meta, key)
+	}
+
+	info, err := probeVideo(ctx, model.GetSettingByName("video_transcode_ffprobe"), input)
+	if err != nil {
+		// 未安装 ffprobe 时不标记文件
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		util.Log().Debug("Failed to probe video %q: %s", file.Name, err)
+		meta[VideoUnprobableMetadataKey] = "true"
+		return file.UpdateMetadata(meta)
+	}
+
+	meta[VideoDurationMetadataKey] = strconv.FormatFloat(info.Duration.Seconds(), 'f', 3, 64)
+	meta[VideoWidthMetadataKey] = strconv.Itoa(info.Width)
+	meta[VideoHeightMetadataKey] = strconv.Itoa(info.Height)
+	meta[VideoCodecMetadataKey] = info.VideoCodec
+	meta[VideoBitrateMetadataKey] = strconv.FormatInt(info.Bitrate, 10)
+	return file.UpdateMetadata(meta)
+}
+
+// VideoInfoOf 返回文件元数据中记录的视频信息，未读取时返回 nil
+func VideoInfoOf(file *model.File) *serializer.VideoInfo {
+	meta := file.MetadataSerialized
+	if meta[VideoUnprobableMetadataKey] == "true" {
+		return &serializer.VideoInfo{Unprobable: true}
+	}
+
+	if _, ok := meta[VideoCodecMetadataKey]; !ok {
+		return nil
+	}
+
+	info := &serializer.VideoInfo{Codec: meta[VideoCodecMetadataKey]}
+	info.Duration, _ = strconv.ParseFloat(meta[VideoDurationMetadataKey], 64)
+	info.Width, _ = strconv.Atoi(meta[VideoWidthMetadataKey])
+	info.Height, _ = strconv.Atoi(meta[VideoHeightMetadataKey])
+	info.Bitrate, _ = strconv.ParseInt(meta[VideoBitrateMetadataKey], 10, 64)
+	return info
+}
@@ -0,0 +1,154 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/transcode"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsVideoProbeNeeded(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_video_probe_exts", "mp4, MKV", 0)
+
+	cache.Set("setting_video_probe_enabled", "0", 0)
+	asserts.False(isVideoProbeNeeded("1.mp4"))
+
+	cache.Set("setting_video_probe_enabled", "1", 0)
+	defer cache.Set("setting_video_probe_enabled", "0", 0)
+	asserts.True(isVideoProbeNeeded("1.mp4"))
+	asserts.True(isVideoProbeNeeded("1.mkv"))
+	asserts.False(isVideoProbeNeeded("1.txt"))
+}
+
+func TestFileSystem_ProbeVideoInfo(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_temp_path", "temp", 0)
+	cache.Set("setting_video_probe_timeout", "60", 0)
+	handler := newMemoryDriver()
+	handler.objects["1.mp4"] = []byte("video")
+	fs := &FileSystem{User: &model.User{}, Handler: handler}
+	defer func() { probeVideo = transcode.Probe }()
+
+	// 读取失败
+	{
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "2.mp4", SourceName: "2.mp4"}
+		asserts.Error(fs.ProbeVideoInfo(context.Background(), file))
+		asserts.Nil(VideoInfoOf(file))
+	}
+
+	// 成功，保留已有元数据
+	{
+		probeVideo = func(ctx context.Context, ffprobe, input string) (*transcode.MediaInfo, error) {
+			content, err := ioutil.ReadFile(input)
+			asserts.NoError(err)
+			asserts.Equal("video", string(content))
+			return &transcode.MediaInfo{
+				VideoCodec: "h264",
+				Duration:   90500 * time.Millisecond,
+				Width:      1920,
+				Height:     1080,
+				Bitrate:    4000000,
+			}, nil
+		}
+		file := &model.File{
+			Model:              gorm.Model{ID: 1},
+			Name:               "1.mp4",
+			SourceName:         "1.mp4",
+			MetadataSerialized: map[string]string{"key": "value", VideoUnprobableMetadataKey: "true"},
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.ProbeVideoInfo(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal("value", file.MetadataSerialized["key"])
+
+		info := VideoInfoOf(file)
+		asserts.NotNil(info)
+		asserts.False(info.Unprobable)
+		asserts.Equal(90.5, info.Duration)
+		asserts.Equal(1920, info.Width)
+		asserts.Equal(1080, info.Height)
+		asserts.Equal("h264", info.Codec)
+		asserts.EqualValues(4000000, info.Bitrate)
+	}
+
+	// 无法解析，标记后不返回错误
+	{
+		probeVideo = func(ctx context.Context, ffprobe, input string) (*transcode.MediaInfo, error) {
+			return nil, errors.New("invalid data found when processing input")
+		}
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.mp4", SourceName: "1.mp4"}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(fs.ProbeVideoInfo(context.Background(), file))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(&serializer.VideoInfo{Unprobable: true}, VideoInfoOf(file))
+	}
+
+	// 未安装 ffprobe
+	{
+		probeVideo = transcode.Probe
+		cache.Set("setting_video_transcode_ffprobe", "/nonexistent/ffprobe", 0)
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.mp4", SourceName: "1.mp4"}
+		asserts.Error(fs.ProbeVideoInfo(context.Background(), file))
+		asserts.Nil(VideoInfoOf(file))
+	}
+}
+
+func TestHookProbeVideoInfo(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_temp_path", "temp", 0)
+	cache.Set("setting_video_probe_exts", "mp4", 0)
+	handler := newMemoryDriver()
+	handler.objects["1.mp4"] = []byte("video")
+	fs := &FileSystem{User: &model.User{}, Handler: handler}
+	defer func() { probeVideo = transcode.Probe }()
+
+	// 未开启
+	{
+		cache.Set("setting_video_probe_enabled", "0", 0)
+		asserts.NoError(HookProbeVideoInfo(context.Background(), fs, &fsctx.FileStream{
+			Model: &model.File{Name: "1.mp4"},
+		}))
+	}
+
+	cache.Set("setting_video_probe_enabled", "1", 0)
+	defer cache.Set("setting_video_probe_enabled", "0", 0)
+
+	// 非视频文件
+	{
+		asserts.NoError(HookProbeVideoInfo(context.Background(), fs, &fsctx.FileStream{
+			Model: &model.File{Name: "1.txt"},
+		}))
+	}
+
+	// 后台读取
+	{
+		probeVideo = func(ctx context.Context, ffprobe, input string) (*transcode.MediaInfo, error) {
+			return &transcode.MediaInfo{VideoCodec: "h264", Width: 640, Height: 360}, nil
+		}
+		file := &model.File{Model: gorm.Model{ID: 1}, Name: "1.mp4", SourceName: "1.mp4"}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		waiter := &PostProcessWaiter{}
+		ctx := context.WithValue(context.Background(), fsctx.PostProcessWaiterCtx, waiter)
+		asserts.NoError(HookProbeVideoInfo(ctx, fs, &fsctx.FileStream{Model: file}))
+		asserts.True(waiter.Wait(time.Second))
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Equal(640, VideoInfoOf(file).Width)
+	}
+}
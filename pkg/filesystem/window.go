@@ -0,0 +1,176 @@
+package filesystem
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+/* ================
+	 上传时间段相关
+   ================
+*/
+
+// UploadWindow 允许上传的时间段，End 不大于 Start 时表示跨越午夜，
+// 午夜后的部分属于 Start 所在的星期
+type UploadWindow struct {
+	Weekdays [7]bool // 适用的星期，下标为 time.Weekday
+	Start    int     // 开始时间，距零点的分钟数
+	End      int     // 结束时间，距零点的分钟数
+}
+
+// ParseUploadWindow 解析形如 "1-5 09:00-18:00" 的时间段，星期部分可省略表示每天，
+// 0 或 7 表示周日，多个星期或范围以逗号分隔，如 "0,6 10:00-12:00"
+func ParseUploadWindow(spec string) (UploadWindow, error) {
+	var window UploadWindow
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+		for i := range window.Weekdays {
+			window.Weekdays[i] = true
+		}
+	case 2:
+		if err := window.parseWeekdays(fields[0]); err != nil {
+			return window, err
+		}
+		fields = fields[1:]
+	default:
+		return window, fmt.Errorf("invalid upload window %q", spec)
+	}
+
+	times := strings.Split(fields[0], "-")
+	if len(times) != 2 {
+		return window, fmt.Errorf("invalid time range %q", fields[0])
+	}
+
+	var err error
+	if window.Start, err = parseClock(times[0]); err != nil {
+		return window, err
+	}
+	if window.End, err = parseClock(times[1]); err != nil {
+		return window, err
+	}
+
+	return window, nil
+}
+
+func (window *UploadWindow) parseWeekdays(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil || from < 0 || from > 7 {
+			return fmt.Errorf("invalid weekday %q", part)
+		}
+
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(bounds[1]); err != nil || to < from || to > 7 {
+				return fmt.Errorf("invalid weekday range %q", part)
+			}
+		}
+
+		for day := from; day <= to; day++ {
+			window.Weekdays[day%7] = true
+		}
+	}
+
+	return nil
+}
+
+// parseClock 解析 HH:MM 格式的时间，返回距零点的分钟数，允许 24:00
+func parseClock(clock string) (int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+
+	return hour*60 + minute, nil
+}
+
+// Contains 返回 t 是否位于时间段内，t 应已转换至时间段所用的时区
+func (window UploadWindow) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	if window.Start < window.End {
+		return window.Weekdays[today] && minute >= window.Start && minute < window.End
+	}
+
+	yesterday := (today + 6) % 7
+	return (window.Weekdays[today] && minute >= window.Start) ||
+		(window.Weekdays[yesterday] && minute < window.End)
+}
+
+// NextStart 返回 t 之后时间段最近一次开始的时间，未设定任何星期时返回零值
+func (window UploadWindow) NextStart(t time.Time) time.Time {
+	for day := 0; day <= 7; day++ {
+		date := t.AddDate(0, 0, day)
+		if !window.Weekdays[date.Weekday()] {
+			continue
+		}
+
+		start := time.Date(date.Year(), date.Month(), date.Day(), 0, window.Start, 0, 0, t.Location())
+		if start.After(t) {
+			return start
+		}
+	}
+
+	return time.Time{}
+}
+
+// UploadWindows 返回用户组设定的允许上传时间段及其时区，无法解析的设定将被忽略
+func (fs *FileSystem) UploadWindows() ([]UploadWindow, *time.Location) {
+	if fs.User == nil {
+		return nil, time.Local
+	}
+
+	options := fs.User.Group.OptionsSerialized
+	windows := make([]UploadWindow, 0, len(options.UploadWindows))
+	for _, spec := range options.UploadWindows {
+		window, err := ParseUploadWindow(spec)
+		if err != nil {
+			util.Log().Warning("Ignored invalid upload window of group %d: %s", fs.User.GroupID, err)
+			continue
+		}
+		windows = append(windows, window)
+	}
+
+	loc := time.Local
+	if options.UploadTimezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(options.UploadTimezone); err != nil {
+			util.Log().Warning("Invalid upload timezone of group %d, using server timezone: %s", fs.User.GroupID, err)
+			loc = time.Local
+		}
+	}
+
+	return windows, loc
+}
+
+// nextUploadWindow 返回 now 是否位于任一时间段内，不在时同时返回最近一次允许上传的时间
+func nextUploadWindow(windows []UploadWindow, now time.Time) (bool, time.Time) {
+	var next time.Time
+	for _, window := range windows {
+		if window.Contains(now) {
+			return true, now
+		}
+
+		if start := window.NextStart(now); !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+
+	return false, next
+}
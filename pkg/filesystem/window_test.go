@@ -0,0 +1,130 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUploadWindow(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 每天
+	{
+		window, err := ParseUploadWindow("09:00-18:30")
+		asserts.NoError(err)
+		asserts.Equal([7]bool{true, true, true, true, true, true, true}, window.Weekdays)
+		asserts.Equal(9*60, window.Start)
+		asserts.Equal(18*60+30, window.End)
+	}
+
+	// 指定星期
+	{
+		window, err := ParseUploadWindow("1-5,7 00:00-24:00")
+		asserts.NoError(err)
+		asserts.Equal([7]bool{true, true, true, true, true, true, false}, window.Weekdays)
+		asserts.Equal(24*60, window.End)
+	}
+
+	// 格式错误
+	for _, spec := range []string{"", "1-5", "8 09:00-18:00", "5-1 09:00-18:00", "09:00", "9-18", "24:30-25:00", "1 2 09:00-18:00"} {
+		_, err := ParseUploadWindow(spec)
+		asserts.Error(err, spec)
+	}
+}
+
+func TestUploadWindow_Contains(t *testing.T) {
+	asserts := assert.New(t)
+	// 2022-01-03 为周一
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2022, 1, 3, hour, minute, 0, 0, time.UTC)
+	}
+
+	window, _ := ParseUploadWindow("1-5 09:00-18:00")
+	asserts.True(window.Contains(monday(9, 0)))
+	asserts.True(window.Contains(monday(17, 59)))
+	asserts.False(window.Contains(monday(18, 0)))
+	asserts.False(window.Contains(monday(8, 59)))
+	asserts.False(window.Contains(monday(12, 0).AddDate(0, 0, -1)))
+
+	// 跨越午夜
+	window, _ = ParseUploadWindow("0 22:00-06:00")
+	asserts.True(window.Contains(monday(5, 0)))
+	asserts.False(window.Contains(monday(23, 0)))
+	asserts.True(window.Contains(monday(23, 0).AddDate(0, 0, -1)))
+	asserts.False(window.Contains(monday(6, 0)))
+}
+
+func TestUploadWindow_NextStart(t *testing.T) {
+	asserts := assert.New(t)
+	loc := time.FixedZone("UTC+8", 8*3600)
+	friday := time.Date(2022, 1, 7, 19, 0, 0, 0, loc)
+
+	window, _ := ParseUploadWindow("1-5 09:00-18:00")
+	asserts.Equal(time.Date(2022, 1, 10, 9, 0, 0, 0, loc), window.NextStart(friday))
+
+	window, _ = ParseUploadWindow("20:00-21:00")
+	asserts.Equal(time.Date(2022, 1, 7, 20, 0, 0, 0, loc), window.NextStart(friday))
+
+	asserts.True(UploadWindow{}.NextStart(friday).IsZero())
+
+	// 取最早的时间段
+	first, _ := ParseUploadWindow("6 10:00-12:00")
+	second, _ := ParseUploadWindow("1-5 09:00-18:00")
+	allowed, next := nextUploadWindow([]UploadWindow{second, first}, friday)
+	asserts.False(allowed)
+	asserts.Equal(time.Date(2022, 1, 8, 10, 0, 0, 0, loc), next)
+}
+
+func TestFileSystem_UploadWindows(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+
+	windows, loc := fs.UploadWindows()
+	asserts.Empty(windows)
+	asserts.Equal(time.Local, loc)
+
+	fs.User.Group.OptionsSerialized.UploadWindows = []string{"1-5 09:00-18:00", "invalid"}
+	fs.User.Group.OptionsSerialized.UploadTimezone = "UTC"
+	windows, loc = fs.UploadWindows()
+	asserts.Len(windows, 1)
+	asserts.Equal(time.UTC, loc)
+
+	fs.User.Group.OptionsSerialized.UploadTimezone = "Invalid/Zone"
+	_, loc = fs.UploadWindows()
+	asserts.Equal(time.Local, loc)
+}
+
+func TestHookValidateUploadWindow(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &FileSystem{User: &model.User{}}
+	today := time.Now().In(time.UTC).Weekday()
+
+	// 全天允许
+	{
+		window, _ := ParseUploadWindow("00:00-24:00")
+		hook := HookValidateUploadWindow([]UploadWindow{window}, time.UTC)
+		asserts.NoError(hook(context.Background(), fs, &fsctx.FileStream{}))
+	}
+
+	// 仅明天允许
+	{
+		window, _ := ParseUploadWindow(fmt.Sprintf("%d 00:00-24:00", (today+1)%7))
+		hook := HookValidateUploadWindow([]UploadWindow{window}, time.UTC)
+		err := hook(context.Background(), fs, &fsctx.FileStream{})
+		asserts.Error(err)
+		appErr := err.(serializer.AppError)
+		asserts.Equal(serializer.CodeUploadWindowClosed, appErr.Code)
+		data := appErr.Data.(map[string]string)
+		asserts.Equal("UTC", data["timezone"])
+		next, parseErr := time.Parse(time.RFC3339, data["next"])
+		asserts.NoError(parseErr)
+		asserts.Equal((today+1)%7, next.Weekday())
+	}
+}
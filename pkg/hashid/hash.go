@@ -16,6 +16,7 @@ const (
 	TagID           // 标签ID
 	PolicyID        // 存储策略ID
 	SourceLinkID
+	TaskID // 任务ID
 )
 
 var (
@@ -0,0 +1,197 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
+)
+
+const (
+	// checkTTL 检查结果的缓存时长，避免频繁探测时反复访问依赖服务
+	checkTTL = 5 * time.Second
+	// checkTimeout 单项依赖检查的超时时长
+	checkTimeout = 3 * time.Second
+	// cacheProbeKey 缓存读写检查使用的键
+	cacheProbeKey = "health_probe"
+	// storageProbePath 存储端检查查询的对象路径，对象不存在不影响检查结果
+	storageProbePath = ".health_probe"
+)
+
+// Result 单项依赖的检查结果
+type Result struct {
+	Healthy bool   `json:"healthy"`
+	Latency int64  `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Status 就绪检查结果，任一依赖不可用时 Ready 为 false
+type Status struct {
+	Ready     bool               `json:"ready"`
+	Checks    map[string]*Result `json:"checks"`
+	CheckedAt time.Time          `json:"checked_at"`
+}
+
+// PublicStatus 对外公开的就绪检查结果，仅包含各依赖是否可用，不含错误详情
+type PublicStatus struct {
+	Ready     bool            `json:"ready"`
+	Checks    map[string]bool `json:"checks"`
+	CheckedAt time.Time       `json:"checked_at"`
+}
+
+// Public 返回去除错误详情后的检查结果
+func (s *Status) Public() *PublicStatus {
+	res := &PublicStatus{
+		Ready:     s.Ready,
+		Checks:    make(map[string]bool, len(s.Checks)),
+		CheckedAt: s.CheckedAt,
+	}
+	for name, check := range s.Checks {
+		res.Checks[name] = check.Healthy
+	}
+
+	return res
+}
+
+// Checker 依赖检查函数
+type Checker func(ctx context.Context) error
+
+// Checkers 参与就绪检查的依赖
+var Checkers = map[string]Checker{
+	"database": CheckDatabase,
+	"cache":    CheckCache,
+	"storage":  CheckStorage,
+}
+
+var (
+	lastStatus *Status
+	lock       sync.Mutex
+)
+
+// Check 返回各依赖的就绪状态，结果在 checkTTL 内复用。检查结果为所有请求共享，
+// 因此不使用请求的上下文，避免个别请求超时或断开导致各依赖被误判为不可用
+func Check() *Status {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if lastStatus != nil && time.Since(lastStatus.CheckedAt) < checkTTL {
+		return lastStatus
+	}
+
+	status := &Status{
+		Ready:     true,
+		Checks:    make(map[string]*Result, len(Checkers)),
+		CheckedAt: time.Now(),
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, checker := range Checkers {
+		wg.Add(1)
+		go func(name string, checker Checker) {
+			defer wg.Done()
+			res := run(context.Background(), checker)
+
+			mu.Lock()
+			defer mu.Unlock()
+			status.Checks[name] = res
+			if !res.Healthy {
+				status.Ready = false
+			}
+		}(name, checker)
+	}
+	wg.Wait()
+
+	lastStatus = status
+	return status
+}
+
+// Reset 清除缓存的检查结果
+func Reset() {
+	lock.Lock()
+	defer lock.Unlock()
+	lastStatus = nil
+}
+
+func run(ctx context.Context, checker Checker) *Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- checker(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errChan:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := &Result{
+		Healthy: err == nil,
+		Latency: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// CheckDatabase 检查数据库连接
+func CheckDatabase(ctx context.Context) error {
+	if model.DB == nil {
+		return errors.New("database is not initialized")
+	}
+
+	return model.DB.DB().PingContext(ctx)
+}
+
+// CheckCache 通过一次读写检查缓存服务
+func CheckCache(ctx context.Context) error {
+	value := fmt.Sprintf("%d", time.Now().UnixNano())
+	if err := cache.Set(cacheProbeKey, value, 60); err != nil {
+		return err
+	}
+
+	if res, ok := cache.Get(cacheProbeKey); !ok || res != value {
+		return errors.New("cache read back mismatch")
+	}
+
+	return nil
+}
+
+// CheckStorage 查询首个存储策略下的单个对象，检查存储端是否可用。对象不存在视为可用；
+// 不支持查询单个对象的存储端改为列取一个不存在的目录
+func CheckStorage(ctx context.Context) error {
+	var policy model.Policy
+	if err := model.DB.Order("id asc").First(&policy).Error; err != nil {
+		return fmt.Errorf("failed to get storage policy: %w", err)
+	}
+
+	fs := &filesystem.FileSystem{User: &model.User{}, Policy: &policy}
+	if err := fs.DispatchHandler(); err != nil {
+		return err
+	}
+
+	_, err := driver.Stat(ctx, fs.Handler, storageProbePath)
+	switch {
+	case errors.Is(err, driver.ErrObjectMissing):
+		return nil
+	case errors.Is(err, driver.ErrStatNotSupported):
+		_, err = fs.Handler.List(ctx, storageProbePath, false)
+	}
+
+	return err
+}
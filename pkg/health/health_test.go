@@ -0,0 +1,114 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+var mock sqlmock.Sqlmock
+
+// TestMain 初始化数据库Mock
+func TestMain(m *testing.M) {
+	var db *sql.DB
+	var err error
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		panic("An error was not expected when opening a stub database connection")
+	}
+	model.DB, _ = gorm.Open("mysql", db)
+	defer db.Close()
+	m.Run()
+}
+
+func TestCheck(t *testing.T) {
+	asserts := assert.New(t)
+	origin := Checkers
+	defer func() {
+		Checkers = origin
+		Reset()
+	}()
+
+	// 全部可用
+	{
+		Reset()
+		calls := 0
+		Checkers = map[string]Checker{
+			"a": func(ctx context.Context) error {
+				calls++
+				return nil
+			},
+		}
+		status := Check()
+		asserts.True(status.Ready)
+		asserts.True(status.Checks["a"].Healthy)
+
+		// 缓存期内复用结果
+		asserts.Same(status, Check())
+		asserts.Equal(1, calls)
+	}
+
+	// 单项不可用
+	{
+		Reset()
+		Checkers = map[string]Checker{
+			"a": func(ctx context.Context) error { return nil },
+			"b": func(ctx context.Context) error { return errors.New("error") },
+		}
+		status := Check()
+		asserts.False(status.Ready)
+		asserts.True(status.Checks["a"].Healthy)
+		asserts.False(status.Checks["b"].Healthy)
+		asserts.Equal("error", status.Checks["b"].Error)
+	}
+}
+
+func TestStatus_Public(t *testing.T) {
+	asserts := assert.New(t)
+	status := &Status{
+		Ready: false,
+		Checks: map[string]*Result{
+			"a": {Healthy: true, Latency: 1},
+			"b": {Healthy: false, Latency: 2, Error: "error"},
+		},
+	}
+
+	res := status.Public()
+	asserts.False(res.Ready)
+	asserts.Equal(map[string]bool{"a": true, "b": false}, res.Checks)
+}
+
+func TestCheckDatabase(t *testing.T) {
+	asserts := assert.New(t)
+
+	asserts.NoError(CheckDatabase(context.Background()))
+}
+
+func TestCheckCache(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.NoError(CheckCache(context.Background()))
+}
+
+func TestCheckStorage(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 无存储策略
+	{
+		mock.ExpectQuery("SELECT(.+)policies(.+)").WillReturnError(errors.New("error"))
+		asserts.Error(CheckStorage(context.Background()))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 本地存储策略
+	{
+		mock.ExpectQuery("SELECT(.+)policies(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "type"}).AddRow(1, "local"))
+		asserts.NoError(CheckStorage(context.Background()))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
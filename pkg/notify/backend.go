@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/email"
+	"github.com/cloudreve/Cloudreve/v3/pkg/request"
+)
+
+// ErrWebhookNotSet 未设置通知 Webhook 地址
+var ErrWebhookNotSet = errors.New("notification webhook url is not set")
+
+// NoopBackend 不发送任何通知
+type NoopBackend struct{}
+
+// Deliver 丢弃通知
+func (NoopBackend) Deliver(ctx context.Context, recipient *model.User, n *Notification) error {
+	return nil
+}
+
+// EmailBackend 通过邮件发送通知
+type EmailBackend struct{}
+
+// Deliver 将通知发送至接收方的邮箱
+func (EmailBackend) Deliver(ctx context.Context, recipient *model.User, n *Notification) error {
+	return email.Send(recipient.Email, n.Title, n.Body)
+}
+
+// InAppBackend 保存为站内通知，用户登录后查看
+type InAppBackend struct{}
+
+// Deliver 为接收方创建站内通知
+func (InAppBackend) Deliver(ctx context.Context, recipient *model.User, n *Notification) error {
+	notification := &model.Notification{
+		UserID: recipient.ID,
+		Event:  string(n.Event),
+		Title:  n.Title,
+		Body:   n.Body,
+	}
+	return notification.Create()
+}
+
+// WebhookBackend 以 JSON 格式将通知 POST 至 notify_webhook_url
+type WebhookBackend struct {
+	Client request.Client // 为空时使用默认客户端
+}
+
+// webhookPayload Webhook 请求正文
+type webhookPayload struct {
+	Event     Event                  `json:"event"`
+	Title     string                 `json:"title"`
+	Body      string                 `json:"body"`
+	UserID    uint                   `json:"user_id"`
+	UserEmail string                 `json:"user_email"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Time      time.Time              `json:"time"`
+}
+
+// Deliver 将通知及接收方信息发送至 Webhook
+func (b WebhookBackend) Deliver(ctx context.Context, recipient *model.User, n *Notification) error {
+	target := model.GetSettingByName("notify_webhook_url")
+	if target == "" {
+		return ErrWebhookNotSet
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Event:     n.Event,
+		Title:     n.Title,
+		Body:      n.Body,
+		UserID:    recipient.ID,
+		UserEmail: recipient.Email,
+		Data:      n.Data,
+		Time:      time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	client := b.Client
+	if client == nil {
+		client = request.NewClient()
+	}
+
+	timeout := time.Duration(model.GetIntSetting("notify_webhook_timeout", 10)) * time.Second
+	return client.Request(
+		"POST",
+		target,
+		bytes.NewReader(body),
+		request.WithContext(ctx),
+		request.WithTimeout(timeout),
+		request.WithHeader(http.Header{"Content-Type": {"application/json"}}),
+	).CheckHTTPResponse(200).Err
+}
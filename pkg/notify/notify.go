@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// Event 通知事件类型
+type Event string
+
+const (
+	// EventQuotaWarning 用户已用容量超过警告阈值
+	EventQuotaWarning Event = "quota_warning"
+	// EventQuarantine 文件未通过校验被隔离
+	EventQuarantine Event = "quarantine"
+	// EventSourceBroken 文件在存储端的数据已丢失
+	EventSourceBroken Event = "source_broken"
+	// EventSensitiveData 上传的文件中检测到敏感数据
+	EventSensitiveData Event = "sensitive_data"
+	// EventApprovalPending 有上传的文件等待审核
+	EventApprovalPending Event = "approval_pending"
+	// EventUploadRejected 上传的文件未通过审核被删除
+	EventUploadRejected Event = "upload_rejected"
+)
+
+// 通知接收方
+const (
+	// RecipientUser 事件相关的用户
+	RecipientUser = "user"
+	// RecipientAdmin 所有可登录的管理员
+	RecipientAdmin = "admin"
+)
+
+var (
+	// ErrUnknownBackend 未注册的通知渠道
+	ErrUnknownBackend = errors.New("unknown notification backend")
+)
+
+// Notification 一条待发送的通知
+type Notification struct {
+	Event Event
+	User  *model.User // 事件相关的用户，为空时不会发送给 user 接收方
+	Title string
+	Body  string
+	Data  map[string]interface{} // 附加信息，由 webhook 等结构化渠道一并发送
+}
+
+// Backend 通知发送渠道
+type Backend interface {
+	// Deliver 将通知 n 发送给 recipient
+	Deliver(ctx context.Context, recipient *model.User, n *Notification) error
+}
+
+var (
+	backendsLock sync.RWMutex
+	backends     = map[string]Backend{
+		"none":    NoopBackend{},
+		"email":   EmailBackend{},
+		"inapp":   InAppBackend{},
+		"webhook": WebhookBackend{},
+	}
+)
+
+// Register 注册名为 name 的通知渠道，已存在时替换
+func Register(name string, backend Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	backends[name] = backend
+}
+
+// getBackend 获取名为 name 的通知渠道
+func getBackend(name string) (Backend, error) {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+	if backend, ok := backends[name]; ok {
+		return backend, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+}
+
+// splitSetting 拆分以逗号分隔的设置项，忽略空项
+func splitSetting(name string) []string {
+	res := make([]string, 0)
+	for _, item := range strings.Split(model.GetSettingByName(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// Recipients 按 notify_<事件>_to 设置返回通知的接收用户，同一用户只出现一次
+func Recipients(n *Notification) []*model.User {
+	recipients := make([]*model.User, 0)
+	added := make(map[uint]bool)
+	add := func(user *model.User) {
+		if !added[user.ID] {
+			added[user.ID] = true
+			recipients = append(recipients, user)
+		}
+	}
+
+	for _, to := range splitSetting(fmt.Sprintf("notify_%s_to", n.Event)) {
+		switch to {
+		case RecipientUser:
+			if n.User != nil {
+				add(n.User)
+			}
+		case RecipientAdmin:
+			admins := model.GetActiveAdminUsers()
+			for i := range admins {
+				add(&admins[i])
+			}
+		default:
+			util.Log().Warning("Unknown recipient %q of notification %q.", to, n.Event)
+		}
+	}
+
+	return recipients
+}
+
+// Dispatch 通过 notify_backend 设置的全部渠道将通知发送给各接收方，单个渠道或接收方
+// 发送失败不影响其他发送，返回最后一个错误
+func Dispatch(ctx context.Context, n *Notification) error {
+	recipients := Recipients(n)
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	var lastErr error
+	for _, name := range splitSetting("notify_backend") {
+		backend, err := getBackend(name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for _, recipient := range recipients {
+			if err := backend.Deliver(ctx, recipient, n); err != nil {
+				util.Log().Warning("Failed to deliver notification %q to user #%d via %q: %s", n.Event, recipient.ID, name, err)
+				lastErr = err
+			}
+		}
+	}
+
+	return lastErr
+}
+
+// Send 在后台发送通知，发送失败时仅记录日志
+func Send(n *Notification) {
+	go func() {
+		if err := Dispatch(context.Background(), n); err != nil {
+			util.Log().Debug("Notification %q is not fully delivered: %s", n.Event, err)
+		}
+	}()
+}
@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+var mock sqlmock.Sqlmock
+
+// TestMain 初始化数据库Mock
+func TestMain(m *testing.M) {
+	var db *sql.DB
+	var err error
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		panic("An error was not expected when opening a stub database connection")
+	}
+	model.DB, _ = gorm.Open("mysql", db)
+	defer db.Close()
+	m.Run()
+}
+
+// recordBackend 记录收到的通知
+type recordBackend struct {
+	mu         sync.Mutex
+	recipients []uint
+	err        error
+}
+
+func (b *recordBackend) Deliver(ctx context.Context, recipient *model.User, n *Notification) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recipients = append(b.recipients, recipient.ID)
+	return b.err
+}
+
+func TestRecipients(t *testing.T) {
+	asserts := assert.New(t)
+	owner := &model.User{Model: gorm.Model{ID: 2}}
+
+	// 未设置接收方
+	{
+		cache.Set("setting_notify_quota_warning_to", "", 0)
+		asserts.Empty(Recipients(&Notification{Event: EventQuotaWarning, User: owner}))
+	}
+
+	// 发送给用户
+	{
+		cache.Set("setting_notify_quota_warning_to", "user", 0)
+		asserts.Equal([]*model.User{owner}, Recipients(&Notification{Event: EventQuotaWarning, User: owner}))
+		asserts.Empty(Recipients(&Notification{Event: EventQuotaWarning}))
+	}
+
+	// 发送给用户及管理员，同一用户只发送一次
+	{
+		cache.Set("setting_notify_source_broken_to", "user, admin, unknown", 0)
+		mock.ExpectQuery("SELECT(.+)users(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(1, "admin@cloudreve.org").AddRow(2, "user@cloudreve.org"))
+		recipients := Recipients(&Notification{Event: EventSourceBroken, User: owner})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Len(recipients, 2)
+		asserts.EqualValues(2, recipients[0].ID)
+		asserts.EqualValues(1, recipients[1].ID)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_notify_quarantine_to", "user", 0)
+	n := &Notification{Event: EventQuarantine, User: &model.User{Model: gorm.Model{ID: 1}}}
+
+	// 没有接收方
+	{
+		asserts.NoError(Dispatch(context.Background(), &Notification{Event: EventQuarantine}))
+	}
+
+	// 多个渠道，单个渠道失败不影响其他渠道
+	{
+		failed := &recordBackend{err: errors.New("error")}
+		succeeded := &recordBackend{}
+		Register("test_failed", failed)
+		Register("test_succeeded", succeeded)
+		cache.Set("setting_notify_backend", "test_failed,unknown,test_succeeded", 0)
+		asserts.Error(Dispatch(context.Background(), n))
+		asserts.Equal([]uint{1}, failed.recipients)
+		asserts.Equal([]uint{1}, succeeded.recipients)
+	}
+
+	// 未注册的渠道
+	{
+		cache.Set("setting_notify_backend", "unknown", 0)
+		asserts.ErrorIs(Dispatch(context.Background(), n), ErrUnknownBackend)
+	}
+
+	// 不发送
+	{
+		cache.Set("setting_notify_backend", "none", 0)
+		asserts.NoError(Dispatch(context.Background(), n))
+	}
+}
+
+func TestInAppBackend_Deliver(t *testing.T) {
+	asserts := assert.New(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT(.+)notifications(.+)").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 1, "quarantine", "title", "body", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err := InAppBackend{}.Deliver(context.Background(), &model.User{Model: gorm.Model{ID: 1}}, &Notification{
+		Event: EventQuarantine,
+		Title: "title",
+		Body:  "body",
+	})
+	asserts.NoError(err)
+	asserts.NoError(mock.ExpectationsWereMet())
+}
+
+func TestWebhookBackend_Deliver(t *testing.T) {
+	asserts := assert.New(t)
+	recipient := &model.User{Model: gorm.Model{ID: 1}, Email: "user@cloudreve.org"}
+	n := &Notification{Event: EventQuotaWarning, Title: "title", Body: "body", Data: map[string]interface{}{"used": 90}}
+
+	// 未设置地址
+	{
+		cache.Set("setting_notify_webhook_url", "", 0)
+		asserts.Equal(ErrWebhookNotSet, WebhookBackend{}.Deliver(context.Background(), recipient, n))
+	}
+
+	// 成功
+	{
+		var payload map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			asserts.Equal("POST", r.Method)
+			asserts.Equal("application/json", r.Header.Get("Content-Type"))
+			body, _ := ioutil.ReadAll(r.Body)
+			asserts.NoError(json.Unmarshal(body, &payload))
+		}))
+		defer server.Close()
+		cache.Set("setting_notify_webhook_url", server.URL, 0)
+		asserts.NoError(WebhookBackend{}.Deliver(context.Background(), recipient, n))
+		asserts.Equal("quota_warning", payload["event"])
+		asserts.Equal("title", payload["title"])
+		asserts.Equal("user@cloudreve.org", payload["user_email"])
+		asserts.EqualValues(1, payload["user_id"])
+		asserts.Equal(map[string]interface{}{"used": float64(90)}, payload["data"])
+	}
+
+	// 服务端返回错误
+	{
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+		cache.Set("setting_notify_webhook_url", server.URL, 0)
+		asserts.Error(WebhookBackend{}.Deliver(context.Background(), recipient, n))
+	}
+}
@@ -0,0 +1,145 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// throttledBodyLimit 被限流的响应中读取并缓存的响应体大小上限
+const throttledBodyLimit = 64 << 10
+
+var globalConcurrencyLimiters = &concurrencyLimiters{limiters: make(map[uint]*concurrencyLimiter)}
+
+// ConcurrencyStat 存储策略的并发请求状态
+type ConcurrencyStat struct {
+	// Limit 最大并发请求数
+	Limit int `json:"limit"`
+	// InFlight 正在进行的请求数
+	InFlight int `json:"in_flight"`
+	// Queued 等待空闲名额的请求数
+	Queued int `json:"queued"`
+}
+
+// concurrencyLimiters 各存储策略的并发请求限制
+type concurrencyLimiters struct {
+	mu       sync.Mutex
+	limiters map[uint]*concurrencyLimiter
+}
+
+// get 返回存储策略的并发限制，限制数改变时重新创建，已占用旧名额的请求在完成后释放至旧的限制
+func (l *concurrencyLimiters) get(policyID uint, limit int) *concurrencyLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, ok := l.limiters[policyID]
+	if !ok || cap(limiter.slots) != limit {
+		limiter = &concurrencyLimiter{slots: make(chan struct{}, limit)}
+		l.limiters[policyID] = limiter
+	}
+
+	return limiter
+}
+
+// stats 返回各存储策略当前的并发请求状态
+func (l *concurrencyLimiters) stats() map[uint]ConcurrencyStat {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	res := make(map[uint]ConcurrencyStat, len(l.limiters))
+	for id, limiter := range l.limiters {
+		res[id] = ConcurrencyStat{
+			Limit:    cap(limiter.slots),
+			InFlight: len(limiter.slots),
+			Queued:   int(atomic.LoadInt64(&limiter.queued)),
+		}
+	}
+
+	return res
+}
+
+// PolicyConcurrencyStats 返回设定了并发请求限制的各存储策略当前的请求状态
+func PolicyConcurrencyStats() map[uint]ConcurrencyStat {
+	return globalConcurrencyLimiters.stats()
+}
+
+// concurrencyLimiter 限制同时进行的请求数，超出时排队等待
+type concurrencyLimiter struct {
+	slots  chan struct{}
+	queued int64
+}
+
+// acquire 占用一个名额，返回释放名额的函数，可重复调用
+func (l *concurrencyLimiter) acquire(ctx context.Context) (func(), error) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		atomic.AddInt64(&l.queued, 1)
+		defer atomic.AddInt64(&l.queued, -1)
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.slots })
+	}, nil
+}
+
+// concurrencyTransport 限制发往同一存储策略的并发请求数。响应体读取完毕并关闭前请求仍占用名额；
+// 被存储端限流的响应会先缓存响应体并立即释放名额，调用方退避等待重试期间不占用名额
+type concurrencyTransport struct {
+	base    http.RoundTripper
+	limiter *concurrencyLimiter
+}
+
+// RoundTrip 实现 http.RoundTripper 接口
+func (t *concurrencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		release()
+		return resp, err
+	}
+
+	if isThrottled(resp.StatusCode) {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, throttledBodyLimit))
+		resp.Body.Close()
+		release()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// isThrottled 返回响应状态码是否表示请求被存储端限流
+func isThrottled(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// releaseOnClose 关闭响应体时释放并发名额
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
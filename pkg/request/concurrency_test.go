@@ -0,0 +1,80 @@
+package request
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	asserts := assert.New(t)
+	limiters := &concurrencyLimiters{limiters: make(map[uint]*concurrencyLimiter)}
+	limiter := limiters.get(1, 1)
+	asserts.Same(limiter, limiters.get(1, 1))
+
+	release, err := limiter.acquire(context.Background())
+	asserts.NoError(err)
+	asserts.Equal(ConcurrencyStat{Limit: 1, InFlight: 1}, limiters.stats()[1])
+
+	// 名额已满时排队，上下文取消后放弃
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(ctx)
+	asserts.Equal(context.DeadlineExceeded, err)
+
+	// 重复释放
+	release()
+	release()
+	asserts.Equal(ConcurrencyStat{Limit: 1}, limiters.stats()[1])
+
+	// 限制数改变
+	asserts.NotSame(limiter, limiters.get(1, 2))
+	asserts.Equal(2, limiters.stats()[1].Limit)
+}
+
+func TestConcurrencyTransport(t *testing.T) {
+	asserts := assert.New(t)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	policy := &model.Policy{}
+	policy.ID = 100
+	policy.OptionsSerialized.MaxConcurrency = 1
+	transport, err := NewOutboundTransport(policy)
+	asserts.NoError(err)
+	client := &http.Client{Transport: transport}
+
+	// 响应体关闭前占用名额
+	resp, err := client.Get(server.URL)
+	asserts.NoError(err)
+	asserts.Equal(1, PolicyConcurrencyStats()[100].InFlight)
+	body, _ := ioutil.ReadAll(resp.Body)
+	asserts.Equal("content", string(body))
+	resp.Body.Close()
+	asserts.Equal(0, PolicyConcurrencyStats()[100].InFlight)
+
+	// 被限流的响应立即释放名额
+	status = http.StatusTooManyRequests
+	resp, err = client.Get(server.URL)
+	asserts.NoError(err)
+	asserts.Equal(0, PolicyConcurrencyStats()[100].InFlight)
+	body, _ = ioutil.ReadAll(resp.Body)
+	asserts.Equal("content", string(body))
+	resp.Body.Close()
+
+	// 请求失败
+	server.Close()
+	_, err = client.Get(server.URL)
+	asserts.Error(err)
+	asserts.Equal(0, PolicyConcurrencyStats()[100].InFlight)
+}
@@ -0,0 +1,163 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrURLNotAllowed 目标地址不被允许访问
+	ErrURLNotAllowed = errors.New("target URL is not allowed")
+	// ErrTooManyRedirects 重定向次数超出限制
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// forbiddenNetworks 除私有、回环等地址外，额外禁止访问的网段
+var forbiddenNetworks = []string{
+	"0.0.0.0/8",     // 本网络
+	"100.64.0.0/10", // 运营商级 NAT
+	"192.0.0.0/24",  // IETF 协议分配
+	"198.18.0.0/15", // 基准测试
+	"240.0.0.0/4",   // 保留地址
+	"64:ff9b::/96",  // NAT64，可映射到内网 IPv4
+}
+
+// forbiddenHosts 云服务商元数据服务等内部主机名
+var forbiddenHosts = []string{"localhost", "metadata.google.internal", "metadata"}
+
+// URLGuard 对服务端发起的请求进行 SSRF 防护，校验目标地址、
+// 连接时的实际 IP 以及每一次重定向
+type URLGuard struct {
+	// 允许访问的主机，为空时允许所有主机；以 . 开头时匹配其所有子域名
+	AllowedHosts []string
+	// 禁止访问的主机，规则同上
+	DeniedHosts []string
+	// 最多跟随的重定向次数
+	MaxRedirects int
+}
+
+// NewURLGuard 根据以逗号分隔的允许/禁止主机列表创建 URLGuard
+func NewURLGuard(allowed, denied string, maxRedirects int) *URLGuard {
+	return &URLGuard{
+		AllowedHosts: splitHosts(allowed),
+		DeniedHosts:  splitHosts(denied),
+		MaxRedirects: maxRedirects,
+	}
+}
+
+func splitHosts(hosts string) []string {
+	res := make([]string, 0)
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			res = append(res, host)
+		}
+	}
+	return res
+}
+
+// Check 校验 URL 的协议及主机名，主机名为 IP 时同时校验 IP 是否为内部地址
+func (guard *URLGuard) Check(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrURLNotAllowed, target.Scheme)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(target.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("%w: empty host", ErrURLNotAllowed)
+	}
+
+	for _, forbidden := range forbiddenHosts {
+		if host == forbidden || strings.HasSuffix(host, "."+forbidden) {
+			return fmt.Errorf("%w: internal host %q", ErrURLNotAllowed, host)
+		}
+	}
+
+	if matchHost(host, guard.DeniedHosts) {
+		return fmt.Errorf("%w: host %q is denied", ErrURLNotAllowed, host)
+	}
+
+	if len(guard.AllowedHosts) > 0 && !matchHost(host, guard.AllowedHosts) {
+		return fmt.Errorf("%w: host %q is not in allow list", ErrURLNotAllowed, host)
+	}
+
+	if ip := net.ParseIP(host); ip != nil && IsInternalIP(ip) {
+		return fmt.Errorf("%w: internal address %s", ErrURLNotAllowed, ip)
+	}
+
+	return nil
+}
+
+// matchHost 返回主机名是否匹配列表中的任一规则
+func matchHost(host string, rules []string) bool {
+	for _, rule := range rules {
+		if strings.HasPrefix(rule, ".") {
+			if host == rule[1:] || strings.HasSuffix(host, rule) {
+				return true
+			}
+		} else if host == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// IsInternalIP 返回 IP 是否为回环、私有、链路本地（包含云元数据服务）等不可从外部访问的地址
+func IsInternalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+
+	for _, cidr := range forbiddenNetworks {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HTTPClient 创建带有防护的 http.Client。连接建立前会再次校验解析后的实际 IP，
+// 以防止 DNS 重绑定；不使用环境变量中的代理设置
+func (guard *URLGuard) HTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || IsInternalIP(ip) {
+				return fmt.Errorf("%w: internal address %s", ErrURLNotAllowed, host)
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > guard.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return guard.Check(req.URL)
+		},
+	}
+}
@@ -0,0 +1,88 @@
+package request
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLGuard_Check(t *testing.T) {
+	a := assert.New(t)
+	guard := NewURLGuard("", "evil.com, .bad.org", 3)
+
+	for _, target := range []string{
+		"ftp://example.com/1.txt",
+		"file:///etc/passwd",
+		"http://localhost/",
+		"http://127.0.0.1:8080/",
+		"http://169.254.169.254/latest/meta-data",
+		"http://metadata.google.internal/",
+		"http://10.0.0.1/",
+		"http://[::1]/",
+		"http://[fd00::1]/",
+		"http://100.64.1.1/",
+		"http://evil.com/",
+		"http://a.bad.org/",
+		"http://bad.org/",
+	} {
+		u, _ := url.Parse(target)
+		a.ErrorIs(guard.Check(u), ErrURLNotAllowed, target)
+	}
+
+	u, _ := url.Parse("https://example.com/1.txt")
+	a.NoError(guard.Check(u))
+	u, _ = url.Parse("http://8.8.8.8/1.txt")
+	a.NoError(guard.Check(u))
+
+	// 允许列表
+	guard = NewURLGuard(".example.com", "", 3)
+	u, _ = url.Parse("https://cdn.example.com/1.txt")
+	a.NoError(guard.Check(u))
+	u, _ = url.Parse("https://example.org/1.txt")
+	a.ErrorIs(guard.Check(u), ErrURLNotAllowed)
+}
+
+func TestIsInternalIP(t *testing.T) {
+	a := assert.New(t)
+	a.True(IsInternalIP(net.ParseIP("192.168.1.1")))
+	a.True(IsInternalIP(net.ParseIP("0.0.0.0")))
+	a.True(IsInternalIP(net.ParseIP("fe80::1")))
+	a.False(IsInternalIP(net.ParseIP("1.1.1.1")))
+	a.False(IsInternalIP(net.ParseIP("2606:4700::1111")))
+}
+
+func TestURLGuard_HTTPClient(t *testing.T) {
+	a := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// 解析到内部地址的连接被拒绝
+	client := NewURLGuard("", "", 3).HTTPClient(time.Second)
+	_, err := client.Get(server.URL)
+	a.True(errors.Is(err, ErrURLNotAllowed))
+
+	// 重定向次数限制
+	guard := &URLGuard{MaxRedirects: 1}
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	a.NoError(guard.HTTPClient(time.Second).CheckRedirect(req, []*http.Request{{}}))
+	a.ErrorIs(guard.HTTPClient(time.Second).CheckRedirect(req, []*http.Request{{}, {}}), ErrTooManyRedirects)
+
+	// 重定向到内部地址
+	req, _ = http.NewRequest("GET", "http://127.0.0.1/", nil)
+	a.ErrorIs(guard.HTTPClient(time.Second).CheckRedirect(req, []*http.Request{{}}), ErrURLNotAllowed)
+}
+
+func TestHTTPClient_RequestWithURLGuard(t *testing.T) {
+	a := assert.New(t)
+	client := NewClient()
+	resp := client.Request("GET", "http://127.0.0.1/", nil, WithURLGuard(NewURLGuard("", "", 0)))
+	a.ErrorIs(resp.Err, ErrURLNotAllowed)
+}
@@ -27,6 +27,8 @@ type options struct {
 	tpsLimiterToken string
 	tps             float64
 	tpsBurst        int
+	guard           *URLGuard
+	transport       http.RoundTripper
 }
 
 type optionFunc func(*options)
@@ -135,3 +137,10 @@ func WithTPSLimit(token string, tps float64, burst int) Option {
 		o.tpsBurst = burst
 	})
 }
+
+// WithURLGuard 请求时对目标地址及重定向进行 SSRF 防护
+func WithURLGuard(guard *URLGuard) Option {
+	return optionFunc(func(o *options) {
+		o.guard = guard
+	})
+}
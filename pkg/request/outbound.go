@@ -0,0 +1,93 @@
+package request
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+)
+
+// outboundTransport 通过存储策略设定的代理发送请求，并附加静态请求头
+type outboundTransport struct {
+	base   http.RoundTripper
+	proxy  *url.URL
+	header http.Header
+}
+
+// RoundTrip 实现 http.RoundTripper 接口
+func (t *outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.header) > 0 {
+		req = req.Clone(req.Context())
+		for k, v := range t.header {
+			req.Header[k] = v
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && t.proxy != nil {
+		// 代理地址中可能包含凭证，仅输出脱敏后的地址
+		return nil, fmt.Errorf("request through outbound proxy %s failed: %w", t.proxy.Redacted(), err)
+	}
+
+	return resp, err
+}
+
+// NewOutboundTransport 根据存储策略的出站代理、附加请求头与并发请求限制创建 http.RoundTripper，
+// 策略均未设定时返回 nil
+func NewOutboundTransport(policy *model.Policy) (http.RoundTripper, error) {
+	proxy, err := policy.OutboundProxyURL()
+	if err != nil {
+		return nil, err
+	}
+
+	maxConcurrency := policy.OptionsSerialized.MaxConcurrency
+	if proxy == nil && len(policy.OptionsSerialized.OutboundHeaders) == 0 && maxConcurrency <= 0 {
+		return nil, nil
+	}
+
+	header := http.Header{}
+	for k, v := range policy.OptionsSerialized.OutboundHeaders {
+		header.Set(k, v)
+	}
+
+	var base http.RoundTripper = http.DefaultTransport
+	if proxy != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxy)
+		base = transport
+	}
+
+	if proxy != nil || len(header) > 0 {
+		base = &outboundTransport{base: base, proxy: proxy, header: header}
+	}
+
+	if maxConcurrency > 0 {
+		base = &concurrencyTransport{
+			base:    base,
+			limiter: globalConcurrencyLimiters.get(policy.ID, maxConcurrency),
+		}
+	}
+
+	return base, nil
+}
+
+// NewOutboundHTTPClient 为存储 SDK 创建使用出站设置的 http.Client，
+// 策略未设定出站代理、请求头与并发请求限制时返回 nil，调用方应使用 SDK 默认客户端
+func NewOutboundHTTPClient(policy *model.Policy) (*http.Client, error) {
+	transport, err := NewOutboundTransport(policy)
+	if err != nil || transport == nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// WithPolicyOutbound 请求时使用存储策略的出站代理与附加请求头，
+// 出站设置无效时忽略，调用方应在初始化驱动时通过 Policy.OutboundProxyURL 校验
+func WithPolicyOutbound(policy *model.Policy) Option {
+	transport, _ := NewOutboundTransport(policy)
+	return optionFunc(func(o *options) {
+		o.transport = transport
+	})
+}
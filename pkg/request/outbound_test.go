@@ -0,0 +1,81 @@
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOutboundTransport(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 未设定
+	{
+		res, err := NewOutboundTransport(&model.Policy{})
+		asserts.NoError(err)
+		asserts.Nil(res)
+		client, err := NewOutboundHTTPClient(&model.Policy{})
+		asserts.NoError(err)
+		asserts.Nil(client)
+	}
+
+	// 代理地址无效
+	{
+		policy := &model.Policy{}
+		policy.OptionsSerialized.OutboundProxy = "ftp://proxy"
+		_, err := NewOutboundTransport(policy)
+		asserts.Equal(model.ErrInvalidOutboundProxy, err)
+		_, err = NewOutboundHTTPClient(policy)
+		asserts.Equal(model.ErrInvalidOutboundProxy, err)
+	}
+}
+
+func TestWithPolicyOutbound(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 附加请求头
+	{
+		var gateway string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gateway = r.Header.Get("X-Gateway-Token")
+		}))
+		defer server.Close()
+
+		policy := &model.Policy{}
+		policy.OptionsSerialized.OutboundHeaders = map[string]string{"X-Gateway-Token": "secret"}
+		resp := NewClient(WithPolicyOutbound(policy)).Request("GET", server.URL, nil)
+		asserts.NoError(resp.Err)
+		asserts.Equal("secret", gateway)
+	}
+
+	// 通过代理发送请求
+	{
+		var proxied string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied = r.URL.String()
+		}))
+		defer proxy.Close()
+
+		policy := &model.Policy{}
+		policy.OptionsSerialized.OutboundProxy = proxy.URL
+		resp := NewClient(WithPolicyOutbound(policy)).Request("GET", "http://storage.example.com/object", nil)
+		asserts.NoError(resp.Err)
+		asserts.Equal("http://storage.example.com/object", proxied)
+	}
+
+	// 代理不可用时返回脱敏后的代理地址
+	{
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		proxy.Close()
+
+		policy := &model.Policy{}
+		policy.OptionsSerialized.OutboundProxy = "http://user:password@" + proxy.Listener.Addr().String()
+		resp := NewClient(WithPolicyOutbound(policy)).Request("GET", "http://storage.example.com/object", nil)
+		asserts.Error(resp.Err)
+		asserts.Contains(resp.Err.Error(), "outbound proxy")
+		asserts.NotContains(resp.Err.Error(), "password")
+	}
+}
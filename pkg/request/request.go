@@ -63,7 +63,10 @@ func (c *HTTPClient) Request(method, target string, body io.Reader, opts ...Opti
 	}
 
 	// 创建请求客户端
-	client := &http.Client{Timeout: options.timeout}
+	client := &http.Client{Timeout: options.timeout, Transport: options.transport}
+	if options.guard != nil {
+		client = options.guard.HTTPClient(options.timeout)
+	}
 
 	// size为0时将body设为nil
 	if options.contentLength == 0 {
@@ -95,6 +98,12 @@ func (c *HTTPClient) Request(method, target string, body io.Reader, opts ...Opti
 		return &Response{Err: err}
 	}
 
+	if options.guard != nil {
+		if err := options.guard.Check(req.URL); err != nil {
+			return &Response{Err: err}
+		}
+	}
+
 	// 添加请求相关设置
 	if options.header != nil {
 		for k, v := range options.header {
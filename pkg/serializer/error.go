@@ -10,6 +10,7 @@ type AppError struct {
 	Code     int
 	Msg      string
 	RawError error
+	Data     interface{}
 }
 
 // NewError 返回新的错误对象
@@ -36,6 +37,12 @@ func (err *AppError) WithError(raw error) AppError {
 	return *err
 }
 
+// WithData 返回携带附加数据的错误副本，附加数据会作为响应的 Data 返回给客户端
+func (err AppError) WithData(data interface{}) AppError {
+	err.Data = data
+	return err
+}
+
 // Error 返回业务代码确定的可读错误信息
 func (err AppError) Error() string {
 	return err.Msg
@@ -192,6 +199,62 @@ const (
 	CodeDisabledSharePreview = 40070
 	// 签名无效
 	CodeInvalidSign = 40071
+	// 上传会话与客户端 IP 不匹配
+	CodeUploadSessionIPMismatch = 40072
+	// 远程地址不被允许访问
+	CodeURLNotAllowed = 40073
+	// 文件小于允许的最小尺寸
+	CodeFileTooSmall = 40074
+	// 超出批量上传的文件数量或大小限制
+	CodeBatchUploadSize = 40075
+	// 当前不在允许上传的时间段内
+	CodeUploadWindowClosed = 40076
+	// 超出该类型文件的容量限制
+	CodeTypeQuotaExceeded = 40077
+	// 文件处于保留期内，不可删除或修改
+	CodeFileRetained = 40078
+	// 上传文件缺少目录要求的元数据
+	CodeMetadataRequired = 40079
+	// 组装完成的文件与客户端声明的校验值不一致
+	CodeChecksumMismatch = 40080
+	// 文件在存储端的对象已丢失
+	CodeSourceMissing = 40081
+	// 文件位于归档存储类型，需解冻后才能读取
+	CodeNeedsRestore = 40082
+	// 归档文件正在解冻
+	CodeRestoreInProgress = 40083
+	// 目录中已有内容相同的文件
+	CodeDuplicateContent = 40084
+	// 无法为文件生成缩略图，如格式不受支持
+	CodeThumbUnsupported = 40085
+	// 文件设有下载密码，需先解锁
+	CodeFileLocked = 40086
+	// 解压出的数据量超出限制
+	CodeDecompressLimitExceeded = 40087
+	// 文件名在要求唯一的范围内已被使用
+	CodeNameNotUnique = 40088
+	// 上传来源地区不被允许
+	CodeUploadRegionDenied = 40089
+	// 上传文件声明的 MIME 类型与扩展名不符
+	CodeMIMETypeMismatch = 40090
+	// 存储策略只接受客户端加密的文件
+	CodeEncryptionRequired = 40091
+	// 上传的文件含有病毒
+	CodeFileInfected = 40092
+	// 病毒扫描失败
+	CodeVirusScanFailed = 40093
+	// 超出文件数配额
+	CodeFileCountExceeded = 40094
+	// 文件不支持 HLS 播放
+	CodeHLSNotAvailable = 40095
+	// 文件正在等待管理员审核
+	CodePendingApproval = 40096
+	// 文件名为 Windows 保留的设备名
+	CodeReservedObjectName = 40097
+	// 存储策略仅允许通过签名链接读取文件
+	CodeSignedURLRequired = 40098
+	// 上传文件的内容类型不被存储策略允许
+	CodeMIMETypeNotAllowed = 40099
 	// CodeDBError 数据库操作失败
 	CodeDBError = 50001
 	// CodeEncryptError 加密失败
@@ -212,6 +275,8 @@ const (
 	CodeNodeOffline = 50010
 	// 文件元信息查询失败
 	CodeQueryMetaFailed = 50011
+	// CodeServerBusy 服务器繁忙，稍后重试
+	CodeServerBusy = 50012
 	//CodeParamErr 各种奇奇怪怪的参数错误
 	CodeParamErr = 40001
 	// CodeNotSet 未定错误，后续尝试从error中获取
@@ -237,16 +302,21 @@ func ParamErr(msg string, err error) Response {
 // Err 通用错误处理
 func Err(errCode int, msg string, err error) Response {
 	// 底层错误是AppError，则尝试从AppError中获取详细信息
-	var appError AppError
+	var (
+		appError AppError
+		data     interface{}
+	)
 	if errors.As(err, &appError) {
 		errCode = appError.Code
 		err = appError.RawError
 		msg = appError.Msg
+		data = appError.Data
 	}
 
 	res := Response{
 		Code: errCode,
 		Msg:  msg,
+		Data: data,
 	}
 	// 生产环境隐藏底层报错
 	if err != nil && gin.Mode() != gin.ReleaseMode {
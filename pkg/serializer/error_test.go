@@ -39,4 +39,11 @@ func TestErr(t *testing.T) {
 	err := NewError(400, "Bad Request", errors.New("error"))
 	resp := Err(400, "", err)
 	a.Equal("Bad Request", resp.Msg)
+	a.Nil(resp.Data)
+
+	// 携带附加数据
+	withData := err.WithData(1)
+	a.Nil(err.Data)
+	resp = Err(400, "", withData)
+	a.Equal(1, resp.Data)
 }
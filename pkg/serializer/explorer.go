@@ -13,17 +13,42 @@ func init() {
 
 // ObjectProps 文件、目录对象的详细属性信息
 type ObjectProps struct {
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	Policy         string    `json:"policy"`
-	Size           uint64    `json:"size"`
-	ChildFolderNum int       `json:"child_folder_num"`
-	ChildFileNum   int       `json:"child_file_num"`
-	Path           string    `json:"path"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Policy         string     `json:"policy"`
+	Size           uint64     `json:"size"`
+	ChildFolderNum int        `json:"child_folder_num"`
+	ChildFileNum   int        `json:"child_file_num"`
+	Path           string     `json:"path"`
+	UploadClient   string     `json:"upload_client,omitempty"`
+	RetainUntil    *time.Time `json:"retain_until,omitempty"` // 保留期截止时间，此前不可删除或修改
+	CaptureDate    *time.Time `json:"capture_date,omitempty"` // 图像拍摄时间，无 EXIF 信息时为上传时间
+	Text           *TextStat  `json:"text,omitempty"`         // 文本文件统计信息
+	Video          *VideoInfo `json:"video,omitempty"`        // 视频文件信息
 
 	QueryDate time.Time `json:"query_date"`
 }
 
+// TextStat 文本文件统计信息
+type TextStat struct {
+	Encoding  string `json:"encoding,omitempty"` // 检测到的字符编码，可直接用作 HTTP charset
+	Lines     int    `json:"lines"`
+	Words     int    `json:"words"`
+	Bytes     int64  `json:"bytes"`     // 参与统计的字节数
+	Binary    bool   `json:"binary"`    // 内容很可能为二进制，此时不统计行数和词数
+	Truncated bool   `json:"truncated"` // 文件超出扫描上限，仅统计了开头部分
+}
+
+// VideoInfo 视频文件信息
+type VideoInfo struct {
+	Duration   float64 `json:"duration"` // 时长（秒）
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Codec      string  `json:"codec,omitempty"`
+	Bitrate    int64   `json:"bitrate"`    // 总码率 (bit/s)
+	Unprobable bool    `json:"unprobable"` // 文件损坏或无法解析，此时其余字段为空
+}
+
 // ObjectList 文件、目录列表
 type ObjectList struct {
 	Parent  string         `json:"parent,omitempty"`
@@ -33,17 +58,27 @@ type ObjectList struct {
 
 // Object 文件或者目录
 type Object struct {
-	ID            string    `json:"id"`
-	Name          string    `json:"name"`
-	Path          string    `json:"path"`
-	Pic           string    `json:"pic"`
-	Size          uint64    `json:"size"`
-	Type          string    `json:"type"`
-	Date          time.Time `json:"date"`
-	CreateDate    time.Time `json:"create_date"`
-	Key           string    `json:"key,omitempty"`
-	SourceEnabled bool      `json:"source_enabled"`
-	MD5           string    `json:"md5,omitempty"`
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Path          string     `json:"path"`
+	Pic           string     `json:"pic"`
+	Size          uint64     `json:"size"`
+	Type          string     `json:"type"`
+	Date          time.Time  `json:"date"`
+	CreateDate    time.Time  `json:"create_date"`
+	Key           string     `json:"key,omitempty"`
+	SourceEnabled bool       `json:"source_enabled"`
+	MD5           string     `json:"md5,omitempty"`
+	ThumbStatus   string     `json:"thumb_status,omitempty"`
+	CaptureDate   *time.Time `json:"capture_date,omitempty"`  // 图像拍摄时间，无 EXIF 信息时为上传时间
+	SourceBroken  bool       `json:"source_broken,omitempty"` // 存储端对象已丢失
+	Protected     bool       `json:"protected,omitempty"`     // 设有下载密码
+	StorageClass  string     `json:"storage_class,omitempty"` // 存储端的存储类型
+	TransitionAt  *time.Time `json:"transition_at,omitempty"` // 计划转换存储类型的时间
+	ExpireAt      *time.Time `json:"expire_at,omitempty"`     // 计划删除的时间
+	PDFPreview    bool       `json:"pdf_preview,omitempty"`   // 已生成 PDF 预览，可经由预览接口获取
+	Cover         string     `json:"cover,omitempty"`         // 目录封面的缩略图地址
+	Pending       bool       `json:"pending,omitempty"`       // 正在等待管理员审核
 }
 
 // PolicySummary 用于前端组件使用的存储策略概况
@@ -78,6 +113,30 @@ func BuildObjectList(parent uint, objects []Object, policy *model.Policy) Object
 	return res
 }
 
+// TrashItem 回收站中的文件
+type TrashItem struct {
+	ID        string    `json:"id"`   // 文件 ID，恢复时使用
+	Name      string    `json:"name"` // 移入回收站前的文件名
+	Size      uint64    `json:"size"`
+	TrashedAt time.Time `json:"trashed_at"`
+	Expires   time.Time `json:"expires"` // 过期后永久删除
+}
+
+// BuildTrashList 构建回收站列表响应
+func BuildTrashList(trashes []model.Trash) []TrashItem {
+	res := make([]TrashItem, len(trashes))
+	for i, trash := range trashes {
+		res[i] = TrashItem{
+			ID:        hashid.HashID(trash.FileID, hashid.FileID),
+			Name:      trash.Name,
+			Size:      trash.Size,
+			TrashedAt: trash.CreatedAt,
+			Expires:   trash.Expires,
+		}
+	}
+	return res
+}
+
 // Sources 获取外链的结果响应
 type Sources struct {
 	URL    string `json:"url"`
@@ -85,3 +144,11 @@ type Sources struct {
 	Parent uint   `json:"parent"`
 	Error  string `json:"error,omitempty"`
 }
+
+// BatchUploadResult 批量上传中单个文件的结果
+type BatchUploadResult struct {
+	Name  string `json:"name"`
+	ID    string `json:"id,omitempty"`
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+}
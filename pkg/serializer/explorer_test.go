@@ -2,10 +2,20 @@ package serializer
 
 import (
 	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/hashid"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
+func TestBuildTrashList(t *testing.T) {
+	a := assert.New(t)
+	res := BuildTrashList([]model.Trash{{FileID: 1, Name: "1.txt", Size: 10}})
+	a.Len(res, 1)
+	a.Equal(hashid.HashID(1, hashid.FileID), res[0].ID)
+	a.Equal("1.txt", res[0].Name)
+	a.EqualValues(10, res[0].Size)
+}
+
 func TestBuildObjectList(t *testing.T) {
 	a := assert.New(t)
 	res := BuildObjectList(1, []Object{{}, {}}, &model.Policy{})
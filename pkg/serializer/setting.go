@@ -51,6 +51,36 @@ func BuildTaskList(tasks []model.Task, total int) Response {
 	}}
 }
 
+type notification struct {
+	ID         uint       `json:"id"`
+	Event      string     `json:"event"`
+	Title      string     `json:"title"`
+	Body       string     `json:"body"`
+	CreateDate time.Time  `json:"create_date"`
+	ReadDate   *time.Time `json:"read_date,omitempty"`
+}
+
+// BuildNotificationList 构建站内通知列表响应
+func BuildNotificationList(notifications []model.Notification, total, unread int) Response {
+	res := make([]notification, 0, len(notifications))
+	for _, n := range notifications {
+		res = append(res, notification{
+			ID:         n.ID,
+			Event:      n.Event,
+			Title:      n.Title,
+			Body:       n.Body,
+			CreateDate: n.CreatedAt,
+			ReadDate:   n.ReadAt,
+		})
+	}
+
+	return Response{Data: map[string]interface{}{
+		"total":         total,
+		"unread":        unread,
+		"notifications": res,
+	}}
+}
+
 func checkSettingValue(setting map[string]string, key string) string {
 	if v, ok := setting[key]; ok {
 		return v
@@ -47,11 +47,29 @@ type UploadSession struct {
 	UploadURL      string
 	UploadID       string
 	Credential     string
+	ClientIP       string   // 创建会话的客户端 IP，为空时不校验
+	Expires        int64    // 会话过期时间戳
+	MD5            string   // 客户端声明的完整文件 MD5，为空时不校验
+	PartETags      []string // 已上传分片的 ETag，按分片序号排列，服务端重试完成分片上传时记录
+	Staging        string   // 经由服务端中转的分片上传暂存数据的存放位置，为空时按 auto 处理
+	StagingPolicy  uint     // Staging 为 policy 时暂存数据所在的存储策略
+	Permission     string   // 本次上传指定的文件默认权限，上传完成时应用，空值表示继承
 }
 
 // UploadCallback 上传回调正文
 type UploadCallback struct {
-	PicInfo string `json:"pic_info"`
+	PicInfo  string `json:"pic_info"`
+	Infected bool   `json:"infected,omitempty"` // 从机扫描发现病毒，主机应拒绝此文件
+	Threat   string `json:"threat,omitempty"`   // 发现的病毒名称
+}
+
+// UploadFinalizeResult 同步完成上传后处理时返回的处理结果
+type UploadFinalizeResult struct {
+	Pending     bool   `json:"pending"` // 处理超时，结果尚未全部就绪
+	ThumbStatus string `json:"thumb_status"`
+	PicInfo     string `json:"pic_info"`
+	MD5         string `json:"md5,omitempty"`
+	PHash       string `json:"phash,omitempty"`
 }
 
 // GeneralUploadCallbackFailed 存储策略上传回调失败响应
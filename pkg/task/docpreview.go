@@ -0,0 +1,157 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// DocPreviewTask 文档 PDF 预览生成任务
+type DocPreviewTask struct {
+	User      *model.User
+	TaskModel *model.Task
+	TaskProps DocPreviewProps
+	Err       *JobError
+}
+
+// DocPreviewProps 文档 PDF 预览生成任务属性
+type DocPreviewProps struct {
+	FileID uint `json:"file_id"` // 文件ID
+
+	// 生成结果
+	Skipped bool `json:"skipped"` // 已有预览或 soffice 不可用，未进行转换
+}
+
+// Props 获取任务属性
+func (job *DocPreviewTask) Props() string {
+	res, _ := json.Marshal(job.TaskProps)
+	return string(res)
+}
+
+// Type 获取任务状态
+func (job *DocPreviewTask) Type() int {
+	return DocPreviewTaskType
+}
+
+// Creator 获取创建者ID
+func (job *DocPreviewTask) Creator() uint {
+	return job.User.ID
+}
+
+// Model 获取任务的数据库模型
+func (job *DocPreviewTask) Model() *model.Task {
+	return job.TaskModel
+}
+
+// SetStatus 设定状态
+func (job *DocPreviewTask) SetStatus(status int) {
+	job.TaskModel.SetStatus(status)
+}
+
+// SetError 设定任务失败信息
+func (job *DocPreviewTask) SetError(err *JobError) {
+	job.Err = err
+	res, _ := json.Marshal(job.Err)
+	job.TaskModel.SetError(string(res))
+}
+
+// SetErrorMsg 设定任务失败信息
+func (job *DocPreviewTask) SetErrorMsg(msg string, err error) {
+	jobErr := &JobError{Msg: msg}
+	if err != nil {
+		jobErr.Error = err.Error()
+	}
+	job.SetError(jobErr)
+}
+
+// GetError 返回任务失败信息
+func (job *DocPreviewTask) GetError() *JobError {
+	return job.Err
+}
+
+// Do 开始执行任务
+func (job *DocPreviewTask) Do() {
+	fs, err := filesystem.NewFileSystem(job.User)
+	if err != nil {
+		job.SetErrorMsg("Failed to initialize file system.", err)
+		return
+	}
+	defer fs.Recycle()
+
+	files, err := model.GetFilesByIDs([]uint{job.TaskProps.FileID}, job.User.ID)
+	if err != nil || len(files) == 0 {
+		job.SetErrorMsg("File not exist.", err)
+		return
+	}
+
+	job.TaskModel.SetProgress(GeneratingProgress)
+	skipped, err := fs.GenerateDocPreview(context.Background(), &files[0])
+	if err != nil {
+		// 仍可使用 office_preview_service 预览
+		util.Log().Warning("Failed to generate preview for document %q: %s", files[0].Name, err)
+		job.SetErrorMsg("Failed to generate document preview.", err)
+		return
+	}
+
+	job.TaskProps.Skipped = skipped
+	job.TaskModel.SetProps(job.Props())
+}
+
+// NewDocPreviewTask 新建文档 PDF 预览生成任务
+func NewDocPreviewTask(user *model.User, fileID uint) (Job, error) {
+	newTask := &DocPreviewTask{
+		User: user,
+		TaskProps: DocPreviewProps{
+			FileID: fileID,
+		},
+	}
+
+	record, err := Record(newTask)
+	if err != nil {
+		return nil, err
+	}
+	newTask.TaskModel = record
+
+	return newTask, nil
+}
+
+// NewDocPreviewTaskFromModel 从数据库记录中恢复文档 PDF 预览生成任务
+func NewDocPreviewTaskFromModel(task *model.Task) (Job, error) {
+	user, err := model.GetActiveUserByID(task.UserID)
+	if err != nil {
+		return nil, err
+	}
+	newTask := &DocPreviewTask{
+		User:      &user,
+		TaskModel: task,
+	}
+
+	err = json.Unmarshal([]byte(task.Props), &newTask.TaskProps)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTask, nil
+}
+
+// HookGenerateDocPreview 上传完成后，为设定格式的文档创建后台 PDF 预览生成任务，
+// soffice 不可用时不创建任务
+func HookGenerateDocPreview(ctx context.Context, fs *filesystem.FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || fileModel.ID == 0 || !filesystem.IsDocPreviewNeeded(fileModel.Name) || !filesystem.IsDocPreviewAvailable() {
+		return nil
+	}
+
+	job, err := NewDocPreviewTask(fs.User, fileModel.ID)
+	if err != nil {
+		util.Log().Warning("Failed to create document preview task for %q: %s", fileModel.Name, err)
+		return nil
+	}
+
+	TaskPoll.Submit(job)
+	return nil
+}
@@ -0,0 +1,149 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestDocPreviewTask_Props(t *testing.T) {
+	asserts := assert.New(t)
+	task := &DocPreviewTask{
+		User: &model.User{},
+	}
+	asserts.NotEmpty(task.Props())
+	asserts.Equal(DocPreviewTaskType, task.Type())
+	asserts.EqualValues(0, task.Creator())
+	asserts.Nil(task.Model())
+}
+
+func TestDocPreviewTask_Do(t *testing.T) {
+	asserts := assert.New(t)
+	task := &DocPreviewTask{
+		User:      &model.User{Policy: model.Policy{Type: "local"}},
+		TaskModel: &model.Task{Model: gorm.Model{ID: 1}},
+		TaskProps: DocPreviewProps{FileID: 1},
+	}
+
+	// 文件不存在
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		task.Do()
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NotNil(task.Err)
+	}
+}
+
+func TestNewDocPreviewTask(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 成功
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		job, err := NewDocPreviewTask(&model.User{}, 1)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(1, job.(*DocPreviewTask).TaskProps.FileID)
+	}
+
+	// 失败
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		job, err := NewDocPreviewTask(&model.User{}, 1)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Nil(job)
+		asserts.Error(err)
+	}
+}
+
+func TestNewDocPreviewTaskFromModel(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 成功
+	{
+		mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		job, err := NewDocPreviewTaskFromModel(&model.Task{Props: `{"file_id":2}`})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(2, job.(*DocPreviewTask).TaskProps.FileID)
+	}
+
+	// JSON解析失败
+	{
+		mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		job, err := NewDocPreviewTaskFromModel(&model.Task{Props: "?"})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.Nil(job)
+	}
+}
+
+func TestHookGenerateDocPreview(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &filesystem.FileSystem{User: &model.User{}}
+	file := &model.File{Model: gorm.Model{ID: 1}, Name: "report.docx"}
+	oldPool := TaskPoll
+	defer func() { TaskPoll = oldPool }()
+
+	// 未开启
+	{
+		cache.Set("setting_doc_preview_enabled", "0", 0)
+		asserts.NoError(HookGenerateDocPreview(context.Background(), fs, &fsctx.FileStream{Model: file}))
+	}
+
+	cache.Set("setting_doc_preview_enabled", "1", 0)
+	cache.Set("setting_doc_preview_exts", "docx,pptx", 0)
+	defer cache.Set("setting_doc_preview_enabled", "0", 0)
+
+	// 不需要转换的格式
+	{
+		asserts.NoError(HookGenerateDocPreview(context.Background(), fs, &fsctx.FileStream{
+			Model: &model.File{Model: gorm.Model{ID: 1}, Name: "report.pdf"},
+		}))
+	}
+
+	// soffice 不可用
+	{
+		cache.Set("setting_doc_preview_soffice", "/nonexistent/soffice", 0)
+		asserts.NoError(HookGenerateDocPreview(context.Background(), fs, &fsctx.FileStream{Model: file}))
+	}
+
+	// 创建任务
+	cache.Set("setting_doc_preview_soffice", "sh", 0)
+	{
+		mockPool := taskPoolMock{}
+		mockPool.On("Submit", testMock.Anything)
+		TaskPoll = mockPool
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(HookGenerateDocPreview(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+		mockPool.AssertExpectations(t)
+	}
+
+	// 创建任务失败，不影响上传
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		asserts.NoError(HookGenerateDocPreview(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
@@ -0,0 +1,407 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+const (
+	// fetchMaxRetries 下载中断后的最大重试次数
+	fetchMaxRetries = 5
+	// fetchProgressInterval 下载进度的记录间隔
+	fetchProgressInterval = time.Second
+)
+
+// errFetchIncomplete 源站提前结束了响应
+var errFetchIncomplete = errors.New("remote file is incomplete")
+
+// retryableError 可通过重新请求恢复的下载错误
+type retryableError struct {
+	error
+}
+
+func (e retryableError) Unwrap() error {
+	return e.error
+}
+
+// FetchTask 远程URL导入任务
+type FetchTask struct {
+	User      *model.User
+	TaskModel *model.Task
+	TaskProps FetchProps
+	Err       *JobError
+
+	lastSaved time.Time
+}
+
+// FetchProps 远程URL导入任务属性
+type FetchProps struct {
+	URL  string `json:"url"`            // 源文件地址
+	Dst  string `json:"dst"`            // 目的目录
+	Name string `json:"name,omitempty"` // 文件名，为空时由响应推断
+
+	ClientIP string `json:"client_ip,omitempty"` // 创建任务的客户端 IP，用于限制上传来源地区
+
+	// 下载进度，用于中断后恢复
+	Size          int64  `json:"size"`                     // 源文件尺寸，-1 表示未知
+	Fetched       uint64 `json:"fetched"`                  // 已下载字节数
+	Resumable     bool   `json:"resumable"`                // 源站是否支持断点续传
+	PlaceholderID uint   `json:"placeholder_id,omitempty"` // 上传会话占位文件ID
+	TempPath      string `json:"temp_path,omitempty"`      // 下载缓存文件路径
+}
+
+// Props 获取任务属性
+func (job *FetchTask) Props() string {
+	res, _ := json.Marshal(job.TaskProps)
+	return string(res)
+}
+
+// Type 获取任务状态
+func (job *FetchTask) Type() int {
+	return FetchTaskType
+}
+
+// Creator 获取创建者ID
+func (job *FetchTask) Creator() uint {
+	return job.User.ID
+}
+
+// Model 获取任务的数据库模型
+func (job *FetchTask) Model() *model.Task {
+	return job.TaskModel
+}
+
+// SetStatus 设定状态
+func (job *FetchTask) SetStatus(status int) {
+	job.TaskModel.SetStatus(status)
+}
+
+// SetError 设定任务失败信息
+func (job *FetchTask) SetError(err *JobError) {
+	job.Err = err
+	res, _ := json.Marshal(job.Err)
+	job.TaskModel.SetError(string(res))
+}
+
+// SetErrorMsg 设定任务失败信息
+func (job *FetchTask) SetErrorMsg(msg string, err error) {
+	jobErr := &JobError{Msg: msg}
+	if err != nil {
+		jobErr.Error = err.Error()
+	}
+	job.SetError(jobErr)
+}
+
+// GetError 返回任务失败信息
+func (job *FetchTask) GetError() *JobError {
+	return job.Err
+}
+
+// Do 开始执行任务
+func (job *FetchTask) Do() {
+	ctx := context.Background()
+	if job.TaskProps.ClientIP != "" {
+		ctx = context.WithValue(ctx, fsctx.ClientIPCtx, job.TaskProps.ClientIP)
+	}
+
+	fs, err := filesystem.NewFileSystem(job.User)
+	if err != nil {
+		job.SetErrorMsg("Failed to initialize file system.", err)
+		return
+	}
+	defer fs.Recycle()
+
+	// 首次执行时分配下载缓存路径
+	if job.TaskProps.TempPath == "" {
+		job.TaskProps.TempPath = filepath.Join(
+			util.RelativePath(model.GetSettingByName("temp_path")),
+			"fetch",
+			fmt.Sprintf("task_%d", job.TaskModel.ID),
+		)
+		job.saveProps()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(job.TaskProps.TempPath), 0700); err != nil {
+		job.SetErrorMsg("Failed to create temp folder.", err)
+		return
+	}
+
+	tempFile, err := os.OpenFile(job.TaskProps.TempPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		job.SetErrorMsg("Failed to open temp file.", err)
+		return
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(job.TaskProps.TempPath)
+	}()
+
+	job.TaskModel.SetProgress(DownloadingProgress)
+	if err := job.download(ctx, fs, tempFile); err != nil {
+		job.removePlaceholder(ctx, fs)
+		job.SetErrorMsg("Failed to fetch remote file.", err)
+		return
+	}
+
+	job.TaskModel.SetProgress(TransferringProgress)
+	if err := job.upload(ctx, fs, tempFile); err != nil {
+		job.removePlaceholder(ctx, fs)
+		job.SetErrorMsg("Failed to save fetched file.", err)
+		return
+	}
+}
+
+// download 将远程文件下载至缓存文件，中断时从已下载的位置重试
+func (job *FetchTask) download(ctx context.Context, fs *filesystem.FileSystem, tempFile *os.File) error {
+	for attempt := 0; ; attempt++ {
+		err := job.fetch(ctx, fs, tempFile)
+		if err == nil {
+			return nil
+		}
+
+		var retryable retryableError
+		if !errors.As(err, &retryable) || attempt >= fetchMaxRetries {
+			return err
+		}
+
+		backoff := time.Duration(1<<uint(attempt)) * time.Second
+		util.Log().Warning("URL import task %d interrupted at %d bytes, retry in %s: %s",
+			job.TaskModel.ID, job.TaskProps.Fetched, backoff, err)
+		time.Sleep(backoff)
+	}
+}
+
+// fetch 请求远程文件并追加写入缓存文件，源站支持时从缓存文件末尾继续下载
+func (job *FetchTask) fetch(ctx context.Context, fs *filesystem.FileSystem, tempFile *os.File) error {
+	info, err := tempFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	offset := uint64(info.Size())
+	if job.TaskProps.Size >= 0 && offset == uint64(job.TaskProps.Size) {
+		job.TaskProps.Fetched = offset
+		return nil
+	}
+
+	if offset > 0 && !job.TaskProps.Resumable {
+		util.Log().Info("Source of URL import task %d does not support resuming, restart downloading.", job.TaskModel.ID)
+		offset = 0
+	}
+
+	resp, partial, err := fs.OpenURL(ctx, job.TaskProps.URL, offset)
+	if err != nil {
+		var appErr serializer.AppError
+		if errors.As(err, &appErr) && appErr.Code == serializer.CodeIOFailed {
+			return retryableError{err}
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if offset > 0 && !partial {
+		util.Log().Info("Source of URL import task %d ignored range request, restart downloading.", job.TaskModel.ID)
+		offset = 0
+	}
+
+	// 首次获得响应时确定文件信息并创建占位文件
+	if job.TaskProps.Size < 0 && offset == 0 {
+		if err := job.probe(ctx, fs, resp); err != nil {
+			return err
+		}
+	}
+
+	if err := tempFile.Truncate(int64(offset)); err != nil {
+		return err
+	}
+	if _, err := tempFile.Seek(int64(offset), io.SeekStart); err != nil {
+		return err
+	}
+	job.TaskProps.Fetched = offset
+
+	limit := fs.URLUploadLimit()
+	if job.TaskProps.Size >= 0 {
+		limit = uint64(job.TaskProps.Size)
+	}
+	if limit < offset {
+		return filesystem.ErrFileSizeTooBig
+	}
+
+	_, err = io.Copy(&fetchProgress{job: job, file: tempFile}, filesystem.NewSizeLimitReader(resp.Body, limit-offset))
+	job.saveProps()
+	if err != nil {
+		if errors.Is(err, filesystem.ErrFileSizeTooBig) {
+			return filesystem.ErrFileSizeTooBig
+		}
+		return retryableError{err}
+	}
+
+	if job.TaskProps.Size >= 0 && job.TaskProps.Fetched != uint64(job.TaskProps.Size) {
+		return retryableError{errFetchIncomplete}
+	}
+
+	return nil
+}
+
+// probe 根据首个完整响应确定文件名、尺寸与是否支持断点续传，尺寸已知时创建占位文件
+func (job *FetchTask) probe(ctx context.Context, fs *filesystem.FileSystem, resp *http.Response) error {
+	if job.TaskProps.Name == "" {
+		job.TaskProps.Name = filesystem.FileNameFromResponse(resp)
+	}
+
+	size := filesystem.RemoteFileSize(resp)
+	job.TaskProps.Resumable = size >= 0 && resp.Header.Get("Accept-Ranges") == "bytes"
+
+	if size >= 0 && job.TaskProps.PlaceholderID == 0 {
+		if uint64(size) > fs.URLUploadLimit() {
+			return filesystem.ErrFileSizeTooBig
+		}
+
+		if err := job.createPlaceholder(ctx, fs, uint64(size)); err != nil {
+			return err
+		}
+	}
+
+	job.TaskProps.Size = size
+	job.saveProps()
+	return nil
+}
+
+// upload 将下载完成的缓存文件写入占位文件，尺寸未知的文件在此时创建占位文件
+func (job *FetchTask) upload(ctx context.Context, fs *filesystem.FileSystem, tempFile *os.File) error {
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if job.TaskProps.PlaceholderID == 0 {
+		if err := job.createPlaceholder(ctx, fs, job.TaskProps.Fetched); err != nil {
+			return err
+		}
+	}
+
+	files, err := model.GetFilesByIDs([]uint{job.TaskProps.PlaceholderID}, job.User.ID)
+	if err != nil || len(files) == 0 {
+		return filesystem.ErrObjectNotExist.WithError(err)
+	}
+
+	// 上次执行已完成上传
+	if files[0].UploadSessionID == nil {
+		return nil
+	}
+
+	return fs.CompleteUploadPlaceholder(ctx, &files[0], &fsctx.FileStream{
+		File:        tempFile,
+		Seeker:      tempFile,
+		Size:        job.TaskProps.Fetched,
+		VirtualPath: job.TaskProps.Dst,
+	})
+}
+
+// createPlaceholder 为导入的文件创建上传会话占位文件
+func (job *FetchTask) createPlaceholder(ctx context.Context, fs *filesystem.FileSystem, size uint64) error {
+	defer fs.CleanHooks("")
+	fs.Policy = &job.User.Policy
+	if err := fs.DispatchHandler(); err != nil {
+		return err
+	}
+
+	placeholder, err := fs.CreateUploadPlaceholder(ctx, &fsctx.FileStream{
+		Name:        job.TaskProps.Name,
+		VirtualPath: job.TaskProps.Dst,
+		Size:        size,
+	})
+	if err != nil {
+		return err
+	}
+
+	job.TaskProps.PlaceholderID = placeholder.ID
+	job.saveProps()
+	return nil
+}
+
+// removePlaceholder 任务失败时删除占位文件
+func (job *FetchTask) removePlaceholder(ctx context.Context, fs *filesystem.FileSystem) {
+	if job.TaskProps.PlaceholderID == 0 {
+		return
+	}
+
+	fs.CleanHooks("")
+	if err := fs.Delete(ctx, []uint{}, []uint{job.TaskProps.PlaceholderID}, false); err != nil {
+		util.Log().Warning("Failed to delete placeholder of URL import task %d: %s", job.TaskModel.ID, err)
+	}
+}
+
+// saveProps 记录任务进度
+func (job *FetchTask) saveProps() {
+	job.lastSaved = time.Now()
+	job.TaskModel.SetProps(job.Props())
+}
+
+// fetchProgress 写入缓存文件的同时定期记录下载进度
+type fetchProgress struct {
+	job  *FetchTask
+	file *os.File
+}
+
+func (w *fetchProgress) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.job.TaskProps.Fetched += uint64(n)
+	if time.Since(w.job.lastSaved) >= fetchProgressInterval {
+		w.job.saveProps()
+	}
+	return n, err
+}
+
+// NewFetchTask 新建远程URL导入任务，clientIP 为创建任务的客户端 IP
+func NewFetchTask(user *model.User, src, dst, name, clientIP string) (Job, error) {
+	newTask := &FetchTask{
+		User: user,
+		TaskProps: FetchProps{
+			URL:      src,
+			Dst:      dst,
+			Name:     name,
+			ClientIP: clientIP,
+			Size:     -1,
+		},
+	}
+
+	record, err := Record(newTask)
+	if err != nil {
+		return nil, err
+	}
+	newTask.TaskModel = record
+
+	return newTask, nil
+}
+
+// NewFetchTaskFromModel 从数据库记录中恢复远程URL导入任务
+func NewFetchTaskFromModel(task *model.Task) (Job, error) {
+	user, err := model.GetActiveUserByID(task.UserID)
+	if err != nil {
+		return nil, err
+	}
+	newTask := &FetchTask{
+		User:      &user,
+		TaskModel: task,
+	}
+
+	err = json.Unmarshal([]byte(task.Props), &newTask.TaskProps)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTask, nil
+}
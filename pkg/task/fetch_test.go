@@ -0,0 +1,148 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchTask_Props(t *testing.T) {
+	asserts := assert.New(t)
+	task := &FetchTask{
+		User: &model.User{},
+	}
+	asserts.NotEmpty(task.Props())
+	asserts.Equal(FetchTaskType, task.Type())
+	asserts.EqualValues(0, task.Creator())
+	asserts.Nil(task.Model())
+}
+
+func TestFetchTask_fetch(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &filesystem.FileSystem{User: &model.User{}}
+	cache.Set("setting_url_upload_allowed_hosts", "", 0)
+	cache.Set("setting_url_upload_denied_hosts", "", 0)
+	cache.Set("setting_url_upload_max_redirects", "3", 0)
+	cache.Set("setting_url_upload_timeout", "10", 0)
+
+	tempFile, err := ioutil.TempFile("", "fetch")
+	asserts.NoError(err)
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}()
+	tempFile.WriteString("1234")
+
+	// 缓存文件已完整
+	{
+		task := &FetchTask{
+			User:      &model.User{},
+			TaskModel: &model.Task{},
+			TaskProps: FetchProps{URL: "http://127.0.0.1/1.txt", Size: 4},
+		}
+		asserts.NoError(task.fetch(context.Background(), fs, tempFile))
+		asserts.EqualValues(4, task.TaskProps.Fetched)
+	}
+
+	// 地址不允许访问，不重试
+	{
+		task := &FetchTask{
+			User:      &model.User{},
+			TaskModel: &model.Task{},
+			TaskProps: FetchProps{URL: "http://127.0.0.1/1.txt", Size: -1},
+		}
+		err := task.download(context.Background(), fs, tempFile)
+		asserts.Error(err)
+		asserts.False(errors.As(err, &retryableError{}))
+	}
+}
+
+func TestFetchTask_upload(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &filesystem.FileSystem{User: &model.User{}}
+	tempFile, err := ioutil.TempFile("", "fetch")
+	asserts.NoError(err)
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}()
+
+	task := &FetchTask{
+		User:      &model.User{Model: gorm.Model{ID: 1}},
+		TaskModel: &model.Task{},
+		TaskProps: FetchProps{PlaceholderID: 1, Size: 4, Fetched: 4},
+	}
+
+	// 占位文件不存在
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		asserts.Error(task.upload(context.Background(), fs, tempFile))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 上次执行已完成上传
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "upload_session_id"}).AddRow(1, nil))
+		asserts.NoError(task.upload(context.Background(), fs, tempFile))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
+
+func TestNewFetchTask(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 成功
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		job, err := NewFetchTask(&model.User{}, "http://example.com/1.txt", "/", "", "1.2.3.4")
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(-1, job.(*FetchTask).TaskProps.Size)
+		asserts.Equal("1.2.3.4", job.(*FetchTask).TaskProps.ClientIP)
+	}
+
+	// 失败
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		job, err := NewFetchTask(&model.User{}, "http://example.com/1.txt", "/", "", "")
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Nil(job)
+		asserts.Error(err)
+	}
+}
+
+func TestNewFetchTaskFromModel(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 成功
+	{
+		mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		job, err := NewFetchTaskFromModel(&model.Task{Props: `{"url":"http://example.com/1.txt","fetched":4}`})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(4, job.(*FetchTask).TaskProps.Fetched)
+	}
+
+	// JSON解析失败
+	{
+		mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		job, err := NewFetchTaskFromModel(&model.Task{Props: "?"})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.Nil(job)
+	}
+}
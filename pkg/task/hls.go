@@ -0,0 +1,156 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// HLSTask 视频 HLS 分段预生成任务
+type HLSTask struct {
+	User      *model.User
+	TaskModel *model.Task
+	TaskProps HLSProps
+	Err       *JobError
+}
+
+// HLSProps 视频 HLS 分段预生成任务属性
+type HLSProps struct {
+	FileID uint `json:"file_id"` // 文件ID
+
+	// 生成结果
+	Skipped bool `json:"skipped"` // 已有分段，未重新生成
+}
+
+// Props 获取任务属性
+func (job *HLSTask) Props() string {
+	res, _ := json.Marshal(job.TaskProps)
+	return string(res)
+}
+
+// Type 获取任务状态
+func (job *HLSTask) Type() int {
+	return HLSTaskType
+}
+
+// Creator 获取创建者ID
+func (job *HLSTask) Creator() uint {
+	return job.User.ID
+}
+
+// Model 获取任务的数据库模型
+func (job *HLSTask) Model() *model.Task {
+	return job.TaskModel
+}
+
+// SetStatus 设定状态
+func (job *HLSTask) SetStatus(status int) {
+	job.TaskModel.SetStatus(status)
+}
+
+// SetError 设定任务失败信息
+func (job *HLSTask) SetError(err *JobError) {
+	job.Err = err
+	res, _ := json.Marshal(job.Err)
+	job.TaskModel.SetError(string(res))
+}
+
+// SetErrorMsg 设定任务失败信息
+func (job *HLSTask) SetErrorMsg(msg string, err error) {
+	jobErr := &JobError{Msg: msg}
+	if err != nil {
+		jobErr.Error = err.Error()
+	}
+	job.SetError(jobErr)
+}
+
+// GetError 返回任务失败信息
+func (job *HLSTask) GetError() *JobError {
+	return job.Err
+}
+
+// Do 开始执行任务
+func (job *HLSTask) Do() {
+	fs, err := filesystem.NewFileSystem(job.User)
+	if err != nil {
+		job.SetErrorMsg("Failed to initialize file system.", err)
+		return
+	}
+	defer fs.Recycle()
+
+	files, err := model.GetFilesByIDs([]uint{job.TaskProps.FileID}, job.User.ID)
+	if err != nil || len(files) == 0 {
+		job.SetErrorMsg("File not exist.", err)
+		return
+	}
+
+	job.TaskModel.SetProgress(TranscodingProgress)
+	skipped, err := fs.GenerateHLS(context.Background(), &files[0])
+	if err != nil {
+		// 播放时仍可实时切分
+		util.Log().Warning("Failed to generate HLS segments for video %q: %s", files[0].Name, err)
+		job.SetErrorMsg("Failed to generate HLS segments.", err)
+		return
+	}
+
+	job.TaskProps.Skipped = skipped
+	job.TaskModel.SetProps(job.Props())
+}
+
+// NewHLSTask 新建视频 HLS 分段预生成任务
+func NewHLSTask(user *model.User, fileID uint) (Job, error) {
+	newTask := &HLSTask{
+		User: user,
+		TaskProps: HLSProps{
+			FileID: fileID,
+		},
+	}
+
+	record, err := Record(newTask)
+	if err != nil {
+		return nil, err
+	}
+	newTask.TaskModel = record
+
+	return newTask, nil
+}
+
+// NewHLSTaskFromModel 从数据库记录中恢复视频 HLS 分段预生成任务
+func NewHLSTaskFromModel(task *model.Task) (Job, error) {
+	user, err := model.GetActiveUserByID(task.UserID)
+	if err != nil {
+		return nil, err
+	}
+	newTask := &HLSTask{
+		User:      &user,
+		TaskModel: task,
+	}
+
+	err = json.Unmarshal([]byte(task.Props), &newTask.TaskProps)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTask, nil
+}
+
+// HookGenerateHLS 上传完成后，为开启 HLS 分段预生成的存储策略下设定格式的视频创建后台预生成任务
+func HookGenerateHLS(ctx context.Context, fs *filesystem.FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || fileModel.ID == 0 || !filesystem.IsHLSPregenerateNeeded(fileModel) {
+		return nil
+	}
+
+	job, err := NewHLSTask(fs.User, fileModel.ID)
+	if err != nil {
+		util.Log().Warning("Failed to create HLS task for %q: %s", fileModel.Name, err)
+		return nil
+	}
+
+	TaskPoll.Submit(job)
+	return nil
+}
@@ -0,0 +1,78 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestHLSTask_Props(t *testing.T) {
+	asserts := assert.New(t)
+	task := &HLSTask{
+		User: &model.User{},
+	}
+	asserts.NotEmpty(task.Props())
+	asserts.Equal(HLSTaskType, task.Type())
+	asserts.EqualValues(0, task.Creator())
+	asserts.Nil(task.Model())
+}
+
+func TestNewHLSTaskFromModel(t *testing.T) {
+	asserts := assert.New(t)
+
+	mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	job, err := GetJobFromModel(&model.Task{Type: HLSTaskType, Props: `{"file_id":2}`})
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.NoError(err)
+	asserts.EqualValues(2, job.(*HLSTask).TaskProps.FileID)
+}
+
+func TestHookGenerateHLS(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &filesystem.FileSystem{User: &model.User{}}
+	cache.Set("setting_hls_exts", "mp4", 0)
+	file := &model.File{
+		Model:  gorm.Model{ID: 1},
+		Name:   "1.mp4",
+		Policy: model.Policy{Model: gorm.Model{ID: 1}},
+	}
+	oldPool := TaskPoll
+	defer func() { TaskPoll = oldPool }()
+
+	// 存储策略未开启预生成
+	{
+		asserts.NoError(HookGenerateHLS(context.Background(), fs, &fsctx.FileStream{Model: file}))
+	}
+
+	// 创建任务
+	file.Policy.OptionsSerialized.HLSMode = filesystem.HLSModePregenerate
+	{
+		mockPool := taskPoolMock{}
+		mockPool.On("Submit", testMock.Anything)
+		TaskPoll = mockPool
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(HookGenerateHLS(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+		mockPool.AssertExpectations(t)
+	}
+
+	// 创建任务失败，不影响上传
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		asserts.NoError(HookGenerateHLS(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
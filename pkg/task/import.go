@@ -102,7 +102,9 @@ func (job *ImportTask) Do() {
 
 	// 注册钩子
 	fs.Use("BeforeAddFile", filesystem.HookValidateFile)
+	fs.Use("BeforeAddFile", filesystem.HookValidateUniqueName)
 	fs.Use("BeforeAddFile", filesystem.HookValidateCapacity)
+	fs.Use("BeforeAddFile", filesystem.HookValidateFileCount)
 
 	// 列取目录、对象
 	job.TaskModel.SetProgress(ListingProgress)
@@ -134,6 +136,7 @@ func (job *ImportTask) Do() {
 	}
 
 	// 插入文件记录到用户文件系统
+	importedFiles := make([]*model.File, 0, len(objects))
 	for _, object := range objects {
 		if !object.IsDir {
 			// 创建文件信息
@@ -161,7 +164,7 @@ func (job *ImportTask) Do() {
 			}
 
 			// 插入文件记录
-			_, err := fs.AddFile(context.Background(), parentFolder, &fileHeader)
+			file, err := fs.AddFile(context.Background(), parentFolder, &fileHeader)
 			if err != nil {
 				util.Log().Warning("Importing task cannot insert user file %q: %s",
 					object.RelativePath, err)
@@ -169,10 +172,18 @@ func (job *ImportTask) Do() {
 					job.SetErrorMsg("Insufficient storage capacity.", err)
 					return
 				}
+				continue
 			}
+			importedFiles = append(importedFiles, file)
 
 		}
 	}
+
+	// 统一为导入的文件生成缩略图
+	if len(importedFiles) > 0 && fs.Policy.IsThumbGenerateNeeded() {
+		res := fs.GenerateThumbnails(ctx, importedFiles)
+		util.Log().Info("Generated thumbnails for imported files: %d succeeded, %d failed, %d skipped.", res.Succeeded, res.Failed, res.Skipped)
+	}
 }
 
 // NewImportTask 新建导入任务
@@ -180,6 +180,7 @@ func TestImportTask_Do(t *testing.T) {
 		mock.ExpectQuery("SELECT(.+)folders").WillReturnRows(sqlmock.NewRows([]string{"id"}))
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT(.+)folders(.+)").WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectExec("UPDATE(.+)users(.+)folder_count(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 		// 插入文件记录
 		mock.ExpectBegin()
@@ -17,6 +17,18 @@ const (
 	ImportTaskType
 	// RecycleTaskType 回收任务
 	RecycleTaskType
+	// MigrateTaskType 存储策略迁移任务
+	MigrateTaskType
+	// FetchTaskType 远程URL导入任务
+	FetchTaskType
+	// ThumbWarmTaskType 目录缩略图预生成任务
+	ThumbWarmTaskType
+	// TranscodeTaskType 视频转码任务
+	TranscodeTaskType
+	// DocPreviewTaskType 文档预览生成任务
+	DocPreviewTaskType
+	// HLSTaskType 视频 HLS 分段预生成任务
+	HLSTaskType
 )
 
 // 任务状态
@@ -49,6 +61,10 @@ const (
 	ListingProgress
 	// InsertingProgress 插入中
 	InsertingProgress
+	// GeneratingProgress 生成中
+	GeneratingProgress
+	// TranscodingProgress 转码中
+	TranscodingProgress
 )
 
 // Job 任务接口
@@ -117,6 +133,18 @@ func GetJobFromModel(task *model.Task) (Job, error) {
 		return NewImportTaskFromModel(task)
 	case RecycleTaskType:
 		return NewRecycleTaskFromModel(task)
+	case MigrateTaskType:
+		return NewMigrateTaskFromModel(task)
+	case FetchTaskType:
+		return NewFetchTaskFromModel(task)
+	case ThumbWarmTaskType:
+		return NewThumbWarmTaskFromModel(task)
+	case TranscodeTaskType:
+		return NewTranscodeTaskFromModel(task)
+	case DocPreviewTaskType:
+		return NewDocPreviewTaskFromModel(task)
+	case HLSTaskType:
+		return NewHLSTaskFromModel(task)
 	default:
 		return nil, ErrUnknownTaskType
 	}
@@ -115,4 +115,16 @@ func TestGetJobFromModel(t *testing.T) {
 		asserts.Nil(job)
 		asserts.Error(err)
 	}
+	// FetchTaskType
+	{
+		task := &model.Task{
+			Status: 0,
+			Type:   FetchTaskType,
+		}
+		mock.ExpectQuery("SELECT(.+)users(.+)").WillReturnError(errors.New("error"))
+		job, err := GetJobFromModel(task)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Nil(job)
+		asserts.Error(err)
+	}
 }
@@ -0,0 +1,539 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sync"
+	"time"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+	"github.com/juju/ratelimit"
+)
+
+const (
+	// migrateBatchSize 每批次查询的文件数量
+	migrateBatchSize = 100
+	// migrateMaxRetries 存储端限流时单个文件的最大重试次数
+	migrateMaxRetries = 5
+)
+
+// migrateRetryInterval 存储端限流时首次重试前的等待时间，之后每次加倍
+var migrateRetryInterval = time.Second
+
+// migrateAborts 已请求中止的迁移任务ID
+var migrateAborts sync.Map
+
+var (
+	// errMigrateSkipped 文件不满足迁移条件，已跳过
+	errMigrateSkipped = errors.New("file skipped")
+	// errMigrateVerifyFailed 目标存储中的文件校验失败
+	errMigrateVerifyFailed = errors.New("failed to verify migrated file")
+	// errMigrateAborted 迁移任务已被中止
+	errMigrateAborted = errors.New("migrate task aborted")
+)
+
+// MigrateTask 存储策略迁移任务
+type MigrateTask struct {
+	User      *model.User
+	TaskModel *model.Task
+	TaskProps MigrateProps
+	Err       *JobError
+
+	canceled bool
+	mu       sync.Mutex
+	inflight sync.Map  // 正在写入的目标路径
+	pause    time.Time // 存储端限流时，所有文件暂停迁移至此时间
+}
+
+// MigrateProps 存储策略迁移任务属性
+type MigrateProps struct {
+	SrcPolicyID uint `json:"src_policy_id"`         // 源存储策略ID
+	DstPolicyID uint `json:"dst_policy_id"`         // 目标存储策略ID
+	UserID      uint `json:"user_id,omitempty"`     // 仅迁移此用户的文件，0 表示不限
+	FolderID    uint `json:"folder_id,omitempty"`   // 仅迁移此目录及其子目录下的文件，0 表示不限
+	SpeedLimit  int  `json:"speed_limit"`           // 每秒传输字节数上限，0 表示不限
+	Concurrency int  `json:"concurrency,omitempty"` // 同时迁移的文件数，0 表示使用全局设定
+
+	// 迁移进度，用于中断后恢复
+	LastID       uint   `json:"last_id"`       // 此ID及之前的文件均已处理
+	Total        int    `json:"total"`         // 任务开始时待迁移的文件数
+	Migrated     int    `json:"migrated"`      // 已迁移文件数
+	MigratedSize uint64 `json:"migrated_size"` // 已迁移文件的总大小
+	Skipped      int    `json:"skipped"`       // 已跳过文件数
+	Failed       int    `json:"failed"`        // 迁移失败文件数
+	Throttled    int    `json:"throttled"`     // 存储端限流重试次数
+}
+
+// AbortMigrateTask 请求中止迁移任务，进行中的文件迁移完成后任务停止，
+// 任务未在运行时返回 false
+func AbortMigrateTask(id uint) bool {
+	var task model.Task
+	if err := model.DB.Where("id = ? and type = ? and status in (?)", id, MigrateTaskType,
+		[]int{Queued, Processing}).First(&task).Error; err != nil {
+		return false
+	}
+
+	migrateAborts.Store(id, true)
+	return true
+}
+
+// Props 获取任务属性
+func (job *MigrateTask) Props() string {
+	res, _ := json.Marshal(job.TaskProps)
+	return string(res)
+}
+
+// Type 获取任务状态
+func (job *MigrateTask) Type() int {
+	return MigrateTaskType
+}
+
+// Creator 获取创建者ID
+func (job *MigrateTask) Creator() uint {
+	return job.User.ID
+}
+
+// Model 获取任务的数据库模型
+func (job *MigrateTask) Model() *model.Task {
+	return job.TaskModel
+}
+
+// SetStatus 设定状态
+func (job *MigrateTask) SetStatus(status int) {
+	job.TaskModel.SetStatus(status)
+}
+
+// SetError 设定任务失败信息
+func (job *MigrateTask) SetError(err *JobError) {
+	job.Err = err
+	res, _ := json.Marshal(job.Err)
+	job.TaskModel.SetError(string(res))
+}
+
+// SetErrorMsg 设定任务失败信息
+func (job *MigrateTask) SetErrorMsg(msg string, err error) {
+	jobErr := &JobError{Msg: msg}
+	if err != nil {
+		jobErr.Error = err.Error()
+	}
+	job.SetError(jobErr)
+}
+
+// GetError 返回任务失败信息
+func (job *MigrateTask) GetError() *JobError {
+	return job.Err
+}
+
+// Canceled 返回任务是否已被中止
+func (job *MigrateTask) Canceled() bool {
+	return job.canceled
+}
+
+// Do 开始执行任务
+func (job *MigrateTask) Do() {
+	ctx := context.Background()
+
+	srcFs, err := job.newFileSystem(job.TaskProps.SrcPolicyID)
+	if err != nil {
+		job.SetErrorMsg("Failed to initialize source policy.", err)
+		return
+	}
+	defer srcFs.Recycle()
+
+	dstFs, err := job.newFileSystem(job.TaskProps.DstPolicyID)
+	if err != nil {
+		job.SetErrorMsg("Failed to initialize destination policy.", err)
+		return
+	}
+	defer dstFs.Recycle()
+
+	// 限定目录时查找所有子目录
+	var folderIDs []uint
+	if job.TaskProps.FolderID > 0 {
+		var root model.Folder
+		if err := model.DB.First(&root, job.TaskProps.FolderID).Error; err != nil {
+			job.SetErrorMsg("Folder not exist.", err)
+			return
+		}
+
+		folders, err := model.GetRecursiveChildFolder([]uint{root.ID}, root.OwnerID, true)
+		if err != nil {
+			job.SetErrorMsg("Failed to list child folders.", err)
+			return
+		}
+
+		for _, folder := range folders {
+			folderIDs = append(folderIDs, folder.ID)
+		}
+	}
+
+	// 统计待迁移文件数，恢复的任务沿用之前的统计
+	query := func() *gorm.DB {
+		tx := model.DB.Model(&model.File{}).Where("policy_id = ?", job.TaskProps.SrcPolicyID)
+		if job.TaskProps.UserID > 0 {
+			tx = tx.Where("user_id = ?", job.TaskProps.UserID)
+		}
+		if len(folderIDs) > 0 {
+			tx = tx.Where("folder_id in (?)", folderIDs)
+		}
+		return tx
+	}
+	if job.TaskProps.LastID == 0 {
+		if err := query().Count(&job.TaskProps.Total).Error; err != nil {
+			job.SetErrorMsg("Failed to count files.", err)
+			return
+		}
+	}
+
+	concurrency := job.TaskProps.Concurrency
+	if concurrency <= 0 {
+		concurrency = model.GetIntSetting("migrate_concurrency", 4)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	job.TaskModel.SetProgress(TransferringProgress)
+	for {
+		var files []model.File
+		if err := query().Where("id > ?", job.TaskProps.LastID).
+			Order("id asc").Limit(migrateBatchSize).Find(&files).Error; err != nil {
+			job.SetErrorMsg("Failed to list files.", err)
+			return
+		}
+
+		if len(files) == 0 {
+			break
+		}
+
+		if err := job.migrateBatch(ctx, srcFs, dstFs, files, concurrency); err != nil {
+			util.Log().Info("Migrate task #%d aborted: %d migrated, %d skipped, %d failed.",
+				job.TaskModel.ID, job.TaskProps.Migrated, job.TaskProps.Skipped, job.TaskProps.Failed)
+			job.TaskModel.SetProps(job.Props())
+			job.canceled = true
+			job.SetStatus(Canceled)
+			return
+		}
+	}
+
+	util.Log().Info("Migrate task finished: %d migrated, %d skipped, %d failed.",
+		job.TaskProps.Migrated, job.TaskProps.Skipped, job.TaskProps.Failed)
+	if job.TaskProps.Failed > 0 {
+		job.SetErrorMsg(fmt.Sprintf("%d file(s) failed to migrate.", job.TaskProps.Failed), nil)
+	}
+}
+
+// aborted 返回任务是否已被请求中止
+func (job *MigrateTask) aborted() bool {
+	_, ok := migrateAborts.Load(job.TaskModel.ID)
+	return ok
+}
+
+// migrateBatch 以 concurrency 个并发迁移一批按ID升序排列的文件。每个文件完成后将
+// LastID 推进至连续完成的最后一个文件并保存，中断后从此处继续，已迁移的文件不再被查询到。
+// 任务被中止时不再开始新文件，等待进行中的文件完成后返回 errMigrateAborted
+func (job *MigrateTask) migrateBatch(ctx context.Context, srcFs, dstFs *filesystem.FileSystem, files []model.File, concurrency int) error {
+	var (
+		wg    sync.WaitGroup
+		queue = make(chan int)
+		done  = make([]bool, len(files))
+		next  = 0
+	)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range queue {
+				err := job.migrateWithRetry(ctx, srcFs, dstFs, &files[index])
+
+				job.mu.Lock()
+				switch {
+				case err == nil:
+					job.TaskProps.Migrated++
+					job.TaskProps.MigratedSize += files[index].Size
+				case errors.Is(err, errMigrateSkipped):
+					job.TaskProps.Skipped++
+				default:
+					util.Log().Warning("Failed to migrate file %q: %s", files[index].Name, err)
+					job.TaskProps.Failed++
+				}
+
+				// 记录进度，以便中断后从此处继续
+				done[index] = true
+				for next < len(files) && done[next] {
+					job.TaskProps.LastID = files[next].ID
+					next++
+				}
+				job.TaskModel.SetProps(job.Props())
+				job.mu.Unlock()
+			}
+		}()
+	}
+
+	aborted := false
+	for i := range files {
+		if job.aborted() {
+			aborted = true
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	if aborted {
+		migrateAborts.Delete(job.TaskModel.ID)
+		return errMigrateAborted
+	}
+
+	return nil
+}
+
+// migrateWithRetry 迁移单个文件，存储端限流时暂停所有文件的迁移并重试
+func (job *MigrateTask) migrateWithRetry(ctx context.Context, srcFs, dstFs *filesystem.FileSystem, file *model.File) error {
+	interval := migrateRetryInterval
+	for retry := 0; ; retry++ {
+		job.mu.Lock()
+		wait := time.Until(job.pause)
+		job.mu.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		err := job.migrate(ctx, srcFs, dstFs, file)
+		if !filesystem.IsThrottleError(err) || retry >= migrateMaxRetries {
+			return err
+		}
+
+		util.Log().Debug("Storage throttled while migrating %q, retry in %s: %s", file.Name, interval, err)
+		job.mu.Lock()
+		job.TaskProps.Throttled++
+		if until := time.Now().Add(interval); until.After(job.pause) {
+			job.pause = until
+		}
+		job.mu.Unlock()
+		interval *= 2
+	}
+}
+
+// newFileSystem 创建使用给定存储策略的文件系统
+func (job *MigrateTask) newFileSystem(policyID uint) (*filesystem.FileSystem, error) {
+	policy, err := model.GetPolicyByID(policyID)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := filesystem.NewFileSystem(job.User)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.Policy = &policy
+	if err := fs.DispatchHandler(); err != nil {
+		fs.Recycle()
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// migrate 将单个文件复制到目标存储策略，校验后更新文件记录，最后删除源文件。
+// 更新记录前出错时删除已复制的文件，文件记录始终指向存在的对象
+func (job *MigrateTask) migrate(ctx context.Context, srcFs, dstFs *filesystem.FileSystem, file *model.File) error {
+	// 共用同一物理文件的记录需一并迁移，有进行中的上传会话时跳过
+	var siblings []model.File
+	if err := model.DB.Where("policy_id = ? and source_name = ?", file.PolicyID, file.SourceName).
+		Find(&siblings).Error; err != nil {
+		return err
+	}
+
+	ids := make([]uint, 0, len(siblings))
+	for _, sibling := range siblings {
+		if sibling.UploadSessionID != nil {
+			return errMigrateSkipped
+		}
+		ids = append(ids, sibling.ID)
+	}
+
+	if len(ids) == 0 {
+		return errMigrateSkipped
+	}
+
+	// 生成目标存储路径
+	virtualPath := "/"
+	if folders, err := model.GetFoldersByIDs([]uint{file.FolderID}, file.UserID); err == nil && len(folders) > 0 {
+		if err := folders[0].TraceRoot(); err == nil {
+			virtualPath = path.Join(folders[0].Position, folders[0].Name)
+		}
+	}
+	dst, err := job.reserveDst(dstFs.Policy, file, virtualPath)
+	if err != nil {
+		return err
+	}
+	defer job.inflight.Delete(dst)
+
+	// 复制文件内容
+	rs, err := srcFs.OpenObject(filesystem.WithInternalRead(context.WithValue(ctx, fsctx.FileModelCtx, *file)), file)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader = rs
+	if job.TaskProps.SpeedLimit > 0 {
+		bucket := ratelimit.NewBucketWithRate(float64(job.TaskProps.SpeedLimit), int64(job.TaskProps.SpeedLimit))
+		reader = ratelimit.Reader(rs, bucket)
+	}
+
+	err = dstFs.Handler.Put(ctx, &fsctx.FileStream{
+		File:     ioutil.NopCloser(reader),
+		Size:     file.Size,
+		Name:     file.Name,
+		SavePath: dst,
+		Mode:     fsctx.Overwrite,
+	})
+	rs.Close()
+	if err != nil {
+		return err
+	}
+
+	// 校验目标文件后更新记录，失败时删除已复制的文件
+	rollback := func() {
+		if _, err := dstFs.Handler.Delete(ctx, []string{dst}); err != nil {
+			util.Log().Warning("Failed to delete migrated object %q: %s", dst, err)
+		}
+	}
+
+	migrated := *file
+	migrated.PolicyID = dstFs.Policy.ID
+	migrated.SourceName = dst
+	migrated.Shards = ""
+	migrated.Policy = *dstFs.Policy
+	if err := verifyMigratedFile(context.WithValue(ctx, fsctx.FileModelCtx, migrated), dstFs, dst, file.Size); err != nil {
+		rollback()
+		return err
+	}
+
+	affected, err := model.MigrateFilesPolicy(ids, file.PolicyID, file.SourceName, dstFs.Policy.ID, dst)
+	if err != nil {
+		rollback()
+		return err
+	}
+
+	// 文件已在迁移期间被删除或修改
+	if affected == 0 {
+		rollback()
+		return errMigrateSkipped
+	}
+
+	// 记录已指向新对象后才删除源文件，迁移期间新增的引用仍在使用时保留源文件
+	var remaining int
+	if err := model.DB.Model(&model.File{}).Where("policy_id = ? and source_name = ?", file.PolicyID, file.SourceName).
+		Count(&remaining).Error; err != nil || remaining > 0 {
+		util.Log().Info("Source object %q is still referenced, skip deleting.", file.SourceName)
+		return nil
+	}
+
+	if failed, err := srcFs.Handler.Delete(ctx, append([]string{file.SourceName}, file.ShardSources()...)); err != nil {
+		util.Log().Warning("Failed to delete source objects %v after migration: %s", failed, err)
+	}
+
+	return nil
+}
+
+// reserveDst 生成文件在目标存储策略中的路径。路径已被其他文件记录引用或正由其他文件写入时
+// 在文件名前添加随机前缀，避免覆盖仍在使用的对象
+func (job *MigrateTask) reserveDst(policy *model.Policy, file *model.File, virtualPath string) (string, error) {
+	dir := policy.GeneratePath(file.UserID, virtualPath)
+	name := policy.GenerateFileName(file.UserID, file.Name)
+	for attempt := 0; ; attempt++ {
+		dst := path.Join(dir, name)
+		if _, loaded := job.inflight.LoadOrStore(dst, true); !loaded {
+			var referenced int
+			if err := model.DB.Model(&model.File{}).Where("policy_id = ? and source_name = ?", policy.ID, dst).
+				Count(&referenced).Error; err != nil {
+				job.inflight.Delete(dst)
+				return "", err
+			}
+
+			if referenced == 0 {
+				return dst, nil
+			}
+			job.inflight.Delete(dst)
+		}
+
+		if attempt >= 10 {
+			return "", fmt.Errorf("no available destination path for %q", file.Name)
+		}
+		name = util.RandStringRunes(8) + "_" + policy.GenerateFileName(file.UserID, file.Name)
+	}
+}
+
+// verifyMigratedFile 校验目标存储中文件的大小
+func verifyMigratedFile(ctx context.Context, fs *filesystem.FileSystem, dst string, size uint64) error {
+	rs, err := fs.Handler.Get(ctx, dst)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errMigrateVerifyFailed, err)
+	}
+	defer rs.Close()
+
+	actual, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errMigrateVerifyFailed, err)
+	}
+
+	if uint64(actual) != size {
+		return fmt.Errorf("%w: expect size %d, got %d", errMigrateVerifyFailed, size, actual)
+	}
+
+	return nil
+}
+
+// NewMigrateTask 新建存储策略迁移任务
+func NewMigrateTask(user uint, props MigrateProps) (Job, error) {
+	creator, err := model.GetActiveUserByID(user)
+	if err != nil {
+		return nil, err
+	}
+
+	newTask := &MigrateTask{
+		User:      &creator,
+		TaskProps: props,
+	}
+
+	record, err := Record(newTask)
+	if err != nil {
+		return nil, err
+	}
+	newTask.TaskModel = record
+
+	return newTask, nil
+}
+
+// NewMigrateTaskFromModel 从数据库记录中恢复存储策略迁移任务
+func NewMigrateTaskFromModel(task *model.Task) (Job, error) {
+	user, err := model.GetActiveUserByID(task.UserID)
+	if err != nil {
+		return nil, err
+	}
+	newTask := &MigrateTask{
+		User:      &user,
+		TaskModel: task,
+	}
+
+	err = json.Unmarshal([]byte(task.Props), &newTask.TaskProps)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTask, nil
+}
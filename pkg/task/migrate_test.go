@@ -0,0 +1,209 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateTask_Props(t *testing.T) {
+	asserts := assert.New(t)
+	task := &MigrateTask{
+		User: &model.User{},
+	}
+	asserts.NotEmpty(task.Props())
+	asserts.Equal(MigrateTaskType, task.Type())
+	asserts.EqualValues(0, task.Creator())
+	asserts.Nil(task.Model())
+}
+
+func TestMigrateTask_Do(t *testing.T) {
+	asserts := assert.New(t)
+	task := &MigrateTask{
+		User: &model.User{},
+		TaskModel: &model.Task{
+			Model: gorm.Model{ID: 1},
+		},
+		TaskProps: MigrateProps{SrcPolicyID: 64, DstPolicyID: 65},
+	}
+
+	// 源存储策略不存在
+	{
+		cache.Deletes([]string{"64"}, "policy_")
+		mock.ExpectQuery("SELECT(.+)policies(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		// 设定失败状态
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		task.Do()
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NotEmpty(task.Err.Error)
+		task.Err = nil
+	}
+}
+
+func newMigrateTestFs(rule string) *filesystem.FileSystem {
+	fs := &filesystem.FileSystem{
+		User:   &model.User{},
+		Policy: &model.Policy{Type: "local", DirNameRule: rule, FileNameRule: "{originname}"},
+	}
+	fs.DispatchHandler()
+	return fs
+}
+
+func TestMigrateTask_migrate(t *testing.T) {
+	asserts := assert.New(t)
+	task := &MigrateTask{User: &model.User{}}
+	srcFs := newMigrateTestFs("tests/TestMigrate/src")
+	srcFs.Policy.ID = 1
+	dstFs := newMigrateTestFs("tests/TestMigrate/dst")
+	dstFs.Policy.ID = 2
+	src := "tests/TestMigrate/src/test.txt"
+	dst := "tests/TestMigrate/dst/test.txt"
+	file := &model.File{Name: "test.txt", SourceName: src, PolicyID: 1, Size: 4, FolderID: 1, UserID: 1}
+	file.ID = 1
+
+	// 有进行中的上传会话
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "upload_session_id"}).AddRow(1, "session"))
+		err := task.migrate(context.Background(), srcFs, dstFs, file)
+		asserts.ErrorIs(err, errMigrateSkipped)
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+
+	// 更新记录失败，回滚已复制的文件
+	{
+		f, _ := util.CreatNestedFile(util.RelativePath(src))
+		f.WriteString("test")
+		f.Close()
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "/"))
+		mock.ExpectQuery("SELECT count(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		err := task.migrate(context.Background(), srcFs, dstFs, file)
+		asserts.Error(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.True(util.Exists(util.RelativePath(src)))
+		asserts.False(util.Exists(util.RelativePath(dst)))
+	}
+
+	// 成功
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		mock.ExpectQuery("SELECT(.+)folders(.+)").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "/"))
+		mock.ExpectQuery("SELECT count(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)files(.+)").WithArgs(2, "", dst, sqlmock.AnyArg(), sqlmock.AnyArg(), 1, src).
+			WillReturnResult(sqlmock.NewResult(1, 2))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT count(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		err := task.migrate(context.Background(), srcFs, dstFs, file)
+		asserts.NoError(err)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.False(util.Exists(util.RelativePath(src)))
+		content, _ := ioutil.ReadFile(util.RelativePath(dst))
+		asserts.Equal("test", string(content))
+	}
+
+	os.RemoveAll(util.RelativePath("tests/TestMigrate"))
+}
+
+func TestMigrateTask_reserveDst(t *testing.T) {
+	asserts := assert.New(t)
+	task := &MigrateTask{User: &model.User{}}
+	policy := &model.Policy{Type: "local", DirNameRule: "dst", FileNameRule: "{originname}"}
+	file := &model.File{Name: "test.txt", UserID: 1}
+
+	// 未被引用
+	mock.ExpectQuery("SELECT count(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	dst, err := task.reserveDst(policy, file, "/")
+	asserts.NoError(err)
+	asserts.Equal("dst/test.txt", dst)
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 正由其他文件写入，已被其他记录引用
+	mock.ExpectQuery("SELECT count(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT count(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	another, err := task.reserveDst(policy, file, "/")
+	asserts.NoError(err)
+	asserts.NotEqual(dst, another)
+	asserts.Contains(another, "_test.txt")
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 查询失败
+	task.inflight.Delete(dst)
+	mock.ExpectQuery("SELECT count(.+)files(.+)").WillReturnError(errors.New("error"))
+	_, err = task.reserveDst(policy, file, "/")
+	asserts.Error(err)
+	asserts.NoError(mock.ExpectationsWereMet())
+	_, reserved := task.inflight.Load(dst)
+	asserts.False(reserved)
+}
+
+func TestMigrateTask_migrateBatch(t *testing.T) {
+	asserts := assert.New(t)
+	srcFs := newMigrateTestFs("tests/TestMigrateBatch/src")
+	dstFs := newMigrateTestFs("tests/TestMigrateBatch/dst")
+	files := []model.File{{Name: "1.txt"}, {Name: "2.txt"}}
+	files[0].ID = 3
+	files[1].ID = 5
+	sessionID := "session"
+
+	// 文件均被跳过，进度推进至最后一个文件
+	{
+		task := &MigrateTask{User: &model.User{}, TaskModel: &model.Task{Model: gorm.Model{ID: 1}}}
+		mock.MatchExpectationsInOrder(false)
+		for range files {
+			mock.ExpectQuery("SELECT(.+)files(.+)").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "upload_session_id"}).AddRow(1, sessionID))
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE(.+)tasks(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+		}
+		asserts.NoError(task.migrateBatch(context.Background(), srcFs, dstFs, files, 2))
+		mock.MatchExpectationsInOrder(true)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.EqualValues(5, task.TaskProps.LastID)
+		asserts.Equal(2, task.TaskProps.Skipped)
+	}
+
+	// 已请求中止
+	{
+		task := &MigrateTask{User: &model.User{}, TaskModel: &model.Task{Model: gorm.Model{ID: 2}}}
+		migrateAborts.Store(uint(2), true)
+		asserts.ErrorIs(task.migrateBatch(context.Background(), srcFs, dstFs, files, 2), errMigrateAborted)
+		asserts.EqualValues(0, task.TaskProps.LastID)
+		asserts.False(task.aborted())
+	}
+}
+
+func TestAbortMigrateTask(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 任务未在运行
+	mock.ExpectQuery("SELECT(.+)tasks(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	asserts.False(AbortMigrateTask(10))
+	asserts.NoError(mock.ExpectationsWereMet())
+
+	// 成功
+	mock.ExpectQuery("SELECT(.+)tasks(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	asserts.True(AbortMigrateTask(10))
+	asserts.NoError(mock.ExpectationsWereMet())
+	_, ok := migrateAborts.Load(uint(10))
+	asserts.True(ok)
+	migrateAborts.Delete(uint(10))
+}
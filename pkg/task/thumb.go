@@ -0,0 +1,146 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+)
+
+// ThumbWarmTask 目录缩略图预生成任务
+type ThumbWarmTask struct {
+	User      *model.User
+	TaskModel *model.Task
+	TaskProps ThumbWarmProps
+	Err       *JobError
+}
+
+// ThumbWarmProps 目录缩略图预生成任务属性
+type ThumbWarmProps struct {
+	FolderID uint `json:"folder_id"` // 目录ID
+
+	// 生成结果
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+}
+
+// Props 获取任务属性
+func (job *ThumbWarmTask) Props() string {
+	res, _ := json.Marshal(job.TaskProps)
+	return string(res)
+}
+
+// Type 获取任务状态
+func (job *ThumbWarmTask) Type() int {
+	return ThumbWarmTaskType
+}
+
+// Creator 获取创建者ID
+func (job *ThumbWarmTask) Creator() uint {
+	return job.User.ID
+}
+
+// Model 获取任务的数据库模型
+func (job *ThumbWarmTask) Model() *model.Task {
+	return job.TaskModel
+}
+
+// SetStatus 设定状态
+func (job *ThumbWarmTask) SetStatus(status int) {
+	job.TaskModel.SetStatus(status)
+}
+
+// SetError 设定任务失败信息
+func (job *ThumbWarmTask) SetError(err *JobError) {
+	job.Err = err
+	res, _ := json.Marshal(job.Err)
+	job.TaskModel.SetError(string(res))
+}
+
+// SetErrorMsg 设定任务失败信息
+func (job *ThumbWarmTask) SetErrorMsg(msg string, err error) {
+	jobErr := &JobError{Msg: msg}
+	if err != nil {
+		jobErr.Error = err.Error()
+	}
+	job.SetError(jobErr)
+}
+
+// GetError 返回任务失败信息
+func (job *ThumbWarmTask) GetError() *JobError {
+	return job.Err
+}
+
+// Do 开始执行任务
+func (job *ThumbWarmTask) Do() {
+	fs, err := filesystem.NewFileSystem(job.User)
+	if err != nil {
+		job.SetErrorMsg("Failed to initialize file system.", err)
+		return
+	}
+	defer fs.Recycle()
+
+	job.TaskModel.SetProgress(ListingProgress)
+	folder, err := model.GetFoldersByIDs([]uint{job.TaskProps.FolderID}, job.User.ID)
+	if err != nil || len(folder) == 0 {
+		job.SetErrorMsg("Folder not exist.", err)
+		return
+	}
+
+	files, err := folder[0].GetChildFiles()
+	if err != nil {
+		job.SetErrorMsg("Failed to list files.", err)
+		return
+	}
+
+	job.TaskProps.Total = len(files)
+	job.TaskModel.SetProps(job.Props())
+
+	// 生成缩略图，并发数与内存占用受缩略图任务池限制
+	job.TaskModel.SetProgress(GeneratingProgress)
+	res := fs.WarmThumbnails(context.Background(), files)
+	job.TaskProps.Succeeded = res.Succeeded
+	job.TaskProps.Failed = res.Failed
+	job.TaskProps.Skipped = res.Skipped
+	job.TaskModel.SetProps(job.Props())
+}
+
+// NewThumbWarmTask 新建目录缩略图预生成任务
+func NewThumbWarmTask(user *model.User, folderID uint) (Job, error) {
+	newTask := &ThumbWarmTask{
+		User: user,
+		TaskProps: ThumbWarmProps{
+			FolderID: folderID,
+		},
+	}
+
+	record, err := Record(newTask)
+	if err != nil {
+		return nil, err
+	}
+	newTask.TaskModel = record
+
+	return newTask, nil
+}
+
+// NewThumbWarmTaskFromModel 从数据库记录中恢复目录缩略图预生成任务
+func NewThumbWarmTaskFromModel(task *model.Task) (Job, error) {
+	user, err := model.GetActiveUserByID(task.UserID)
+	if err != nil {
+		return nil, err
+	}
+	newTask := &ThumbWarmTask{
+		User:      &user,
+		TaskModel: task,
+	}
+
+	err = json.Unmarshal([]byte(task.Props), &newTask.TaskProps)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTask, nil
+}
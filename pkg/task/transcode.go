@@ -0,0 +1,161 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+)
+
+// TranscodeTask 视频转码任务
+type TranscodeTask struct {
+	User      *model.User
+	TaskModel *model.Task
+	TaskProps TranscodeProps
+	Err       *JobError
+}
+
+// TranscodeProps 视频转码任务属性
+type TranscodeProps struct {
+	FileID uint `json:"file_id"` // 文件ID
+
+	// 转码结果
+	Percent int  `json:"percent"` // 转码进度百分比
+	Skipped bool `json:"skipped"` // 视频已可在浏览器中播放，无需转码
+}
+
+// Props 获取任务属性
+func (job *TranscodeTask) Props() string {
+	res, _ := json.Marshal(job.TaskProps)
+	return string(res)
+}
+
+// Type 获取任务状态
+func (job *TranscodeTask) Type() int {
+	return TranscodeTaskType
+}
+
+// Creator 获取创建者ID
+func (job *TranscodeTask) Creator() uint {
+	return job.User.ID
+}
+
+// Model 获取任务的数据库模型
+func (job *TranscodeTask) Model() *model.Task {
+	return job.TaskModel
+}
+
+// SetStatus 设定状态
+func (job *TranscodeTask) SetStatus(status int) {
+	job.TaskModel.SetStatus(status)
+}
+
+// SetError 设定任务失败信息
+func (job *TranscodeTask) SetError(err *JobError) {
+	job.Err = err
+	res, _ := json.Marshal(job.Err)
+	job.TaskModel.SetError(string(res))
+}
+
+// SetErrorMsg 设定任务失败信息
+func (job *TranscodeTask) SetErrorMsg(msg string, err error) {
+	jobErr := &JobError{Msg: msg}
+	if err != nil {
+		jobErr.Error = err.Error()
+	}
+	job.SetError(jobErr)
+}
+
+// GetError 返回任务失败信息
+func (job *TranscodeTask) GetError() *JobError {
+	return job.Err
+}
+
+// Do 开始执行任务
+func (job *TranscodeTask) Do() {
+	fs, err := filesystem.NewFileSystem(job.User)
+	if err != nil {
+		job.SetErrorMsg("Failed to initialize file system.", err)
+		return
+	}
+	defer fs.Recycle()
+
+	files, err := model.GetFilesByIDs([]uint{job.TaskProps.FileID}, job.User.ID)
+	if err != nil || len(files) == 0 {
+		job.SetErrorMsg("File not exist.", err)
+		return
+	}
+
+	job.TaskModel.SetProgress(TranscodingProgress)
+	skipped, err := fs.TranscodeVideo(context.Background(), &files[0], func(percent int) {
+		job.TaskProps.Percent = percent
+		job.TaskModel.SetProps(job.Props())
+	})
+	if err != nil {
+		// 原文件保持不变，仍可按原格式下载
+		util.Log().Warning("Failed to transcode video %q: %s", files[0].Name, err)
+		job.SetErrorMsg("Failed to transcode video.", err)
+		return
+	}
+
+	job.TaskProps.Skipped = skipped
+	job.TaskProps.Percent = 100
+	job.TaskModel.SetProps(job.Props())
+}
+
+// NewTranscodeTask 新建视频转码任务
+func NewTranscodeTask(user *model.User, fileID uint) (Job, error) {
+	newTask := &TranscodeTask{
+		User: user,
+		TaskProps: TranscodeProps{
+			FileID: fileID,
+		},
+	}
+
+	record, err := Record(newTask)
+	if err != nil {
+		return nil, err
+	}
+	newTask.TaskModel = record
+
+	return newTask, nil
+}
+
+// NewTranscodeTaskFromModel 从数据库记录中恢复视频转码任务
+func NewTranscodeTaskFromModel(task *model.Task) (Job, error) {
+	user, err := model.GetActiveUserByID(task.UserID)
+	if err != nil {
+		return nil, err
+	}
+	newTask := &TranscodeTask{
+		User:      &user,
+		TaskModel: task,
+	}
+
+	err = json.Unmarshal([]byte(task.Props), &newTask.TaskProps)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTask, nil
+}
+
+// HookTranscodeVideo 上传完成后，为设定格式的视频创建后台转码任务
+func HookTranscodeVideo(ctx context.Context, fs *filesystem.FileSystem, fileHeader fsctx.FileHeader) error {
+	fileModel, ok := fileHeader.Info().Model.(*model.File)
+	if !ok || fileModel.ID == 0 || !filesystem.IsTranscodeNeeded(fileModel.Name) {
+		return nil
+	}
+
+	job, err := NewTranscodeTask(fs.User, fileModel.ID)
+	if err != nil {
+		util.Log().Warning("Failed to create transcode task for %q: %s", fileModel.Name, err)
+		return nil
+	}
+
+	TaskPoll.Submit(job)
+	return nil
+}
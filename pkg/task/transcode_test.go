@@ -0,0 +1,142 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	testMock "github.com/stretchr/testify/mock"
+)
+
+func TestTranscodeTask_Props(t *testing.T) {
+	asserts := assert.New(t)
+	task := &TranscodeTask{
+		User: &model.User{},
+	}
+	asserts.NotEmpty(task.Props())
+	asserts.Equal(TranscodeTaskType, task.Type())
+	asserts.EqualValues(0, task.Creator())
+	asserts.Nil(task.Model())
+}
+
+func TestTranscodeTask_Do(t *testing.T) {
+	asserts := assert.New(t)
+	task := &TranscodeTask{
+		User:      &model.User{Policy: model.Policy{Type: "local"}},
+		TaskModel: &model.Task{Model: gorm.Model{ID: 1}},
+		TaskProps: TranscodeProps{FileID: 1},
+	}
+
+	// 文件不存在
+	{
+		mock.ExpectQuery("SELECT(.+)files(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		task.Do()
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NotNil(task.Err)
+	}
+}
+
+func TestNewTranscodeTask(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 成功
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		job, err := NewTranscodeTask(&model.User{}, 1)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(1, job.(*TranscodeTask).TaskProps.FileID)
+	}
+
+	// 失败
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		job, err := NewTranscodeTask(&model.User{}, 1)
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Nil(job)
+		asserts.Error(err)
+	}
+}
+
+func TestNewTranscodeTaskFromModel(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 成功
+	{
+		mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		job, err := NewTranscodeTaskFromModel(&model.Task{Props: `{"file_id":2}`})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.NoError(err)
+		asserts.EqualValues(2, job.(*TranscodeTask).TaskProps.FileID)
+	}
+
+	// JSON解析失败
+	{
+		mock.ExpectQuery("SELECT(.+)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		job, err := NewTranscodeTaskFromModel(&model.Task{Props: "?"})
+		asserts.NoError(mock.ExpectationsWereMet())
+		asserts.Error(err)
+		asserts.Nil(job)
+	}
+}
+
+func TestHookTranscodeVideo(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &filesystem.FileSystem{User: &model.User{}}
+	file := &model.File{Model: gorm.Model{ID: 1}, Name: "video.mkv"}
+	oldPool := TaskPoll
+	defer func() { TaskPoll = oldPool }()
+
+	// 未开启
+	{
+		cache.Set("setting_video_transcode_enabled", "0", 0)
+		asserts.NoError(HookTranscodeVideo(context.Background(), fs, &fsctx.FileStream{Model: file}))
+	}
+
+	cache.Set("setting_video_transcode_enabled", "1", 0)
+	cache.Set("setting_video_transcode_exts", "mkv,avi", 0)
+	defer cache.Set("setting_video_transcode_enabled", "0", 0)
+
+	// 不需要转码的格式
+	{
+		asserts.NoError(HookTranscodeVideo(context.Background(), fs, &fsctx.FileStream{
+			Model: &model.File{Model: gorm.Model{ID: 1}, Name: "video.mp4"},
+		}))
+	}
+
+	// 创建任务
+	{
+		mockPool := taskPoolMock{}
+		mockPool.On("Submit", testMock.Anything)
+		TaskPoll = mockPool
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		asserts.NoError(HookTranscodeVideo(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+		mockPool.AssertExpectations(t)
+	}
+
+	// 创建任务失败，不影响上传
+	{
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT(.+)").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		asserts.NoError(HookTranscodeVideo(context.Background(), fs, &fsctx.FileStream{Model: file}))
+		asserts.NoError(mock.ExpectationsWereMet())
+	}
+}
@@ -10,6 +10,12 @@ type Worker interface {
 	Do(Job) // 执行任务
 }
 
+// CancelableJob 可在执行中被中止的任务
+type CancelableJob interface {
+	Job
+	Canceled() bool // 返回任务是否已被中止
+}
+
 // GeneralWorker 通用Worker
 type GeneralWorker struct {
 }
@@ -31,6 +37,12 @@ func (worker *GeneralWorker) Do(job Job) {
 	// 开始执行任务
 	job.Do()
 
+	// 任务已被中止，保留中止状态
+	if cancelable, ok := job.(CancelableJob); ok && cancelable.Canceled() {
+		util.Log().Debug("Task canceled.")
+		return
+	}
+
 	// 任务执行失败
 	if err := job.GetError(); err != nil {
 		util.Log().Debug("Failed to execute task.")
@@ -78,4 +78,21 @@ func TestGeneralWorker_Do(t *testing.T) {
 		asserts.Equal(Error, job.Status)
 	}
 
+	// 已被中止
+	{
+		job := &MockCancelableJob{}
+		job.DoFunc = func() {
+			job.Status = Canceled
+		}
+		worker.Do(job)
+		asserts.Equal(Canceled, job.Status)
+	}
+}
+
+type MockCancelableJob struct {
+	MockJob
+}
+
+func (job *MockCancelableJob) Canceled() bool {
+	return job.Status == Canceled
 }
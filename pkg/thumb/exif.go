@@ -0,0 +1,180 @@
+package thumb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNoCaptureTime 图像中不存在可用的拍摄时间
+var ErrNoCaptureTime = errors.New("capture time not found in EXIF")
+
+const (
+	// exifSearchLimit 查找 EXIF 段时最多读取的字节数
+	exifSearchLimit = 256 << 10
+
+	exifTagExifIFD            = 0x8769
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagDateTimeDigitized  = 0x9004
+	exifTagOffsetTimeOriginal = 0x9011
+	exifTypeASCII             = 2
+	exifDateTimeLayout        = "2006:01:02 15:04:05"
+)
+
+// ReadCaptureTime 从 JPEG 图像的 EXIF 信息中读取拍摄时间，优先使用 DateTimeOriginal，
+// 其次为 DateTimeDigitized。存在 OffsetTimeOriginal 时按其时区解析，否则视为 UTC。
+// 无 EXIF 信息或字段格式错误时返回 ErrNoCaptureTime
+func ReadCaptureTime(r io.Reader) (time.Time, error) {
+	tiff, err := findExifSegment(bufio.NewReader(io.LimitReader(r, exifSearchLimit)))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tags, err := readExifTags(tiff)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	loc := time.UTC
+	if offset, ok := tags[exifTagOffsetTimeOriginal]; ok {
+		if zone, err := time.Parse("-07:00", offset); err == nil {
+			loc = zone.Location()
+		}
+	}
+
+	for _, tag := range []uint16{exifTagDateTimeOriginal, exifTagDateTimeDigitized} {
+		if value, ok := tags[tag]; ok {
+			if t, err := time.ParseInLocation(exifDateTimeLayout, value, loc); err == nil && t.Year() > 1 {
+				return t, nil
+			}
+		}
+	}
+
+	return time.Time{}, ErrNoCaptureTime
+}
+
+// findExifSegment 在 JPEG 数据中查找 APP1 EXIF 段，返回其中的 TIFF 数据
+func findExifSegment(r *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, ErrNoCaptureTime
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrNoCaptureTime
+		}
+		if b != 0xFF {
+			return nil, ErrNoCaptureTime
+		}
+
+		// 跳过填充字节
+		marker := byte(0xFF)
+		for marker == 0xFF {
+			if marker, err = r.ReadByte(); err != nil {
+				return nil, ErrNoCaptureTime
+			}
+		}
+
+		// 图像数据开始或结束，不再有 EXIF 段
+		if marker == 0xDA || marker == 0xD9 {
+			return nil, ErrNoCaptureTime
+		}
+
+		var size uint16
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil || size < 2 {
+			return nil, ErrNoCaptureTime
+		}
+
+		payload := make([]byte, size-2)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, ErrNoCaptureTime
+		}
+
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return payload[6:], nil
+		}
+	}
+}
+
+// readExifTags 解析 TIFF 数据，返回 EXIF 子目录中与拍摄时间相关的 ASCII 字段
+func readExifTags(tiff []byte) (map[uint16]string, error) {
+	if len(tiff) < 8 {
+		return nil, ErrNoCaptureTime
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, ErrNoCaptureTime
+	}
+
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil, ErrNoCaptureTime
+	}
+
+	// 在 IFD0 中查找 EXIF 子目录
+	var exifOffset uint32
+	found := walkIFD(tiff, order, order.Uint32(tiff[4:]), func(tag, typ uint16, count uint32, value []byte) {
+		if tag == exifTagExifIFD {
+			exifOffset = order.Uint32(value)
+		}
+	})
+	if !found || exifOffset == 0 {
+		return nil, ErrNoCaptureTime
+	}
+
+	tags := make(map[uint16]string)
+	walkIFD(tiff, order, exifOffset, func(tag, typ uint16, count uint32, value []byte) {
+		switch tag {
+		case exifTagDateTimeOriginal, exifTagDateTimeDigitized, exifTagOffsetTimeOriginal:
+			if typ != exifTypeASCII {
+				return
+			}
+
+			data := value
+			if count > 4 {
+				offset := order.Uint32(value)
+				if uint64(offset)+uint64(count) > uint64(len(tiff)) {
+					return
+				}
+				data = tiff[offset : offset+count]
+			} else {
+				data = data[:count]
+			}
+			tags[tag] = strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+		}
+	})
+
+	return tags, nil
+}
+
+// walkIFD 依次回调 offset 处 IFD 中的每个条目，value 为条目中 4 字节的值或偏移量。
+// IFD 超出数据范围时返回 false
+func walkIFD(tiff []byte, order binary.ByteOrder, offset uint32, fn func(tag, typ uint16, count uint32, value []byte)) bool {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return false
+	}
+
+	num := uint64(order.Uint16(tiff[offset:]))
+	start := uint64(offset) + 2
+	if start+num*12 > uint64(len(tiff)) {
+		return false
+	}
+
+	for i := uint64(0); i < num; i++ {
+		entry := tiff[start+i*12 : start+i*12+12]
+		fn(order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:]), entry[8:12])
+	}
+
+	return true
+}
@@ -0,0 +1,122 @@
+package thumb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildExifJPEG 构造仅包含 EXIF 段的 JPEG 数据，tags 为 EXIF 子目录中的 ASCII 字段
+func buildExifJPEG(order binary.ByteOrder, tags map[uint16]string) []byte {
+	tiff := &bytes.Buffer{}
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(tiff, order, uint16(42))
+	binary.Write(tiff, order, uint32(8))
+
+	// IFD0，仅包含指向 EXIF 子目录的条目
+	exifOffset := uint32(8 + 2 + 12 + 4)
+	binary.Write(tiff, order, uint16(1))
+	binary.Write(tiff, order, []uint16{exifTagExifIFD, 4})
+	binary.Write(tiff, order, []uint32{1, exifOffset})
+	binary.Write(tiff, order, uint32(0))
+
+	// EXIF 子目录，字段值统一存放在目录之后
+	keys := []uint16{exifTagDateTimeOriginal, exifTagDateTimeDigitized, exifTagOffsetTimeOriginal}
+	entries := make([]uint16, 0)
+	for _, key := range keys {
+		if _, ok := tags[key]; ok {
+			entries = append(entries, key)
+		}
+	}
+	dataOffset := exifOffset + 2 + uint32(len(entries))*12 + 4
+	data := &bytes.Buffer{}
+	binary.Write(tiff, order, uint16(len(entries)))
+	for _, key := range entries {
+		value := append([]byte(tags[key]), 0)
+		binary.Write(tiff, order, []uint16{key, exifTypeASCII})
+		binary.Write(tiff, order, []uint32{uint32(len(value)), dataOffset + uint32(data.Len())})
+		data.Write(value)
+	}
+	binary.Write(tiff, order, uint32(0))
+	tiff.Write(data.Bytes())
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	res := &bytes.Buffer{}
+	res.Write([]byte{0xFF, 0xD8})
+	// 其他段应被跳过
+	res.Write([]byte{0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00})
+	res.Write([]byte{0xFF, 0xE1})
+	binary.Write(res, binary.BigEndian, uint16(len(payload)+2))
+	res.Write(payload)
+	res.Write([]byte{0xFF, 0xD9})
+	return res.Bytes()
+}
+
+func TestReadCaptureTime(t *testing.T) {
+	a := assert.New(t)
+
+	// 非 JPEG
+	{
+		_, err := ReadCaptureTime(bytes.NewReader([]byte("not an image")))
+		a.Equal(ErrNoCaptureTime, err)
+	}
+
+	// 无 EXIF 段
+	{
+		_, err := ReadCaptureTime(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}))
+		a.Equal(ErrNoCaptureTime, err)
+	}
+
+	// 无时区，视为 UTC
+	{
+		res, err := ReadCaptureTime(bytes.NewReader(buildExifJPEG(binary.LittleEndian, map[uint16]string{
+			exifTagDateTimeOriginal: "2021:07:15 10:20:30",
+		})))
+		a.NoError(err)
+		a.True(res.Equal(time.Date(2021, 7, 15, 10, 20, 30, 0, time.UTC)))
+	}
+
+	// 带时区偏移
+	{
+		res, err := ReadCaptureTime(bytes.NewReader(buildExifJPEG(binary.BigEndian, map[uint16]string{
+			exifTagDateTimeOriginal:   "2021:07:15 10:20:30",
+			exifTagOffsetTimeOriginal: "+08:00",
+		})))
+		a.NoError(err)
+		a.True(res.Equal(time.Date(2021, 7, 15, 2, 20, 30, 0, time.UTC)))
+	}
+
+	// DateTimeOriginal 格式错误时使用 DateTimeDigitized
+	{
+		res, err := ReadCaptureTime(bytes.NewReader(buildExifJPEG(binary.LittleEndian, map[uint16]string{
+			exifTagDateTimeOriginal:  "0000:00:00 00:00:00",
+			exifTagDateTimeDigitized: "2020:01:02 03:04:05",
+		})))
+		a.NoError(err)
+		a.True(res.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+	}
+
+	// 字段均格式错误
+	{
+		_, err := ReadCaptureTime(bytes.NewReader(buildExifJPEG(binary.LittleEndian, map[uint16]string{
+			exifTagDateTimeOriginal: "yesterday",
+		})))
+		a.Equal(ErrNoCaptureTime, err)
+	}
+
+	// 数据被截断
+	{
+		data := buildExifJPEG(binary.LittleEndian, map[uint16]string{
+			exifTagDateTimeOriginal: "2021:07:15 10:20:30",
+		})
+		_, err := ReadCaptureTime(bytes.NewReader(data[:30]))
+		a.Equal(ErrNoCaptureTime, err)
+	}
+}
@@ -0,0 +1,139 @@
+package thumb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// displayP3Profile 将 sRGB 配置文件的原色替换为 Display P3 原色
+func displayP3Profile() []byte {
+	profile := append([]byte{}, SRGBProfile()...)
+	primaries := map[string][3]float64{
+		"rXYZ": {0.5151, 0.2412, -0.0011},
+		"gXYZ": {0.2919, 0.6922, 0.0419},
+		"bXYZ": {0.1572, 0.0666, 0.7841},
+	}
+
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count; i++ {
+		entry := profile[132+i*12:]
+		xyz, ok := primaries[string(entry[:4])]
+		if !ok {
+			continue
+		}
+
+		offset := int(binary.BigEndian.Uint32(entry[4:]))
+		for j, v := range xyz {
+			binary.BigEndian.PutUint32(profile[offset+8+j*4:], uint32(int32(math.Round(v*65536))))
+		}
+	}
+
+	return profile
+}
+
+func encodeTestImage(t *testing.T, img image.Image, format string, profile []byte) []byte {
+	var buf bytes.Buffer
+	if format == "png" {
+		assert.NoError(t, png.Encode(&buf, img))
+	} else {
+		assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	}
+
+	if profile == nil {
+		return buf.Bytes()
+	}
+	return embedICCProfile(buf.Bytes(), profile)
+}
+
+func TestSRGBProfile(t *testing.T) {
+	a := assert.New(t)
+	profile, err := parseICCProfile(SRGBProfile())
+	a.NoError(err)
+	a.Equal("RGB", profile.colorSpace)
+	a.Equal("sRGB IEC61966-2.1", profile.description)
+	a.True(profile.isSRGB())
+
+	p3, err := parseICCProfile(displayP3Profile())
+	a.NoError(err)
+	a.False(p3.isSRGB())
+
+	_, err = parseICCProfile([]byte("not a profile"))
+	a.Equal(ErrUnsupportedProfile, err)
+}
+
+func TestEmbedICCProfile(t *testing.T) {
+	a := assert.New(t)
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for _, format := range []string{"jpg", "png"} {
+		data := encodeTestImage(t, img, format, displayP3Profile())
+		a.Equal(displayP3Profile(), extractICCProfile(data), format)
+
+		// 嵌入后仍可正常解码
+		_, _, err := image.Decode(bytes.NewReader(data))
+		a.NoError(err, format)
+
+		a.Nil(extractICCProfile(encodeTestImage(t, img, format, nil)), format)
+	}
+
+	a.Equal([]byte("GIF89a"), embedICCProfile([]byte("GIF89a"), SRGBProfile()))
+}
+
+func TestThumb_ToSRGB(t *testing.T) {
+	a := assert.New(t)
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+
+	// 无配置文件或已是 sRGB 时不转换
+	for _, profile := range [][]byte{nil, SRGBProfile()} {
+		thumb, err := NewThumbFromFile(bytes.NewReader(encodeTestImage(t, img, "png", profile)), "1.png")
+		a.NoError(err)
+		converted, err := thumb.ToSRGB()
+		a.NoError(err)
+		a.False(converted)
+	}
+
+	// Display P3 转换到 sRGB
+	{
+		thumb, err := NewThumbFromFile(bytes.NewReader(encodeTestImage(t, img, "png", displayP3Profile())), "1.png")
+		a.NoError(err)
+		converted, err := thumb.ToSRGB()
+		a.NoError(err)
+		a.True(converted)
+
+		// P3 纯红超出 sRGB 色域，灰色保持不变
+		r, g, b, _ := thumb.src.At(0, 0).RGBA()
+		a.EqualValues(0xffff, r)
+		a.True(g < 0x1000 && b < 0x1000)
+		r, g, b, _ = thumb.src.At(1, 0).RGBA()
+		a.InDelta(r, g, 0x200)
+		a.InDelta(g, b, 0x200)
+
+		var out bytes.Buffer
+		a.NoError(thumb.Encode(&out, 90))
+		a.Equal(SRGBProfile(), extractICCProfile(out.Bytes()))
+	}
+
+	// CMYK 图像转换为 RGB
+	{
+		thumb := &Thumb{src: image.NewCMYK(image.Rect(0, 0, 2, 2)), ext: "jpg"}
+		converted, err := thumb.ToSRGB()
+		a.NoError(err)
+		a.True(converted)
+		a.False(isCMYK(thumb.src))
+	}
+
+	// 不支持的格式
+	{
+		thumb := &Thumb{src: img, ext: "gif"}
+		a.Error(thumb.Encode(&bytes.Buffer{}, 90))
+	}
+}
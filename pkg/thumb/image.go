@@ -1,6 +1,7 @@
 package thumb
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"image"
@@ -20,8 +21,10 @@ import (
 
 // Thumb 缩略图
 type Thumb struct {
-	src image.Image
-	ext string
+	src     image.Image
+	ext     string
+	profile []byte // 原图嵌入的色彩配置文件
+	srgb    bool   // 已转换到 sRGB，输出时嵌入 sRGB 配置文件
 }
 
 // NewThumbFromFile 从文件数据获取新的Thumb对象，
@@ -33,6 +36,10 @@ func NewThumbFromFile(file io.Reader, name string) (*Thumb, error) {
 		return nil, errors.New("未知的图像类型")
 	}
 
+	// 记录图像头部，用于提取嵌入的色彩配置文件
+	header := &headerRecorder{limit: iccSearchLimit}
+	file = io.TeeReader(file, header)
+
 	var err error
 	var img image.Image
 	switch ext[1:] {
@@ -52,11 +59,28 @@ func NewThumbFromFile(file io.Reader, name string) (*Thumb, error) {
 	}
 
 	return &Thumb{
-		src: img,
-		ext: ext[1:],
+		src:     img,
+		ext:     ext[1:],
+		profile: extractICCProfile(header.Bytes()),
 	}, nil
 }
 
+// bytesPerPixel 估算解码内存时每像素占用的字节数
+const bytesPerPixel = 4
+
+// EstimateMemory 读取图像头部中的尺寸，估算完整解码图像所需的内存字节数。
+// 返回的 Reader 包含已读取的头部，可继续用于解码
+func EstimateMemory(file io.Reader) (uint64, io.Reader, error) {
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(file, &header))
+	reader := io.MultiReader(&header, file)
+	if err != nil {
+		return 0, reader, err
+	}
+
+	return uint64(config.Width) * uint64(config.Height) * bytesPerPixel, reader, nil
+}
+
 // GetThumb 生成给定最大尺寸的缩略图
 func (image *Thumb) GetThumb(width, height uint) {
 	//image.src = resize.Thumbnail(width, height, image.src, resize.Lanczos3)
@@ -77,15 +101,75 @@ func (image *Thumb) Save(path string) (err error) {
 		return err
 	}
 	defer out.Close()
-	switch model.GetSettingByNameWithDefault("thumb_encode_method", "jpg") {
+	return image.encode(out, model.GetSettingByNameWithDefault("thumb_encode_method", "jpg"),
+		model.GetIntSetting("thumb_encode_quality", 85))
+}
+
+// Encode 按原图格式编码图像，JPEG 使用给定的质量
+func (image *Thumb) Encode(out io.Writer, quality int) error {
+	switch image.ext {
+	case "jpg", "jpeg", "png":
+		return image.encode(out, image.ext, quality)
+	}
+
+	return fmt.Errorf("encoding %q image is not supported", image.ext)
+}
+
+// encode 以 png 或 jpg 格式编码图像，已转换到 sRGB 时嵌入 sRGB 配置文件
+func (image *Thumb) encode(out io.Writer, method string, quality int) (err error) {
+	var buf bytes.Buffer
+	switch method {
 	case "png":
-		err = png.Encode(out, image.src)
+		err = png.Encode(&buf, image.src)
 	default:
-		err = jpeg.Encode(out, image.src, &jpeg.Options{Quality: model.GetIntSetting("thumb_encode_quality", 85)})
+		err = jpeg.Encode(&buf, image.src, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return err
+	}
+
+	data := buf.Bytes()
+	if image.srgb {
+		data = embedICCProfile(data, SRGBProfile())
 	}
 
+	_, err = out.Write(data)
 	return err
+}
+
+// ToSRGB 将图像转换到 sRGB 色彩空间，CMYK 图像转换为 RGB。
+// 未嵌入配置文件、配置文件已是 sRGB 或非 RGB/CMYK 色彩空间时不做处理，返回值表示图像是否被转换
+func (image *Thumb) ToSRGB() (bool, error) {
+	converted := false
+	if isCMYK(image.src) {
+		image.src = toRGB(image.src)
+		converted = true
+	}
+
+	if image.profile != nil {
+		profile, err := parseICCProfile(image.profile)
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case profile.colorSpace == "CMYK":
+			// CMYK 配置文件的转换需要查找表，按通用公式转换后视为 sRGB
+			converted = true
+		case profile.colorSpace != "RGB":
+			// 灰度等其他色彩空间不影响显示，保留原样
+		case !profile.isSRGB():
+			image.src = profile.convertToSRGB(image.src)
+			converted = true
+		}
+	}
+
+	if converted {
+		image.srgb = true
+		image.profile = nil
+	}
 
+	return converted, nil
 }
 
 // Thumbnail will downscale provided image to max width and height preserving
@@ -5,6 +5,7 @@ import (
 	"image"
 	"image/jpeg"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
@@ -144,3 +145,28 @@ func TestThumb_CreateAvatar(t *testing.T) {
 	asserts.True(util.Exists(util.RelativePath("tests/avatar_1_2.png")))
 	asserts.True(util.Exists(util.RelativePath("tests/avatar_1_0.png")))
 }
+
+func TestEstimateMemory(t *testing.T) {
+	asserts := assert.New(t)
+	file := CreateTestImage()
+	defer file.Close()
+
+	// 成功读取尺寸，且返回的数据流仍可完整解码
+	{
+		memory, reader, err := EstimateMemory(file)
+		asserts.NoError(err)
+		asserts.EqualValues(500*200*4, memory)
+		thumb, err := NewThumbFromFile(reader, "123.jpg")
+		asserts.NoError(err)
+		w, h := thumb.GetSize()
+		asserts.Equal(500, w)
+		asserts.Equal(200, h)
+	}
+
+	// 无法识别的格式
+	{
+		memory, _, err := EstimateMemory(strings.NewReader("not an image"))
+		asserts.Error(err)
+		asserts.EqualValues(0, memory)
+	}
+}
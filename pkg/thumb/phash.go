@@ -0,0 +1,111 @@
+package thumb
+
+import (
+	"image"
+	"math/bits"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// DHash 计算图像的 64 位差异哈希（dHash）。图像被缩放为 9x8 的灰度图后，
+// 逐行比较相邻像素亮度，缩放和重新压缩后的图像会得到相近的哈希值
+func (image *Thumb) DHash() uint64 {
+	return DHash(image.src)
+}
+
+// DHash 计算给定图像的 64 位差异哈希
+func DHash(img image.Image) uint64 {
+	gray := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.ApproxBiLinear.Scale(gray, gray.Rect, img, img.Bounds(), draw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray.GrayAt(x, y).Y > gray.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// HammingDistance 返回两个哈希值的汉明距离
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// BKTree 以汉明距离为度量的 BK 树，用于查找相似哈希
+type BKTree struct {
+	mu   sync.RWMutex
+	root *bkNode
+}
+
+type bkNode struct {
+	hash     uint64
+	ids      []uint
+	children map[int]*bkNode
+}
+
+// Add 向树中添加一个哈希值及其对应的文件 ID
+func (tree *BKTree) Add(hash uint64, id uint) {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	if tree.root == nil {
+		tree.root = &bkNode{hash: hash, ids: []uint{id}}
+		return
+	}
+
+	node := tree.root
+	for {
+		distance := HammingDistance(node.hash, hash)
+		if distance == 0 {
+			node.ids = append(node.ids, id)
+			return
+		}
+
+		child, ok := node.children[distance]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[distance] = &bkNode{hash: hash, ids: []uint{id}}
+			return
+		}
+		node = child
+	}
+}
+
+// Search 查找与 hash 的汉明距离不超过 maxDistance 的所有文件 ID
+func (tree *BKTree) Search(hash uint64, maxDistance int) []uint {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	res := make([]uint, 0)
+	if tree.root == nil {
+		return res
+	}
+
+	candidates := []*bkNode{tree.root}
+	for len(candidates) > 0 {
+		node := candidates[len(candidates)-1]
+		candidates = candidates[:len(candidates)-1]
+
+		distance := HammingDistance(node.hash, hash)
+		if distance <= maxDistance {
+			res = append(res, node.ids...)
+		}
+
+		// 根据三角不等式，只需检查距离在 [d-max, d+max] 内的子树
+		for childDistance, child := range node.children {
+			if childDistance >= distance-maxDistance && childDistance <= distance+maxDistance {
+				candidates = append(candidates, child)
+			}
+		}
+	}
+
+	return res
+}
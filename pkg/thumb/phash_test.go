@@ -0,0 +1,65 @@
+package thumb
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createGradient(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			v := uint8((x*255/w + y*128/h) % 256)
+			img.Set(x, y, color.RGBA{R: v, G: 255 - v, B: v / 2, A: 255})
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	asserts := assert.New(t)
+	origin := createGradient(400, 300)
+
+	// 缩放后的图像哈希相近
+	resized := Resize(120, 90, origin)
+	asserts.LessOrEqual(HammingDistance(DHash(origin), DHash(resized)), 5)
+
+	// 不同图像哈希差异大
+	flipped := image.NewRGBA(origin.Bounds())
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 300; y++ {
+			flipped.Set(399-x, y, origin.At(x, y))
+		}
+	}
+	asserts.Greater(HammingDistance(DHash(origin), DHash(flipped)), 10)
+
+	thumb := &Thumb{src: origin}
+	asserts.Equal(DHash(origin), thumb.DHash())
+}
+
+func TestHammingDistance(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.Equal(0, HammingDistance(1, 1))
+	asserts.Equal(1, HammingDistance(0, 1))
+	asserts.Equal(64, HammingDistance(0, ^uint64(0)))
+}
+
+func TestBKTree(t *testing.T) {
+	asserts := assert.New(t)
+	tree := &BKTree{}
+	asserts.Empty(tree.Search(0, 10))
+
+	tree.Add(0b0000, 1)
+	tree.Add(0b0001, 2)
+	tree.Add(0b0011, 3)
+	tree.Add(0b1111, 4)
+	tree.Add(0b0000, 5)
+
+	asserts.ElementsMatch([]uint{1, 5}, tree.Search(0, 0))
+	asserts.ElementsMatch([]uint{1, 2, 5}, tree.Search(0, 1))
+	asserts.ElementsMatch([]uint{1, 2, 3, 5}, tree.Search(0, 2))
+	asserts.ElementsMatch([]uint{3, 4}, tree.Search(0b0111, 1))
+}
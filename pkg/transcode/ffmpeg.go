@@ -0,0 +1,188 @@
+package transcode
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 浏览器普遍支持的容器、视频编码与音频编码
+var (
+	webContainers  = []string{"mp4", "m4v"}
+	webVideoCodecs = []string{"h264"}
+	webAudioCodecs = []string{"aac", "mp3"}
+)
+
+// MediaInfo 视频文件的编码信息
+type MediaInfo struct {
+	VideoCodec string        // 首个视频流的编码，无视频流时为空
+	AudioCodec string        // 首个音频流的编码，无音频流时为空
+	Duration   time.Duration // 时长，无法获取时为 0
+	Width      int           // 首个视频流的宽度
+	Height     int           // 首个视频流的高度
+	Bitrate    int64         // 总码率 (bit/s)，无法获取时为 0
+}
+
+// WebFriendly 返回扩展名为 ext 的此视频是否可直接在浏览器中播放
+func (info *MediaInfo) WebFriendly(ext string) bool {
+	if !contains(webContainers, strings.ToLower(strings.TrimPrefix(ext, "."))) {
+		return false
+	}
+
+	if !contains(webVideoCodecs, info.VideoCodec) {
+		return false
+	}
+
+	return info.AudioCodec == "" || contains(webAudioCodecs, info.AudioCodec)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Probe 使用 ffprobe 读取 input 的编码信息
+func Probe(ctx context.Context, ffprobe, input string) (*MediaInfo, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffprobe,
+		"-v", "error",
+		"-show_entries", "stream=codec_type,codec_name,width,height,bit_rate:format=duration,bit_rate",
+		"-of", "json",
+		input,
+	)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseProbe(output)
+}
+
+// parseProbe 解析 ffprobe 输出的 JSON
+func parseProbe(output []byte) (*MediaInfo, error) {
+	var res struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			BitRate   string `json:"bit_rate"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+			BitRate  string `json:"bit_rate"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(output, &res); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	info := &MediaInfo{}
+	videoBitrate := ""
+	for _, stream := range res.Streams {
+		switch {
+		case stream.CodecType == "video" && info.VideoCodec == "":
+			info.VideoCodec = stream.CodecName
+			info.Width = stream.Width
+			info.Height = stream.Height
+			videoBitrate = stream.BitRate
+		case stream.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = stream.CodecName
+		}
+	}
+
+	if info.VideoCodec == "" {
+		return nil, fmt.Errorf("no video stream found")
+	}
+
+	if seconds, err := strconv.ParseFloat(res.Format.Duration, 64); err == nil && seconds > 0 {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	// 容器未记录总码率时使用视频流的码率
+	for _, bitrate := range []string{res.Format.BitRate, videoBitrate} {
+		if value, err := strconv.ParseInt(bitrate, 10, 64); err == nil && value > 0 {
+			info.Bitrate = value
+			break
+		}
+	}
+
+	return info, nil
+}
+
+// ToMP4 使用 ffmpeg 将 input 转码为 H.264/AAC 编码、可边下边播的 MP4 文件 output，
+// 转码过程中以 0-100 的百分比回调 progress，duration 为 0 时不报告进度
+func ToMP4(ctx context.Context, ffmpeg, input, output string, duration time.Duration, progress func(percent int)) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg,
+		"-y",
+		"-v", "error",
+		"-i", input,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		"-progress", "pipe:1", "-nostats",
+		output,
+	)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	readProgress(stdout, duration, progress)
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// readProgress 读取 ffmpeg -progress 的输出，按已处理时长换算为百分比
+func readProgress(r io.Reader, duration time.Duration, progress func(percent int)) {
+	scanner := bufio.NewScanner(r)
+	last := -1
+	for scanner.Scan() {
+		if duration <= 0 || progress == nil {
+			continue
+		}
+
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "out_time_us" {
+			continue
+		}
+
+		processed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || processed < 0 {
+			continue
+		}
+
+		percent := int(time.Duration(processed) * time.Microsecond * 100 / duration)
+		if percent > 100 {
+			percent = 100
+		}
+		if percent != last {
+			last = percent
+			progress(percent)
+		}
+	}
+}
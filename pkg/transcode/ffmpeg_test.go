@@ -0,0 +1,109 @@
+package transcode
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProbe(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 正常
+	{
+		info, err := parseProbe([]byte(`{
+			"streams": [
+				{"codec_type": "video", "codec_name": "hevc", "width": 1920, "height": 1080},
+				{"codec_type": "audio", "codec_name": "ac3"},
+				{"codec_type": "audio", "codec_name": "aac"}
+			],
+			"format": {"duration": "90.500000", "bit_rate": "4000000"}
+		}`))
+		asserts.NoError(err)
+		asserts.Equal("hevc", info.VideoCodec)
+		asserts.Equal("ac3", info.AudioCodec)
+		asserts.Equal(90500*time.Millisecond, info.Duration)
+		asserts.Equal(1920, info.Width)
+		asserts.Equal(1080, info.Height)
+		asserts.EqualValues(4000000, info.Bitrate)
+	}
+
+	// 容器未记录码率
+	{
+		info, err := parseProbe([]byte(`{
+			"streams": [{"codec_type": "video", "codec_name": "h264", "bit_rate": "1500000"}],
+			"format": {"duration": "N/A", "bit_rate": "N/A"}
+		}`))
+		asserts.NoError(err)
+		asserts.EqualValues(1500000, info.Bitrate)
+		asserts.Zero(info.Duration)
+	}
+
+	// 无视频流
+	{
+		_, err := parseProbe([]byte(`{"streams": [{"codec_type": "audio", "codec_name": "mp3"}]}`))
+		asserts.Error(err)
+	}
+
+	// 无法解析
+	{
+		_, err := parseProbe([]byte(`not json`))
+		asserts.Error(err)
+	}
+}
+
+func TestMediaInfo_WebFriendly(t *testing.T) {
+	asserts := assert.New(t)
+
+	asserts.True((&MediaInfo{VideoCodec: "h264", AudioCodec: "aac"}).WebFriendly(".mp4"))
+	asserts.True((&MediaInfo{VideoCodec: "h264"}).WebFriendly("M4V"))
+	asserts.False((&MediaInfo{VideoCodec: "h264", AudioCodec: "aac"}).WebFriendly(".mkv"))
+	asserts.False((&MediaInfo{VideoCodec: "hevc", AudioCodec: "aac"}).WebFriendly(".mp4"))
+	asserts.False((&MediaInfo{VideoCodec: "h264", AudioCodec: "ac3"}).WebFriendly(".mp4"))
+}
+
+func TestReadProgress(t *testing.T) {
+	asserts := assert.New(t)
+	output := strings.Join([]string{
+		"frame=1",
+		"out_time_us=1000000",
+		"out_time_us=1000000",
+		"out_time_us=N/A",
+		"out_time_us=5000000",
+		"out_time_us=12000000",
+		"progress=end",
+	}, "\n")
+
+	// 按时长换算百分比，相同进度不重复报告
+	{
+		var res []int
+		readProgress(strings.NewReader(output), 10*time.Second, func(percent int) {
+			res = append(res, percent)
+		})
+		asserts.Equal([]int{10, 50, 100}, res)
+	}
+
+	// 时长未知
+	{
+		called := false
+		readProgress(strings.NewReader(output), 0, func(percent int) {
+			called = true
+		})
+		asserts.False(called)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	asserts := assert.New(t)
+
+	// 找不到 ffprobe
+	_, err := Probe(context.Background(), "/nonexistent/ffprobe", "input.mkv")
+	asserts.Error(err)
+
+	// 找不到 ffmpeg
+	err = ToMP4(context.Background(), "/nonexistent/ffmpeg", "input.mkv", "output.mp4", 0, nil)
+	asserts.Error(err)
+}
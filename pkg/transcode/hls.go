@@ -0,0 +1,160 @@
+package transcode
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HLSPlaylistName 预生成时 ffmpeg 输出的播放列表文件名
+	HLSPlaylistName = "index.m3u8"
+	// hlsSegmentPattern 预生成时 ffmpeg 输出的分段文件名格式
+	hlsSegmentPattern = "%d.ts"
+)
+
+// hlsEncodeArgs 将视频编码为 H.264/AAC，并按分段时长插入关键帧使各分段可独立解码
+func hlsEncodeArgs(segment time.Duration) []string {
+	return []string{
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%g)", segment.Seconds()),
+		"-c:a", "aac",
+	}
+}
+
+// ToHLS 使用 ffmpeg 将 input 切分为时长约为 segment 的 MPEG-TS 分段，与播放列表一同写入 outputDir
+func ToHLS(ctx context.Context, ffmpeg, input, outputDir string, segment time.Duration) error {
+	args := []string{"-y", "-v", "error", "-i", input}
+	args = append(args, hlsEncodeArgs(segment)...)
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.FormatFloat(segment.Seconds(), 'f', -1, 64),
+		"-hls_list_size", "0",
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(outputDir, hlsSegmentPattern),
+		filepath.Join(outputDir, HLSPlaylistName),
+	)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// segmentReader 读取 ffmpeg 的输出，关闭时结束进程
+type segmentReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+}
+
+// Close 结束 ffmpeg 进程并等待其退出
+func (r *segmentReader) Close() error {
+	r.cancel()
+	err := r.ReadCloser.Close()
+	_ = r.cmd.Wait()
+	return err
+}
+
+// Segment 使用 ffmpeg 从 input 的 start 处截取时长为 duration 的片段，实时编码为 MPEG-TS 分段。
+// input 可为本机路径或 HTTP 地址，ffmpeg 通过范围请求只读取所需部分。
+// 分段的时间戳从 start 开始，使连续的分段可在同一播放列表中衔接
+func Segment(ctx context.Context, ffmpeg, input string, start, duration time.Duration) (io.ReadCloser, error) {
+	args := []string{
+		"-v", "error",
+		"-ss", strconv.FormatFloat(start.Seconds(), 'f', -1, 64),
+		"-t", strconv.FormatFloat(duration.Seconds(), 'f', -1, 64),
+		"-i", input,
+	}
+	args = append(args, hlsEncodeArgs(duration)...)
+	args = append(args,
+		"-output_ts_offset", strconv.FormatFloat(start.Seconds(), 'f', -1, 64),
+		"-f", "mpegts",
+		"pipe:1",
+	)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, ffmpeg, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	return &segmentReader{ReadCloser: stdout, cmd: cmd, cancel: cancel}, nil
+}
+
+// SegmentNum 返回时长为 total 的视频按 segment 切分后的分段数量
+func SegmentNum(total, segment time.Duration) int {
+	if total <= 0 || segment <= 0 {
+		return 0
+	}
+
+	return int((total + segment - 1) / segment)
+}
+
+// Playlist 生成按 segment 等长切分、时长为 total 的点播播放列表，第 i 个分段的地址为 uri(i)
+func Playlist(total, segment time.Duration, uri func(i int) string) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	b.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", int((segment+time.Second-1)/time.Second)))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+
+	for i := 0; i < SegmentNum(total, segment); i++ {
+		length := segment
+		if rest := total - time.Duration(i)*segment; rest < segment {
+			length = rest
+		}
+		b.WriteString(fmt.Sprintf("#EXTINF:%.6f,\n%s\n", length.Seconds(), uri(i)))
+	}
+
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// PlaylistSegments 返回播放列表中的分段地址
+func PlaylistSegments(playlist string) []string {
+	var segments []string
+	scanner := bufio.NewScanner(strings.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			segments = append(segments, line)
+		}
+	}
+
+	return segments
+}
+
+// RewritePlaylist 将播放列表中的分段地址替换为 uri 的返回值
+func RewritePlaylist(playlist string, uri func(segment string) string) string {
+	var b strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			line = uri(line)
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
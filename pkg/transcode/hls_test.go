@@ -0,0 +1,42 @@
+package transcode
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentNum(t *testing.T) {
+	asserts := assert.New(t)
+
+	asserts.Equal(0, SegmentNum(0, 6*time.Second))
+	asserts.Equal(1, SegmentNum(5*time.Second, 6*time.Second))
+	asserts.Equal(1, SegmentNum(6*time.Second, 6*time.Second))
+	asserts.Equal(2, SegmentNum(6500*time.Millisecond, 6*time.Second))
+}
+
+func TestPlaylist(t *testing.T) {
+	asserts := assert.New(t)
+
+	playlist := Playlist(13500*time.Millisecond, 6*time.Second, func(i int) string {
+		return strconv.Itoa(i) + ".ts"
+	})
+	asserts.True(strings.HasPrefix(playlist, "#EXTM3U\n"))
+	asserts.Contains(playlist, "#EXT-X-TARGETDURATION:6\n")
+	asserts.Contains(playlist, "#EXTINF:6.000000,\n0.ts\n#EXTINF:6.000000,\n1.ts\n#EXTINF:1.500000,\n2.ts\n")
+	asserts.True(strings.HasSuffix(playlist, "#EXT-X-ENDLIST\n"))
+	asserts.Equal([]string{"0.ts", "1.ts", "2.ts"}, PlaylistSegments(playlist))
+}
+
+func TestRewritePlaylist(t *testing.T) {
+	asserts := assert.New(t)
+
+	playlist := "#EXTM3U\n#EXTINF:4.0,\n0.ts\n\n#EXTINF:2.5,\n1.ts\n#EXT-X-ENDLIST"
+	res := RewritePlaylist(playlist, func(segment string) string {
+		return segment + "?unlock=token"
+	})
+	asserts.Equal("#EXTM3U\n#EXTINF:4.0,\n0.ts?unlock=token\n\n#EXTINF:2.5,\n1.ts?unlock=token\n#EXT-X-ENDLIST\n", res)
+}
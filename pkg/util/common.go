@@ -2,6 +2,7 @@ package util
 
 import (
 	"math/rand"
+	"net"
 	"regexp"
 	"strings"
 	"time"
@@ -106,3 +107,23 @@ func SliceDifference(slice1, slice2 []string) []string {
 	}
 	return nn
 }
+
+// IsSameSubnet 返回两个 IP 地址是否位于同一子网，v4Prefix 和 v6Prefix
+// 分别为 IPv4 和 IPv6 地址比较时使用的前缀长度
+func IsSameSubnet(a, b string, v4Prefix, v6Prefix int) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return false
+	}
+
+	if v4A, v4B := ipA.To4(), ipB.To4(); v4A != nil || v4B != nil {
+		if v4A == nil || v4B == nil {
+			return false
+		}
+		mask := net.CIDRMask(v4Prefix, 32)
+		return v4A.Mask(mask).Equal(v4B.Mask(mask))
+	}
+
+	mask := net.CIDRMask(v6Prefix, 128)
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
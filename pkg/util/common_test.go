@@ -96,3 +96,15 @@ func TestSliceDifference(t *testing.T) {
 		asserts.Equal([]string{"1", "2", "3", "4"}, SliceDifference(s1, s2))
 	}
 }
+
+func TestIsSameSubnet(t *testing.T) {
+	asserts := assert.New(t)
+	asserts.True(IsSameSubnet("1.2.3.4", "1.2.3.4", 32, 128))
+	asserts.False(IsSameSubnet("1.2.3.4", "1.2.3.5", 32, 128))
+	asserts.True(IsSameSubnet("1.2.3.4", "1.2.3.200", 24, 128))
+	asserts.False(IsSameSubnet("1.2.3.4", "1.2.4.4", 24, 128))
+	asserts.True(IsSameSubnet("2001:db8::1", "2001:db8::ffff", 32, 64))
+	asserts.False(IsSameSubnet("2001:db8::1", "2001:db9::1", 32, 64))
+	asserts.False(IsSameSubnet("1.2.3.4", "2001:db8::1", 0, 0))
+	asserts.False(IsSameSubnet("", "1.2.3.4", 24, 64))
+}
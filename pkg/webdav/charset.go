@@ -0,0 +1,125 @@
+package webdav
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// NameCodec 在客户端使用的文件名编码与 UTF-8 之间转换路径
+type NameCodec interface {
+	// Decode 将客户端发送的路径转换为 UTF-8
+	Decode(name string) string
+	// Encode 将 UTF-8 路径转换为客户端使用的编码
+	Encode(name string) string
+}
+
+type nameCodecKey struct{}
+
+var (
+	charsetMu sync.RWMutex
+	charsets  = map[string]encoding.Encoding{}
+)
+
+// RegisterCharset 注册名为 name 的字符集，可覆盖内置的同名字符集
+func RegisterCharset(name string, enc encoding.Encoding) {
+	charsetMu.Lock()
+	defer charsetMu.Unlock()
+	charsets[strings.ToLower(name)] = enc
+}
+
+// lookupCharset 查找字符集，优先使用已注册的字符集，其次使用 WHATWG 编码名称
+func lookupCharset(name string) (encoding.Encoding, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	charsetMu.RLock()
+	enc, ok := charsets[name]
+	charsetMu.RUnlock()
+	if ok {
+		return enc, true
+	}
+
+	enc, err := htmlindex.Get(name)
+	return enc, err == nil
+}
+
+// IsSupportedCharset 返回是否支持字符集 name
+func IsSupportedCharset(name string) bool {
+	_, ok := lookupCharset(name)
+	return ok
+}
+
+// charsetCodec 基于字符集的文件名转换，仅转换不是合法 UTF-8 的路径
+type charsetCodec struct {
+	enc         encoding.Encoding
+	encodeNames bool
+}
+
+func (c *charsetCodec) Decode(name string) string {
+	if utf8.ValidString(name) {
+		return name
+	}
+
+	decoded, err := c.enc.NewDecoder().String(name)
+	if err != nil || !utf8.ValidString(decoded) {
+		return name
+	}
+	return decoded
+}
+
+func (c *charsetCodec) Encode(name string) string {
+	if !c.encodeNames {
+		return name
+	}
+
+	encoded, err := c.enc.NewEncoder().String(name)
+	if err != nil {
+		return name
+	}
+	return encoded
+}
+
+// NewCharsetCodec 创建字符集 charset 的文件名转换器，encodeNames 为真时响应中的路径
+// 也转换为该字符集。charset 为空或不受支持时返回 nil
+func NewCharsetCodec(charset string, encodeNames bool) NameCodec {
+	if charset == "" {
+		return nil
+	}
+
+	enc, ok := lookupCharset(charset)
+	if !ok {
+		return nil
+	}
+
+	return &charsetCodec{enc: enc, encodeNames: encodeNames}
+}
+
+// WithNameCodec 返回携带文件名转换器的上下文
+func WithNameCodec(ctx context.Context, codec NameCodec) context.Context {
+	return context.WithValue(ctx, nameCodecKey{}, codec)
+}
+
+// nameCodecFromContext 返回上下文中的文件名转换器，未设定时返回 nil
+func nameCodecFromContext(ctx context.Context) NameCodec {
+	codec, _ := ctx.Value(nameCodecKey{}).(NameCodec)
+	return codec
+}
+
+// decodeName 使用上下文中的转换器将客户端路径转换为 UTF-8
+func decodeName(ctx context.Context, name string) string {
+	if codec := nameCodecFromContext(ctx); codec != nil {
+		return codec.Decode(name)
+	}
+	return name
+}
+
+// encodeName 使用上下文中的转换器将路径转换为客户端使用的编码
+func encodeName(ctx context.Context, name string) string {
+	if codec := nameCodecFromContext(ctx); codec != nil {
+		return codec.Encode(name)
+	}
+	return name
+}
@@ -0,0 +1,149 @@
+package webdav
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+)
+
+// deadPropKeyPrefix 死属性在文件元数据中的键前缀，其后为 Clark 记法的属性名 {namespace}local
+const deadPropKeyPrefix = "webdav_prop:"
+
+// deadPropValue 死属性在文件元数据中的存储结构
+type deadPropValue struct {
+	Lang     string `json:"lang,omitempty"`
+	InnerXML string `json:"xml"`
+}
+
+func deadPropKey(name xml.Name) string {
+	return deadPropKeyPrefix + "{" + name.Space + "}" + name.Local
+}
+
+func parseDeadPropKey(key string) (xml.Name, bool) {
+	if !strings.HasPrefix(key, deadPropKeyPrefix+"{") {
+		return xml.Name{}, false
+	}
+
+	clark := strings.TrimPrefix(key, deadPropKeyPrefix+"{")
+	end := strings.Index(clark, "}")
+	if end < 0 || end == len(clark)-1 {
+		return xml.Name{}, false
+	}
+
+	return xml.Name{Space: clark[:end], Local: clark[end+1:]}, true
+}
+
+// deadPropsMetadata 返回文件或目录的元数据，其他对象不支持死属性
+func deadPropsMetadata(fi FileInfo) (map[string]string, bool) {
+	switch obj := fi.(type) {
+	case *model.File:
+		return obj.MetadataSerialized, true
+	case *model.Folder:
+		return obj.MetadataSerialized, true
+	default:
+		return nil, false
+	}
+}
+
+// updateDeadPropsMetadata 保存文件或目录的元数据
+func updateDeadPropsMetadata(fi FileInfo, meta map[string]string) error {
+	switch obj := fi.(type) {
+	case *model.File:
+		return obj.UpdateMetadata(meta)
+	case *model.Folder:
+		return obj.UpdateMetadata(meta)
+	default:
+		return ErrNotImplemented
+	}
+}
+
+// loadDeadProps 从文件或目录的元数据中读取死属性
+func loadDeadProps(fi FileInfo) map[xml.Name]Property {
+	metadata, ok := deadPropsMetadata(fi)
+	if !ok {
+		return nil
+	}
+
+	res := make(map[xml.Name]Property)
+	for key, raw := range metadata {
+		name, ok := parseDeadPropKey(key)
+		if !ok {
+			continue
+		}
+
+		var value deadPropValue
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			continue
+		}
+
+		res[name] = Property{
+			XMLName:  name,
+			Lang:     value.Lang,
+			InnerXML: []byte(value.InnerXML),
+		}
+	}
+
+	return res
+}
+
+// deadPropsSize 返回元数据中所有死属性占用的字节数
+func deadPropsSize(meta map[string]string) int {
+	size := 0
+	for key, value := range meta {
+		if strings.HasPrefix(key, deadPropKeyPrefix) {
+			size += len(key) + len(value)
+		}
+	}
+	return size
+}
+
+// patchDeadProps 将死属性的修改原子地写入文件或目录的元数据，总大小超出
+// webdav_dead_props_max_size 时全部修改失败并返回 507
+func patchDeadProps(fi FileInfo, patches []Proppatch) ([]Propstat, error) {
+	metadata, _ := deadPropsMetadata(fi)
+	meta := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		meta[key] = value
+	}
+
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			key := deadPropKey(p.XMLName)
+			if patch.Remove {
+				delete(meta, key)
+				continue
+			}
+
+			value, err := json.Marshal(deadPropValue{Lang: p.Lang, InnerXML: string(p.InnerXML)})
+			if err != nil {
+				return nil, err
+			}
+			meta[key] = string(value)
+		}
+	}
+
+	if deadPropsSize(meta) > model.GetIntSetting("webdav_dead_props_max_size", 65536) {
+		pstat := Propstat{Status: http.StatusInsufficientStorage}
+		for _, patch := range patches {
+			for _, p := range patch.Props {
+				pstat.Props = append(pstat.Props, Property{XMLName: p.XMLName})
+			}
+		}
+		return []Propstat{pstat}, nil
+	}
+
+	if err := updateDeadPropsMetadata(fi, meta); err != nil {
+		return nil, err
+	}
+
+	pstat := Propstat{Status: http.StatusOK}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, Property{XMLName: p.XMLName})
+		}
+	}
+	return []Propstat{pstat}, nil
+}
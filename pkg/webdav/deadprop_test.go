@@ -0,0 +1,77 @@
+package webdav
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+var mock sqlmock.Sqlmock
+
+// TestMain 初始化数据库Mock
+func TestMain(m *testing.M) {
+	var db *sql.DB
+	var err error
+	db, mock, err = sqlmock.New()
+	if err != nil {
+		panic("An error was not expected when opening a stub database connection")
+	}
+	model.DB, _ = gorm.Open("mysql", db)
+	defer db.Close()
+	m.Run()
+}
+
+func TestPatch_Folder(t *testing.T) {
+	asserts := assert.New(t)
+	fs := &filesystem.FileSystem{User: &model.User{}}
+	folder := &model.Folder{Model: gorm.Model{ID: 1}, Name: "dir"}
+	name := xml.Name{Space: "urn:schemas-microsoft-com:", Local: "Win32FileAttributes"}
+	cache.Set("setting_webdav_dead_props_max_size", "65536", 0)
+
+	// 设定死属性
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)folders(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	pstats, err := patch(context.Background(), fs, nil, folder, []Proppatch{{
+		Props: []Property{{XMLName: name, InnerXML: []byte("00000010")}},
+	}})
+	asserts.NoError(err)
+	asserts.NoError(mock.ExpectationsWereMet())
+	asserts.Len(pstats, 1)
+	asserts.Equal(http.StatusOK, pstats[0].Status)
+
+	// 之后可读取到已设定的死属性
+	pstats, err = props(context.Background(), fs, nil, folder, []xml.Name{name})
+	asserts.NoError(err)
+	asserts.Len(pstats, 1)
+	asserts.Equal(http.StatusOK, pstats[0].Status)
+	asserts.Equal("00000010", string(pstats[0].Props[0].InnerXML))
+
+	// 重新从数据库读取目录后仍然存在
+	reloaded := &model.Folder{Metadata: folder.Metadata}
+	asserts.NoError(reloaded.AfterFind())
+	asserts.Contains(loadDeadProps(reloaded), name)
+
+	// 删除死属性
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE(.+)folders(.+)metadata(.+)").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	_, err = patch(context.Background(), fs, nil, folder, []Proppatch{{
+		Remove: true,
+		Props:  []Property{{XMLName: name}},
+	}})
+	asserts.NoError(err)
+	asserts.NoError(mock.ExpectationsWereMet())
+	pstats, err = props(context.Background(), fs, nil, folder, []xml.Name{name})
+	asserts.NoError(err)
+	asserts.Equal(http.StatusNotFound, pstats[0].Status)
+}
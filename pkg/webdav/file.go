@@ -99,13 +99,17 @@ func copyFiles(ctx context.Context, fs *filesystem.FileSystem, src FileInfo, dst
 // Allowed values for depth are 0, 1 or infiniteDepth. For each visited node,
 // walkFS calls walkFn. If a visited file system node is a directory and
 // walkFn returns filepath.SkipDir, walkFS will skip traversal of this node.
+// At most limit children of each directory are visited, 0 means no limit;
+// truncFn is called after the children of a directory with more entries.
 func walkFS(
 	ctx context.Context,
 	fs *filesystem.FileSystem,
 	depth int,
 	name string,
 	info FileInfo,
-	walkFn func(reqPath string, info FileInfo, err error) error) error {
+	limit int,
+	walkFn func(reqPath string, info FileInfo, err error) error,
+	truncFn func(reqPath string, folder *model.Folder, listed int) error) error {
 	// This implementation is based on Walk's code in the standard path/filepath package.
 	err := walkFn(name, info, nil)
 	if err != nil {
@@ -121,12 +125,15 @@ func walkFS(
 		depth = 0
 	}
 
-	dirs, _ := info.(*model.Folder).GetChildFolder()
-	files, _ := info.(*model.Folder).GetChildFiles()
+	folder := info.(*model.Folder)
+	files, dirs, truncated, err := folder.GetChildrenWithLimit(limit)
+	if err != nil {
+		return err
+	}
 
 	for _, fileInfo := range files {
 		filename := path.Join(name, fileInfo.Name)
-		err = walkFS(ctx, fs, depth, filename, &fileInfo, walkFn)
+		err = walkFS(ctx, fs, depth, filename, &fileInfo, limit, walkFn, truncFn)
 		if err != nil {
 			if !fileInfo.IsDir() || err != filepath.SkipDir {
 				return err
@@ -136,12 +143,16 @@ func walkFS(
 
 	for _, fileInfo := range dirs {
 		filename := path.Join(name, fileInfo.Name)
-		err = walkFS(ctx, fs, depth, filename, &fileInfo, walkFn)
+		err = walkFS(ctx, fs, depth, filename, &fileInfo, limit, walkFn, truncFn)
 		if err != nil {
 			if !fileInfo.IsDir() || err != filepath.SkipDir {
 				return err
 			}
 		}
 	}
+
+	if truncated {
+		return truncFn(name, folder, len(files)+len(dirs))
+	}
 	return nil
 }
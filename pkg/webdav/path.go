@@ -0,0 +1,80 @@
+package webdav
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+)
+
+// resource 请求路径解析得到的资源
+type resource struct {
+	// Path 去除前缀并规范化后的路径，不以斜杠结尾
+	Path string
+	// Collection 请求路径以斜杠结尾，明确指向集合
+	Collection bool
+	// Info 路径上已存在的目录或文件，不存在时为 nil
+	Info FileInfo
+}
+
+// splitResourcePath 去除请求路径的前缀并规范化，返回资源路径及请求路径是否指向集合。
+// 依照 RFC 4918 第 5.2 节，以斜杠结尾的路径指向集合，根路径总是集合；不以斜杠结尾的
+// 路径可同时指向集合或非集合资源
+func splitResourcePath(prefix, urlPath string) (string, bool, error) {
+	rest := urlPath
+	if prefix != "" {
+		if rest = strings.TrimPrefix(urlPath, prefix); len(rest) == len(urlPath) {
+			return urlPath, false, errPrefixMismatch
+		}
+	}
+
+	reqPath := path.Clean("/" + rest)
+	return reqPath, reqPath == "/" || strings.HasSuffix(rest, "/"), nil
+}
+
+// resolve 解析请求路径对应的资源。优先匹配目录，请求路径以斜杠结尾时不匹配文件
+func (h *Handler) resolve(ctx context.Context, fs *filesystem.FileSystem, urlPath string) (*resource, int, error) {
+	reqPath, collection, err := splitResourcePath(h.Prefix, urlPath)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+
+	res := &resource{Path: reqPath, Collection: collection}
+	if ok, folder := fs.IsPathExist(reqPath); ok {
+		res.Info = folder
+	} else if !collection {
+		if ok, file := fs.IsFileExist(reqPath); ok {
+			res.Info = file
+		}
+	}
+
+	return res, 0, nil
+}
+
+// File 返回资源对应的文件，资源不存在或为目录时返回 nil
+func (res *resource) File() *model.File {
+	file, _ := res.Info.(*model.File)
+	return file
+}
+
+// IsDir 返回资源是否为已存在的目录
+func (res *resource) IsDir() bool {
+	return res.Info != nil && res.Info.IsDir()
+}
+
+// checkParent 按设定检查新建资源的上级目录是否存在。未开启自动创建上级目录时，
+// 依照 RFC 4918 第 9.3.1、9.7.1 节，上级目录不存在时返回 409
+func checkParent(fs *filesystem.FileSystem, reqPath string) (int, error) {
+	if model.IsTrueVal(model.GetSettingByNameWithDefault("webdav_auto_create_parent", "1")) {
+		return 0, nil
+	}
+
+	if ok, _ := fs.IsPathExist(path.Dir(reqPath)); !ok {
+		return http.StatusConflict, errParentNotExist
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,40 @@
+package webdav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitResourcePath(t *testing.T) {
+	asserts := assert.New(t)
+	testCases := []struct {
+		prefix     string
+		urlPath    string
+		path       string
+		collection bool
+	}{
+		// 根路径总是集合
+		{"/dav", "/dav", "/", true},
+		{"/dav", "/dav/", "/", true},
+		{"", "/", "/", true},
+		// Finder、rclone 以斜杠结尾请求集合
+		{"/dav", "/dav/docs/", "/docs", true},
+		{"/dav", "/dav/docs", "/docs", false},
+		// Windows 资源管理器可能发送重复斜杠
+		{"/dav", "/dav//docs//a.txt", "/docs/a.txt", false},
+		{"/dav", "/dav/docs/./sub/../", "/docs", true},
+		{"", "/docs/a.txt", "/docs/a.txt", false},
+	}
+
+	for _, testCase := range testCases {
+		reqPath, collection, err := splitResourcePath(testCase.prefix, testCase.urlPath)
+		asserts.NoError(err, testCase.urlPath)
+		asserts.Equal(testCase.path, reqPath, testCase.urlPath)
+		asserts.Equal(testCase.collection, collection, testCase.urlPath)
+	}
+
+	// 前缀不匹配
+	_, _, err := splitResourcePath("/dav", "/api/v3")
+	asserts.Equal(errPrefixMismatch, err)
+}
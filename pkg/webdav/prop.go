@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"time"
 
+	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
 )
 
@@ -153,10 +154,10 @@ var liveProps = map[xml.Name]struct {
 	},
 	{Space: "DAV:", Local: "getetag"}: {
 		findFn: findETag,
-		// findETag implements ETag as the concatenated hex values of a file's
-		// modification time and size. This is not a reliable synchronization
-		// mechanism for directories, so we do not advertise getetag for DAV
-		// collections.
+		// findETag implements ETag with filesystem.FileETag, so it follows the
+		// etag_strategy setting and matches the ETag sent by downloads. This is
+		// not a reliable synchronization mechanism for directories, so we do not
+		// advertise getetag for DAV collections.
 		dir: false,
 	},
 
@@ -178,7 +179,7 @@ var liveProps = map[xml.Name]struct {
 func props(ctx context.Context, fs *filesystem.FileSystem, ls LockSystem, fi FileInfo, pnames []xml.Name) ([]Propstat, error) {
 	isDir := fi.IsDir()
 
-	var deadProps map[xml.Name]Property
+	deadProps := loadDeadProps(fi)
 
 	pstatOK := Propstat{Status: http.StatusOK}
 	pstatNotFound := Propstat{Status: http.StatusNotFound}
@@ -211,7 +212,7 @@ func props(ctx context.Context, fs *filesystem.FileSystem, ls LockSystem, fi Fil
 func propnames(ctx context.Context, fs *filesystem.FileSystem, ls LockSystem, fi FileInfo) ([]xml.Name, error) {
 	isDir := fi.IsDir()
 
-	var deadProps map[xml.Name]Property
+	deadProps := loadDeadProps(fi)
 
 	pnames := make([]xml.Name, 0, len(liveProps)+len(deadProps))
 	for pn, prop := range liveProps {
@@ -219,6 +220,9 @@ func propnames(ctx context.Context, fs *filesystem.FileSystem, ls LockSystem, fi
 			pnames = append(pnames, pn)
 		}
 	}
+	for pn := range deadProps {
+		pnames = append(pnames, pn)
+	}
 	return pnames, nil
 }
 
@@ -250,7 +254,7 @@ func allprop(ctx context.Context, fs *filesystem.FileSystem, ls LockSystem, info
 
 // Patch patches the properties of resource name. The return values are
 // constrained in the same manner as DeadPropsHolder.Patch.
-func patch(ctx context.Context, fs *filesystem.FileSystem, ls LockSystem, name string, patches []Proppatch) ([]Propstat, error) {
+func patch(ctx context.Context, fs *filesystem.FileSystem, ls LockSystem, fi FileInfo, patches []Proppatch) ([]Propstat, error) {
 	conflict := false
 loop:
 	for _, patch := range patches {
@@ -281,9 +285,13 @@ loop:
 		return makePropstats(pstatForbidden, pstatFailedDep), nil
 	}
 
-	// The file doesn't implement the optional DeadPropsHolder interface, so
-	// all patches are forbidden.
-	pstat := Propstat{Status: http.StatusOK}
+	// 文件和目录的死属性持久化到各自的元数据中
+	if _, ok := deadPropsMetadata(fi); ok {
+		return patchDeadProps(fi, patches)
+	}
+
+	// 无法保存死属性的对象拒绝修改
+	pstat := Propstat{Status: http.StatusForbidden}
 	for _, patch := range patches {
 		for _, p := range patch.Props {
 			pstat.Props = append(pstat.Props, Property{XMLName: p.XMLName})
@@ -324,7 +332,11 @@ func findDisplayName(ctx context.Context, fs *filesystem.FileSystem, ls LockSyst
 		// Hide the real name of a possibly prefixed root directory.
 		return "", nil
 	}
-	return escapeXML(fi.GetName()), nil
+	displayName := fi.GetName()
+	if filesystem.ReservedNameStrategy() == filesystem.ReservedNameRename {
+		displayName = filesystem.EscapeReservedName(displayName)
+	}
+	return escapeXML(displayName), nil
 }
 
 func findContentLength(ctx context.Context, fs *filesystem.FileSystem, ls LockSystem, name string, fi FileInfo) (string, error) {
@@ -405,6 +417,9 @@ type ETager interface {
 }
 
 func findETag(ctx context.Context, fs *filesystem.FileSystem, ls LockSystem, reqPath string, fi FileInfo) (string, error) {
+	if file, ok := fi.(*model.File); ok {
+		return filesystem.FileETag(file), nil
+	}
 	return fmt.Sprintf(`"%x%x"`, fi.ModTime().UnixNano(), fi.GetSize()), nil
 }
 
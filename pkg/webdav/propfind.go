@@ -0,0 +1,55 @@
+package webdav
+
+import (
+	"fmt"
+	"net/url"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+)
+
+// PROPFIND 列出的目录项目数超过 webdav_propfind_max_entries 时的处理方式。
+//
+// 截断时，在 207 响应末尾追加一条指向该目录、状态为 507 并带有
+// DAV:number-of-matches-within-limits 错误的 response（RFC 4918 11.5 节、RFC 5323 5.2 节）。
+// Windows 资源管理器、macOS Finder、rclone、WinSCP 及 Cyberduck 均会忽略这一条目，
+// 正常显示已列出的项目；davfs2 及部分同步客户端会将其视为错误并中止同步，
+// 需要完整列表的场景应调大上限，或改用 reject 使客户端明确得知失败。
+// 拒绝时，整个请求以 507 响应，不返回任何项目；仅在请求的目录本身超限时生效，
+// Depth 为 infinity 时更深层的超限目录仍按截断处理。
+const (
+	PropfindOverflowTruncate = "truncate"
+	PropfindOverflowReject   = "reject"
+)
+
+// propfindMaxEntries 返回 PROPFIND 单个目录至多列出的项目数，0 表示不限制
+func propfindMaxEntries() int {
+	limit := model.GetIntSetting("webdav_propfind_max_entries", 10000)
+	if limit < 0 {
+		return 0
+	}
+
+	return limit
+}
+
+// propfindOverflow 返回目录项目数超限时的处理方式
+func propfindOverflow() string {
+	if model.GetSettingByName("webdav_propfind_overflow") == PropfindOverflowReject {
+		return PropfindOverflowReject
+	}
+
+	return PropfindOverflowTruncate
+}
+
+// makeTruncatedResponse 返回标记目录列表已被截断的 response
+func makeTruncatedResponse(href string, listed, total int) *response {
+	return &response{
+		Href:   []string{(&url.URL{Path: href}).EscapedPath()},
+		Status: fmt.Sprintf("HTTP/1.1 %d %s", StatusInsufficientStorage, StatusText(StatusInsufficientStorage)),
+		Error:  &xmlError{InnerXML: []byte("<D:number-of-matches-within-limits/>")},
+		ResponseDescription: fmt.Sprintf(
+			"Listing truncated: %d of %d entries returned, the rest are omitted",
+			listed,
+			total,
+		),
+	}
+}
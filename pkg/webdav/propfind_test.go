@@ -0,0 +1,40 @@
+package webdav
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropfindLimitSettings(t *testing.T) {
+	asserts := assert.New(t)
+	defer cache.Deletes([]string{"webdav_propfind_max_entries", "webdav_propfind_overflow"}, "setting_")
+
+	cache.Set("setting_webdav_propfind_max_entries", "100", 0)
+	cache.Set("setting_webdav_propfind_overflow", "reject", 0)
+	asserts.Equal(100, propfindMaxEntries())
+	asserts.Equal(PropfindOverflowReject, propfindOverflow())
+
+	// 无效值
+	cache.Set("setting_webdav_propfind_max_entries", "-1", 0)
+	cache.Set("setting_webdav_propfind_overflow", "unknown", 0)
+	asserts.Equal(0, propfindMaxEntries())
+	asserts.Equal(PropfindOverflowTruncate, propfindOverflow())
+}
+
+func TestMakeTruncatedResponse(t *testing.T) {
+	asserts := assert.New(t)
+	w := httptest.NewRecorder()
+	mw := multistatusWriter{w: w}
+	asserts.NoError(mw.write(makeTruncatedResponse("/dav/big dir/", 10, 25)))
+	asserts.NoError(mw.close())
+
+	body := w.Body.String()
+	asserts.Equal(StatusMulti, w.Code)
+	asserts.Contains(body, "<D:href>/dav/big%20dir/</D:href>")
+	asserts.Contains(body, "<D:status>HTTP/1.1 507 Insufficient Storage</D:status>")
+	asserts.Contains(body, "<D:number-of-matches-within-limits/>")
+	asserts.Contains(body, "10 of 25 entries")
+}
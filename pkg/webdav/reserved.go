@@ -0,0 +1,74 @@
+package webdav
+
+import (
+	"strings"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+)
+
+// reservedNameCodec 以带前缀的名称向客户端呈现 Windows 保留设备名，使 Windows 客户端能够
+// 保存和访问此类文件，客户端以带前缀的名称请求时还原为原名称
+type reservedNameCodec struct{}
+
+func (reservedNameCodec) Decode(name string) string {
+	return mapPathNames(name, filesystem.UnescapeReservedName)
+}
+
+func (reservedNameCodec) Encode(name string) string {
+	return mapPathNames(name, filesystem.EscapeReservedName)
+}
+
+// mapPathNames 对路径中的各级名称分别进行转换
+func mapPathNames(name string, fn func(string) string) string {
+	parts := strings.Split(name, "/")
+	for i := range parts {
+		if parts[i] != "" {
+			parts[i] = fn(parts[i])
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// NewReservedNameCodec 保留设备名的处理方式为重命名时返回对应的文件名转换器，否则返回 nil
+func NewReservedNameCodec() NameCodec {
+	if filesystem.ReservedNameStrategy() != filesystem.ReservedNameRename {
+		return nil
+	}
+	return reservedNameCodec{}
+}
+
+// chainCodec 依次应用多个文件名转换器，转换为客户端路径时顺序相反
+type chainCodec []NameCodec
+
+func (c chainCodec) Decode(name string) string {
+	for _, codec := range c {
+		name = codec.Decode(name)
+	}
+	return name
+}
+
+func (c chainCodec) Encode(name string) string {
+	for i := len(c) - 1; i >= 0; i-- {
+		name = c[i].Encode(name)
+	}
+	return name
+}
+
+// ChainNameCodecs 组合多个文件名转换器，客户端路径依次经由各转换器转换，忽略其中的 nil。
+// 没有可用的转换器时返回 nil
+func ChainNameCodecs(codecs ...NameCodec) NameCodec {
+	chain := make(chainCodec, 0, len(codecs))
+	for _, codec := range codecs {
+		if codec != nil {
+			chain = append(chain, codec)
+		}
+	}
+
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	}
+	return chain
+}
@@ -0,0 +1,43 @@
+package webdav
+
+import (
+	"testing"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/cache"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservedNameCodec(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_reserved_names", "CON,NUL", 0)
+	cache.Set("setting_reserved_name_prefix", "_", 0)
+	defer cache.Deletes([]string{"reserved_names", "reserved_name_prefix", "reserved_name_strategy"}, "setting_")
+
+	cache.Set("setting_reserved_name_strategy", filesystem.ReservedNameReject, 0)
+	asserts.Nil(NewReservedNameCodec())
+
+	cache.Set("setting_reserved_name_strategy", filesystem.ReservedNameRename, 0)
+	codec := NewReservedNameCodec()
+	asserts.NotNil(codec)
+	asserts.Equal("/dav/_CON/_nul.txt", codec.Encode("/dav/CON/nul.txt"))
+	asserts.Equal("/dav/CON/nul.txt", codec.Decode("/dav/_CON/_nul.txt"))
+	asserts.Equal("/dav/__CON/", codec.Encode("/dav/_CON/"))
+	asserts.Equal("/dav/_CON/", codec.Decode("/dav/__CON/"))
+}
+
+func TestChainNameCodecs(t *testing.T) {
+	asserts := assert.New(t)
+	cache.Set("setting_reserved_names", "CON", 0)
+	cache.Set("setting_reserved_name_prefix", "_", 0)
+	defer cache.Deletes([]string{"reserved_names", "reserved_name_prefix"}, "setting_")
+
+	asserts.Nil(ChainNameCodecs(nil, nil))
+	asserts.Equal(reservedNameCodec{}, ChainNameCodecs(nil, reservedNameCodec{}))
+
+	// 先转换字符集，再还原保留设备名
+	charset := NewCharsetCodec("gbk", true)
+	codec := ChainNameCodecs(charset, reservedNameCodec{})
+	asserts.Equal("/中文/CON", codec.Decode(charset.Encode("/中文/_CON")))
+	asserts.Equal(charset.Encode("/中文/_CON"), codec.Encode("/中文/CON"))
+}
@@ -13,14 +13,13 @@ import (
 	"net/url"
 	"path"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
-	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/cloudreve/Cloudreve/v3/pkg/task"
 )
 
 type Handler struct {
@@ -35,17 +34,11 @@ type Handler struct {
 }
 
 func (h *Handler) stripPrefix(p string, uid uint) (string, int, error) {
-	if h.Prefix == "" {
-		return p, http.StatusOK, nil
-	}
-	prefix := h.Prefix
-	if r := strings.TrimPrefix(p, prefix); len(r) < len(p) {
-		if len(r) == 0 {
-			r = "/"
-		}
-		return util.RemoveSlash(r), http.StatusOK, nil
+	reqPath, _, err := splitResourcePath(h.Prefix, p)
+	if err != nil {
+		return p, http.StatusNotFound, err
 	}
-	return p, http.StatusNotFound, errPrefixMismatch
+	return reqPath, http.StatusOK, nil
 }
 
 // isPathExist 路径是否存在
@@ -75,6 +68,9 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, fs *filesyst
 		}
 		h.Mutex.Unlock()
 
+		// 将旧版客户端以其他编码发送的路径转换为 UTF-8
+		r.URL.Path = decodeName(r.Context(), r.URL.Path)
+
 		switch r.Method {
 		case "OPTIONS":
 			status, err = h.handleOptions(w, r, fs)
@@ -112,121 +108,115 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, fs *filesyst
 
 // OK
 func (h *Handler) lock(now time.Time, root string, fs *filesystem.FileSystem, ls LockSystem) (token string, status int, err error) {
-	//token, err = ls.Create(now, LockDetails{
-	//	Root:      root,
-	//	Duration:  infiniteTimeout,
-	//	ZeroDepth: true,
-	//})
-	//if err != nil {
-	//	if err == ErrLocked {
-	//		return "", StatusLocked, err
-	//	}
-	//	return "", http.StatusInternalServerError, err
-	//}
-
-	return fmt.Sprintf("%d", time.Now().Unix()), 0, nil
+	token, err = ls.Create(now, LockDetails{
+		Root:      root,
+		Duration:  infiniteTimeout,
+		ZeroDepth: true,
+	})
+	if err != nil {
+		if err == ErrLocked {
+			return "", StatusLocked, err
+		}
+		return "", http.StatusInternalServerError, err
+	}
+	return token, 0, nil
 }
 
-// ok
+// confirmLocks 确认当前请求可以操作 src 与 dst。锁按用户分别存储，If 头中的锁令牌
+// 只能匹配当前用户创建的锁；已过期的锁在确认前被清除，不再阻止操作
 func (h *Handler) confirmLocks(r *http.Request, src, dst string, fs *filesystem.FileSystem) (release func(), status int, err error) {
+	hdr := r.Header.Get("If")
+	h.Mutex.Lock()
+	ls, ok := h.LockSystem[fs.User.ID]
+	h.Mutex.Unlock()
+	if !ok {
+		return nil, http.StatusInternalServerError, errNoLockSystem
+	}
 
-	//hdr := r.Header.Get("If")
-	//h.Mutex.Lock()
-	//ls,ok := h.LockSystem[fs.User.ID]
-	//h.Mutex.Unlock()
-	//if !ok{
-	//	return nil, http.StatusInternalServerError, errNoLockSystem
-	//}
-	//
-	//if hdr == "" {
-	//	// An empty If header means that the client hasn't previously created locks.
-	//	// Even if this client doesn't care about locks, we still need to check that
-	//	// the resources aren't locked by another client, so we create temporary
-	//	// locks that would conflict with another client's locks. These temporary
-	//	// locks are unlocked at the end of the HTTP request.
-	//	now, srcToken, dstToken := time.Now(), "", ""
-	//	if src != "" {
-	//		srcToken, status, err = h.lock(now, src, fs,ls)
-	//		if err != nil {
-	//			return nil, status, err
-	//		}
-	//	}
-	//	if dst != "" {
-	//		dstToken, status, err = h.lock(now, dst, fs,ls)
-	//		if err != nil {
-	//			if srcToken != "" {
-	//				ls.Unlock(now, srcToken)
-	//			}
-	//			return nil, status, err
-	//		}
-	//	}
-	//
-	//	return func() {
-	//		if dstToken != "" {
-	//			ls.Unlock(now, dstToken)
-	//		}
-	//		if srcToken != "" {
-	//			ls.Unlock(now, srcToken)
-	//		}
-	//	}, 0, nil
-	//}
-	//
-	//ih, ok := parseIfHeader(hdr)
-	//if !ok {
-	//	return nil, http.StatusBadRequest, errInvalidIfHeader
-	//}
-	//// ih is a disjunction (OR) of ifLists, so any ifList will do.
-	//for _, l := range ih.lists {
-	//	lsrc := l.resourceTag
-	//	if lsrc == "" {
-	//		lsrc = src
-	//	} else {
-	//		u, err := url.Parse(lsrc)
-	//		if err != nil {
-	//			continue
-	//		}
-	//		//if u.Host != r.Host {
-	//		//	continue
-	//		//}
-	//		lsrc, status, err = h.stripPrefix(u.Path, fs.User.ID)
-	//		if err != nil {
-	//			return nil, status, err
-	//		}
-	//	}
-	//	release, err = ls.Confirm(
-	//		time.Now(),
-	//		lsrc,
-	//		dst,
-	//		l.conditions...,
-	//	)
-	//	if err == ErrConfirmationFailed {
-	//		continue
-	//	}
-	//	if err != nil {
-	//		return nil, http.StatusInternalServerError, err
-	//	}
-	//	return release, 0, nil
-	//}
-	//// Section 10.4.1 says that "If this header is evaluated and all state lists
-	//// fail, then the request must fail with a 412 (Precondition Failed) status."
-	//// We follow the spec even though the cond_put_corrupt_token test case from
-	//// the litmus test warns on seeing a 412 instead of a 423 (Locked).
-	//return nil, http.StatusPreconditionFailed, ErrLocked
+	if hdr == "" {
+		// An empty If header means that the client hasn't previously created locks.
+		// Even if this client doesn't care about locks, we still need to check that
+		// the resources aren't locked by another client, so we create temporary
+		// locks that would conflict with another client's locks. These temporary
+		// locks are unlocked at the end of the HTTP request.
+		now, srcToken, dstToken := time.Now(), "", ""
+		if src != "" {
+			srcToken, status, err = h.lock(now, src, fs, ls)
+			if err != nil {
+				return nil, status, err
+			}
+		}
+		if dst != "" {
+			dstToken, status, err = h.lock(now, dst, fs, ls)
+			if err != nil {
+				if srcToken != "" {
+					ls.Unlock(now, srcToken)
+				}
+				return nil, status, err
+			}
+		}
 
-	return func() {
+		return func() {
+			if dstToken != "" {
+				ls.Unlock(now, dstToken)
+			}
+			if srcToken != "" {
+				ls.Unlock(now, srcToken)
+			}
+		}, 0, nil
+	}
 
-	}, 0, nil
+	ih, ok := parseIfHeader(hdr)
+	if !ok {
+		return nil, http.StatusBadRequest, errInvalidIfHeader
+	}
+	// ih is a disjunction (OR) of ifLists, so any ifList will do.
+	for _, l := range ih.lists {
+		lsrc := l.resourceTag
+		if lsrc == "" {
+			lsrc = src
+		} else {
+			u, err := url.Parse(lsrc)
+			if err != nil {
+				continue
+			}
+			lsrc, status, err = h.stripPrefix(decodeName(r.Context(), u.Path), fs.User.ID)
+			if err != nil {
+				return nil, status, err
+			}
+		}
+		release, err = ls.Confirm(
+			time.Now(),
+			lsrc,
+			dst,
+			l.conditions...,
+		)
+		if err == ErrConfirmationFailed {
+			continue
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return release, 0, nil
+	}
+	// Section 10.4.1 says that "If this header is evaluated and all state lists
+	// fail, then the request must fail with a 412 (Precondition Failed) status."
+	// We follow the spec even though the cond_put_corrupt_token test case from
+	// the litmus test warns on seeing a 412 instead of a 423 (Locked).
+	return nil, http.StatusPreconditionFailed, ErrLocked
 }
 
 //OK
 func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request, fs *filesystem.FileSystem) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path, fs.User.ID)
+	res, status, err := h.resolve(r.Context(), fs, r.URL.Path)
 	if err != nil {
 		return status, err
 	}
-	ctx := r.Context()
 	allow := "OPTIONS, LOCK, PUT, MKCOL"
-	if exist, fi := isPathExist(ctx, fs, reqPath); exist {
+	if res.Collection {
+		allow = "OPTIONS, LOCK, MKCOL"
+	}
+	if fi := res.Info; fi != nil {
 		if fi.IsDir() {
 			allow = "OPTIONS, LOCK, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND"
 		} else {
@@ -245,15 +235,21 @@ func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request, fs *file
 func (h *Handler) handleGetHeadPost(w http.ResponseWriter, r *http.Request, fs *filesystem.FileSystem) (status int, err error) {
 	defer fs.Recycle()
 
-	reqPath, status, err := h.stripPrefix(r.URL.Path, fs.User.ID)
+	ctx := r.Context()
+	res, status, err := h.resolve(ctx, fs, r.URL.Path)
 	if err != nil {
 		return status, err
 	}
+	reqPath := res.Path
 
-	ctx := r.Context()
+	// 集合不支持获取内容
+	if res.IsDir() {
+		w.Header().Set("Allow", "OPTIONS, LOCK, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND")
+		return http.StatusMethodNotAllowed, errIsADirectory
+	}
 
-	exist, file := fs.IsFileExist(reqPath)
-	if !exist {
+	file := res.File()
+	if file == nil {
 		return http.StatusNotFound, nil
 	}
 	fs.SetTargetFile(&[]model.File{*file})
@@ -271,11 +267,12 @@ func (h *Handler) handleGetHeadPost(w http.ResponseWriter, r *http.Request, fs *
 		return http.StatusInternalServerError, err
 	}
 	w.Header().Set("ETag", etag)
+	filesystem.SetContentTypeHeader(w.Header(), &fs.FileTarget[0])
 
 	if !rs.Redirect {
 		defer rs.Content.Close()
 		// 获取文件内容
-		http.ServeContent(w, r, reqPath, fs.FileTarget[0].UpdatedAt, rs.Content)
+		http.ServeContent(filesystem.NewBufferedResponseWriter(w), r, reqPath, fs.FileTarget[0].UpdatedAt, rs.Content)
 		return 0, nil
 	}
 
@@ -288,30 +285,26 @@ func (h *Handler) handleGetHeadPost(w http.ResponseWriter, r *http.Request, fs *
 func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request, fs *filesystem.FileSystem) (status int, err error) {
 	defer fs.Recycle()
 
-	reqPath, status, err := h.stripPrefix(r.URL.Path, fs.User.ID)
+	ctx := r.Context()
+	res, status, err := h.resolve(ctx, fs, r.URL.Path)
 	if err != nil {
 		return status, err
 	}
 
-	release, status, err := h.confirmLocks(r, reqPath, "", fs)
+	release, status, err := h.confirmLocks(r, res.Path, "", fs)
 	if err != nil {
 		return status, err
 	}
 	defer release()
 
-	ctx := r.Context()
-
-	// 尝试作为文件删除
-	if ok, file := fs.IsFileExist(reqPath); ok {
-		if err := fs.Delete(ctx, []uint{}, []uint{file.ID}, false); err != nil {
+	switch info := res.Info.(type) {
+	case *model.File:
+		if err := fs.Delete(ctx, []uint{}, []uint{info.ID}, false); err != nil {
 			return http.StatusMethodNotAllowed, err
 		}
 		return http.StatusNoContent, nil
-	}
-
-	// 尝试作为目录删除
-	if ok, folder := fs.IsPathExist(reqPath); ok {
-		if err := fs.Delete(ctx, []uint{folder.ID}, []uint{}, false); err != nil {
+	case *model.Folder:
+		if err := fs.Delete(ctx, []uint{info.ID}, []uint{}, false); err != nil {
 			return http.StatusMethodNotAllowed, err
 		}
 		return http.StatusNoContent, nil
@@ -322,10 +315,24 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request, fs *files
 
 // OK
 func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request, fs *filesystem.FileSystem) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path, fs.User.ID)
+	res, status, err := h.resolve(r.Context(), fs, r.URL.Path)
 	if err != nil {
 		return status, err
 	}
+	reqPath := res.Path
+
+	// 不能以 PUT 写入集合
+	if res.Collection || res.IsDir() {
+		return http.StatusMethodNotAllowed, errIsADirectory
+	}
+
+	// 新建文件时检查上级目录
+	if res.Info == nil {
+		if status, err := checkParent(fs, reqPath); err != nil {
+			return status, err
+		}
+	}
+
 	release, status, err := h.confirmLocks(r, reqPath, "", fs)
 	if err != nil {
 		return status, err
@@ -333,28 +340,56 @@ func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request, fs *filesyst
 	defer release()
 	// TODO(rost): Support the If-Match, If-None-Match headers? See bradfitz'
 	// comments in http.checkEtag.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	ctx = context.WithValue(ctx, fsctx.HTTPCtx, r.Context())
-	ctx = context.WithValue(ctx, fsctx.CancelFuncCtx, cancel)
-
 	fileSize, err := strconv.ParseUint(r.Header.Get("Content-Length"), 10, 64)
 	if err != nil {
 		return http.StatusMethodNotAllowed, err
 	}
+
+	// 服务端强制的上传时限
+	ctx, cancel := filesystem.WithUploadDeadline(context.Background(), fileSize)
+	defer cancel()
+	ctx = context.WithValue(ctx, fsctx.HTTPCtx, r.Context())
+	ctx = context.WithValue(ctx, fsctx.CancelFuncCtx, cancel)
+	ctx = context.WithValue(ctx, fsctx.UploadClientCtx, filesystem.UploadClientWebDAV)
+	if clientIP, ok := r.Context().Value(fsctx.ClientIPCtx).(string); ok {
+		ctx = context.WithValue(ctx, fsctx.ClientIPCtx, clientIP)
+	}
+
 	fileName := path.Base(reqPath)
 	filePath := path.Dir(reqPath)
+
+	// 按用户组设定确定文件的 MIME 类型
+	mimeMode := fs.User.Group.OptionsSerialized.WebDAVMIMEMode
+	mimeType, err := filesystem.ResolveMIMEType(mimeMode, fileName, r.Header.Get("Content-Type"))
+	if err != nil {
+		return http.StatusUnsupportedMediaType, err
+	}
+
 	fileData := fsctx.FileStream{
-		MIMEType:    r.Header.Get("Content-Type"),
-		File:        r.Body,
+		MIMEType:    mimeType,
+		File:        filesystem.NewContextReader(ctx, r.Body),
 		Size:        fileSize,
 		Name:        fileName,
 		VirtualPath: filePath,
 	}
 
+	// 限定上传时间段
+	if windows, loc := fs.UploadWindows(); len(windows) > 0 {
+		fs.Use("BeforeUpload", filesystem.HookValidateUploadWindow(windows, loc))
+	}
+
+	// 限定上传来源地区
+	if filesystem.IsUploadRegionPolicyEnabled() {
+		fs.Use("BeforeUpload", filesystem.HookValidateUploadRegion)
+	}
+
+	// 记录确定的 MIME 类型
+	if mimeMode != "" {
+		fs.Use("BeforeUpload", filesystem.HookSaveMIMEType)
+	}
+
 	// 判断文件是否已存在
-	exist, originFile := fs.IsFileExist(reqPath)
-	if exist {
+	if originFile := res.File(); originFile != nil {
 		// 已存在，为更新操作
 
 		// 检查此文件是否有软链接
@@ -368,27 +403,45 @@ func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request, fs *filesyst
 			fs.Use("AfterValidateFailed", filesystem.HookUpdateSourceName)
 		}
 
+		fs.Use("BeforeUpload", filesystem.HookValidateRetention)
 		fs.Use("BeforeUpload", filesystem.HookResetPolicy)
 		fs.Use("BeforeUpload", filesystem.HookValidateFile)
+		fs.Use("BeforeUpload", filesystem.HookValidateConfiguredMinFileSize)
 		fs.Use("BeforeUpload", filesystem.HookValidateCapacityDiff)
 		fs.Use("AfterUploadCanceled", filesystem.HookCleanFileContent)
 		fs.Use("AfterUploadCanceled", filesystem.HookClearFileSize)
 		fs.Use("AfterUploadCanceled", filesystem.HookCancelContext)
 		fs.Use("AfterUpload", filesystem.GenericAfterUpdate)
+		fs.UseUpdateProcessors()
 		fs.Use("AfterValidateFailed", filesystem.HookCleanFileContent)
 		fs.Use("AfterValidateFailed", filesystem.HookClearFileSize)
 		ctx = context.WithValue(ctx, fsctx.FileModelCtx, *originFile)
 		fileData.Mode |= fsctx.Overwrite
 	} else {
+		metadata, err := filesystem.ParseUploadMetadata(r)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		fileData.Metadata = metadata
+
 		// 给文件系统分配钩子
 		fs.Use("BeforeUpload", filesystem.HookValidateFile)
+		fs.Use("BeforeUpload", filesystem.HookValidateUniqueName)
+		fs.Use("BeforeUpload", filesystem.HookValidateConfiguredMinFileSize)
 		fs.Use("BeforeUpload", filesystem.HookValidateCapacity)
 		fs.Use("AfterUploadCanceled", filesystem.HookDeleteTempFile)
 		fs.Use("AfterUploadCanceled", filesystem.HookCancelContext)
+		fs.Use("AfterUpload", filesystem.HookValidateUniqueContent)
+		fs.Use("BeforeAddFile", filesystem.HookValidateFileCount)
 		fs.Use("AfterUpload", filesystem.GenericAfterUpload)
-		fs.Use("AfterUpload", filesystem.HookGenerateThumb)
+		fs.UseUploadProcessors(true)
+		fs.Use("AfterUpload", task.HookTranscodeVideo)
+		fs.Use("AfterUpload", task.HookGenerateDocPreview)
+		fs.Use("AfterUpload", task.HookGenerateHLS)
 		fs.Use("AfterValidateFailed", filesystem.HookDeleteTempFile)
 	}
+	fs.Use("BeforeUpload", filesystem.HookValidateEncryptedUpload)
+	fs.Use("BeforeUpload", filesystem.HookValidateMIMEType)
 
 	// 执行上传
 	err = fs.Upload(ctx, &fileData)
@@ -408,18 +461,33 @@ func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request, fs *filesyst
 func (h *Handler) handleMkcol(w http.ResponseWriter, r *http.Request, fs *filesystem.FileSystem) (status int, err error) {
 	defer fs.Recycle()
 
-	reqPath, status, err := h.stripPrefix(r.URL.Path, fs.User.ID)
+	ctx := r.Context()
+	res, status, err := h.resolve(ctx, fs, r.URL.Path)
 	if err != nil {
 		return status, err
 	}
+	reqPath := res.Path
+
+	// 路径上已有目录或文件时，依照 RFC 4918 第 9.3.1 节返回 405
+	if res.Info == nil && res.Collection {
+		if ok, file := fs.IsFileExist(reqPath); ok {
+			res.Info = file
+		}
+	}
+	if res.Info != nil {
+		return http.StatusMethodNotAllowed, errResourceExists
+	}
+
+	if status, err := checkParent(fs, reqPath); err != nil {
+		return status, err
+	}
+
 	release, status, err := h.confirmLocks(r, reqPath, "", fs)
 	if err != nil {
 		return status, err
 	}
 	defer release()
 
-	ctx := r.Context()
-
 	if r.ContentLength > 0 {
 		return http.StatusUnsupportedMediaType, nil
 	}
@@ -442,6 +510,7 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request, fs *fil
 	if err != nil {
 		return http.StatusBadRequest, errInvalidDestination
 	}
+	u.Path = decodeName(r.Context(), u.Path)
 	//if u.Host != "" && u.Host != r.Host {
 	//	return http.StatusBadGateway, errInvalidDestination
 	//}
@@ -530,133 +599,121 @@ func (h *Handler) handleLock(w http.ResponseWriter, r *http.Request, fs *filesys
 		return status, err
 	}
 
-	////ctx := r.Context()
-	//token, ld, now, created := "", LockDetails{}, time.Now(), false
-	//if li == (lockInfo{}) {
-	//	// An empty lockInfo means to refresh the lock.
-	//	ih, ok := parseIfHeader(r.Header.Get("If"))
-	//	if !ok {
-	//		return http.StatusBadRequest, errInvalidIfHeader
-	//	}
-	//	if len(ih.lists) == 1 && len(ih.lists[0].conditions) == 1 {
-	//		token = ih.lists[0].conditions[0].Token
-	//	}
-	//	if token == "" {
-	//		return http.StatusBadRequest, errInvalidLockToken
-	//	}
-	//	ld, err = ls.Refresh(now, token, duration)
-	//	if err != nil {
-	//		if err == ErrNoSuchLock {
-	//			return http.StatusPreconditionFailed, err
-	//		}
-	//		return http.StatusInternalServerError, err
-	//	}
-	//
-	//} else {
-	//	// Section 9.10.3 says that "If no Depth header is submitted on a LOCK request,
-	//	// then the request MUST act as if a "Depth:infinity" had been submitted."
-	//	depth := infiniteDepth
-	//	if hdr := r.Header.Get("Depth"); hdr != "" {
-	//		depth = parseDepth(hdr)
-	//		if depth != 0 && depth != infiniteDepth {
-	//			// Section 9.10.3 says that "Values other than 0 or infinity must not be
-	//			// used with the Depth header on a LOCK method".
-	//			return http.StatusBadRequest, errInvalidDepth
-	//		}
-	//	}
-	//	reqPath, status, err := h.stripPrefix(r.URL.Path, fs.User.ID)
-	//	if err != nil {
-	//		return status, err
-	//	}
-	//	ld = LockDetails{
-	//		Root:      reqPath,
-	//		Duration:  duration,
-	//		OwnerXML:  li.Owner.InnerXML,
-	//		ZeroDepth: depth == 0,
-	//	}
-	//	token, err = ls.Create(now, ld)
-	//	if err != nil {
-	//		if err == ErrLocked {
-	//			return StatusLocked, err
-	//		}
-	//		return http.StatusInternalServerError, err
-	//	}
-	//	defer func() {
-	//		if retErr != nil {
-	//			ls.Unlock(now, token)
-	//		}
-	//	}()
-	//
-	//	// Create the resource if it didn't previously exist.
-	//	//if _, err := h.FileSystem.Stat(ctx, reqPath); err != nil {
-	//	//	f, err := h.FileSystem.OpenFile(ctx, reqPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
-	//	//	if err != nil {
-	//	//		// TODO: detect missing intermediate dirs and return http.StatusConflict?
-	//	//		return http.StatusInternalServerError, err
-	//	//	}
-	//	//	f.Close()
-	//	//	created = true
-	//	//}
-	//
-	//	// http://www.webdav.org/specs/rfc4918.html#HEADER_Lock-Token says that the
-	//	// Lock-Token value is a Coded-URL. We add angle brackets.
-	//	w.Header().Set("Lock-Token", "<"+token+">")
-	//}
-	//
-	//w.Header().Set("Content-Type", "application/xml; charset=utf-8")
-	//if created {
-	//	// This is "w.WriteHeader(http.StatusCreated)" and not "return
-	//	// http.StatusCreated, nil" because we write our own (XML) response to w
-	//	// and Handler.ServeHTTP would otherwise write "Created".
-	//	w.WriteHeader(http.StatusCreated)
-	//}
+	li, status, err := readLockInfo(r.Body)
+	if err != nil {
+		return status, err
+	}
 
-	writeLockInfo(w, fmt.Sprintf("%d", time.Now().UnixNano()), LockDetails{
-		Duration: duration,
-		OwnerXML: fs.User.Email,
-		Root:     reqPath,
-	})
+	token, ld, now := "", LockDetails{}, time.Now()
+	if li == (lockInfo{}) {
+		// An empty lockInfo means to refresh the lock.
+		ih, ok := parseIfHeader(r.Header.Get("If"))
+		if !ok {
+			return http.StatusBadRequest, errInvalidIfHeader
+		}
+		if len(ih.lists) == 1 && len(ih.lists[0].conditions) == 1 {
+			token = ih.lists[0].conditions[0].Token
+		}
+		if token == "" {
+			return http.StatusBadRequest, errInvalidLockToken
+		}
+		ld, err = ls.Refresh(now, token, limitLockDuration(duration))
+		if err != nil {
+			if err == ErrNoSuchLock {
+				return http.StatusPreconditionFailed, err
+			}
+			return http.StatusInternalServerError, err
+		}
+	} else {
+		// Section 9.10.3 says that "If no Depth header is submitted on a LOCK request,
+		// then the request MUST act as if a "Depth:infinity" had been submitted."
+		depth := infiniteDepth
+		if hdr := r.Header.Get("Depth"); hdr != "" {
+			depth = parseDepth(hdr)
+			if depth != 0 && depth != infiniteDepth {
+				// Section 9.10.3 says that "Values other than 0 or infinity must not be
+				// used with the Depth header on a LOCK method".
+				return http.StatusBadRequest, errInvalidDepth
+			}
+		}
+		ld = LockDetails{
+			Root:      reqPath,
+			Duration:  limitLockDuration(duration),
+			OwnerXML:  li.Owner.InnerXML,
+			ZeroDepth: depth == 0,
+		}
+		token, err = ls.Create(now, ld)
+		if err != nil {
+			if err == ErrLocked {
+				return StatusLocked, err
+			}
+			return http.StatusInternalServerError, err
+		}
+		defer func() {
+			if retErr != nil {
+				ls.Unlock(now, token)
+			}
+		}()
+
+		// http://www.webdav.org/specs/rfc4918.html#HEADER_Lock-Token says that the
+		// Lock-Token value is a Coded-URL. We add angle brackets.
+		w.Header().Set("Lock-Token", "<"+token+">")
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if _, err := writeLockInfo(w, token, ld); err != nil {
+		return http.StatusInternalServerError, err
+	}
 	return 0, nil
 }
 
+// limitLockDuration 将锁的时长限制在 webdav_lock_timeout 设定以内，避免客户端异常退出后
+// 无限期或长时间锁定的资源无法释放
+func limitLockDuration(duration time.Duration) time.Duration {
+	max := time.Duration(model.GetIntSetting("webdav_lock_timeout", 3600)) * time.Second
+	if duration < 0 || duration > max {
+		return max
+	}
+	return duration
+}
+
 // OK
 func (h *Handler) handleUnlock(w http.ResponseWriter, r *http.Request, fs *filesystem.FileSystem, ls LockSystem) (status int, err error) {
 	defer fs.Recycle()
-	return http.StatusNoContent, err
 
-	//// http://www.webdav.org/specs/rfc4918.html#HEADER_Lock-Token says that the
-	//// Lock-Token value is a Coded-URL. We strip its angle brackets.
-	//t := r.Header.Get("Lock-Token")
-	//if len(t) < 2 || t[0] != '<' || t[len(t)-1] != '>' {
-	//	return http.StatusBadRequest, errInvalidLockToken
-	//}
-	//t = t[1 : len(t)-1]
-	//
-	//switch err = ls.Unlock(time.Now(), t); err {
-	//case nil:
-	//	return http.StatusNoContent, err
-	//case ErrForbidden:
-	//	return http.StatusForbidden, err
-	//case ErrLocked:
-	//	return StatusLocked, err
-	//case ErrNoSuchLock:
-	//	return http.StatusConflict, err
-	//default:
-	//	return http.StatusInternalServerError, err
-	//}
+	// http://www.webdav.org/specs/rfc4918.html#HEADER_Lock-Token says that the
+	// Lock-Token value is a Coded-URL. We strip its angle brackets.
+	t := r.Header.Get("Lock-Token")
+	if len(t) < 2 || t[0] != '<' || t[len(t)-1] != '>' {
+		return http.StatusBadRequest, errInvalidLockToken
+	}
+	t = t[1 : len(t)-1]
+
+	switch err = ls.Unlock(time.Now(), t); err {
+	case nil:
+		return http.StatusNoContent, err
+	case ErrForbidden:
+		return http.StatusForbidden, err
+	case ErrLocked:
+		return StatusLocked, err
+	case ErrNoSuchLock:
+		return http.StatusConflict, err
+	default:
+		return http.StatusInternalServerError, err
+	}
 }
 
 // OK
 func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request, fs *filesystem.FileSystem, ls LockSystem) (status int, err error) {
 	defer fs.Recycle()
 
-	reqPath, status, err := h.stripPrefix(r.URL.Path, fs.User.ID)
+	ctx := r.Context()
+	res, status, err := h.resolve(ctx, fs, r.URL.Path)
 	if err != nil {
 		return status, err
 	}
-	ctx := r.Context()
-	ok, fi := isPathExist(ctx, fs, reqPath)
-	if !ok {
+	reqPath, fi := res.Path, res.Info
+	if fi == nil {
 		return http.StatusNotFound, err
 	}
 
@@ -672,6 +729,18 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request, fs *fil
 		return status, err
 	}
 
+	// 目录项目过多时直接拒绝，避免客户端得到不完整的列表
+	limit := propfindMaxEntries()
+	if limit > 0 && depth != 0 && fi.IsDir() && propfindOverflow() == PropfindOverflowReject {
+		total, err := fi.(*model.Folder).CountChildren()
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if total > limit {
+			return StatusInsufficientStorage, errTooManyEntries
+		}
+	}
+
 	mw := multistatusWriter{w: w}
 
 	walkFn := func(reqPath string, info FileInfo, err error) error {
@@ -702,10 +771,23 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request, fs *fil
 		if href != "/" && info.IsDir() {
 			href += "/"
 		}
+		href = encodeName(ctx, href)
 		return mw.write(makePropstatResponse(href, pstats))
 	}
 
-	walkErr := walkFS(ctx, fs, depth, reqPath, fi, walkFn)
+	truncFn := func(reqPath string, folder *model.Folder, listed int) error {
+		total, err := folder.CountChildren()
+		if err != nil {
+			return err
+		}
+		href := path.Join(h.Prefix, reqPath)
+		if href != "/" {
+			href += "/"
+		}
+		return mw.write(makeTruncatedResponse(encodeName(ctx, href), listed, total))
+	}
+
+	walkErr := walkFS(ctx, fs, depth, reqPath, fi, limit, walkFn, truncFn)
 	closeErr := mw.close()
 	if walkErr != nil {
 		return http.StatusInternalServerError, walkErr
@@ -731,14 +813,15 @@ func (h *Handler) handleProppatch(w http.ResponseWriter, r *http.Request, fs *fi
 
 	ctx := r.Context()
 
-	if exist, _ := isPathExist(ctx, fs, reqPath); !exist {
+	exist, fi := isPathExist(ctx, fs, reqPath)
+	if !exist {
 		return http.StatusNotFound, nil
 	}
 	patches, status, err := readProppatch(r.Body)
 	if err != nil {
 		return status, err
 	}
-	pstats, err := patch(ctx, fs, ls, reqPath, patches)
+	pstats, err := patch(ctx, fs, ls, fi, patches)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -840,8 +923,12 @@ var (
 	errNoFileSystem            = errors.New("webdav: no file system")
 	errNoLockSystem            = errors.New("webdav: no lock system")
 	errNotADirectory           = errors.New("webdav: not a directory")
+	errIsADirectory            = errors.New("webdav: is a directory")
+	errParentNotExist          = errors.New("webdav: parent collection does not exist")
+	errResourceExists          = errors.New("webdav: resource already exists")
 	errPrefixMismatch          = errors.New("webdav: prefix mismatch")
 	errRecursionTooDeep        = errors.New("webdav: recursion too deep")
+	errTooManyEntries          = errors.New("webdav: too many entries in collection")
 	errUnsupportedLockInfo     = errors.New("webdav: unsupported lock info")
 	errUnsupportedMethod       = errors.New("webdav: unsupported method")
 )
@@ -8,6 +8,7 @@ import (
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/aria2"
 	"github.com/cloudreve/Cloudreve/v3/pkg/email"
+	"github.com/cloudreve/Cloudreve/v3/pkg/health"
 	"github.com/cloudreve/Cloudreve/v3/pkg/request"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/service/admin"
@@ -25,6 +26,14 @@ func AdminSummary(c *gin.Context) {
 	}
 }
 
+// AdminHealth 获取各依赖服务的就绪检查详情
+func AdminHealth(c *gin.Context) {
+	c.JSON(200, serializer.Response{
+		Code: 0,
+		Data: health.Check(),
+	})
+}
+
 // AdminNews 获取社区新闻
 func AdminNews(c *gin.Context) {
 	tag := "announcements"
@@ -351,6 +360,145 @@ func AdminDeleteFile(c *gin.Context) {
 	}
 }
 
+// AdminResetThumbStatus 重置缩略图生成失败状态
+func AdminResetThumbStatus(c *gin.Context) {
+	var service admin.ThumbResetService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Reset(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminListBrokenFile 列出存储端对象已丢失的文件
+func AdminListBrokenFile(c *gin.Context) {
+	var service admin.AdminListService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.BrokenFiles()
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminDiagnoseFile 诊断并修复单个文件记录与存储端对象的一致性
+func AdminDiagnoseFile(c *gin.Context) {
+	var service admin.FileDiagnoseService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Diagnose(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminImpersonateUser 模拟用户进行操作
+func AdminImpersonateUser(c *gin.Context) {
+	var service admin.UserImpersonateService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Start(c, CurrentUser(c))
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// StopImpersonation 结束管理员对当前用户的模拟
+func StopImpersonation(c *gin.Context) {
+	var service admin.NoParamService
+	res := service.StopImpersonation(c, CurrentUser(c))
+	c.JSON(200, res)
+}
+
+// AdminStorageClassUsage 按存储策略和存储类型统计文件用量
+func AdminStorageClassUsage(c *gin.Context) {
+	var service admin.NoParamService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.StorageClassUsage()
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminListQuarantinedFile 列出已隔离的文件
+func AdminListQuarantinedFile(c *gin.Context) {
+	var service admin.AdminListService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.QuarantinedFiles()
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminReleaseQuarantinedFile 解除文件隔离
+func AdminReleaseQuarantinedFile(c *gin.Context) {
+	var service admin.QuarantineBatchService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Release(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminDeleteQuarantinedFile 永久删除已隔离的文件
+func AdminDeleteQuarantinedFile(c *gin.Context) {
+	var service admin.QuarantineBatchService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Delete(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminListPendingApprovalFile 列出待审核的文件
+func AdminListPendingApprovalFile(c *gin.Context) {
+	var service admin.AdminListService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.PendingApprovalFiles()
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminApproveFile 审核通过待审核的文件
+func AdminApproveFile(c *gin.Context) {
+	var service admin.ApprovalBatchService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Approve(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminRejectFile 拒绝并删除待审核的文件
+func AdminRejectFile(c *gin.Context) {
+	var service admin.ApprovalBatchService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Reject(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminSetFolderApproval 设定上传至目录的文件是否需经审核
+func AdminSetFolderApproval(c *gin.Context) {
+	var service admin.FolderApprovalService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Set()
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // AdminListShare 列出分享
 func AdminListShare(c *gin.Context) {
 	var service admin.AdminListService
@@ -417,6 +565,39 @@ func AdminDeleteTask(c *gin.Context) {
 	}
 }
 
+// AdminListHookRetry 列出上传后处理重试队列
+func AdminListHookRetry(c *gin.Context) {
+	var service admin.AdminListService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.HookRetries()
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminRequeueHookRetry 立即重试上传后处理
+func AdminRequeueHookRetry(c *gin.Context) {
+	var service admin.HookRetryBatchService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Requeue(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminDeleteHookRetry 批量删除上传后处理重试记录
+func AdminDeleteHookRetry(c *gin.Context) {
+	var service admin.HookRetryBatchService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Delete(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // AdminCreateImportTask 新建文件导入任务
 func AdminCreateImportTask(c *gin.Context) {
 	var service admin.ImportTaskService
@@ -428,6 +609,28 @@ func AdminCreateImportTask(c *gin.Context) {
 	}
 }
 
+// AdminCreateMigrateTask 新建存储策略迁移任务
+func AdminCreateMigrateTask(c *gin.Context) {
+	var service admin.MigrateTaskService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Create(c, CurrentUser(c))
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// AdminAbortMigrateTask 中止存储策略迁移任务
+func AdminAbortMigrateTask(c *gin.Context) {
+	var service admin.TaskBatchService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.AbortMigrate(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // AdminListFolders 列出用户或外部文件系统目录
 func AdminListFolders(c *gin.Context) {
 	var service admin.ListFolderService
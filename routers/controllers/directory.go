@@ -16,6 +16,105 @@ func CreateDirectory(c *gin.Context) {
 	}
 }
 
+// SetFolderPermission 设定目录中上传文件的默认权限
+func SetFolderPermission(c *gin.Context) {
+	var service explorer.FolderPermissionService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Set(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// SetFolderAllowedTypes 设定目录允许存放的文件类型
+func SetFolderAllowedTypes(c *gin.Context) {
+	var service explorer.FolderAllowedTypesService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Set(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// SetFolderCollisionPolicy 设定目录中上传文件重名时的处理方式
+func SetFolderCollisionPolicy(c *gin.Context) {
+	var service explorer.FolderCollisionPolicyService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Set(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// SetFolderRetention 设定上传至目录的文件的保留天数
+func SetFolderRetention(c *gin.Context) {
+	var service explorer.FolderRetentionService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Set(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// SetFolderRequiredMetadata 设定上传至目录的文件必须提供的元数据
+func SetFolderRequiredMetadata(c *gin.Context) {
+	var service explorer.FolderRequiredMetadataService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Set(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// SetFolderUniqueContent 设定是否拒绝上传与目录中已有文件内容相同的文件
+func SetFolderUniqueContent(c *gin.Context) {
+	var service explorer.FolderUniqueContentService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Set(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// SetFolderCover 设定目录封面
+func SetFolderCover(c *gin.Context) {
+	var service explorer.FolderCoverService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Set(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// WarmFolderThumbs 创建目录缩略图预生成任务
+func WarmFolderThumbs(c *gin.Context) {
+	var service explorer.FolderThumbWarmService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Create(c, CurrentUser(c))
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// GetFolderThumbWarmTask 获取目录缩略图预生成任务状态
+func GetFolderThumbWarmTask(c *gin.Context) {
+	var service explorer.FolderThumbWarmTaskService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.Get(c, CurrentUser(c))
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // ListDirectory 列出目录下内容
 func ListDirectory(c *gin.Context) {
 	var service explorer.DirectoryService
@@ -170,7 +170,7 @@ func Thumb(c *gin.Context) {
 	}
 
 	// 获取缩略图
-	resp, err := fs.GetThumb(ctx, fileID.(uint))
+	resp, err := fs.GetThumb(filesystem.WithFileUnlock(ctx, c), fileID.(uint))
 	if err != nil {
 		c.JSON(200, serializer.Err(serializer.CodeNotSet, "Failed to get thumbnail", err))
 		return
@@ -210,6 +210,24 @@ func Preview(c *gin.Context) {
 	}
 }
 
+// HLS 获取视频的 HLS 播放列表或分段
+func HLS(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.HLSService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.Serve(ctx, c)
+		// 是否有错误发生
+		if res.Code != 0 {
+			c.JSON(200, res)
+		}
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // PreviewText 预览文本文件
 func PreviewText(c *gin.Context) {
 	// 创建上下文
@@ -258,6 +276,77 @@ func CreateDownloadSession(c *gin.Context) {
 	}
 }
 
+// RestoreArchivedFile 对归档文件发起解冻
+func RestoreArchivedFile(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.FileIDService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.RestoreArchived(ctx, c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// ListTrash 列出回收站中的文件
+func ListTrash(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.FileIDService
+	res := service.ListTrash(ctx, c)
+	c.JSON(200, res)
+}
+
+// RestoreTrashedFile 将回收站中的文件恢复至原目录
+func RestoreTrashedFile(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.FileIDService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.RestoreTrashed(ctx, c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// SetFilePassword 设定文件的下载密码
+func SetFilePassword(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.FilePasswordService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Set(ctx, c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// UnlockFile 使用下载密码解锁文件
+func UnlockFile(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.FileUnlockService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Unlock(ctx, c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // Download 文件下载
 func Download(c *gin.Context) {
 	// 创建上下文
@@ -290,6 +379,22 @@ func PutContent(c *gin.Context) {
 	}
 }
 
+// BatchUpload 单次请求上传多个文件
+func BatchUpload(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.BatchUploadService
+	if err := c.ShouldBindQuery(&service); err == nil {
+		res := service.Upload(ctx, c)
+		c.JSON(200, res)
+		request.BlackHole(c.Request.Body)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // FileUpload 本地策略文件上传
 func FileUpload(c *gin.Context) {
 	// 创建上下文
@@ -392,6 +497,25 @@ func GetUploadSession(c *gin.Context) {
 	}
 }
 
+// ExportFolderManifest 导出目录下所有文件的校验清单
+func ExportFolderManifest(c *gin.Context) {
+	var service explorer.FolderManifestService
+	if err := c.ShouldBindUri(&service); err != nil {
+		c.JSON(200, ErrorResponse(err))
+		return
+	}
+
+	if err := c.ShouldBindQuery(&service); err != nil {
+		c.JSON(200, ErrorResponse(err))
+		return
+	}
+
+	// 开始输出后无法再返回错误信息
+	if res := service.Export(c); res.Code != 0 && !c.Writer.Written() {
+		c.JSON(200, res)
+	}
+}
+
 // SearchFile 搜索文件
 func SearchFile(c *gin.Context) {
 	var service explorer.ItemSearchService
@@ -409,6 +533,17 @@ func SearchFile(c *gin.Context) {
 	c.JSON(200, res)
 }
 
+// SearchSimilarImages 查找相似图像
+func SearchSimilarImages(c *gin.Context) {
+	var service explorer.SimilarImageService
+	if err := c.ShouldBindQuery(&service); err == nil {
+		res := service.Search(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 //
 //// ExtSearchFile 额外搜索
 //func ExtSearchFile(c *gin.Context) {
@@ -432,6 +567,28 @@ func CreateFile(c *gin.Context) {
 	}
 }
 
+// UploadFromURL 从远程URL上传文件
+func UploadFromURL(c *gin.Context) {
+	var service explorer.URLUploadService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Upload(c, CurrentUser(c))
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// GetURLUploadTask 获取远程URL上传任务状态
+func GetURLUploadTask(c *gin.Context) {
+	var service explorer.URLUploadTaskService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.Get(c, CurrentUser(c))
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // OtherSearchFile 搜索文件
 func OtherSearchFile(c *gin.Context) {
 	var req explorer.OtherSearchFileReq
@@ -212,6 +212,17 @@ func ArchiveShare(c *gin.Context) {
 	}
 }
 
+// UnlockShareFile 使用下载密码解锁分享中的文件
+func UnlockShareFile(c *gin.Context) {
+	var service share.FileUnlockService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.Unlock(c)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // ShareThumb 获取分享目录下文件的缩略图
 func ShareThumb(c *gin.Context) {
 	var service share.Service
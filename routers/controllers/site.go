@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"net/http"
+
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/conf"
+	"github.com/cloudreve/Cloudreve/v3/pkg/health"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/gin-gonic/gin"
@@ -52,6 +55,29 @@ func Ping(c *gin.Context) {
 	})
 }
 
+// HealthLive 存活检查，进程可响应请求即视为存活
+func HealthLive(c *gin.Context) {
+	c.JSON(200, serializer.Response{
+		Code: 0,
+		Data: "ok",
+	})
+}
+
+// HealthReady 就绪检查，数据库、缓存、存储端任一不可用时返回 503，
+// 仅返回各依赖是否可用，错误详情需通过管理接口查看
+func HealthReady(c *gin.Context) {
+	status := health.Check()
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	c.JSON(code, serializer.Response{
+		Code: 0,
+		Data: status.Public(),
+	})
+}
+
 // Captcha 获取验证码
 func Captcha(c *gin.Context) {
 	options := model.GetSettingByNames(
@@ -109,6 +109,21 @@ func SlaveThumb(c *gin.Context) {
 	}
 }
 
+// SlaveGenerateThumb 从机重新生成文件缩略图
+func SlaveGenerateThumb(c *gin.Context) {
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var service explorer.SlaveFileService
+	if err := c.ShouldBindUri(&service); err == nil {
+		res := service.GenerateThumb(ctx)
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // SlaveDelete 从机删除
 func SlaveDelete(c *gin.Context) {
 	// 创建上下文
@@ -77,7 +77,8 @@ func FinishLoginAuthn(c *gin.Context) {
 	}
 
 	util.SetSession(c, map[string]interface{}{
-		"user_id": expectedUser.ID,
+		"user_id":       expectedUser.ID,
+		"session_epoch": expectedUser.SessionEpoch,
 	})
 	c.JSON(200, serializer.BuildUserResponse(expectedUser))
 }
@@ -244,6 +245,28 @@ func UserTasks(c *gin.Context) {
 	}
 }
 
+// UserNotifications 获取站内通知
+func UserNotifications(c *gin.Context) {
+	var service user.SettingListService
+	if err := c.ShouldBindQuery(&service); err == nil {
+		res := service.ListNotifications(c, CurrentUser(c))
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
+// MarkNotificationsRead 将站内通知标记为已读
+func MarkNotificationsRead(c *gin.Context) {
+	var service user.NotificationReadService
+	if err := c.ShouldBindJSON(&service); err == nil {
+		res := service.MarkRead(c, CurrentUser(c))
+		c.JSON(200, res)
+	} else {
+		c.JSON(200, ErrorResponse(err))
+	}
+}
+
 // UserSetting 获取用户设定
 func UserSetting(c *gin.Context) {
 	var service user.SettingService
@@ -349,6 +372,8 @@ func UpdateOption(c *gin.Context) {
 			subService = &user.DeleteWebAuthn{}
 		case "theme":
 			subService = &user.ThemeChose{}
+		case "lifecycle":
+			subService = &user.LifecycleChange{}
 		default:
 			subService = &user.ChangerNick{}
 		}
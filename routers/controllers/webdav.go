@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"context"
+
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/cloudreve/Cloudreve/v3/pkg/webdav"
 	"github.com/cloudreve/Cloudreve/v3/service/setting"
@@ -28,6 +31,7 @@ func ServeWebDAV(c *gin.Context) {
 		return
 	}
 
+	var codec webdav.NameCodec
 	if webdavCtx, ok := c.Get("webdav"); ok {
 		application := webdavCtx.(*model.Webdav)
 
@@ -39,8 +43,19 @@ func ServeWebDAV(c *gin.Context) {
 				fs.Root = root
 			}
 		}
+
+		// 旧版客户端文件名编码转换
+		codec = webdav.NewCharsetCodec(application.NameCharset(&fs.User.Group))
 	}
 
+	// Windows 保留设备名以带前缀的名称呈现
+	if codec = webdav.ChainNameCodecs(codec, webdav.NewReservedNameCodec()); codec != nil {
+		c.Request = c.Request.WithContext(webdav.WithNameCodec(c.Request.Context(), codec))
+	}
+
+	// 记录经可信代理解析的客户端 IP
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), fsctx.ClientIPCtx, c.ClientIP()))
+
 	handler.ServeHTTP(c.Writer, c.Request, fs)
 }
 
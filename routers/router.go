@@ -36,6 +36,8 @@ func InitSlaveRouter() *gin.Engine {
 	v3.Use(middleware.MasterMetadata())
 	// 禁止缓存
 	v3.Use(middleware.CacheControl())
+	// 全站上传并发限制
+	uploadLimit := middleware.UploadConcurrencyLimit()
 
 	/*
 		路由
@@ -51,7 +53,7 @@ func InitSlaveRouter() *gin.Engine {
 		upload := v3.Group("upload")
 		{
 			// 上传分片
-			upload.POST(":sessionId", controllers.SlaveUpload)
+			upload.POST(":sessionId", uploadLimit, controllers.SlaveUpload)
 			// 创建上传会话上传
 			upload.PUT("", controllers.SlaveGetUploadSession)
 			// 删除上传会话
@@ -63,6 +65,8 @@ func InitSlaveRouter() *gin.Engine {
 		v3.GET("source/:speed/:path/:name", controllers.SlavePreview)
 		// 缩略图
 		v3.GET("thumb/:path", controllers.SlaveThumb)
+		// 重新生成缩略图
+		v3.POST("thumb/:path", controllers.SlaveGenerateThumb)
 		// 删除文件
 		v3.POST("delete", controllers.SlaveDelete)
 		// 列出文件
@@ -137,9 +141,13 @@ func InitMasterRouter() *gin.Engine {
 	}
 	// 用户会话
 	v3.Use(middleware.CurrentUser())
+	// 管理员模拟用户
+	v3.Use(middleware.Impersonation())
 
 	// 禁止缓存
 	v3.Use(middleware.CacheControl())
+	// 全站上传并发限制
+	uploadLimit := middleware.UploadConcurrencyLimit()
 
 	/*
 		路由
@@ -159,6 +167,10 @@ func InitMasterRouter() *gin.Engine {
 		{
 			// 测试用路由
 			site.GET("ping", controllers.Ping)
+			// 存活检查
+			site.GET("health/live", controllers.HealthLive)
+			// 就绪检查
+			site.GET("health/ready", controllers.HealthReady)
 			// 验证码
 			site.GET("captcha", controllers.Captcha)
 			// 站点全局配置
@@ -237,7 +249,7 @@ func InitMasterRouter() *gin.Engine {
 			upload := slave.Group("upload")
 			{
 				// 上传分片
-				upload.POST(":sessionId", controllers.SlaveUpload)
+				upload.POST(":sessionId", uploadLimit, controllers.SlaveUpload)
 				// 创建上传会话上传
 				upload.PUT("", controllers.SlaveGetUploadSession)
 				// 删除上传会话
@@ -360,6 +372,11 @@ func InitMasterRouter() *gin.Engine {
 				middleware.CheckShareUnlocked(),
 				controllers.PreviewShareReadme,
 			)
+			// 使用下载密码解锁分享中的文件
+			share.POST("unlock/:id",
+				middleware.CheckShareUnlocked(),
+				controllers.UnlockShareFile,
+			)
 			// 获取缩略图
 			share.GET("thumb/:id/:file",
 				middleware.CheckShareUnlocked(),
@@ -379,6 +396,8 @@ func InitMasterRouter() *gin.Engine {
 			{
 				// 获取站点概况
 				admin.GET("summary", controllers.AdminSummary)
+				// 获取依赖服务就绪检查详情
+				admin.GET("health", controllers.AdminHealth)
 				// 获取社区新闻
 				admin.GET("news", controllers.AdminNews)
 				// 更改设置
@@ -447,6 +466,8 @@ func InitMasterRouter() *gin.Engine {
 					user.POST("delete", controllers.AdminDeleteUser)
 					// 封禁/解封用户
 					user.PATCH("ban/:id", controllers.AdminBanUser)
+					// 模拟用户进行操作
+					user.POST("impersonate", controllers.AdminImpersonateUser)
 				}
 
 				file := admin.Group("file")
@@ -457,6 +478,28 @@ func InitMasterRouter() *gin.Engine {
 					file.GET("preview/:id", middleware.Sandbox(), controllers.AdminGetFile)
 					// 删除
 					file.POST("delete", controllers.AdminDeleteFile)
+					// 重置缩略图生成失败状态
+					file.POST("thumb/reset", controllers.AdminResetThumbStatus)
+					// 列出存储端对象已丢失的文件
+					file.POST("broken/list", controllers.AdminListBrokenFile)
+					// 诊断并修复单个文件
+					file.POST("diagnose", controllers.AdminDiagnoseFile)
+					// 按存储类型统计文件用量
+					file.GET("storage_class", controllers.AdminStorageClassUsage)
+					// 列出已隔离的文件
+					file.POST("quarantine/list", controllers.AdminListQuarantinedFile)
+					// 解除文件隔离
+					file.POST("quarantine/release", controllers.AdminReleaseQuarantinedFile)
+					// 永久删除已隔离的文件
+					file.POST("quarantine/delete", controllers.AdminDeleteQuarantinedFile)
+					// 列出待审核的文件
+					file.POST("approval/list", controllers.AdminListPendingApprovalFile)
+					// 审核通过
+					file.POST("approval/approve", controllers.AdminApproveFile)
+					// 拒绝并删除待审核的文件
+					file.POST("approval/reject", controllers.AdminRejectFile)
+					// 设定目录上传是否需要审核
+					file.POST("approval/folder", controllers.AdminSetFolderApproval)
 					// 列出用户或外部文件系统目录
 					file.GET("folders/:type/:id/*path",
 						controllers.AdminListFolders)
@@ -486,6 +529,20 @@ func InitMasterRouter() *gin.Engine {
 					task.POST("delete", controllers.AdminDeleteTask)
 					// 新建文件导入任务
 					task.POST("import", controllers.AdminCreateImportTask)
+					// 新建存储策略迁移任务
+					task.POST("migrate", controllers.AdminCreateMigrateTask)
+					// 中止存储策略迁移任务
+					task.POST("migrate/abort", controllers.AdminAbortMigrateTask)
+				}
+
+				hookRetry := admin.Group("hook_retry")
+				{
+					// 列出上传后处理重试队列
+					hookRetry.POST("list", controllers.AdminListHookRetry)
+					// 立即重试
+					hookRetry.POST("requeue", controllers.AdminRequeueHookRetry)
+					// 删除
+					hookRetry.POST("delete", controllers.AdminDeleteHookRetry)
 				}
 
 				node := admin.Group("node")
@@ -515,6 +572,8 @@ func InitMasterRouter() *gin.Engine {
 				user.GET("storage", controllers.UserStorage)
 				// 退出登录
 				user.DELETE("session", controllers.UserSignOut)
+				// 结束管理员对当前用户的模拟
+				user.DELETE("impersonation", controllers.StopImpersonation)
 
 				// WebAuthn 注册相关
 				authn := user.Group("authn",
@@ -529,6 +588,10 @@ func InitMasterRouter() *gin.Engine {
 				{
 					// 任务队列
 					setting.GET("tasks", controllers.UserTasks)
+					// 站内通知
+					setting.GET("notifications", controllers.UserNotifications)
+					// 将站内通知标记为已读
+					setting.PATCH("notifications", controllers.MarkNotificationsRead)
 					// 获取当前用户设定
 					setting.GET("", controllers.UserSetting)
 					// 从文件上传头像
@@ -549,7 +612,9 @@ func InitMasterRouter() *gin.Engine {
 				upload := file.Group("upload")
 				{
 					// 文件上传
-					upload.POST(":sessionId/:index", controllers.FileUpload)
+					upload.POST(":sessionId/:index", uploadLimit, controllers.FileUpload)
+					// 单次请求上传多个文件
+					upload.POST("batch", uploadLimit, controllers.BatchUpload)
 					// 创建上传会话
 					upload.PUT("", controllers.GetUploadSession)
 					// 删除给定上传会话
@@ -558,19 +623,39 @@ func InitMasterRouter() *gin.Engine {
 					upload.DELETE("", controllers.DeleteAllUploadSession)
 				}
 				// 更新文件
-				file.PUT("update/:id", controllers.PutContent)
+				file.PUT("update/:id", uploadLimit, controllers.PutContent)
 				// 创建空白文件
 				file.POST("create", controllers.CreateFile)
+				// 从远程URL上传文件
+				file.POST("fetch", controllers.UploadFromURL)
+				// 获取远程URL上传任务状态
+				file.GET("fetch/:task", controllers.GetURLUploadTask)
 				// 创建文件下载会话
 				file.PUT("download/:id", controllers.CreateDownloadSession)
+				// 对归档文件发起解冻
+				file.POST("restore/:id", controllers.RestoreArchivedFile)
+				// 列出回收站中的文件
+				file.GET("trash", controllers.ListTrash)
+				// 恢复回收站中的文件
+				file.POST("trash/restore/:id", controllers.RestoreTrashedFile)
+				// 设定文件下载密码
+				file.PUT("password/:id", controllers.SetFilePassword)
+				// 使用下载密码解锁文件
+				file.POST("unlock/:id", controllers.UnlockFile)
 				// 预览文件
 				file.GET("preview/:id", middleware.Sandbox(), controllers.Preview)
+				// 获取视频的 HLS 播放列表或分段
+				file.GET("hls/:id/:name", controllers.HLS)
 				// 获取文本文件内容
 				file.GET("content/:id", middleware.Sandbox(), controllers.PreviewText)
 				// 取得Office文档预览地址
 				file.GET("doc/:id", controllers.GetDocPreview)
 				// 获取缩略图
 				file.GET("thumb/:id", controllers.Thumb)
+				// 预生成目录下图像的缩略图
+				file.POST("thumbs/warm", controllers.WarmFolderThumbs)
+				// 获取缩略图预生成任务状态
+				file.GET("thumbs/warm/:task", controllers.GetFolderThumbWarmTask)
 				// 取得文件外链
 				file.POST("source", controllers.GetSource)
 				// 打包要下载的文件
@@ -581,8 +666,12 @@ func InitMasterRouter() *gin.Engine {
 				file.POST("decompress", controllers.Decompress)
 				// 创建文件解压缩任务
 				file.GET("search/:type/:keywords", controllers.SearchFile)
+				// 查找相似图像
+				file.GET("similar/:id", controllers.SearchSimilarImages)
 
 				file.POST("md5_search", controllers.OtherSearchFile)
+				// 导出目录校验清单
+				file.GET("manifest/*path", controllers.ExportFolderManifest)
 
 			}
 
@@ -608,6 +697,20 @@ func InitMasterRouter() *gin.Engine {
 			{
 				// 创建目录
 				directory.PUT("", controllers.CreateDirectory)
+				// 设定目录中上传文件的默认权限
+				directory.PUT("permission", controllers.SetFolderPermission)
+				// 设定目录允许存放的文件类型
+				directory.PUT("types", controllers.SetFolderAllowedTypes)
+				// 设定目录中上传文件重名时的处理方式
+				directory.PUT("collision", controllers.SetFolderCollisionPolicy)
+				// 设定目录文件保留期
+				directory.PUT("retention", controllers.SetFolderRetention)
+				// 设定上传至目录的文件必须提供的元数据
+				directory.PUT("metadata", controllers.SetFolderRequiredMetadata)
+				// 设定是否拒绝上传与目录中已有文件内容相同的文件
+				directory.PUT("unique", controllers.SetFolderUniqueContent)
+				// 设定目录封面
+				directory.PUT("cover", controllers.SetFolderCover)
 				// 列出目录下内容
 				directory.GET("*path", controllers.ListDirectory)
 
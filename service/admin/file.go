@@ -2,14 +2,17 @@ package admin
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/cloudreve/Cloudreve/v3/service/explorer"
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
 // FileService 文件ID服务
@@ -23,6 +26,35 @@ type FileBatchService struct {
 	Force bool   `json:"force"`
 }
 
+// QuarantineBatchService 隔离文件批量操作服务
+type QuarantineBatchService struct {
+	ID []uint `json:"id" binding:"min=1"`
+}
+
+// ApprovalBatchService 待审核文件批量操作服务
+type ApprovalBatchService struct {
+	ID     []uint `json:"id" binding:"min=1"`
+	Reason string `json:"reason" binding:"max=1024"` // 拒绝的原因，会发送给文件所有者
+}
+
+// FolderApprovalService 目录上传审核设定服务
+type FolderApprovalService struct {
+	ID       uint `json:"id" binding:"required"`
+	Required bool `json:"required"`
+}
+
+// ThumbResetService 缩略图状态重置服务
+type ThumbResetService struct {
+	ID []uint `json:"id"`
+}
+
+// FileDiagnoseService 单文件一致性诊断服务
+type FileDiagnoseService struct {
+	ID         uint   `json:"id" binding:"required"`
+	VerifyHash bool   `json:"verify_hash"`
+	Action     string `json:"action" binding:"omitempty,eq=fix_size|eq=mark_broken|eq=delete_record"`
+}
+
 // ListFolderService 列目录结构
 type ListFolderService struct {
 	Path string `uri:"path" binding:"required,max=65535"`
@@ -100,6 +132,12 @@ func (service *FileBatchService) Delete(c *gin.Context) serializer.Response {
 		userFile[files[i].UserID] = append(userFile[files[i].UserID], files[i])
 	}
 
+	// 有权忽略保留期的管理员可删除保留期内的文件
+	ctx := context.Background()
+	if admin, ok := c.Get("user"); ok {
+		ctx = context.WithValue(ctx, fsctx.RetentionBypassCtx, admin)
+	}
+
 	// 异步执行删除
 	go func(files map[uint][]model.File) {
 		for uid, file := range files {
@@ -121,7 +159,9 @@ func (service *FileBatchService) Delete(c *gin.Context) serializer.Response {
 			}
 
 			// 执行删除
-			fs.Delete(context.Background(), []uint{}, ids, service.Force)
+			if err := fs.Delete(ctx, []uint{}, ids, service.Force); err != nil {
+				util.Log().Warning("Failed to delete files of user #%d: %s", uid, err)
+			}
 			fs.Recycle()
 		}
 	}(userFile)
@@ -131,10 +171,51 @@ func (service *FileBatchService) Delete(c *gin.Context) serializer.Response {
 
 }
 
+// Reset 将缩略图生成失败的文件重置为待生成状态，以便修复生成环境后重试
+func (service *ThumbResetService) Reset(c *gin.Context) serializer.Response {
+	count, err := model.ResetFailedThumbStatus(service.ID)
+	if err != nil {
+		return serializer.DBErr("Failed to reset thumbnail status", err)
+	}
+
+	return serializer.Response{Data: count}
+}
+
+// Diagnose 核对文件记录与存储端对象，返回诊断报告，指定了修复操作时一并执行
+func (service *FileDiagnoseService) Diagnose(c *gin.Context) serializer.Response {
+	files, err := model.GetFilesByIDs([]uint{service.ID}, 0)
+	if err != nil || len(files) == 0 {
+		return serializer.Err(serializer.CodeFileNotFound, "", err)
+	}
+
+	fs, err := filesystem.NewAnonymousFileSystem()
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	report, err := fs.DiagnoseFile(c.Request.Context(), &files[0], service.VerifyHash)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+	}
+
+	if service.Action != "" {
+		if err := fs.RepairFile(c.Request.Context(), &files[0], report, service.Action); err != nil {
+			return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+		}
+	}
+
+	return serializer.Response{Data: report}
+}
+
 // Get 预览文件
 func (service *FileService) Get(c *gin.Context) serializer.Response {
 	file, err := model.GetFilesByIDs([]uint{service.ID}, 0)
-	if err != nil {
+	if err == nil && len(file) == 0 {
+		// 已隔离的文件仅管理员可预览
+		file, err = model.GetQuarantinedFilesByIDs([]uint{service.ID})
+	}
+	if err != nil || len(file) == 0 {
 		return serializer.Err(serializer.CodeFileNotFound, "", err)
 	}
 
@@ -147,10 +228,38 @@ func (service *FileService) Get(c *gin.Context) serializer.Response {
 
 // Files 列出文件
 func (service *AdminListService) Files() serializer.Response {
+	return service.listFiles(model.DB.Model(&model.File{}))
+}
+
+// StorageClassUsage 按存储策略和存储类型统计文件数量及容量，用于估算存储成本
+func (service *NoParamService) StorageClassUsage() serializer.Response {
+	usage, err := model.GetStorageClassUsage()
+	if err != nil {
+		return serializer.DBErr("Failed to count storage class usage", err)
+	}
+
+	return serializer.Response{Data: usage}
+}
+
+// BrokenFiles 列出存储端对象已丢失的文件
+func (service *AdminListService) BrokenFiles() serializer.Response {
+	return service.listFiles(model.DB.Model(&model.File{}).Where("source_broken = ?", true))
+}
+
+// QuarantinedFiles 列出已隔离的文件
+func (service *AdminListService) QuarantinedFiles() serializer.Response {
+	return service.listFiles(model.DB.Model(&model.File{}).Where("quarantined_at is not NULL"))
+}
+
+// PendingApprovalFiles 列出待审核的文件
+func (service *AdminListService) PendingApprovalFiles() serializer.Response {
+	return service.listFiles(model.DB.Model(&model.File{}).Where("pending_approval is not NULL"))
+}
+
+func (service *AdminListService) listFiles(tx *gorm.DB) serializer.Response {
 	var res []model.File
 	total := 0
 
-	tx := model.DB.Model(&model.File{})
 	if service.OrderBy != "" {
 		tx = tx.Order(service.OrderBy)
 	}
@@ -198,3 +307,188 @@ func (service *AdminListService) Files() serializer.Response {
 		"users": users,
 	}}
 }
+
+// groupQuarantinedFiles 查找已隔离的文件并按所有者分组
+func (service *QuarantineBatchService) groupQuarantinedFiles() (map[uint][]model.File, error) {
+	files, err := model.GetQuarantinedFilesByIDs(service.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	userFile := make(map[uint][]model.File)
+	for _, file := range files {
+		userFile[file.UserID] = append(userFile[file.UserID], file)
+	}
+
+	return userFile, nil
+}
+
+// Release 解除文件隔离，将文件恢复至所有者的原目录
+func (service *QuarantineBatchService) Release(c *gin.Context) serializer.Response {
+	userFile, err := service.groupQuarantinedFiles()
+	if err != nil {
+		return serializer.DBErr("Failed to list quarantined files", err)
+	}
+
+	var lastErr error
+	released := 0
+	for uid, files := range userFile {
+		user, err := model.GetUserByID(uid)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		fs, err := filesystem.NewFileSystem(&user)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for i := range files {
+			if err := fs.ReleaseQuarantinedFile(context.Background(), &files[i]); err != nil {
+				util.Log().Warning("Failed to release quarantined file #%d: %s", files[i].ID, err)
+				lastErr = err
+				continue
+			}
+			released++
+		}
+		fs.Recycle()
+	}
+
+	if lastErr != nil {
+		return serializer.Err(serializer.CodeNotFullySuccess, fmt.Sprintf("Released %d file(s)", released), lastErr)
+	}
+
+	return serializer.Response{Data: released}
+}
+
+// Delete 永久删除已隔离的文件
+func (service *QuarantineBatchService) Delete(c *gin.Context) serializer.Response {
+	userFile, err := service.groupQuarantinedFiles()
+	if err != nil {
+		return serializer.DBErr("Failed to list quarantined files", err)
+	}
+
+	var lastErr error
+	for uid, files := range userFile {
+		user, err := model.GetUserByID(uid)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		fs, err := filesystem.NewFileSystem(&user)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if err := fs.DeleteQuarantinedFiles(context.Background(), files); err != nil {
+			util.Log().Warning("Failed to delete quarantined files of user #%d: %s", uid, err)
+			lastErr = err
+		}
+		fs.Recycle()
+	}
+
+	if lastErr != nil {
+		return serializer.Err(serializer.CodeNotFullySuccess, "Failed to delete some quarantined files", lastErr)
+	}
+
+	return serializer.Response{}
+}
+
+// groupPendingApprovalFiles 查找待审核的文件并按所有者分组
+func (service *ApprovalBatchService) groupPendingApprovalFiles() (map[uint][]model.File, error) {
+	files, err := model.GetPendingApprovalFilesByIDs(service.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	userFile := make(map[uint][]model.File)
+	for _, file := range files {
+		userFile[file.UserID] = append(userFile[file.UserID], file)
+	}
+
+	return userFile, nil
+}
+
+// Approve 审核通过，文件恢复为普通文件
+func (service *ApprovalBatchService) Approve(c *gin.Context) serializer.Response {
+	files, err := model.GetPendingApprovalFilesByIDs(service.ID)
+	if err != nil {
+		return serializer.DBErr("Failed to list pending files", err)
+	}
+
+	var lastErr error
+	approved := 0
+	for i := range files {
+		if err := files[i].Approve(); err != nil {
+			util.Log().Warning("Failed to approve file #%d: %s", files[i].ID, err)
+			lastErr = err
+			continue
+		}
+		approved++
+	}
+
+	if lastErr != nil {
+		return serializer.Err(serializer.CodeNotFullySuccess, fmt.Sprintf("Approved %d file(s)", approved), lastErr)
+	}
+
+	return serializer.Response{Data: approved}
+}
+
+// Reject 拒绝并删除待审核的文件，将原因通知文件所有者
+func (service *ApprovalBatchService) Reject(c *gin.Context) serializer.Response {
+	userFile, err := service.groupPendingApprovalFiles()
+	if err != nil {
+		return serializer.DBErr("Failed to list pending files", err)
+	}
+
+	// 有权忽略保留期的管理员可拒绝保留期内的文件
+	ctx := context.Background()
+	if admin, ok := c.Get("user"); ok {
+		ctx = context.WithValue(ctx, fsctx.RetentionBypassCtx, admin)
+	}
+
+	var lastErr error
+	for uid, files := range userFile {
+		user, err := model.GetUserByID(uid)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		fs, err := filesystem.NewFileSystem(&user)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if err := fs.RejectPendingFiles(ctx, files, service.Reason); err != nil {
+			util.Log().Warning("Failed to reject pending files of user #%d: %s", uid, err)
+			lastErr = err
+		}
+		fs.Recycle()
+	}
+
+	if lastErr != nil {
+		return serializer.Err(serializer.CodeNotFullySuccess, "Failed to reject some pending files", lastErr)
+	}
+
+	return serializer.Response{}
+}
+
+// Set 设定上传至目录的文件是否需经审核
+func (service *FolderApprovalService) Set() serializer.Response {
+	var folder model.Folder
+	if err := model.DB.First(&folder, service.ID).Error; err != nil {
+		return serializer.Err(serializer.CodeNotFound, "", err)
+	}
+
+	if err := folder.SetRequireApproval(service.Required); err != nil {
+		return serializer.DBErr("Failed to update folder", err)
+	}
+
+	return serializer.Response{}
+}
@@ -265,6 +265,10 @@ func (service *AddPolicyService) Add() serializer.Response {
 		service.Policy.DirNameRule = strings.TrimPrefix(service.Policy.DirNameRule, "/")
 	}
 
+	if _, err := service.Policy.OutboundProxyURL(); err != nil {
+		return serializer.ParamErr(err.Error(), err)
+	}
+
 	if service.Policy.ID > 0 {
 		if err := model.DB.Save(&service.Policy).Error; err != nil {
 			return serializer.DBErr("Failed to save policy", err)
@@ -327,8 +331,9 @@ func (service *AdminListService) Policies() serializer.Response {
 	}
 
 	return serializer.Response{Data: map[string]interface{}{
-		"total":   total,
-		"items":   res,
-		"statics": statics,
+		"total":       total,
+		"items":       res,
+		"statics":     statics,
+		"concurrency": request.PolicyConcurrencyStats(),
 	}}
 }
@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"strings"
+
+	model "github.com/cloudreve/Cloudreve/v3/models"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/gin-gonic/gin"
+)
+
+// HookRetryBatchService 上传后处理重试记录批量操作服务
+type HookRetryBatchService struct {
+	ID []uint `json:"id" binding:"min=1"`
+}
+
+// Requeue 立即重试，死信将重新开始计数
+func (service *HookRetryBatchService) Requeue(c *gin.Context) serializer.Response {
+	if err := model.RequeueHookRetries(service.ID); err != nil {
+		return serializer.DBErr("Failed to update retry records", err)
+	}
+	return serializer.Response{}
+}
+
+// Delete 删除重试记录
+func (service *HookRetryBatchService) Delete(c *gin.Context) serializer.Response {
+	if err := model.DeleteHookRetries(service.ID); err != nil {
+		return serializer.DBErr("Failed to delete retry records", err)
+	}
+	return serializer.Response{}
+}
+
+// HookRetries 列出上传后处理重试队列，以 dead 条件筛选死信
+func (service *AdminListService) HookRetries() serializer.Response {
+	var res []model.HookRetry
+	total := 0
+
+	tx := model.DB.Model(&model.HookRetry{})
+	if service.OrderBy != "" {
+		tx = tx.Order(service.OrderBy)
+	}
+
+	for k, v := range service.Conditions {
+		tx = tx.Where(k+" = ?", v)
+	}
+
+	if len(service.Searches) > 0 {
+		search := ""
+		for k, v := range service.Searches {
+			search += k + " like '%" + v + "%' OR "
+		}
+		search = strings.TrimSuffix(search, " OR ")
+		tx = tx.Where(search)
+	}
+
+	// 计算总数用于分页
+	tx.Count(&total)
+
+	// 查询记录
+	tx.Limit(service.PageSize).Offset((service.Page - 1) * service.PageSize).Find(&res)
+
+	// 查询对应文件及用户
+	fileIDs := make([]uint, 0, len(res))
+	users := make(map[uint]model.User)
+	for _, record := range res {
+		fileIDs = append(fileIDs, record.FileID)
+		users[record.UserID] = model.User{}
+	}
+
+	files := make(map[uint]model.File)
+	var fileList []model.File
+	model.DB.Where("id in (?)", fileIDs).Find(&fileList)
+	for _, v := range fileList {
+		files[v.ID] = v
+	}
+
+	userIDs := make([]uint, 0, len(users))
+	for k := range users {
+		userIDs = append(userIDs, k)
+	}
+
+	var userList []model.User
+	model.DB.Where("id in (?)", userIDs).Find(&userList)
+
+	for _, v := range userList {
+		users[v.ID] = v
+	}
+
+	return serializer.Response{Data: map[string]interface{}{
+		"total": total,
+		"items": res,
+		"files": files,
+		"users": users,
+	}}
+}
@@ -34,6 +34,52 @@ func (service *ImportTaskService) Create(c *gin.Context, user *model.User) seria
 	return serializer.Response{}
 }
 
+// MigrateTaskService 存储策略迁移任务
+type MigrateTaskService struct {
+	SrcPolicyID uint `json:"src_policy_id" binding:"required"`
+	DstPolicyID uint `json:"dst_policy_id" binding:"required,nefield=SrcPolicyID"`
+	UserID      uint `json:"user_id"`
+	FolderID    uint `json:"folder_id"`
+	SpeedLimit  int  `json:"speed_limit" binding:"min=0"`
+	Concurrency int  `json:"concurrency" binding:"min=0,max=64"`
+}
+
+// Create 新建存储策略迁移任务
+func (service *MigrateTaskService) Create(c *gin.Context, user *model.User) serializer.Response {
+	for _, id := range []uint{service.SrcPolicyID, service.DstPolicyID} {
+		if _, err := model.GetPolicyByID(id); err != nil {
+			return serializer.Err(serializer.CodePolicyNotExist, "", err)
+		}
+	}
+
+	// 创建任务
+	job, err := task.NewMigrateTask(user.ID, task.MigrateProps{
+		SrcPolicyID: service.SrcPolicyID,
+		DstPolicyID: service.DstPolicyID,
+		UserID:      service.UserID,
+		FolderID:    service.FolderID,
+		SpeedLimit:  service.SpeedLimit,
+		Concurrency: service.Concurrency,
+	})
+	if err != nil {
+		return serializer.DBErr("Failed to create task record.", err)
+	}
+	task.TaskPoll.Submit(job)
+	return serializer.Response{}
+}
+
+// AbortMigrate 中止存储策略迁移任务，进行中的文件完成迁移后任务停止
+func (service *TaskBatchService) AbortMigrate(c *gin.Context) serializer.Response {
+	aborted := make([]uint, 0, len(service.ID))
+	for _, id := range service.ID {
+		if task.AbortMigrateTask(id) {
+			aborted = append(aborted, id)
+		}
+	}
+
+	return serializer.Response{Data: aborted}
+}
+
 // Delete 删除任务
 func (service *TaskBatchService) Delete(c *gin.Context) serializer.Response {
 	if err := model.DB.Where("id in (?)", service.ID).Delete(&model.Download{}).Error; err != nil {
@@ -3,10 +3,14 @@ package admin
 import (
 	"context"
 	"strings"
+	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
 )
 
 // AddUserService 用户添加服务
@@ -25,6 +29,54 @@ type UserBatchService struct {
 	ID []uint `json:"id" binding:"min=1"`
 }
 
+// UserImpersonateService 模拟用户服务
+type UserImpersonateService struct {
+	ID     uint   `json:"id" binding:"required"`
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// Start 在当前管理员会话中模拟用户，有效期内的请求均以该用户的身份和权限执行
+func (service *UserImpersonateService) Start(c *gin.Context, admin *model.User) serializer.Response {
+	target, err := model.GetActiveUserByID(service.ID)
+	if err != nil {
+		return serializer.Err(serializer.CodeUserNotFound, "", err)
+	}
+
+	if !admin.CanImpersonate(&target) {
+		return serializer.Err(serializer.CodeNoPermissionErr, "You are not allowed to impersonate this user", nil)
+	}
+
+	expires := time.Now().Add(time.Duration(model.GetIntSetting("impersonation_ttl", 1800)) * time.Second)
+	util.SetSession(c, map[string]interface{}{
+		"impersonate_uid":     target.ID,
+		"impersonate_admin":   admin.ID,
+		"impersonate_expires": expires.Unix(),
+	})
+	util.Log().Info("[Audit] Admin %q (#%d) started acting as user %q (#%d) until %s, reason: %s",
+		admin.Email, admin.ID, target.Email, target.ID, expires.Format(time.RFC3339), service.Reason)
+
+	return serializer.Response{Data: expires}
+}
+
+// StopImpersonation 结束当前会话中管理员对用户的模拟
+func (service *NoParamService) StopImpersonation(c *gin.Context, user *model.User) serializer.Response {
+	admin, ok := c.Get("impersonator")
+	if !ok {
+		return serializer.Err(serializer.CodeNoPermissionErr, "Not in impersonation", nil)
+	}
+
+	session := sessions.Default(c)
+	session.Delete("impersonate_uid")
+	session.Delete("impersonate_admin")
+	session.Delete("impersonate_expires")
+	if err := session.Save(); err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "Failed to clear impersonation", err)
+	}
+
+	util.Log().Info("[Audit] Admin #%d stopped acting as user %q (#%d).", admin.(*model.User).ID, user.Email, user.ID)
+	return serializer.Response{}
+}
+
 // Ban 封禁/解封用户
 func (service *UserService) Ban() serializer.Response {
 	user, err := model.GetUserByID(service.ID)
@@ -102,6 +154,7 @@ func (service *AddUserService) Add() serializer.Response {
 		user, _ := model.GetUserByID(service.User.ID)
 		if service.Password != "" {
 			user.SetPassword(service.Password)
+			user.SessionEpoch++
 		}
 
 		// 只更新必要字段
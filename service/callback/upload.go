@@ -2,16 +2,20 @@ package callback
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"strings"
 
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/cos"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/onedrive"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/driver/s3"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/task"
+	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/gin-gonic/gin"
 )
 
@@ -125,6 +129,13 @@ func ProcessCallback(service CallbackProcessService, c *gin.Context) serializer.
 		return serializer.Err(serializer.CodeUploadSessionExpired, "LocalUpload session file placeholder not exist", err)
 	}
 
+	// 从机扫描发现病毒时，丢弃占位文件及已上传的内容
+	if callbackBody.Infected {
+		util.Log().Warning("Upload %q of user %q rejected by slave, threat detected: %s", file.Name, fs.User.Email, callbackBody.Threat)
+		fs.DiscardCorruptedUpload(context.Background(), file)
+		return serializer.Response{}
+	}
+
 	fileData := fsctx.FileStream{
 		Size:         uploadSession.Size,
 		Name:         uploadSession.Name,
@@ -141,16 +152,51 @@ func ProcessCallback(service CallbackProcessService, c *gin.Context) serializer.
 		fs.Use("AfterUpload", filesystem.HookChunkUploaded)
 	}
 
+	fs.Use("AfterUpload", filesystem.HookVerifyChecksum(uploadSession.MD5))
+	fs.Use("AfterUpload", filesystem.HookValidateUniqueContent)
+	fs.Use("AfterUpload", filesystem.HookContentAddress)
 	fs.Use("AfterUpload", filesystem.HookPopPlaceholderToFile(callbackBody.PicInfo))
+	fs.Use("AfterUpload", filesystem.HookApplyUploadPermission(uploadSession.Permission))
+	fs.Use("AfterUpload", filesystem.HookRequireApproval)
+	fs.Use("AfterUpload", filesystem.HookUpdateFolderCover)
+	fs.Use("AfterUpload", filesystem.HookGenerateRemoteThumb)
+	fs.Use("AfterUpload", task.HookTranscodeVideo)
+	fs.Use("AfterUpload", task.HookGenerateDocPreview)
+	fs.Use("AfterUpload", task.HookGenerateHLS)
 	fs.Use("AfterValidateFailed", filesystem.HookDeleteTempFile)
 	err = fs.Upload(context.Background(), &fileData)
 	if err != nil {
+		if filesystem.ShouldDiscardUpload(err) {
+			fs.DiscardCorruptedUpload(context.Background(), file)
+		}
 		return serializer.Err(serializer.CodeUploadFailed, err.Error(), err)
 	}
 
+	if err := filesystem.MarkUploadSessionDone(uploadSession); err != nil {
+		util.Log().Warning("Failed to mark upload session %q as done: %s", uploadSession.Key, err)
+	}
+
 	return serializer.Response{}
 }
 
+// restoreUploadSession 将上传会话放回缓存，失败时仅记录日志
+func restoreUploadSession(uploadSession *serializer.UploadSession) {
+	if err := filesystem.RestoreUploadSession(uploadSession); err != nil {
+		util.Log().Debug("Cannot restore upload session %q: %s", uploadSession.Key, err)
+	}
+}
+
+// discardUploadPlaceholder 上传无法完成时删除上传会话创建的占位文件
+func discardUploadPlaceholder(fs *filesystem.FileSystem, uploadSession *serializer.UploadSession) {
+	file, err := model.GetFilesByUploadSession(uploadSession.Key, fs.User.ID)
+	if err != nil {
+		util.Log().Debug("Placeholder of upload session %q not found: %s", uploadSession.Key, err)
+		return
+	}
+
+	fs.DiscardCorruptedUpload(context.Background(), file)
+}
+
 // PreProcess 对OneDrive客户端回调进行预处理验证
 func (service *OneDriveCallback) PreProcess(c *gin.Context) serializer.Response {
 	// 创建文件系统
@@ -202,6 +248,8 @@ func (service *COSCallback) PreProcess(c *gin.Context) serializer.Response {
 	// 获取文件信息
 	info, err := fs.Handler.(cos.Driver).Meta(context.Background(), uploadSession.SavePath)
 	if err != nil {
+		// 对象可能尚未在存储端可见，保留会话以便稍后重试回调
+		restoreUploadSession(uploadSession)
 		return serializer.Err(serializer.CodeMetaMismatch, "", err)
 	}
 
@@ -226,9 +274,25 @@ func (service *S3Callback) PreProcess(c *gin.Context) serializer.Response {
 	uploadSession := c.MustGet(filesystem.UploadSessionCtx).(*serializer.UploadSession)
 
 	// 获取文件信息
-	info, err := fs.Handler.(*s3.Driver).Meta(context.Background(), uploadSession.SavePath)
+	handler := fs.Handler.(*s3.Driver)
+	info, err := handler.Meta(context.Background(), uploadSession.SavePath)
 	if err != nil {
-		return serializer.Err(serializer.CodeMetaMismatch, "", err)
+		// 客户端完成分片上传的请求可能失败或响应丢失，由服务端重试完成
+		if err := handler.CompleteMultipart(context.Background(), uploadSession); err != nil {
+			if errors.Is(err, driver.ErrMultipartAborted) {
+				discardUploadPlaceholder(fs, uploadSession)
+				return serializer.Err(serializer.CodeUploadFailed, "", err)
+			}
+
+			// 保留会话及已记录的分片，以便稍后（包括服务重启后）重试回调
+			restoreUploadSession(uploadSession)
+			return serializer.Err(serializer.CodeMetaMismatch, "", err)
+		}
+
+		if info, err = handler.Meta(context.Background(), uploadSession.SavePath); err != nil {
+			restoreUploadSession(uploadSession)
+			return serializer.Err(serializer.CodeMetaMismatch, "", err)
+		}
 	}
 
 	// 验证实际文件信息与回调会话中是否一致
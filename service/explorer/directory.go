@@ -2,10 +2,15 @@ package explorer
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 
+	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/hashid"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/task"
 	"github.com/gin-gonic/gin"
 )
 
@@ -14,6 +19,329 @@ type DirectoryService struct {
 	Path string `uri:"path" json:"path" binding:"required,min=1,max=65535"`
 }
 
+// FolderPermissionService 目录默认权限设定服务
+type FolderPermissionService struct {
+	Path       string `json:"path" binding:"required,min=1,max=65535"`
+	Permission string `json:"permission" binding:"omitempty,oneof=private public"`
+}
+
+// Set 设定上传至目录的文件的默认权限，Permission 为空时使用全局设置
+func (service *FolderPermissionService) Set(c *gin.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	exist, folder := fs.IsPathExist(service.Path)
+	if !exist {
+		return serializer.Err(serializer.CodeParentNotExist, "", nil)
+	}
+
+	if service.Permission == model.FilePermissionPublic && !fs.User.Group.ShareEnabled {
+		return serializer.Err(serializer.CodeGroupNotAllowed, "", nil)
+	}
+
+	if err := folder.SetDefaultPermission(service.Permission); err != nil {
+		return serializer.DBErr("Failed to update folder permission", err)
+	}
+
+	return serializer.Response{}
+}
+
+// FolderAllowedTypesService 目录允许存放的文件类型设定服务
+type FolderAllowedTypesService struct {
+	Path  string `json:"path" binding:"required,min=1,max=65535"`
+	Types string `json:"types" binding:"max=65535"`
+}
+
+// Set 设定允许存放在目录中的文件类型，Types 为空时不限制
+func (service *FolderAllowedTypesService) Set(c *gin.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	exist, folder := fs.IsPathExist(service.Path)
+	if !exist {
+		return serializer.Err(serializer.CodeParentNotExist, "", nil)
+	}
+
+	if err := folder.SetAllowedTypes(strings.TrimSpace(service.Types)); err != nil {
+		return serializer.DBErr("Failed to update folder allowed types", err)
+	}
+
+	return serializer.Response{}
+}
+
+// FolderCollisionPolicyService 目录重名处理方式设定服务
+type FolderCollisionPolicyService struct {
+	Path   string `json:"path" binding:"required,min=1,max=65535"`
+	Policy string `json:"policy" binding:"omitempty,oneof=error overwrite version rename"`
+}
+
+// Set 设定上传文件与目录中已有文件重名时的处理方式，Policy 为空时继承上级目录或全局设置
+func (service *FolderCollisionPolicyService) Set(c *gin.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	exist, folder := fs.IsPathExist(service.Path)
+	if !exist {
+		return serializer.Err(serializer.CodeParentNotExist, "", nil)
+	}
+
+	if err := folder.SetCollisionPolicy(service.Policy); err != nil {
+		return serializer.DBErr("Failed to update folder collision policy", err)
+	}
+
+	return serializer.Response{}
+}
+
+// FolderRetentionService 目录文件保留期设定服务
+type FolderRetentionService struct {
+	Path string `json:"path" binding:"required,min=1,max=65535"`
+	Days int    `json:"days" binding:"min=0,max=36500"`
+}
+
+// Set 设定此后上传至目录的文件的保留天数，已上传文件的保留期不受影响
+func (service *FolderRetentionService) Set(c *gin.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	exist, folder := fs.IsPathExist(service.Path)
+	if !exist {
+		return serializer.Err(serializer.CodeParentNotExist, "", nil)
+	}
+
+	if err := folder.SetRetentionDays(service.Days); err != nil {
+		return serializer.DBErr("Failed to update folder retention", err)
+	}
+
+	return serializer.Response{}
+}
+
+// FolderRequiredMetadataService 目录必需元数据设定服务
+type FolderRequiredMetadataService struct {
+	Path string `json:"path" binding:"required,min=1,max=65535"`
+	Keys string `json:"keys" binding:"max=65535"`
+}
+
+// Set 设定此后上传至目录的文件必须提供的元数据键，以逗号分隔，为空时不要求
+func (service *FolderRequiredMetadataService) Set(c *gin.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	exist, folder := fs.IsPathExist(service.Path)
+	if !exist {
+		return serializer.Err(serializer.CodeParentNotExist, "", nil)
+	}
+
+	// 去除空白及重复的键
+	keys := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(service.Keys, ",") {
+		if key = strings.TrimSpace(key); key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if err := folder.SetRequiredMetadata(strings.Join(keys, ",")); err != nil {
+		return serializer.DBErr("Failed to update folder required metadata", err)
+	}
+
+	return serializer.Response{}
+}
+
+// FolderUniqueContentService 目录内容唯一设定服务
+type FolderUniqueContentService struct {
+	Path   string `json:"path" binding:"required,min=1,max=65535"`
+	Unique bool   `json:"unique"`
+}
+
+// Set 设定是否拒绝上传与目录中已有文件内容相同的文件，不影响目录中已有的文件
+func (service *FolderUniqueContentService) Set(c *gin.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	exist, folder := fs.IsPathExist(service.Path)
+	if !exist {
+		return serializer.Err(serializer.CodeParentNotExist, "", nil)
+	}
+
+	if err := folder.SetUniqueContent(service.Unique); err != nil {
+		return serializer.DBErr("Failed to update folder unique content setting", err)
+	}
+
+	return serializer.Response{}
+}
+
+// FolderCoverService 目录封面设定服务
+type FolderCoverService struct {
+	Path string `json:"path" binding:"required,min=1,max=65535"`
+	File string `json:"file"`
+}
+
+// Set 将目录中的图像手动指定为封面，File 为空时恢复为自动选择
+func (service *FolderCoverService) Set(c *gin.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	exist, folder := fs.IsPathExist(service.Path)
+	if !exist {
+		return serializer.Err(serializer.CodeParentNotExist, "", nil)
+	}
+
+	if service.File == "" {
+		if err := filesystem.RefreshFolderCover(folder); err != nil {
+			return serializer.DBErr("Failed to update folder cover", err)
+		}
+		return serializer.Response{}
+	}
+
+	id, err := hashid.DecodeHashID(service.File, hashid.FileID)
+	if err != nil {
+		return serializer.ParamErr("Failed to parse file ID", err)
+	}
+
+	files, err := model.GetFilesByIDs([]uint{id}, fs.User.ID)
+	if err != nil || len(files) == 0 || files[0].FolderID != folder.ID {
+		return serializer.Err(serializer.CodeFileNotFound, "", err)
+	}
+
+	if !filesystem.IsFolderCoverCandidate(files[0].Name) {
+		return serializer.ParamErr("Only images can be used as folder cover", nil)
+	}
+
+	if err := folder.SetCover(&id, true); err != nil {
+		return serializer.DBErr("Failed to update folder cover", err)
+	}
+
+	return serializer.Response{}
+}
+
+// FolderThumbWarmService 目录缩略图预生成服务
+type FolderThumbWarmService struct {
+	ID string `json:"id" binding:"required"`
+}
+
+// Create 创建为目录下图像预先生成缩略图的任务，立即返回任务ID
+func (service *FolderThumbWarmService) Create(c *gin.Context, user *model.User) serializer.Response {
+	id, err := hashid.DecodeHashID(service.ID, hashid.FolderID)
+	if err != nil {
+		return serializer.ParamErr("Failed to parse folder ID", err)
+	}
+
+	if folders, err := model.GetFoldersByIDs([]uint{id}, user.ID); err != nil || len(folders) == 0 {
+		return serializer.Err(serializer.CodeParentNotExist, "", err)
+	}
+
+	job, err := task.NewThumbWarmTask(user, id)
+	if err != nil {
+		return serializer.DBErr("Failed to create task record.", err)
+	}
+	task.TaskPoll.Submit(job)
+
+	return serializer.Response{Data: hashid.HashID(job.Model().ID, hashid.TaskID)}
+}
+
+// FolderThumbWarmTaskService 目录缩略图预生成任务服务
+type FolderThumbWarmTaskService struct {
+	ID string `uri:"task" binding:"required"`
+}
+
+// Get 获取目录缩略图预生成任务的状态与结果
+func (service *FolderThumbWarmTaskService) Get(c *gin.Context, user *model.User) serializer.Response {
+	id, err := hashid.DecodeHashID(service.ID, hashid.TaskID)
+	if err != nil {
+		return serializer.ParamErr("Failed to parse task ID", err)
+	}
+
+	record, err := model.GetTasksByID(id)
+	if err != nil || record.UserID != user.ID || record.Type != task.ThumbWarmTaskType {
+		return serializer.Err(serializer.CodeNotFound, "Task not exist", err)
+	}
+
+	var props task.ThumbWarmProps
+	if err := json.Unmarshal([]byte(record.Props), &props); err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "Failed to parse task props", err)
+	}
+
+	return serializer.Response{Data: map[string]interface{}{
+		"status":    record.Status,
+		"progress":  record.Progress,
+		"error":     record.Error,
+		"total":     props.Total,
+		"succeeded": props.Succeeded,
+		"failed":    props.Failed,
+		"skipped":   props.Skipped,
+	}}
+}
+
+// FolderManifestService 目录校验清单导出服务
+type FolderManifestService struct {
+	Path   string `uri:"path" binding:"required,min=1,max=65535"`
+	Format string `form:"format" binding:"omitempty,oneof=csv jsonl"`
+}
+
+// Export 以流的形式导出目录下所有文件的校验清单，客户端断开连接时停止导出
+func (service *FolderManifestService) Export(c *gin.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	if exist, _ := fs.IsPathExist(service.Path); !exist {
+		return serializer.Err(serializer.CodeParentNotExist, "", nil)
+	}
+
+	format := service.Format
+	if format == "" {
+		format = filesystem.ManifestFormatCSV
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"manifest.%s\"", format))
+	if format == filesystem.ManifestFormatCSV {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+
+	if err := fs.ExportManifest(c.Request.Context(), c.Writer, service.Path, format); err != nil {
+		if err == filesystem.ErrClientCanceled {
+			return serializer.Response{}
+		}
+		return serializer.Err(serializer.CodeIOFailed, "Failed to export manifest", err)
+	}
+
+	return serializer.Response{}
+}
+
 // ListDirectory 列出目录内容
 func (service *DirectoryService) ListDirectory(c *gin.Context) serializer.Response {
 	// 创建文件系统
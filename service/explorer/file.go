@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"io/ioutil"
-	"net/http"
 	"net/url"
 	"path"
 	"strconv"
@@ -41,6 +40,16 @@ type DownloadService struct {
 	ID string `uri:"id" binding:"required"`
 }
 
+// FilePasswordService 文件下载密码设定服务
+type FilePasswordService struct {
+	Password string `json:"password" binding:"max=255"`
+}
+
+// FileUnlockService 文件下载密码解锁服务
+type FileUnlockService struct {
+	Password string `json:"password" binding:"required,max=255"`
+}
+
 // ArchiveService 文件流式打包下載服务
 type ArchiveService struct {
 	ID string `uri:"sessionID" binding:"required"`
@@ -58,9 +67,19 @@ func (service *SingleFileService) Create(c *gin.Context) serializer.Response {
 	// 上下文
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	ctx = context.WithValue(ctx, fsctx.ClientIPCtx, c.ClientIP())
 
 	// 给文件系统分配钩子
 	fs.Use("BeforeUpload", filesystem.HookValidateFile)
+	fs.Use("BeforeUpload", filesystem.HookValidateUniqueName)
+	fs.Use("BeforeUpload", filesystem.HookValidateConfiguredMinFileSize)
+	if windows, loc := fs.UploadWindows(); len(windows) > 0 {
+		fs.Use("BeforeUpload", filesystem.HookValidateUploadWindow(windows, loc))
+	}
+	if filesystem.IsUploadRegionPolicyEnabled() {
+		fs.Use("BeforeUpload", filesystem.HookValidateUploadRegion)
+	}
+	fs.Use("BeforeAddFile", filesystem.HookValidateFileCount)
 	fs.Use("AfterUpload", filesystem.GenericAfterUpload)
 
 	// 上传空文件
@@ -149,14 +168,17 @@ func (service *FileAnonymousGetService) Download(ctx context.Context, c *gin.Con
 	}
 
 	// 获取文件流
-	rs, err := fs.GetDownloadContent(ctx, 0)
+	rs, err := fs.GetDownloadContent(filesystem.WithSignedAccess(filesystem.WithFileUnlock(ctx, c), c), 0)
 	defer rs.Close()
 	if err != nil {
 		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
 	}
 
 	// 发送文件
-	http.ServeContent(c.Writer, c.Request, service.Name, fs.FileTarget[0].UpdatedAt, rs)
+	filesystem.SetPolicyHeaders(c.Writer.Header(), fs.FileTarget[0].GetPolicy())
+	c.Header("ETag", filesystem.FileETag(&fs.FileTarget[0]))
+	filesystem.SetContentTypeHeader(c.Writer.Header(), &fs.FileTarget[0])
+	filesystem.ServeContent(c.Writer, c.Request, service.Name, fs.FileTarget[0].UpdatedAt, fs.FileTarget[0].Size, rs)
 
 	return serializer.Response{
 		Code: 0,
@@ -179,11 +201,12 @@ func (service *FileAnonymousGetService) Source(ctx context.Context, c *gin.Conte
 
 	// 获取文件流
 	ttl := int64(model.GetIntSetting("preview_timeout", 60))
-	res, err := fs.SignURL(ctx, &fs.FileTarget[0], ttl, false)
+	res, err := fs.SignURL(filesystem.WithFileUnlock(ctx, c), &fs.FileTarget[0], ttl, false)
 	if err != nil {
 		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
 	}
 
+	filesystem.SetPolicyHeaders(c.Writer.Header(), fs.FileTarget[0].GetPolicy())
 	c.Header("Cache-Control", fmt.Sprintf("max-age=%d", ttl))
 	return serializer.Response{
 		Code: -302,
@@ -202,6 +225,7 @@ func (service *FileIDService) CreateDocPreviewSession(ctx context.Context, c *gi
 
 	// 获取对象id
 	objectID, _ := c.Get("object_id")
+	ctx = filesystem.WithFileUnlock(ctx, c)
 
 	// 如果上下文中已有File对象，则重设目标
 	if file, ok := ctx.Value(fsctx.FileModelCtx).(*model.File); ok {
@@ -250,6 +274,7 @@ func (service *FileIDService) CreateDownloadSession(ctx context.Context, c *gin.
 
 	// 获取对象id
 	objectID, _ := c.Get("object_id")
+	ctx = filesystem.WithFileUnlock(ctx, c)
 
 	// 获取下载地址
 	downloadURL, err := fs.GetDownloadURL(ctx, objectID.(uint), "download_timeout")
@@ -281,6 +306,8 @@ func (service *DownloadService) Download(ctx context.Context, c *gin.Context) se
 
 	// 开始处理下载
 	ctx = context.WithValue(ctx, fsctx.GinCtx, c)
+	ctx = filesystem.WithFileUnlock(ctx, c)
+	ctx = filesystem.WithSignedAccess(ctx, c)
 	rs, err := fs.GetDownloadContent(ctx, 0)
 	if err != nil {
 		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
@@ -296,7 +323,10 @@ func (service *DownloadService) Download(ctx context.Context, c *gin.Context) se
 	}
 
 	// 发送文件
-	http.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, fs.FileTarget[0].UpdatedAt, rs)
+	filesystem.SetPolicyHeaders(c.Writer.Header(), fs.FileTarget[0].GetPolicy())
+	c.Header("ETag", filesystem.FileETag(&fs.FileTarget[0]))
+	filesystem.SetContentTypeHeader(c.Writer.Header(), &fs.FileTarget[0])
+	filesystem.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, fs.FileTarget[0].UpdatedAt, fs.FileTarget[0].Size, rs)
 
 	return serializer.Response{
 		Code: 0,
@@ -315,6 +345,7 @@ func (service *FileIDService) PreviewContent(ctx context.Context, c *gin.Context
 
 	// 获取对象id
 	objectID, _ := c.Get("object_id")
+	ctx = filesystem.WithFileUnlock(ctx, c)
 
 	// 如果上下文中已有File对象，则重设目标
 	if file, ok := ctx.Value(fsctx.FileModelCtx).(*model.File); ok {
@@ -341,6 +372,7 @@ func (service *FileIDService) PreviewContent(ctx context.Context, c *gin.Context
 
 	// 重定向到文件源
 	if resp.Redirect {
+		filesystem.SetPolicyHeaders(c.Writer.Header(), fs.FileTarget[0].GetPolicy())
 		c.Header("Cache-Control", fmt.Sprintf("max-age=%d", resp.MaxAge))
 		return serializer.Response{
 			Code: -301,
@@ -350,18 +382,111 @@ func (service *FileIDService) PreviewContent(ctx context.Context, c *gin.Context
 
 	// 直接返回文件内容
 	defer resp.Content.Close()
+	filesystem.SetContentTypeHeader(c.Writer.Header(), &fs.FileTarget[0])
+
+	// 文档已转换为 PDF 时输出的是 PDF 预览
+	if !isText && fs.FileTarget[0].DocPreviewSource != "" {
+		c.Header("Content-Type", "application/pdf")
+	}
 
 	if isText {
 		c.Header("Cache-Control", "no-cache")
+		// 按上传时检测到的编码声明字符集，以便前端正确解码
+		if stat := filesystem.TextStatOf(&fs.FileTarget[0]); stat != nil && stat.Encoding != "" {
+			c.Header("Content-Type", "text/plain; charset="+stat.Encoding)
+		}
 	}
 
-	http.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, fs.FileTarget[0].UpdatedAt, resp.Content)
+	filesystem.SetPolicyHeaders(c.Writer.Header(), fs.FileTarget[0].GetPolicy())
+	c.Header("ETag", filesystem.FileETag(&fs.FileTarget[0]))
+	filesystem.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, fs.FileTarget[0].UpdatedAt, fs.FileTarget[0].Size, resp.Content)
 
 	return serializer.Response{
 		Code: 0,
 	}
 }
 
+// Set 设定文件的下载密码，密码为空时取消
+func (service *FilePasswordService) Set(ctx context.Context, c *gin.Context) serializer.Response {
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	objectID, _ := c.Get("object_id")
+	if err := fs.SetFilePassword(ctx, objectID.(uint), service.Password); err != nil {
+		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+	}
+
+	return serializer.Response{}
+}
+
+// Unlock 校验文件的下载密码，返回读取文件时使用的解锁凭证
+func (service *FileUnlockService) Unlock(ctx context.Context, c *gin.Context) serializer.Response {
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	objectID, _ := c.Get("object_id")
+	token, err := fs.UnlockFile(ctx, objectID.(uint), service.Password)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+	}
+
+	return serializer.Response{Data: token}
+}
+
+// RestoreArchived 对归档文件发起解冻
+func (service *FileIDService) RestoreArchived(ctx context.Context, c *gin.Context) serializer.Response {
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	objectID, _ := c.Get("object_id")
+	if err := fs.RestoreArchivedFile(ctx, objectID.(uint)); err != nil {
+		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+	}
+
+	return serializer.Response{}
+}
+
+// ListTrash 列出回收站中的文件
+func (service *FileIDService) ListTrash(ctx context.Context, c *gin.Context) serializer.Response {
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	trashes, err := model.ListTrash(fs.User.ID)
+	if err != nil {
+		return serializer.DBErr("Failed to list trashed files", err)
+	}
+
+	return serializer.Response{Data: serializer.BuildTrashList(trashes)}
+}
+
+// RestoreTrashed 将回收站中的文件恢复至原目录
+func (service *FileIDService) RestoreTrashed(ctx context.Context, c *gin.Context) serializer.Response {
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	objectID, _ := c.Get("object_id")
+	if err := fs.RestoreTrashedFile(ctx, objectID.(uint)); err != nil {
+		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+	}
+
+	return serializer.Response{}
+}
+
 // PutContent 更新文件内容
 func (service *FileIDService) PutContent(ctx context.Context, c *gin.Context) serializer.Response {
 	// 创建上下文
@@ -388,6 +513,7 @@ func (service *FileIDService) PutContent(ctx context.Context, c *gin.Context) se
 		return serializer.Err(serializer.CodeCreateFSError, "", err)
 	}
 	uploadCtx := context.WithValue(ctx, fsctx.GinCtx, c)
+	uploadCtx = context.WithValue(uploadCtx, fsctx.ClientIPCtx, c.ClientIP())
 
 	// 取得现有文件
 	fileID, _ := c.Get("object_id")
@@ -409,12 +535,23 @@ func (service *FileIDService) PutContent(ctx context.Context, c *gin.Context) se
 	}
 
 	// 给文件系统分配钩子
+	fs.Use("BeforeUpload", filesystem.HookValidateRetention)
 	fs.Use("BeforeUpload", filesystem.HookResetPolicy)
 	fs.Use("BeforeUpload", filesystem.HookValidateFile)
+	fs.Use("BeforeUpload", filesystem.HookValidateConfiguredMinFileSize)
+	if windows, loc := fs.UploadWindows(); len(windows) > 0 {
+		fs.Use("BeforeUpload", filesystem.HookValidateUploadWindow(windows, loc))
+	}
+	if filesystem.IsUploadRegionPolicyEnabled() {
+		fs.Use("BeforeUpload", filesystem.HookValidateUploadRegion)
+	}
+	fs.Use("BeforeUpload", filesystem.HookValidateEncryptedUpload)
+	fs.Use("BeforeUpload", filesystem.HookValidateMIMEType)
 	fs.Use("BeforeUpload", filesystem.HookValidateCapacityDiff)
 	fs.Use("AfterUploadCanceled", filesystem.HookCleanFileContent)
 	fs.Use("AfterUploadCanceled", filesystem.HookClearFileSize)
 	fs.Use("AfterUpload", filesystem.GenericAfterUpdate)
+	fs.UseUpdateProcessors()
 	fs.Use("AfterValidateFailed", filesystem.HookCleanFileContent)
 	fs.Use("AfterValidateFailed", filesystem.HookClearFileSize)
 
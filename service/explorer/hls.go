@@ -0,0 +1,59 @@
+package explorer
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem"
+	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
+	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/transcode"
+	"github.com/gin-gonic/gin"
+)
+
+// HLSService 视频 HLS 播放服务，Name 为播放列表或分段的文件名
+type HLSService struct {
+	Name string `uri:"name" binding:"required"`
+}
+
+// Serve 输出视频的 HLS 播放列表或分段。分段地址相对于播放列表，与播放列表经过相同的权限检查，
+// 请求携带的文件解锁凭证会附加到各分段地址中
+func (service *HLSService) Serve(ctx context.Context, c *gin.Context) serializer.Response {
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	objectID, _ := c.Get("object_id")
+	ctx = filesystem.WithFileUnlock(ctx, c)
+
+	if service.Name == transcode.HLSPlaylistName {
+		token, _ := ctx.Value(fsctx.FileUnlockCtx).(string)
+		playlist, err := fs.HLSPlaylist(ctx, objectID.(uint), func(segment string) string {
+			if token == "" {
+				return segment
+			}
+			return segment + "?" + url.Values{filesystem.FileUnlockQuery: []string{token}}.Encode()
+		})
+		if err != nil {
+			return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+		}
+
+		c.Header("Cache-Control", "no-cache")
+		c.Data(200, "application/vnd.apple.mpegurl", []byte(playlist))
+		return serializer.Response{}
+	}
+
+	segment, err := fs.HLSSegment(ctx, objectID.(uint), service.Name)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+	}
+	defer segment.Close()
+
+	c.Header("Content-Type", "video/mp2t")
+	c.Status(200)
+	_, _ = io.Copy(c.Writer, segment)
+	return serializer.Response{}
+}
@@ -382,6 +382,14 @@ func (service *ItemPropertyService) GetProperty(ctx context.Context, c *gin.Cont
 		props.UpdatedAt = file[0].UpdatedAt
 		props.Policy = file[0].GetPolicy().Name
 		props.Size = file[0].Size
+		props.UploadClient = file[0].UploadClient
+		if props.UploadClient == "" {
+			props.UploadClient = filesystem.UploadClientUnknown
+		}
+		props.RetainUntil = file[0].RetainUntil
+		props.CaptureDate = filesystem.CaptureTimeOf(&file[0])
+		props.Text = filesystem.TextStatOf(&file[0])
+		props.Video = filesystem.VideoInfoOf(&file[0])
 
 		// 查找父目录
 		if service.TraceRoot {
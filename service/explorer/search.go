@@ -151,3 +151,37 @@ func (service *ItemSearchService) SearchKeywords(c *gin.Context, fs *filesystem.
 		},
 	}
 }
+
+// SimilarImageService 相似图像查找服务
+type SimilarImageService struct {
+	Distance int `form:"distance" binding:"min=0,max=64"`
+}
+
+// Search 查找与给定图像相似的图像，Distance 为 0 时使用默认阈值
+func (service *SimilarImageService) Search(c *gin.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	distance := service.Distance
+	if distance == 0 {
+		distance = model.GetIntSetting("image_phash_distance", 8)
+	}
+
+	objectID, _ := c.Get("object_id")
+	objects, err := fs.FindSimilarImages(context.Background(), objectID.(uint), distance)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+	}
+
+	return serializer.Response{
+		Code: 0,
+		Data: map[string]interface{}{
+			"parent":  0,
+			"objects": objects,
+		},
+	}
+}
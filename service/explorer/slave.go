@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"path"
 	"time"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
@@ -88,7 +89,7 @@ func (service *SlaveDownloadService) ServeFile(ctx context.Context, c *gin.Conte
 	}
 
 	// 发送文件
-	http.ServeContent(c.Writer, c.Request, fs.FileTarget[0].Name, time.Now(), rs)
+	http.ServeContent(filesystem.NewBufferedResponseWriter(c.Writer), c.Request, fs.FileTarget[0].Name, time.Now(), rs)
 
 	return serializer.Response{}
 }
@@ -146,6 +147,37 @@ func (service *SlaveFileService) Thumb(ctx context.Context, c *gin.Context) seri
 	return serializer.Response{}
 }
 
+// GenerateThumb 为从机上的文件重新生成缩略图，返回图像原始尺寸
+func (service *SlaveFileService) GenerateThumb(ctx context.Context) serializer.Response {
+	// 创建文件系统
+	fs, err := filesystem.NewAnonymousFileSystem()
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	// 解码文件路径
+	fileSource, err := base64.RawURLEncoding.DecodeString(service.PathEncoded)
+	if err != nil {
+		return serializer.Err(serializer.CodeFileNotFound, "", err)
+	}
+
+	file := model.File{
+		Name:       path.Base(string(fileSource)),
+		SourceName: string(fileSource),
+	}
+	fs.GenerateThumbnail(ctx, &file)
+
+	switch {
+	case file.ThumbStatus == model.ThumbStatusUnsupported || file.ThumbStatus == model.ThumbStatusDisabled:
+		return serializer.Err(serializer.CodeThumbUnsupported, "", nil)
+	case file.PicInfo == "":
+		return serializer.Err(serializer.CodeNotSet, "Failed to generate thumb", nil)
+	}
+
+	return serializer.Response{Data: file.PicInfo}
+}
+
 // CreateTransferTask 创建从机文件转存任务
 func CreateTransferTask(c *gin.Context, req *serializer.SlaveTransferReq) serializer.Response {
 	if id, ok := c.Get("MasterSiteID"); ok {
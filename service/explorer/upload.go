@@ -2,6 +2,7 @@ package explorer
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/auth"
@@ -11,9 +12,12 @@ import (
 	"github.com/cloudreve/Cloudreve/v3/pkg/filesystem/fsctx"
 	"github.com/cloudreve/Cloudreve/v3/pkg/hashid"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
+	"github.com/cloudreve/Cloudreve/v3/pkg/task"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
 	"github.com/gin-gonic/gin"
 	"io/ioutil"
+	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -21,13 +25,20 @@ import (
 
 // CreateUploadSessionService 获取上传凭证服务
 type CreateUploadSessionService struct {
-	Path         string `json:"path" binding:"required"`
-	Size         uint64 `json:"size" binding:"min=0"`
-	Name         string `json:"name" binding:"required"`
-	PolicyID     string `json:"policy_id" binding:"required"`
-	LastModified int64  `json:"last_modified"`
+	Path         string            `json:"path" binding:"required"`
+	Size         uint64            `json:"size" binding:"min=0"`
+	Name         string            `json:"name" binding:"required"`
+	PolicyID     string            `json:"policy_id" binding:"required"`
+	LastModified int64             `json:"last_modified"`
+	Permission   string            `json:"permission" binding:"omitempty,oneof=private public"`
+	Metadata     map[string]string `json:"metadata"`
+	MD5          string            `json:"md5" binding:"omitempty,len=32,hexadecimal"`
+	StorageClass string            `json:"storage_class"`
 }
 
+// storageClassPattern 上传时可指定的存储类型名称
+var storageClassPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,32}$`)
+
 // Create 创建新的上传会话
 func (service *CreateUploadSessionService) Create(ctx context.Context, c *gin.Context) serializer.Response {
 	// 创建文件系统
@@ -46,16 +57,37 @@ func (service *CreateUploadSessionService) Create(ctx context.Context, c *gin.Co
 		return serializer.Err(serializer.CodePolicyNotAllowed, "存储策略发生变化，请刷新文件列表并重新添加此任务", nil)
 	}
 
+	if service.StorageClass != "" && !storageClassPattern.MatchString(service.StorageClass) {
+		return serializer.ParamErr("Invalid storage class", nil)
+	}
+
 	file := &fsctx.FileStream{
-		Size:        service.Size,
-		Name:        service.Name,
-		VirtualPath: service.Path,
-		File:        ioutil.NopCloser(strings.NewReader("")),
+		Size:         service.Size,
+		Name:         service.Name,
+		VirtualPath:  service.Path,
+		File:         ioutil.NopCloser(strings.NewReader("")),
+		StorageClass: service.StorageClass,
 	}
 	if service.LastModified > 0 {
 		lastModified := time.UnixMilli(service.LastModified)
 		file.LastModified = &lastModified
 	}
+
+	// 元数据可在请求正文或请求头中提供
+	file.Metadata = service.Metadata
+	if file.Metadata == nil {
+		if file.Metadata, err = filesystem.ParseUploadMetadata(c.Request); err != nil {
+			return serializer.Err(serializer.CodeParamErr, err.Error(), err)
+		}
+	}
+	ctx = context.WithValue(ctx, fsctx.ClientIPCtx, c.ClientIP())
+	ctx = context.WithValue(ctx, fsctx.UploadClientCtx, filesystem.DetectUploadClient(c.Request))
+	if service.Permission != "" {
+		ctx = context.WithValue(ctx, fsctx.UploadPermissionCtx, service.Permission)
+	}
+	if service.MD5 != "" {
+		ctx = context.WithValue(ctx, fsctx.UploadChecksumCtx, service.MD5)
+	}
 	credential, err := fs.CreateUploadSession(ctx, file)
 	if err != nil {
 		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
@@ -91,6 +123,10 @@ func (service *UploadService) LocalUpload(ctx context.Context, c *gin.Context) s
 		return serializer.Err(serializer.CodeUploadSessionExpired, "", nil)
 	}
 
+	if err := filesystem.ValidateUploadSessionIP(&uploadSession, c.ClientIP()); err != nil {
+		return serializer.Err(serializer.CodeUploadSessionIPMismatch, err.Error(), err)
+	}
+
 	// 查找上传会话创建的占位文件
 	file, err := model.GetFilesByUploadSession(service.ID, fs.User.ID)
 	if err != nil {
@@ -173,9 +209,13 @@ func processChunkUpload(ctx context.Context, c *gin.Context, fs *filesystem.File
 		mode |= fsctx.Overwrite
 	}
 
+	// 服务端强制的上传时限，防止慢速客户端无限期占用连接
+	ctx, cancel := filesystem.WithUploadDeadline(ctx, fileSize)
+	defer cancel()
+
 	fileData := fsctx.FileStream{
 		MIMEType:     c.Request.Header.Get("Content-Type"),
-		File:         c.Request.Body,
+		File:         filesystem.NewContextReader(ctx, c.Request.Body),
 		Size:         fileSize,
 		Name:         session.Name,
 		VirtualPath:  session.VirtualPath,
@@ -189,18 +229,31 @@ func processChunkUpload(ctx context.Context, c *gin.Context, fs *filesystem.File
 	// 给文件系统分配钩子
 	fs.Use("AfterUploadCanceled", filesystem.HookTruncateFileTo(fileData.AppendStart))
 	fs.Use("AfterValidateFailed", filesystem.HookTruncateFileTo(fileData.AppendStart))
+	fs.Use("BeforeUpload", filesystem.HookValidateEncryptedUpload)
+	fs.Use("BeforeUpload", filesystem.HookValidateMIMEType)
 
 	if file != nil {
 		fs.Use("BeforeUpload", filesystem.HookValidateCapacity)
 		fs.Use("AfterUpload", filesystem.HookChunkUploaded)
 		fs.Use("AfterValidateFailed", filesystem.HookChunkUploadFailed)
 		if isLastChunk {
+			fs.Use("AfterUpload", filesystem.HookCommitAppendBuffer)
+			fs.Use("AfterUpload", filesystem.HookVerifyChecksum(session.MD5))
+			fs.Use("AfterUpload", filesystem.HookValidateUniqueContent)
+			fs.Use("AfterUpload", filesystem.HookContentAddress)
 			fs.Use("AfterUpload", filesystem.HookPopPlaceholderToFile(""))
-			fs.Use("AfterUpload", filesystem.HookGenerateThumb)
+			fs.Use("AfterUpload", filesystem.HookApplyUploadPermission(session.Permission))
+			fs.UseUploadProcessors(true)
+			fs.Use("AfterUpload", task.HookTranscodeVideo)
+			fs.Use("AfterUpload", task.HookGenerateDocPreview)
+			fs.Use("AfterUpload", task.HookGenerateHLS)
 			fs.Use("AfterUpload", filesystem.HookDeleteUploadSession(session.Key))
 		}
 	} else {
 		if isLastChunk {
+			fs.Use("AfterUpload", filesystem.HookCommitAppendBuffer)
+			// 扫描须先于回调，使主机只接收扫描通过的文件
+			fs.Use("AfterUpload", filesystem.HookSlaveScanBeforeCallback(session))
 			fs.Use("AfterUpload", filesystem.SlaveAfterUpload(session))
 			fs.Use("AfterUpload", filesystem.HookDeleteUploadSession(session.Key))
 		}
@@ -208,14 +261,59 @@ func processChunkUpload(ctx context.Context, c *gin.Context, fs *filesystem.File
 
 	// 执行上传
 	uploadCtx := context.WithValue(ctx, fsctx.GinCtx, c)
+
+	// 从机的暂存位置总是本机，不使用主机的暂存设定
+	if file != nil {
+		uploadCtx = filesystem.WithUploadStaging(uploadCtx, session)
+	}
+
+	// 客户端要求同步完成后处理时，跟踪后处理任务以便等待结果
+	var waiter *filesystem.PostProcessWaiter
+	if file != nil && isLastChunk && c.Query("finalize") == "sync" {
+		waiter = &filesystem.PostProcessWaiter{}
+		uploadCtx = context.WithValue(uploadCtx, fsctx.PostProcessWaiterCtx, waiter)
+	}
+
 	err = fs.Upload(uploadCtx, &fileData)
 	if err != nil {
+		if file != nil && filesystem.ShouldDiscardUpload(err) {
+			fs.DiscardCorruptedUpload(ctx, file)
+		}
 		return serializer.Err(serializer.CodeUploadFailed, err.Error(), err)
 	}
 
+	if waiter != nil {
+		timeout := time.Duration(model.GetIntSetting("upload_finalize_timeout", 30)) * time.Second
+		return serializer.Response{Data: finalizeUploadResult(file, fs.User.ID, !waiter.Wait(timeout))}
+	}
+
 	return serializer.Response{}
 }
 
+// finalizeUploadResult 返回文件后处理的结果。处理超时时后台任务仍可能修改 file，
+// 此时改为从数据库读取当前结果
+func finalizeUploadResult(file *model.File, uid uint, pending bool) *serializer.UploadFinalizeResult {
+	if pending {
+		files, err := model.GetFilesByIDs([]uint{file.ID}, uid)
+		if err != nil || len(files) == 0 {
+			return &serializer.UploadFinalizeResult{Pending: true}
+		}
+		file = &files[0]
+	}
+
+	res := &serializer.UploadFinalizeResult{
+		Pending:     pending,
+		ThumbStatus: file.ThumbStatus,
+		PicInfo:     file.PicInfo,
+		MD5:         file.MD5,
+	}
+	if file.PHash != 0 {
+		res.PHash = fmt.Sprintf("%016x", uint64(file.PHash))
+	}
+
+	return res
+}
+
 // UploadSessionService 上传会话服务
 type UploadSessionService struct {
 	ID string `uri:"sessionId" binding:"required"`
@@ -289,3 +387,162 @@ func DeleteAllUploadSession(ctx context.Context, c *gin.Context) serializer.Resp
 
 	return serializer.Response{}
 }
+
+// URLUploadService 远程URL上传服务
+type URLUploadService struct {
+	URL  string `json:"url" binding:"required,max=65535"`
+	Path string `json:"path" binding:"required,min=1,max=65535"`
+	Name string `json:"name" binding:"max=255"`
+}
+
+// Upload 创建由服务端下载远程文件并保存到用户文件系统的任务，中断后可从已下载的位置继续
+func (service *URLUploadService) Upload(c *gin.Context, user *model.User) serializer.Response {
+	job, err := task.NewFetchTask(user, service.URL, service.Path, service.Name, c.ClientIP())
+	if err != nil {
+		return serializer.DBErr("Failed to create task record.", err)
+	}
+	task.TaskPoll.Submit(job)
+
+	return serializer.Response{Data: hashid.HashID(job.Model().ID, hashid.TaskID)}
+}
+
+// URLUploadTaskService 远程URL上传任务服务
+type URLUploadTaskService struct {
+	ID string `uri:"task" binding:"required"`
+}
+
+// Get 获取远程URL上传任务的状态与进度
+func (service *URLUploadTaskService) Get(c *gin.Context, user *model.User) serializer.Response {
+	id, err := hashid.DecodeHashID(service.ID, hashid.TaskID)
+	if err != nil {
+		return serializer.ParamErr("Failed to parse task ID", err)
+	}
+
+	record, err := model.GetTasksByID(id)
+	if err != nil || record.UserID != user.ID || record.Type != task.FetchTaskType {
+		return serializer.Err(serializer.CodeNotFound, "Task not exist", err)
+	}
+
+	var props task.FetchProps
+	if err := json.Unmarshal([]byte(record.Props), &props); err != nil {
+		return serializer.Err(serializer.CodeInternalSetting, "Failed to parse task props", err)
+	}
+
+	return serializer.Response{Data: map[string]interface{}{
+		"status":    record.Status,
+		"progress":  record.Progress,
+		"error":     record.Error,
+		"url":       props.URL,
+		"dst":       props.Dst,
+		"name":      props.Name,
+		"size":      props.Size,
+		"fetched":   props.Fetched,
+		"resumable": props.Resumable,
+	}}
+}
+
+// BatchUploadService 单次请求上传多个文件服务
+type BatchUploadService struct {
+	Path string `form:"path" binding:"required,min=1,max=65535"`
+}
+
+// batchUploadFormOverhead 批量上传请求中表单字段及分隔符允许占用的额外字节数
+const batchUploadFormOverhead = 1 << 20
+
+// Upload 解析 multipart 请求中的全部文件并逐个上传，返回每个文件的结果
+func (service *BatchUploadService) Upload(ctx context.Context, c *gin.Context) serializer.Response {
+	fs, err := filesystem.NewFileSystemFromContext(c)
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	maxFiles := model.GetIntSetting("upload_batch_max_files", 50)
+	maxSize := uint64(model.GetIntSetting("upload_batch_max_size", 104857600))
+
+	// 限制请求正文大小，超出时解析失败
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxSize)+batchUploadFormOverhead)
+	form, err := c.MultipartForm()
+	if err != nil {
+		return serializer.Err(serializer.CodeBatchUploadSize, "Failed to parse multipart form", err)
+	}
+	defer form.RemoveAll()
+
+	headers := form.File["files"]
+	if len(headers) == 0 {
+		return serializer.ParamErr("No file in request", nil)
+	}
+
+	if len(headers) > maxFiles {
+		return serializer.Err(serializer.CodeBatchUploadSize, fmt.Sprintf("At most %d files can be uploaded at once", maxFiles), nil)
+	}
+
+	var total uint64
+	for _, header := range headers {
+		total += uint64(header.Size)
+	}
+	if total > maxSize {
+		return serializer.Err(serializer.CodeBatchUploadSize, fmt.Sprintf("Total size of files exceeds %d bytes", maxSize), nil)
+	}
+
+	metadata, err := filesystem.ParseUploadMetadata(c.Request)
+	if err != nil {
+		return serializer.Err(serializer.CodeParamErr, err.Error(), err)
+	}
+
+	res := make([]serializer.BatchUploadResult, len(headers))
+	files := make([]*fsctx.FileStream, 0, len(headers))
+	index := make([]int, 0, len(headers))
+	for i, header := range headers {
+		res[i].Name = header.Filename
+		file, err := header.Open()
+		if err != nil {
+			failed := serializer.Err(serializer.CodeIOFailed, "Failed to read file data", err)
+			res[i].Code, res[i].Error = failed.Code, failed.Msg
+			continue
+		}
+
+		files = append(files, &fsctx.FileStream{
+			File:        file,
+			Seeker:      file,
+			Size:        uint64(header.Size),
+			MIMEType:    header.Header.Get("Content-Type"),
+			Name:        header.Filename,
+			VirtualPath: service.Path,
+			Metadata:    metadata,
+		})
+		index = append(index, i)
+	}
+
+	ctx = context.WithValue(ctx, fsctx.HTTPCtx, c.Request.Context())
+	ctx = context.WithValue(ctx, fsctx.UploadClientCtx, filesystem.DetectUploadClient(c.Request))
+	ctx = context.WithValue(ctx, fsctx.ClientIPCtx, c.ClientIP())
+	errs := fs.UploadBatch(ctx, files)
+
+	succeed := 0
+	for i, err := range errs {
+		current := &res[index[i]]
+		if err != nil {
+			failed := serializer.Err(serializer.CodeUploadFailed, err.Error(), err)
+			current.Code, current.Error = failed.Code, failed.Msg
+			continue
+		}
+
+		if file, ok := files[i].Model.(*model.File); ok {
+			current.ID = hashid.HashID(file.ID, hashid.FileID)
+		}
+		succeed++
+	}
+
+	if succeed < len(res) {
+		return serializer.Response{
+			Code: serializer.CodeNotFullySuccess,
+			Data: res,
+		}
+	}
+
+	return serializer.Response{
+		Code: 0,
+		Data: res,
+	}
+}
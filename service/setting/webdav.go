@@ -4,6 +4,7 @@ import (
 	model "github.com/cloudreve/Cloudreve/v3/models"
 	"github.com/cloudreve/Cloudreve/v3/pkg/serializer"
 	"github.com/cloudreve/Cloudreve/v3/pkg/util"
+	"github.com/cloudreve/Cloudreve/v3/pkg/webdav"
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,8 +19,10 @@ type WebDAVAccountService struct {
 
 // WebDAVAccountCreateService WebDAV 账号创建服务
 type WebDAVAccountCreateService struct {
-	Path string `json:"path" binding:"required,min=1,max=65535"`
-	Name string `json:"name" binding:"required,min=1,max=255"`
+	Path        string `json:"path" binding:"required,min=1,max=65535"`
+	Name        string `json:"name" binding:"required,min=1,max=255"`
+	Charset     string `json:"charset" binding:"max=32"`
+	EncodeNames bool   `json:"encode_names"`
 }
 
 // WebDAVMountCreateService WebDAV 挂载创建服务
@@ -30,11 +33,17 @@ type WebDAVMountCreateService struct {
 
 // Create 创建WebDAV账户
 func (service *WebDAVAccountCreateService) Create(c *gin.Context, user *model.User) serializer.Response {
+	if service.Charset != "" && !webdav.IsSupportedCharset(service.Charset) {
+		return serializer.ParamErr("Unsupported charset", nil)
+	}
+
 	account := model.Webdav{
-		Name:     service.Name,
-		Password: util.RandStringRunes(32),
-		UserID:   user.ID,
-		Root:     service.Path,
+		Name:        service.Name,
+		Password:    util.RandStringRunes(32),
+		UserID:      user.ID,
+		Root:        service.Path,
+		Charset:     service.Charset,
+		EncodeNames: service.EncodeNames,
 	}
 
 	if _, err := account.Create(); err != nil {
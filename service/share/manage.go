@@ -104,6 +104,8 @@ func (service *ShareCreateService) Create(c *gin.Context) serializer.Response {
 		file, err := model.GetFilesByIDs([]uint{sourceID}, user.ID)
 		if err != nil || len(file) == 0 {
 			exist = false
+		} else if file[0].IsPendingApproval() {
+			return serializer.Err(serializer.CodePendingApproval, "File is pending approval", nil)
 		} else {
 			sourceName = file[0].Name
 		}
@@ -33,6 +33,12 @@ type Service struct {
 	Path string `form:"path" uri:"path" binding:"max=65535"`
 }
 
+// FileUnlockService 解锁分享中设有下载密码的文件的服务
+type FileUnlockService struct {
+	Path     string `json:"path" binding:"max=65535"`
+	Password string `json:"password" binding:"required,max=255"`
+}
+
 // ArchiveService 分享归档下载服务
 type ArchiveService struct {
 	Path  string   `json:"path" binding:"required,max=65535"`
@@ -163,7 +169,8 @@ func (service *Service) CreateDownloadSession(c *gin.Context) serializer.Respons
 		return serializer.Err(serializer.CodeFileNotFound, "", err)
 	}
 
-	ctx := context.Background()
+	ctx := filesystem.WithShareDownload(context.Background(), share, user, c)
+	ctx = filesystem.WithFileUnlock(ctx, c)
 
 	// 重设根目录
 	if share.IsDir {
@@ -188,11 +195,47 @@ func (service *Service) CreateDownloadSession(c *gin.Context) serializer.Respons
 	}
 }
 
+// Unlock 校验分享中文件的下载密码，返回读取文件时使用的解锁凭证
+func (service *FileUnlockService) Unlock(c *gin.Context) serializer.Response {
+	shareCtx, _ := c.Get("share")
+	share := shareCtx.(*model.Share)
+
+	// 创建文件系统
+	fs, err := filesystem.NewFileSystem(share.Creator())
+	if err != nil {
+		return serializer.Err(serializer.CodeCreateFSError, "", err)
+	}
+	defer fs.Recycle()
+
+	// 重设文件系统处理目标为源文件
+	err = fs.SetTargetByInterface(share.Source())
+	if err != nil {
+		return serializer.Err(serializer.CodeFileNotFound, "", err)
+	}
+
+	ctx := context.Background()
+	if share.IsDir {
+		fs.Root = &fs.DirTarget[0]
+		if err := fs.ResetFileIfNotExist(ctx, service.Path); err != nil {
+			return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+		}
+	}
+
+	token, err := fs.UnlockFile(ctx, 0, service.Password)
+	if err != nil {
+		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+	}
+
+	return serializer.Response{Data: token}
+}
+
 // PreviewContent 预览文件，需要登录会话, isText - 是否为文本文件，文本文件会
 // 强制经由服务端中转
 func (service *Service) PreviewContent(ctx context.Context, c *gin.Context, isText bool) serializer.Response {
 	shareCtx, _ := c.Get("share")
 	share := shareCtx.(*model.Share)
+	userCtx, _ := c.Get("user")
+	ctx = filesystem.WithShareDownload(ctx, share, userCtx.(*model.User), c)
 
 	// 用于调下层service
 	if share.IsDir {
@@ -210,9 +253,10 @@ func (service *Service) PreviewContent(ctx context.Context, c *gin.Context, isTe
 func (service *Service) CreateDocPreviewSession(c *gin.Context) serializer.Response {
 	shareCtx, _ := c.Get("share")
 	share := shareCtx.(*model.Share)
+	userCtx, _ := c.Get("user")
 
 	// 用于调下层service
-	ctx := context.Background()
+	ctx := filesystem.WithShareDownload(context.Background(), share, userCtx.(*model.User), c)
 	if share.IsDir {
 		ctx = context.WithValue(ctx, fsctx.FolderModelCtx, share.Source())
 		ctx = context.WithValue(ctx, fsctx.PathCtx, service.Path)
@@ -293,6 +337,7 @@ func (service *Service) Thumb(c *gin.Context) serializer.Response {
 	}
 
 	ctx := context.WithValue(context.Background(), fsctx.LimitParentCtx, parent)
+	ctx = filesystem.WithFileUnlock(ctx, c)
 
 	// 获取文件ID
 	fileID, err := hashid.DecodeHashID(c.Param("file"), hashid.FileID)
@@ -354,6 +399,11 @@ func (service *ArchiveService) Archive(c *gin.Context) serializer.Response {
 	// 限制操作范围为父目录下
 	ctx := context.WithValue(context.Background(), fsctx.LimitParentCtx, parent)
 
+	// 打包文件稍后由独立的请求读取，在此计入分享的下载次数
+	if err := filesystem.CountShareDownload(filesystem.WithShareDownload(ctx, share, user, c)); err != nil {
+		return serializer.Err(serializer.CodeNotSet, err.Error(), err)
+	}
+
 	// 用于调下层service
 	tempUser := share.Creator()
 	tempUser.Group.OptionsSerialized.ArchiveDownload = true
@@ -52,8 +52,7 @@ func (service *UserResetService) Reset(c *gin.Context) serializer.Response {
 		return serializer.Err(serializer.CodeUserNotFound, "User not found", nil)
 	}
 
-	user.SetPassword(service.Password)
-	if err := user.Update(map[string]interface{}{"password": user.Password}); err != nil {
+	if err := user.ChangePassword(service.Password); err != nil {
 		return serializer.DBErr("Failed to reset password", err)
 	}
 
@@ -112,7 +111,8 @@ func (service *Enable2FA) Login(c *gin.Context) serializer.Response {
 		//登陆成功，清空并设置session
 		util.DeleteSession(c, "2fa_user_id")
 		util.SetSession(c, map[string]interface{}{
-			"user_id": expectedUser.ID,
+			"user_id":       expectedUser.ID,
+			"session_epoch": expectedUser.SessionEpoch,
 		})
 
 		return serializer.BuildUserResponse(expectedUser)
@@ -148,7 +148,8 @@ func (service *UserLoginService) Login(c *gin.Context) serializer.Response {
 
 	//登陆成功，清空并设置session
 	util.SetSession(c, map[string]interface{}{
-		"user_id": expectedUser.ID,
+		"user_id":       expectedUser.ID,
+		"session_epoch": expectedUser.SessionEpoch,
 	})
 
 	return serializer.BuildUserResponse(expectedUser)
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	model "github.com/cloudreve/Cloudreve/v3/models"
@@ -16,6 +17,9 @@ import (
 	"github.com/pquerna/otp/totp"
 )
 
+// storageClassPattern 可设定的存储类型名称
+var storageClassPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,32}$`)
+
 // SettingService 通用设置服务
 type SettingService struct {
 }
@@ -25,6 +29,11 @@ type SettingListService struct {
 	Page int `form:"page" binding:"required,min=1"`
 }
 
+// NotificationReadService 站内通知标记已读服务
+type NotificationReadService struct {
+	ID []uint `json:"id"`
+}
+
 // AvatarService 头像服务
 type AvatarService struct {
 	Size string `uri:"size" binding:"required,eq=l|eq=m|eq=s"`
@@ -59,6 +68,8 @@ type HomePage struct {
 type PasswordChange struct {
 	Old string `json:"old" binding:"required,min=4,max=64"`
 	New string `json:"new" binding:"required,min=4,max=64"`
+	// KeepSession 是否保留当前会话，否则当前会话也将随其他会话一同失效
+	KeepSession bool `json:"keep_session"`
 }
 
 // Enable2FA 开启二步验证
@@ -71,6 +82,14 @@ type DeleteWebAuthn struct {
 	ID string `json:"id" binding:"required"`
 }
 
+// LifecycleChange 设定上传文件默认的存储类型及生命周期规则
+type LifecycleChange struct {
+	StorageClass    string `json:"storage_class" binding:"max=32"`
+	TransitionDays  int    `json:"transition_days" binding:"min=0"`
+	TransitionClass string `json:"transition_class" binding:"max=32"`
+	ExpireDays      int    `json:"expire_days" binding:"min=0"`
+}
+
 // ThemeChose 主题选择
 type ThemeChose struct {
 	Theme string `json:"theme" binding:"required,hexcolor|rgb|rgba|hsl"`
@@ -88,6 +107,40 @@ func (service *ThemeChose) Update(c *gin.Context, user *model.User) serializer.R
 	return serializer.Response{}
 }
 
+// Update 更新存储类型及生命周期设定，仅对此后上传的文件生效
+func (service *LifecycleChange) Update(c *gin.Context, user *model.User) serializer.Response {
+	for _, class := range []string{service.StorageClass, service.TransitionClass} {
+		if class != "" && !storageClassPattern.MatchString(class) {
+			return serializer.ParamErr("Invalid storage class", nil)
+		}
+	}
+
+	if service.TransitionDays > 0 && service.TransitionClass == "" {
+		return serializer.ParamErr("Target storage class of transition is required", nil)
+	}
+
+	if service.ExpireDays > 0 && service.TransitionDays >= service.ExpireDays {
+		return serializer.ParamErr("Files must be transitioned before they expire", nil)
+	}
+
+	rule := &model.LifecycleRule{
+		TransitionDays:  service.TransitionDays,
+		TransitionClass: service.TransitionClass,
+		ExpireDays:      service.ExpireDays,
+	}
+	if rule.IsEmpty() {
+		rule = nil
+	}
+
+	user.OptionsSerialized.StorageClass = service.StorageClass
+	user.OptionsSerialized.Lifecycle = rule
+	if err := user.UpdateOptions(); err != nil {
+		return serializer.DBErr("Failed to update user preferences", err)
+	}
+
+	return serializer.Response{}
+}
+
 // Update 删除凭证
 func (service *DeleteWebAuthn) Update(c *gin.Context, user *model.User) serializer.Response {
 	user.RemoveAuthn(service.ID)
@@ -147,11 +200,18 @@ func (service *PasswordChange) Update(c *gin.Context, user *model.User) serializ
 	}
 
 	// 更改为新密码
-	user.SetPassword(service.New)
-	if err := user.Update(map[string]interface{}{"password": user.Password}); err != nil {
+	if err := user.ChangePassword(service.New); err != nil {
 		return serializer.DBErr("Failed to update password", err)
 	}
 
+	// 以新的会话纪元重新签发当前会话
+	if service.KeepSession {
+		util.SetSession(c, map[string]interface{}{
+			"user_id":       user.ID,
+			"session_epoch": user.SessionEpoch,
+		})
+	}
+
 	return serializer.Response{}
 }
 
@@ -245,16 +305,33 @@ func (service *SettingListService) ListTasks(c *gin.Context, user *model.User) s
 	return serializer.BuildTaskList(tasks, total)
 }
 
+// ListNotifications 列出站内通知
+func (service *SettingListService) ListNotifications(c *gin.Context, user *model.User) serializer.Response {
+	notifications, total, unread := model.ListNotifications(user.ID, service.Page, 10)
+	return serializer.BuildNotificationList(notifications, total, unread)
+}
+
+// MarkRead 将站内通知标记为已读，未指定通知时标记全部
+func (service *NotificationReadService) MarkRead(c *gin.Context, user *model.User) serializer.Response {
+	if err := model.MarkNotificationsRead(user.ID, service.ID); err != nil {
+		return serializer.DBErr("Failed to update notifications", err)
+	}
+
+	return serializer.Response{}
+}
+
 // Settings 获取用户设定
 func (service *SettingService) Settings(c *gin.Context, user *model.User) serializer.Response {
 	return serializer.Response{
 		Data: map[string]interface{}{
-			"uid":          user.ID,
-			"homepage":     !user.OptionsSerialized.ProfileOff,
-			"two_factor":   user.TwoFactor != "",
-			"prefer_theme": user.OptionsSerialized.PreferredTheme,
-			"themes":       model.GetSettingByName("themes"),
-			"authn":        serializer.BuildWebAuthnList(user.WebAuthnCredentials()),
+			"uid":           user.ID,
+			"homepage":      !user.OptionsSerialized.ProfileOff,
+			"two_factor":    user.TwoFactor != "",
+			"prefer_theme":  user.OptionsSerialized.PreferredTheme,
+			"storage_class": user.OptionsSerialized.StorageClass,
+			"lifecycle":     user.OptionsSerialized.Lifecycle,
+			"themes":        model.GetSettingByName("themes"),
+			"authn":         serializer.BuildWebAuthnList(user.WebAuthnCredentials()),
 		},
 	}
 }